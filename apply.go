@@ -0,0 +1,661 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+	"github.com/eloquence-cloud/ch/chlib/reply"
+	"github.com/eloquence-cloud/ch/chlib/subcmd"
+)
+
+// maxAttachedFiles bounds the record of attached files; the files attached
+// longest ago are forgotten first.
+const maxAttachedFiles = 1000
+
+// attachedFiles is the record of the local files rendered with -file-ids:
+// for each file ID, the file's path and the SHA-256 of the content it was
+// rendered with, in index.json, and a copy of that content under content/,
+// named by its SHA-256. ch apply reads it to find the file a reply means by
+// ID, to notice if the file has changed since, and to merge the changes.
+type attachedFiles struct {
+	dir string
+}
+
+type attachedFile struct {
+	Path     string    `json:"path"`
+	SHA256   string    `json:"sha256"`
+	Attached time.Time `json:"attached"`
+}
+
+// defaultAttachedFiles returns the record in the data directory.
+func defaultAttachedFiles() (attachedFiles, error) {
+	dir, err := dataDir()
+	if err != nil {
+		return attachedFiles{}, err
+	}
+	return attachedFiles{dir: filepath.Join(dir, "attached")}, nil
+}
+
+func (a attachedFiles) index() string {
+	return filepath.Join(a.dir, "index.json")
+}
+
+func (a attachedFiles) contentPath(sum string) string {
+	return filepath.Join(a.dir, "content", sum)
+}
+
+// content returns the recorded content with the SHA-256 sum.
+func (a attachedFiles) content(sum string) ([]byte, error) {
+	return os.ReadFile(a.contentPath(sum))
+}
+
+// load returns the recorded files by ID.
+func (a attachedFiles) load() (map[string]attachedFile, error) {
+	files := map[string]attachedFile{}
+	data, err := os.ReadFile(a.index())
+	if errors.Is(err, os.ErrNotExist) {
+		return files, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &files); err != nil {
+		return nil, fmt.Errorf("%s is corrupt: %v", a.index(), err)
+	}
+	return files, nil
+}
+
+// record adds the local files among entries to the record, as attached at
+// now.
+func (a attachedFiles) record(entries []entry.Entry, now time.Time) error {
+	files, err := a.load()
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		file, ok := entry.Unwrap(e).(entry.File)
+		if !ok || file.ID() == "" {
+			continue
+		}
+		path, err := filepath.Abs(file.StoragePath)
+		if err != nil {
+			return err
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		sum, err := entry.HashContent(bytes.NewReader(content))
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(a.contentPath(sum)); err != nil {
+			if err := writeFileAtomically(a.contentPath(sum), content); err != nil {
+				return err
+			}
+		}
+		files[file.ID()] = attachedFile{Path: path, SHA256: sum, Attached: now}
+	}
+	for len(files) > maxAttachedFiles {
+		oldest := ""
+		for id, file := range files {
+			if oldest == "" || file.Attached.Before(files[oldest].Attached) {
+				oldest = id
+			}
+		}
+		delete(files, oldest)
+	}
+
+	data, err := json.MarshalIndent(files, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomically(a.index(), append(data, '\n')); err != nil {
+		return err
+	}
+	a.prune(files)
+	return nil
+}
+
+// prune removes the recorded content that no recorded file has any more.
+func (a attachedFiles) prune(files map[string]attachedFile) {
+	kept := map[string]bool{}
+	for _, file := range files {
+		kept[file.SHA256] = true
+	}
+	stored, _ := os.ReadDir(filepath.Join(a.dir, "content"))
+	for _, s := range stored {
+		if !kept[s.Name()] {
+			os.Remove(a.contentPath(s.Name()))
+		}
+	}
+}
+
+// writeFileAtomically writes a private file by writing a temporary file
+// and renaming it, so that concurrent runs never see half of it.
+func writeFileAtomically(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	temp := fmt.Sprintf("%s.%d", path, os.Getpid())
+	if err := os.WriteFile(temp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(temp, path)
+}
+
+// recordAttachedFiles records the local files among entries, which are
+// rendered with their IDs, for ch apply. A failure only costs ch apply the
+// IDs, so it is logged rather than returned.
+func recordAttachedFiles(entries []entry.Entry) {
+	a, err := defaultAttachedFiles()
+	if err == nil {
+		err = a.record(entries, time.Now())
+	}
+	if err != nil {
+		slog.Warn("failed to record attached files for ch apply", "error", err)
+	}
+}
+
+// replyInstructions returns the instructions that -reply-format adds to
+// the end of the output, kept from any budget's trimming.
+func replyInstructions(format string) (entry.Entry, error) {
+	text, err := reply.Instructions(format)
+	if err != nil {
+		return nil, err
+	}
+	return entry.Prioritized{Entry: entry.Message{Text: strings.TrimSuffix(text, "\n")}, Priority: entry.PriorityHigh}, nil
+}
+
+// hashFile returns the hex SHA-256 of the file at path.
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	return entry.HashContent(file)
+}
+
+// fileWrite is a file that ch apply writes.
+type fileWrite struct {
+	path    string
+	content string
+	// recorded is the file as it was attached, if it was.
+	recorded attachedFile
+	// patched is set if content came from applying a diff to the file as
+	// it is now, rather than from the reply alone.
+	patched bool
+	// notes explain how the path or content was arrived at.
+	notes []string
+}
+
+// conflict describes how the file that w replaces has changed since it was
+// attached, or returns "" if it hasn't, or wasn't attached. A patched
+// file has no conflict, since the diff was applied to its changes.
+func (w fileWrite) conflict() (string, error) {
+	if w.recorded.SHA256 == "" || w.patched {
+		return "", nil
+	}
+	sum, err := hashFile(w.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "was removed after it was attached", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if sum != w.recorded.SHA256 {
+		return fmt.Sprintf("changed after it was attached (%s)", w.recorded.Attached.Format("2006-01-02 15:04")), nil
+	}
+	return "", nil
+}
+
+// resolveWrites decides where each proposed file and patch goes. A file
+// with an ID goes to the file recorded under that ID, whatever path the
+// reply gives it, so that a renamed or similarly named file can't be
+// written in its place; an ID that isn't recorded is an error rather than
+// a guess. A file with only a path goes to that path, as long as it is one
+// ch attached or lies within the working directory or its repository. A
+// patch is applied to the file as it is now.
+func resolveWrites(proposed []reply.File, patches []reply.Patch, records map[string]attachedFile) ([]fileWrite, error) {
+	var writes []fileWrite
+	for _, file := range proposed {
+		write, err := resolveTarget(file.ID, file.Path, records)
+		if err != nil {
+			return nil, err
+		}
+		write.content = file.Content
+		writes = append(writes, write)
+	}
+	for _, patch := range patches {
+		write, err := resolveTarget(patch.ID, patch.Path, records)
+		if err != nil {
+			return nil, err
+		}
+		if write.content, err = applyPatch(write.path, patch); err != nil {
+			return nil, err
+		}
+		write.patched = true
+		writes = append(writes, write)
+	}
+	seen := map[string]bool{}
+	for _, write := range writes {
+		key, err := filepath.Abs(write.path)
+		if err != nil {
+			return nil, err
+		}
+		if seen[key] {
+			return nil, fmt.Errorf("the reply proposes %s more than once", write.path)
+		}
+		seen[key] = true
+	}
+	return writes, nil
+}
+
+// resolveTarget returns a write, without content, to the file a reply
+// gives with id and path.
+func resolveTarget(id, path string, records map[string]attachedFile) (fileWrite, error) {
+	write := fileWrite{path: path}
+	if id != "" {
+		record, ok := records[id]
+		if !ok {
+			return fileWrite{}, fmt.Errorf("the reply's %s has file ID %s, which ch has no record of attaching; render the prompt with -file-ids", cmp.Or(path, "file"), id)
+		}
+		write.path, write.recorded = record.Path, record
+		if path != "" && !samePath(path, record.Path) {
+			write.notes = append(write.notes, fmt.Sprintf("the reply calls it %s, but ID %s is %s", path, id, record.Path))
+		}
+		return write, nil
+	}
+	// A file named by path may still have been attached.
+	key, err := filepath.Abs(path)
+	if err != nil {
+		return fileWrite{}, err
+	}
+	write.recorded = records[entry.FileID(key)]
+	if write.recorded.Path == "" && !confined(path) {
+		return fileWrite{}, fmt.Errorf("the reply writes %s, which is outside the working directory and its repository; give the file an ID with -file-ids to write it there", path)
+	}
+	return write, nil
+}
+
+// confined reports whether path is relative and lies within the working
+// directory or the top of the git repository containing it.
+func confined(path string) bool {
+	if filepath.IsAbs(path) {
+		return false
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return false
+	}
+	abs := filepath.Join(cwd, path)
+	// The file may not exist yet, so resolve its directory instead.
+	abs = filepath.Join(resolvePath(filepath.Dir(abs)), filepath.Base(abs))
+	roots := []string{resolvePath(cwd)}
+	if root, err := runGit(".", "rev-parse", "--show-toplevel"); err == nil {
+		roots = append(roots, resolvePath(root))
+	}
+	for _, root := range roots {
+		rel, err := filepath.Rel(root, abs)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyPatch returns the content of the file at path with patch applied.
+func applyPatch(path string, patch reply.Patch) (string, error) {
+	if patch.Deletes() {
+		return "", fmt.Errorf("the reply deletes %s, and ch apply does not delete files", path)
+	}
+	current, err := os.ReadFile(path)
+	switch {
+	case patch.Creates() && err == nil:
+		return "", fmt.Errorf("the reply creates %s, which already exists", path)
+	case patch.Creates() && errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return "", fmt.Errorf("failed to read %s to patch it: %v", path, err)
+	}
+	content, err := patch.Patch.Apply(string(current))
+	if err != nil {
+		return "", fmt.Errorf("failed to patch %s: %v", path, err)
+	}
+	return content, nil
+}
+
+// samePath reports whether path, as a reply gives it, names the file at
+// the absolute path recorded: it is the same once made absolute, or a
+// trailing part of it, as paths relative to another directory are.
+func samePath(path, recorded string) bool {
+	if abs, err := filepath.Abs(path); err == nil && abs == recorded {
+		return true
+	}
+	path = filepath.Clean(path)
+	return !filepath.IsAbs(path) && strings.HasSuffix(recorded, string(filepath.Separator)+path)
+}
+
+// applyFlags are the flags of "ch apply".
+type applyFlags struct {
+	file   *string
+	dryRun *bool
+	force  *bool
+	merge  *bool
+	undo   *bool
+	// interactive has the user pick the changes to take.
+	interactive *bool
+	worktree    *string
+	branch      *string
+	test        *string
+	commit      *commitFlag
+}
+
+func addApplyFlags(flags *flag.FlagSet) applyFlags {
+	commit := &commitFlag{}
+	flags.Var(commit, "commit", "Commit the files written, with a message naming the prompt and reply, or from the `template` given as -commit=template")
+	return applyFlags{
+		commit:      commit,
+		file:        flags.String("f", "", "Apply the reply in `file` (- for stdin) instead of the clipboard"),
+		dryRun:      flags.Bool("n", false, "Only show which files would be written"),
+		force:       flags.Bool("force", false, "Overwrite files that changed after they were attached (with -undo, since they were applied)"),
+		merge:       flags.Bool("merge", false, "Merge the reply with changes made to files after they were attached, marking any conflicts"),
+		undo:        flags.Bool("undo", false, "Restore the files written by the last apply"),
+		interactive: flags.Bool("interactive", false, "Ask, hunk by hunk, which changes to take"),
+		worktree:    flags.String("worktree", "", "Write the files in the git worktree at `dir`, adding it if need be, instead of the working tree"),
+		branch:      flags.String("branch", "", "Write the files on `branch`, created from HEAD if need be: in -worktree, or else committed from a temporary worktree"),
+		test:        flags.String("test", "", "Run `command` with sh where the files were written, and fail if it does"),
+	}
+}
+
+// applyCommand implements "ch apply": it writes the files proposed in a
+// model's reply.
+func applyCommand(args []string) error {
+	flags := newCommandFlags("apply")
+	f := addApplyFlags(flags)
+	rest, err := parseInterspersed(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return usageError("usage: ch apply [-f file] [-n] [-interactive] [-force | -merge] [-worktree dir] [-branch branch] [-test command] | ch apply -undo [-n] [-force]")
+	}
+	sandboxed := *f.worktree != "" || *f.branch != ""
+	if (sandboxed || f.commit.template != "") && *f.dryRun {
+		return usageError("-n cannot be combined with -worktree, -branch, or -commit")
+	}
+	if *f.force && *f.merge {
+		return usageError("-force and -merge cannot be combined")
+	}
+	sets, err := defaultChangeSets()
+	if err != nil {
+		return fmt.Errorf("failed to locate the record of applied changes: %v", err)
+	}
+	if *f.undo {
+		if *f.file != "" || *f.merge || *f.interactive || sandboxed || *f.test != "" || f.commit.template != "" {
+			return usageError("-undo cannot be combined with -f, -merge, -interactive, -worktree, -branch, -test, or -commit")
+		}
+		return undoLastApply(sets, *f.force, *f.dryRun)
+	}
+	if *f.interactive && *f.file == "-" {
+		return usageError("-interactive reads answers from stdin, so it cannot be combined with -f -")
+	}
+	text, err := readInput(*f.file, "apply")
+	if err != nil {
+		return err
+	}
+	proposed := reply.Files(text)
+	patches, err := reply.Patches(text)
+	if err != nil {
+		return fmt.Errorf("failed to read the reply's diffs: %v", err)
+	}
+	if len(proposed) == 0 && len(patches) == 0 {
+		return fmt.Errorf("the reply proposes no files: no code block is labeled with a path or file ID, and none is a diff")
+	}
+	a, err := defaultAttachedFiles()
+	if err != nil {
+		return fmt.Errorf("failed to locate the record of attached files: %v", err)
+	}
+	records, err := a.load()
+	if err != nil {
+		return fmt.Errorf("failed to read the record of attached files: %v", err)
+	}
+	writes, err := resolveWrites(proposed, patches, records)
+	if err != nil {
+		return err
+	}
+
+	// Check every file before writing any, so that a conflict leaves them
+	// all as they were.
+	var conflicts []string
+	for i := range writes {
+		write := &writes[i]
+		conflict, err := write.conflict()
+		if err != nil {
+			return fmt.Errorf("failed to check %s: %v", write.path, err)
+		}
+		switch {
+		case conflict == "":
+		case *f.force:
+			write.notes = append(write.notes, "overwriting it, though it "+conflict)
+		case *f.merge:
+			if err := mergeChanges(a, write); err != nil {
+				return fmt.Errorf("failed to merge %s, which %s: %v", write.path, conflict, err)
+			}
+		default:
+			conflicts = append(conflicts, fmt.Sprintf("%s %s", write.path, conflict))
+		}
+	}
+	if len(conflicts) > 0 {
+		return fmt.Errorf("not applying the reply, since it would overwrite changes:\n  %s\nUse -merge to merge the reply with them, or -force to overwrite them", strings.Join(conflicts, "\n  "))
+	}
+	// Conflicts are with the working tree, where the files were attached,
+	// but a sandbox is where they are written.
+	var box *sandbox
+	if sandboxed {
+		if box, err = openSandbox(*f.worktree, *f.branch); err != nil {
+			return err
+		}
+		defer box.close()
+		for i := range writes {
+			if writes[i].path, err = box.path(writes[i].path); err != nil {
+				return err
+			}
+		}
+	}
+	if *f.interactive {
+		r := &reviewer{in: bufio.NewReader(os.Stdin), out: os.Stdout, edit: editText}
+		if writes, err = reviewWrites(writes, r); err != nil {
+			return err
+		}
+		if len(writes) == 0 {
+			fmt.Fprintln(messages, "No changes taken.")
+			return nil
+		}
+	}
+
+	verb := "Wrote"
+	if *f.dryRun {
+		verb = "Would write"
+	} else if err := writeFiles(writes, sets, box == nil || !box.temporary); err != nil {
+		return err
+	}
+	for _, write := range writes {
+		fmt.Fprintf(messages, "%s %s (%s)\n", verb, write.path, entry.FormatLineCount(entry.CountLines([]byte(write.content))))
+		for _, note := range write.notes {
+			fmt.Fprintf(messages, "  (%s)\n", note)
+		}
+	}
+	if *f.dryRun {
+		return nil
+	}
+
+	dir := "."
+	if box != nil {
+		dir = box.dir
+	}
+	var testErr error
+	if *f.test != "" {
+		fmt.Fprintf(messages, "Running %s...\n", *f.test)
+		if testErr = runTests(*f.test, dir, os.Stdout); testErr == nil {
+			fmt.Fprintln(messages, "Tests passed.")
+		}
+	}
+
+	// A temporary worktree goes away, so its changes are kept as a commit
+	// on the branch, whether or not the tests pass. Otherwise only changes
+	// that pass are committed.
+	template := f.commit.template
+	if box != nil && box.temporary {
+		template = cmp.Or(template, defaultCommitTemplate)
+	} else if template != "" && testErr != nil {
+		fmt.Fprintln(messages, "Not committing, since the tests failed.")
+		template = ""
+	}
+	if template != "" {
+		if err := commitWrites(dir, writes, template, text); err != nil {
+			return err
+		}
+	}
+	return testErr
+}
+
+// commitWrites commits the files written in the git repository at dir,
+// with a message from template about the reply.
+func commitWrites(dir string, writes []fileWrite, template, reply string) error {
+	var paths, ids []string
+	for _, write := range writes {
+		paths = append(paths, write.path)
+		if write.recorded.Path != "" {
+			ids = append(ids, entry.FileID(write.recorded.Path))
+		}
+	}
+	rel, err := repoPaths(dir, paths)
+	if err != nil {
+		return err
+	}
+	message, err := commitMessage(template, rel, reply, ids)
+	if err != nil {
+		return err
+	}
+	commit, err := gitCommit(dir, paths, message)
+	if err != nil {
+		return err
+	}
+	branch, _ := runGit(dir, "rev-parse", "--abbrev-ref", "HEAD")
+	fmt.Fprintf(messages, "Committed to %s as %s.\n", branch, commit)
+	return nil
+}
+
+// writeFiles writes writes all or none, first backing up the files they
+// replace in sets, so that the apply can be undone, if backup.
+func writeFiles(writes []fileWrite, sets changeSets, backup bool) error {
+	var saved string
+	if backup {
+		var err error
+		if saved, err = sets.save(writes, time.Now()); err != nil {
+			return fmt.Errorf("failed to back up the files to be written: %v", err)
+		}
+	}
+	var replacements []fileReplacement
+	for _, write := range writes {
+		replacements = append(replacements, fileReplacement{path: write.path, content: []byte(write.content)})
+	}
+	if err := replaceFiles(replacements); err != nil {
+		if saved != "" {
+			os.RemoveAll(saved)
+		}
+		return err
+	}
+	return nil
+}
+
+// mergeChanges makes write's content a three-way merge of the reply's
+// version of the file with the changes made to it since it was attached,
+// using git merge-file. Conflicts are marked in the content as git marks
+// them.
+func mergeChanges(a attachedFiles, write *fileWrite) error {
+	base, err := a.content(write.recorded.SHA256)
+	if err != nil {
+		return fmt.Errorf("the attached version is no longer recorded: %v", err)
+	}
+	current, err := os.ReadFile(write.path)
+	if err != nil {
+		return err
+	}
+	merged, conflicts, err := mergeFile(current, base, []byte(write.content))
+	if err != nil {
+		return err
+	}
+	write.content = string(merged)
+	if conflicts > 0 {
+		write.notes = append(write.notes, fmt.Sprintf("merged with changes made after it was attached; %d conflicts are marked in it", conflicts))
+	} else {
+		write.notes = append(write.notes, "merged with changes made after it was attached")
+	}
+	return nil
+}
+
+// mergeFile merges the changes from base to current and from base to
+// proposed with git merge-file, returning the result and the number of
+// conflicts marked in it.
+func mergeFile(current, base, proposed []byte) ([]byte, int, error) {
+	dir, err := os.MkdirTemp("", "ch-merge-")
+	if err != nil {
+		return nil, 0, err
+	}
+	defer os.RemoveAll(dir)
+	var paths []string
+	for i, content := range [][]byte{current, base, proposed} {
+		path := filepath.Join(dir, fmt.Sprint(i))
+		if err := os.WriteFile(path, content, 0600); err != nil {
+			return nil, 0, err
+		}
+		paths = append(paths, path)
+	}
+	cmd := exec.Command("git", "merge-file", "-p", "-L", "current", "-L", "attached", "-L", "reply", paths[0], paths[1], paths[2])
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	merged, err := cmd.Output()
+	// merge-file exits with the number of conflicts, or a negative status
+	// on error.
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() > 0 && exitErr.ExitCode() < 128 {
+		return merged, exitErr.ExitCode(), nil
+	}
+	if err != nil {
+		return nil, 0, subcmd.Errorf(subcmd.KindExec, "git merge-file failed: %v %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return merged, 0, nil
+}
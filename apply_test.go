@@ -0,0 +1,271 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+	"github.com/eloquence-cloud/ch/chlib/reply"
+)
+
+func TestResolveWrites(t *testing.T) {
+	dir := t.TempDir()
+	login := filepath.Join(dir, "auth", "login.go")
+	records := map[string]attachedFile{"1a2b3c4d": {Path: login}}
+
+	testCases := []struct {
+		name     string
+		proposed []reply.File
+		path     string
+		note     bool
+		err      string
+	}{
+		{"ID and matching path", []reply.File{{ID: "1a2b3c4d", Path: "auth/login.go"}}, login, false, ""},
+		{"ID wins over a renamed path", []reply.File{{ID: "1a2b3c4d", Path: "login.go.new"}}, login, true, ""},
+		{"path only", []reply.File{{Path: "new.go"}}, "new.go", false, ""},
+		{"absolute path", []reply.File{{Path: filepath.Join(dir, "new.go")}}, "", false, "outside the working directory"},
+		{"path escapes the working directory", []reply.File{{Path: "../../../tmp/applyt/escaped.txt"}}, "", false, "outside the working directory"},
+		{"unknown ID", []reply.File{{ID: "ffffffff", Path: "auth/login.go"}}, "", false, "no record"},
+		{"proposed twice", []reply.File{{Path: "new.go"}, {Path: "./new.go"}}, "", false, "more than once"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			writes, err := resolveWrites(tc.proposed, nil, records)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Errorf("Expected an error containing %q\n  Actual %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveWrites: %v", err)
+			}
+			if writes[0].path != tc.path || (len(writes[0].notes) > 0) != tc.note {
+				t.Errorf("Expected %s (note: %v)\n  Actual %s (notes: %q)", tc.path, tc.note, writes[0].path, writes[0].notes)
+			}
+		})
+	}
+}
+
+func TestApplyCommand(t *testing.T) {
+	isolateStorage(t)
+	oldMessages := messages
+	defer func() { messages = oldMessages }()
+	var reported strings.Builder
+	messages = &reported
+
+	dir := t.TempDir()
+	target := filepath.Join(dir, "login.go")
+	if err := os.WriteFile(target, []byte("package old\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	a, err := defaultAttachedFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := entry.File{StoragePath: target, OriginalPath: target}
+	if err := a.record([]entry.Entry{file, entry.Message{Text: "fix it"}}, time.Now()); err != nil {
+		t.Fatalf("record: %v", err)
+	}
+
+	// The reply renames the file, but its ID still says which it is.
+	replyPath := filepath.Join(dir, "reply.md")
+	text := "Fixed:\n\n`login_fixed.go`\n```go id=" + file.ID() + "\npackage auth\n```\n"
+	if err := os.WriteFile(replyPath, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := applyCommand([]string{"-n", "-f", replyPath}); err != nil {
+		t.Fatalf("apply -n: %v", err)
+	}
+	if content, _ := os.ReadFile(target); string(content) != "package old\n" {
+		t.Errorf("Expected -n to leave the file alone\n  Actual %q", content)
+	}
+	if err := applyCommand([]string{"-f", replyPath}); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if content, _ := os.ReadFile(target); string(content) != "package auth\n" {
+		t.Errorf("Expected the proposed content\n  Actual %q", content)
+	}
+	if info, err := os.Stat(target); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Expected the file's mode to be kept\n  Actual %v, %v", info.Mode(), err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "login_fixed.go")); err == nil {
+		t.Errorf("Expected nothing to be written under the reply's name for the file")
+	}
+	for _, want := range []string{"Would write " + target, "Wrote " + target, "the reply calls it login_fixed.go"} {
+		if !strings.Contains(reported.String(), want) {
+			t.Errorf("Expected messages to contain %q\n  Actual:\n%s", want, reported.String())
+		}
+	}
+}
+
+func TestApplyConflicts(t *testing.T) {
+	isolateStorage(t)
+	oldMessages := messages
+	defer func() { messages = oldMessages }()
+	var reported strings.Builder
+	messages = &reported
+
+	dir := t.TempDir()
+	target := filepath.Join(dir, "list.txt")
+	attach := func() string {
+		if err := os.WriteFile(target, []byte("one\ntwo\nthree\nfour\nfive\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		a, err := defaultAttachedFiles()
+		if err != nil {
+			t.Fatal(err)
+		}
+		file := entry.File{StoragePath: target, OriginalPath: target}
+		if err := a.record([]entry.Entry{file}, time.Now()); err != nil {
+			t.Fatalf("record: %v", err)
+		}
+		// Then the file is changed before the reply comes back.
+		if err := os.WriteFile(target, []byte("ONE\ntwo\nthree\nfour\nfive\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return file.ID()
+	}
+	replyPath := filepath.Join(dir, "reply.md")
+	writeReply := func(id string) {
+		text := "`list.txt`\n```text id=" + id + "\none\ntwo\nthree\nfour\nFIVE\n```\n"
+		if err := os.WriteFile(replyPath, []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	content := func() string {
+		data, _ := os.ReadFile(target)
+		return string(data)
+	}
+
+	writeReply(attach())
+	err := applyCommand([]string{"-f", replyPath})
+	if err == nil || !strings.Contains(err.Error(), "changed after it was attached") {
+		t.Errorf("Expected a conflict\n  Actual %v", err)
+	}
+	if got := content(); got != "ONE\ntwo\nthree\nfour\nfive\n" {
+		t.Errorf("Expected the file to be left alone\n  Actual %q", got)
+	}
+
+	if err := applyCommand([]string{"-merge", "-f", replyPath}); err != nil {
+		t.Fatalf("apply -merge: %v", err)
+	}
+	if got, want := content(), "ONE\ntwo\nthree\nfour\nFIVE\n"; got != want {
+		t.Errorf("Expected both changes\n  %q\n  Actual %q", want, got)
+	}
+
+	writeReply(attach())
+	if err := applyCommand([]string{"-force", "-f", replyPath}); err != nil {
+		t.Fatalf("apply -force: %v", err)
+	}
+	if got, want := content(), "one\ntwo\nthree\nfour\nFIVE\n"; got != want {
+		t.Errorf("Expected the reply's version\n  %q\n  Actual %q", want, got)
+	}
+	if err := applyCommand([]string{"-force", "-merge", "-f", replyPath}); err == nil {
+		t.Errorf("Expected an error for -force with -merge")
+	}
+	// A diff applies to the file as it is now, so its changes since it
+	// was attached are no conflict. A new file is named relative to the
+	// working directory.
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	id := attach()
+	text := "```diff id=" + id + "\n--- a/list.txt\n+++ b/list.txt\n@@ -3,3 +3,3 @@\n three\n-four\n+FOUR\n five\n```\n" +
+		"```diff\n--- /dev/null\n+++ b/new.txt\n@@ -0,0 +1 @@\n+new\n```\n"
+	if err := os.WriteFile(replyPath, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyCommand([]string{"-f", replyPath}); err != nil {
+		t.Fatalf("apply a diff: %v", err)
+	}
+	if got, want := content(), "ONE\ntwo\nthree\nFOUR\nfive\n"; got != want {
+		t.Errorf("Expected the diff applied to the changed file\n  %q\n  Actual %q", want, got)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "new.txt")); string(data) != "new\n" {
+		t.Errorf("Expected new.txt to be created\n  Actual %q", data)
+	}
+	if err := applyCommand([]string{"-f", replyPath}); err == nil || !strings.Contains(err.Error(), "failed to patch") {
+		t.Errorf("Expected a diff that no longer matches to fail\n  Actual %v", err)
+	}
+}
+
+func TestMergeFileConflicts(t *testing.T) {
+	merged, conflicts, err := mergeFile([]byte("a\nB\nc\n"), []byte("a\nb\nc\n"), []byte("a\nbee\nc\n"))
+	if err != nil {
+		t.Fatalf("mergeFile: %v", err)
+	}
+	if conflicts != 1 || !strings.Contains(string(merged), "<<<<<<< current\nB\n=======\nbee\n>>>>>>> reply\n") {
+		t.Errorf("Expected 1 marked conflict\n  Actual %d:\n%s", conflicts, merged)
+	}
+}
+
+func TestApplyUndo(t *testing.T) {
+	isolateStorage(t)
+	oldMessages := messages
+	defer func() { messages = oldMessages }()
+	messages = &strings.Builder{}
+
+	dir := t.TempDir()
+	existing, created := filepath.Join(dir, "a.txt"), filepath.Join(dir, "sub", "b.txt")
+	if err := os.WriteFile(existing, []byte("before\n"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	replyPath := filepath.Join(dir, "reply.md")
+	text := "`a.txt`\n```\nafter\n```\n\n`sub/b.txt`\n```\nnew\n```\n"
+	if err := os.WriteFile(replyPath, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+	read := func(path string) string {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "(missing)"
+		}
+		return string(data)
+	}
+
+	if err := applyCommand([]string{"-f", replyPath}); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if read(existing) != "after\n" || read(created) != "new\n" {
+		t.Fatalf("Expected the reply's files\n  Actual %q, %q", read(existing), read(created))
+	}
+
+	if err := applyCommand([]string{"-undo"}); err != nil {
+		t.Fatalf("apply -undo: %v", err)
+	}
+	if read(existing) != "before\n" || read(created) != "(missing)" {
+		t.Errorf("Expected the files as they were\n  Actual %q, %q", read(existing), read(created))
+	}
+	if info, err := os.Stat(existing); err != nil || info.Mode().Perm() != 0640 {
+		t.Errorf("Expected the file's mode to be restored\n  Actual %v, %v", info.Mode(), err)
+	}
+	if err := applyCommand([]string{"-undo"}); err == nil || !strings.Contains(err.Error(), "no apply to undo") {
+		t.Errorf("Expected nothing left to undo\n  Actual %v", err)
+	}
+
+	// A file changed after the apply is only restored with -force.
+	if err := applyCommand([]string{"-f", replyPath}); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if err := os.WriteFile(existing, []byte("edited\n"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyCommand([]string{"-undo"}); err == nil || read(existing) != "edited\n" {
+		t.Errorf("Expected undo to refuse and leave the edit\n  Actual %v, %q", err, read(existing))
+	}
+	if err := applyCommand([]string{"-undo", "-force"}); err != nil || read(existing) != "before\n" {
+		t.Errorf("Expected undo -force to restore the file\n  Actual %v, %q", err, read(existing))
+	}
+}
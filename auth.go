@@ -0,0 +1,118 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/eloquence-cloud/ch/chlib/keyring"
+)
+
+// authCommand implements "ch auth set|get|remove name": it manages the
+// credentials, such as API keys, that ch keeps in the OS keyring for the
+// subcommands that reach network services.
+func authCommand(args []string) error {
+	flags := newCommandFlags("auth")
+	rest, err := parseInterspersed(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 2 {
+		return usageError("usage: ch auth set|get|remove name")
+	}
+	name := rest[1]
+	if err := keyring.ValidateName(name); err != nil {
+		return usageError("%v", err)
+	}
+	switch rest[0] {
+	case "set":
+		secret, err := readSecret(os.Stdin, name)
+		if err != nil {
+			return err
+		}
+		if err := keyring.Set(name, secret); err != nil {
+			return fmt.Errorf("failed to store the %s credential: %v", name, err)
+		}
+		fmt.Fprintf(messages, "Stored the %s credential in the keyring.\n", name)
+		return nil
+	case "get":
+		secret, err := keyring.Get(name)
+		if errors.Is(err, keyring.ErrNotFound) {
+			return fmt.Errorf("no %s credential is stored", name)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read the %s credential: %v", name, err)
+		}
+		fmt.Println(secret)
+		return nil
+	case "remove":
+		err := keyring.Remove(name)
+		if errors.Is(err, keyring.ErrNotFound) {
+			return fmt.Errorf("no %s credential is stored", name)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to remove the %s credential: %v", name, err)
+		}
+		fmt.Fprintf(messages, "Removed the %s credential from the keyring.\n", name)
+		return nil
+	default:
+		return usageError("usage: ch auth set|get|remove name")
+	}
+}
+
+// readSecret reads a credential, the first line of stdin. When stdin is a
+// terminal, it prompts for it and turns off echoing while it is typed.
+func readSecret(stdin *os.File, name string) (string, error) {
+	if info, err := stdin.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+		fmt.Fprintf(os.Stderr, "Enter the %s credential: ", name)
+		if setEcho(stdin, false) == nil {
+			defer func() {
+				setEcho(stdin, true)
+				fmt.Fprintln(os.Stderr)
+			}()
+		}
+	}
+	line, err := bufio.NewReader(stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", fmt.Errorf("failed to read the credential: %v", err)
+	}
+	secret := strings.TrimSpace(line)
+	if secret == "" {
+		return "", usageError("no credential given")
+	}
+	return secret, nil
+}
+
+// setEcho turns the echoing of a terminal's input on or off with stty.
+func setEcho(terminal *os.File, on bool) error {
+	mode := "-echo"
+	if on {
+		mode = "echo"
+	}
+	cmd := exec.Command("stty", mode)
+	cmd.Stdin = terminal
+	return cmd.Run()
+}
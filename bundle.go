@@ -0,0 +1,180 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/eloquence-cloud/ch/chlib/render"
+	"github.com/eloquence-cloud/ch/chlib/subcmd"
+)
+
+// projectConfigName is the name of a project's own config file, found in
+// the working directory or the nearest directory above it that has one.
+// Only its [bundles] are read, since it comes with the project rather than
+// from the user.
+const projectConfigName = ".ch.toml"
+
+// bundleConfig is a [bundles.name] table: a script of subcommands, one
+// per line as in a script file for load, for a kind of question.
+type bundleConfig struct {
+	// Description says what the bundle is for, in ch bundle's list.
+	Description string `toml:"description"`
+	Subcommands string `toml:"subcommands"`
+	// Budget is the -budget that ch bundle runs the bundle with, unless
+	// another is given.
+	Budget string `toml:"budget"`
+}
+
+// validateBundles reports the first invalid bundle.
+func validateBundles(bundles map[string]bundleConfig) error {
+	for name, b := range bundles {
+		if name == "" || strings.ContainsAny(name, " \t,") {
+			return fmt.Errorf("invalid bundle name %q", name)
+		}
+		if strings.TrimSpace(b.Subcommands) == "" {
+			return fmt.Errorf("bundle %s has no subcommands", name)
+		}
+		for i, line := range strings.Split(b.Subcommands, "\n") {
+			if _, err := subcmd.SplitWords(line); err != nil {
+				return fmt.Errorf("bundle %s, line %d: %v", name, i+1, err)
+			}
+		}
+		if b.Budget != "" {
+			if _, err := render.ParseLimit(b.Budget); err != nil {
+				return fmt.Errorf("invalid budget for bundle %s: %v", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// findProjectConfig returns the path of the project config file in dir
+// or the nearest directory above it, or "" if there is none.
+func findProjectConfig(dir string) string {
+	for {
+		path := filepath.Join(dir, projectConfigName)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// addProjectBundles adds the bundles of the project config file, if there
+// is one, to cfg, replacing any of the same names.
+func addProjectBundles(cfg *config) error {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil
+	}
+	path := findProjectConfig(cwd)
+	if path == "" {
+		return nil
+	}
+	var project struct {
+		Bundles map[string]bundleConfig `toml:"bundles"`
+	}
+	metadata, err := toml.DecodeFile(path, &project)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load project config %s: %v", path, err)
+	}
+	if undecoded := metadata.Undecoded(); len(undecoded) > 0 {
+		return fmt.Errorf("unknown keys in project config %s: %s (only [bundles] are read from it)", path, undecoded[0])
+	}
+	if err := validateBundles(project.Bundles); err != nil {
+		return fmt.Errorf("%v in project config %s", err, path)
+	}
+	if len(project.Bundles) > 0 && cfg.Bundles == nil {
+		cfg.Bundles = map[string]bundleConfig{}
+	}
+	for name, b := range project.Bundles {
+		cfg.Bundles[name] = b
+	}
+	return nil
+}
+
+// bundleScripts returns the scripts of the configured bundles, by name,
+// for subcmd.Context.Bundles.
+func (cfg config) bundleScripts() map[string]string {
+	scripts := make(map[string]string, len(cfg.Bundles))
+	for name, b := range cfg.Bundles {
+		scripts[name] = b.Subcommands
+	}
+	return scripts
+}
+
+// bundleCommand implements "ch bundle": with a name, it runs the bundle as
+// the main command line would run "bundle name", with the flags and any
+// further subcommands that follow the name; without one, it lists the
+// bundles.
+func bundleCommand(args []string) error {
+	if len(args) == 0 {
+		return listBundles()
+	}
+	if strings.HasPrefix(args[0], "-") {
+		return usageError("usage: ch bundle [name [flags] [subcommands]]")
+	}
+	os.Args = append([]string{os.Args[0]}, args[1:]...)
+	runPipelineCommand(args[0])
+	return nil
+}
+
+// listBundles prints the configured bundles, with their descriptions and
+// budgets.
+func listBundles() error {
+	cfg, err := loadUserConfig("")
+	if err != nil {
+		return err
+	}
+	if len(cfg.Bundles) == 0 {
+		fmt.Fprintf(messages, "There are no bundles. Define them in [bundles.name] tables of the config file or of %s.\n", projectConfigName)
+		return nil
+	}
+	var names []string
+	width := 0
+	for name := range cfg.Bundles {
+		names = append(names, name)
+		width = max(width, len(name))
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		b := cfg.Bundles[name]
+		line := fmt.Sprintf("%-*s  %s", width, name, b.Description)
+		if b.Budget != "" {
+			line += fmt.Sprintf(" (budget %s)", b.Budget)
+		}
+		fmt.Println(strings.TrimRight(line, " "))
+	}
+	return nil
+}
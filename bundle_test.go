@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestProjectBundles(t *testing.T) {
+	root := t.TempDir()
+	nested := filepath.Join(root, "api", "handlers")
+	if err := os.MkdirAll(nested, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeProject := func(content string) {
+		if err := os.WriteFile(filepath.Join(root, projectConfigName), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(oldDir)
+	if err := os.Chdir(nested); err != nil {
+		t.Fatal(err)
+	}
+
+	if path := findProjectConfig(nested); path != "" {
+		t.Errorf("Expected no project config yet\n  Actual %s", path)
+	}
+	writeProject("[bundles.api-debug]\nsubcommands = \"\"\"\nattach api\nexec git diff\n\"\"\"\nbudget = \"20k-tokens\"\n")
+	if path, expected := findProjectConfig(nested), filepath.Join(root, projectConfigName); path != expected {
+		t.Errorf("Expected %s\n  Actual %s", expected, path)
+	}
+
+	cfg := config{Bundles: map[string]bundleConfig{
+		"api-debug": {Subcommands: "say mine"},
+		"mine":      {Subcommands: "say also mine"},
+	}}
+	if err := addProjectBundles(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{"api-debug": "attach api\nexec git diff\n", "mine": "say also mine"}
+	if actual := cfg.bundleScripts(); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected the project's bundle to replace the user's\n  %q\n  Actual %q", expected, actual)
+	}
+	if budget := cfg.Bundles["api-debug"].Budget; budget != "20k-tokens" {
+		t.Errorf("Expected the project bundle's budget\n  Actual %q", budget)
+	}
+
+	for _, tc := range []struct{ content, err string }{
+		{"scripts = [\"evil.star\"]\n", "only [bundles] are read"},
+		{"[bundles.x]\nsubcommands = \"say 'open\"\n", "bundle x, line 1"},
+		{"[bundles.x]\nsubcommands = \"say hi\"\nbudget = \"lots\"\n", "invalid budget for bundle x"},
+		{"[bundles.x]\ndescription = \"nothing\"\n", "bundle x has no subcommands"},
+	} {
+		writeProject(tc.content)
+		if err := addProjectBundles(&config{}); err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("Expected an error containing %q for %q\n  Actual %v", tc.err, tc.content, err)
+		}
+	}
+}
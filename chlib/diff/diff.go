@@ -0,0 +1,509 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+// Package diff computes line-based differences between texts, shown line
+// by line or word by word.
+package diff
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// contextLines is the number of unchanged lines shown around each change.
+const contextLines = 3
+
+// edit is one line of an edit script: ' ' for a line both sides share,
+// '-' for a line only in the old text, '+' for a line only in the new one.
+type edit struct {
+	kind byte
+	line string
+}
+
+// splitLines splits text into lines, each keeping its trailing newline.
+func splitLines(text string) []string {
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// editScript returns a shortest edit script turning a into b, using Myers'
+// O(ND) algorithm.
+func editScript(a, b []string) []edit {
+	n, m := len(a), len(b)
+	max := n + m
+	offset := max + 1
+	v := make([]int, 2*max+3)
+	var trace [][]int
+
+search:
+	for d := 0; d <= max; d++ {
+		trace = append(trace, append([]int(nil), v...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	// Walk back through the trace, collecting operations in reverse.
+	var ops []edit
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			ops = append(ops, edit{' ', a[x-1]})
+			x--
+			y--
+		}
+		if x == prevX {
+			ops = append(ops, edit{'+', b[y-1]})
+			y--
+		} else {
+			ops = append(ops, edit{'-', a[x-1]})
+			x--
+		}
+	}
+	for x > 0 && y > 0 {
+		ops = append(ops, edit{' ', a[x-1]})
+		x--
+		y--
+	}
+
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+// Unified returns the differences between oldText and newText in
+// unified format, with "---"/"+++" headers naming oldName and newName, or
+// "" if the texts are equal.
+func Unified(oldName, newName, oldText, newText string) string {
+	return format(oldName, newName, oldText, newText, func(out *strings.Builder, ops []edit) {
+		for _, op := range ops {
+			out.WriteByte(op.kind)
+			out.WriteString(op.line)
+			if !strings.HasSuffix(op.line, "\n") {
+				out.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+	})
+}
+
+// Words returns the differences between oldText and newText with the same
+// headers and hunks as Unified, but with each changed line shown once,
+// marking the removed words [-like this-] and the added ones {+like this+},
+// as git diff --word-diff=plain does. It reads better than Unified for
+// changes to prose and configuration.
+func Words(oldName, newName, oldText, newText string) string {
+	return format(oldName, newName, oldText, newText, func(out *strings.Builder, ops []edit) {
+		for i := 0; i < len(ops); {
+			if ops[i].kind == ' ' {
+				out.WriteString(ensureNewline(ops[i].line))
+				i++
+				continue
+			}
+			var removed, added strings.Builder
+			for ; i < len(ops) && ops[i].kind != ' '; i++ {
+				if ops[i].kind == '-' {
+					removed.WriteString(ensureNewline(ops[i].line))
+				} else {
+					added.WriteString(ensureNewline(ops[i].line))
+				}
+			}
+			writeWordChanges(out, removed.String(), added.String())
+		}
+	})
+}
+
+// format returns the "---"/"+++" headers and the hunks of the differences
+// between oldText and newText, or "" if the texts are equal. writeHunk
+// writes the body of each hunk, given the edits it covers.
+func format(oldName, newName, oldText, newText string, writeHunk func(out *strings.Builder, ops []edit)) string {
+	if oldText == newText {
+		return ""
+	}
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", oldName, newName)
+	eachHunk(oldText, newText, func(header string, _ int, ops []edit) {
+		out.WriteString(header + "\n")
+		writeHunk(&out, ops)
+	})
+	return out.String()
+}
+
+// eachHunk calls fn with the header, the 0-based index of the first old
+// line, and the edits of each hunk of the differences between oldText and
+// newText.
+func eachHunk(oldText, newText string, fn func(header string, start int, ops []edit)) {
+	ops := editScript(splitLines(oldText), splitLines(newText))
+
+	// oldLines[i] and newLines[i] are the 1-based line numbers at ops[i].
+	oldLines := make([]int, len(ops)+1)
+	newLines := make([]int, len(ops)+1)
+	oldLines[0], newLines[0] = 1, 1
+	for i, op := range ops {
+		oldLines[i+1], newLines[i+1] = oldLines[i], newLines[i]
+		if op.kind != '+' {
+			oldLines[i+1]++
+		}
+		if op.kind != '-' {
+			newLines[i+1]++
+		}
+	}
+
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+		// Grow the hunk while the next change is close enough that the
+		// context around them would overlap.
+		start := i - contextLines
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for j := i; j < len(ops) && j <= end+2*contextLines; j++ {
+			if ops[j].kind != ' ' {
+				end = j
+			}
+		}
+		stop := end + 1 + contextLines
+		if stop > len(ops) {
+			stop = len(ops)
+		}
+
+		header := fmt.Sprintf("@@ -%s +%s @@",
+			hunkRange(oldLines[start], oldLines[stop]-oldLines[start]),
+			hunkRange(newLines[start], newLines[stop]-newLines[start]))
+		fn(header, oldLines[start]-1, ops[start:stop])
+		i = stop
+	}
+}
+
+// Hunk is a group of nearby changes, with the lines around them, as a
+// unified diff shows them.
+type Hunk struct {
+	// Header is the hunk's "@@ -1,4 +1,5 @@" line, without its newline.
+	Header string
+	// Diff is the body of the hunk as Unified shows it.
+	Diff string
+	// Old and New are the lines the hunk covers in the old and new texts.
+	Old, New string
+	// Start is the 0-based index of the hunk's first line in the old text.
+	Start int
+}
+
+// Hunks returns the hunks of the differences between oldText and newText,
+// in order, for taking some changes and not others; see Splice.
+func Hunks(oldText, newText string) []Hunk {
+	var hunks []Hunk
+	eachHunk(oldText, newText, func(header string, start int, ops []edit) {
+		hunk := Hunk{Header: header, Start: start}
+		var diff, old, new strings.Builder
+		for _, op := range ops {
+			diff.WriteByte(op.kind)
+			diff.WriteString(op.line)
+			if !strings.HasSuffix(op.line, "\n") {
+				diff.WriteString("\n\\ No newline at end of file\n")
+			}
+			if op.kind != '+' {
+				old.WriteString(op.line)
+			}
+			if op.kind != '-' {
+				new.WriteString(op.line)
+			}
+		}
+		hunk.Diff, hunk.Old, hunk.New = diff.String(), old.String(), new.String()
+		hunks = append(hunks, hunk)
+	})
+	return hunks
+}
+
+// Splice returns oldText with the lines of each of hunks, which are from
+// Hunks(oldText, ...), replaced by replace(i): hunks[i].New to take its
+// changes, hunks[i].Old to leave them, or any other text.
+func Splice(oldText string, hunks []Hunk, replace func(i int) string) string {
+	lines := splitLines(oldText)
+	var out strings.Builder
+	next := 0
+	for i, hunk := range hunks {
+		out.WriteString(strings.Join(lines[next:hunk.Start], ""))
+		out.WriteString(replace(i))
+		next = hunk.Start + len(splitLines(hunk.Old))
+	}
+	out.WriteString(strings.Join(lines[next:], ""))
+	return out.String()
+}
+
+// writeWordChanges writes the lines that changed from removed to added,
+// with the words that differ marked.
+func writeWordChanges(out *strings.Builder, removed, added string) {
+	ops := editScript(splitWords(removed), splitWords(added))
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			out.WriteString(ops[i].line)
+			i++
+			continue
+		}
+		var oldWords, newWords strings.Builder
+		for ; i < len(ops) && ops[i].kind != ' '; i++ {
+			if ops[i].kind == '-' {
+				oldWords.WriteString(ops[i].line)
+			} else {
+				newWords.WriteString(ops[i].line)
+			}
+		}
+		writeMarked(out, "[-", "-]", oldWords.String())
+		writeMarked(out, "{+", "+}", newWords.String())
+	}
+}
+
+// writeMarked writes text between open and close, marking each line's part
+// separately so that the markers never span lines.
+func writeMarked(out *strings.Builder, open, close, text string) {
+	for _, part := range strings.SplitAfter(text, "\n") {
+		if body := strings.TrimSuffix(part, "\n"); body != "" {
+			out.WriteString(open + body + close)
+		}
+		if strings.HasSuffix(part, "\n") {
+			out.WriteString("\n")
+		}
+	}
+}
+
+// splitWords splits text into words (runs of letters, digits, and
+// underscores), runs of spaces and tabs, and single other characters,
+// including newlines.
+func splitWords(text string) []string {
+	var words []string
+	class := func(r rune) int {
+		switch {
+		case r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r):
+			return 1
+		case r == ' ' || r == '\t':
+			return 2
+		}
+		return 0
+	}
+	start := 0
+	for i, r := range text {
+		if i > start {
+			prev, _ := utf8.DecodeLastRuneInString(text[:i])
+			if class(r) == 0 || class(r) != class(prev) {
+				words = append(words, text[start:i])
+				start = i
+			}
+		}
+	}
+	if start < len(text) {
+		words = append(words, text[start:])
+	}
+	return words
+}
+
+// ensureNewline returns line with a newline at the end, adding one to the
+// last line of a text that lacks it.
+func ensureNewline(line string) string {
+	if strings.HasSuffix(line, "\n") {
+		return line
+	}
+	return line + "\n"
+}
+
+// hunkRange formats one side of a hunk header. An empty range names the
+// line before it, as diff(1) does.
+func hunkRange(start, count int) string {
+	if count == 0 {
+		start--
+	}
+	if count == 1 {
+		return fmt.Sprint(start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+// FilePatch is the changes to one file in a unified diff.
+type FilePatch struct {
+	// OldPath and NewPath name the file before and after, as the "---"
+	// and "+++" lines give them, without git's a/ and b/ prefixes. A new
+	// file's OldPath, or a removed file's NewPath, is /dev/null.
+	OldPath, NewPath string
+	Hunks            []PatchHunk
+}
+
+// PatchHunk is a hunk of a unified diff.
+type PatchHunk struct {
+	// OldStart is the 1-based line where the hunk starts in the old file.
+	OldStart int
+	// Lines are the hunk's lines, each starting with ' ', '-', or '+',
+	// without their newlines.
+	Lines []string
+}
+
+var hunkHeader = regexp.MustCompile(`^@@ -(\d+)(?:,\d+)? \+\d+(?:,\d+)? @@`)
+
+// ParseUnified returns the file patches in a unified diff, such as git diff
+// writes. The line counts in hunk headers are not trusted, since diffs
+// written by hand or by a model often get them wrong; a hunk runs until
+// the next hunk or file. A blank line in a hunk is taken as a blank line of
+// context, whose leading space is easily lost.
+func ParseUnified(text string) ([]FilePatch, error) {
+	var patches []FilePatch
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		if !strings.HasPrefix(lines[i], "--- ") {
+			continue
+		}
+		if i+1 >= len(lines) || !strings.HasPrefix(lines[i+1], "+++ ") {
+			return nil, fmt.Errorf("line %d: %q is not followed by a +++ line", i+1, lines[i])
+		}
+		patch := FilePatch{OldPath: patchPath(lines[i][4:], "a/"), NewPath: patchPath(lines[i+1][4:], "b/")}
+		i += 2
+		for ; i < len(lines); i++ {
+			line := lines[i]
+			if m := hunkHeader.FindStringSubmatch(line); m != nil {
+				start, _ := strconv.Atoi(m[1])
+				patch.Hunks = append(patch.Hunks, PatchHunk{OldStart: start})
+				continue
+			}
+			if strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ ") {
+				break
+			}
+			if len(patch.Hunks) == 0 {
+				// Lines such as "diff --git" or "index" before the first hunk.
+				continue
+			}
+			hunk := &patch.Hunks[len(patch.Hunks)-1]
+			switch {
+			case line == "":
+				hunk.Lines = append(hunk.Lines, " ")
+			case line[0] == ' ' || line[0] == '-' || line[0] == '+':
+				hunk.Lines = append(hunk.Lines, line)
+			case line[0] == '\\':
+				// "\ No newline at end of file"
+			}
+		}
+		i--
+		if len(patch.Hunks) == 0 {
+			return nil, fmt.Errorf("the diff of %s has no hunks", patch.NewPath)
+		}
+		patches = append(patches, patch)
+	}
+	if len(patches) == 0 {
+		return nil, fmt.Errorf("no ---/+++ lines found")
+	}
+	return patches, nil
+}
+
+// patchPath returns the path in a "---" or "+++" line, without prefix or
+// anything after a tab, such as a timestamp.
+func patchPath(path, prefix string) string {
+	path, _, _ = strings.Cut(path, "\t")
+	path = strings.TrimSpace(path)
+	if path == "/dev/null" {
+		return path
+	}
+	return strings.TrimPrefix(path, prefix)
+}
+
+// Apply returns oldText with the patch's hunks applied. Each hunk's context
+// and removed lines must appear in oldText, after the previous hunk's, but
+// may have moved from where its header says; the nearest place they appear
+// is used. Lines are compared without trailing white space.
+func (p FilePatch) Apply(oldText string) (string, error) {
+	lines := splitLines(oldText)
+	var out []string
+	next, offset := 0, 0
+	for n, hunk := range p.Hunks {
+		var old, new []string
+		for _, line := range hunk.Lines {
+			if line[0] != '+' {
+				old = append(old, line[1:])
+			}
+			if line[0] != '-' {
+				new = append(new, line[1:]+"\n")
+			}
+		}
+		at := findLines(lines, old, next, hunk.OldStart-1+offset)
+		if at < 0 {
+			return "", fmt.Errorf("hunk %d (at line %d) does not match %s", n+1, hunk.OldStart, p.NewPath)
+		}
+		out = append(out, lines[next:at]...)
+		out = append(out, new...)
+		next = at + len(old)
+		offset = at - (hunk.OldStart - 1)
+	}
+	out = append(out, lines[next:]...)
+	return strings.Join(out, ""), nil
+}
+
+// findLines returns the index at or after from where lines holds want,
+// nearest to near, or -1 if it doesn't.
+func findLines(lines, want []string, from, near int) int {
+	matches := func(at int) bool {
+		if at < from || at+len(want) > len(lines) {
+			return false
+		}
+		for i, line := range want {
+			if strings.TrimRight(lines[at+i], " \t\r\n") != strings.TrimRight(line, " \t\r") {
+				return false
+			}
+		}
+		return true
+	}
+	for distance := 0; near-distance >= from || near+distance <= len(lines); distance++ {
+		if matches(near - distance) {
+			return near - distance
+		}
+		if matches(near + distance) {
+			return near + distance
+		}
+	}
+	return -1
+}
@@ -0,0 +1,195 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new string
+		expected string
+	}{
+		{"equal", "a\nb\n", "a\nb\n", ""},
+		{
+			"change in the middle",
+			"1\n2\n3\n4\n5\n6\n7\n8\n9\n",
+			"1\n2\n3\n4\nfive\n6\n7\n8\n9\n",
+			"--- old\n+++ new\n@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+five\n 6\n 7\n 8\n",
+		},
+		{
+			"separate hunks",
+			"1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n",
+			"one\n2\n3\n4\n5\n6\n7\n8\n9\nten\n",
+			"--- old\n+++ new\n@@ -1,4 +1,4 @@\n-1\n+one\n 2\n 3\n 4\n@@ -7,4 +7,4 @@\n 7\n 8\n 9\n-10\n+ten\n",
+		},
+		{"from empty", "", "a\n", "--- old\n+++ new\n@@ -0,0 +1 @@\n+a\n"},
+		{"to empty", "a\n", "", "--- old\n+++ new\n@@ -1 +0,0 @@\n-a\n"},
+		{
+			"missing final newline",
+			"a\nb",
+			"a\nb\n",
+			"--- old\n+++ new\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+b\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if actual := Unified("old", "new", test.old, test.new); actual != test.expected {
+				t.Errorf("Expected %q\n  Actual %q", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestEditScriptIsMinimal(t *testing.T) {
+	a := splitLines("a\nb\nc\na\nb\nb\na\n")
+	b := splitLines("c\nb\na\nb\na\nc\n")
+	changes := 0
+	for _, op := range editScript(a, b) {
+		if op.kind != ' ' {
+			changes++
+		}
+	}
+	// The classic example from Myers' paper has an edit distance of 5.
+	if changes != 5 {
+		t.Errorf("Expected 5 changes\n  Actual %d", changes)
+	}
+}
+
+func TestWordDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new string
+		expected string
+	}{
+		{"equal", "a b\n", "a b\n", ""},
+		{
+			"changed word",
+			"timeout = 30 # seconds\n",
+			"timeout = 60 # seconds\n",
+			"--- old\n+++ new\n@@ -1 +1 @@\ntimeout = [-30-]{+60+} # seconds\n",
+		},
+		{
+			"added words",
+			"intro\nThe quick fox.\n",
+			"intro\nThe quick brown fox jumps.\n",
+			"--- old\n+++ new\n@@ -1,2 +1,2 @@\nintro\nThe quick {+brown +}fox{+ jumps+}.\n",
+		},
+		{
+			"change across lines",
+			"one two\nthree\n",
+			"one 2\n3\n",
+			"--- old\n+++ new\n@@ -1,2 +1,2 @@\none [-two-]{+2+}\n[-three-]{+3+}\n",
+		},
+		{"added line", "a\n", "a\nb\n", "--- old\n+++ new\n@@ -1 +1,2 @@\na\n{+b+}\n"},
+		{"missing final newline", "a b", "a c\n", "--- old\n+++ new\n@@ -1 +1 @@\na [-b-]{+c+}\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if actual := Words("old", "new", test.old, test.new); actual != test.expected {
+				t.Errorf("Expected %q\n  Actual %q", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestHunksSplice(t *testing.T) {
+	var old, new strings.Builder
+	for i := 1; i <= 20; i++ {
+		fmt.Fprintf(&old, "line %d\n", i)
+		switch i {
+		case 2:
+			new.WriteString("line two\n")
+		case 18:
+			fmt.Fprintf(&new, "line %d\nline 18.5\n", i)
+		default:
+			fmt.Fprintf(&new, "line %d\n", i)
+		}
+	}
+	hunks := Hunks(old.String(), new.String())
+	if len(hunks) != 2 || hunks[0].Header != "@@ -1,5 +1,5 @@" || hunks[1].Header != "@@ -16,5 +16,6 @@" {
+		t.Fatalf("Expected 2 hunks\n  Actual %+v", hunks)
+	}
+	if !strings.Contains(hunks[0].Diff, "-line 2\n+line two\n") {
+		t.Errorf("Expected the first hunk's diff to show the change\n  Actual %q", hunks[0].Diff)
+	}
+
+	testCases := []struct {
+		name    string
+		replace func(i int) string
+		check   func(result string) bool
+	}{
+		{"all", func(i int) string { return hunks[i].New }, func(r string) bool { return r == new.String() }},
+		{"none", func(i int) string { return hunks[i].Old }, func(r string) bool { return r == old.String() }},
+		{"first", func(i int) string { return []string{hunks[0].New, hunks[1].Old}[i] }, func(r string) bool {
+			return strings.Contains(r, "line two\n") && !strings.Contains(r, "18.5")
+		}},
+	}
+	for _, tc := range testCases {
+		if result := Splice(old.String(), hunks, tc.replace); !tc.check(result) {
+			t.Errorf("%s: unexpected result:\n%s", tc.name, result)
+		}
+	}
+}
+
+func TestParseUnifiedApply(t *testing.T) {
+	old := "package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Println(\"hi\")\n}\n"
+	testCases := []struct {
+		name     string
+		diff     string
+		old      string
+		expected string
+		err      bool
+	}{
+		{
+			name:     "git diff",
+			diff:     "diff --git a/main.go b/main.go\nindex 1..2 100644\n--- a/main.go\n+++ b/main.go\n@@ -5,3 +5,3 @@ import \"fmt\"\n func main() {\n-\tfmt.Println(\"hi\")\n+\tfmt.Println(\"hello\")\n }\n",
+			old:      old,
+			expected: strings.Replace(old, "hi", "hello", 1),
+		},
+		{
+			name: "wrong line numbers, wrong counts, and a blank context line without its space",
+			diff: "--- main.go\n+++ main.go\n@@ -1,2 +1,9 @@\n import \"fmt\"\n\n+// main says hello.\n func main() {\n",
+			old:  old, expected: strings.Replace(old, "func main", "// main says hello.\nfunc main", 1),
+		},
+		{
+			name:     "new file",
+			diff:     "--- /dev/null\n+++ b/new.txt\n@@ -0,0 +1,2 @@\n+one\n+two\n",
+			old:      "",
+			expected: "one\ntwo\n",
+		},
+		{
+			name: "context that isn't there",
+			diff: "--- a/main.go\n+++ b/main.go\n@@ -1,1 +1,1 @@\n-package other\n+package main\n",
+			old:  old, err: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			patches, err := ParseUnified(tc.diff)
+			if err != nil || len(patches) != 1 {
+				t.Fatalf("ParseUnified: %d patches, %v", len(patches), err)
+			}
+			actual, err := patches[0].Apply(tc.old)
+			if tc.err {
+				if err == nil {
+					t.Errorf("Expected an error\n  Actual %q", actual)
+				}
+				return
+			}
+			if err != nil || actual != tc.expected {
+				t.Errorf("Expected %q\n  Actual %q, %v", tc.expected, actual, err)
+			}
+		})
+	}
+
+	patches, err := ParseUnified("--- a/x\n+++ b/x\n@@ -1 +1 @@\n-a\n+b\n--- a/y\n+++ b/y\n@@ -1 +1 @@\n-c\n+d\n")
+	if err != nil || len(patches) != 2 || patches[1].OldPath != "y" || len(patches[0].Hunks[0].Lines) != 2 {
+		t.Errorf("Expected two patches, of x and y\n  Actual %+v, %v", patches, err)
+	}
+	if _, err := ParseUnified("--- a/x\n+++ b/x\n"); err == nil {
+		t.Errorf("Expected an error for a diff without hunks")
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package entry
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// cacheVersion is part of every cache key. Change it when the markdown
+// for a file changes, so that entries cached by older versions of ch are
+// not used.
+const cacheVersion = 1
+
+// cacheMaxAge is how long a cached rendering is kept after it was last
+// used.
+const cacheMaxAge = 14 * 24 * time.Hour
+
+// Cache stores the rendered markdown of attached files between runs, so
+// that repeated runs over the same tree only read the files that changed.
+// A rendering is keyed by the file's path, size, and modification time and
+// by the render options. Set RenderOptions.Cache to use it.
+//
+// Only local files are cached: remote files and files changed by hooks are
+// fresh temporary copies each time. Nor are files rendered with Metadata,
+// whose git status can change while the file does not.
+type Cache struct {
+	dir string
+}
+
+// OpenCache opens the cache in dir, creating the directory if need be, and
+// removes renderings that haven't been used for a while, then the least
+// recently used ones until the cache holds at most maxSize bytes (if
+// maxSize is positive).
+func OpenCache(dir string, maxSize int64) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create render cache: %v", err)
+	}
+	c := &Cache{dir: dir}
+	c.expire(time.Now().Add(-cacheMaxAge), maxSize)
+	return c, nil
+}
+
+// expire removes the renderings last used before cutoff, and then, oldest
+// first, those beyond maxSize bytes.
+func (c *Cache) expire(cutoff time.Time, maxSize int64) {
+	files, err := os.ReadDir(c.dir)
+	if err != nil {
+		slog.Debug("failed to list render cache", "dir", c.dir, "error", err)
+		return
+	}
+	var kept []os.FileInfo
+	var size int64
+	for _, file := range files {
+		info, err := file.Info()
+		if err != nil {
+			continue
+		}
+		if info.ModTime().Before(cutoff) {
+			os.Remove(filepath.Join(c.dir, file.Name()))
+			continue
+		}
+		kept = append(kept, info)
+		size += info.Size()
+	}
+	if maxSize <= 0 {
+		return
+	}
+	slices.SortFunc(kept, func(a, b os.FileInfo) int { return a.ModTime().Compare(b.ModTime()) })
+	for _, info := range kept {
+		if size <= maxSize {
+			break
+		}
+		if os.Remove(filepath.Join(c.dir, info.Name())) == nil {
+			size -= info.Size()
+		}
+	}
+}
+
+// key returns the cache key for e, whose file is described by info,
+// rendered with opts, or "" if e can't be cached.
+func (c *Cache) key(e File, info os.FileInfo, opts RenderOptions) string {
+	if e.IsRemote() || opts.Metadata {
+		return ""
+	}
+	path, err := filepath.Abs(e.StoragePath)
+	if err != nil {
+		return ""
+	}
+	// RenderOptions.Cache is left out of the JSON.
+	optsJSON, err := json.Marshal(opts)
+	if err != nil {
+		return ""
+	}
+	hash := sha256.New()
+	// The rendering's heading shows the display path, which depends on the
+	// working directory the file was attached from, not just where it is.
+	fmt.Fprintf(hash, "%d\x00%s\x00%s\x00%s\x00%d\x00%d\x00%s", cacheVersion, path, e.DisplayPath(), e.Lang, info.Size(), info.ModTime().UnixNano(), optsJSON)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// get returns the rendering stored under key, marking it as used.
+func (c *Cache) get(key string) (string, bool) {
+	path := filepath.Join(c.dir, key)
+	markdown, err := os.ReadFile(path)
+	if err != nil {
+		return "", false
+	}
+	now := time.Now()
+	os.Chtimes(path, now, now)
+	return string(markdown), true
+}
+
+// put stores markdown under key. Failures are only logged, since the
+// cache is an optimization.
+func (c *Cache) put(key, markdown string) {
+	// Write to a temporary file and rename it into place, so that a
+	// concurrent run never reads a partial rendering.
+	tmp, err := os.CreateTemp(c.dir, "tmp-")
+	if err != nil {
+		slog.Debug("failed to write render cache", "error", err)
+		return
+	}
+	_, err = tmp.WriteString(markdown)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filepath.Join(c.dir, key))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		slog.Debug("failed to write render cache", "error", err)
+	}
+}
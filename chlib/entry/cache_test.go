@@ -0,0 +1,128 @@
+package entry
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	cache, err := OpenCache(t.TempDir(), 0)
+	if err != nil {
+		t.Fatalf("Failed to open cache: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "main.go")
+	modified := time.Now().Add(-time.Hour).Truncate(time.Second)
+	write := func(content string, modTime time.Time) {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatalf("Failed to set file time: %v", err)
+		}
+	}
+	file := File{StoragePath: path, OriginalPath: path}
+	opts := RenderOptions{Cache: cache}
+
+	write("package a\n", modified)
+	if actual, expected := file.RenderMarkdown(opts), "`"+path+"`\n```go\npackage a\n```\n"; actual != expected {
+		t.Fatalf("Expected markdown: %q\n  Actual markdown: %q", expected, actual)
+	}
+
+	// A change that keeps the size and modification time goes unnoticed,
+	// showing that the cached rendering is used.
+	write("package b\n", modified)
+	if actual, expected := file.RenderMarkdown(opts), "`"+path+"`\n```go\npackage a\n```\n"; actual != expected {
+		t.Errorf("Expected the cached markdown: %q\n  Actual markdown: %q", expected, actual)
+	}
+
+	// Different options are cached separately.
+	fenceOpts := RenderOptions{Cache: cache, FencePath: true}
+	if actual, expected := file.RenderMarkdown(fenceOpts), "```go path="+path+"\npackage b\n```\n"; actual != expected {
+		t.Errorf("Expected markdown: %q\n  Actual markdown: %q", expected, actual)
+	}
+
+	write("package c\n", modified.Add(time.Second))
+	if actual, expected := file.RenderMarkdown(opts), "`"+path+"`\n```go\npackage c\n```\n"; actual != expected {
+		t.Errorf("Expected fresh markdown: %q\n  Actual markdown: %q", expected, actual)
+	}
+
+	// Metadata includes git status, which can change while the file
+	// doesn't, so it isn't cached.
+	if key := cache.key(file, mustStat(t, path), RenderOptions{Metadata: true}); key != "" {
+		t.Errorf("Expected no cache key with Metadata, got %q", key)
+	}
+}
+
+func TestCacheWorkingDirectories(t *testing.T) {
+	cache, err := OpenCache(t.TempDir(), 0)
+	if err != nil {
+		t.Fatalf("Failed to open cache: %v", err)
+	}
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "sub"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "main.go"), []byte("package main\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	// The same file, attached from two directories, is rendered with the
+	// path it was attached by in each.
+	for _, tc := range []struct{ dir, path string }{{root, "main.go"}, {filepath.Join(root, "sub"), "../main.go"}} {
+		if err := os.Chdir(tc.dir); err != nil {
+			t.Fatal(err)
+		}
+		file := File{StoragePath: tc.path, OriginalPath: tc.path}
+		if actual, expected := file.RenderMarkdown(RenderOptions{Cache: cache}), "`"+tc.path+"`\n```go\npackage main\n```\n"; actual != expected {
+			t.Errorf("Expected markdown: %q\n  Actual markdown: %q", expected, actual)
+		}
+	}
+}
+
+func TestCacheExpire(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	for i, age := range []time.Duration{30 * 24 * time.Hour, 3 * time.Hour, 2 * time.Hour, time.Hour} {
+		path := filepath.Join(dir, fmt.Sprintf("rendering-%d", i))
+		if err := os.WriteFile(path, make([]byte, 100), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, now.Add(-age), now.Add(-age)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The month-old rendering expires, and the least recently used of the
+	// rest go until the cache is within 200 bytes.
+	if _, err := OpenCache(dir, 200); err != nil {
+		t.Fatal(err)
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, file := range files {
+		names = append(names, file.Name())
+	}
+	if expected := []string{"rendering-2", "rendering-3"}; !slices.Equal(names, expected) {
+		t.Errorf("Expected %v\n  Actual %v", expected, names)
+	}
+}
+
+func mustStat(t *testing.T, path string) os.FileInfo {
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Failed to stat %s: %v", path, err)
+	}
+	return info
+}
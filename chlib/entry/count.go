@@ -0,0 +1,47 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package entry
+
+import "os"
+
+// AttachedSize returns the total size of the files attached as entries.
+func AttachedSize(entries []Entry) int64 {
+	var total int64
+	for _, e := range entries {
+		if file, ok := Unwrap(e).(File); ok {
+			if info, err := os.Stat(file.StoragePath); err == nil {
+				total += info.Size()
+			}
+		}
+	}
+	return total
+}
+
+// CountFailures returns the number of Failure placeholders in entries, left
+// by -keep-going.
+func CountFailures(entries []Entry) int {
+	failures := 0
+	for _, e := range entries {
+		if _, ok := Unwrap(e).(Failure); ok {
+			failures++
+		}
+	}
+	return failures
+}
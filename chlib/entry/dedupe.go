@@ -0,0 +1,73 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package entry
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// Deduplication modes accepted by Dedupe.
+const (
+	DedupeOff  = "off"
+	DedupeDrop = "drop"
+	DedupeStub = "stub"
+)
+
+// Dedupe removes repeated file entries, keeping the first occurrence of each
+// file. In DedupeDrop mode later occurrences are omitted; in DedupeStub mode
+// they are replaced by a Duplicate pointing back to the first one. In
+// DedupeOff mode entries are returned unchanged.
+func Dedupe(entries []Entry, mode string) []Entry {
+	if mode == DedupeOff {
+		return entries
+	}
+	seen := make(map[string]bool)
+	var result []Entry
+	for _, entry := range entries {
+		file, ok := Unwrap(entry).(File)
+		if !ok {
+			result = append(result, entry)
+			continue
+		}
+		key := fileIdentity(file.OriginalPath)
+		if !seen[key] {
+			seen[key] = true
+			result = append(result, entry)
+		} else if mode == DedupeStub {
+			result = append(result, Duplicate{OriginalPath: file.DisplayPath()})
+		}
+	}
+	return result
+}
+
+// fileIdentity returns a key that is the same for every spelling of the same
+// file: local paths are made absolute and cleaned, remote paths (host:path)
+// are used as given.
+func fileIdentity(path string) string {
+	if strings.Contains(path, ":") {
+		return path
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return filepath.Clean(path)
+	}
+	return abs
+}
@@ -0,0 +1,402 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+// Package entry defines the entries that make up a ch document (messages,
+// attached files, command output, and diffs) and how each renders to
+// markdown.
+package entry
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Entry is one piece of a generated document.
+type Entry interface {
+	// RenderMarkdown returns the markdown representation of the entry.
+	// This should end with a single newline.
+	RenderMarkdown(opts RenderOptions) string
+}
+
+// MarkdownWriter is implemented by entries whose markdown can be large,
+// such as attached files, to write it without holding it all in memory.
+// WriteMarkdown writes what RenderMarkdown would return.
+type MarkdownWriter interface {
+	WriteMarkdown(w io.Writer, opts RenderOptions) error
+}
+
+// RenderOptions controls how entries are rendered to markdown.
+type RenderOptions struct {
+	// Metadata adds size, line count, modification time, and git status to
+	// the header line of each attached file.
+	Metadata bool
+	// TOC prefixes the output with a table of contents.
+	TOC bool
+	// Preamble prefixes the output (and the table of contents) with an
+	// introduction saying what is attached and how it is delimited.
+	Preamble bool
+	// Header, if set, is put at the very top of the output, before the
+	// preamble and table of contents, which don't count it as an entry.
+	// It is left out of the JSON, and so of the render cache's keys.
+	Header string `json:"-"`
+	// DetailsOver wraps attached files longer than this many lines in a
+	// collapsible <details> element. 0 disables wrapping.
+	DetailsOver int
+	// FencePath puts each attached file's path in its fence info string
+	// (```go path=main.go) instead of on a separate line.
+	FencePath bool
+	// FileIDs tags each attached local file with its ID and the start of
+	// its SHA-256 in the fence info string (```go id=1a2b3c4d
+	// sha256=...), so that a reply quoting the ID can be applied back to
+	// the right file. See File.ID.
+	FileIDs bool
+	// Languages holds the configured extension and file name to language
+	// mappings. See LanguageFor.
+	Languages map[string]string
+	// Cache, if set, holds renderings of attached files from earlier runs.
+	Cache *Cache `json:"-"`
+}
+
+// Message is a paragraph of text.
+type Message struct {
+	Text string
+	// Source records where the message came from, such as the inserted
+	// file's path or "clipboard". It is empty for messages typed inline.
+	Source string
+	// Lang, if set, fences the text as that language instead of letting it
+	// read as part of the message; see DetectLanguage.
+	Lang string
+}
+
+func (e Message) RenderMarkdown(opts RenderOptions) string {
+	return fenceAs(e.Lang, e.Text)
+}
+
+// File is an attached file, rendered in a fenced code block.
+type File struct {
+	// StoragePath is where the file's content can be read: the file itself,
+	// or a local temporary copy of a remote or imported file.
+	StoragePath string
+	// OriginalPath is the path the file was attached by, possibly
+	// host:path. It is shown in the output unless Label is set.
+	OriginalPath string
+	// Label, if set, is shown in place of OriginalPath, e.g. to hide a
+	// machine-specific prefix or to say which environment a file came from.
+	Label string
+	// Lang, if set, is the fence language in place of the one for
+	// OriginalPath, for content stored in another form, such as an HTML
+	// file converted to markdown.
+	Lang string
+}
+
+// DisplayPath returns the name the file is shown under: its Label, or else
+// its OriginalPath.
+func (e File) DisplayPath() string {
+	if e.Label != "" {
+		return e.Label
+	}
+	return e.OriginalPath
+}
+
+// ID returns the file's ID, which names it the same way in every run: a
+// hash of its absolute path. Remote and stored copies, which can't be
+// written back, have no ID.
+func (e File) ID() string {
+	if e.IsRemote() {
+		return ""
+	}
+	path, err := filepath.Abs(e.StoragePath)
+	if err != nil {
+		return ""
+	}
+	return FileID(path)
+}
+
+// FileID returns the ID of the local file at the absolute path.
+func FileID(path string) string {
+	sum := sha256.Sum256([]byte(path))
+	return hex.EncodeToString(sum[:4])
+}
+
+// HashContent returns the hex SHA-256 of r's content.
+func HashContent(r io.Reader) (string, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// fileIDHashLength is how many hex digits of a file's SHA-256 are shown
+// beside its ID.
+const fileIDHashLength = 16
+
+func (e File) RenderMarkdown(opts RenderOptions) string {
+	var key string
+	if opts.Cache != nil {
+		if info, err := os.Stat(e.StoragePath); err == nil {
+			key = opts.Cache.key(e, info, opts)
+		}
+		if key != "" {
+			if markdown, ok := opts.Cache.get(key); ok {
+				return markdown
+			}
+		}
+	}
+
+	var markdown strings.Builder
+	file, err := os.Open(e.StoragePath)
+	if err == nil {
+		defer file.Close()
+		err = e.copyMarkdown(&markdown, file, opts)
+	}
+	if err != nil {
+		// Leave a visible trace rather than silently dropping the file.
+		slog.Warn("failed to read attached file", "path", e.OriginalPath, "error", err)
+		return e.unreadable(err)
+	}
+	if key != "" {
+		opts.Cache.put(key, markdown.String())
+	}
+	return markdown.String()
+}
+
+// WriteMarkdown writes the same markdown as RenderMarkdown, copying the
+// file's content rather than holding it in memory. If the file can't be
+// opened, it writes a note saying so instead.
+func (e File) WriteMarkdown(w io.Writer, opts RenderOptions) error {
+	file, err := os.Open(e.StoragePath)
+	if err != nil {
+		slog.Warn("failed to read attached file", "path", e.OriginalPath, "error", err)
+		_, err := io.WriteString(w, e.unreadable(err))
+		return err
+	}
+	defer file.Close()
+	return e.copyMarkdown(w, file, opts)
+}
+
+// unreadable returns the note that stands in for a file that can't be read.
+func (e File) unreadable(err error) string {
+	return fmt.Sprintf("`%s` (could not be read: %v)\n", e.DisplayPath(), err)
+}
+
+// copyMarkdown writes the markdown for e, whose content is read from file.
+func (e File) copyMarkdown(w io.Writer, file *os.File, opts RenderOptions) error {
+	// The header needs the size and line count, so count them first.
+	var size int64
+	var lines int
+	var err error
+	if opts.Metadata || opts.DetailsOver > 0 {
+		if size, lines, err = countContent(file); err != nil {
+			return err
+		}
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+	}
+
+	var metadata string
+	if opts.Metadata {
+		metadata = e.metadata(size, lines)
+	}
+
+	var tag string
+	if id := e.ID(); opts.FileIDs && id != "" {
+		sum, err := HashContent(file)
+		if err != nil {
+			return err
+		}
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		tag = fmt.Sprintf(" id=%s sha256=%s", id, sum[:fileIDHashLength])
+	}
+
+	var header strings.Builder
+	lang := e.Lang
+	if lang == "" {
+		lang = LanguageFor(e.OriginalPath, opts.Languages)
+	}
+	fence := "```" + lang
+	collapse := opts.DetailsOver > 0 && lines > opts.DetailsOver
+	if fence == "```" && (opts.FencePath || tag != "") {
+		// The first word of an info string is taken as the language.
+		fence += "text"
+	}
+	if opts.FencePath {
+		fence += " path=" + quoteInfoValue(e.DisplayPath())
+	}
+	fence += tag
+	if collapse {
+		// Chat UIs that render HTML show only the summary until expanded.
+		// The blank lines let the fenced block inside render as markdown.
+		header.WriteString(fmt.Sprintf("<details><summary><code>%s</code>", html.EscapeString(e.DisplayPath())))
+		if metadata != "" {
+			header.WriteString(" (" + html.EscapeString(metadata) + ")")
+		}
+		header.WriteString("</summary>\n\n")
+	} else if opts.FencePath {
+		// The path travels in the fence info string, so only the metadata
+		// (if any) needs a line of its own.
+		if metadata != "" {
+			header.WriteString(fmt.Sprintf("_%s_\n", metadata))
+		}
+	} else if metadata != "" {
+		header.WriteString(fmt.Sprintf("`%s` (%s)\n", e.DisplayPath(), metadata))
+	} else {
+		header.WriteString(fmt.Sprintf("`%s`\n", e.DisplayPath()))
+	}
+	header.WriteString(fence + "\n")
+	if _, err := io.WriteString(w, header.String()); err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, file); err != nil {
+		return err
+	}
+
+	footer := "```\n"
+	if collapse {
+		footer += "\n</details>\n"
+	}
+	_, err = io.WriteString(w, footer)
+	return err
+}
+
+// IsRemote reports whether the entry was copied from another host, in which
+// case StoragePath is a local temporary copy of OriginalPath.
+func (e File) IsRemote() bool {
+	return e.StoragePath != e.OriginalPath
+}
+
+// metadata describes the file for its header line: size and line count, plus
+// modification time and git status for local files.
+func (e File) metadata(size int64, lines int) string {
+	parts := []string{FormatSize(size), FormatLineCount(lines)}
+	if !e.IsRemote() {
+		if info, err := os.Stat(e.StoragePath); err == nil {
+			parts = append(parts, "modified "+info.ModTime().Format("2006-01-02 15:04"))
+		}
+		if status := gitStatus(e.StoragePath); status != "" {
+			parts = append(parts, "git: "+status)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// quoteInfoValue quotes a fence info string value if it contains characters
+// that would otherwise end it.
+func quoteInfoValue(value string) string {
+	if strings.ContainsAny(value, " \t\"") {
+		return strconv.Quote(value)
+	}
+	return value
+}
+
+// Duplicate stands in for a file that was already included earlier in the
+// output. It is produced by Dedupe in DedupeStub mode.
+type Duplicate struct {
+	OriginalPath string
+}
+
+func (e Duplicate) RenderMarkdown(opts RenderOptions) string {
+	return fmt.Sprintf("`%s` (duplicate; see above)\n", e.OriginalPath)
+}
+
+// Output is the output of a command.
+type Output struct {
+	Output string
+	// Command is the command line that produced the output.
+	Command string
+	// Lang, if set, fences the output as that language; see
+	// DetectLanguage.
+	Lang string
+}
+
+func (e Output) RenderMarkdown(opts RenderOptions) string {
+	return fenceAs(e.Lang, e.Output)
+}
+
+// fenceAs returns text trimmed of surrounding space and, if lang is set,
+// in a fenced code block of that language.
+func fenceAs(lang, text string) string {
+	text = strings.TrimSpace(text) + "\n"
+	if lang == "" {
+		return text
+	}
+	return "```" + lang + "\n" + text + "```\n"
+}
+
+// Diff is a unified diff between two versions of a file.
+type Diff struct {
+	// Path names what was compared.
+	Path string
+	// Diff is the unified diff, or "" if there are no differences.
+	Diff string
+	// Words reports whether Diff marks changed words rather than lines;
+	// see diff.Words.
+	Words bool
+}
+
+func (e Diff) RenderMarkdown(opts RenderOptions) string {
+	if e.Diff == "" {
+		return fmt.Sprintf("`%s` (no differences)\n", e.Path)
+	}
+	if e.Words {
+		return fmt.Sprintf("`%s` (word diff)\n```\n%s```\n", e.Path, e.Diff)
+	}
+	return fmt.Sprintf("`%s` (diff)\n```diff\n%s```\n", e.Path, e.Diff)
+}
+
+// Failure stands in for a subcommand, or one of its files, that failed
+// when ch was run with -keep-going.
+type Failure struct {
+	// Command is the subcommand that failed, e.g. "attach missing.go".
+	Command string
+	// Error is the text of the error.
+	Error string
+}
+
+func (e Failure) RenderMarkdown(opts RenderOptions) string {
+	quoted := strings.ReplaceAll(strings.TrimSpace(e.Error), "\n", "\n> ")
+	return fmt.Sprintf("> **Failed:** `%s`\n> %s\n", e.Command, quoted)
+}
+
+// Roles are the roles a Turn can have.
+var Roles = []string{"system", "user", "assistant"}
+
+// Turn begins a turn of a conversation: the entries after it, up to the
+// next Turn, are what Role said. In markdown a turn is headed by its role;
+// structured outputs group the turns into an array of roles and contents
+// instead (see render.Transcript).
+type Turn struct {
+	// Role is one of Roles.
+	Role string
+}
+
+func (e Turn) RenderMarkdown(opts RenderOptions) string {
+	return "## " + strings.ToUpper(e.Role[:1]) + e.Role[1:] + "\n"
+}
@@ -0,0 +1,224 @@
+package entry
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLanguageFor(t *testing.T) {
+	testCases := map[string]string{
+		"main.go":                 "go",
+		"src/App.TSX":             "tsx",
+		"host:/etc/app.yml":       "yaml",
+		"build/Dockerfile":        "dockerfile",
+		"notes.txt":               "",
+		"Makefile.am":             "",
+		"/path/to/CMakeLists.txt": "cmake",
+	}
+	for path, expected := range testCases {
+		if actual := LanguageFor(path, nil); actual != expected {
+			t.Errorf("LanguageFor(%q) = %q, expected %q", path, actual, expected)
+		}
+	}
+
+	overrides := map[string]string{
+		".TFVARS":     "hcl",
+		".ts":         "ts",
+		"Dockerfile":  "docker",
+		"Jenkinsfile": "groovy",
+	}
+	overrideCases := map[string]string{
+		"prod.tfvars":      "hcl",
+		"src/index.ts":     "ts",
+		"Dockerfile":       "docker",
+		"ci/Jenkinsfile":   "groovy",
+		"main.go":          "go",
+		"Dockerfile.local": "",
+	}
+	for path, expected := range overrideCases {
+		if actual := LanguageFor(path, overrides); actual != expected {
+			t.Errorf("LanguageFor(%q, overrides) = %q, expected %q", path, actual, expected)
+		}
+	}
+}
+
+func TestDetectLanguage(t *testing.T) {
+	testCases := map[string]string{
+		"{\"id\": 1, \"tags\": [\"a\"]}\n": "json",
+		"[1, 2,\n 3]":                      "json",
+		"{not json}\nat all\n":             "",
+		"diff --git a/x b/x\nindex 1..2\n--- a/x\n+++ b/x\n@@ -1 +1 @@\n-a\n+b\n":        "diff",
+		"name: app\nreplicas: 3\nports:\n  - 80\n  - 443\n":                              "yaml",
+		"# config\nkey: value\n\nother: value\n":                                         "yaml",
+		"- first item\n- second item\n":                                                  "",
+		"2024-05-01T10:00:00Z INFO starting\n2024-05-01T10:00:01Z ERROR failed\n":        "log",
+		"May  1 10:00:00 host sshd[1]: accepted\nMay  1 10:00:02 host sshd[1]: closed\n": "log",
+		"[WARN] low disk\n[ERROR] disk full\nretrying\n":                                 "log",
+		"Just some words.\nAnd some more.\n":                                             "",
+		"key: value\n":                                                                   "",
+		"":                                                                               "",
+	}
+	for text, expected := range testCases {
+		if actual := DetectLanguage(text); actual != expected {
+			t.Errorf("DetectLanguage(%q) = %q, expected %q", text, actual, expected)
+		}
+	}
+}
+
+func TestDedupe(t *testing.T) {
+	dir := t.TempDir()
+	file1 := filepath.Join(dir, "file1.txt")
+	file2 := filepath.Join(dir, "file2.txt")
+	// The same file spelled differently must still be recognized as a repeat.
+	file1Unclean := dir + string(filepath.Separator) + "." + string(filepath.Separator) + "file1.txt"
+
+	entries := []Entry{
+		Message{Text: "Intro"},
+		File{StoragePath: file1, OriginalPath: file1},
+		File{StoragePath: file2, OriginalPath: file2},
+		File{StoragePath: file1Unclean, OriginalPath: file1Unclean},
+		Message{Text: "Intro"},
+	}
+
+	testCases := []struct {
+		name     string
+		mode     string
+		expected []Entry
+	}{
+		{
+			name:     "Off",
+			mode:     DedupeOff,
+			expected: entries,
+		},
+		{
+			name: "Drop",
+			mode: DedupeDrop,
+			expected: []Entry{
+				Message{Text: "Intro"},
+				File{StoragePath: file1, OriginalPath: file1},
+				File{StoragePath: file2, OriginalPath: file2},
+				Message{Text: "Intro"},
+			},
+		},
+		{
+			name: "Stub",
+			mode: DedupeStub,
+			expected: []Entry{
+				Message{Text: "Intro"},
+				File{StoragePath: file1, OriginalPath: file1},
+				File{StoragePath: file2, OriginalPath: file2},
+				Duplicate{OriginalPath: file1Unclean},
+				Message{Text: "Intro"},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual := Dedupe(entries, tc.mode)
+			if !reflect.DeepEqual(actual, tc.expected) {
+				t.Errorf("Expected entries: %v\n  Actual entries: %v", tc.expected, actual)
+			}
+		})
+	}
+}
+
+// setupTestFiles creates a file containing "File content\n" and an empty
+// file in a temporary directory, returning the directory and both paths.
+func setupTestFiles(t *testing.T) (string, string, string) {
+	dir := t.TempDir()
+
+	fileWithContentPath := filepath.Join(dir, "file.txt")
+	err := os.WriteFile(fileWithContentPath, []byte("File content\n"), 0644)
+	if err != nil {
+		t.Fatalf("Failed to create file with content: %v", err)
+	}
+
+	emptyFilePath := filepath.Join(dir, "empty.txt")
+	err = os.WriteFile(emptyFilePath, []byte{}, 0644)
+	if err != nil {
+		t.Fatalf("Failed to create empty file: %v", err)
+	}
+
+	return dir, fileWithContentPath, emptyFilePath
+}
+
+func TestCounts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.txt")
+	if err := os.WriteFile(path, []byte("12345"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	entries := []Entry{
+		Message{Text: "hi"},
+		File{StoragePath: path, OriginalPath: path},
+		Prioritized{Entry: File{StoragePath: path, OriginalPath: path}, Priority: PriorityLow},
+		Failure{Command: "attach missing.go", Error: "not found"},
+	}
+	if size := AttachedSize(entries); size != 10 {
+		t.Errorf("Expected 10 bytes attached\n  Actual %d", size)
+	}
+	if failures := CountFailures(entries); failures != 1 {
+		t.Errorf("Expected 1 failure\n  Actual %d", failures)
+	}
+}
+
+func TestFileRenderUnreadable(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing.txt")
+	actual := File{StoragePath: missing, OriginalPath: "missing.txt"}.RenderMarkdown(RenderOptions{})
+	if !strings.HasPrefix(actual, "`missing.txt` (could not be read: ") {
+		t.Errorf("Expected a could-not-be-read placeholder\n  Actual: %q", actual)
+	}
+}
+
+func TestFileRenderLabel(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(path, []byte("port: 80\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	file := File{StoragePath: path, OriginalPath: path, Label: "config (prod)"}
+	testCases := []struct {
+		opts     RenderOptions
+		expected string
+	}{
+		{RenderOptions{}, "`config (prod)`\n```yaml\nport: 80\n```\n"},
+		{RenderOptions{FencePath: true}, "```yaml path=\"config (prod)\"\nport: 80\n```\n"},
+	}
+	for _, tc := range testCases {
+		if actual := file.RenderMarkdown(tc.opts); actual != tc.expected {
+			t.Errorf("Expected %q\n  Actual: %q", tc.expected, actual)
+		}
+	}
+}
+
+func TestFileRenderIDs(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "notes")
+	if err := os.WriteFile(path, []byte("hello\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// The first digits of the SHA-256 of "hello\n".
+	tag := "id=" + FileID(path) + " sha256=5891b5b522d5df08"
+	file := File{StoragePath: path, OriginalPath: path}
+	testCases := []struct {
+		file     File
+		opts     RenderOptions
+		expected string
+	}{
+		{file, RenderOptions{FileIDs: true}, "`" + path + "`\n```text " + tag + "\nhello\n```\n"},
+		{file, RenderOptions{FileIDs: true, FencePath: true}, "```text path=" + path + " " + tag + "\nhello\n```\n"},
+		{file, RenderOptions{}, "`" + path + "`\n```\nhello\n```\n"},
+		// A remote copy can't be written back, so it has no ID.
+		{File{StoragePath: path, OriginalPath: "host:notes"}, RenderOptions{FileIDs: true}, "`host:notes`\n```\nhello\n```\n"},
+	}
+	for _, tc := range testCases {
+		if actual := tc.file.RenderMarkdown(tc.opts); actual != tc.expected {
+			t.Errorf("Expected %q\n  Actual: %q", tc.expected, actual)
+		}
+	}
+	if id := file.ID(); len(id) != 8 || id != FileID(path) {
+		t.Errorf("Expected the 8-digit ID of %s\n  Actual %q", path, id)
+	}
+}
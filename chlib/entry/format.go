@@ -0,0 +1,145 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package entry
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// CountLines returns the number of lines in content, counting a final line
+// that lacks a trailing newline.
+func CountLines(content []byte) int {
+	lines := bytes.Count(content, []byte("\n"))
+	if len(content) > 0 && content[len(content)-1] != '\n' {
+		lines++
+	}
+	return lines
+}
+
+// CountFileLines returns the number of lines in the file at path, as
+// CountLines would for its content, without reading it all into memory.
+func CountFileLines(path string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	_, lines, err := countContent(file)
+	return lines, err
+}
+
+// countContent returns the size of r's content in bytes and the number of
+// lines in it, as CountLines would count them.
+func countContent(r io.Reader) (int64, int, error) {
+	var size int64
+	var lines int
+	last := byte('\n')
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			size += int64(n)
+			lines += bytes.Count(buf[:n], []byte("\n"))
+			last = buf[n-1]
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+	if last != '\n' {
+		lines++
+	}
+	return size, lines, nil
+}
+
+// FormatLineCount renders a line count such as "1 line" or "12 lines".
+func FormatLineCount(lines int) string {
+	if lines == 1 {
+		return "1 line"
+	}
+	return fmt.Sprintf("%d lines", lines)
+}
+
+// FormatSize renders a byte count in human-readable units.
+func FormatSize(size int64) string {
+	switch {
+	case size < 1024:
+		return fmt.Sprintf("%d B", size)
+	case size < 1024*1024:
+		return fmt.Sprintf("%.1f KB", float64(size)/1024)
+	default:
+		return fmt.Sprintf("%.1f MB", float64(size)/(1024*1024))
+	}
+}
+
+// gitStatus returns a short description of the file's git status, such as
+// "clean", "modified", or "untracked". It returns "" if the file is not in a
+// git working tree or git is unavailable.
+func gitStatus(filePath string) string {
+	dir, name := filepath.Split(filePath)
+	if dir == "" {
+		dir = "."
+	}
+	output, err := exec.Command("git", "-C", dir, "status", "--porcelain", "--ignored", "--", name).Output()
+	if err != nil {
+		slog.Debug("git status unavailable", "path", filePath, "error", err)
+		return ""
+	}
+	status := strings.TrimRight(string(output), "\n")
+	if status == "" {
+		// Nothing to report: the file is either tracked and unchanged, or
+		// git does not know about it at all.
+		if exec.Command("git", "-C", dir, "ls-files", "--error-unmatch", "--", name).Run() != nil {
+			return ""
+		}
+		return "clean"
+	}
+	if len(status) < 2 {
+		return ""
+	}
+	switch code := status[:2]; {
+	case code == "??":
+		return "untracked"
+	case code == "!!":
+		return "ignored"
+	case strings.Contains(code, "A"):
+		return "added"
+	case strings.Contains(code, "D"):
+		return "deleted"
+	case strings.Contains(code, "R"):
+		return "renamed"
+	case strings.Contains(code, "U"):
+		return "conflicted"
+	case code[0] != ' ' && code[1] == ' ':
+		return "staged"
+	default:
+		return "modified"
+	}
+}
@@ -0,0 +1,169 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package entry
+
+import (
+	"encoding/json"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// languagesByExtension maps lowercase file extensions to the language names
+// used in fence info strings.
+var languagesByExtension = map[string]string{
+	".bash":  "bash",
+	".c":     "c",
+	".cc":    "cpp",
+	".cpp":   "cpp",
+	".cs":    "csharp",
+	".css":   "css",
+	".dart":  "dart",
+	".go":    "go",
+	".h":     "c",
+	".hpp":   "cpp",
+	".html":  "html",
+	".java":  "java",
+	".js":    "javascript",
+	".json":  "json",
+	".jsx":   "jsx",
+	".kt":    "kotlin",
+	".lua":   "lua",
+	".md":    "markdown",
+	".php":   "php",
+	".pl":    "perl",
+	".proto": "protobuf",
+	".ps1":   "powershell",
+	".py":    "python",
+	".r":     "r",
+	".rb":    "ruby",
+	".rs":    "rust",
+	".scala": "scala",
+	".scss":  "scss",
+	".sh":    "bash",
+	".sql":   "sql",
+	".swift": "swift",
+	".tf":    "hcl",
+	".toml":  "toml",
+	".ts":    "typescript",
+	".tsx":   "tsx",
+	".vue":   "vue",
+	".xml":   "xml",
+	".yaml":  "yaml",
+	".yml":   "yaml",
+	".zsh":   "zsh",
+}
+
+// languagesByFilename maps well-known file names that have no meaningful
+// extension to fence languages.
+var languagesByFilename = map[string]string{
+	"CMakeLists.txt": "cmake",
+	"Dockerfile":     "dockerfile",
+	"Makefile":       "makefile",
+}
+
+// LanguageFor returns the fence language for a file path, or "" if unknown.
+// Keys in overrides are either extensions (starting with ".") or exact file
+// names, and take precedence over the built-in tables.
+func LanguageFor(filePath string, overrides map[string]string) string {
+	name := path.Base(filepath.ToSlash(filePath))
+	ext := strings.ToLower(path.Ext(name))
+	if lang, ok := overrides[name]; ok {
+		return lang
+	}
+	if lang, ok := languagesByFilename[name]; ok {
+		return lang
+	}
+	for key, lang := range overrides {
+		if strings.HasPrefix(key, ".") && strings.ToLower(key) == ext {
+			return lang
+		}
+	}
+	return languagesByExtension[ext]
+}
+
+var (
+	// logLinePattern matches a line that starts like a log record: with a
+	// timestamp, a syslog date, or a level.
+	logLinePattern = regexp.MustCompile(`^(\[?\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}|[A-Z][a-z]{2} [ \d]\d \d{2}:\d{2}:\d{2} |\[?(TRACE|DEBUG|INFO|WARN|WARNING|ERROR|FATAL)\b)`)
+	// yamlItemPattern matches a YAML sequence item, and yamlKeyPattern a
+	// mapping key.
+	yamlItemPattern = regexp.MustCompile(`^\s*-( |$)`)
+	yamlKeyPattern  = regexp.MustCompile(`^\s*[\w"'./-]+:( |$)`)
+)
+
+// DetectLanguage returns the fence language that text, such as a command's
+// output, appears to be written in: "diff", "json", "yaml", or "log". It
+// returns "" if the text looks like none of them.
+func DetectLanguage(text string) string {
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" {
+		return ""
+	}
+	if (trimmed[0] == '{' || trimmed[0] == '[') && json.Valid([]byte(trimmed)) {
+		return "json"
+	}
+	lines := strings.Split(trimmed, "\n")
+	if looksLikeDiff(lines) {
+		return "diff"
+	}
+	var content, logLines, yamlLines, yamlKeys int
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		content++
+		if logLinePattern.MatchString(line) {
+			logLines++
+		}
+		switch {
+		case yamlKeyPattern.MatchString(line):
+			yamlKeys++
+			yamlLines++
+		case yamlItemPattern.MatchString(line) || strings.HasPrefix(line, " "):
+			yamlLines++
+		}
+	}
+	// A lone line is too little to go on; otherwise most lines of a log
+	// start like a record, while every line of YAML is a key, an item, or
+	// indented under one. Requiring a key keeps markdown lists out.
+	switch {
+	case content < 2:
+		return ""
+	case logLines*2 > content:
+		return "log"
+	case yamlLines == content && yamlKeys > 0 && !strings.HasPrefix(lines[0], " "):
+		return "yaml"
+	}
+	return ""
+}
+
+// looksLikeDiff reports whether lines contain the start of a unified diff:
+// "---" and "+++" headers followed by a hunk. Lines before it, such as git's
+// "diff --git" header or the commit shown by git show, belong to the diff.
+func looksLikeDiff(lines []string) bool {
+	for i := 0; i+2 < len(lines); i++ {
+		if strings.HasPrefix(lines[i], "--- ") && strings.HasPrefix(lines[i+1], "+++ ") && strings.HasPrefix(lines[i+2], "@@ ") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,210 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package entry
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"slices"
+	"unicode/utf8"
+)
+
+// SchemaVersion is the version of the JSON forms of entries: entry lists,
+// and the manifests and other output that describe entries in the same
+// terms. It goes up when a change could mislead a reader that doesn't know
+// of it, such as renaming a field or changing what one means; adding an
+// optional field or an entry type doesn't change it.
+const SchemaVersion = 1
+
+// List is the JSON form of a list of collected entries, written by ch's
+// -export flag and read by its import subcommand. Unlike a manifest, it
+// carries each entry's full content, so entries can be rendered on another
+// machine or in a later invocation.
+type List struct {
+	// SchemaVersion is the SchemaVersion the list was written with. Lists
+	// written before it was recorded have none, and version 1's layout.
+	SchemaVersion int        `json:"schemaVersion,omitempty"`
+	Entries       []Exported `json:"entries"`
+}
+
+// Upgrade brings a list read from JSON up to SchemaVersion, so that
+// lists written by older versions of ch, or by plugins written against
+// them, can still be read. A list from a newer version of ch is an error,
+// since its fields may not mean what this version takes them to.
+func (l *List) Upgrade() error {
+	switch {
+	case l.SchemaVersion > SchemaVersion:
+		return fmt.Errorf("entry list has schema version %d, but this ch reads only up to version %d; upgrade ch to read it", l.SchemaVersion, SchemaVersion)
+	case l.SchemaVersion < 0:
+		return fmt.Errorf("invalid entry list schema version %d", l.SchemaVersion)
+	case l.SchemaVersion == 0:
+		l.SchemaVersion = 1
+	}
+	// Later versions migrate older lists here, a version at a time.
+	return nil
+}
+
+// Exported is the JSON form of one entry.
+type Exported struct {
+	// Type is "message", "file", "output", "duplicate", "diff", "failure",
+	// or "turn".
+	Type string `json:"type"`
+	// Path is the original path (possibly host:path) of a file or
+	// duplicate, or the files compared by a diff.
+	Path string `json:"path,omitempty"`
+	// Label is the name a file is shown under, if not its path.
+	Label string `json:"label,omitempty"`
+	// Source is where a message came from; see Message.
+	Source string `json:"source,omitempty"`
+	// Command is the command line that produced an output, or the
+	// subcommand that failed.
+	Command  string `json:"command,omitempty"`
+	Priority string `json:"priority,omitempty"`
+	// Content holds the message text, command output, diff, error text, or
+	// file contents. File contents that are not valid UTF-8 are stored
+	// base64-encoded in ContentBase64 instead.
+	Content       string `json:"content,omitempty"`
+	ContentBase64 string `json:"contentBase64,omitempty"`
+	// Words reports whether a diff marks changed words; see Diff.Words.
+	Words bool `json:"words,omitempty"`
+	// Lang is the language a message, output, or file is fenced as, if not
+	// the default.
+	Lang string `json:"lang,omitempty"`
+	// Role is the role of a turn; see Turn.
+	Role string `json:"role,omitempty"`
+}
+
+// Export converts entries to their JSON form, reading the contents of
+// attached files.
+func Export(entries []Entry) (List, error) {
+	list := List{SchemaVersion: SchemaVersion, Entries: []Exported{}}
+	for _, entry := range entries {
+		var exported Exported
+		if p := PriorityOf(entry); p != PriorityNormal {
+			exported.Priority = p.String()
+		}
+		switch e := Unwrap(entry).(type) {
+		case Message:
+			exported.Type, exported.Source, exported.Content, exported.Lang = "message", e.Source, e.Text, e.Lang
+		case File:
+			exported.Type, exported.Path, exported.Label, exported.Lang = "file", e.OriginalPath, e.Label, e.Lang
+			content, err := os.ReadFile(e.StoragePath)
+			if err != nil {
+				return List{}, fmt.Errorf("failed to read file %s: %v", e.OriginalPath, err)
+			}
+			if utf8.Valid(content) {
+				exported.Content = string(content)
+			} else {
+				exported.ContentBase64 = base64.StdEncoding.EncodeToString(content)
+			}
+		case Duplicate:
+			exported.Type, exported.Path = "duplicate", e.OriginalPath
+		case Output:
+			exported.Type, exported.Command, exported.Content, exported.Lang = "output", e.Command, e.Output, e.Lang
+		case Diff:
+			exported.Type, exported.Path, exported.Content = "diff", e.Path, e.Diff
+			exported.Words = e.Words
+		case Failure:
+			exported.Type, exported.Command, exported.Content = "failure", e.Command, e.Error
+		case Turn:
+			exported.Type, exported.Role = "turn", e.Role
+		default:
+			return List{}, fmt.Errorf("unsupported entry type %T", e)
+		}
+		list.Entries = append(list.Entries, exported)
+	}
+	return list, nil
+}
+
+// Import converts a JSON entry list back into entries, upgrading it first
+// (see List.Upgrade). The contents of files are written to temporary files
+// in tempDir, so imported files render like files copied from a remote
+// host.
+func Import(tempDir string, list List) ([]Entry, error) {
+	if err := list.Upgrade(); err != nil {
+		return nil, err
+	}
+	var entries []Entry
+	for i, exported := range list.Entries {
+		var entry Entry
+		switch exported.Type {
+		case "message":
+			entry = Message{Text: exported.Content, Source: exported.Source, Lang: exported.Lang}
+		case "output":
+			entry = Output{Output: exported.Content, Command: exported.Command, Lang: exported.Lang}
+		case "duplicate":
+			entry = Duplicate{OriginalPath: exported.Path}
+		case "diff":
+			entry = Diff{Path: exported.Path, Diff: exported.Content, Words: exported.Words}
+		case "failure":
+			entry = Failure{Command: exported.Command, Error: exported.Content}
+		case "turn":
+			if !slices.Contains(Roles, exported.Role) {
+				return nil, fmt.Errorf("entry %d: invalid role %q (expected system, user, or assistant)", i+1, exported.Role)
+			}
+			entry = Turn{Role: exported.Role}
+		case "file":
+			content := []byte(exported.Content)
+			if exported.ContentBase64 != "" {
+				var err error
+				if content, err = base64.StdEncoding.DecodeString(exported.ContentBase64); err != nil {
+					return nil, fmt.Errorf("entry %d: invalid base64 content: %v", i+1, err)
+				}
+			}
+			file, err := NewStoredFile(tempDir, exported.Path, content)
+			if err != nil {
+				return nil, fmt.Errorf("entry %d: failed to store file content: %v", i+1, err)
+			}
+			file.Label, file.Lang = exported.Label, exported.Lang
+			entry = file
+		default:
+			return nil, fmt.Errorf("entry %d: unknown entry type %q", i+1, exported.Type)
+		}
+
+		p := PriorityNormal
+		if exported.Priority != "" {
+			var err error
+			if p, err = ParsePriority(exported.Priority); err != nil {
+				return nil, fmt.Errorf("entry %d: %v", i+1, err)
+			}
+		}
+		entries = append(entries, WithPriority([]Entry{entry}, p)...)
+	}
+	return entries, nil
+}
+
+// NewStoredFile returns a File whose content is stored in a new temporary
+// file in tempDir, for content that did not come from a local file, such as
+// an imported file or one recovered from generated markdown.
+func NewStoredFile(tempDir, originalPath string, content []byte) (File, error) {
+	tempFile, err := os.CreateTemp(tempDir, "stored-")
+	if err != nil {
+		return File{}, err
+	}
+	_, err = tempFile.Write(content)
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return File{}, err
+	}
+	return File{StoragePath: tempFile.Name(), OriginalPath: originalPath}, nil
+}
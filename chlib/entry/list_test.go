@@ -0,0 +1,113 @@
+package entry
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExportImportRoundTrip(t *testing.T) {
+	dir, fileWithContentPath, emptyFilePath := setupTestFiles(t)
+
+	binaryPath := filepath.Join(dir, "data.bin")
+	if err := os.WriteFile(binaryPath, []byte{0xff, 0x00, 0xfe, '\n'}, 0644); err != nil {
+		t.Fatalf("Failed to create binary file: %v", err)
+	}
+
+	entries := []Entry{
+		Message{Text: "Hello"},
+		Message{Text: "From a file", Source: "notes.txt"},
+		Prioritized{Entry: File{StoragePath: fileWithContentPath, OriginalPath: fileWithContentPath}, Priority: PriorityLow},
+		File{StoragePath: emptyFilePath, OriginalPath: emptyFilePath, Label: "empty (labeled)"},
+		File{StoragePath: binaryPath, OriginalPath: "host:/data.bin"},
+		Duplicate{OriginalPath: emptyFilePath},
+		Output{Output: "ok\n", Command: "echo ok"},
+		Diff{Path: "a vs b", Diff: "--- a\n+++ b\n@@ -1 +1 @@\n-x\n+y\n"},
+		Output{Output: "{}\n", Command: "echo {}", Lang: "json"},
+		File{StoragePath: fileWithContentPath, OriginalPath: "page.html", Lang: "markdown"},
+		Diff{Path: "c vs d", Diff: "--- c\n+++ d\n@@ -1 +1 @@\n[-x-]{+y+}\n", Words: true},
+		Failure{Command: "attach missing.go", Error: "file does not exist: missing.go"},
+		Turn{Role: "assistant"},
+	}
+
+	list, err := Export(entries)
+	if err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	if list.Entries[4].ContentBase64 == "" || list.Entries[4].Content != "" {
+		t.Errorf("Expected binary content to be base64-encoded, got %+v", list.Entries[4])
+	}
+
+	data, err := json.Marshal(list)
+	if err != nil {
+		t.Fatalf("Failed to marshal list: %v", err)
+	}
+	var decoded List
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Failed to unmarshal list: %v", err)
+	}
+
+	imported, err := Import(dir, decoded)
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	if len(imported) != len(entries) {
+		t.Fatalf("Expected %d imported entries, got %d", len(entries), len(imported))
+	}
+	if PriorityOf(imported[2]) != PriorityLow {
+		t.Errorf("Expected the priority to survive the round trip, got %v", PriorityOf(imported[2]))
+	}
+	for i, entry := range entries {
+		expected := entry.RenderMarkdown(RenderOptions{})
+		actual := imported[i].RenderMarkdown(RenderOptions{})
+		if actual != expected {
+			t.Errorf("Entry %d renders differently after import.\nExpected: %q\n  Actual: %q", i+1, expected, actual)
+		}
+	}
+	for _, i := range []int{0, 1, 5, 6, 7, 8, 10, 11, 12} {
+		if !reflect.DeepEqual(imported[i], entries[i]) {
+			t.Errorf("Entry %d changed in the round trip: expected %v, got %v", i+1, entries[i], imported[i])
+		}
+	}
+}
+
+func TestImportErrors(t *testing.T) {
+	if _, err := Import(t.TempDir(), List{Entries: []Exported{{Type: "picture"}}}); err == nil {
+		t.Error("Expected an error for an unknown entry type")
+	}
+	if _, err := Import(t.TempDir(), List{Entries: []Exported{{Type: "message", Priority: "urgent"}}}); err == nil {
+		t.Error("Expected an error for an invalid priority")
+	}
+	if _, err := Import(t.TempDir(), List{Entries: []Exported{{Type: "turn", Role: "narrator"}}}); err == nil {
+		t.Error("Expected an error for an invalid role")
+	}
+	if _, err := Import(t.TempDir(), List{SchemaVersion: SchemaVersion + 1}); err == nil || !strings.Contains(err.Error(), "upgrade ch") {
+		t.Errorf("Expected an error for a list from a newer ch\n  Actual %v", err)
+	}
+}
+
+func TestListUpgrade(t *testing.T) {
+	list, err := Export([]Entry{Message{Text: "Hello"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list.SchemaVersion != SchemaVersion {
+		t.Errorf("Expected an exported list to have schema version %d\n  Actual %d", SchemaVersion, list.SchemaVersion)
+	}
+
+	// A list written before the schema was versioned reads as version 1.
+	var legacy List
+	if err := json.Unmarshal([]byte(`{"entries": [{"type": "message", "content": "Hello"}]}`), &legacy); err != nil {
+		t.Fatal(err)
+	}
+	if err := legacy.Upgrade(); err != nil || legacy.SchemaVersion != 1 {
+		t.Errorf("Expected version 1\n  Actual %d, %v", legacy.SchemaVersion, err)
+	}
+	entries, err := Import(t.TempDir(), legacy)
+	if err != nil || !reflect.DeepEqual(entries, []Entry{Message{Text: "Hello"}}) {
+		t.Errorf("Expected the legacy list to import\n  Actual %v, %v", entries, err)
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package entry
+
+import "fmt"
+
+// Priority tells budget enforcement and output splitting how to treat an
+// entry when space is short. Entries are normal unless given another
+// priority with WithPriority.
+type Priority int
+
+const (
+	// PriorityLow entries are dropped first when over budget, and may be cut
+	// across parts when splitting.
+	PriorityLow Priority = -1
+	// PriorityNormal entries are truncated when over budget once all
+	// low-priority entries are gone.
+	PriorityNormal Priority = 0
+	// PriorityHigh entries are never truncated or dropped.
+	PriorityHigh Priority = 1
+)
+
+// ParsePriority parses "high", "normal", or "low".
+func ParsePriority(s string) (Priority, error) {
+	switch s {
+	case "high":
+		return PriorityHigh, nil
+	case "normal":
+		return PriorityNormal, nil
+	case "low":
+		return PriorityLow, nil
+	default:
+		return PriorityNormal, fmt.Errorf("invalid priority %q (expected high, normal, or low)", s)
+	}
+}
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityHigh:
+		return "high"
+	case PriorityLow:
+		return "low"
+	default:
+		return "normal"
+	}
+}
+
+// Prioritized attaches a non-normal priority to an entry.
+type Prioritized struct {
+	Entry
+	Priority Priority
+}
+
+// WithPriority returns entries with p attached to each.
+func WithPriority(entries []Entry, p Priority) []Entry {
+	if p == PriorityNormal {
+		return entries
+	}
+	result := make([]Entry, len(entries))
+	for i, entry := range entries {
+		result[i] = Prioritized{Entry: Unwrap(entry), Priority: p}
+	}
+	return result
+}
+
+// Unwrap returns the underlying entry, without any attached priority.
+// Code that inspects entries by type should unwrap them first.
+func Unwrap(entry Entry) Entry {
+	if p, ok := entry.(Prioritized); ok {
+		return p.Entry
+	}
+	return entry
+}
+
+// PriorityOf returns the priority attached to entry.
+func PriorityOf(entry Entry) Priority {
+	if p, ok := entry.(Prioritized); ok {
+		return p.Priority
+	}
+	return PriorityNormal
+}
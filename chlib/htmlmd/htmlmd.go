@@ -0,0 +1,385 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+// Package htmlmd converts HTML documents to markdown, keeping what a reader
+// needs (headings, paragraphs, lists, code, links, and tables) and dropping
+// scripts, styles, and the rest of the markup.
+package htmlmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// skippedElements are dropped along with everything in them.
+var skippedElements = map[string]bool{
+	"iframe": true, "noscript": true, "script": true, "style": true,
+	"svg": true, "template": true, "textarea": true, "title": true,
+}
+
+// blockElements start and end paragraphs.
+var blockElements = map[string]bool{
+	"address": true, "article": true, "aside": true, "dd": true, "details": true,
+	"div": true, "dl": true, "dt": true, "fieldset": true, "figcaption": true,
+	"figure": true, "footer": true, "form": true, "header": true, "main": true,
+	"nav": true, "p": true, "section": true, "summary": true,
+}
+
+// Convert returns the markdown for an HTML document. Code blocks are fenced
+// with ~~~, so the result can itself be put in a ``` fence.
+func Convert(doc string) string {
+	c := &converter{frames: []*frame{{}}}
+	for _, t := range tokenize(doc) {
+		switch {
+		case c.skipped > 0:
+			if t.kind == startToken && skippedElements[t.name] {
+				c.skipped++
+			} else if t.kind == endToken && skippedElements[t.name] {
+				c.skipped--
+			}
+		case t.kind == textToken:
+			c.text(t.text)
+		case t.kind == startToken:
+			c.start(t)
+		default:
+			c.end(t.name)
+		}
+	}
+	for len(c.frames) > 1 {
+		c.end(c.top().tag)
+	}
+	if markdown := strings.TrimSpace(string(c.top().buf)); markdown != "" {
+		return markdown + "\n"
+	}
+	return ""
+}
+
+// frame collects the markdown for an element that is rewritten as a whole
+// when it ends: a blockquote or a preformatted block. The document itself
+// is the bottom frame.
+type frame struct {
+	tag  string
+	buf  []byte
+	lang string
+}
+
+// list is an open ul or ol; next is the number of an ol's next item.
+type list struct {
+	ordered bool
+	next    int
+}
+
+type converter struct {
+	frames  []*frame
+	lists   []list
+	links   []string // the targets of the open links, "" for those shown as text
+	skipped int      // how many skipped elements are open
+	inCell  bool     // whether a table cell is open
+	rows    int      // how many rows of the current table have ended
+	cells   int      // how many cells of the current row have ended
+}
+
+func (c *converter) top() *frame {
+	return c.frames[len(c.frames)-1]
+}
+
+func (c *converter) inPre() bool {
+	return c.top().tag == "pre"
+}
+
+// flat reports whether blocks must stay on one line, as in a list item or
+// a table cell.
+func (c *converter) flat() bool {
+	return len(c.lists) > 0 || c.inCell
+}
+
+// space separates words, unless the line is empty or ends in a space.
+func (c *converter) space() {
+	if buf := c.top().buf; len(buf) > 0 && buf[len(buf)-1] != '\n' && buf[len(buf)-1] != ' ' {
+		c.write(" ")
+	}
+}
+
+func (c *converter) write(s string) {
+	f := c.top()
+	f.buf = append(f.buf, s...)
+}
+
+// block ends the current paragraph, if any, with a blank line.
+func (c *converter) block() {
+	f := c.top()
+	f.buf = []byte(strings.TrimRight(string(f.buf), " \t"))
+	switch {
+	case len(f.buf) == 0 || strings.HasSuffix(string(f.buf), "\n\n"):
+	case f.buf[len(f.buf)-1] == '\n':
+		f.buf = append(f.buf, '\n')
+	default:
+		f.buf = append(f.buf, "\n\n"...)
+	}
+}
+
+// newline ends the current line, if any.
+func (c *converter) newline() {
+	f := c.top()
+	f.buf = []byte(strings.TrimRight(string(f.buf), " \t"))
+	if len(f.buf) > 0 && f.buf[len(f.buf)-1] != '\n' {
+		f.buf = append(f.buf, '\n')
+	}
+}
+
+// text writes text as HTML displays it: with runs of white space collapsed
+// to single spaces, except in preformatted blocks.
+func (c *converter) text(s string) {
+	if c.inPre() {
+		c.write(s)
+		return
+	}
+	s = collapseSpace(s)
+	if buf := c.top().buf; len(buf) == 0 || buf[len(buf)-1] == '\n' || buf[len(buf)-1] == ' ' {
+		s = strings.TrimLeft(s, " ")
+	}
+	if c.inCell {
+		s = strings.ReplaceAll(s, "|", `\|`)
+	}
+	c.write(s)
+}
+
+func (c *converter) start(t token) {
+	if c.inPre() {
+		switch t.name {
+		case "code":
+			if c.top().lang == "" {
+				c.top().lang = language(t.attrs["class"])
+			}
+		case "br":
+			c.write("\n")
+		}
+		return
+	}
+	switch name := t.name; {
+	case skippedElements[name]:
+		c.skipped++
+	case len(name) == 2 && name[0] == 'h' && '1' <= name[1] && name[1] <= '6':
+		if c.flat() {
+			c.space()
+		} else {
+			c.block()
+			c.write(strings.Repeat("#", int(name[1]-'0')) + " ")
+		}
+	case blockElements[name]:
+		c.paragraph()
+	case name == "br":
+		if c.flat() {
+			c.space()
+		} else {
+			c.newline()
+		}
+	case name == "hr":
+		c.block()
+		c.write("---")
+		c.block()
+	case name == "ul" || name == "ol":
+		c.listBoundary()
+		next := 1
+		if n, err := strconv.Atoi(t.attrs["start"]); err == nil {
+			next = n
+		}
+		c.lists = append(c.lists, list{ordered: name == "ol", next: next})
+	case name == "li":
+		c.newline()
+		marker := "- "
+		if depth := len(c.lists); depth > 0 {
+			c.write(strings.Repeat("    ", depth-1))
+			if l := &c.lists[depth-1]; l.ordered {
+				marker = fmt.Sprintf("%d. ", l.next)
+				l.next++
+			}
+		}
+		c.write(marker)
+	case name == "pre":
+		c.block()
+		c.frames = append(c.frames, &frame{tag: "pre", lang: language(t.attrs["class"])})
+	case name == "blockquote":
+		c.block()
+		c.frames = append(c.frames, &frame{tag: "blockquote"})
+	case name == "code" || name == "kbd" || name == "samp" || name == "tt":
+		c.write("`")
+	case name == "strong" || name == "b":
+		c.write("**")
+	case name == "em" || name == "i":
+		c.write("_")
+	case name == "a":
+		href := t.attrs["href"]
+		if href == "" || strings.HasPrefix(href, "#") || strings.HasPrefix(strings.ToLower(href), "javascript:") {
+			href = ""
+		} else {
+			c.write("[")
+		}
+		c.links = append(c.links, href)
+	case name == "img":
+		if src := t.attrs["src"]; src != "" {
+			c.write("![" + t.attrs["alt"] + "](" + src + ")")
+		}
+	case name == "table":
+		c.block()
+		c.rows = 0
+	case name == "tr":
+		c.newline()
+		c.write("|")
+		c.cells = 0
+	case name == "td" || name == "th":
+		c.space()
+		c.inCell = true
+	}
+}
+
+func (c *converter) end(name string) {
+	if c.inPre() && name != "pre" {
+		return
+	}
+	switch {
+	case skippedElements[name]:
+		// Unbalanced; skipped elements that were opened end in Convert.
+	case len(name) == 2 && name[0] == 'h' && '1' <= name[1] && name[1] <= '6':
+		if c.flat() {
+			c.space()
+		} else {
+			c.block()
+		}
+	case blockElements[name]:
+		c.paragraph()
+	case name == "ul" || name == "ol":
+		if len(c.lists) > 0 {
+			c.lists = c.lists[:len(c.lists)-1]
+		}
+		c.listBoundary()
+	case name == "pre" || name == "blockquote":
+		if c.top().tag != name {
+			return
+		}
+		f := c.top()
+		c.frames = c.frames[:len(c.frames)-1]
+		c.block()
+		if name == "pre" {
+			c.write("~~~" + f.lang + "\n" + strings.Trim(string(f.buf), "\n") + "\n~~~")
+		} else {
+			c.write(quote(strings.TrimSpace(string(f.buf))))
+		}
+		c.block()
+	case name == "code" || name == "kbd" || name == "samp" || name == "tt":
+		c.write("`")
+	case name == "strong" || name == "b":
+		c.write("**")
+	case name == "em" || name == "i":
+		c.write("_")
+	case name == "a":
+		if len(c.links) == 0 {
+			return
+		}
+		href := c.links[len(c.links)-1]
+		c.links = c.links[:len(c.links)-1]
+		if href != "" {
+			c.write("](" + href + ")")
+		}
+	case name == "td" || name == "th":
+		c.top().buf = []byte(strings.TrimRight(string(c.top().buf), " "))
+		c.write(" |")
+		c.inCell = false
+		c.cells++
+	case name == "tr":
+		// Markdown tables need a separator after the first row.
+		if c.rows == 0 && c.cells > 0 {
+			c.newline()
+			c.write("|" + strings.Repeat(" --- |", c.cells))
+		}
+		c.rows++
+	case name == "table":
+		c.block()
+		c.inCell = false
+	}
+}
+
+// paragraph starts or ends a paragraph, or in a list item or table cell,
+// where paragraphs can't break the line, separates words.
+func (c *converter) paragraph() {
+	if c.flat() {
+		c.space()
+	} else {
+		c.block()
+	}
+}
+
+// listBoundary separates a list from what precedes or follows it: with a
+// blank line at the top level, and with a line break when nested.
+func (c *converter) listBoundary() {
+	if len(c.lists) > 0 {
+		c.newline()
+	} else {
+		c.block()
+	}
+}
+
+// language returns the language named by a class attribute in the usual
+// way, as language-go or lang-go, or "" if there is none.
+func language(class string) string {
+	for _, name := range strings.Fields(class) {
+		for _, prefix := range []string{"language-", "lang-"} {
+			if lang, ok := strings.CutPrefix(name, prefix); ok {
+				return lang
+			}
+		}
+	}
+	return ""
+}
+
+// collapseSpace replaces each run of white space in s with a single space.
+func collapseSpace(s string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range s {
+		if unicode.IsSpace(r) {
+			space = true
+			continue
+		}
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		b.WriteRune(r)
+	}
+	if space {
+		b.WriteByte(' ')
+	}
+	return b.String()
+}
+
+// quote prefixes each line of text with "> ", or ">" if it is blank.
+func quote(text string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if line == "" {
+			lines[i] = ">"
+		} else {
+			lines[i] = "> " + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
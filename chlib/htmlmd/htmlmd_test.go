@@ -0,0 +1,60 @@
+package htmlmd
+
+import (
+	"testing"
+)
+
+func TestConvert(t *testing.T) {
+	testCases := []struct {
+		name     string
+		html     string
+		expected string
+	}{
+		{
+			"document",
+			"<!DOCTYPE html>\n<html><head><title>Guide</title><style>p { color: red }</style>" +
+				"<script>if (a < b && c) {}</script></head>\n<body>\n<h1>Install</h1>\n" +
+				"<p>Run   the <b>installer</b>,\nthen <a href=\"https://example.com/next\">continue</a>.</p>\n" +
+				"<!-- a comment --><p>Caf&eacute; &amp; more&nbsp;text</p></body></html>",
+			"# Install\n\nRun the **installer**, then [continue](https://example.com/next).\n\nCafé & more text\n",
+		},
+		{
+			"lists",
+			"<ul><li>one<li>two<ol start=3><li>three</li><li><p>four</p></li></ol></li></ul><p>after</p>",
+			"- one\n- two\n    3. three\n    4. four\n\nafter\n",
+		},
+		{
+			"code",
+			"<p>Call <code>run()</code>:</p><pre><code class=\"language-go\">func run() {\n\tif a < b {\n\t}\n}\n</code></pre>",
+			"Call `run()`:\n\n~~~go\nfunc run() {\n\tif a < b {\n\t}\n}\n~~~\n",
+		},
+		{
+			"blockquote and rule",
+			"<blockquote><p>First.</p><p>Second.</p></blockquote><hr><p>Done<br>now</p>",
+			"> First.\n>\n> Second.\n\n---\n\nDone\nnow\n",
+		},
+		{
+			"table",
+			"<table><tr><th>Name</th><th>Value</th></tr><tr><td>a|b</td><td> <em>1</em> </td></tr></table>",
+			"| Name | Value |\n| --- | --- |\n| a\\|b | _1_ |\n",
+		},
+		{
+			"images and local links",
+			"<p><img src=\"logo.png\" alt=\"Logo\"> <a href=\"#top\">Top</a> <a href='javascript:void(0)'>x</a></p>",
+			"![Logo](logo.png) Top x\n",
+		},
+		{
+			"loose markup",
+			"<div>a < b</span> and <P CLASS=x>unclosed <pre>code",
+			"a < b and\n\nunclosed\n\n~~~\ncode\n~~~\n",
+		},
+		{"empty", "<html><body> </body></html>", ""},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if actual := Convert(tc.html); actual != tc.expected {
+				t.Errorf("Expected %q\n  Actual %q", tc.expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package htmlmd
+
+import (
+	"html"
+	"strings"
+)
+
+// tokenKind is the kind of a token: text, a start tag, or an end tag.
+type tokenKind int
+
+const (
+	textToken tokenKind = iota
+	startToken
+	endToken
+)
+
+// token is a piece of an HTML document. The tag names of start and end
+// tokens are lowercase, and text has its character references decoded.
+type token struct {
+	kind  tokenKind
+	name  string
+	attrs map[string]string
+	text  string
+}
+
+// rawTextElements hold text that is not markup, up to their end tag.
+var rawTextElements = map[string]bool{"script": true, "style": true, "textarea": true, "title": true}
+
+// tokenize splits an HTML document into tokens. It is lenient, as browsers
+// are: a "<" that starts no tag is text, and comments, doctypes, and
+// processing instructions are dropped.
+func tokenize(doc string) []token {
+	var tokens []token
+	addText := func(text string) {
+		if text != "" {
+			tokens = append(tokens, token{kind: textToken, text: html.UnescapeString(text)})
+		}
+	}
+	for doc != "" {
+		lt := strings.IndexByte(doc, '<')
+		if lt < 0 {
+			addText(doc)
+			break
+		}
+		addText(doc[:lt])
+		doc = doc[lt:]
+
+		switch {
+		case strings.HasPrefix(doc, "<!--"):
+			doc = skipPast(doc[4:], "-->")
+		case strings.HasPrefix(doc, "<!") || strings.HasPrefix(doc, "<?"):
+			doc = skipPast(doc[2:], ">")
+		case strings.HasPrefix(doc, "</") && len(doc) > 2 && isLetter(doc[2]):
+			name, rest := tagName(doc[2:])
+			tokens = append(tokens, token{kind: endToken, name: name})
+			doc = skipPast(rest, ">")
+		case len(doc) > 1 && isLetter(doc[1]):
+			var t token
+			t, doc = startTag(doc[1:])
+			tokens = append(tokens, t)
+			if rawTextElements[t.name] {
+				end := strings.Index(strings.ToLower(doc), "</"+t.name)
+				if end < 0 {
+					end = len(doc)
+				}
+				addText(doc[:end])
+				doc = doc[end:]
+			}
+		default:
+			addText("<")
+			doc = doc[1:]
+		}
+	}
+	return tokens
+}
+
+// startTag parses a start tag, given the text after its "<", and returns
+// the text after its ">".
+func startTag(s string) (token, string) {
+	t := token{kind: startToken, attrs: map[string]string{}}
+	t.name, s = tagName(s)
+	for {
+		s = strings.TrimLeft(s, " \t\r\n\f/")
+		if s == "" {
+			return t, s
+		}
+		if s[0] == '>' {
+			return t, s[1:]
+		}
+		end := strings.IndexAny(s, " \t\r\n\f/>=")
+		if end == 0 {
+			// A stray "=" names nothing.
+			s = s[1:]
+			continue
+		}
+		if end < 0 {
+			end = len(s)
+		}
+		name := strings.ToLower(s[:end])
+		s = strings.TrimLeft(s[end:], " \t\r\n\f")
+		var value string
+		if strings.HasPrefix(s, "=") {
+			value, s = attrValue(strings.TrimLeft(s[1:], " \t\r\n\f"))
+		}
+		t.attrs[name] = html.UnescapeString(value)
+	}
+}
+
+// attrValue parses an attribute value, quoted or not, returning it and the
+// text after it.
+func attrValue(s string) (string, string) {
+	if s != "" && (s[0] == '"' || s[0] == '\'') {
+		if end := strings.IndexByte(s[1:], s[0]); end >= 0 {
+			return s[1 : end+1], s[end+2:]
+		}
+		return s[1:], ""
+	}
+	end := strings.IndexAny(s, " \t\r\n\f>")
+	if end < 0 {
+		return s, ""
+	}
+	return s[:end], s[end:]
+}
+
+// tagName returns the lowercase tag name at the start of s and the text
+// after it.
+func tagName(s string) (string, string) {
+	end := strings.IndexAny(s, " \t\r\n\f/>")
+	if end < 0 {
+		end = len(s)
+	}
+	return strings.ToLower(s[:end]), s[end:]
+}
+
+// skipPast returns the text after the first occurrence of delim in s, or ""
+// if there is none.
+func skipPast(s, delim string) string {
+	if i := strings.Index(s, delim); i >= 0 {
+		return s[i+len(delim):]
+	}
+	return ""
+}
+
+func isLetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
@@ -0,0 +1,195 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+// Package keyring stores credentials, such as API keys, in the operating
+// system's keyring: the login keychain on macOS, and the Secret Service
+// (GNOME Keyring or KWallet) through secret-tool on Linux and the BSDs.
+// Each credential is stored under the service "ch" and an account named
+// for what it unlocks, such as slack.
+package keyring
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+// service is the keyring service that ch's credentials are stored under.
+const service = "ch"
+
+// ErrNotFound is returned by Get for a credential that isn't stored.
+var ErrNotFound = errors.New("credential not found")
+
+// namePattern matches valid credential names.
+var namePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]*$`)
+
+// tool is the program that manages a platform's keyring: the command lines
+// that store (reading the secret from stdin), look up, and remove a
+// credential, and the exit status that means it isn't stored.
+type tool struct {
+	set      func(name, secret string) (args []string, stdin string)
+	get      func(name string) []string
+	remove   func(name string) []string
+	notFound int
+}
+
+// toolFor returns the keyring tool on goos, given the installed programs.
+func toolFor(goos string, lookPath func(string) (string, error)) (tool, error) {
+	switch goos {
+	case "darwin":
+		return tool{
+			// security -i reads its commands from stdin, which keeps the
+			// secret out of the process list.
+			set: func(name, secret string) ([]string, string) {
+				return []string{"security", "-i"}, fmt.Sprintf("add-generic-password -U -s %s -a %s -w %s\n", service, name, securityQuote(secret))
+			},
+			get: func(name string) []string {
+				return []string{"security", "find-generic-password", "-s", service, "-a", name, "-w"}
+			},
+			remove: func(name string) []string {
+				return []string{"security", "delete-generic-password", "-s", service, "-a", name}
+			},
+			notFound: 44,
+		}, nil
+	case "linux", "freebsd", "openbsd", "netbsd":
+		if _, err := lookPath("secret-tool"); err != nil {
+			return tool{}, fmt.Errorf("the keyring needs secret-tool (libsecret-tools), which isn't installed")
+		}
+		return tool{
+			set: func(name, secret string) ([]string, string) {
+				return []string{"secret-tool", "store", "--label=" + service + ": " + name, "service", service, "account", name}, secret
+			},
+			get: func(name string) []string {
+				return []string{"secret-tool", "lookup", "service", service, "account", name}
+			},
+			remove: func(name string) []string {
+				return []string{"secret-tool", "clear", "service", service, "account", name}
+			},
+			notFound: 1,
+		}, nil
+	default:
+		return tool{}, fmt.Errorf("the keyring isn't supported on %s", goos)
+	}
+}
+
+// securityQuote quotes s as a word for security -i.
+func securityQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// ValidateName returns an error if name can't name a credential.
+func ValidateName(name string) error {
+	if !namePattern.MatchString(name) {
+		return fmt.Errorf("invalid credential name %q: use lowercase letters, digits, '.', '_', and '-'", name)
+	}
+	return nil
+}
+
+// Set stores secret as the credential name, replacing any stored before.
+func Set(name, secret string) error {
+	t, err := platformTool(name)
+	if err != nil {
+		return err
+	}
+	args, stdin := t.set(name, secret)
+	_, err = run(args, stdin)
+	return err
+}
+
+// Get returns the credential name, or ErrNotFound if it isn't stored.
+func Get(name string) (string, error) {
+	t, err := platformTool(name)
+	if err != nil {
+		return "", err
+	}
+	output, err := run(t.get(name), "")
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == t.notFound || err == nil && output == "" {
+		return "", ErrNotFound
+	}
+	return strings.TrimRight(output, "\r\n"), err
+}
+
+// Remove deletes the credential name, returning ErrNotFound if it isn't
+// stored.
+func Remove(name string) error {
+	t, err := platformTool(name)
+	if err != nil {
+		return err
+	}
+	_, err = run(t.remove(name), "")
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == t.notFound {
+		return ErrNotFound
+	}
+	return err
+}
+
+// Lookup returns the credential name from the keyring or, if it isn't
+// stored there, from the environment variable envVar, which suits CI
+// machines without a keyring. It returns "" and an error saying how to
+// store the credential if neither has it.
+func Lookup(name, envVar string) (string, error) {
+	secret, err := Get(name)
+	if err == nil {
+		return secret, nil
+	}
+	if !errors.Is(err, ErrNotFound) {
+		slog.Debug("keyring lookup failed", "name", name, "error", err)
+	}
+	if secret := os.Getenv(envVar); secret != "" {
+		return secret, nil
+	}
+	return "", fmt.Errorf("no %s credential: store one with \"ch auth set %s\", or set $%s", name, name, envVar)
+}
+
+// EnvVar returns the environment variable that conventionally holds the
+// credential name, such as GITHUB_TOKEN for github.
+func EnvVar(name string) string {
+	return strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(name)) + "_TOKEN"
+}
+
+func platformTool(name string) (tool, error) {
+	if err := ValidateName(name); err != nil {
+		return tool{}, err
+	}
+	return toolFor(runtime.GOOS, exec.LookPath)
+}
+
+// run runs a keyring tool, returning its standard output. A failure's
+// error includes what the tool wrote to standard error.
+func run(args []string, stdin string) (string, error) {
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = strings.NewReader(stdin)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return "", fmt.Errorf("%s: %w: %s", args[0], err, message)
+		}
+		return "", fmt.Errorf("%s: %w", args[0], err)
+	}
+	return string(output), nil
+}
@@ -0,0 +1,77 @@
+package keyring
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// fakeSecretTool puts a secret-tool on PATH that keeps each credential in a
+// file named for its account.
+func fakeSecretTool(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the fake secret-tool is a Linux shell script")
+	}
+	binDir := t.TempDir()
+	store := t.TempDir()
+	script := `#!/bin/sh
+store='` + store + `'
+case "$1" in
+store) cat > "$store/$6" ;;
+lookup) cat "$store/$5" 2>/dev/null || exit 1 ;;
+clear) rm "$store/$5" 2>/dev/null || exit 1 ;;
+esac
+`
+	if err := os.WriteFile(filepath.Join(binDir, "secret-tool"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestSetGetRemove(t *testing.T) {
+	fakeSecretTool(t)
+	if _, err := Get("slack"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound before Set\n  Actual %v", err)
+	}
+	if err := Set("slack", "xoxb-123"); err != nil {
+		t.Fatal(err)
+	}
+	if secret, err := Get("slack"); err != nil || secret != "xoxb-123" {
+		t.Errorf("Expected xoxb-123\n  Actual %q, %v", secret, err)
+	}
+	if err := Remove("slack"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Remove("slack"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound removing twice\n  Actual %v", err)
+	}
+	if err := Set("Slack Token", "x"); err == nil {
+		t.Error("Expected an error for an invalid name")
+	}
+}
+
+func TestLookup(t *testing.T) {
+	fakeSecretTool(t)
+	t.Setenv("SLACK_TOKEN", "")
+	if _, err := Lookup("slack", "SLACK_TOKEN"); err == nil {
+		t.Error("Expected an error with no credential")
+	}
+	t.Setenv("SLACK_TOKEN", "from-env")
+	if secret, _ := Lookup("slack", "SLACK_TOKEN"); secret != "from-env" {
+		t.Errorf("Expected from-env\n  Actual %q", secret)
+	}
+	if err := Set("slack", "from-keyring"); err != nil {
+		t.Fatal(err)
+	}
+	if secret, _ := Lookup("slack", "SLACK_TOKEN"); secret != "from-keyring" {
+		t.Errorf("Expected the keyring to take precedence\n  Actual %q", secret)
+	}
+
+	// Without secret-tool, only the environment is consulted.
+	t.Setenv("PATH", t.TempDir())
+	if secret, _ := Lookup("slack", "SLACK_TOKEN"); secret != "from-env" {
+		t.Errorf("Expected from-env without a keyring\n  Actual %q", secret)
+	}
+}
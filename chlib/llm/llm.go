@@ -0,0 +1,213 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+// Package llm sends conversations to language models through their
+// providers' HTTP APIs. Each configured Model names the provider whose API
+// it is reached through: ProviderAnthropic for Anthropic's Messages API, or
+// ProviderOpenAI for the OpenAI chat completions API and the servers that
+// implement it, such as Ollama, vLLM, and llama.cpp. Send tries a chain of
+// models in turn, falling back to the next when one fails or is rate
+// limited.
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// The providers that models can be reached through.
+const (
+	ProviderAnthropic = "anthropic"
+	ProviderOpenAI    = "openai"
+)
+
+// DefaultMaxTokens is the default limit on the length of a reply, in
+// tokens.
+const DefaultMaxTokens = 4096
+
+// defaultBytesPerToken is the tokenizer estimate of a model that doesn't
+// set one, as render.ApproxTokens estimates.
+const defaultBytesPerToken = 4
+
+// Message is a turn of a conversation: what a role ("system", "user", or
+// "assistant") said.
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// Model is a language model as configured: the provider and endpoint it
+// is reached at, how to authenticate, and what its tokens cost.
+type Model struct {
+	// Name is the name the model is configured under.
+	Name     string
+	Provider string
+	// Endpoint is the URL requests are posted to; "" means the provider's
+	// public API.
+	Endpoint string
+	// ID is the model's ID in the provider's API, such as gpt-4o.
+	ID string
+	// Credential returns the API key, or "" if the model needs none. It is
+	// called only when the model is tried, so that a fallback's missing
+	// key doesn't fail a request its primary answers.
+	Credential func() (string, error)
+	// MaxTokens limits the length of a reply; 0 means DefaultMaxTokens.
+	MaxTokens int
+	// BytesPerToken is the model's tokenizer, approximately: how many
+	// bytes of text a token averages. 0 means 4.
+	BytesPerToken float64
+	// ContextWindow is how many tokens a request may hold; 0 means no
+	// limit is checked.
+	ContextWindow int
+	// InputPrice and OutputPrice are what a million tokens of request and
+	// of reply cost, in dollars.
+	InputPrice, OutputPrice float64
+}
+
+// EstimateTokens estimates how many tokens the model's tokenizer makes of
+// text.
+func (m Model) EstimateTokens(text string) int {
+	perToken := m.BytesPerToken
+	if perToken <= 0 {
+		perToken = defaultBytesPerToken
+	}
+	return int(float64(len(text))/perToken + 0.5)
+}
+
+// Cost returns the price, in dollars, of a request and reply of the given
+// sizes.
+func (m Model) Cost(inputTokens, outputTokens int) float64 {
+	return (float64(inputTokens)*m.InputPrice + float64(outputTokens)*m.OutputPrice) / 1e6
+}
+
+func (m Model) maxTokens() int {
+	if m.MaxTokens > 0 {
+		return m.MaxTokens
+	}
+	return DefaultMaxTokens
+}
+
+// Response is a model's reply.
+type Response struct {
+	// Model is the name of the model that replied, which is a fallback if
+	// those before it failed.
+	Model string
+	Text  string
+	// InputTokens and OutputTokens are the sizes of the request and reply
+	// as the provider counted them.
+	InputTokens, OutputTokens int
+	// StopReason says why the reply ended, in the provider's words, such
+	// as "end_turn" or "max_tokens".
+	StopReason string
+}
+
+// Provider sends conversations to the models of an API.
+type Provider interface {
+	Send(ctx context.Context, client *http.Client, m Model, messages []Message) (Response, error)
+}
+
+var providers = map[string]Provider{
+	ProviderAnthropic: anthropic{},
+	ProviderOpenAI:    openAI{},
+}
+
+// Providers returns the names of the providers, in lexical order.
+func Providers() []string {
+	var names []string
+	for name := range providers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// APIError is an error reported by a provider's API.
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("%d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// RateLimited reports whether the API refused the request for now because
+// of rate limits or load.
+func (e *APIError) RateLimited() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode == 529
+}
+
+// ErrTooLarge is returned for a request that doesn't fit in a model's
+// context window.
+var ErrTooLarge = errors.New("request too large for the context window")
+
+// Send sends messages to the first model of chain, and to each of the
+// others in turn if that fails: if its request is too large for it, its
+// credential is missing, its API can't be reached, or it reports an error
+// such as a rate limit. The error, if all fail, says why each did.
+func Send(ctx context.Context, client *http.Client, chain []Model, messages []Message) (Response, error) {
+	if len(chain) == 0 {
+		return Response{}, errors.New("no model to send to")
+	}
+	var failures []string
+	for i, m := range chain {
+		response, err := send(ctx, client, m, messages)
+		if err == nil {
+			response.Model = m.Name
+			return response, nil
+		}
+		if ctx.Err() != nil {
+			return Response{}, ctx.Err()
+		}
+		failures = append(failures, fmt.Sprintf("%s: %v", m.Name, err))
+		if i+1 < len(chain) {
+			slog.Warn("model failed; falling back", "model", m.Name, "fallback", chain[i+1].Name, "error", err)
+		}
+	}
+	if len(failures) == 1 {
+		return Response{}, errors.New(failures[0])
+	}
+	return Response{}, fmt.Errorf("every model failed: %s", strings.Join(failures, "; "))
+}
+
+// send sends messages to a single model.
+func send(ctx context.Context, client *http.Client, m Model, messages []Message) (Response, error) {
+	provider, ok := providers[m.Provider]
+	if !ok {
+		return Response{}, fmt.Errorf("unknown provider %q", m.Provider)
+	}
+	if m.ContextWindow > 0 {
+		tokens := 0
+		for _, message := range messages {
+			tokens += m.EstimateTokens(message.Content)
+		}
+		if tokens+m.maxTokens() > m.ContextWindow {
+			return Response{}, fmt.Errorf("%w: about %d tokens, with %d for the reply, of %d", ErrTooLarge, tokens, m.maxTokens(), m.ContextWindow)
+		}
+	}
+	return provider.Send(ctx, client, m, messages)
+}
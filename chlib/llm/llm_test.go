@@ -0,0 +1,120 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSendAnthropic(t *testing.T) {
+	var request map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("x-api-key") != "secret" || r.Header.Get("anthropic-version") != anthropicVersion {
+			t.Errorf("Expected the API key and version headers, got: %v", r.Header)
+		}
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &request)
+		io.WriteString(w, `{"content": [{"type": "text", "text": "Looks fine."}], "stop_reason": "end_turn", "usage": {"input_tokens": 12, "output_tokens": 3}}`)
+	}))
+	defer server.Close()
+
+	m := Model{Name: "claude", Provider: ProviderAnthropic, Endpoint: server.URL, ID: "claude-3-5-sonnet-latest",
+		Credential: func() (string, error) { return "secret", nil }}
+	response, err := Send(context.Background(), server.Client(), []Model{m}, []Message{
+		{Role: "system", Content: "Be brief."},
+		{Role: "user", Content: "Review this."},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := Response{Model: "claude", Text: "Looks fine.", InputTokens: 12, OutputTokens: 3, StopReason: "end_turn"}
+	if response != expected {
+		t.Errorf("Expected response: %+v\n  Actual response: %+v", expected, response)
+	}
+	if request["system"] != "Be brief." || request["model"] != "claude-3-5-sonnet-latest" || request["max_tokens"] != float64(DefaultMaxTokens) {
+		t.Errorf("Unexpected request: %v", request)
+	}
+	if turns, _ := request["messages"].([]any); len(turns) != 1 {
+		t.Errorf("Expected only the user turn in messages, got: %v", request["messages"])
+	}
+}
+
+func TestSendOpenAI(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth := r.Header.Get("Authorization"); auth != "" {
+			t.Errorf("Expected no Authorization header without a credential, got: %q", auth)
+		}
+		io.WriteString(w, `{"choices": [{"message": {"content": "Hi."}, "finish_reason": "stop"}], "usage": {"prompt_tokens": 5, "completion_tokens": 2}}`)
+	}))
+	defer server.Close()
+
+	m := Model{Name: "local", Provider: ProviderOpenAI, Endpoint: server.URL, ID: "llama3.1"}
+	response, err := Send(context.Background(), server.Client(), []Model{m}, []Message{{Role: "user", Content: "Hello."}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := Response{Model: "local", Text: "Hi.", InputTokens: 5, OutputTokens: 2, StopReason: "stop"}
+	if response != expected {
+		t.Errorf("Expected response: %+v\n  Actual response: %+v", expected, response)
+	}
+}
+
+func TestSendFallback(t *testing.T) {
+	limited := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		io.WriteString(w, `{"error": {"type": "rate_limit_error", "message": "slow down"}}`)
+	}))
+	defer limited.Close()
+	working := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"choices": [{"message": {"content": "Fallback reply."}}]}`)
+	}))
+	defer working.Close()
+
+	primary := Model{Name: "claude", Provider: ProviderAnthropic, Endpoint: limited.URL, ID: "claude"}
+	noKey := Model{Name: "gpt", Provider: ProviderOpenAI, ID: "gpt-4o",
+		Credential: func() (string, error) { return "", errors.New("no openai credential") }}
+	small := Model{Name: "tiny", Provider: ProviderOpenAI, Endpoint: working.URL, ID: "tiny", ContextWindow: 4200}
+	local := Model{Name: "local", Provider: ProviderOpenAI, Endpoint: working.URL, ID: "llama3.1"}
+	messages := []Message{{Role: "user", Content: strings.Repeat("x", 1000)}}
+
+	response, err := Send(context.Background(), http.DefaultClient, []Model{primary, noKey, small, local}, messages)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if response.Model != "local" || response.Text != "Fallback reply." {
+		t.Errorf("Expected the reply from local, got: %+v", response)
+	}
+
+	_, err = Send(context.Background(), http.DefaultClient, []Model{primary, noKey}, messages)
+	if err == nil {
+		t.Fatalf("Expected an error")
+	}
+	for _, expected := range []string{"every model failed", "claude: 429 Too Many Requests: slow down", "gpt: no openai credential"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected error containing %q, got: %v", expected, err)
+		}
+	}
+}
+
+func TestAPIErrorRateLimited(t *testing.T) {
+	for status, expected := range map[int]bool{429: true, 529: true, 500: false, 401: false} {
+		if actual := (&APIError{StatusCode: status}).RateLimited(); actual != expected {
+			t.Errorf("Expected RateLimited() = %v for %d, got %v", expected, status, actual)
+		}
+	}
+}
+
+func TestModelEstimates(t *testing.T) {
+	m := Model{BytesPerToken: 3.5, InputPrice: 3, OutputPrice: 15}
+	if tokens := m.EstimateTokens(strings.Repeat("x", 700)); tokens != 200 {
+		t.Errorf("Expected 200 tokens, got %d", tokens)
+	}
+	if cost := m.Cost(1_000_000, 100_000); cost != 4.5 {
+		t.Errorf("Expected a cost of 4.5, got %v", cost)
+	}
+}
@@ -0,0 +1,177 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// maxResponseSize bounds the body of an API's response.
+const maxResponseSize = 16 << 20
+
+// anthropic is Anthropic's Messages API.
+type anthropic struct{}
+
+// anthropicVersion is the version of the Messages API that requests are
+// made to.
+const anthropicVersion = "2023-06-01"
+
+func (anthropic) Send(ctx context.Context, client *http.Client, m Model, messages []Message) (Response, error) {
+	// System messages go in a field of their own.
+	var system []string
+	var turns []Message
+	for _, message := range messages {
+		if message.Role == "system" {
+			system = append(system, message.Content)
+		} else {
+			turns = append(turns, message)
+		}
+	}
+	request := map[string]any{"model": m.ID, "max_tokens": m.maxTokens(), "messages": turns}
+	if len(system) > 0 {
+		request["system"] = strings.Join(system, "\n\n")
+	}
+	var response struct {
+		Content []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"content"`
+		StopReason string `json:"stop_reason"`
+		Usage      struct {
+			InputTokens  int `json:"input_tokens"`
+			OutputTokens int `json:"output_tokens"`
+		} `json:"usage"`
+	}
+	err := post(ctx, client, m, "https://api.anthropic.com/v1/messages", request, func(req *http.Request, key string) {
+		req.Header.Set("anthropic-version", anthropicVersion)
+		if key != "" {
+			req.Header.Set("x-api-key", key)
+		}
+	}, &response)
+	if err != nil {
+		return Response{}, err
+	}
+	var text strings.Builder
+	for _, block := range response.Content {
+		if block.Type == "text" {
+			text.WriteString(block.Text)
+		}
+	}
+	return Response{
+		Text:         text.String(),
+		InputTokens:  response.Usage.InputTokens,
+		OutputTokens: response.Usage.OutputTokens,
+		StopReason:   response.StopReason,
+	}, nil
+}
+
+// openAI is the OpenAI chat completions API, which many other servers
+// implement too.
+type openAI struct{}
+
+func (openAI) Send(ctx context.Context, client *http.Client, m Model, messages []Message) (Response, error) {
+	request := map[string]any{"model": m.ID, "max_tokens": m.maxTokens(), "messages": messages}
+	var response struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+			FinishReason string `json:"finish_reason"`
+		} `json:"choices"`
+		Usage struct {
+			PromptTokens     int `json:"prompt_tokens"`
+			CompletionTokens int `json:"completion_tokens"`
+		} `json:"usage"`
+	}
+	err := post(ctx, client, m, "https://api.openai.com/v1/chat/completions", request, func(req *http.Request, key string) {
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+	}, &response)
+	if err != nil {
+		return Response{}, err
+	}
+	if len(response.Choices) == 0 {
+		return Response{}, fmt.Errorf("the reply has no choices")
+	}
+	return Response{
+		Text:         response.Choices[0].Message.Content,
+		InputTokens:  response.Usage.PromptTokens,
+		OutputTokens: response.Usage.CompletionTokens,
+		StopReason:   response.Choices[0].FinishReason,
+	}, nil
+}
+
+// post posts request as JSON to the model's endpoint, or else to
+// defaultEndpoint, with the headers that authorize sets given the model's
+// credential, and decodes the response into response. An error response
+// becomes an *APIError with the message the API gave.
+func post(ctx context.Context, client *http.Client, m Model, defaultEndpoint string, request any, authorize func(req *http.Request, key string), response any) error {
+	key := ""
+	if m.Credential != nil {
+		var err error
+		if key, err = m.Credential(); err != nil {
+			return err
+		}
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	endpoint := m.Endpoint
+	if endpoint == "" {
+		endpoint = defaultEndpoint
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("invalid endpoint: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	authorize(req, key)
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	content, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		// Both APIs report errors as {"error": {"message": ...}}.
+		var failure struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		json.Unmarshal(content, &failure)
+		return &APIError{StatusCode: resp.StatusCode, Message: failure.Error.Message}
+	}
+	if err := json.Unmarshal(content, response); err != nil {
+		return fmt.Errorf("invalid response: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+// Package mdhtml renders the markdown that ch produces as HTML, so that
+// rich-text editors such as Google Docs, Notion, and mail clients show its
+// code blocks as code when it is pasted into them. It understands what the
+// output is made of (fenced code blocks, headings, paragraphs, inline code,
+// and the <details> lines of -details) rather than all of CommonMark.
+package mdhtml
+
+import (
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Styles are inline, since editors drop style sheets from pasted HTML.
+const (
+	preStyle  = "background:#f6f8fa;padding:8px 12px;border-radius:4px;font-family:Menlo,Consolas,'Courier New',monospace;font-size:90%;white-space:pre-wrap"
+	codeStyle = "background:#f6f8fa;padding:1px 4px;border-radius:3px;font-family:Menlo,Consolas,'Courier New',monospace;font-size:90%"
+)
+
+var (
+	fencePattern   = regexp.MustCompile("^(```+|~~~+)\\s*([^`\\s]*)")
+	headingPattern = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*$`)
+	codePattern    = regexp.MustCompile("`+")
+)
+
+// Render returns an HTML fragment for markdown.
+func Render(markdown string) string {
+	var out strings.Builder
+	var paragraph []string
+	flush := func() {
+		if len(paragraph) > 0 {
+			out.WriteString("<p>" + strings.Join(paragraph, "<br>\n") + "</p>\n")
+			paragraph = nil
+		}
+	}
+	lines := strings.Split(strings.TrimSuffix(markdown, "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if m := fencePattern.FindStringSubmatch(line); m != nil {
+			flush()
+			var code []string
+			for i++; i < len(lines) && !closesFence(lines[i], m[1]); i++ {
+				code = append(code, lines[i])
+			}
+			out.WriteString(`<pre style="` + preStyle + `"><code`)
+			if m[2] != "" {
+				out.WriteString(` class="language-` + html.EscapeString(m[2]) + `"`)
+			}
+			out.WriteString(">" + html.EscapeString(strings.Join(code, "\n")) + "</code></pre>\n")
+			continue
+		}
+		switch trimmed := strings.TrimSpace(line); {
+		case trimmed == "":
+			flush()
+		case strings.HasPrefix(trimmed, "<details") || strings.HasPrefix(trimmed, "</details"):
+			// -details writes these itself, with their text escaped.
+			flush()
+			out.WriteString(trimmed + "\n")
+		case headingPattern.MatchString(line):
+			flush()
+			m := headingPattern.FindStringSubmatch(line)
+			level := strconv.Itoa(len(m[1]))
+			out.WriteString("<h" + level + ">" + inline(m[2]) + "</h" + level + ">\n")
+		default:
+			paragraph = append(paragraph, inline(line))
+		}
+	}
+	flush()
+	return out.String()
+}
+
+// closesFence reports whether line closes a code block opened by fence: it
+// is a run of the same character, at least as long, and nothing else.
+func closesFence(line, fence string) bool {
+	trimmed := strings.TrimSpace(line)
+	return len(trimmed) >= len(fence) && strings.Trim(trimmed, fence[:1]) == ""
+}
+
+// inline renders a line of text, escaping it and turning code spans into
+// <code>.
+func inline(text string) string {
+	var out strings.Builder
+	for {
+		loc := codePattern.FindStringIndex(text)
+		if loc == nil {
+			break
+		}
+		ticks := text[loc[0]:loc[1]]
+		end := strings.Index(text[loc[1]:], ticks)
+		if end < 0 {
+			break
+		}
+		code := strings.TrimSpace(text[loc[1] : loc[1]+end])
+		out.WriteString(html.EscapeString(text[:loc[0]]))
+		out.WriteString(`<code style="` + codeStyle + `">` + html.EscapeString(code) + "</code>")
+		text = text[loc[1]+end+len(ticks):]
+	}
+	out.WriteString(html.EscapeString(text))
+	return out.String()
+}
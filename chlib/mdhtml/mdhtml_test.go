@@ -0,0 +1,61 @@
+package mdhtml
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name     string
+		markdown string
+		expected string
+	}{
+		{
+			name:     "Paragraphs",
+			markdown: "Please review.\nThanks & regards\n\n<b>not markup</b>\n",
+			expected: "<p>Please review.<br>\nThanks &amp; regards</p>\n<p>&lt;b&gt;not markup&lt;/b&gt;</p>\n",
+		},
+		{
+			name:     "Attached file",
+			markdown: "`main.go`\n```go\nif a < b {\n}\n```\n",
+			expected: `<p><code style="` + codeStyle + `">main.go</code></p>` + "\n" +
+				`<pre style="` + preStyle + `"><code class="language-go">if a &lt; b {` + "\n}</code></pre>\n",
+		},
+		{
+			name:     "Longer fence",
+			markdown: "````markdown\n```go\nx\n```\n````\nAfter\n",
+			expected: `<pre style="` + preStyle + `"><code class="language-markdown">` + "```go\nx\n```</code></pre>\n<p>After</p>\n",
+		},
+		{
+			name:     "Heading",
+			markdown: "## Files `a`\n",
+			expected: `<h2>Files <code style="` + codeStyle + `">a</code></h2>` + "\n",
+		},
+		{
+			name:     "Details",
+			markdown: "<details><summary><code>big.log</code></summary>\n\n```\nlog\n```\n\n</details>\n",
+			expected: "<details><summary><code>big.log</code></summary>\n" + `<pre style="` + preStyle + `"><code>log</code></pre>` + "\n</details>\n",
+		},
+		{
+			name:     "Unclosed code span",
+			markdown: "a ` b\n",
+			expected: "<p>a ` b</p>\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual := Render(tt.markdown)
+			if actual != tt.expected {
+				t.Errorf("Expected %q\n  Actual %q", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestRenderUnclosedFence(t *testing.T) {
+	actual := Render("```\ncode to the end")
+	if !strings.Contains(actual, "<code>code to the end</code></pre>") {
+		t.Errorf("Expected the rest to be code\n  Actual %q", actual)
+	}
+}
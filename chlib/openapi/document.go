@@ -0,0 +1,135 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package openapi
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// object is a mapping of a document, with its keys in the order they
+// appear, so that a summary lists endpoints and schemas in the document's
+// order.
+type object struct {
+	keys   []string
+	values map[string]any
+}
+
+// get returns the value of key, or nil if o is nil or hasn't key.
+func (o *object) get(key string) any {
+	if o == nil {
+		return nil
+	}
+	return o.values[key]
+}
+
+func (o *object) set(key string, value any) {
+	if o.values == nil {
+		o.values = map[string]any{}
+	}
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = value
+}
+
+// parseDocument parses a YAML or JSON document. Mappings are returned as
+// *object, sequences as []any, and scalars as string, bool, int, float64,
+// or nil. Aliases are resolved, and merge keys (<<) applied.
+func parseDocument(data []byte) (any, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+	return nodeValue(doc.Content[0], 0)
+}
+
+// maxDepth bounds the nesting of a document, so that aliases that refer
+// to themselves can't recurse forever.
+const maxDepth = 1000
+
+func nodeValue(n *yaml.Node, depth int) (any, error) {
+	if depth > maxDepth {
+		return nil, fmt.Errorf("line %d: document nested too deeply", n.Line)
+	}
+	switch n.Kind {
+	case yaml.AliasNode:
+		return nodeValue(n.Alias, depth+1)
+	case yaml.SequenceNode:
+		list := []any{}
+		for _, item := range n.Content {
+			value, err := nodeValue(item, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		return list, nil
+	case yaml.MappingNode:
+		o := &object{}
+		var merged []*object
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, value := n.Content[i], n.Content[i+1]
+			v, err := nodeValue(value, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			if key.Kind == yaml.ScalarNode && key.Tag == "!!merge" {
+				switch v := v.(type) {
+				case *object:
+					merged = append(merged, v)
+				case []any:
+					for _, item := range v {
+						if m, ok := item.(*object); ok {
+							merged = append(merged, m)
+						}
+					}
+				}
+				continue
+			}
+			o.set(key.Value, v)
+		}
+		// Keys given in the mapping itself override merged ones, and
+		// earlier merged mappings override later ones.
+		for _, m := range merged {
+			for _, key := range m.keys {
+				if _, ok := o.values[key]; !ok {
+					o.set(key, m.values[key])
+				}
+			}
+		}
+		return o, nil
+	case yaml.ScalarNode:
+		switch n.ShortTag() {
+		case "!!str", "!!timestamp", "!!binary":
+			return n.Value, nil
+		}
+		var value any
+		if err := n.Decode(&value); err != nil {
+			return nil, err
+		}
+		return value, nil
+	}
+	return nil, fmt.Errorf("line %d: unexpected YAML node", n.Line)
+}
@@ -0,0 +1,73 @@
+package openapi
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// dump renders a parsed value compactly, with mappings in key order and
+// strings quoted, for comparison.
+func dump(value any) string {
+	switch value := value.(type) {
+	case *object:
+		var entries []string
+		for _, key := range value.keys {
+			entries = append(entries, fmt.Sprintf("%s: %s", key, dump(value.values[key])))
+		}
+		return "{" + strings.Join(entries, ", ") + "}"
+	case []any:
+		var items []string
+		for _, item := range value {
+			items = append(items, dump(item))
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case string:
+		return fmt.Sprintf("%q", value)
+	default:
+		return fmt.Sprintf("%v", value)
+	}
+}
+
+func TestParseDocument(t *testing.T) {
+	testCases := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "Scalars in key order",
+			input:    "b: 1\na: two # comment\nc: true\nd: ~\ne: 1.5\nf: 2024-10-16\n200: OK\n",
+			expected: `{b: 1, a: "two", c: true, d: <nil>, e: 1.5, f: "2024-10-16", 200: "OK"}`,
+		},
+		{
+			name: "Anchors and merge keys",
+			input: `base: &base
+  type: object
+  nullable: true
+pet:
+  <<: *base
+  nullable: false
+tags: &tags [a, b]
+more: *tags
+`,
+			expected: `{base: {type: "object", nullable: true}, pet: {nullable: false, type: "object"}, tags: ["a", "b"], more: ["a", "b"]}`,
+		},
+		{
+			name:     "JSON",
+			input:    `{"openapi": "3.1.0", "paths": {"/b": {}, "/a": {}}}`,
+			expected: `{openapi: "3.1.0", paths: {/b: {}, /a: {}}}`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			value, err := parseDocument([]byte(tc.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if actual := dump(value); actual != tc.expected {
+				t.Errorf("Expected %s\n  Actual %s", tc.expected, actual)
+			}
+		})
+	}
+}
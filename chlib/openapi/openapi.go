@@ -0,0 +1,483 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+// Package openapi condenses an OpenAPI (or Swagger 2.0) document into a
+// compact summary of its endpoints, their parameters, request bodies, and
+// responses, and the schemas they use, small enough to give a language
+// model in place of a spec that may run to tens of thousands of lines.
+package openapi
+
+import (
+	"cmp"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// methods are the operations a path item may have, in the order they are
+// listed.
+var methods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+// maxEnum is how many enum values a summary lists before eliding the rest.
+const maxEnum = 8
+
+// Summarize returns a summary of the OpenAPI document spec, in YAML or
+// JSON. If paths are given, only the endpoints whose paths match one of
+// them, globs in which * matches any run of characters including /, are
+// summarized, along with just the schemas they use.
+func Summarize(spec []byte, paths []string) (string, error) {
+	parsed, err := parseDocument(spec)
+	if err != nil {
+		return "", fmt.Errorf("invalid OpenAPI document: %v", err)
+	}
+	doc, ok := parsed.(*object)
+	if !ok || doc.get("paths") == nil && doc.get("openapi") == nil && doc.get("swagger") == nil {
+		return "", fmt.Errorf("not an OpenAPI document: it has no openapi, swagger, or paths key")
+	}
+	var patterns []*regexp.Regexp
+	for _, glob := range paths {
+		patterns = append(patterns, globPattern(glob))
+	}
+
+	s := &summarizer{doc: doc, used: map[string]bool{}}
+	s.header()
+	s.endpoints(patterns)
+	s.schemas(len(patterns) > 0)
+	return strings.TrimRight(s.b.String(), "\n") + "\n", nil
+}
+
+// globPattern returns a regexp matching the paths that glob does.
+func globPattern(glob string) *regexp.Regexp {
+	parts := strings.Split(glob, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	return regexp.MustCompile("^" + strings.Join(parts, ".*") + "$")
+}
+
+type summarizer struct {
+	doc *object
+	b   strings.Builder
+	// used records the schemas that the summary refers to by name.
+	used map[string]bool
+}
+
+func (s *summarizer) printf(format string, args ...any) {
+	fmt.Fprintf(&s.b, format, args...)
+}
+
+// header writes the API's title, version, description, servers, and
+// security schemes.
+func (s *summarizer) header() {
+	info, _ := s.doc.get("info").(*object)
+	title := cmp.Or(str(info.get("title")), "Untitled API")
+	if version := str(info.get("version")); version != "" {
+		title += " " + version
+	}
+	if version := cmp.Or(str(s.doc.get("openapi")), str(s.doc.get("swagger"))); version != "" {
+		format := "OpenAPI"
+		if s.doc.get("swagger") != nil {
+			format = "Swagger"
+		}
+		title += fmt.Sprintf(" (%s %s)", format, version)
+	}
+	s.printf("%s\n", title)
+	if description := firstSentence(str(info.get("description")), 200); description != "" {
+		s.printf("%s\n", description)
+	}
+
+	var servers []string
+	for _, server := range list(s.doc.get("servers")) {
+		if server, ok := server.(*object); ok {
+			servers = append(servers, str(server.get("url")))
+		}
+	}
+	if host := str(s.doc.get("host")); host != "" {
+		scheme := "https"
+		if schemes := list(s.doc.get("schemes")); len(schemes) > 0 {
+			scheme = str(schemes[0])
+		}
+		servers = append(servers, scheme+"://"+host+str(s.doc.get("basePath")))
+	}
+	if len(servers) > 0 {
+		s.printf("Servers: %s\n", strings.Join(servers, ", "))
+	}
+
+	components, _ := s.doc.get("components").(*object)
+	schemes, _ := components.get("securitySchemes").(*object)
+	if schemes == nil {
+		schemes, _ = s.doc.get("securityDefinitions").(*object)
+	}
+	var auth []string
+	for _, name := range keys(schemes) {
+		scheme, _ := s.resolve(schemes.get(name)).(*object)
+		auth = append(auth, name+" ("+securityScheme(scheme)+")")
+	}
+	if len(auth) > 0 {
+		s.printf("Auth: %s\n", strings.Join(auth, ", "))
+	}
+}
+
+// securityScheme describes a security scheme, e.g. "http bearer" or
+// "apiKey in header X-API-Key".
+func securityScheme(scheme *object) string {
+	kind := str(scheme.get("type"))
+	switch kind {
+	case "http":
+		return strings.TrimSpace("http " + str(scheme.get("scheme")))
+	case "apiKey":
+		return fmt.Sprintf("apiKey in %s %s", str(scheme.get("in")), str(scheme.get("name")))
+	case "oauth2":
+		if flow := str(scheme.get("flow")); flow != "" {
+			return "oauth2 " + flow
+		}
+		return strings.TrimSpace("oauth2 " + strings.Join(keys(asMap(scheme.get("flows"))), ", "))
+	}
+	return kind
+}
+
+// endpoints writes each operation of the paths that match patterns (all
+// of them if there are none).
+func (s *summarizer) endpoints(patterns []*regexp.Regexp) {
+	paths, _ := s.doc.get("paths").(*object)
+	s.printf("\nEndpoints:\n")
+	count := 0
+	for _, path := range keys(paths) {
+		if len(patterns) > 0 && !slices.ContainsFunc(patterns, func(p *regexp.Regexp) bool { return p.MatchString(path) }) {
+			continue
+		}
+		item, _ := s.resolve(paths.get(path)).(*object)
+		for _, method := range keys(item) {
+			if !slices.Contains(methods, method) {
+				continue
+			}
+			op, ok := item.get(method).(*object)
+			if !ok {
+				continue
+			}
+			s.operation(strings.ToUpper(method), path, op, list(item.get("parameters")))
+			count++
+		}
+	}
+	if count == 0 {
+		s.printf("(none)\n")
+	}
+}
+
+// operation writes one endpoint: its method, path, and summary, then its
+// parameters by location, its request body, and its responses.
+func (s *summarizer) operation(method, path string, op *object, shared []any) {
+	line := method + " " + path
+	if summary := cmp.Or(firstSentence(str(op.get("summary")), 100), firstSentence(str(op.get("description")), 100)); summary != "" {
+		line += " — " + summary
+	}
+	if op.get("deprecated") == true {
+		line += " (deprecated)"
+	}
+	s.printf("%s\n", line)
+
+	// Operation parameters override the path item's of the same name and
+	// location.
+	var params []*object
+	seen := map[string]bool{}
+	for _, p := range append(list(op.get("parameters")), shared...) {
+		param, ok := s.resolve(p).(*object)
+		if !ok {
+			continue
+		}
+		id := str(param.get("in")) + " " + str(param.get("name"))
+		if !seen[id] {
+			seen[id] = true
+			params = append(params, param)
+		}
+	}
+	for _, in := range []string{"path", "query", "header", "cookie", "formData"} {
+		var described []string
+		for _, param := range params {
+			if str(param.get("in")) != in {
+				continue
+			}
+			name := str(param.get("name"))
+			if param.get("required") == true {
+				name += "*"
+			}
+			schema := param.get("schema")
+			if schema == nil {
+				schema = param // Swagger 2.0 puts the type on the parameter.
+			}
+			described = append(described, name+" "+s.typeOf(schema, 0))
+		}
+		if len(described) > 0 {
+			s.printf("  %s: %s\n", in, strings.Join(described, ", "))
+		}
+	}
+
+	if body, ok := s.resolve(op.get("requestBody")).(*object); ok {
+		s.content("body", body.get("required") == true, asMap(body.get("content")))
+	}
+	for _, param := range params {
+		if str(param.get("in")) == "body" {
+			label := "  body"
+			if param.get("required") == true {
+				label += "*"
+			}
+			s.printf("%s: %s\n", label, s.typeOf(param.get("schema"), 0))
+		}
+	}
+
+	responses, _ := op.get("responses").(*object)
+	for _, code := range keys(responses) {
+		response, _ := s.resolve(responses.get(code)).(*object)
+		if schema := response.get("schema"); schema != nil {
+			s.printf("  %s: %s\n", code, s.typeOf(schema, 0))
+			continue
+		}
+		if content := asMap(response.get("content")); content != nil && len(content.keys) > 0 {
+			s.content(code, false, content)
+			continue
+		}
+		s.printf("  %s\n", code)
+	}
+}
+
+// content writes a request or response body given as media types, such as
+// "body* (application/json): NewPet". Media types with the same schema
+// are listed together.
+func (s *summarizer) content(label string, required bool, content *object) {
+	if required {
+		label += "*"
+	}
+	var order []string
+	types := map[string][]string{}
+	for _, mediaType := range keys(content) {
+		media, _ := content.get(mediaType).(*object)
+		schema := "(any)"
+		if media.get("schema") != nil {
+			schema = s.typeOf(media.get("schema"), 0)
+		}
+		if _, ok := types[schema]; !ok {
+			order = append(order, schema)
+		}
+		types[schema] = append(types[schema], mediaType)
+	}
+	for _, schema := range order {
+		s.printf("  %s (%s): %s\n", label, strings.Join(types[schema], ", "), schema)
+	}
+}
+
+// schemas writes each schema the document defines, or, if onlyUsed, just
+// those the summary refers to, directly or through other schemas.
+func (s *summarizer) schemas(onlyUsed bool) {
+	definitions := asMap(asMap(s.doc.get("components")).get("schemas"))
+	if definitions == nil {
+		definitions = asMap(s.doc.get("definitions"))
+	}
+	if definitions == nil || len(definitions.keys) == 0 {
+		return
+	}
+	// Describing a schema can refer to more, so describe them all first,
+	// until no new ones turn up.
+	described := map[string]string{}
+	for {
+		added := false
+		for _, name := range definitions.keys {
+			if _, ok := described[name]; !ok && (!onlyUsed || s.used[name]) {
+				described[name] = s.typeOf(definitions.get(name), 1)
+				added = true
+			}
+		}
+		if !added {
+			break
+		}
+	}
+	if len(described) == 0 {
+		return
+	}
+	s.printf("\nSchemas:\n")
+	for _, name := range definitions.keys {
+		if description, ok := described[name]; ok {
+			s.printf("%s: %s\n", name, description)
+		}
+	}
+}
+
+// typeOf describes a schema briefly: a referenced schema by name, an array
+// as []T, a map as map[string]T, an enum by its values, and an object by
+// its properties, with * marking required ones, down to depth 2.
+func (s *summarizer) typeOf(value any, depth int) string {
+	schema, ok := value.(*object)
+	if !ok {
+		return "any"
+	}
+	if ref := str(schema.get("$ref")); ref != "" {
+		name := ref[strings.LastIndex(ref, "/")+1:]
+		if strings.Contains(ref, "/schemas/") || strings.Contains(ref, "/definitions/") {
+			s.used[name] = true
+		}
+		return name
+	}
+	for _, combiner := range []string{"allOf", "oneOf", "anyOf"} {
+		if parts := list(schema.get(combiner)); len(parts) > 0 {
+			var described []string
+			for _, part := range parts {
+				described = append(described, s.typeOf(part, depth))
+			}
+			separator := " | "
+			if combiner == "allOf" {
+				separator = " & "
+			}
+			return nullable(schema, strings.Join(described, separator))
+		}
+	}
+	if enum := list(schema.get("enum")); len(enum) > 0 {
+		var values []string
+		for _, v := range enum[:min(len(enum), maxEnum)] {
+			if v, ok := v.(string); ok {
+				values = append(values, fmt.Sprintf("%q", v))
+			} else {
+				values = append(values, fmt.Sprint(v))
+			}
+		}
+		if len(enum) > maxEnum {
+			values = append(values, fmt.Sprintf("… (%d more)", len(enum)-maxEnum))
+		}
+		return nullable(schema, strings.Join(values, "|"))
+	}
+
+	kind := str(schema.get("type"))
+	if kinds := list(schema.get("type")); len(kinds) > 0 {
+		var names []string
+		for _, k := range kinds {
+			names = append(names, str(k))
+		}
+		kind = strings.Join(names, "|")
+	}
+	properties := asMap(schema.get("properties"))
+	switch {
+	case kind == "array":
+		return nullable(schema, "[]"+s.typeOf(schema.get("items"), depth))
+	case properties != nil && len(properties.keys) > 0:
+		if depth > 2 {
+			return nullable(schema, "object")
+		}
+		required := map[string]bool{}
+		for _, name := range list(schema.get("required")) {
+			required[str(name)] = true
+		}
+		var fields []string
+		for _, name := range properties.keys {
+			field := name
+			if required[name] {
+				field += "*"
+			}
+			fields = append(fields, field+": "+s.typeOf(properties.get(name), depth+1))
+		}
+		return nullable(schema, "{"+strings.Join(fields, ", ")+"}")
+	case schema.get("additionalProperties") != nil && schema.get("additionalProperties") != false:
+		return nullable(schema, "map[string]"+s.typeOf(schema.get("additionalProperties"), depth))
+	case kind == "":
+		kind = "any"
+		if schema.get("properties") != nil || schema.get("additionalProperties") == false {
+			kind = "object"
+		}
+	}
+	if format := str(schema.get("format")); format != "" {
+		kind += "(" + format + ")"
+	}
+	return nullable(schema, kind)
+}
+
+// nullable marks a description as allowing null if schema says so.
+func nullable(schema *object, description string) string {
+	if schema.get("nullable") == true {
+		return description + "|null"
+	}
+	return description
+}
+
+// resolve follows a $ref within the document, returning value itself if
+// it isn't a reference, or nil if the reference can't be followed.
+func (s *summarizer) resolve(value any) any {
+	for range 10 {
+		m, ok := value.(*object)
+		ref := str(m.get("$ref"))
+		if !ok || ref == "" {
+			return value
+		}
+		pointer, ok := strings.CutPrefix(ref, "#/")
+		if !ok {
+			return nil // References to other documents aren't followed.
+		}
+		value = any(s.doc)
+		for _, token := range strings.Split(pointer, "/") {
+			token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+			value = asMap(value).get(token)
+		}
+	}
+	return nil
+}
+
+// firstSentence returns the first sentence of text, or its first line if
+// that is shorter, cut to at most max bytes.
+func firstSentence(text string, max int) string {
+	text = strings.TrimSpace(text)
+	if i := strings.Index(text, "\n"); i >= 0 {
+		text = text[:i]
+	}
+	if i := strings.Index(text, ". "); i >= 0 {
+		text = text[:i+1]
+	}
+	if len(text) > max {
+		cut := strings.LastIndex(text[:max], " ")
+		if cut <= 0 {
+			cut = max
+		}
+		text = strings.TrimRight(text[:cut], " ,;:") + "…"
+	}
+	return text
+}
+
+func str(value any) string {
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+func list(value any) []any {
+	l, _ := value.([]any)
+	return l
+}
+
+func asMap(value any) *object {
+	m, _ := value.(*object)
+	return m
+}
+
+func keys(m *object) []string {
+	if m == nil {
+		return nil
+	}
+	return m.keys
+}
@@ -0,0 +1,215 @@
+package openapi
+
+import (
+	"strings"
+	"testing"
+)
+
+const petstore = `openapi: 3.0.3
+info:
+  title: Petstore
+  version: 1.0.0
+  description: |
+    A sample API. It has pets.
+servers:
+  - url: https://petstore.example.com/v1
+components:
+  securitySchemes:
+    bearer: {type: http, scheme: bearer}
+  parameters:
+    PetId:
+      name: id
+      in: path
+      required: true
+      schema: {type: string, format: uuid}
+  schemas:
+    Pet:
+      type: object
+      required: [id, name]
+      properties:
+        id: {type: string, format: uuid}
+        name: {type: string}
+        status: {type: string, enum: [available, sold], nullable: true}
+        owner: {$ref: '#/components/schemas/Owner'}
+    Owner:
+      type: object
+      properties:
+        tags: {type: array, items: {type: string}}
+        labels: {type: object, additionalProperties: {type: string}}
+    Error:
+      type: object
+      properties:
+        message: {type: string}
+paths:
+  /pets:
+    get:
+      summary: List pets. Paginated.
+      parameters:
+        - {name: limit, in: query, schema: {type: integer, format: int32}}
+      responses:
+        '200':
+          description: OK
+          content:
+            application/json:
+              schema: {type: array, items: {$ref: '#/components/schemas/Pet'}}
+        default:
+          description: error
+          content:
+            application/json:
+              schema: {$ref: '#/components/schemas/Error'}
+  /pets/{id}:
+    parameters:
+      - $ref: '#/components/parameters/PetId'
+    put:
+      summary: Replace a pet
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema: {$ref: '#/components/schemas/Pet'}
+          application/xml:
+            schema: {$ref: '#/components/schemas/Pet'}
+      responses:
+        '200': {description: OK}
+    delete:
+      deprecated: true
+      description: Deletes a pet
+      responses:
+        '204': {description: Gone}
+`
+
+func TestSummarize(t *testing.T) {
+	testCases := []struct {
+		name     string
+		spec     string
+		paths    []string
+		expected string
+	}{
+		{
+			name: "OpenAPI 3 in YAML",
+			spec: petstore,
+			expected: `Petstore 1.0.0 (OpenAPI 3.0.3)
+A sample API.
+Servers: https://petstore.example.com/v1
+Auth: bearer (http bearer)
+
+Endpoints:
+GET /pets — List pets.
+  query: limit integer(int32)
+  200 (application/json): []Pet
+  default (application/json): Error
+PUT /pets/{id} — Replace a pet
+  path: id* string(uuid)
+  body* (application/json, application/xml): Pet
+  200
+DELETE /pets/{id} — Deletes a pet (deprecated)
+  path: id* string(uuid)
+  204
+
+Schemas:
+Pet: {id*: string(uuid), name*: string, status: "available"|"sold"|null, owner: Owner}
+Owner: {tags: []string, labels: map[string]string}
+Error: {message: string}
+`,
+		},
+		{
+			name:  "Paths",
+			spec:  petstore,
+			paths: []string{"/pets/*"},
+			expected: `Petstore 1.0.0 (OpenAPI 3.0.3)
+A sample API.
+Servers: https://petstore.example.com/v1
+Auth: bearer (http bearer)
+
+Endpoints:
+PUT /pets/{id} — Replace a pet
+  path: id* string(uuid)
+  body* (application/json, application/xml): Pet
+  200
+DELETE /pets/{id} — Deletes a pet (deprecated)
+  path: id* string(uuid)
+  204
+
+Schemas:
+Pet: {id*: string(uuid), name*: string, status: "available"|"sold"|null, owner: Owner}
+Owner: {tags: []string, labels: map[string]string}
+`,
+		},
+		{
+			name: "Swagger 2 in JSON",
+			spec: `{
+  "swagger": "2.0",
+  "info": {"title": "Users", "version": "2"},
+  "host": "api.example.com",
+  "basePath": "/v2",
+  "securityDefinitions": {"key": {"type": "apiKey", "in": "header", "name": "X-Key"}},
+  "paths": {
+    "/users": {
+      "post": {
+        "operationId": "createUser",
+        "parameters": [
+          {"name": "body", "in": "body", "required": true, "schema": {"$ref": "#/definitions/User"}},
+          {"name": "dryRun", "in": "query", "type": "boolean"}
+        ],
+        "responses": {"201": {"description": "Created", "schema": {"$ref": "#/definitions/User"}}}
+      }
+    }
+  },
+  "definitions": {
+    "User": {"type": "object", "properties": {"id": {"type": "integer"}, "roles": {"type": "array", "items": {"type": "string", "enum": ["admin", "user"]}}}}
+  }
+}`,
+			expected: `Users 2 (Swagger 2.0)
+Servers: https://api.example.com/v2
+Auth: key (apiKey in header X-Key)
+
+Endpoints:
+POST /users
+  query: dryRun boolean
+  body*: User
+  201: User
+
+Schemas:
+User: {id: integer, roles: []"admin"|"user"}
+`,
+		},
+		{
+			name:  "No matching paths",
+			spec:  petstore,
+			paths: []string{"/owners*"},
+			expected: `Petstore 1.0.0 (OpenAPI 3.0.3)
+A sample API.
+Servers: https://petstore.example.com/v1
+Auth: bearer (http bearer)
+
+Endpoints:
+(none)
+`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := Summarize([]byte(tc.spec), tc.paths)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if actual != tc.expected {
+				t.Errorf("Expected:\n%s\n  Actual:\n%s", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestSummarizeErrors(t *testing.T) {
+	for _, spec := range []string{"name: not a spec\n", "- a list\n", "paths: [unclosed\n"} {
+		if _, err := Summarize([]byte(spec), nil); err == nil {
+			t.Errorf("Expected an error for %q", spec)
+		}
+	}
+}
+
+func TestFirstSentence(t *testing.T) {
+	if actual := firstSentence("Lists the pets in the store, one page at a time", 20); !strings.HasSuffix(actual, "…") || len(actual) > 20+len("…") {
+		t.Errorf("Expected a cut sentence\n  Actual %q", actual)
+	}
+}
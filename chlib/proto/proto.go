@@ -0,0 +1,313 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+// Package proto condenses Protocol Buffers files into a compact listing of
+// their services, RPCs, messages, and enums, reformatted consistently and
+// without syntax and import statements, for conversations about an API's
+// design.
+package proto
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Options control what a listing keeps.
+type Options struct {
+	// NoComments drops comments, which are kept by default.
+	NoComments bool
+	// NoOptions drops option statements and [field options].
+	NoOptions bool
+}
+
+// Summarize returns a listing of the declarations in a .proto file's
+// source.
+func Summarize(source string, opts Options) (string, error) {
+	tokens, err := tokenize(source)
+	if err != nil {
+		return "", err
+	}
+	l := &lister{opts: opts}
+	for _, t := range tokens {
+		if err := l.add(t); err != nil {
+			return "", err
+		}
+	}
+	if len(l.statement) > 0 {
+		return "", fmt.Errorf("line %d: unterminated statement %q", l.statement[0].line, join(l.statement))
+	}
+	if l.depth > 0 {
+		return "", fmt.Errorf("missing }")
+	}
+	return strings.Join(collapseEmpty(l.lines), "\n") + "\n", nil
+}
+
+// token is a word, string, punctuation mark, or comment, with the line it
+// starts on.
+type token struct {
+	text    string
+	line    int
+	comment bool
+}
+
+// tokenize splits source into tokens.
+func tokenize(source string) ([]token, error) {
+	var tokens []token
+	line := 1
+	for i := 0; i < len(source); {
+		c := source[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case strings.HasPrefix(source[i:], "//"):
+			end := strings.IndexByte(source[i:], '\n')
+			if end < 0 {
+				end = len(source) - i
+			}
+			tokens = append(tokens, token{source[i : i+end], line, true})
+			i += end
+		case strings.HasPrefix(source[i:], "/*"):
+			end := strings.Index(source[i+2:], "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: unterminated comment", line)
+			}
+			text := source[i : i+2+end+2]
+			tokens = append(tokens, token{text, line, true})
+			line += strings.Count(text, "\n")
+			i += len(text)
+		case c == '"' || c == '\'':
+			j := i + 1
+			for j < len(source) && source[j] != c && source[j] != '\n' {
+				if source[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(source) || source[j] != c {
+				return nil, fmt.Errorf("line %d: unterminated string", line)
+			}
+			tokens = append(tokens, token{source[i : j+1], line, false})
+			i = j + 1
+		case strings.IndexByte("{}()[]<>;,=:", c) >= 0:
+			tokens = append(tokens, token{string(c), line, false})
+			i++
+		default:
+			j := i
+			for j < len(source) && strings.IndexByte("{}()[]<>;,=: \t\r\n\"'/", source[j]) < 0 {
+				j++
+			}
+			if j == i {
+				return nil, fmt.Errorf("line %d: unexpected %q", line, c)
+			}
+			tokens = append(tokens, token{source[i:j], line, false})
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+// lister builds the listing from tokens, a statement at a time.
+type lister struct {
+	opts      Options
+	lines     []string
+	depth     int     // how many blocks are open
+	statement []token // the statement so far
+	nesting   int     // open ( [ < and, within option values, { in the statement
+	comments  []string
+	lastLine  int // the source line the last emitted line ended on
+}
+
+func (l *lister) add(t token) error {
+	if t.comment {
+		if l.opts.NoComments {
+			return nil
+		}
+		if len(l.statement) == 0 && t.line == l.lastLine && len(l.lines) > 0 {
+			l.lines[len(l.lines)-1] += "  " + oneLine(t.text)
+			return nil
+		}
+		l.comments = append(l.comments, commentLines(t.text)...)
+		return nil
+	}
+	inOption := len(l.statement) > 0 && l.statement[0].text == "option"
+	switch {
+	case t.text == "(" || t.text == "[" || t.text == "<" || t.text == "{" && (l.nesting > 0 || inOption):
+		l.nesting++
+	case l.nesting > 0 && (t.text == ")" || t.text == "]" || t.text == ">" || t.text == "}"):
+		l.nesting--
+	case t.text == ";" && l.nesting == 0:
+		l.end(t, ";")
+		return nil
+	case t.text == "{" && l.nesting == 0:
+		l.end(t, " {")
+		l.depth++
+		return nil
+	case t.text == "}":
+		if len(l.statement) > 0 {
+			return fmt.Errorf("line %d: unterminated statement %q", t.line, join(l.statement))
+		}
+		if l.depth == 0 {
+			return fmt.Errorf("line %d: unexpected }", t.line)
+		}
+		l.depth--
+		l.flushComments()
+		l.emit("}", t.line)
+		if l.depth == 0 {
+			l.lines = append(l.lines, "")
+		}
+		return nil
+	}
+	l.statement = append(l.statement, t)
+	return nil
+}
+
+// end ends the current statement with suffix, emitting it unless it is
+// one the listing leaves out.
+func (l *lister) end(t token, suffix string) {
+	statement := l.statement
+	l.statement = nil
+	if len(statement) == 0 {
+		return
+	}
+	keyword := statement[0].text
+	switch {
+	case l.depth == 0 && (keyword == "syntax" || keyword == "edition" || keyword == "import"),
+		keyword == "option" && l.opts.NoOptions:
+		l.comments = nil
+		l.lastLine = t.line
+		return
+	}
+	if l.opts.NoOptions {
+		statement = dropFieldOptions(statement)
+	}
+	if l.depth == 0 && suffix == " {" && len(l.lines) > 0 && l.lines[len(l.lines)-1] != "" {
+		l.lines = append(l.lines, "")
+	}
+	l.flushComments()
+	l.emit(join(statement)+suffix, t.line)
+	if keyword == "package" && l.depth == 0 {
+		l.lines = append(l.lines, "")
+	}
+}
+
+func (l *lister) flushComments() {
+	for _, comment := range l.comments {
+		l.emit(comment, 0)
+	}
+	l.comments = nil
+}
+
+func (l *lister) emit(text string, line int) {
+	l.lines = append(l.lines, strings.Repeat("  ", l.depth)+text)
+	l.lastLine = line
+}
+
+// dropFieldOptions removes [options] from a field or enum value.
+func dropFieldOptions(statement []token) []token {
+	var kept []token
+	depth := 0
+	for _, t := range statement {
+		switch {
+		case t.text == "[":
+			depth++
+		case t.text == "]" && depth > 0:
+			depth--
+		case depth == 0:
+			kept = append(kept, t)
+		}
+	}
+	return kept
+}
+
+// join writes tokens as source, spaced conventionally:
+// "map<string, Foo> labels = 1", "rpc Get(GetRequest) returns (Reply)".
+func join(tokens []token) string {
+	var b strings.Builder
+	for i, t := range tokens {
+		if i > 0 {
+			prev := tokens[i-1].text
+			switch {
+			case strings.Contains(",;:)]>", t.text):
+			case prev == "(" || prev == "[" || prev == "<":
+			case t.text == "(" && prev != "returns" && prev != "option" && prev != "=":
+			case t.text == "<" && prev == "map":
+			case strings.HasPrefix(t.text, ".") && prev == ")":
+			default:
+				b.WriteByte(' ')
+			}
+		}
+		b.WriteString(t.text)
+	}
+	return b.String()
+}
+
+// commentLines returns a comment as // lines.
+func commentLines(text string) []string {
+	if strings.HasPrefix(text, "//") {
+		return []string{strings.TrimRight(text, " \t")}
+	}
+	text = strings.TrimSuffix(strings.TrimPrefix(text, "/*"), "*/")
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "*"))
+		if line != "" {
+			lines = append(lines, "// "+line)
+		}
+	}
+	return lines
+}
+
+// oneLine returns a comment as a single // comment.
+func oneLine(text string) string {
+	lines := commentLines(text)
+	var parts []string
+	for _, line := range lines {
+		parts = append(parts, strings.TrimPrefix(line, "// "))
+	}
+	return "// " + strings.Join(parts, " ")
+}
+
+// collapseEmpty rewrites blocks left empty, such as an RPC whose options
+// were dropped, on one line, and removes doubled and trailing blank lines.
+func collapseEmpty(lines []string) []string {
+	var out []string
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "}" && len(out) > 0 && strings.HasSuffix(out[len(out)-1], " {") {
+			opening := strings.TrimSuffix(out[len(out)-1], " {")
+			if strings.HasPrefix(strings.TrimSpace(opening), "rpc ") {
+				out[len(out)-1] = opening + ";"
+			} else {
+				out[len(out)-1] = opening + " {}"
+			}
+			continue
+		}
+		if trimmed == "" && (len(out) == 0 || out[len(out)-1] == "") {
+			continue
+		}
+		out = append(out, line)
+	}
+	for len(out) > 0 && out[len(out)-1] == "" {
+		out = out[:len(out)-1]
+	}
+	return out
+}
@@ -0,0 +1,134 @@
+package proto
+
+import "testing"
+
+const orders = `syntax = "proto3";
+
+// Orders API.
+package shop.v1;
+
+import "google/api/annotations.proto";
+option go_package = "example.com/shop/v1;shopv1";
+
+/*
+ * OrderService manages orders.
+ */
+service OrderService {
+  // GetOrder returns one order.
+  rpc GetOrder(GetOrderRequest) returns (Order) {
+    option (google.api.http) = { get: "/v1/orders/{id}" };
+  }
+  rpc StreamOrders (StreamOrdersRequest) returns (stream Order);
+}
+message Order {
+  string id = 1; // the order's ID
+  repeated LineItem items = 2 [(validate.rules).repeated.min_items = 1];
+  map<string,string> labels = 3;
+  enum Status {
+    STATUS_UNSPECIFIED = 0;
+    PAID = 1 [deprecated = true];
+  }
+  oneof payment {
+    Card card = 5;
+    string voucher = 6;
+  }
+  reserved 7, 8;
+}
+message Empty {}
+`
+
+func TestSummarize(t *testing.T) {
+	testCases := []struct {
+		name     string
+		opts     Options
+		expected string
+	}{
+		{
+			name: "Everything",
+			expected: `// Orders API.
+package shop.v1;
+
+option go_package = "example.com/shop/v1;shopv1";
+
+// OrderService manages orders.
+service OrderService {
+  // GetOrder returns one order.
+  rpc GetOrder(GetOrderRequest) returns (Order) {
+    option (google.api.http) = { get: "/v1/orders/{id}" };
+  }
+  rpc StreamOrders(StreamOrdersRequest) returns (stream Order);
+}
+
+message Order {
+  string id = 1;  // the order's ID
+  repeated LineItem items = 2 [(validate.rules).repeated.min_items = 1];
+  map<string, string> labels = 3;
+  enum Status {
+    STATUS_UNSPECIFIED = 0;
+    PAID = 1 [deprecated = true];
+  }
+  oneof payment {
+    Card card = 5;
+    string voucher = 6;
+  }
+  reserved 7, 8;
+}
+
+message Empty {}
+`,
+		},
+		{
+			name: "No comments or options",
+			opts: Options{NoComments: true, NoOptions: true},
+			expected: `package shop.v1;
+
+service OrderService {
+  rpc GetOrder(GetOrderRequest) returns (Order);
+  rpc StreamOrders(StreamOrdersRequest) returns (stream Order);
+}
+
+message Order {
+  string id = 1;
+  repeated LineItem items = 2;
+  map<string, string> labels = 3;
+  enum Status {
+    STATUS_UNSPECIFIED = 0;
+    PAID = 1;
+  }
+  oneof payment {
+    Card card = 5;
+    string voucher = 6;
+  }
+  reserved 7, 8;
+}
+
+message Empty {}
+`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := Summarize(orders, tc.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if actual != tc.expected {
+				t.Errorf("Expected:\n%s\n  Actual:\n%s", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestSummarizeErrors(t *testing.T) {
+	for _, source := range []string{
+		"message A {\n  string a = 1;\n",
+		"message A {}\n}\n",
+		"message A { string a = 1 }\n",
+		"/* unterminated\n",
+		"option x = \"unterminated;\n",
+	} {
+		if _, err := Summarize(source, Options{}); err == nil {
+			t.Errorf("Expected an error for %q", source)
+		}
+	}
+}
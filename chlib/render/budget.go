@@ -0,0 +1,99 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package render
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+)
+
+// truncatedNote ends a chunk that EnforceBudget has truncated.
+const truncatedNote = "_(truncated to fit the size budget)_\n"
+
+// EnforceBudget trims chunks so that, joined, they fit within budget. It
+// first drops low-priority chunks, starting from the end, then truncates
+// normal-priority chunks, starting with the largest. High-priority chunks are
+// left intact; if they alone exceed the budget, EnforceBudget fails.
+func EnforceBudget(chunks []Chunk, budget Limit) ([]Chunk, error) {
+	total := func() int {
+		return budget.Measure(Join(chunks))
+	}
+	if total() <= budget.Amount {
+		return chunks, nil
+	}
+	chunks = append([]Chunk(nil), chunks...)
+
+	// Drop low-priority chunks, starting from the end. A note at the end
+	// says how many were dropped; it counts against the budget too.
+	dropped := 0
+	for i := len(chunks) - 1; i >= 0 && total() > budget.Amount; i-- {
+		if chunks[i].Priority != entry.PriorityLow {
+			continue
+		}
+		chunks = append(chunks[:i], chunks[i+1:]...)
+		dropped++
+		note := Chunk{Markdown: omittedNote(dropped), Priority: entry.PriorityHigh}
+		if dropped == 1 {
+			chunks = append(chunks, note)
+		} else {
+			chunks[len(chunks)-1] = note
+		}
+	}
+
+	// Truncate normal-priority chunks, largest first.
+	var normal []int
+	for i, chunk := range chunks {
+		if chunk.Priority == entry.PriorityNormal {
+			normal = append(normal, i)
+		}
+	}
+	sort.SliceStable(normal, func(a, b int) bool {
+		return len(chunks[normal[a]].Markdown) > len(chunks[normal[b]].Markdown)
+	})
+	for _, i := range normal {
+		excess := total() - budget.Amount
+		if excess <= 0 {
+			break
+		}
+		chunks[i].Markdown = truncateChunk(chunks[i].Markdown, budget.Measure(chunks[i].Markdown)-excess, budget)
+	}
+
+	if over := total() - budget.Amount; over > 0 {
+		return nil, fmt.Errorf("high-priority entries exceed the size budget of %v by %d", budget, over)
+	}
+	return chunks, nil
+}
+
+// omittedNote ends the output when EnforceBudget has dropped n entries.
+func omittedNote(n int) string {
+	return fmt.Sprintf("_(%s omitted to fit the size budget)_\n", pluralize(n, "low-priority entry", "low-priority entries"))
+}
+
+// truncateChunk shortens chunk to at most size (in the limit's unit),
+// cutting between lines and ending with a note that it was truncated.
+func truncateChunk(chunk string, size int, limit Limit) string {
+	room := size - limit.Measure(truncatedNote)
+	if room <= 0 {
+		return truncatedNote
+	}
+	return cutChunk(chunk, room, room, limit)[0] + truncatedNote
+}
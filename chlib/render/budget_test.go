@@ -0,0 +1,77 @@
+package render
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+)
+
+func TestEnforceBudget(t *testing.T) {
+	high := Chunk{Markdown: strings.Repeat("h", 30) + "\n", Priority: entry.PriorityHigh}
+	low1 := Chunk{Markdown: strings.Repeat("a", 100) + "\n", Priority: entry.PriorityLow}
+	low2 := Chunk{Markdown: strings.Repeat("b", 100) + "\n", Priority: entry.PriorityLow}
+	var lines strings.Builder
+	for i := 0; i < 10; i++ {
+		lines.WriteString("normal line\n")
+	}
+	normal := Chunk{Markdown: "`file.go`\n```go\n" + lines.String() + "```\n"}
+
+	t.Run("Within budget", func(t *testing.T) {
+		chunks := []Chunk{high, low1, normal}
+		actual, err := EnforceBudget(chunks, Limit{Amount: 1000})
+		if err != nil {
+			t.Fatalf("EnforceBudget failed: %v", err)
+		}
+		if !reflect.DeepEqual(actual, chunks) {
+			t.Errorf("Expected chunks to be unchanged, got %v", actual)
+		}
+	})
+
+	t.Run("Drops low priority from the end", func(t *testing.T) {
+		chunks := []Chunk{high, low1, low2, normal}
+		note := Chunk{Markdown: omittedNote(1)}
+		budget := Limit{Amount: len(Join([]Chunk{high, low1, normal, note}))}
+		actual, err := EnforceBudget(chunks, budget)
+		if err != nil {
+			t.Fatalf("EnforceBudget failed: %v", err)
+		}
+		markdown := Join(actual)
+		if !strings.Contains(markdown, low1.Markdown) || strings.Contains(markdown, low2.Markdown) {
+			t.Errorf("Expected only the last low-priority chunk to be dropped, got %q", markdown)
+		}
+		if !strings.Contains(markdown, "1 low-priority entry omitted") {
+			t.Errorf("Expected a note about the dropped entry, got %q", markdown)
+		}
+		if !strings.Contains(markdown, normal.Markdown) {
+			t.Errorf("Expected the normal chunk to be intact, got %q", markdown)
+		}
+	})
+
+	t.Run("Truncates normal priority", func(t *testing.T) {
+		chunks := []Chunk{high, low1, normal}
+		budget := Limit{Amount: 200}
+		actual, err := EnforceBudget(chunks, budget)
+		if err != nil {
+			t.Fatalf("EnforceBudget failed: %v", err)
+		}
+		markdown := Join(actual)
+		if budget.Measure(markdown) > budget.Amount {
+			t.Errorf("Output exceeds the budget: %d > %d", budget.Measure(markdown), budget.Amount)
+		}
+		if !strings.Contains(markdown, high.Markdown) || strings.Contains(markdown, low1.Markdown) {
+			t.Errorf("Expected high kept and low dropped, got %q", markdown)
+		}
+		if !strings.Contains(markdown, truncatedNote) || strings.Count(markdown, "```")%2 != 0 {
+			t.Errorf("Expected a well-formed truncated normal chunk, got %q", markdown)
+		}
+	})
+
+	t.Run("High priority over budget", func(t *testing.T) {
+		_, err := EnforceBudget([]Chunk{high, high}, Limit{Amount: 40})
+		if err == nil {
+			t.Error("Expected an error when high-priority entries exceed the budget")
+		}
+	})
+}
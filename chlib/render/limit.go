@@ -0,0 +1,100 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package render
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Limit is a limit on the size of generated markdown, measured either in
+// bytes or in estimated tokens.
+type Limit struct {
+	Amount int
+	Tokens bool
+}
+
+// ParseLimit parses sizes such as "30k-tokens", "100k-bytes", "2m-bytes",
+// or "5000". A number may carry a k (thousand) or m (million) suffix; a size
+// without a unit is measured in tokens.
+func ParseLimit(s string) (Limit, error) {
+	number, unit, _ := strings.Cut(strings.ToLower(strings.TrimSpace(s)), "-")
+	limit := Limit{Tokens: true}
+	switch unit {
+	case "", "tokens", "token":
+	case "bytes", "byte":
+		limit.Tokens = false
+	default:
+		return Limit{}, fmt.Errorf("unknown unit %q in size %q (expected tokens or bytes)", unit, s)
+	}
+
+	multiplier := 1
+	switch {
+	case strings.HasSuffix(number, "k"):
+		multiplier = 1000
+		number = strings.TrimSuffix(number, "k")
+	case strings.HasSuffix(number, "m"):
+		multiplier = 1000 * 1000
+		number = strings.TrimSuffix(number, "m")
+	}
+	n, err := strconv.Atoi(number)
+	if err != nil || n <= 0 {
+		return Limit{}, fmt.Errorf("invalid size %q", s)
+	}
+	limit.Amount = n * multiplier
+	return limit, nil
+}
+
+func (l Limit) String() string {
+	if l.Tokens {
+		return fmt.Sprintf("%d tokens", l.Amount)
+	}
+	return fmt.Sprintf("%d bytes", l.Amount)
+}
+
+// Measure returns the size of text in the limit's unit.
+func (l Limit) Measure(text string) int {
+	if l.Tokens {
+		return ApproxTokens(text)
+	}
+	return len(text)
+}
+
+// maxBytes returns the largest number of bytes whose measure is at most
+// amount.
+func (l Limit) maxBytes(amount int) int {
+	if l.Tokens {
+		return amount * 4
+	}
+	return amount
+}
+
+// ApproxTokens estimates how many tokens a language model would see in text.
+// Tokenizers differ, but roughly four bytes per token holds well enough for
+// English prose and source code to size a paste.
+func ApproxTokens(text string) int {
+	return ApproxTokensForSize(int64(len(text)))
+}
+
+// ApproxTokensForSize is ApproxTokens for text of size bytes.
+func ApproxTokensForSize(size int64) int {
+	return int((size + 3) / 4)
+}
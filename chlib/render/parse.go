@@ -0,0 +1,147 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package render
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+)
+
+var (
+	// fileHeaderPattern matches the line naming an attached file, with
+	// optional metadata: `path` or `path` (13 B, 1 line).
+	fileHeaderPattern = regexp.MustCompile("^`([^`]+)`(?: \\(.*\\))?$")
+	// duplicateHeaderPattern matches a rendered Duplicate.
+	duplicateHeaderPattern = regexp.MustCompile("^`([^`]+)` \\(duplicate; see above\\)$")
+	// detailsHeaderPattern matches the opening of a collapsed attachment.
+	detailsHeaderPattern = regexp.MustCompile("^<details><summary><code>(.*)</code>.*</summary>$")
+	// fencePathPattern extracts the path from a fence info string written
+	// in -fence-path mode.
+	fencePathPattern = regexp.MustCompile(`^` + "```" + `\S* path=("(?:[^"\\]|\\.)*"|\S+)`)
+)
+
+// Parse recovers entries from markdown previously generated by ch, in any of
+// its file rendering modes. Attached files become File entries whose
+// contents are stored in tempDir; "see above" stubs become Duplicate
+// entries; everything else becomes Message entries, one per run of text
+// between files, with the given source.
+func Parse(tempDir, markdown, source string) ([]entry.Entry, error) {
+	var entries []entry.Entry
+	var text []string
+	flushText := func() {
+		if message := strings.TrimSpace(strings.Join(text, "\n")); message != "" {
+			entries = append(entries, entry.Message{Text: message, Source: source})
+		}
+		text = nil
+	}
+	addFile := func(originalPath string, content string) error {
+		flushText()
+		file, err := entry.NewStoredFile(tempDir, originalPath, []byte(content))
+		if err != nil {
+			return fmt.Errorf("failed to store file content: %v", err)
+		}
+		entries = append(entries, file)
+		return nil
+	}
+
+	lines := strings.Split(markdown, "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+
+		if m := duplicateHeaderPattern.FindStringSubmatch(line); m != nil {
+			flushText()
+			entries = append(entries, entry.Duplicate{OriginalPath: m[1]})
+			continue
+		}
+
+		// Find the opening fence of an attached file, if this line starts one.
+		var originalPath string
+		fenceIndex := -1
+		if m := detailsHeaderPattern.FindStringSubmatch(line); m != nil && i+2 < len(lines) && lines[i+1] == "" && isFence(lines[i+2]) {
+			originalPath, fenceIndex = html.UnescapeString(m[1]), i+2
+		} else if m := fileHeaderPattern.FindStringSubmatch(line); m != nil && i+1 < len(lines) && isFence(lines[i+1]) {
+			originalPath, fenceIndex = m[1], i+1
+		} else if m := fencePathPattern.FindStringSubmatch(line); m != nil {
+			originalPath, fenceIndex = unquoteInfoValue(m[1]), i
+			// Drop the metadata line that -meta puts before the fence.
+			if len(text) > 0 && isMetadataLine(text[len(text)-1]) {
+				text = text[:len(text)-1]
+			}
+		}
+		if fenceIndex < 0 {
+			text = append(text, line)
+			continue
+		}
+
+		end := closingFence(lines, fenceIndex+1)
+		if end < 0 {
+			// Unterminated fence: not something ch generated. Keep it as text.
+			text = append(text, line)
+			continue
+		}
+		content := strings.Join(lines[fenceIndex+1:end], "\n")
+		if end > fenceIndex+1 {
+			content += "\n"
+		}
+		if err := addFile(originalPath, content); err != nil {
+			return nil, err
+		}
+		i = end
+		if strings.HasPrefix(line, "<details>") && i+2 < len(lines) && lines[i+1] == "" && lines[i+2] == "</details>" {
+			i += 2
+		}
+	}
+	flushText()
+	return entries, nil
+}
+
+func isFence(line string) bool {
+	return strings.HasPrefix(line, "```")
+}
+
+// closingFence returns the index of the first bare ``` line at or after
+// start, or -1 if there is none.
+func closingFence(lines []string, start int) int {
+	for j := start; j < len(lines); j++ {
+		if lines[j] == "```" {
+			return j
+		}
+	}
+	return -1
+}
+
+// isMetadataLine reports whether line is file metadata rendered in
+// -fence-path mode, such as "_13 B, 1 line_".
+func isMetadataLine(line string) bool {
+	return len(line) > 2 && strings.HasPrefix(line, "_") && strings.HasSuffix(line, "_") && strings.Contains(line, " B, ")
+}
+
+// unquoteInfoValue reverses the quoting of values in fence info strings.
+func unquoteInfoValue(value string) string {
+	if unquoted, err := strconv.Unquote(value); err == nil {
+		return unquoted
+	}
+	return value
+}
@@ -0,0 +1,85 @@
+package render
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+)
+
+// parsedSummary flattens entries into comparable strings, reading file
+// contents back from storage.
+func parsedSummary(t *testing.T, entries []entry.Entry) []string {
+	var summary []string
+	for _, e := range entries {
+		switch e := e.(type) {
+		case entry.Message:
+			summary = append(summary, "message: "+e.Text)
+		case entry.File:
+			content, err := os.ReadFile(e.StoragePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			summary = append(summary, "file "+e.OriginalPath+": "+string(content))
+		case entry.Duplicate:
+			summary = append(summary, "duplicate "+e.OriginalPath)
+		default:
+			t.Fatalf("unexpected entry %#v", e)
+		}
+	}
+	return summary
+}
+
+func TestParse(t *testing.T) {
+	dir, filePath, _ := setupTestFiles(t)
+
+	entries := []entry.Entry{
+		entry.Message{Text: "Look at this:"},
+		entry.File{StoragePath: filePath, OriginalPath: "dir/a b.txt"},
+		entry.Duplicate{OriginalPath: "dir/a b.txt"},
+		entry.Message{Text: "Thanks."},
+	}
+	expected := []string{
+		"message: Look at this:",
+		"file dir/a b.txt: File content\n",
+		"duplicate dir/a b.txt",
+		"message: Thanks.",
+	}
+
+	tests := []struct {
+		name string
+		opts entry.RenderOptions
+	}{
+		{"plain", entry.RenderOptions{}},
+		{"metadata", entry.RenderOptions{Metadata: true}},
+		{"details", entry.RenderOptions{Metadata: true, DetailsOver: 1}},
+		{"fence path", entry.RenderOptions{FencePath: true}},
+		{"fence path with metadata", entry.RenderOptions{FencePath: true, Metadata: true}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			markdown := Markdown(entries, test.opts)
+			parsed, err := Parse(dir, markdown, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if actual := parsedSummary(t, parsed); !reflect.DeepEqual(actual, expected) {
+				t.Errorf("Expected %q\n  Actual %q\nfrom markdown:\n%s", expected, actual, markdown)
+			}
+		})
+	}
+}
+
+func TestParseUnterminatedFence(t *testing.T) {
+	dir := t.TempDir()
+
+	parsed, err := Parse(dir, "`a.txt`\n```\nno end\n", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"message: `a.txt`\n```\nno end"}
+	if actual := parsedSummary(t, parsed); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected %q\n  Actual %q", expected, actual)
+	}
+}
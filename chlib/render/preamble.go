@@ -0,0 +1,179 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package render
+
+import (
+	"cmp"
+	"fmt"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+)
+
+// maxPreambleDirs bounds the directories a preamble lists by name.
+const maxPreambleDirs = 8
+
+// Preamble returns an introduction to entries for the model reading them:
+// what is attached (how many files and lines, in which languages and
+// directories, and what else) and how each kind of entry is delimited, as
+// rendered with opts.
+func Preamble(entries []entry.Entry, opts entry.RenderOptions) string {
+	var files []entry.File
+	var outputs, diffs, duplicates, failures int
+	for _, e := range entries {
+		switch e := entry.Unwrap(e).(type) {
+		case entry.File:
+			files = append(files, e)
+		case entry.Output:
+			outputs++
+		case entry.Diff:
+			diffs++
+		case entry.Duplicate:
+			duplicates++
+		case entry.Failure:
+			failures++
+		}
+	}
+
+	var lines int
+	languages := map[string]int{}
+	dirs := map[string]int{}
+	for _, file := range files {
+		if n, err := entry.CountFileLines(file.StoragePath); err == nil {
+			lines += n
+		}
+		lang := cmp.Or(file.Lang, entry.LanguageFor(file.OriginalPath, opts.Languages), "other")
+		languages[lang]++
+		dirs["`"+path.Dir(filepath.ToSlash(file.DisplayPath()))+"`"]++
+	}
+
+	var parts []string
+	if len(files) > 0 {
+		parts = append(parts, fmt.Sprintf("%s (%s)", pluralize(len(files), "file", "files"), entry.FormatLineCount(lines)))
+	}
+	if outputs > 0 {
+		parts = append(parts, pluralize(outputs, "command output", "command outputs"))
+	}
+	if diffs > 0 {
+		parts = append(parts, pluralize(diffs, "diff", "diffs"))
+	}
+	if duplicates > 0 {
+		parts = append(parts, pluralize(duplicates, "file repeated", "files repeated")+" from above")
+	}
+	if failures > 0 {
+		parts = append(parts, pluralize(failures, "failed command", "failed commands"))
+	}
+
+	var preamble strings.Builder
+	preamble.WriteString("**About this context**\n\n")
+	if len(parts) == 0 {
+		preamble.WriteString("What follows is messages only, with nothing attached.\n")
+		return preamble.String()
+	}
+	fmt.Fprintf(&preamble, "What follows includes %s.", joinList(parts))
+	if len(files) > 0 {
+		fmt.Fprintf(&preamble, " By language, the files are %s; by directory, ", countedNames(languages, 0, ""))
+		if len(dirs) > 1 {
+			preamble.WriteString(countedNames(dirs, maxPreambleDirs, "directories") + ".")
+		} else {
+			for dir := range dirs {
+				fmt.Fprintf(&preamble, "all are in %s.", dir)
+			}
+		}
+	}
+	preamble.WriteString("\n\n")
+	if len(files) > 0 {
+		preamble.WriteString("- " + describeFileFormat(opts) + "\n")
+	}
+	if outputs > 0 || diffs > 0 {
+		preamble.WriteString("- Command outputs and diffs are in fenced code blocks too; each diff is headed by the path it compares.\n")
+	}
+	if duplicates > 0 {
+		preamble.WriteString("- A file given more than once appears in full only the first time; later it is only named, marked \"duplicate; see above\".\n")
+	}
+	if failures > 0 {
+		preamble.WriteString("- A command that failed is quoted, marked **Failed:**, with its error in place of its output.\n")
+	}
+	preamble.WriteString("- Everything else is messages to you, written as plain text.\n")
+	return preamble.String()
+}
+
+// describeFileFormat says how an attached file is delimited, as rendered
+// with opts.
+func describeFileFormat(opts entry.RenderOptions) string {
+	var text strings.Builder
+	if opts.FencePath {
+		text.WriteString("Each file is a fenced code block holding its full content, whose opening fence gives its language and its path (path=).")
+		if opts.Metadata {
+			text.WriteString(" A line in italics before the block gives its size, line count, modification time, and git status.")
+		}
+	} else {
+		text.WriteString("Each file is its path, in backticks on a line of its own, followed by a fenced code block holding its full content, whose opening fence gives its language.")
+		if opts.Metadata {
+			text.WriteString(" The path is followed by the file's size, line count, modification time, and git status.")
+		}
+	}
+	if opts.FileIDs {
+		text.WriteString(" The opening fence also gives the file's ID (id=) and the start of its SHA-256 (sha256=).")
+	}
+	if opts.DetailsOver > 0 {
+		fmt.Fprintf(&text, " Files over %s are wrapped in <details>, with the path in the summary.", entry.FormatLineCount(opts.DetailsOver))
+	}
+	return text.String()
+}
+
+// countedNames lists names with their counts, most common first, such as
+// "go (3), markdown (2), and yaml (1)". Past limit names, if limit isn't
+// 0, the rest are counted as "N more" of kind.
+func countedNames(counts map[string]int, limit int, kind string) string {
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	slices.SortFunc(names, func(a, b string) int {
+		return cmp.Or(cmp.Compare(counts[b], counts[a]), cmp.Compare(a, b))
+	})
+	var items []string
+	for i, name := range names {
+		if limit > 0 && i == limit {
+			items = append(items, fmt.Sprintf("%d more %s", len(names)-limit, kind))
+			break
+		}
+		items = append(items, fmt.Sprintf("%s (%d)", name, counts[name]))
+	}
+	return joinList(items)
+}
+
+// joinList joins items as an English list: "a", "a and b", or "a, b, and
+// c".
+func joinList(items []string) string {
+	switch len(items) {
+	case 0:
+		return ""
+	case 1:
+		return items[0]
+	case 2:
+		return items[0] + " and " + items[1]
+	}
+	return strings.Join(items[:len(items)-1], ", ") + ", and " + items[len(items)-1]
+}
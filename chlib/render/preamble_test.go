@@ -0,0 +1,82 @@
+package render
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+)
+
+func TestPreamble(t *testing.T) {
+	dir := t.TempDir()
+	file := func(label, content string) entry.File {
+		path := filepath.Join(dir, strings.ReplaceAll(label, "/", "_"))
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return entry.File{StoragePath: path, OriginalPath: path, Label: label}
+	}
+	files := []entry.Entry{
+		file("src/a.go", "package a\n\nfunc A() {}\n"),
+		file("src/b.go", "package b\n"),
+		file("README.md", "# A\n"),
+		file("LICENSE", "MIT\n"),
+	}
+
+	testCases := []struct {
+		name     string
+		entries  []entry.Entry
+		opts     entry.RenderOptions
+		expected string
+	}{
+		{
+			name:    "files and outputs",
+			entries: append([]entry.Entry{entry.Message{Text: "Review these."}, entry.Output{Output: "ok"}}, files...),
+			expected: "**About this context**\n\n" +
+				"What follows includes 4 files (6 lines) and 1 command output. By language, the files are go (2), markdown (1), and other (1); by directory, `.` (2) and `src` (2).\n\n" +
+				"- Each file is its path, in backticks on a line of its own, followed by a fenced code block holding its full content, whose opening fence gives its language.\n" +
+				"- Command outputs and diffs are in fenced code blocks too; each diff is headed by the path it compares.\n" +
+				"- Everything else is messages to you, written as plain text.\n",
+		},
+		{
+			name:    "one directory, as rendered with other flags",
+			entries: files[:2],
+			opts:    entry.RenderOptions{FencePath: true, FileIDs: true, DetailsOver: 100},
+			expected: "**About this context**\n\n" +
+				"What follows includes 2 files (4 lines). By language, the files are go (2); by directory, all are in `src`.\n\n" +
+				"- Each file is a fenced code block holding its full content, whose opening fence gives its language and its path (path=). " +
+				"The opening fence also gives the file's ID (id=) and the start of its SHA-256 (sha256=). " +
+				"Files over 100 lines are wrapped in <details>, with the path in the summary.\n" +
+				"- Everything else is messages to you, written as plain text.\n",
+		},
+		{
+			name:     "messages only",
+			entries:  []entry.Entry{entry.Message{Text: "Hi."}},
+			expected: "**About this context**\n\nWhat follows is messages only, with nothing attached.\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if actual := Preamble(tc.entries, tc.opts); actual != tc.expected {
+				t.Errorf("Expected %q\n  Actual %q", tc.expected, actual)
+			}
+		})
+	}
+
+	markdown := Markdown(files[:1], entry.RenderOptions{Preamble: true, TOC: true})
+	if !strings.HasPrefix(markdown, "**About this context**") || !strings.Contains(markdown, "\n**Contents**") {
+		t.Errorf("Expected the preamble, then the table of contents\n  Actual %q", markdown)
+	}
+}
+
+func TestCountedNames(t *testing.T) {
+	counts := map[string]int{"a": 1, "b": 3, "c": 2, "d": 1}
+	if actual, expected := countedNames(counts, 2, "directories"), "b (3), c (2), and 2 more directories"; actual != expected {
+		t.Errorf("Expected %q\n  Actual %q", expected, actual)
+	}
+	if actual, expected := countedNames(counts, 0, ""), "b (3), c (2), a (1), and d (1)"; actual != expected {
+		t.Errorf("Expected %q\n  Actual %q", expected, actual)
+	}
+}
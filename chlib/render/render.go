@@ -0,0 +1,285 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+// Package render turns entries into the markdown that ch delivers: joining
+// them into one document, fitting it to a size budget, splitting it into
+// parts, and reading it back.
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+)
+
+// Markdown concatenates the markdown for entries with an extra newline of separation.
+// It returns a string with no whitespace at the front and exactly one newline at the end.
+// If entries is empty, it returns "\n".
+func Markdown(entries []entry.Entry, opts entry.RenderOptions) string {
+	var markdown strings.Builder
+
+	for _, chunk := range Chunks(entries, opts) {
+		markdown.WriteString(chunk.Markdown)
+		// Each chunk ends with a newline. Add a newline as a paragraph break.
+		markdown.WriteString("\n")
+	}
+
+	return strings.TrimSpace(markdown.String()) + "\n"
+}
+
+// Write writes the same markdown as Markdown to w, one entry at a time.
+// Attached files are copied to w rather than read into memory, so output
+// much larger than the available memory can be written to a file.
+func Write(w io.Writer, entries []entry.Entry, opts entry.RenderOptions) error {
+	tw := &trimWriter{w: w}
+	if opts.Header != "" {
+		io.WriteString(tw, opts.Header+"\n")
+	}
+	if opts.Preamble && len(entries) > 0 {
+		io.WriteString(tw, Preamble(entries, opts)+"\n")
+	}
+	if opts.TOC && len(entries) > 0 {
+		io.WriteString(tw, TOC(entries)+"\n")
+	}
+	for _, e := range entries {
+		if mw, ok := entry.Unwrap(e).(entry.MarkdownWriter); ok {
+			if err := mw.WriteMarkdown(tw, opts); err != nil {
+				return err
+			}
+		} else {
+			io.WriteString(tw, e.RenderMarkdown(opts))
+		}
+		// Each entry ends with a newline. Add a newline as a paragraph break.
+		io.WriteString(tw, "\n")
+	}
+	return tw.finish()
+}
+
+// trimWriter passes writes on to w with leading whitespace dropped and
+// trailing whitespace held back, so that once finish has written the final
+// newline, the output is what strings.TrimSpace(all) + "\n" would be (for
+// ASCII whitespace).
+type trimWriter struct {
+	w       io.Writer
+	started bool
+	// pending is whitespace that is written only if more text follows.
+	pending []byte
+	err     error
+}
+
+func (t *trimWriter) Write(p []byte) (int, error) {
+	if t.err != nil {
+		return 0, t.err
+	}
+	n := len(p)
+	if !t.started {
+		p = bytes.TrimLeft(p, asciiSpace)
+		if len(p) == 0 {
+			return n, nil
+		}
+		t.started = true
+	}
+	text := bytes.TrimRight(p, asciiSpace)
+	if len(text) > 0 {
+		if _, t.err = t.w.Write(t.pending); t.err != nil {
+			return 0, t.err
+		}
+		t.pending = t.pending[:0]
+		if _, t.err = t.w.Write(text); t.err != nil {
+			return 0, t.err
+		}
+	}
+	t.pending = append(t.pending, p[len(text):]...)
+	return n, nil
+}
+
+// finish ends the output with a single newline.
+func (t *trimWriter) finish() error {
+	if t.err != nil {
+		return t.err
+	}
+	_, t.err = io.WriteString(t.w, "\n")
+	return t.err
+}
+
+const asciiSpace = " \t\n\v\f\r"
+
+// Chunk is the markdown for one entry (or the preamble or table of
+// contents), together with the entry's priority.
+type Chunk struct {
+	Markdown string
+	Priority entry.Priority
+	// Role is set for the chunk of an entry.Turn, to the turn's role.
+	Role string
+	// File is set for the chunk of an attached file, which is the same
+	// from run to run as long as the file is.
+	File bool
+}
+
+// renderWorkers bounds how many entries Chunks renders at once. Rendering
+// a file is mostly waiting for it to be read (and, with metadata, for git),
+// so this is more than the number of CPUs would suggest; it pays off most
+// on network filesystems.
+const renderWorkers = 16
+
+// Chunks renders each entry (preceded by the preamble and the table of
+// contents, if requested) to a separate chunk of markdown ending with a newline. Chunks
+// are the units that Markdown joins, EnforceBudget trims, and Split
+// distributes. Entries are rendered concurrently, but the chunks are in the
+// order of the entries.
+func Chunks(entries []entry.Entry, opts entry.RenderOptions) []Chunk {
+	var chunks []Chunk
+	if opts.Header != "" {
+		chunks = append(chunks, Chunk{Markdown: opts.Header, Priority: entry.PriorityHigh})
+	}
+	if opts.Preamble && len(entries) > 0 {
+		chunks = append(chunks, Chunk{Markdown: Preamble(entries, opts), Priority: entry.PriorityHigh})
+	}
+	if opts.TOC && len(entries) > 0 {
+		chunks = append(chunks, Chunk{Markdown: TOC(entries), Priority: entry.PriorityHigh})
+	}
+	rendered := make([]Chunk, len(entries))
+	parallelFor(len(entries), renderWorkers, func(i int) {
+		rendered[i] = Chunk{Markdown: entries[i].RenderMarkdown(opts), Priority: entry.PriorityOf(entries[i])}
+		switch e := entry.Unwrap(entries[i]).(type) {
+		case entry.Turn:
+			// A budget mustn't drop a turn's start and merge it into another.
+			rendered[i].Role, rendered[i].Priority = e.Role, entry.PriorityHigh
+		case entry.File:
+			rendered[i].File = true
+		}
+	})
+	return append(chunks, rendered...)
+}
+
+// parallelFor calls fn for each index from 0 to n-1, on up to workers
+// goroutines at once, and returns when every call has returned.
+func parallelFor(n, workers int, fn func(i int)) {
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(n, workers); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+}
+
+// Join joins the markdown of chunks the same way Markdown does.
+func Join(chunks []Chunk) string {
+	markdown := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		markdown[i] = chunk.Markdown
+	}
+	return joinChunks(markdown)
+}
+
+// joinChunks joins chunks with blank lines, the same way Markdown does.
+func joinChunks(chunks []string) string {
+	var joined strings.Builder
+	for _, chunk := range chunks {
+		joined.WriteString(chunk)
+		joined.WriteString("\n")
+	}
+	return strings.TrimSpace(joined.String()) + "\n"
+}
+
+// TOC returns a table of contents for entries: a summary line counting
+// entries of each kind, followed by a numbered list with one line per entry.
+func TOC(entries []entry.Entry) string {
+	var lines []string
+	var files, messages, outputs int
+	for _, e := range entries {
+		switch entry.Unwrap(e).(type) {
+		case entry.File:
+			files++
+		case entry.Message:
+			messages++
+		case entry.Output:
+			outputs++
+		}
+		lines = append(lines, Describe(e))
+	}
+
+	var toc strings.Builder
+	toc.WriteString(fmt.Sprintf("**Contents** (%s, %s, %s)\n\n",
+		pluralize(files, "file", "files"),
+		pluralize(messages, "message", "messages"),
+		pluralize(outputs, "command output", "command outputs")))
+	for i, line := range lines {
+		toc.WriteString(fmt.Sprintf("%d. %s\n", i+1, line))
+	}
+	return toc.String()
+}
+
+// Describe returns a one-line description of an entry, as listed in a
+// table of contents.
+func Describe(e entry.Entry) string {
+	switch e := entry.Unwrap(e).(type) {
+	case entry.File:
+		line := fmt.Sprintf("`%s`", e.DisplayPath())
+		if lines, err := entry.CountFileLines(e.StoragePath); err == nil {
+			line += fmt.Sprintf(" (%s)", entry.FormatLineCount(lines))
+		}
+		return line
+	case entry.Duplicate:
+		return fmt.Sprintf("`%s` (duplicate)", e.OriginalPath)
+	case entry.Diff:
+		return fmt.Sprintf("`%s` (diff, %s)", e.Path, entry.FormatLineCount(entry.CountLines([]byte(e.Diff))))
+	case entry.Failure:
+		return fmt.Sprintf("Failed: `%s`", e.Command)
+	case entry.Message:
+		return "Message: " + summarizeText(e.Text)
+	case entry.Output:
+		return fmt.Sprintf("Command output (%s)", entry.FormatLineCount(entry.CountLines([]byte(strings.TrimSpace(e.Output)))))
+	case entry.Turn:
+		return "Turn: " + e.Role
+	}
+	return fmt.Sprintf("%T", e)
+}
+
+// summarizeText returns the first line of text, shortened to fit on a
+// single table-of-contents line.
+func summarizeText(text string) string {
+	const maxLen = 60
+	line, _, _ := strings.Cut(strings.TrimSpace(text), "\n")
+	if runes := []rune(line); len(runes) > maxLen {
+		line = string(runes[:maxLen]) + "…"
+	}
+	return fmt.Sprintf("%q", line)
+}
+
+func pluralize(n int, singular, plural string) string {
+	if n == 1 {
+		return "1 " + singular
+	}
+	return fmt.Sprintf("%d %s", n, plural)
+}
@@ -0,0 +1,325 @@
+package render
+
+import (
+	"html"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+)
+
+func TestMarkdown(t *testing.T) {
+	dir, fileWithContentPath, emptyFilePath := setupTestFiles(t)
+
+	specialCharFilePath := filepath.Join(dir, "file with spaces.txt")
+	err := os.WriteFile(specialCharFilePath, []byte("File content\n"), 0644)
+	if err != nil {
+		t.Fatalf("Failed to create file with special characters: %v", err)
+	}
+
+	testCases := []struct {
+		name     string
+		entries  []entry.Entry
+		expected string
+	}{
+		{
+			name: "Single message entry",
+			entries: []entry.Entry{
+				entry.Message{Text: "Hello, world!"},
+			},
+			expected: "Hello, world!\n",
+		},
+		{
+			name: "Single message entry with special characters",
+			entries: []entry.Entry{
+				entry.Message{Text: "Hello, `world`!"},
+			},
+			expected: "Hello, `world`!\n",
+		},
+		{
+			name: "Single file entry",
+			entries: []entry.Entry{
+				entry.File{StoragePath: fileWithContentPath, OriginalPath: fileWithContentPath},
+			},
+			expected: "`" + fileWithContentPath + "`\n```\nFile content\n```\n",
+		},
+		{
+			name: "Single file entry with empty content",
+			entries: []entry.Entry{
+				entry.File{StoragePath: emptyFilePath, OriginalPath: emptyFilePath},
+			},
+			expected: "`" + emptyFilePath + "`\n```\n```\n",
+		},
+		{
+			name: "Single file entry with special characters in path",
+			entries: []entry.Entry{
+				entry.File{StoragePath: specialCharFilePath, OriginalPath: specialCharFilePath},
+			},
+			expected: "`" + specialCharFilePath + "`\n```\nFile content\n```\n",
+		},
+		{
+			name: "Single output entry",
+			entries: []entry.Entry{
+				entry.Output{Output: "Command output"},
+			},
+			expected: "Command output\n",
+		},
+		{
+			name: "Single output entry with empty output",
+			entries: []entry.Entry{
+				entry.Output{Output: ""},
+			},
+			expected: "\n",
+		},
+		{
+			name: "Mixed entries",
+			entries: []entry.Entry{
+				entry.Message{Text: "Message 1"},
+				entry.File{StoragePath: fileWithContentPath, OriginalPath: fileWithContentPath},
+				entry.Output{Output: "Command output"},
+				entry.Message{Text: "Message 2"},
+			},
+			expected: "Message 1\n\n`" + fileWithContentPath + "`\n```\nFile content\n```\n\nCommand output\n\nMessage 2\n",
+		},
+		{
+			name: "Mixed entries with empty content",
+			entries: []entry.Entry{
+				entry.Message{Text: ""},
+				entry.File{StoragePath: emptyFilePath, OriginalPath: emptyFilePath},
+				entry.Output{Output: ""},
+				entry.Message{Text: ""},
+			},
+			expected: "`" + emptyFilePath + "`\n```\n```\n",
+		},
+		{
+			name: "Failure entry",
+			entries: []entry.Entry{
+				entry.Failure{Command: "exec make", Error: "command execution failed\nexit status 2\n"},
+			},
+			expected: "> **Failed:** `exec make`\n> command execution failed\n> exit status 2\n",
+		},
+		{
+			name:     "Empty entries",
+			entries:  []entry.Entry{},
+			expected: "\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			markdown := Markdown(tc.entries, entry.RenderOptions{})
+			if markdown != tc.expected {
+				t.Errorf("Unexpected markdown generated for %q.\nExpected:\n%q\nActual:\n%q", tc.name, tc.expected, markdown)
+			}
+		})
+	}
+}
+
+func TestMarkdownWithMetadata(t *testing.T) {
+	dir, fileWithContentPath, emptyFilePath := setupTestFiles(t)
+
+	modTime := time.Date(2024, 3, 1, 12, 30, 0, 0, time.Local)
+	for _, path := range []string{fileWithContentPath, emptyFilePath} {
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatalf("Failed to set modification time: %v", err)
+		}
+	}
+	remoteCopyPath := filepath.Join(dir, "file-remote")
+	if err := os.WriteFile(remoteCopyPath, []byte("one\ntwo\n"), 0644); err != nil {
+		t.Fatalf("Failed to create remote copy: %v", err)
+	}
+
+	entries := []entry.Entry{
+		entry.File{StoragePath: fileWithContentPath, OriginalPath: fileWithContentPath},
+		entry.File{StoragePath: emptyFilePath, OriginalPath: emptyFilePath},
+		entry.File{StoragePath: remoteCopyPath, OriginalPath: "host:/etc/app.conf"},
+	}
+	expected := "`" + fileWithContentPath + "` (13 B, 1 line, modified 2024-03-01 12:30)\n```\nFile content\n```\n\n" +
+		"`" + emptyFilePath + "` (0 B, 0 lines, modified 2024-03-01 12:30)\n```\n```\n\n" +
+		"`host:/etc/app.conf` (8 B, 2 lines)\n```\none\ntwo\n```\n"
+
+	markdown := Markdown(entries, entry.RenderOptions{Metadata: true})
+	if markdown != expected {
+		t.Errorf("Unexpected markdown generated.\nExpected:\n%q\nActual:\n%q", expected, markdown)
+	}
+}
+
+func TestMarkdownWithTOC(t *testing.T) {
+	_, fileWithContentPath, emptyFilePath := setupTestFiles(t)
+
+	entries := []entry.Entry{
+		entry.Message{Text: "Please review these files.\nThey are short."},
+		entry.File{StoragePath: fileWithContentPath, OriginalPath: fileWithContentPath},
+		entry.File{StoragePath: emptyFilePath, OriginalPath: emptyFilePath},
+		entry.Output{Output: "ok\n"},
+	}
+	expected := "**Contents** (2 files, 1 message, 1 command output)\n\n" +
+		"1. Message: \"Please review these files.\"\n" +
+		"2. `" + fileWithContentPath + "` (1 line)\n" +
+		"3. `" + emptyFilePath + "` (0 lines)\n" +
+		"4. Command output (1 line)\n\n" +
+		"Please review these files.\nThey are short.\n\n" +
+		"`" + fileWithContentPath + "`\n```\nFile content\n```\n\n" +
+		"`" + emptyFilePath + "`\n```\n```\n\n" +
+		"ok\n"
+
+	markdown := Markdown(entries, entry.RenderOptions{TOC: true})
+	if markdown != expected {
+		t.Errorf("Unexpected markdown generated.\nExpected:\n%q\nActual:\n%q", expected, markdown)
+	}
+}
+
+func TestMarkdownWithDetails(t *testing.T) {
+	dir, fileWithContentPath, _ := setupTestFiles(t)
+
+	longFilePath := filepath.Join(dir, "long <file>.txt")
+	if err := os.WriteFile(longFilePath, []byte("1\n2\n3\n"), 0644); err != nil {
+		t.Fatalf("Failed to create long file: %v", err)
+	}
+
+	entries := []entry.Entry{
+		entry.File{StoragePath: fileWithContentPath, OriginalPath: fileWithContentPath},
+		entry.File{StoragePath: longFilePath, OriginalPath: longFilePath},
+	}
+	expected := "`" + fileWithContentPath + "`\n```\nFile content\n```\n\n" +
+		"<details><summary><code>" + html.EscapeString(longFilePath) + "</code></summary>\n\n```\n1\n2\n3\n```\n\n</details>\n"
+
+	markdown := Markdown(entries, entry.RenderOptions{DetailsOver: 2})
+	if markdown != expected {
+		t.Errorf("Unexpected markdown generated.\nExpected:\n%q\nActual:\n%q", expected, markdown)
+	}
+}
+
+func TestMarkdownWithFencePath(t *testing.T) {
+	dir, fileWithContentPath, _ := setupTestFiles(t)
+
+	goFilePath := filepath.Join(dir, "main.go")
+	if err := os.WriteFile(goFilePath, []byte("package main\n"), 0644); err != nil {
+		t.Fatalf("Failed to create Go file: %v", err)
+	}
+	spacedFilePath := filepath.Join(dir, "my notes.md")
+	if err := os.WriteFile(spacedFilePath, []byte("# Notes\n"), 0644); err != nil {
+		t.Fatalf("Failed to create markdown file: %v", err)
+	}
+
+	entries := []entry.Entry{
+		entry.File{StoragePath: goFilePath, OriginalPath: goFilePath},
+		entry.File{StoragePath: fileWithContentPath, OriginalPath: fileWithContentPath},
+		entry.File{StoragePath: spacedFilePath, OriginalPath: spacedFilePath},
+	}
+
+	testCases := []struct {
+		name     string
+		opts     entry.RenderOptions
+		expected string
+	}{
+		{
+			name: "Separate path line",
+			opts: entry.RenderOptions{},
+			expected: "`" + goFilePath + "`\n```go\npackage main\n```\n\n" +
+				"`" + fileWithContentPath + "`\n```\nFile content\n```\n\n" +
+				"`" + spacedFilePath + "`\n```markdown\n# Notes\n```\n",
+		},
+		{
+			name: "Path in info string",
+			opts: entry.RenderOptions{FencePath: true},
+			expected: "```go path=" + goFilePath + "\npackage main\n```\n\n" +
+				"```text path=" + fileWithContentPath + "\nFile content\n```\n\n" +
+				"```markdown path=" + strconv.Quote(spacedFilePath) + "\n# Notes\n```\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			markdown := Markdown(entries, tc.opts)
+			if markdown != tc.expected {
+				t.Errorf("Unexpected markdown generated.\nExpected:\n%q\nActual:\n%q", tc.expected, markdown)
+			}
+		})
+	}
+}
+
+// setupTestFiles creates a file containing "File content\n" and an empty
+// file in a temporary directory, returning the directory and both paths.
+func setupTestFiles(t *testing.T) (string, string, string) {
+	dir := t.TempDir()
+
+	fileWithContentPath := filepath.Join(dir, "file.txt")
+	err := os.WriteFile(fileWithContentPath, []byte("File content\n"), 0644)
+	if err != nil {
+		t.Fatalf("Failed to create file with content: %v", err)
+	}
+
+	emptyFilePath := filepath.Join(dir, "empty.txt")
+	err = os.WriteFile(emptyFilePath, []byte{}, 0644)
+	if err != nil {
+		t.Fatalf("Failed to create empty file: %v", err)
+	}
+
+	return dir, fileWithContentPath, emptyFilePath
+}
+
+func TestChunksOrder(t *testing.T) {
+	dir := t.TempDir()
+	var entries []entry.Entry
+	var expected []Chunk
+	for i := 0; i < 100; i++ {
+		path := filepath.Join(dir, strconv.Itoa(i)+".txt")
+		if err := os.WriteFile(path, []byte(strconv.Itoa(i)+"\n"), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+		entries = append(entries, entry.File{StoragePath: path, OriginalPath: path})
+		expected = append(expected, Chunk{Markdown: "`" + path + "`\n```\n" + strconv.Itoa(i) + "\n```\n", File: true})
+	}
+
+	actual := Chunks(entries, entry.RenderOptions{})
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected chunks: %v\n  Actual chunks: %v", expected, actual)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	dir, fileWithContentPath, emptyFilePath := setupTestFiles(t)
+	longFilePath := filepath.Join(dir, "long.txt")
+	if err := os.WriteFile(longFilePath, []byte("one\ntwo\nthree"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	entries := []entry.Entry{
+		entry.Message{Text: "  Please review these files.\n"},
+		entry.File{StoragePath: fileWithContentPath, OriginalPath: fileWithContentPath},
+		entry.File{StoragePath: longFilePath, OriginalPath: longFilePath},
+		entry.Prioritized{Entry: entry.File{StoragePath: emptyFilePath, OriginalPath: "empty.go"}, Priority: entry.PriorityHigh},
+		entry.File{StoragePath: filepath.Join(t.TempDir(), "missing.txt"), OriginalPath: "missing.txt"},
+		entry.Duplicate{OriginalPath: fileWithContentPath},
+		entry.Diff{Path: "a.go", Diff: "-old\n+new\n"},
+		entry.Output{Output: "ok\n\n"},
+	}
+
+	testCases := []struct {
+		name string
+		opts entry.RenderOptions
+	}{
+		{name: "Default", opts: entry.RenderOptions{}},
+		{name: "TOC", opts: entry.RenderOptions{TOC: true}},
+		{name: "Metadata", opts: entry.RenderOptions{Metadata: true}},
+		{name: "FencePath", opts: entry.RenderOptions{Metadata: true, FencePath: true}},
+		{name: "Details", opts: entry.RenderOptions{DetailsOver: 2, Metadata: true}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var actual strings.Builder
+			if err := Write(&actual, entries, tc.opts); err != nil {
+				t.Fatalf("Write failed: %v", err)
+			}
+			expected := Markdown(entries, tc.opts)
+			if actual.String() != expected {
+				t.Errorf("Expected markdown:\n%q\n  Actual markdown:\n%q", expected, actual.String())
+			}
+		})
+	}
+}
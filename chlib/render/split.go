@@ -0,0 +1,185 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package render
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+)
+
+// partHeader returns the line that introduces part i of n.
+func partHeader(i, n int) string {
+	if i == n {
+		return fmt.Sprintf("**Part %d of %d** — this is the last part.", i, n)
+	}
+	return fmt.Sprintf("**Part %d of %d** — reply \"ok\" and wait for the next part.", i, n)
+}
+
+// Split distributes rendered chunks (see Chunks) into parts that each fit
+// within limit, including the part header. Normal- and high-priority chunks
+// are kept whole where possible, starting a new part when they don't fit;
+// low-priority chunks are cut to fill the rest of the current part. A chunk that is too large for any part on its own is cut
+// between lines, closing and reopening a code fence around the cut. If
+// everything fits in one part, that part is returned without a header.
+func Split(chunks []Chunk, limit Limit) ([]string, error) {
+	whole := Join(chunks)
+	if limit.Measure(whole) <= limit.Amount {
+		return []string{whole}, nil
+	}
+
+	// Reserve room for the longest header we could need, plus its blank line.
+	capacity := limit.Amount - limit.Measure(partHeader(999, 1000)+"\n\n")
+	if capacity <= 0 {
+		return nil, fmt.Errorf("split size %v is too small to hold a part header", limit)
+	}
+
+	var bodies []string
+	var current []string
+	flush := func() {
+		if len(current) > 0 {
+			bodies = append(bodies, joinChunks(current))
+			current = nil
+		}
+	}
+	for _, rendered := range chunks {
+		chunk := rendered.Markdown
+		if strings.TrimSpace(chunk) == "" {
+			continue
+		}
+		if limit.Measure(joinChunks(append(current, chunk))) <= capacity {
+			current = append(current, chunk)
+			continue
+		}
+		if rendered.Priority == entry.PriorityLow && len(current) > 0 {
+			// Fill the rest of this part with the start of the chunk, if
+			// there is room for a meaningful piece of it.
+			room := capacity - limit.Measure(joinChunks(current)+"\n")
+			if room > capacity/4 {
+				pieces := cutChunk(chunk, room, capacity, limit)
+				if limit.Measure(joinChunks(append(current, pieces[0]))) <= capacity {
+					current = append(current, pieces[0])
+					flush()
+					bodies = append(bodies, pieces[1:len(pieces)-1]...)
+					current = append(current, pieces[len(pieces)-1])
+					continue
+				}
+			}
+		}
+		flush()
+		if limit.Measure(chunk) <= capacity {
+			current = append(current, chunk)
+			continue
+		}
+		pieces := cutChunk(chunk, capacity, capacity, limit)
+		bodies = append(bodies, pieces[:len(pieces)-1]...)
+		current = append(current, pieces[len(pieces)-1])
+	}
+	flush()
+
+	parts := make([]string, len(bodies))
+	for i, body := range bodies {
+		parts[i] = partHeader(i+1, len(bodies)) + "\n\n" + body
+	}
+	return parts, nil
+}
+
+// cutChunk cuts an oversized chunk into pieces, the first of which fits in
+// firstCapacity and the rest in capacity. Cuts fall between lines; when a cut
+// falls inside a code fence, the fence is closed at the end of one piece and
+// reopened (with the same info string) at the start of the next, so every
+// piece is well-formed markdown.
+func cutChunk(chunk string, firstCapacity, capacity int, limit Limit) []string {
+	const continued = "(continued)\n"
+	var pieces []string
+	var piece strings.Builder
+	openFence := ""
+
+	closing := func() string {
+		if openFence != "" {
+			return "```\n"
+		}
+		return ""
+	}
+	startPiece := func() {
+		piece.Reset()
+		piece.WriteString(continued)
+		if openFence != "" {
+			piece.WriteString(openFence)
+		}
+	}
+
+	pieceCapacity := firstCapacity
+	lines := strings.SplitAfter(chunk, "\n")
+	for len(lines) > 0 {
+		line := lines[0]
+		if line == "" {
+			lines = lines[1:]
+			continue
+		}
+		if limit.Measure(piece.String()+line+closing()) > pieceCapacity {
+			if piece.Len() > 0 && piece.String() != continued+openFence {
+				piece.WriteString(closing())
+				pieces = append(pieces, piece.String())
+				startPiece()
+				pieceCapacity = capacity
+				continue
+			}
+			// A single line too long for an empty piece: cut the line itself.
+			room := limit.maxBytes(pieceCapacity) - len(piece.String()+closing()+"\n")
+			line = truncateUTF8(line, room)
+			lines[0] = strings.TrimPrefix(lines[0], line)
+			line += "\n"
+		} else {
+			lines = lines[1:]
+		}
+		piece.WriteString(line)
+		if strings.HasPrefix(line, "```") {
+			if openFence == "" {
+				openFence = line
+			} else if strings.TrimSpace(line) == "```" {
+				openFence = ""
+			}
+		}
+	}
+	if piece.Len() > 0 {
+		pieces = append(pieces, piece.String())
+	}
+	return pieces
+}
+
+// truncateUTF8 returns the longest prefix of s that is at most n bytes and
+// does not end in the middle of a UTF-8 sequence. To guarantee progress, the
+// prefix always includes at least the first rune of a non-empty s.
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	if n <= 0 {
+		_, size := utf8.DecodeRuneInString(s)
+		return s[:size]
+	}
+	return s[:n]
+}
@@ -0,0 +1,161 @@
+package render
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+)
+
+func TestParseLimit(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected Limit
+		wantErr  bool
+	}{
+		{input: "30k-tokens", expected: Limit{Amount: 30000, Tokens: true}},
+		{input: "100k-bytes", expected: Limit{Amount: 100000}},
+		{input: "2M-bytes", expected: Limit{Amount: 2000000}},
+		{input: "5000", expected: Limit{Amount: 5000, Tokens: true}},
+		{input: "1-token", expected: Limit{Amount: 1, Tokens: true}},
+		{input: "30k-words", wantErr: true},
+		{input: "lots", wantErr: true},
+		{input: "0", wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		actual, err := ParseLimit(tc.input)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("ParseLimit(%q): expected an error, got %v", tc.input, actual)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseLimit(%q): unexpected error: %v", tc.input, err)
+		} else if actual != tc.expected {
+			t.Errorf("ParseLimit(%q) = %+v, expected %+v", tc.input, actual, tc.expected)
+		}
+	}
+}
+
+func TestSplit(t *testing.T) {
+	limit := Limit{Amount: 120}
+	header1 := partHeader(1, 3) + "\n\n"
+
+	t.Run("Fits in one part", func(t *testing.T) {
+		parts, err := Split(normalChunks("Hello\n", "World\n"), limit)
+		if err != nil {
+			t.Fatalf("Split failed: %v", err)
+		}
+		if len(parts) != 1 || parts[0] != "Hello\n\nWorld\n" {
+			t.Errorf("Expected a single unheaded part, got %q", parts)
+		}
+	})
+
+	t.Run("Whole chunks", func(t *testing.T) {
+		chunks := []string{
+			strings.Repeat("a", 50) + "\n",
+			strings.Repeat("b", 50) + "\n",
+			strings.Repeat("c", 50) + "\n",
+		}
+		parts, err := Split(normalChunks(chunks...), limit)
+		if err != nil {
+			t.Fatalf("Split failed: %v", err)
+		}
+		expected := []string{
+			header1 + chunks[0],
+			partHeader(2, 3) + "\n\n" + chunks[1],
+			partHeader(3, 3) + "\n\n" + chunks[2],
+		}
+		if strings.Join(parts, "|") != strings.Join(expected, "|") {
+			t.Errorf("Unexpected parts.\nExpected: %q\n  Actual: %q", expected, parts)
+		}
+	})
+
+	t.Run("Oversized fenced chunk", func(t *testing.T) {
+		var content strings.Builder
+		for i := 0; i < 12; i++ {
+			content.WriteString("line of code\n")
+		}
+		chunk := "`big.go`\n```go\n" + content.String() + "```\n"
+		parts, err := Split(normalChunks("Intro\n", chunk), limit)
+		if err != nil {
+			t.Fatalf("Split failed: %v", err)
+		}
+		if len(parts) < 3 {
+			t.Fatalf("Expected the chunk to be cut into several parts, got %q", parts)
+		}
+		var reassembled strings.Builder
+		for i, part := range parts {
+			if limit.Measure(part) > limit.Amount {
+				t.Errorf("Part %d exceeds the limit: %q", i+1, part)
+			}
+			if strings.Count(part, "```")%2 != 0 {
+				t.Errorf("Part %d has an unbalanced code fence: %q", i+1, part)
+			}
+			if !strings.HasPrefix(part, partHeader(i+1, len(parts))) {
+				t.Errorf("Part %d lacks its header: %q", i+1, part)
+			}
+			reassembled.WriteString(part)
+		}
+		if strings.Count(reassembled.String(), "line of code\n") != 12 {
+			t.Errorf("Content was lost or duplicated: %q", parts)
+		}
+	})
+
+	t.Run("Oversized line", func(t *testing.T) {
+		long := strings.Repeat("é", 200) + "\n"
+		parts, err := Split(normalChunks(long), limit)
+		if err != nil {
+			t.Fatalf("Split failed: %v", err)
+		}
+		var reassembled strings.Builder
+		for i, part := range parts {
+			if limit.Measure(part) > limit.Amount {
+				t.Errorf("Part %d exceeds the limit: %q", i+1, part)
+			}
+			body := strings.SplitN(part, "\n\n", 2)[1]
+			body = strings.TrimPrefix(body, "(continued)\n")
+			reassembled.WriteString(strings.ReplaceAll(body, "\n", ""))
+		}
+		if reassembled.String() != strings.TrimSuffix(long, "\n") {
+			t.Errorf("Long line was not reassembled intact: %q", parts)
+		}
+	})
+
+	t.Run("Low priority fills parts", func(t *testing.T) {
+		intro := strings.Repeat("i", 20) + "\n"
+		var notes strings.Builder
+		for i := 0; i < 10; i++ {
+			notes.WriteString("note line\n")
+		}
+		chunks := []Chunk{
+			{Markdown: intro},
+			{Markdown: notes.String(), Priority: entry.PriorityLow},
+		}
+		parts, err := Split(chunks, limit)
+		if err != nil {
+			t.Fatalf("Split failed: %v", err)
+		}
+		if len(parts) < 2 || !strings.Contains(parts[0], intro+"\nnote line\n") {
+			t.Errorf("Expected the low-priority chunk to start in the first part, got %q", parts)
+		}
+	})
+
+	t.Run("Too small for header", func(t *testing.T) {
+		_, err := Split(normalChunks(strings.Repeat("x", 100)+"\n"), Limit{Amount: 10})
+		if err == nil {
+			t.Error("Expected an error for a limit smaller than the header")
+		}
+	})
+}
+
+// normalChunks wraps markdown strings as normal-priority rendered chunks.
+func normalChunks(markdown ...string) []Chunk {
+	chunks := make([]Chunk, len(markdown))
+	for i, m := range markdown {
+		chunks[i] = Chunk{Markdown: m}
+	}
+	return chunks
+}
@@ -0,0 +1,111 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package render
+
+import "strings"
+
+// Turn is one turn of a transcript: the markdown of what one role said.
+// A list of turns, as JSON, is the role array that chat APIs take.
+type Turn struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// Transcript groups chunks into turns, each begun by the chunk of an
+// entry.Turn and joined as Join does. Chunks before the first turn, or all
+// of them if there are no turns, make a user turn of their own.
+func Transcript(chunks []Chunk) []Turn {
+	turns := []Turn{}
+	for _, group := range groupTurns(chunks) {
+		turn := Turn{Role: group.role}
+		if len(group.chunks) > 0 {
+			turn.Content = strings.TrimSuffix(Join(group.chunks), "\n")
+		}
+		turns = append(turns, turn)
+	}
+	return turns
+}
+
+// BlockTurn is a turn of a transcript whose content is kept in blocks.
+type BlockTurn struct {
+	Role   string
+	Blocks []Block
+}
+
+// Block is part of a turn's content: the markdown of consecutive chunks
+// that are all attached files, or all not.
+type Block struct {
+	Text string
+	File bool
+}
+
+// TranscriptBlocks groups chunks into turns as Transcript does, but keeps
+// each turn's content in blocks, so that the files attached in a turn,
+// which change less often than what surrounds them, can be told apart.
+func TranscriptBlocks(chunks []Chunk) []BlockTurn {
+	turns := []BlockTurn{}
+	for _, group := range groupTurns(chunks) {
+		turn := BlockTurn{Role: group.role}
+		for start := 0; start < len(group.chunks); {
+			end := start + 1
+			for end < len(group.chunks) && group.chunks[end].File == group.chunks[start].File {
+				end++
+			}
+			text := strings.TrimSuffix(Join(group.chunks[start:end]), "\n")
+			turn.Blocks = append(turn.Blocks, Block{Text: text, File: group.chunks[start].File})
+			start = end
+		}
+		turns = append(turns, turn)
+	}
+	return turns
+}
+
+// turnGroup is the role of a turn and the chunks of its content.
+type turnGroup struct {
+	role   string
+	chunks []Chunk
+}
+
+// groupTurns groups chunks into turns for Transcript and TranscriptBlocks.
+func groupTurns(chunks []Chunk) []turnGroup {
+	var groups []turnGroup
+	role := ""
+	var pending []Chunk
+	flush := func() {
+		if role == "" && len(pending) == 0 {
+			return
+		}
+		group := turnGroup{role: role, chunks: pending}
+		if group.role == "" {
+			group.role = "user"
+		}
+		groups = append(groups, group)
+	}
+	for _, chunk := range chunks {
+		if chunk.Role != "" {
+			flush()
+			role, pending = chunk.Role, nil
+			continue
+		}
+		pending = append(pending, chunk)
+	}
+	flush()
+	return groups
+}
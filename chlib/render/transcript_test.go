@@ -0,0 +1,101 @@
+package render
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+)
+
+func TestTranscript(t *testing.T) {
+	tests := []struct {
+		name     string
+		entries  []entry.Entry
+		expected []Turn
+	}{
+		{
+			name:     "No entries",
+			expected: []Turn{},
+		},
+		{
+			name:     "No turns",
+			entries:  []entry.Entry{entry.Message{Text: "Hello"}, entry.Output{Output: "ok\n", Lang: "text"}},
+			expected: []Turn{{Role: "user", Content: "Hello\n\n```text\nok\n```"}},
+		},
+		{
+			name: "Turns",
+			entries: []entry.Entry{
+				entry.Message{Text: "Context first"},
+				entry.Turn{Role: "assistant"},
+				entry.Message{Text: "A reply"},
+				entry.Turn{Role: "user"},
+				entry.Message{Text: "A follow-up"},
+				entry.Turn{Role: "assistant"},
+			},
+			expected: []Turn{
+				{Role: "user", Content: "Context first"},
+				{Role: "assistant", Content: "A reply"},
+				{Role: "user", Content: "A follow-up"},
+				{Role: "assistant"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual := Transcript(Chunks(test.entries, entry.RenderOptions{}))
+			if !reflect.DeepEqual(actual, test.expected) {
+				t.Errorf("Expected %+v\n  Actual %+v", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestTranscriptBudget(t *testing.T) {
+	entries := []entry.Entry{
+		entry.Turn{Role: "user"},
+		entry.Prioritized{Entry: entry.Message{Text: "Low priority " + strings.Repeat("detail ", 100)}, Priority: entry.PriorityLow},
+		entry.Turn{Role: "assistant"},
+		entry.Message{Text: "Reply"},
+	}
+	chunks, err := EnforceBudget(Chunks(entries, entry.RenderOptions{}), Limit{Amount: 200})
+	if err != nil {
+		t.Fatalf("EnforceBudget failed: %v", err)
+	}
+	turns := Transcript(chunks)
+	if len(turns) != 2 || turns[0].Role != "user" || turns[1].Role != "assistant" || strings.Contains(turns[0].Content, "Low priority") {
+		t.Errorf("Expected the budget to drop the low-priority message but keep both turns\n  Actual %+v", turns)
+	}
+}
+
+func TestTranscriptBlocks(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.go"), filepath.Join(dir, "b.go")
+	for _, path := range []string{a, b} {
+		if err := os.WriteFile(path, []byte("package x\n"), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+	entries := []entry.Entry{
+		entry.Turn{Role: "system"},
+		entry.Message{Text: "Be brief."},
+		entry.Turn{Role: "user"},
+		entry.File{StoragePath: a, OriginalPath: "a.go"},
+		entry.File{StoragePath: b, OriginalPath: "b.go"},
+		entry.Message{Text: "Why?"},
+	}
+	expected := []BlockTurn{
+		{Role: "system", Blocks: []Block{{Text: "Be brief."}}},
+		{Role: "user", Blocks: []Block{
+			{Text: "`a.go`\n```go\npackage x\n```\n\n`b.go`\n```go\npackage x\n```", File: true},
+			{Text: "Why?"},
+		}},
+	}
+	actual := TranscriptBlocks(Chunks(entries, entry.RenderOptions{}))
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected %+v\n  Actual %+v", expected, actual)
+	}
+}
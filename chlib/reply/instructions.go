@@ -0,0 +1,86 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package reply
+
+import "fmt"
+
+// The reply formats Instructions asks for.
+const (
+	// FormatFiles asks for each changed file in full.
+	FormatFiles = "files"
+	// FormatDiff asks for a unified diff of each changed file.
+	FormatDiff = "diff"
+)
+
+// Formats lists the reply formats, for usage messages.
+var Formats = []string{FormatFiles, FormatDiff}
+
+// Instructions returns a block of markdown telling a model how to format
+// its reply so that Files (for FormatFiles) or Patches (for FormatDiff)
+// reads it. Each ends with an example that the package's tests check
+// those parsers read as described.
+func Instructions(format string) (string, error) {
+	switch format {
+	case FormatFiles:
+		return filesInstructions, nil
+	case FormatDiff:
+		return diffInstructions, nil
+	}
+	return "", fmt.Errorf("invalid reply format %q (expected files or diff)", format)
+}
+
+const filesInstructions = "## Reply format\n\n" +
+	"If you change any files, give each changed file in full, in its own fenced code block:\n\n" +
+	"- Put the file's path, in backticks, alone on the line before the block.\n" +
+	"- Start the block with three backticks and the file's language. If the file was attached with an `id=`, " +
+	"repeat that `id=` after the language.\n" +
+	"- Give the whole file, not just the changed part, and nothing else in the block.\n" +
+	"- For a new file, give its path and leave out the `id=`.\n" +
+	"- Use other code blocks only for snippets that are not files, with no path before them.\n\n" +
+	"For example:\n\n" +
+	"`src/hello.go`\n" +
+	"```go id=1a2b3c4d\n" +
+	"package main\n\n" +
+	"func main() {\n" +
+	"\tprintln(\"hello, world\")\n" +
+	"}\n" +
+	"```\n"
+
+const diffInstructions = "## Reply format\n\n" +
+	"If you change any files, give each change as a unified diff, in its own fenced code block:\n\n" +
+	"- Start the block with three backticks and `diff`. If the file was attached with an `id=`, " +
+	"repeat that `id=` after `diff`.\n" +
+	"- Begin the diff with `--- a/path` and `+++ b/path` lines, using the file's path.\n" +
+	"- Give each hunk an `@@ -old,count +new,count @@` header, with three lines of unchanged context " +
+	"around each change, copied exactly from the file.\n" +
+	"- For a new file, use `--- /dev/null`, a `@@ -0,0 +1,count @@` header, and leave out the `id=`.\n" +
+	"- Use other code blocks only for snippets that are not changes.\n\n" +
+	"For example:\n\n" +
+	"```diff id=1a2b3c4d\n" +
+	"--- a/src/hello.go\n" +
+	"+++ b/src/hello.go\n" +
+	"@@ -1,5 +1,5 @@\n" +
+	" package main\n" +
+	" \n" +
+	" func main() {\n" +
+	"-\tprintln(\"hello\")\n" +
+	"+\tprintln(\"hello, world\")\n" +
+	" }\n" +
+	"```\n"
@@ -0,0 +1,222 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+// Package reply finds the files a model proposes in its reply to a ch
+// prompt, so that ch apply can write them back. A proposed file is a fenced
+// code block holding a file's full new content, named by the file ID that
+// ch gave it (see entry.File.ID), by a path, or both; a proposed change is
+// a diff block holding a unified diff. Instructions tells a model how to
+// write either, in a form these parsers read.
+package reply
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/eloquence-cloud/ch/chlib/diff"
+)
+
+// File is a file proposed in a reply.
+type File struct {
+	// ID is the file ID given for it, if any.
+	ID string
+	// Path is the path given for it, if any.
+	Path string
+	// Content is the file's proposed content.
+	Content string
+}
+
+var (
+	// fenceOpening matches the opening of a fenced code block, giving the
+	// fence and the info string.
+	fenceOpening = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})(.*)$")
+	// infoID and infoPath match the id= and path= values that ch writes
+	// in fence info strings.
+	infoID   = regexp.MustCompile(`(?:^|\s)id=([0-9a-f]{8})\b`)
+	infoPath = regexp.MustCompile(`(?:^|\s)path=("(?:[^"\\]|\\.)*"|\S+)`)
+	// headerPath matches a line that only names the file that follows, as
+	// ch writes it and as models tend to: `path`, **`path`**, or ### `path`,
+	// possibly with a colon or its ID after it. Prose that merely starts
+	// with inline code doesn't match.
+	headerPath = regexp.MustCompile("^(?:#{1,6}\\s+)?(?:\\*\\*)?`([^`\\s]+)`(?:\\*\\*)?:?(?:\\s+\\(?id[=:]\\s*[0-9a-f]{8}\\)?)?:?\\s*$")
+	// headerID matches a file ID given on a header line.
+	headerID = regexp.MustCompile(`\bid[=:]\s*([0-9a-f]{8})\b`)
+)
+
+// Files returns the files proposed in text, in the order they appear. A
+// fenced code block is a proposed file if its info string or the line
+// before it (or before a blank line before it) gives an ID or a path, as
+// in ch's own output; other blocks are taken to be snippets and skipped,
+// as are diffs, which Patches returns.
+func Files(text string) []File {
+	var files []File
+	for _, b := range blocks(text) {
+		if b.isDiff() {
+			continue
+		}
+		file := File{ID: b.id, Path: b.path, Content: b.content}
+		if file.ID != "" || file.Path != "" {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// Patch is a change to one file, proposed in a reply as a unified diff.
+type Patch struct {
+	// ID is the file ID given for it, if any.
+	ID string
+	// Path is the path of the file it changes, from its +++ line, or
+	// from its --- line if it deletes the file.
+	Path string
+	// Patch is the parsed diff.
+	Patch diff.FilePatch
+}
+
+// Deletes reports whether the patch deletes its file.
+func (p Patch) Deletes() bool {
+	return p.Patch.NewPath == "/dev/null"
+}
+
+// Creates reports whether the patch creates its file.
+func (p Patch) Creates() bool {
+	return p.Patch.OldPath == "/dev/null"
+}
+
+// Patches returns the changes proposed in text as unified diffs: fenced
+// code blocks whose language is diff or patch. A block may hold diffs of
+// several files; an ID given for the block applies only if it holds one.
+func Patches(text string) ([]Patch, error) {
+	var patches []Patch
+	for _, b := range blocks(text) {
+		if !b.isDiff() {
+			continue
+		}
+		filePatches, err := diff.ParseUnified(b.content)
+		if err != nil {
+			return nil, fmt.Errorf("diff block at line %d: %v", b.line, err)
+		}
+		for _, fp := range filePatches {
+			patch := Patch{Path: fp.NewPath, Patch: fp}
+			if patch.Deletes() {
+				patch.Path = fp.OldPath
+			}
+			if len(filePatches) == 1 {
+				patch.ID = b.id
+			}
+			patches = append(patches, patch)
+		}
+	}
+	return patches, nil
+}
+
+// block is a fenced code block in a reply.
+type block struct {
+	// line is the 1-based line number of its opening fence.
+	line int
+	// lang is the first word of its info string, unless that is a
+	// key=value pair.
+	lang string
+	// id and path are the file ID and path given in its info string or
+	// on the line before it.
+	id, path string
+	content  string
+}
+
+// isDiff reports whether b holds a unified diff.
+func (b block) isDiff() bool {
+	return b.lang == "diff" || b.lang == "patch"
+}
+
+// blocks returns the fenced code blocks in text, in the order they appear.
+func blocks(text string) []block {
+	var found []block
+	lines := strings.Split(text, "\n")
+	for i := 0; i < len(lines); i++ {
+		m := fenceOpening.FindStringSubmatch(lines[i])
+		if m == nil {
+			continue
+		}
+		end := closingFence(lines, i+1, m[1])
+		if end < 0 {
+			break
+		}
+		b := block{line: i + 1, content: strings.Join(lines[i+1:end], "\n")}
+		if end > i+1 {
+			b.content += "\n"
+		}
+		info := m[2]
+		if fields := strings.Fields(info); len(fields) > 0 && !strings.Contains(fields[0], "=") {
+			b.lang = fields[0]
+		}
+		if id := infoID.FindStringSubmatch(info); id != nil {
+			b.id = id[1]
+		}
+		if path := infoPath.FindStringSubmatch(info); path != nil {
+			b.path = unquote(path[1])
+		}
+		if header := headerLine(lines, i); header != "" {
+			if path := headerPath.FindStringSubmatch(header); path != nil {
+				if b.path == "" {
+					b.path = path[1]
+				}
+				if id := headerID.FindStringSubmatch(header); id != nil && b.id == "" {
+					b.id = id[1]
+				}
+			}
+		}
+		found = append(found, b)
+		i = end
+	}
+	return found
+}
+
+// closingFence returns the index of the line at or after start that closes
+// a block opened with fence, or -1 if there is none. As in CommonMark, the
+// closing fence is of the same character and at least as long.
+func closingFence(lines []string, start int, fence string) int {
+	for j := start; j < len(lines); j++ {
+		line := strings.TrimSpace(lines[j])
+		if len(line) >= len(fence) && strings.Trim(line, fence[:1]) == "" {
+			return j
+		}
+	}
+	return -1
+}
+
+// headerLine returns the line before the fence opening at index i, skipping
+// one blank line, or "" if there is none.
+func headerLine(lines []string, i int) string {
+	for j := i - 1; j >= 0 && j >= i-2; j-- {
+		if line := strings.TrimSpace(lines[j]); line != "" {
+			return line
+		}
+	}
+	return ""
+}
+
+// unquote reverses the quoting of values in fence info strings.
+func unquote(value string) string {
+	if unquoted, err := strconv.Unquote(value); err == nil {
+		return unquoted
+	}
+	return value
+}
@@ -0,0 +1,121 @@
+package reply
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFiles(t *testing.T) {
+	testCases := []struct {
+		name     string
+		text     string
+		expected []File
+	}{
+		{
+			name:     "ch's own format",
+			text:     "Here is the fix:\n\n`auth/login.go`\n```go id=1a2b3c4d sha256=0011223344556677\npackage auth\n```\n",
+			expected: []File{{ID: "1a2b3c4d", Path: "auth/login.go", Content: "package auth\n"}},
+		},
+		{
+			name:     "fence path",
+			text:     "```go path=\"my dir/a.go\" id=1a2b3c4d\nx\n```",
+			expected: []File{{ID: "1a2b3c4d", Path: "my dir/a.go", Content: "x\n"}},
+		},
+		{
+			name:     "bold header with an ID and a blank line",
+			text:     "**`a.go`** (id: 0badf00d)\n\n```go\nx\n```\n",
+			expected: []File{{ID: "0badf00d", Path: "a.go", Content: "x\n"}},
+		},
+		{
+			name:     "heading and a longer fence holding a fence",
+			text:     "### `README.md`\n````markdown\n```sh\nmake\n```\n````\n",
+			expected: []File{{Path: "README.md", Content: "```sh\nmake\n```\n"}},
+		},
+		{
+			name:     "snippets are skipped",
+			text:     "Run `make`, then:\n```sh\ngo test ./...\n```\n`b.go`:\n```go\ny\n```\n",
+			expected: []File{{Path: "b.go", Content: "y\n"}},
+		},
+		{
+			name:     "prose starting with inline code",
+			text:     "`foo` is called like this:\n```go\nfoo()\n```\n**`Bar`** returns an error, id=1a2b3c4d:\n```go\nerr := Bar()\n```\n",
+			expected: nil,
+		},
+		{
+			name:     "unterminated",
+			text:     "`a.go`\n```go\nx\n",
+			expected: nil,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if actual := Files(tc.text); !reflect.DeepEqual(actual, tc.expected) {
+				t.Errorf("Expected %+v\n  Actual %+v", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestPatches(t *testing.T) {
+	text := "Change a.go:\n\n```diff id=1a2b3c4d\n--- a/a.go\n+++ b/a.go\n@@ -1 +1 @@\n-x\n+y\n```\n\n" +
+		"And add and remove files:\n```patch\n--- /dev/null\n+++ b/new.go\n@@ -0,0 +1 @@\n+z\n--- a/old.go\n+++ /dev/null\n@@ -1 +0,0 @@\n-w\n```\n" +
+		"`c.go`\n```go\nc\n```\n"
+	patches, err := Patches(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var actual []string
+	for _, p := range patches {
+		actual = append(actual, fmt.Sprintf("%s %s creates=%t deletes=%t", p.ID, p.Path, p.Creates(), p.Deletes()))
+	}
+	expected := []string{
+		"1a2b3c4d a.go creates=false deletes=false",
+		" new.go creates=true deletes=false",
+		" old.go creates=false deletes=true",
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected %q\n  Actual %q", expected, actual)
+	}
+	if files := Files(text); len(files) != 1 || files[0].Path != "c.go" {
+		t.Errorf("Expected Files to skip the diffs and find c.go\n  Actual %+v", files)
+	}
+
+	if _, err := Patches("```diff\nnot a diff\n```\n"); err == nil {
+		t.Errorf("Expected an error for a diff block without a diff")
+	}
+}
+
+// TestInstructions checks that the example in each format's instructions
+// reads as the instructions describe it.
+func TestInstructions(t *testing.T) {
+	text, err := Instructions(FormatFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := Files(text)
+	if len(files) != 1 || files[0].ID != "1a2b3c4d" || files[0].Path != "src/hello.go" {
+		t.Errorf("Expected the files example to propose src/hello.go with its ID\n  Actual %+v", files)
+	}
+
+	text, err = Instructions(FormatDiff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	patches, err := Patches(text)
+	if err != nil || len(patches) != 1 || patches[0].ID != "1a2b3c4d" || patches[0].Path != "src/hello.go" {
+		t.Fatalf("Expected the diff example to change src/hello.go with its ID\n  Actual %+v, %v", patches, err)
+	}
+	old := "package main\n\nfunc main() {\n\tprintln(\"hello\")\n}\n"
+	if updated, err := patches[0].Patch.Apply(old); err != nil || updated != strings.Replace(old, "hello", "hello, world", 1) {
+		t.Errorf("Expected the diff example to apply\n  Actual %q, %v", updated, err)
+	}
+	if len(Files(text)) != 0 {
+		t.Errorf("Expected no files in the diff instructions")
+	}
+
+	if _, err := Instructions("xml"); err == nil {
+		t.Errorf("Expected an error for an unknown format")
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package script
+
+import (
+	"fmt"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+	"go.starlark.net/starlark"
+)
+
+// exportedFields lists the dict keys of an entry and the Exported field
+// each corresponds to.
+var exportedFields = []struct {
+	key   string
+	field func(*entry.Exported) *string
+}{
+	{"type", func(e *entry.Exported) *string { return &e.Type }},
+	{"path", func(e *entry.Exported) *string { return &e.Path }},
+	{"source", func(e *entry.Exported) *string { return &e.Source }},
+	{"command", func(e *entry.Exported) *string { return &e.Command }},
+	{"priority", func(e *entry.Exported) *string { return &e.Priority }},
+	{"content", func(e *entry.Exported) *string { return &e.Content }},
+	{"contentBase64", func(e *entry.Exported) *string { return &e.ContentBase64 }},
+	{"role", func(e *entry.Exported) *string { return &e.Role }},
+}
+
+// toValues converts entries to a Starlark list of dicts. It also returns the
+// original entries, which fromValues reuses for files a hook leaves
+// unchanged, so that local files keep their metadata.
+func toValues(entries []entry.Entry) (*starlark.List, []entry.Entry, error) {
+	list, err := entry.Export(entries)
+	if err != nil {
+		return nil, nil, err
+	}
+	values := make([]starlark.Value, len(list.Entries))
+	for i := range list.Entries {
+		dict := starlark.NewDict(len(exportedFields))
+		for _, f := range exportedFields {
+			if value := *f.field(&list.Entries[i]); value != "" {
+				dict.SetKey(starlark.String(f.key), starlark.String(value))
+			}
+		}
+		values[i] = dict
+	}
+	return starlark.NewList(values), entries, nil
+}
+
+// fromValues converts a value returned by a script (a list of entry dicts
+// and strings) back into entries.
+func fromValues(tempDir string, value starlark.Value, originals []entry.Entry) ([]entry.Entry, error) {
+	iterable, ok := value.(starlark.Iterable)
+	if !ok || value.Type() == "string" {
+		return nil, fmt.Errorf("expected a list of entries, got %s", value.Type())
+	}
+	unchanged := unchangedFiles(originals)
+
+	var list entry.List
+	iter := iterable.Iterate()
+	defer iter.Done()
+	var item starlark.Value
+	for i := 1; iter.Next(&item); i++ {
+		exported, err := toExported(item)
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: %v", i, err)
+		}
+		list.Entries = append(list.Entries, exported)
+	}
+
+	var entries []entry.Entry
+	for i, exported := range list.Entries {
+		if original, ok := unchanged[exported]; ok {
+			entries = append(entries, original)
+			continue
+		}
+		imported, err := entry.Import(tempDir, entry.List{Entries: list.Entries[i : i+1]})
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: %v", i+1, err)
+		}
+		entries = append(entries, imported...)
+	}
+	return entries, nil
+}
+
+// unchangedFiles maps the exported form of each original file entry to the
+// entry itself.
+func unchangedFiles(originals []entry.Entry) map[entry.Exported]entry.Entry {
+	unchanged := make(map[entry.Exported]entry.Entry)
+	for _, original := range originals {
+		if _, ok := entry.Unwrap(original).(entry.File); !ok {
+			continue
+		}
+		if list, err := entry.Export([]entry.Entry{original}); err == nil {
+			unchanged[list.Entries[0]] = original
+		}
+	}
+	return unchanged
+}
+
+func toExported(value starlark.Value) (entry.Exported, error) {
+	if text, ok := value.(starlark.String); ok {
+		return entry.Exported{Type: "message", Content: string(text)}, nil
+	}
+	dict, ok := value.(*starlark.Dict)
+	if !ok {
+		return entry.Exported{}, fmt.Errorf("expected a dict or string, got %s", value.Type())
+	}
+	var exported entry.Exported
+	for _, item := range dict.Items() {
+		key, ok := starlark.AsString(item[0])
+		if !ok {
+			return entry.Exported{}, fmt.Errorf("key %s is not a string", item[0])
+		}
+		field := fieldFor(key)
+		if field == nil {
+			return entry.Exported{}, fmt.Errorf("unknown key %q", key)
+		}
+		text, ok := starlark.AsString(item[1])
+		if !ok {
+			return entry.Exported{}, fmt.Errorf("value of %q is %s, not a string", key, item[1].Type())
+		}
+		*field(&exported) = text
+	}
+	return exported, nil
+}
+
+func fieldFor(key string) func(*entry.Exported) *string {
+	for _, f := range exportedFields {
+		if f.key == key {
+			return f.field
+		}
+	}
+	return nil
+}
@@ -0,0 +1,230 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+// Package script runs user scripts, written in Starlark, that extend ch:
+// they can define subcommands and hooks that adjust entries before rendering
+// and markdown after it.
+//
+// A script registers its extensions by calling these predeclared functions:
+//
+//	subcommand(name, fn)  fn(args) returns entries for the subcommand name
+//	pre_render(fn)        fn(entries) returns the entries to render
+//	post_render(fn)       fn(markdown) returns the markdown to deliver
+//
+// Entries are dicts with the keys of the -export JSON format ("type",
+// "content", "path", "source", "command", "priority"); a plain string
+// stands for a message. Scripts can also call read_file(path) and
+// run(argv...), which returns a command's standard output.
+package script
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+	"github.com/eloquence-cloud/ch/chlib/subcmd"
+	"go.starlark.net/starlark"
+)
+
+// Scripts holds the extensions defined by a set of loaded scripts.
+type Scripts struct {
+	thread      *starlark.Thread
+	subcommands []namedFunc
+	preRender   []starlark.Callable
+	postRender  []starlark.Callable
+}
+
+type namedFunc struct {
+	name string
+	fn   starlark.Callable
+}
+
+// Load executes each script in turn and collects the extensions they
+// define.
+func Load(paths ...string) (*Scripts, error) {
+	s := &Scripts{}
+	s.thread = s.newThread(context.Background())
+	predeclared := starlark.StringDict{
+		"subcommand":  starlark.NewBuiltin("subcommand", s.defineSubcommand),
+		"pre_render":  starlark.NewBuiltin("pre_render", s.addHook(&s.preRender)),
+		"post_render": starlark.NewBuiltin("post_render", s.addHook(&s.postRender)),
+		"read_file":   starlark.NewBuiltin("read_file", readFile),
+		"run":         starlark.NewBuiltin("run", run),
+	}
+	for _, path := range paths {
+		if _, err := starlark.ExecFile(s.thread, path, nil, predeclared); err != nil {
+			return nil, fmt.Errorf("failed to load script %s: %v", path, scriptError(err))
+		}
+	}
+	return s, nil
+}
+
+// contextKey is the thread-local key of the context.Context that run
+// commands are bound to.
+const contextKey = "context"
+
+// newThread returns a thread for running script code on behalf of ctx.
+// Each subcommand call gets its own thread, so that it can be cancelled
+// without affecting later calls.
+func (s *Scripts) newThread(ctx context.Context) *starlark.Thread {
+	thread := &starlark.Thread{
+		Name: "ch",
+		Print: func(_ *starlark.Thread, msg string) {
+			fmt.Fprintln(os.Stderr, msg)
+		},
+	}
+	thread.SetLocal(contextKey, ctx)
+	return thread
+}
+
+func (s *Scripts) defineSubcommand(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var name string
+	var fn starlark.Callable
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 2, &name, &fn); err != nil {
+		return nil, err
+	}
+	s.subcommands = append(s.subcommands, namedFunc{name, fn})
+	return starlark.None, nil
+}
+
+func (s *Scripts) addHook(hooks *[]starlark.Callable) func(*starlark.Thread, *starlark.Builtin, starlark.Tuple, []starlark.Tuple) (starlark.Value, error) {
+	return func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var fn starlark.Callable
+		if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 1, &fn); err != nil {
+			return nil, err
+		}
+		*hooks = append(*hooks, fn)
+		return starlark.None, nil
+	}
+}
+
+// RegisterSubcommands makes the subcommands defined by the scripts
+// available to subcmd.Process.
+func (s *Scripts) RegisterSubcommands() {
+	for _, sub := range s.subcommands {
+		fn := sub.fn
+		subcmd.Register(sub.name, func(ctx context.Context, sc subcmd.Context, args []string) ([]entry.Entry, error) {
+			values := make([]starlark.Value, len(args))
+			for i, arg := range args {
+				values[i] = starlark.String(arg)
+			}
+			thread := s.newThread(ctx)
+			done := make(chan struct{})
+			defer close(done)
+			go func() {
+				select {
+				case <-ctx.Done():
+					thread.Cancel(ctx.Err().Error())
+				case <-done:
+				}
+			}()
+			result, err := starlark.Call(thread, fn, starlark.Tuple{starlark.NewList(values)}, nil)
+			if err != nil {
+				return nil, scriptError(err)
+			}
+			return fromValues(sc.TempDir, result, nil)
+		})
+	}
+}
+
+// PreRender passes entries through each pre_render hook in turn. File
+// contents are stored in tempDir when a hook changes them.
+func (s *Scripts) PreRender(tempDir string, entries []entry.Entry) ([]entry.Entry, error) {
+	for _, hook := range s.preRender {
+		values, originals, err := toValues(entries)
+		if err != nil {
+			return nil, err
+		}
+		result, err := starlark.Call(s.thread, hook, starlark.Tuple{values}, nil)
+		if err != nil {
+			return nil, scriptError(err)
+		}
+		if entries, err = fromValues(tempDir, result, originals); err != nil {
+			return nil, fmt.Errorf("pre_render hook %s: %v", hook.Name(), err)
+		}
+	}
+	return entries, nil
+}
+
+// PostRender passes markdown through each post_render hook in turn.
+func (s *Scripts) PostRender(markdown string) (string, error) {
+	for _, hook := range s.postRender {
+		result, err := starlark.Call(s.thread, hook, starlark.Tuple{starlark.String(markdown)}, nil)
+		if err != nil {
+			return "", scriptError(err)
+		}
+		text, ok := starlark.AsString(result)
+		if !ok {
+			return "", fmt.Errorf("post_render hook %s returned %s, not a string", hook.Name(), result.Type())
+		}
+		markdown = text
+	}
+	return markdown, nil
+}
+
+// HasPostRender reports whether any post_render hooks are defined, in
+// which case the whole markdown must be in hand before it is delivered.
+func (s *Scripts) HasPostRender() bool {
+	return len(s.postRender) > 0
+}
+
+// scriptError includes the Starlark backtrace, which locates the error in
+// the script.
+func scriptError(err error) error {
+	if evalErr, ok := err.(*starlark.EvalError); ok {
+		return fmt.Errorf("%s", evalErr.Backtrace())
+	}
+	return err
+}
+
+func readFile(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var path string
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 1, &path); err != nil {
+		return nil, err
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return starlark.String(content), nil
+}
+
+func run(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if len(args) == 0 || len(kwargs) > 0 {
+		return nil, fmt.Errorf("%s: expected a command and its arguments", b.Name())
+	}
+	argv := make([]string, len(args))
+	for i, arg := range args {
+		s, ok := starlark.AsString(arg)
+		if !ok {
+			return nil, fmt.Errorf("%s: argument %d is %s, not a string", b.Name(), i+1, arg.Type())
+		}
+		argv[i] = s
+	}
+	ctx := thread.Local(contextKey).(context.Context)
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Stderr = os.Stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s %v: %v", b.Name(), argv, err)
+	}
+	return starlark.String(output), nil
+}
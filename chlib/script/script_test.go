@@ -0,0 +1,198 @@
+package script
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+	"github.com/eloquence-cloud/ch/chlib/render"
+	"github.com/eloquence-cloud/ch/chlib/subcmd"
+)
+
+// loadScript writes source to a script file and loads it.
+func loadScript(t *testing.T, source string) *Scripts {
+	path := filepath.Join(t.TempDir(), "hooks.star")
+	if err := os.WriteFile(path, []byte(source), 0644); err != nil {
+		t.Fatalf("Failed to write script: %v", err)
+	}
+	scripts, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	return scripts
+}
+
+func TestSubcommand(t *testing.T) {
+	scripts := loadScript(t, `
+def ticket(args):
+    return ["Ticket " + args[0], {"type": "file", "path": args[0] + ".txt", "content": "details\n"}]
+
+subcommand("ticket", ticket)
+`)
+	scripts.RegisterSubcommands()
+
+	sc, err := subcmd.NewContext()
+	if err != nil {
+		t.Fatalf("Failed to create context: %v", err)
+	}
+	defer sc.Cleanup()
+
+	entries, err := subcmd.Process(context.Background(), sc, []string{"ticket", "--priority", "high", "PROJ-1"})
+	if err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+	expected := "Ticket PROJ-1\n\n`PROJ-1.txt`\n```\ndetails\n```\n"
+	if markdown := render.Markdown(entries, entry.RenderOptions{}); markdown != expected {
+		t.Errorf("Expected markdown: %q\n  Actual markdown: %q", expected, markdown)
+	}
+	if entry.PriorityOf(entries[0]) != entry.PriorityHigh {
+		t.Errorf("Expected --priority to apply to script subcommands, got %v", entry.PriorityOf(entries[0]))
+	}
+}
+
+func TestPreRender(t *testing.T) {
+	dir := t.TempDir()
+	var paths []string
+	for _, name := range []string{"b.go", "a.go", "a_test.go"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("package a\n"), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+		paths = append(paths, path)
+	}
+	entries := []entry.Entry{
+		entry.Message{Text: "Review:"},
+		entry.File{StoragePath: paths[0], OriginalPath: paths[0]},
+		entry.File{StoragePath: paths[1], OriginalPath: paths[1]},
+		entry.File{StoragePath: paths[2], OriginalPath: paths[2]},
+	}
+
+	scripts := loadScript(t, `
+def files_only_sorted(entries):
+    files = [e for e in entries if e["type"] == "file" and not e["path"].endswith("_test.go")]
+    return sorted(files, key = lambda e: e["path"])
+
+def annotate(entries):
+    return ["%d files follow." % len(entries)] + entries
+
+pre_render(files_only_sorted)
+pre_render(annotate)
+`)
+	actual, err := scripts.PreRender(t.TempDir(), entries)
+	if err != nil {
+		t.Fatalf("PreRender failed: %v", err)
+	}
+	expected := []entry.Entry{entry.Message{Text: "2 files follow."}, entries[2], entries[1]}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected entries: %v\n  Actual entries: %v", expected, actual)
+	}
+}
+
+func TestPreRenderChangedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.env")
+	if err := os.WriteFile(path, []byte("TOKEN=abc\n"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	scripts := loadScript(t, `
+def redact(entries):
+    for e in entries:
+        if e["path"].endswith(".env"):
+            e["content"] = "TOKEN=***\n"
+    return entries
+
+pre_render(redact)
+`)
+	actual, err := scripts.PreRender(t.TempDir(), []entry.Entry{entry.File{StoragePath: path, OriginalPath: path}})
+	if err != nil {
+		t.Fatalf("PreRender failed: %v", err)
+	}
+	expected := "`" + path + "`\n```\nTOKEN=***\n```\n"
+	if markdown := render.Markdown(actual, entry.RenderOptions{}); markdown != expected {
+		t.Errorf("Expected markdown: %q\n  Actual markdown: %q", expected, markdown)
+	}
+}
+
+func TestPostRender(t *testing.T) {
+	scripts := loadScript(t, `
+post_render(lambda md: md.replace("TODO", "(to do)"))
+post_render(lambda md: md + "\nEnd of context.\n")
+`)
+	actual, err := scripts.PostRender("TODO: review\n")
+	if err != nil {
+		t.Fatalf("PostRender failed: %v", err)
+	}
+	if expected := "(to do): review\n\nEnd of context.\n"; actual != expected {
+		t.Errorf("Expected markdown: %q\n  Actual markdown: %q", expected, actual)
+	}
+}
+
+func TestScriptErrors(t *testing.T) {
+	testCases := []struct {
+		name        string
+		source      string
+		run         func(*Scripts) error
+		expectedErr string
+	}{
+		{
+			name:        "Syntax error",
+			source:      "def broken(:\n",
+			expectedErr: "failed to load script",
+		},
+		{
+			name:   "Pre-render returns a number",
+			source: "pre_render(lambda entries: 42)\n",
+			run: func(s *Scripts) error {
+				_, err := s.PreRender(os.TempDir(), nil)
+				return err
+			},
+			expectedErr: "expected a list of entries",
+		},
+		{
+			name:   "Unknown entry key",
+			source: "pre_render(lambda entries: [{\"type\": \"message\", \"text\": \"hi\"}])\n",
+			run: func(s *Scripts) error {
+				_, err := s.PreRender(os.TempDir(), nil)
+				return err
+			},
+			expectedErr: "unknown key \"text\"",
+		},
+		{
+			name:   "Post-render returns a list",
+			source: "post_render(lambda md: [md])\n",
+			run: func(s *Scripts) error {
+				_, err := s.PostRender("x")
+				return err
+			},
+			expectedErr: "not a string",
+		},
+		{
+			name:   "Hook fails",
+			source: "def reject(md):\n    fail(\"no markdown today\")\n\npost_render(reject)\n",
+			run: func(s *Scripts) error {
+				_, err := s.PostRender("x")
+				return err
+			},
+			expectedErr: "no markdown today",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "hooks.star")
+			if err := os.WriteFile(path, []byte(tc.source), 0644); err != nil {
+				t.Fatalf("Failed to write script: %v", err)
+			}
+			scripts, err := Load(path)
+			if err == nil && tc.run != nil {
+				err = tc.run(scripts)
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.expectedErr) {
+				t.Errorf("Expected error containing %q, got: %v", tc.expectedErr, err)
+			}
+		})
+	}
+}
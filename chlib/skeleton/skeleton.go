@@ -0,0 +1,120 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+// Package skeleton reduces source files to their declarations, leaving out
+// the bodies of functions, so that a file too large to attach whole can
+// still show a model its structure.
+package skeleton
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"strings"
+)
+
+// elision stands in for the lines a skeleton leaves out.
+const elision = "..."
+
+// Of returns the skeleton of source, the content of the file at path. Go
+// files keep everything but the bodies of functions and methods. Other
+// files, which ch doesn't parse, keep the lines that aren't indented and
+// the indented lines that begin with a declaration keyword (class, def,
+// fn, func, and so on); each run of other lines becomes a single "...".
+func Of(path, source string) string {
+	if filepath.Ext(path) == ".go" {
+		if skeleton, ok := goSkeleton(path, source); ok {
+			return skeleton
+		}
+	}
+	return indentSkeleton(source)
+}
+
+// goSkeleton returns the skeleton of Go source, or false if it doesn't
+// parse.
+func goSkeleton(path, source string) (string, bool) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, path, source, parser.ParseComments|parser.SkipObjectResolution)
+	if err != nil {
+		return "", false
+	}
+	var skeleton strings.Builder
+	last := 0
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Body == nil {
+			continue
+		}
+		lbrace, rbrace := fset.Position(fn.Body.Lbrace).Offset, fset.Position(fn.Body.Rbrace).Offset
+		skeleton.WriteString(source[last:lbrace])
+		skeleton.WriteString("{ " + elision + " }")
+		last = rbrace + 1
+	}
+	skeleton.WriteString(source[last:])
+	return skeleton.String(), true
+}
+
+// declarationKeywords begin the indented lines that indentSkeleton keeps,
+// such as methods in a class.
+var declarationKeywords = []string{
+	"abstract", "async", "class", "def", "enum", "export", "fn", "func",
+	"function", "impl", "interface", "internal", "module", "override",
+	"private", "protected", "pub", "public", "static", "struct", "trait",
+	"type",
+}
+
+// indentSkeleton returns the skeleton of source in a language ch doesn't
+// parse, judging declarations by indentation and keywords.
+func indentSkeleton(source string) string {
+	var kept []string
+	// A run of blank lines is kept as one, unless an elision follows it.
+	eliding, blank := false, false
+	for _, line := range strings.Split(strings.TrimSuffix(source, "\n"), "\n") {
+		trimmed := strings.TrimLeft(line, " \t")
+		switch {
+		case trimmed == "":
+			blank = true
+		case trimmed == line || isDeclaration(trimmed):
+			if blank && len(kept) > 0 {
+				kept = append(kept, "")
+			}
+			kept = append(kept, line)
+			eliding, blank = false, false
+		case !eliding:
+			kept = append(kept, line[:len(line)-len(trimmed)]+elision)
+			eliding, blank = true, false
+		default:
+			blank = false
+		}
+	}
+	return strings.Join(kept, "\n") + "\n"
+}
+
+// isDeclaration reports whether a line, without its indentation, begins
+// with one of declarationKeywords.
+func isDeclaration(line string) bool {
+	word, _, _ := strings.Cut(line, " ")
+	for _, keyword := range declarationKeywords {
+		if word == keyword {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,101 @@
+package skeleton
+
+import "testing"
+
+func TestOf(t *testing.T) {
+	testCases := []struct {
+		name     string
+		path     string
+		source   string
+		expected string
+	}{
+		{
+			name: "Go",
+			path: "server.go",
+			source: `package server
+
+// Server serves requests.
+type Server struct {
+	addr string
+}
+
+// Start starts the server.
+func (s *Server) Start() error {
+	if s.addr == "" {
+		return errEmpty
+	}
+	return nil
+}
+
+func helper() {}
+`,
+			expected: `package server
+
+// Server serves requests.
+type Server struct {
+	addr string
+}
+
+// Start starts the server.
+func (s *Server) Start() error { ... }
+
+func helper() { ... }
+`,
+		},
+		{
+			name:     "Go that doesn't parse",
+			path:     "broken.go",
+			source:   "func broken( {\n\treturn\n}\n",
+			expected: "func broken( {\n\t...\n}\n",
+		},
+		{
+			name: "Python",
+			path: "app.py",
+			source: `import os
+
+class App:
+    """An app."""
+
+    def run(self):
+        for arg in os.args:
+            print(arg)
+
+    async def stop(self):
+        pass
+
+def main():
+
+    App().run()
+`,
+			expected: `import os
+
+class App:
+    ...
+
+    def run(self):
+        ...
+
+    async def stop(self):
+        ...
+
+def main():
+    ...
+`,
+		},
+		{
+			name:     "JavaScript",
+			path:     "app.js",
+			source:   "export function run(args) {\n  const n = args.length;\n  return n;\n}\n",
+			expected: "export function run(args) {\n  ...\n}\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual := Of(tc.path, tc.source)
+			if actual != tc.expected {
+				t.Errorf("Expected %q\n  Actual %q", tc.expected, actual)
+			}
+		})
+	}
+}
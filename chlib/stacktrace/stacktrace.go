@@ -0,0 +1,115 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+// Package stacktrace finds the frames of Go panics, Python tracebacks, and
+// Java stack traces in a command's output or a log, so that the source
+// around each can accompany the crash.
+package stacktrace
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Frame is a stack frame: a line of a source file.
+type Frame struct {
+	// Path is the file's path as the trace gives it. For Java, which gives
+	// only the file's name, it is the path under a source root implied by
+	// the class's package, e.g. com/acme/Orders.java.
+	Path string
+	Line int
+	// Function is the function or method the line is in, if known.
+	Function string
+}
+
+var (
+	goroutineHeader = regexp.MustCompile(`^goroutine \d+ \[.*\]:$`)
+	goFile          = regexp.MustCompile(`^\s+(\S+\.go):(\d+)(?: \+0x[0-9a-f]+)?$`)
+	pythonFile      = regexp.MustCompile(`^\s*File "([^"]+)", line (\d+)(?:, in (.+))?$`)
+	javaFrame       = regexp.MustCompile(`^\s*at (?:[\w.$@-]+/)*([\w$.]+)\.([\w$<>-]+)\(([\w$-]+\.(?:java|kt|scala|groovy)):(\d+)\)`)
+)
+
+// Parse returns the frames in text, in the order they appear, each once.
+// Go frames are recognized only under a goroutine header, as in a panic.
+func Parse(text string) []Frame {
+	var frames []Frame
+	seen := map[Frame]bool{}
+	add := func(frame Frame) {
+		key := Frame{Path: frame.Path, Line: frame.Line}
+		if !seen[key] {
+			seen[key] = true
+			frames = append(frames, frame)
+		}
+	}
+
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	inGoroutine := false
+	for i, line := range lines {
+		switch {
+		case goroutineHeader.MatchString(line):
+			inGoroutine = true
+		case inGoroutine && line == "":
+			inGoroutine = false
+		case inGoroutine:
+			if m := goFile.FindStringSubmatch(line); m != nil {
+				frame := Frame{Path: m[1], Line: atoi(m[2])}
+				if i > 0 {
+					frame.Function = goFunction(lines[i-1])
+				}
+				add(frame)
+			}
+		default:
+			if m := pythonFile.FindStringSubmatch(line); m != nil {
+				add(Frame{Path: m[1], Line: atoi(m[2]), Function: m[3]})
+			} else if m := javaFrame.FindStringSubmatch(line); m != nil {
+				add(Frame{Path: javaPath(m[1], m[3]), Line: atoi(m[4]), Function: m[1] + "." + m[2]})
+			}
+		}
+	}
+	return frames
+}
+
+// goFunction returns the function named by the line before a Go frame's
+// file, e.g. "main.divide" for "main.divide(0x1, 0x0)".
+func goFunction(line string) string {
+	line = strings.TrimPrefix(line, "created by ")
+	if i := strings.LastIndex(line, "("); i > 0 && strings.HasSuffix(line, ")") {
+		line = line[:i]
+	} else if i := strings.Index(line, " in goroutine "); i > 0 {
+		line = line[:i]
+	}
+	return line
+}
+
+// javaPath returns the path of a Java class's source file under a source
+// root, from the class's package, e.g. com/acme/Orders.java for the class
+// com.acme.Orders$Line in Orders.java.
+func javaPath(class, file string) string {
+	i := strings.LastIndex(class, ".")
+	if i < 0 {
+		return file
+	}
+	return strings.ReplaceAll(class[:i], ".", "/") + "/" + file
+}
+
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
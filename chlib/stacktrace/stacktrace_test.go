@@ -0,0 +1,95 @@
+package stacktrace
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		expected []Frame
+	}{
+		{
+			name: "Go panic",
+			text: `panic: runtime error: integer divide by zero
+
+goroutine 1 [running]:
+main.divide(...)
+	/home/dev/calc/main.go:8
+main.main()
+	/home/dev/calc/main.go:12 +0x1d
+exit status 2
+`,
+			expected: []Frame{
+				{Path: "/home/dev/calc/main.go", Line: 8, Function: "main.divide"},
+				{Path: "/home/dev/calc/main.go", Line: 12, Function: "main.main"},
+			},
+		},
+		{
+			name: "Go goroutine created by another",
+			text: `goroutine 7 [running]:
+example.com/calc/worker.(*Pool).run(0xc000010000)
+	/home/dev/calc/worker/pool.go:31 +0x45
+created by example.com/calc/worker.Start in goroutine 1
+	/home/dev/calc/worker/pool.go:19 +0x6a
+
+main.go:3: not a frame
+`,
+			expected: []Frame{
+				{Path: "/home/dev/calc/worker/pool.go", Line: 31, Function: "example.com/calc/worker.(*Pool).run"},
+				{Path: "/home/dev/calc/worker/pool.go", Line: 19, Function: "example.com/calc/worker.Start"},
+			},
+		},
+		{
+			name: "Python traceback",
+			text: `Traceback (most recent call last):
+  File "/home/dev/app/cli.py", line 10, in <module>
+    main()
+  File "app/orders.py", line 6, in main
+    total = sum(o.price for o in orders) / len(orders)
+ZeroDivisionError: division by zero
+`,
+			expected: []Frame{
+				{Path: "/home/dev/app/cli.py", Line: 10, Function: "<module>"},
+				{Path: "app/orders.py", Line: 6, Function: "main"},
+			},
+		},
+		{
+			name: "Java stack trace",
+			text: `Exception in thread "main" java.lang.IllegalStateException: empty order
+	at com.acme.orders.Order$Line.total(Order.java:42)
+	at com.acme.orders.Main.main(Main.java:9)
+	at java.base/java.util.ArrayList.forEach(ArrayList.java:1596)
+	at Script.run(Script.java:3)
+`,
+			expected: []Frame{
+				{Path: "com/acme/orders/Order.java", Line: 42, Function: "com.acme.orders.Order$Line.total"},
+				{Path: "com/acme/orders/Main.java", Line: 9, Function: "com.acme.orders.Main.main"},
+				{Path: "java/util/ArrayList.java", Line: 1596, Function: "java.util.ArrayList.forEach"},
+				{Path: "Script.java", Line: 3, Function: "Script.run"},
+			},
+		},
+		{
+			name: "Repeated frames",
+			text: `  File "loop.py", line 2, in f
+  File "loop.py", line 2, in f
+`,
+			expected: []Frame{{Path: "loop.py", Line: 2, Function: "f"}},
+		},
+		{
+			name: "No trace",
+			text: "ok  \texample.com/calc\t0.002s\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual := Parse(test.text)
+			if !reflect.DeepEqual(actual, test.expected) {
+				t.Errorf("Expected %+v\n  Actual %+v", test.expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,207 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package subcmd
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+)
+
+// maxArchiveFileSize is the size of the largest file that attach takes
+// from an archive; larger ones are skipped as unlikely to be meant for a
+// prompt.
+const maxArchiveFileSize = 1 << 20
+
+// maxArchiveSize limits the total size of the files that attach takes from
+// one archive, so that a large or malicious archive can't fill the disk.
+const maxArchiveSize = 64 << 20
+
+// isArchive reports whether attach treats the file at filePath as an
+// archive of files to attach, by its extension.
+func isArchive(filePath string) bool {
+	name := strings.ToLower(filePath)
+	for _, ext := range []string{".zip", ".tar", ".tar.gz", ".tgz"} {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// archiveFile is a text file read from an archive.
+type archiveFile struct {
+	name    string
+	content []byte
+}
+
+// attachArchive returns the text files in the archive stored at
+// storagePath, in lexical order, each shown as displayPath/name. The files
+// are filtered as a directory walk with opts would filter them: hidden,
+// pruned, excluded, and too-deep files are skipped. So are binary files and
+// files larger than maxArchiveFileSize.
+func attachArchive(sc Context, storagePath, displayPath string, opts walkOptions) ([]entry.Entry, error) {
+	var files []archiveFile
+	var total int64
+	var add archiveFunc = func(name string, size int64, open func() (io.ReadCloser, error)) error {
+		name = path.Clean(strings.TrimPrefix(name, "./"))
+		if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") || opts.skipsArchiveFile(name) {
+			return nil
+		}
+		if size > maxArchiveFileSize {
+			slog.Warn("skipped large file in archive", "archive", displayPath, "file", name, "size", size)
+			return nil
+		}
+		if total += size; total > maxArchiveSize {
+			return Errorf(KindUsage, "archive %s holds more than %s of files to attach", displayPath, entry.FormatSize(maxArchiveSize))
+		}
+		r, err := open()
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		content, err := io.ReadAll(io.LimitReader(r, maxArchiveFileSize+1))
+		if err != nil {
+			return err
+		}
+		if len(content) > maxArchiveFileSize || !utf8.Valid(content) || bytes.IndexByte(content, 0) >= 0 {
+			slog.Debug("skipped binary or large file in archive", "archive", displayPath, "file", name)
+			return nil
+		}
+		files = append(files, archiveFile{name, content})
+		return nil
+	}
+
+	var err error
+	// A remote archive's storagePath is a temporary file without its
+	// extension.
+	if strings.HasSuffix(strings.ToLower(displayPath), ".zip") {
+		err = readZip(storagePath, add)
+	} else {
+		err = readTar(storagePath, add)
+	}
+	if err != nil {
+		var subErr *Error
+		if errors.As(err, &subErr) {
+			return nil, err
+		}
+		return nil, Errorf(KindMissingFile, "failed to read archive %s: %v", displayPath, err)
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].name < files[j].name })
+	entries := []entry.Entry{}
+	for _, file := range files {
+		stored, err := entry.NewStoredFile(sc.TempDir, displayPath+"/"+file.name, file.content)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, stored)
+	}
+	return entries, nil
+}
+
+// skipsArchiveFile reports whether a walk with opts would skip the file at
+// name, a slash-separated path within an archive.
+func (opts walkOptions) skipsArchiveFile(name string) bool {
+	elems := strings.Split(name, "/")
+	if opts.maxDepth >= 0 && len(elems)-1 > opts.maxDepth {
+		return true
+	}
+	for i, elem := range elems[:len(elems)-1] {
+		if opts.isPruned(elem) || opts.skipHidden(elem) || isExcluded(strings.Join(elems[:i+1], "/"), true, opts.excludes) {
+			return true
+		}
+	}
+	return opts.skipHidden(elems[len(elems)-1]) || isExcluded(name, false, opts.excludes)
+}
+
+// archiveFunc is called for each regular file in an archive, with its
+// path in the archive, its size, and a function that opens it.
+type archiveFunc func(name string, size int64, open func() (io.ReadCloser, error)) error
+
+func readZip(storagePath string, add archiveFunc) error {
+	r, err := zip.OpenReader(storagePath)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	for _, f := range r.File {
+		if !f.Mode().IsRegular() {
+			continue
+		}
+		if err := add(f.Name, int64(f.UncompressedSize64), f.Open); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readTar reads a tar archive, which may be gzipped.
+func readTar(storagePath string, add archiveFunc) error {
+	file, err := os.Open(storagePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	var r io.Reader = file
+	// Gzip streams start with 0x1f 0x8b, whatever the file is called.
+	var magic [2]byte
+	if _, err := io.ReadFull(file, magic[:]); err == nil && magic == [2]byte{0x1f, 0x8b} {
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	} else if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		open := func() (io.ReadCloser, error) { return io.NopCloser(tr), nil }
+		if err := add(header.Name, header.Size, open); err != nil {
+			return err
+		}
+	}
+}
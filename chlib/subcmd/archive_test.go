@@ -0,0 +1,139 @@
+package subcmd
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+)
+
+var archiveTestFiles = []struct {
+	name    string
+	content string
+}{
+	{"logs/app.log", "started\n"},
+	{"./README.md", "# Bundle\n"},
+	{"logs/deep/trace.txt", "trace\n"},
+	{".hidden/secret.txt", "secret\n"},
+	{"node_modules/dep/index.js", "module.exports = 1\n"},
+	{"core.bin", "\x00\x01\x02"},
+	{"huge.txt", strings.Repeat("x", maxArchiveFileSize+1)},
+}
+
+func writeTestZip(t *testing.T, archivePath string) {
+	file, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	w := zip.NewWriter(file)
+	for _, f := range archiveTestFiles {
+		fw, err := w.Create(f.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(fw, f.content)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeTestTarGz(t *testing.T, archivePath string) {
+	file, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	gz := gzip.NewWriter(file)
+	w := tar.NewWriter(gz)
+	w.WriteHeader(&tar.Header{Name: "logs/", Typeflag: tar.TypeDir, Mode: 0755})
+	for _, f := range archiveTestFiles {
+		if err := w.WriteHeader(&tar.Header{Name: f.name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(f.content))}); err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(w, f.content)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAttachArchive(t *testing.T) {
+	sc, _, _ := setupTestFiles(t)
+	defer sc.Cleanup()
+	sc.PruneDirs = []string{"node_modules"}
+	zipPath := filepath.Join(sc.TempDir, "bundle.zip")
+	writeTestZip(t, zipPath)
+	tarPath := filepath.Join(sc.TempDir, "bundle.tar.gz")
+	writeTestTarGz(t, tarPath)
+
+	testCases := []struct {
+		name     string
+		args     []string
+		expected map[string]string
+	}{
+		{"zip", []string{zipPath}, map[string]string{
+			zipPath + "/README.md":           "# Bundle\n",
+			zipPath + "/logs/app.log":        "started\n",
+			zipPath + "/logs/deep/trace.txt": "trace\n",
+		}},
+		{"tar.gz", []string{tarPath}, map[string]string{
+			tarPath + "/README.md":           "# Bundle\n",
+			tarPath + "/logs/app.log":        "started\n",
+			tarPath + "/logs/deep/trace.txt": "trace\n",
+		}},
+		{"walk flags", []string{"--max-depth", "1", "--exclude", "*.md", "--hidden", zipPath}, map[string]string{
+			zipPath + "/.hidden/secret.txt": "secret\n",
+			zipPath + "/logs/app.log":       "started\n",
+		}},
+		{"label", []string{"--as", "support", "--exclude", "logs/**", tarPath}, map[string]string{
+			"support/README.md": "# Bundle\n",
+		}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			entries, err := attachSub(context.Background(), sc, tc.args)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			actual := make(map[string]string)
+			var names []string
+			for _, e := range entries {
+				file := e.(entry.File)
+				content, err := os.ReadFile(file.StoragePath)
+				if err != nil {
+					t.Fatal(err)
+				}
+				actual[file.DisplayPath()] = string(content)
+				names = append(names, file.DisplayPath())
+			}
+			if !reflect.DeepEqual(actual, tc.expected) {
+				t.Errorf("Expected files: %q\n  Actual: %q", tc.expected, actual)
+			}
+			if !slices.IsSorted(names) {
+				t.Errorf("Expected files in lexical order, got: %q", names)
+			}
+		})
+	}
+
+	corrupt := filepath.Join(sc.TempDir, "corrupt.zip")
+	if err := os.WriteFile(corrupt, []byte("not a zip"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := attachSub(context.Background(), sc, []string{corrupt}); err == nil {
+		t.Errorf("Expected an error for a corrupt archive")
+	}
+}
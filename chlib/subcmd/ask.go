@@ -0,0 +1,81 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package subcmd
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+)
+
+// AskTemplates are the built-in prompt templates of the ask subcommand, by
+// task. Each is a text/template given the request's .Task and .Details,
+// which is empty if the request gave none. The [ask] table of the config
+// file overrides and adds to them (see Context.AskTemplates).
+var AskTemplates = map[string]string{
+	"review": "Please review the code below as an experienced reviewer would. " +
+		"Look for bugs, including unhandled edge cases and errors; for security problems; and for anything hard to read or maintain. " +
+		"For each problem, name the file and line, say why it matters, and suggest a fix. " +
+		"Put the most important problems first, and say so if you find none." +
+		"{{if .Details}}\n\nIn particular: {{.Details}}{{end}}",
+	"debug": "Please help me debug a problem.{{if .Details}} {{.Details}}{{end}}\n\n" +
+		"Using the code and output below, work out the most likely cause before proposing a fix: " +
+		"say what evidence points to it, what else it could be, and how to confirm it. " +
+		"Then give the smallest change that fixes the cause rather than the symptom.",
+	"refactor": "Please refactor the code below{{if .Details}}: {{.Details}}{{else}} to make it clearer and easier to maintain{{end}}. " +
+		"Keep its behavior exactly the same, including its interfaces and error handling, unless I say otherwise. " +
+		"Explain each change briefly, and give the changed code in full.",
+	"explain": "Please explain the code below{{if .Details}}, focusing on this: {{.Details}}{{end}}. " +
+		"Start with what it is for and how its pieces fit together, then walk through the important parts, pointing out anything subtle or surprising. " +
+		"Assume I know the language but not this codebase.",
+}
+
+// askSub implements "ask task details...": it adds the prompt template for
+// the task, filled in with the details, as a message that -budget keeps.
+func askSub(ctx context.Context, sc Context, args []string) ([]entry.Entry, error) {
+	templates := maps.Clone(AskTemplates)
+	maps.Copy(templates, sc.AskTemplates)
+	var tasks []string
+	for task := range templates {
+		tasks = append(tasks, task)
+	}
+	slices.Sort(tasks)
+	if len(args) == 0 {
+		return nil, Errorf(KindUsage, "ask takes a task (%s) and details, e.g. ask review \"focus on error handling\"", strings.Join(tasks, ", "))
+	}
+	text, ok := templates[args[0]]
+	if !ok {
+		return nil, Errorf(KindUsage, "unknown ask task %q (expected %s)", args[0], strings.Join(tasks, ", "))
+	}
+	tmpl, err := template.New(args[0]).Parse(text)
+	if err != nil {
+		return nil, Errorf(KindUsage, "invalid ask template for %s: %v", args[0], err)
+	}
+	var prompt strings.Builder
+	data := struct{ Task, Details string }{args[0], strings.Join(args[1:], " ")}
+	if err := tmpl.Execute(&prompt, data); err != nil {
+		return nil, Errorf(KindUsage, "invalid ask template for %s: %v", args[0], err)
+	}
+	return []entry.Entry{entry.Prioritized{Entry: entry.Message{Text: prompt.String()}, Priority: entry.PriorityHigh}}, nil
+}
@@ -0,0 +1,49 @@
+package subcmd
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+)
+
+func TestAsk(t *testing.T) {
+	sc := Context{AskTemplates: map[string]string{
+		"security": "Audit {{.Task}}: {{.Details}}",
+		"explain":  "What does this do?",
+		"broken":   "{{.Missing}}",
+	}}
+	testCases := []struct {
+		name     string
+		args     []string
+		expected string
+		err      string
+	}{
+		{name: "built-in with details", args: []string{"review", "focus", "on", "errors"}, expected: "In particular: focus on errors"},
+		{name: "built-in without details", args: []string{"refactor"}, expected: "Please refactor the code below to make it clearer"},
+		{name: "configured task", args: []string{"security", "the login flow"}, expected: "Audit security: the login flow"},
+		{name: "configured override", args: []string{"explain", "ignored"}, expected: "What does this do?"},
+		{name: "unknown task", args: []string{"poem"}, err: "expected broken, debug, explain, refactor, review, security"},
+		{name: "no task", args: nil, err: "ask takes a task"},
+		{name: "failing template", args: []string{"broken"}, err: "invalid ask template for broken"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			entries, err := askSub(context.Background(), sc, tc.args)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Errorf("Expected an error containing %q\n  Actual %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil || len(entries) != 1 {
+				t.Fatalf("Expected one entry\n  Actual %v, %v", entries, err)
+			}
+			message, ok := entry.Unwrap(entries[0]).(entry.Message)
+			if !ok || !strings.Contains(message.Text, tc.expected) || entry.PriorityOf(entries[0]) != entry.PriorityHigh {
+				t.Errorf("Expected a high-priority message containing %q\n  Actual %+v", tc.expected, entries[0])
+			}
+		})
+	}
+}
@@ -0,0 +1,411 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package subcmd
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+)
+
+// DefaultPruneDirs names the directories that directory walks skip without
+// descending into them whatever the project: version control metadata,
+// which is rarely wanted and can be huge. Each is a path.Match pattern for
+// a directory's name. Context.PruneDirs adds to the list, as with the
+// dependencies, build output, and caches of the project types that ch
+// detects, and attach --no-prune turns pruning off.
+var DefaultPruneDirs = []string{".git", ".hg", ".svn"}
+
+// walkOptions controls which files a directory attach includes.
+type walkOptions struct {
+	// maxDepth limits how many levels of subdirectories are descended into.
+	// 0 means only the directory's own files; a negative value means no limit.
+	maxDepth int
+	// excludes are glob patterns matched against paths relative to the
+	// directory being walked. See isExcluded.
+	excludes []string
+	// hidden includes every hidden (dot-named) file and directory.
+	hidden bool
+	// includeHidden lists glob patterns for hidden names (such as ".github")
+	// that are included even when hidden is false.
+	includeHidden []string
+	// prune lists glob patterns for the names of directories that are
+	// skipped whatever the other options say.
+	prune []string
+}
+
+// isPruned reports whether a directory found while walking is one of
+// opts.prune. Directories named explicitly on the command line are never
+// pruned.
+func (opts walkOptions) isPruned(name string) bool {
+	for _, pattern := range opts.prune {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// skipHidden reports whether a dot-named file or directory found while
+// walking should be skipped. Files and directories named explicitly on the
+// command line are never subject to this rule.
+func (opts walkOptions) skipHidden(name string) bool {
+	if !strings.HasPrefix(name, ".") || opts.hidden {
+		return false
+	}
+	for _, pattern := range opts.includeHidden {
+		if ok, _ := path.Match(pattern, name); ok {
+			return false
+		}
+	}
+	return true
+}
+
+// attachFlags are the flags of the attach subcommand.
+type attachFlags struct {
+	maxDepth      *int
+	excludes      *stringList
+	hidden        *bool
+	includeHidden *stringList
+	noPrune       *bool
+	as            *string
+	keepHTML      *bool
+	goPackage     *bool
+	goTests       *bool
+	goDeps        *bool
+	order         *string
+}
+
+func addAttachFlags(flags *flag.FlagSet) attachFlags {
+	f := attachFlags{excludes: &stringList{}, includeHidden: &stringList{}}
+	f.maxDepth = flags.Int("max-depth", -1, "Descend at most `N` levels into directories (0 = top level only, -1 = no limit)")
+	flags.Var(f.excludes, "exclude", "Skip files and directories matching `glob` when walking (repeatable); 'vendor/**' matches by path, '*.min.js' by name")
+	f.hidden = flags.Bool("hidden", false, "Include hidden (dot) files and directories when walking")
+	flags.Var(f.includeHidden, "include-hidden", "Include hidden entries with this `name`, e.g. .github (repeatable)")
+	f.noPrune = flags.Bool("no-prune", false, "Walk into .git, node_modules, vendor, target, and the other directories that are skipped by default")
+	f.as = flags.String("as", "", "Show the file under `label` instead of its path; for a directory, label replaces the directory's path")
+	f.keepHTML = flags.Bool("keep-html", false, "Attach local .html files as they are instead of converting them to markdown")
+	f.goPackage = flags.Bool("go-package", false, "Take the arguments as Go package patterns, such as ./internal/server or ./..., and attach each package's Go source files")
+	f.goTests = flags.Bool("go-tests", false, "With --go-package, attach the packages' test files too")
+	f.goDeps = flags.Bool("go-deps", false, "With --go-package, follow the files with the exported API of each package they import, outside the standard library")
+	f.order = flags.String("order", OrderPath, "Order the files by `order`: path (as named, directories in lexical order) or imports (each after the attached files it imports)")
+	return f
+}
+
+func attachSub(ctx context.Context, sc Context, args []string) ([]entry.Entry, error) {
+	flags := newSubcommandFlags("attach")
+	f := addAttachFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return nil, Errorf(KindUsage, "invalid attach flags: %v", err)
+	}
+	opts := walkOptions{
+		maxDepth:      *f.maxDepth,
+		excludes:      *f.excludes,
+		hidden:        *f.hidden,
+		includeHidden: *f.includeHidden,
+	}
+	if !*f.noPrune {
+		opts.prune = append(append([]string{}, DefaultPruneDirs...), sc.PruneDirs...)
+	}
+	args = flags.Args()
+	if sc.Workspace != "" {
+		args = inWorkspace(sc.Workspace, args, *f.goPackage)
+	}
+	if *f.as != "" && len(args) > 1 {
+		return nil, Errorf(KindUsage, "attach --as takes a single path")
+	}
+	if *f.order != OrderPath && *f.order != OrderImports {
+		return nil, Errorf(KindUsage, "invalid attach --order %q (expected path or imports)", *f.order)
+	}
+	if *f.goPackage {
+		if len(args) == 0 || *f.as != "" {
+			return nil, Errorf(KindUsage, "attach --go-package takes Go package patterns, e.g. attach --go-package ./internal/server, and not --as")
+		}
+		entries, err := attachGoPackages(ctx, args, *f.goTests, *f.goDeps)
+		if err != nil {
+			return nil, err
+		}
+		return orderFiles(labelFiles(entries, "", "", sc.PathAliases), *f.order), nil
+	}
+	if *f.goTests || *f.goDeps {
+		return nil, Errorf(KindUsage, "attach --go-tests and --go-deps need --go-package")
+	}
+
+	entries, err := eachPath(ctx, sc, "attach", args, func(filePath string) ([]entry.Entry, error) {
+		var entries []entry.Entry
+		if strings.Contains(filePath, ":") {
+			parts := strings.SplitN(filePath, ":", 2)
+			if len(parts) == 2 {
+				hostname := parts[0]
+				remotePath := parts[1]
+				tempFile, originalPath, err := copyRemoteFileToTemp(ctx, sc, hostname, remotePath)
+				if err != nil {
+					return nil, fmt.Errorf("failed to copy remote file: %w", err)
+				}
+				if isArchive(remotePath) {
+					archiveEntries, err := attachArchive(sc, tempFile, originalPath, opts)
+					if err != nil {
+						return nil, err
+					}
+					return labelFiles(archiveEntries, filePath, *f.as, sc.PathAliases), nil
+				}
+				entries = append(entries, entry.File{StoragePath: tempFile, OriginalPath: originalPath})
+			} else {
+				return nil, Errorf(KindUsage, "invalid remote file path: %v", filePath)
+			}
+		} else {
+			fileInfo, err := os.Stat(filePath)
+			if os.IsNotExist(err) {
+				return nil, Errorf(KindMissingFile, "file does not exist: %v", filePath)
+			}
+			if err != nil {
+				return nil, Errorf(KindMissingFile, "cannot read file: %v", err)
+			}
+			if fileInfo.IsDir() {
+				var paths []string
+				err := walkDirectory(filePath, opts, func(path string) {
+					paths = append(paths, path)
+				})
+				if err != nil {
+					return nil, Errorf(KindMissingFile, "failed to process directory: %v", err)
+				}
+				for _, path := range paths {
+					if err := checkReadable(path); err != nil {
+						return nil, err
+					}
+					entries = append(entries, entry.File{StoragePath: path, OriginalPath: path})
+				}
+			} else if isArchive(filePath) {
+				archiveEntries, err := attachArchive(sc, filePath, filePath, opts)
+				if err != nil {
+					return nil, err
+				}
+				entries = append(entries, archiveEntries...)
+			} else {
+				if err := checkReadable(filePath); err != nil {
+					return nil, err
+				}
+				entries = append(entries, entry.File{StoragePath: filePath, OriginalPath: filePath})
+			}
+			if !*f.keepHTML {
+				var err error
+				if entries, err = convertHTML(sc, entries); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return labelFiles(entries, filePath, *f.as, sc.PathAliases), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return orderFiles(entries, *f.order), nil
+}
+
+// checkReadable opens the local file at path, so that a file attach can't
+// read, such as one without read permission or a dangling symlink, fails
+// the subcommand when it is attached, rather than being rendered as a note
+// that it couldn't be read. Files other than regular files, such as
+// FIFOs, which opening could block on, are only checked for existence.
+func checkReadable(path string) error {
+	info, err := os.Stat(path)
+	if err == nil && !info.Mode().IsRegular() {
+		return nil
+	}
+	var file *os.File
+	if err == nil {
+		file, err = os.Open(path)
+	}
+	if err != nil {
+		return Errorf(KindMissingFile, "cannot read file: %v", err)
+	}
+	return file.Close()
+}
+
+// inWorkspace resolves attach's arguments in the workspace directory dir:
+// relative paths, and Go package patterns starting with ".", are taken
+// relative to it, and no arguments attach all of it. Absolute and remote
+// paths, and Go import paths, are left as they are.
+func inWorkspace(dir string, args []string, goPackages bool) []string {
+	if len(args) == 0 {
+		args = []string{"."}
+		if goPackages {
+			args = []string{"./..."}
+		}
+	}
+	resolved := make([]string, len(args))
+	for i, arg := range args {
+		switch {
+		case goPackages && strings.HasPrefix(arg, "."):
+			resolved[i] = "./" + filepath.ToSlash(filepath.Join(dir, arg))
+		case goPackages || filepath.IsAbs(arg) || strings.Contains(arg, ":"):
+			resolved[i] = arg
+		default:
+			resolved[i] = filepath.Join(dir, arg)
+		}
+	}
+	return resolved
+}
+
+// orderFiles puts the attached files in the order given to attach --order.
+func orderFiles(entries []entry.Entry, order string) []entry.Entry {
+	if order == OrderImports {
+		return orderByImports(entries)
+	}
+	return entries
+}
+
+// labelFiles sets the labels of the files attached by the argument arg:
+// as, if given, in place of arg, or else the name given by the first of
+// aliases whose prefix matches the file's path.
+func labelFiles(entries []entry.Entry, arg, as string, aliases []PathAlias) []entry.Entry {
+	for i, e := range entries {
+		file, ok := e.(entry.File)
+		if !ok {
+			continue
+		}
+		switch {
+		case as != "" && file.OriginalPath == arg:
+			file.Label = as
+		case as != "":
+			rel, err := filepath.Rel(arg, file.OriginalPath)
+			if err != nil {
+				continue
+			}
+			file.Label = strings.TrimSuffix(as, "/") + "/" + filepath.ToSlash(rel)
+		default:
+			for _, alias := range aliases {
+				if rest, ok := strings.CutPrefix(file.OriginalPath, alias.Prefix); ok {
+					file.Label = alias.Replacement + rest
+					break
+				}
+			}
+		}
+		entries[i] = file
+	}
+	return entries
+}
+
+// ListFiles returns the files that "attach dir" would attach with no
+// flags: those under dir, in lexical order, skipping hidden files and
+// directories, DefaultPruneDirs, and pruneDirs.
+func ListFiles(dir string, pruneDirs []string) ([]string, error) {
+	opts := walkOptions{maxDepth: -1, prune: append(append([]string{}, DefaultPruneDirs...), pruneDirs...)}
+	var files []string
+	err := walkDirectory(dir, opts, func(path string) {
+		files = append(files, path)
+	})
+	return files, err
+}
+
+// walkDirectory calls fn for each file under root that passes opts, in
+// lexical order. Pruned, excluded, and hidden directories, and directories
+// beyond the depth limit, are skipped rather than walked.
+func walkDirectory(root string, opts walkOptions, fn func(path string)) error {
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == root {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if info.IsDir() {
+			if opts.isPruned(info.Name()) {
+				slog.Debug("pruned directory", "path", path)
+				return filepath.SkipDir
+			}
+			depth := strings.Count(rel, "/") + 1
+			if (opts.maxDepth >= 0 && depth > opts.maxDepth) || opts.skipHidden(info.Name()) || isExcluded(rel, true, opts.excludes) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if opts.skipHidden(info.Name()) || isExcluded(rel, false, opts.excludes) {
+			return nil
+		}
+		fn(path)
+		return nil
+	})
+}
+
+// isExcluded reports whether the slash-separated relative path rel matches
+// any of the exclude patterns. A pattern without a slash matches the last
+// element of the path anywhere in the tree (e.g. "*.min.js"); a pattern with
+// a slash is matched against the whole relative path, where "**" matches any
+// number of path elements (e.g. "vendor/**"). A directory is also excluded
+// when a pattern excludes everything beneath it.
+func isExcluded(rel string, isDir bool, patterns []string) bool {
+	for _, pattern := range patterns {
+		pattern = strings.TrimPrefix(pattern, "./")
+		if !strings.Contains(pattern, "/") {
+			if ok, _ := path.Match(pattern, path.Base(rel)); ok {
+				return true
+			}
+			continue
+		}
+		if MatchGlob(pattern, rel) {
+			return true
+		}
+		if isDir && strings.HasSuffix(pattern, "/**") && MatchGlob(strings.TrimSuffix(pattern, "/**"), rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchGlob matches a slash-separated path against a glob pattern in which
+// each element is a path.Match pattern and "**" matches zero or more
+// elements.
+func MatchGlob(pattern, name string) bool {
+	return matchGlobElems(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchGlobElems(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchGlobElems(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
@@ -0,0 +1,402 @@
+package subcmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+)
+
+func TestAttachSub(t *testing.T) {
+	sc, err := NewContext()
+	if err != nil {
+		t.Fatalf("Failed to create context: %v", err)
+	}
+	defer sc.Cleanup()
+
+	// Create temporary files and directories within the context's temporary directory
+	file1Path := filepath.Join(sc.TempDir, "file1.txt")
+	file2Path := filepath.Join(sc.TempDir, "file2.txt")
+	err = os.WriteFile(file1Path, []byte("File 1 content"), 0644)
+	if err != nil {
+		t.Fatalf("Failed to create file1: %v", err)
+	}
+	err = os.WriteFile(file2Path, []byte("File 2 content"), 0644)
+	if err != nil {
+		t.Fatalf("Failed to create file2: %v", err)
+	}
+
+	subDir := filepath.Join(sc.TempDir, "subdir")
+	err = os.Mkdir(subDir, 0755)
+	if err != nil {
+		t.Fatalf("Failed to create subdirectory: %v", err)
+	}
+	file3Path := filepath.Join(subDir, "file3.txt")
+	err = os.WriteFile(file3Path, []byte("File 3 content"), 0644)
+	if err != nil {
+		t.Fatalf("Failed to create file3: %v", err)
+	}
+
+	// Hidden files and directories are skipped by directory walks by default.
+	hiddenFilePath := filepath.Join(sc.TempDir, ".env")
+	err = os.WriteFile(hiddenFilePath, []byte("SECRET=1"), 0644)
+	if err != nil {
+		t.Fatalf("Failed to create hidden file: %v", err)
+	}
+	hiddenDir := filepath.Join(sc.TempDir, ".github")
+	err = os.Mkdir(hiddenDir, 0755)
+	if err != nil {
+		t.Fatalf("Failed to create hidden directory: %v", err)
+	}
+	workflowPath := filepath.Join(hiddenDir, "ci.yml")
+	err = os.WriteFile(workflowPath, []byte("on: push"), 0644)
+	if err != nil {
+		t.Fatalf("Failed to create workflow file: %v", err)
+	}
+
+	// Directories such as .git, and node_modules in a node project, are
+	// pruned from walks by default, even with --hidden.
+	sc.PruneDirs = []string{"node_modules"}
+	gitConfigPath := filepath.Join(sc.TempDir, ".git", "config")
+	modulePath := filepath.Join(sc.TempDir, "node_modules", "left-pad", "index.js")
+	for _, path := range []string{gitConfigPath, modulePath} {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte("pruned"), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+
+	testCases := []struct {
+		name        string
+		args        []string
+		expected    []entry.Entry
+		expectedErr error
+	}{
+		{
+			name:        "Single file",
+			args:        []string{file1Path},
+			expected:    []entry.Entry{entry.File{StoragePath: file1Path, OriginalPath: file1Path}},
+			expectedErr: nil,
+		},
+		{
+			name:        "Multiple files",
+			args:        []string{file1Path, file2Path},
+			expected:    []entry.Entry{entry.File{StoragePath: file1Path, OriginalPath: file1Path}, entry.File{StoragePath: file2Path, OriginalPath: file2Path}},
+			expectedErr: nil,
+		},
+		{
+			name:        "Directory",
+			args:        []string{sc.TempDir},
+			expected:    []entry.Entry{entry.File{StoragePath: file1Path, OriginalPath: file1Path}, entry.File{StoragePath: file2Path, OriginalPath: file2Path}, entry.File{StoragePath: file3Path, OriginalPath: file3Path}},
+			expectedErr: nil,
+		},
+		{
+			name:        "Directory with hidden",
+			args:        []string{"--hidden", "--exclude", "subdir", sc.TempDir},
+			expected:    []entry.Entry{entry.File{StoragePath: hiddenFilePath, OriginalPath: hiddenFilePath}, entry.File{StoragePath: workflowPath, OriginalPath: workflowPath}, entry.File{StoragePath: file1Path, OriginalPath: file1Path}, entry.File{StoragePath: file2Path, OriginalPath: file2Path}},
+			expectedErr: nil,
+		},
+		{
+			name:        "Directory with include-hidden",
+			args:        []string{"--include-hidden", ".github", "--exclude", "subdir", sc.TempDir},
+			expected:    []entry.Entry{entry.File{StoragePath: workflowPath, OriginalPath: workflowPath}, entry.File{StoragePath: file1Path, OriginalPath: file1Path}, entry.File{StoragePath: file2Path, OriginalPath: file2Path}},
+			expectedErr: nil,
+		},
+		{
+			name:        "Hidden directory named directly",
+			args:        []string{hiddenDir},
+			expected:    []entry.Entry{entry.File{StoragePath: workflowPath, OriginalPath: workflowPath}},
+			expectedErr: nil,
+		},
+		{
+			name:        "Directory with no-prune",
+			args:        []string{"--no-prune", "--hidden", "--exclude", "subdir", "--exclude", ".github", "--exclude", ".env", sc.TempDir},
+			expected:    []entry.Entry{entry.File{StoragePath: gitConfigPath, OriginalPath: gitConfigPath}, entry.File{StoragePath: file1Path, OriginalPath: file1Path}, entry.File{StoragePath: file2Path, OriginalPath: file2Path}, entry.File{StoragePath: modulePath, OriginalPath: modulePath}},
+			expectedErr: nil,
+		},
+		{
+			name:        "Pruned directory named directly",
+			args:        []string{filepath.Join(sc.TempDir, "node_modules")},
+			expected:    []entry.Entry{entry.File{StoragePath: modulePath, OriginalPath: modulePath}},
+			expectedErr: nil,
+		},
+		{
+			name:        "Directory with max depth",
+			args:        []string{"--max-depth", "0", sc.TempDir},
+			expected:    []entry.Entry{entry.File{StoragePath: file1Path, OriginalPath: file1Path}, entry.File{StoragePath: file2Path, OriginalPath: file2Path}},
+			expectedErr: nil,
+		},
+		{
+			name:        "Directory with excludes",
+			args:        []string{"--exclude", "subdir/**", "--exclude", "file1.*", sc.TempDir},
+			expected:    []entry.Entry{entry.File{StoragePath: file2Path, OriginalPath: file2Path}},
+			expectedErr: nil,
+		},
+		{
+			name:        "Non-existent file",
+			args:        []string{"nonexistent.txt"},
+			expected:    nil,
+			expectedErr: fmt.Errorf("file does not exist: nonexistent.txt"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			entries, err := attachSub(context.Background(), sc, tc.args)
+			if tc.expectedErr != nil {
+				if err == nil || err.Error() != tc.expectedErr.Error() {
+					t.Errorf("Expected error: %v, got: %v", tc.expectedErr, err)
+				}
+			} else {
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+			}
+			if !reflect.DeepEqual(entries, tc.expected) {
+				t.Errorf("Expected entries: %v, got: %v", tc.expected, entries)
+			}
+		})
+	}
+}
+
+func TestIsExcluded(t *testing.T) {
+	testCases := []struct {
+		rel      string
+		isDir    bool
+		patterns []string
+		expected bool
+	}{
+		{"app.min.js", false, []string{"*.min.js"}, true},
+		{"web/static/app.min.js", false, []string{"*.min.js"}, true},
+		{"web/static/app.js", false, []string{"*.min.js"}, false},
+		{"vendor", true, []string{"vendor/**"}, true},
+		{"vendor/lib/x.go", false, []string{"vendor/**"}, true},
+		{"src/vendor/x.go", false, []string{"vendor/**"}, false},
+		{"src/vendor/x.go", false, []string{"**/vendor/**"}, true},
+		{"docs/a/b/c.md", false, []string{"docs/**/*.md"}, true},
+		{"docs/c.md", false, []string{"./docs/*.md"}, true},
+		{"node_modules", true, []string{"node_modules"}, true},
+		{"main.go", false, nil, false},
+	}
+
+	for _, tc := range testCases {
+		actual := isExcluded(tc.rel, tc.isDir, tc.patterns)
+		if actual != tc.expected {
+			t.Errorf("isExcluded(%q, %v, %q) = %v, expected %v", tc.rel, tc.isDir, tc.patterns, actual, tc.expected)
+		}
+	}
+}
+
+func TestInWorkspace(t *testing.T) {
+	testCases := []struct {
+		args       []string
+		goPackages bool
+		expected   []string
+	}{
+		{nil, false, []string{"services/api"}},
+		{[]string{"main.go", "../shared", "/etc/hosts", "prod:/etc/app.conf"}, false, []string{"services/api/main.go", "services/shared", "/etc/hosts", "prod:/etc/app.conf"}},
+		{nil, true, []string{"./services/api/..."}},
+		{[]string{"./internal/server", "example.com/lib"}, true, []string{"./services/api/internal/server", "example.com/lib"}},
+	}
+
+	for _, tc := range testCases {
+		actual := inWorkspace("services/api", tc.args, tc.goPackages)
+		if !reflect.DeepEqual(actual, tc.expected) {
+			t.Errorf("inWorkspace(%q, %v) = %q, expected %q", tc.args, tc.goPackages, actual, tc.expected)
+		}
+	}
+}
+
+func TestAttachPruneDirs(t *testing.T) {
+	sc, fileWithContentPath, emptyFilePath := setupTestFiles(t)
+	defer sc.Cleanup()
+	distPath := filepath.Join(sc.TempDir, "dist", "bundle.js")
+	if err := os.MkdirAll(filepath.Dir(distPath), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(distPath, []byte("built"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	sc.PruneDirs = []string{"di*"}
+	entries, err := attachSub(context.Background(), sc, []string{sc.TempDir})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []entry.Entry{
+		entry.File{StoragePath: emptyFilePath, OriginalPath: emptyFilePath},
+		entry.File{StoragePath: fileWithContentPath, OriginalPath: fileWithContentPath},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("Expected entries: %v, got: %v", expected, entries)
+	}
+}
+
+func TestAttachLabels(t *testing.T) {
+	sc, fileWithContentPath, emptyFilePath := setupTestFiles(t)
+	defer sc.Cleanup()
+	sc.PathAliases = []PathAlias{{Prefix: sc.TempDir + "/file", Replacement: "project/file"}, {Prefix: sc.TempDir + "/", Replacement: ""}}
+
+	testCases := []struct {
+		name     string
+		args     []string
+		expected []entry.Entry
+	}{
+		{
+			"file with --as",
+			[]string{"--as", "config (prod)", fileWithContentPath},
+			[]entry.Entry{entry.File{StoragePath: fileWithContentPath, OriginalPath: fileWithContentPath, Label: "config (prod)"}},
+		},
+		{
+			"directory with --as",
+			[]string{"--as", "bundle/", sc.TempDir},
+			[]entry.Entry{
+				entry.File{StoragePath: emptyFilePath, OriginalPath: emptyFilePath, Label: "bundle/empty.txt"},
+				entry.File{StoragePath: fileWithContentPath, OriginalPath: fileWithContentPath, Label: "bundle/file.txt"},
+			},
+		},
+		{
+			"aliases",
+			[]string{sc.TempDir},
+			[]entry.Entry{
+				entry.File{StoragePath: emptyFilePath, OriginalPath: emptyFilePath, Label: "empty.txt"},
+				entry.File{StoragePath: fileWithContentPath, OriginalPath: fileWithContentPath, Label: "project/file.txt"},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			entries, err := attachSub(context.Background(), sc, tc.args)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(entries, tc.expected) {
+				t.Errorf("Expected entries: %v, got: %v", tc.expected, entries)
+			}
+		})
+	}
+
+	if _, err := attachSub(context.Background(), sc, []string{"--as", "x", fileWithContentPath, emptyFilePath}); err == nil {
+		t.Errorf("Expected an error for --as with two paths")
+	}
+}
+
+func TestAttachHTML(t *testing.T) {
+	sc, _, _ := setupTestFiles(t)
+	defer sc.Cleanup()
+	pagePath := filepath.Join(sc.TempDir, "page.html")
+	page := "<html><body><h1>Setup</h1><ul><li>Install</li><li>Run</li></ul></body></html>"
+	if err := os.WriteFile(pagePath, []byte(page), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := attachSub(context.Background(), sc, []string{"--as", "docs/page.html", pagePath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, ok := entries[0].(entry.File)
+	if len(entries) != 1 || !ok || file.OriginalPath != pagePath || file.Label != "docs/page.html" || file.Lang != "markdown" {
+		t.Fatalf("Expected a markdown file for %s\n  Actual %v", pagePath, entries)
+	}
+	content, err := os.ReadFile(file.StoragePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "# Setup\n\n- Install\n- Run\n"; string(content) != expected {
+		t.Errorf("Expected %q\n  Actual %q", expected, content)
+	}
+
+	entries, err = attachSub(context.Background(), sc, []string{"--keep-html", pagePath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []entry.Entry{entry.File{StoragePath: pagePath, OriginalPath: pagePath}}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("Expected %v\n  Actual %v", expected, entries)
+	}
+}
+
+func TestListFiles(t *testing.T) {
+	sc, fileWithContentPath, emptyFilePath := setupTestFiles(t)
+	defer sc.Cleanup()
+	for _, path := range []string{".git/config", "dist/bundle.js", ".env"} {
+		path = filepath.Join(sc.TempDir, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte("skipped"), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+
+	files, err := ListFiles(sc.TempDir, []string{"dist"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []string{emptyFilePath, fileWithContentPath}
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("Expected files: %v, got: %v", expected, files)
+	}
+}
+
+func TestAttachUnreadable(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires symlinks")
+	}
+	sc, err := NewContext()
+	if err != nil {
+		t.Fatalf("Failed to create context: %v", err)
+	}
+	defer sc.Cleanup()
+
+	dir := filepath.Join(sc.TempDir, "src")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	dangling := filepath.Join(dir, "dangling.go")
+	if err := os.Symlink(filepath.Join(dir, "gone.go"), dangling); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+	private := filepath.Join(sc.TempDir, "private.txt")
+	if err := os.WriteFile(private, []byte("secret\n"), 0000); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	testCases := []struct {
+		name        string
+		path        string
+		expectedErr string
+	}{
+		{name: "Dangling symlink in a directory", path: dir, expectedErr: "cannot read file: stat " + dangling},
+		{name: "File without read permission", path: private, expectedErr: "cannot read file: open " + private + ": permission denied"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.path == private && os.Geteuid() == 0 {
+				t.Skip("root can read any file")
+			}
+			entries, err := attachSub(context.Background(), sc, []string{tc.path})
+			if err == nil || !strings.HasPrefix(err.Error(), tc.expectedErr) {
+				t.Errorf("Expected error starting with %q\n  Actual %v", tc.expectedErr, err)
+			}
+			if KindOf(err) != KindMissingFile {
+				t.Errorf("Expected a missing-file error\n  Actual %v", KindOf(err))
+			}
+			if entries != nil {
+				t.Errorf("Expected no entries\n  Actual %v", entries)
+			}
+		})
+	}
+}
@@ -0,0 +1,274 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package subcmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+)
+
+// blameRangePattern matches the line range that may end a blame argument:
+// ":100-160", or ":100" for one line.
+var blameRangePattern = regexp.MustCompile(`:(\d+)(?:-(\d+))?$`)
+
+// blameCommit is a commit that last changed lines of a blamed file.
+type blameCommit struct {
+	hash    string
+	author  string
+	time    time.Time
+	summary string
+}
+
+// uncommitted reports whether c stands for changes not yet committed,
+// which git blame gives an all-zero hash.
+func (c *blameCommit) uncommitted() bool {
+	return strings.Trim(c.hash, "0") == ""
+}
+
+// blameLine is a line of a blamed file, with the commit that last changed
+// it.
+type blameLine struct {
+	number int
+	text   string
+	commit *blameCommit
+}
+
+// blameSub implements "blame file[:start-end]...": an excerpt of each file
+// with the commit, author, and age of each line, from git blame, followed
+// by the summaries of those commits.
+func blameSub(ctx context.Context, sc Context, args []string) ([]entry.Entry, error) {
+	flags := newSubcommandFlags("blame")
+	if err := flags.Parse(args); err != nil {
+		return nil, Errorf(KindUsage, "invalid blame flags: %v", err)
+	}
+	if flags.NArg() == 0 {
+		return nil, Errorf(KindUsage, "blame takes one or more files, each with an optional line range, e.g. blame server.go:100-160")
+	}
+	return eachPath(ctx, sc, "blame", flags.Args(), func(arg string) ([]entry.Entry, error) {
+		filePath, start, end, err := parseBlameArg(arg)
+		if err != nil {
+			return nil, err
+		}
+		if info, err := os.Stat(filePath); err != nil {
+			return nil, Errorf(KindMissingFile, "file does not exist: %v", filePath)
+		} else if info.IsDir() {
+			return nil, Errorf(KindUsage, "blame takes files, not directories: %s", filePath)
+		}
+
+		var lineRange []string
+		what := filePath
+		if start > 0 {
+			lineRange = []string{"-L", fmt.Sprintf("%d,%d", start, end)}
+			what = fmt.Sprintf("%s, lines %d-%d", filePath, start, end)
+		}
+		gitArgs := append(append([]string{"blame", "--porcelain"}, lineRange...), "--", filepath.Base(filePath))
+		// Run in the file's directory, so that files of other repositories
+		// can be blamed too.
+		cmd := exec.CommandContext(ctx, "git", gitArgs...)
+		cmd.Dir = filepath.Dir(filePath)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		output, err := cmd.Output()
+		if err != nil {
+			return nil, Errorf(KindExec, "git blame %s failed: %v\n%s", arg, contextError(ctx, err), strings.TrimSpace(stderr.String()))
+		}
+		lines, err := parseBlame(output)
+		if err != nil {
+			return nil, Errorf(KindExec, "failed to read the output of git blame %s: %v", arg, err)
+		}
+		return []entry.Entry{
+			entry.Message{Text: "Blame of " + what + ":"},
+			entry.Output{Output: formatBlame(lines, time.Now()), Command: strings.Join(append(append([]string{"git", "blame"}, lineRange...), "--", filePath), " "), Lang: "text"},
+		}, nil
+	})
+}
+
+// parseBlameArg splits a blame argument into its file and line range. The
+// range is 0, 0 if there is none.
+func parseBlameArg(arg string) (filePath string, start, end int, err error) {
+	match := blameRangePattern.FindStringSubmatchIndex(arg)
+	if match == nil {
+		return arg, 0, 0, nil
+	}
+	filePath = arg[:match[0]]
+	start, _ = strconv.Atoi(arg[match[2]:match[3]])
+	end = start
+	if match[4] >= 0 {
+		end, _ = strconv.Atoi(arg[match[4]:match[5]])
+	}
+	if filePath == "" || start < 1 || end < start {
+		return "", 0, 0, Errorf(KindUsage, "invalid blame line range in %q (expected file:start-end, e.g. server.go:100-160)", arg)
+	}
+	return filePath, start, end, nil
+}
+
+// parseBlame parses the output of git blame --porcelain. Each commit's
+// details are given only with the first line it changed.
+func parseBlame(porcelain []byte) ([]blameLine, error) {
+	commits := map[string]*blameCommit{}
+	var lines []blameLine
+	var current *blameLine
+	scanner := bufio.NewScanner(bytes.NewReader(porcelain))
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if text, ok := strings.CutPrefix(line, "\t"); ok {
+			if current == nil {
+				return nil, fmt.Errorf("line without a header: %q", text)
+			}
+			current.text = text
+			lines = append(lines, *current)
+			current = nil
+			continue
+		}
+		if current == nil {
+			// A header: the commit, the line's number in the commit and
+			// in the file, and the size of the group it starts, if any.
+			fields := strings.Fields(line)
+			if len(fields) < 3 {
+				return nil, fmt.Errorf("invalid header %q", line)
+			}
+			number, err := strconv.Atoi(fields[2])
+			if err != nil {
+				return nil, fmt.Errorf("invalid header %q", line)
+			}
+			commit, ok := commits[fields[0]]
+			if !ok {
+				commit = &blameCommit{hash: fields[0]}
+				commits[fields[0]] = commit
+			}
+			current = &blameLine{number: number, commit: commit}
+			continue
+		}
+		key, value, _ := strings.Cut(line, " ")
+		switch key {
+		case "author":
+			current.commit.author = value
+		case "author-time":
+			if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+				current.commit.time = time.Unix(seconds, 0)
+			}
+		case "summary":
+			current.commit.summary = value
+		}
+	}
+	return lines, scanner.Err()
+}
+
+// formatBlame lays out blamed lines as columns of commit, author, age as of
+// now, line number, and text, followed by the commits, newest first.
+func formatBlame(lines []blameLine, now time.Time) string {
+	var commits []*blameCommit
+	authorWidth, ageWidth, numberWidth := 0, 0, 0
+	for _, line := range lines {
+		if !slices.Contains(commits, line.commit) {
+			commits = append(commits, line.commit)
+		}
+		authorWidth = max(authorWidth, len([]rune(blameAuthor(line.commit))))
+		ageWidth = max(ageWidth, len(blameAge(line.commit, now)))
+		numberWidth = max(numberWidth, len(strconv.Itoa(line.number)))
+	}
+
+	var b strings.Builder
+	for _, line := range lines {
+		author := blameAuthor(line.commit)
+		author += strings.Repeat(" ", authorWidth-len([]rune(author)))
+		fmt.Fprintf(&b, "%s  %s  %-*s  %*d  %s\n", shortHash(line.commit), author, ageWidth, blameAge(line.commit, now), numberWidth, line.number, line.text)
+	}
+
+	sortCommits(commits)
+	b.WriteString("\nCommits:\n")
+	for _, c := range commits {
+		if c.uncommitted() {
+			fmt.Fprintf(&b, "%s  (changes not yet committed)\n", shortHash(c))
+			continue
+		}
+		fmt.Fprintf(&b, "%s  %s  %s  %s\n", shortHash(c), c.time.Format("2006-01-02"), c.author, c.summary)
+	}
+	return b.String()
+}
+
+// sortCommits sorts commits newest first, keeping uncommitted changes, the
+// newest of all, at the top.
+func sortCommits(commits []*blameCommit) {
+	slices.SortStableFunc(commits, func(a, b *blameCommit) int {
+		switch {
+		case a.uncommitted() != b.uncommitted():
+			if a.uncommitted() {
+				return -1
+			}
+			return 1
+		default:
+			return b.time.Compare(a.time)
+		}
+	})
+}
+
+func shortHash(c *blameCommit) string {
+	return c.hash[:min(8, len(c.hash))]
+}
+
+func blameAuthor(c *blameCommit) string {
+	if c.uncommitted() {
+		return "(uncommitted)"
+	}
+	return c.author
+}
+
+// blameAge says how long before now c was made, roughly, e.g. "3 weeks
+// ago".
+func blameAge(c *blameCommit, now time.Time) string {
+	if c.uncommitted() {
+		return "now"
+	}
+	age := now.Sub(c.time)
+	const day = 24 * time.Hour
+	for _, unit := range []struct {
+		name string
+		size time.Duration
+	}{
+		{"year", 365 * day},
+		{"month", 30 * day},
+		{"week", 7 * day},
+		{"day", day},
+		{"hour", time.Hour},
+		{"minute", time.Minute},
+	} {
+		if n := int(age / unit.size); n >= 1 {
+			if n == 1 {
+				return "1 " + unit.name + " ago"
+			}
+			return fmt.Sprintf("%d %ss ago", n, unit.name)
+		}
+	}
+	return "just now"
+}
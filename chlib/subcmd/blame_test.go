@@ -0,0 +1,115 @@
+package subcmd
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+)
+
+func TestParseBlameArg(t *testing.T) {
+	testCases := []struct {
+		arg           string
+		expectedPath  string
+		expectedStart int
+		expectedEnd   int
+		expectedErr   bool
+	}{
+		{"server.go", "server.go", 0, 0, false},
+		{"server.go:100-160", "server.go", 100, 160, false},
+		{"server.go:42", "server.go", 42, 42, false},
+		{"dir:with:colons/a.go:3-4", "dir:with:colons/a.go", 3, 4, false},
+		{"server.go:160-100", "", 0, 0, true},
+		{"server.go:0-10", "", 0, 0, true},
+		{":1-2", "", 0, 0, true},
+	}
+
+	for _, tc := range testCases {
+		path, start, end, err := parseBlameArg(tc.arg)
+		if (err != nil) != tc.expectedErr || path != tc.expectedPath || start != tc.expectedStart || end != tc.expectedEnd {
+			t.Errorf("parseBlameArg(%q) = %q, %d, %d, %v, expected %q, %d, %d (error: %v)", tc.arg, path, start, end, err, tc.expectedPath, tc.expectedStart, tc.expectedEnd, tc.expectedErr)
+		}
+	}
+}
+
+func TestFormatBlame(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	old := &blameCommit{hash: "3f2a9c1d5e6f", author: "Ada Lovelace", time: now.AddDate(-2, 0, 0), summary: "Add the retry loop"}
+	recent := &blameCommit{hash: "b7e41a0922cd", author: "Bo", time: now.Add(-3 * 24 * time.Hour), summary: "Shorten the timeout"}
+	uncommitted := &blameCommit{hash: strings.Repeat("0", 40)}
+	lines := []blameLine{
+		{number: 9, text: "for i := 0; i < 3; i++ {", commit: old},
+		{number: 10, text: "\tctx, cancel := context.WithTimeout(ctx, time.Second)", commit: recent},
+		{number: 11, text: "\tdefer cancel()", commit: uncommitted},
+		{number: 12, text: "}", commit: old},
+	}
+
+	expected := `3f2a9c1d  Ada Lovelace   2 years ago   9  for i := 0; i < 3; i++ {
+b7e41a09  Bo             3 days ago   10  	ctx, cancel := context.WithTimeout(ctx, time.Second)
+00000000  (uncommitted)  now          11  	defer cancel()
+3f2a9c1d  Ada Lovelace   2 years ago  12  }
+
+Commits:
+00000000  (changes not yet committed)
+b7e41a09  2024-05-29  Bo  Shorten the timeout
+3f2a9c1d  2022-06-01  Ada Lovelace  Add the retry loop
+`
+	if actual := formatBlame(lines, now); actual != expected {
+		t.Errorf("Expected:\n%s\n  Actual:\n%s", expected, actual)
+	}
+}
+
+func TestBlameSub(t *testing.T) {
+	repo := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", repo}, args...)...)
+		cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=Ada Lovelace", "GIT_AUTHOR_EMAIL=ada@example.com",
+			"GIT_COMMITTER_NAME=Ada Lovelace", "GIT_COMMITTER_EMAIL=ada@example.com")
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, output)
+		}
+	}
+	filePath := filepath.Join(repo, "main.go")
+	git("init", "--quiet")
+	if err := os.WriteFile(filePath, []byte("package main\n\nfunc main() {\n}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	git("add", "main.go")
+	git("commit", "--quiet", "-m", "Add main")
+	if err := os.WriteFile(filePath, []byte("package main\n\nfunc main() {\n\tpanic(1)\n}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := blameSub(context.Background(), Context{}, []string{filePath + ":3-4"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Expected a label and the blame\n  Actual %v", entries)
+	}
+	if label := entries[0].(entry.Message).Text; label != "Blame of "+filePath+", lines 3-4:" {
+		t.Errorf("Unexpected label %q", label)
+	}
+	output := entries[1].(entry.Output)
+	for _, want := range []string{"Ada Lovelace", "3  func main() {", "(uncommitted)", "4  \tpanic(1)", "Commits:", "Add main"} {
+		if !strings.Contains(output.Output, want) {
+			t.Errorf("Expected the blame to contain %q\n  Actual %s", want, output.Output)
+		}
+	}
+	if strings.Contains(output.Output, "package main") {
+		t.Errorf("Expected only lines 3-4\n  Actual %s", output.Output)
+	}
+	if output.Command != "git blame -L 3,4 -- "+filePath {
+		t.Errorf("Unexpected command %q", output.Command)
+	}
+
+	if _, err := blameSub(context.Background(), Context{}, []string{filepath.Join(repo, "missing.go")}); KindOf(err) != KindMissingFile {
+		t.Errorf("Expected a missing file error, got: %v", err)
+	}
+}
@@ -0,0 +1,203 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package subcmd
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+)
+
+func saySub(ctx context.Context, sc Context, args []string) ([]entry.Entry, error) {
+	message := strings.Join(args, " ")
+	return []entry.Entry{entry.Message{Text: message}}, nil
+}
+
+// langFlags are the flags of the subcommands whose content is fenced by
+// the language it appears to be in: insert and exec.
+type langFlags struct {
+	lang *string
+}
+
+func addLangFlags(flags *flag.FlagSet) langFlags {
+	return langFlags{
+		lang: flags.String("lang", "", "Fence the content as `lang` instead of detecting its language (none leaves it unfenced)"),
+	}
+}
+
+// langOf returns the language to fence content as: the one given with
+// --lang, or else the one it appears to be in.
+func (f langFlags) langOf(content string) string {
+	switch *f.lang {
+	case "":
+		return entry.DetectLanguage(content)
+	case "none":
+		return ""
+	}
+	return *f.lang
+}
+
+// insertFlags are the flags of the insert subcommand.
+type insertFlags struct {
+	langFlags
+	stacktraceFlags
+}
+
+func addInsertFlags(flags *flag.FlagSet) insertFlags {
+	return insertFlags{
+		langFlags:       addLangFlags(flags),
+		stacktraceFlags: addStacktraceFlags(flags),
+	}
+}
+
+func insertSub(ctx context.Context, sc Context, args []string) ([]entry.Entry, error) {
+	flags := newSubcommandFlags("insert")
+	f := addInsertFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return nil, Errorf(KindUsage, "invalid insert flags: %v", err)
+	}
+	if err := f.check("insert"); err != nil {
+		return nil, err
+	}
+	return eachPath(ctx, sc, "insert", flags.Args(), func(filePath string) ([]entry.Entry, error) {
+		content, err := readLocalOrRemote(ctx, sc, filePath)
+		if err != nil {
+			return nil, err
+		}
+		sources, err := f.sources(sc, content)
+		if err != nil {
+			return nil, err
+		}
+		return append([]entry.Entry{entry.Message{Text: content, Source: filePath, Lang: f.langOf(content)}}, sources...), nil
+	})
+}
+
+// execFlags are the flags of the exec subcommand.
+type execFlags struct {
+	langFlags
+	stacktraceFlags
+	parallel *bool
+}
+
+func addExecFlags(flags *flag.FlagSet) execFlags {
+	return execFlags{
+		langFlags:       addLangFlags(flags),
+		stacktraceFlags: addStacktraceFlags(flags),
+		parallel:        flags.Bool("parallel", false, "Run each argument as a separate command line, all at once, labeling each one's output"),
+	}
+}
+
+func execSub(ctx context.Context, sc Context, args []string) ([]entry.Entry, error) {
+	flags := newSubcommandFlags("exec")
+	f := addExecFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return nil, Errorf(KindUsage, "invalid exec flags: %v", err)
+	}
+	args = flags.Args()
+	if len(args) == 0 {
+		return nil, Errorf(KindUsage, "exec takes a command, e.g. exec go test ./...")
+	}
+	if err := f.check("exec"); err != nil {
+		return nil, err
+	}
+	if *f.parallel {
+		return execParallel(ctx, sc, f, args)
+	}
+	return execCommand(ctx, sc, f, args)
+}
+
+// execCommand runs a command and returns its standard output. With
+// --enrich-stacktrace, it returns its standard error too, where crashes
+// are reported, followed by the source of the frames of any stack traces;
+// a command that fails then doesn't fail the subcommand, since its crash is
+// what is wanted.
+func execCommand(ctx context.Context, sc Context, f execFlags, args []string) ([]entry.Entry, error) {
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	var output []byte
+	var err error
+	if *f.enrich {
+		output, err = cmd.CombinedOutput()
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && ctx.Err() == nil {
+			slog.Info("command failed", "command", strings.Join(args, " "), "error", err)
+			err = nil
+		}
+	} else {
+		output, err = cmd.Output()
+	}
+	if err != nil {
+		return []entry.Entry{}, Errorf(KindExec, "command execution failed: %v", contextError(ctx, err))
+	}
+	sources, err := f.sources(sc, string(output))
+	if err != nil {
+		return nil, err
+	}
+	return append([]entry.Entry{entry.Output{Output: string(output), Command: strings.Join(args, " "), Lang: f.langOf(string(output))}}, sources...), nil
+}
+
+// execParallel implements "exec --parallel 'command line'...": it runs the
+// command lines concurrently, then returns their outputs in the order
+// given, each after a message naming its command line. A command that
+// fails fails the subcommand once they have all finished, unless
+// sc.KeepGoing is set.
+func execParallel(ctx context.Context, sc Context, f execFlags, lines []string) ([]entry.Entry, error) {
+	commands := make([][]string, len(lines))
+	for i, line := range lines {
+		words, err := SplitWords(line)
+		if err != nil {
+			return nil, Errorf(KindUsage, "invalid command line %q: %v", line, err)
+		}
+		if len(words) == 0 {
+			return nil, Errorf(KindUsage, "exec --parallel takes command lines, e.g. exec --parallel 'go vet ./...' 'go test ./...'")
+		}
+		commands[i] = words
+	}
+
+	type result struct {
+		entries []entry.Entry
+		err     error
+	}
+	results := make([]result, len(commands))
+	var wg sync.WaitGroup
+	for i, command := range commands {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			entries, err := execCommand(ctx, sc, f, command)
+			label := entry.Message{Text: fmt.Sprintf("Output of `%s`:", lines[i])}
+			results[i] = result{append([]entry.Entry{label}, entries...), err}
+		}()
+	}
+	wg.Wait()
+
+	i := 0
+	return eachPath(ctx, sc, "exec", lines, func(string) ([]entry.Entry, error) {
+		r := results[i]
+		i++
+		return r.entries, r.err
+	})
+}
@@ -0,0 +1,232 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package subcmd
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+)
+
+// conventionalPattern matches the subject of a conventional commit:
+// "type(scope)!: description", where the scope and "!" are optional.
+var conventionalPattern = regexp.MustCompile(`^(\w+)(?:\(([^)]*)\))?(!)?:\s+(.+)$`)
+
+// changelogGroups are the headings that changelog groups conventional
+// commits under, by type, in the order they are listed. Commits of other
+// types are listed last, under "Other changes".
+var changelogGroups = []struct {
+	types   []string
+	heading string
+}{
+	{[]string{"feat", "feature"}, "Features"},
+	{[]string{"fix", "bugfix"}, "Bug fixes"},
+	{[]string{"perf"}, "Performance"},
+	{[]string{"refactor"}, "Refactoring"},
+	{[]string{"revert"}, "Reverts"},
+	{[]string{"docs", "doc"}, "Documentation"},
+	{[]string{"test", "tests"}, "Tests"},
+	{[]string{"build", "deps"}, "Build and dependencies"},
+	{[]string{"ci"}, "Continuous integration"},
+	{[]string{"style"}, "Style"},
+	{[]string{"chore"}, "Chores"},
+}
+
+// changelogCommit is a commit listed by changelog.
+type changelogCommit struct {
+	hash    string
+	subject string
+	body    string
+	// typ, scope, description, and breaking are parsed from a
+	// conventional commit's subject; typ is "" for other commits.
+	typ, scope, description string
+	breaking                bool
+}
+
+// parseChangelogCommit parses a commit's subject as a conventional commit,
+// if it is one. A "BREAKING CHANGE:" footer in the body also marks it as
+// breaking.
+func parseChangelogCommit(hash, subject, body string) changelogCommit {
+	c := changelogCommit{hash: hash, subject: subject, body: body}
+	if match := conventionalPattern.FindStringSubmatch(subject); match != nil {
+		c.typ = strings.ToLower(match[1])
+		c.scope = match[2]
+		c.breaking = match[3] != ""
+		c.description = match[4]
+	}
+	if strings.Contains(body, "BREAKING CHANGE:") || strings.Contains(body, "BREAKING-CHANGE:") {
+		c.breaking = true
+	}
+	return c
+}
+
+// changelogFlags are the flags of the changelog subcommand.
+type changelogFlags struct {
+	noBodies *bool
+	merges   *bool
+}
+
+func addChangelogFlags(flags *flag.FlagSet) changelogFlags {
+	return changelogFlags{
+		noBodies: flags.Bool("no-bodies", false, "List only the commits' subjects, not their bodies"),
+		merges:   flags.Bool("merges", false, "Include merge commits"),
+	}
+}
+
+// changelogSub implements "changelog [range]": the subjects and bodies of
+// the commits in a git revision range, such as v1.2.0..HEAD, grouped by
+// type when they follow the conventional commits format. Without a range,
+// the commits since the latest tag are listed.
+func changelogSub(ctx context.Context, sc Context, args []string) ([]entry.Entry, error) {
+	flags := newSubcommandFlags("changelog")
+	f := addChangelogFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return nil, Errorf(KindUsage, "invalid changelog flags: %v", err)
+	}
+	if flags.NArg() > 1 {
+		return nil, Errorf(KindUsage, "changelog takes one revision range, e.g. changelog v1.2.0..HEAD")
+	}
+	revisions := flags.Arg(0)
+	if revisions == "" {
+		tag, err := runGit(ctx, "describe", "--tags", "--abbrev=0")
+		if err != nil {
+			return nil, Errorf(KindExec, "changelog found no tag to start from; give a revision range, e.g. changelog v1.2.0..HEAD (%v)", err)
+		}
+		revisions = strings.TrimSpace(tag) + "..HEAD"
+	}
+
+	// Fields are separated by a unit separator, and commits by a record
+	// separator, which commit messages don't contain.
+	logArgs := []string{"log", "--format=%h%x1f%s%x1f%b%x1e"}
+	if !*f.merges {
+		logArgs = append(logArgs, "--no-merges")
+	}
+	output, err := runGit(ctx, append(logArgs, revisions, "--")...)
+	if err != nil {
+		return nil, Errorf(KindExec, "git log %s failed: %v", revisions, err)
+	}
+	var commits []changelogCommit
+	for _, record := range strings.Split(output, "\x1e") {
+		fields := strings.SplitN(strings.TrimLeft(record, "\n"), "\x1f", 3)
+		if len(fields) == 3 {
+			commits = append(commits, parseChangelogCommit(fields[0], fields[1], strings.TrimSpace(fields[2])))
+		}
+	}
+
+	if len(commits) == 0 {
+		return []entry.Entry{entry.Message{Text: "There are no commits in " + revisions + "."}}, nil
+	}
+	return []entry.Entry{
+		entry.Message{Text: fmt.Sprintf("Commits in %s (%d):", revisions, len(commits))},
+		entry.Output{Output: formatChangelog(commits, !*f.noBodies), Command: "changelog " + revisions, Lang: "markdown"},
+	}, nil
+}
+
+// runGit runs git with args in the working directory and returns its
+// output, or an error that includes what it wrote to stderr.
+func runGit(ctx context.Context, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("%v: %s", contextError(ctx, err), strings.TrimSpace(stderr.String()))
+	}
+	return string(output), nil
+}
+
+// formatChangelog lists commits, newest first, as markdown. If at least
+// half of them are conventional commits, they are grouped under headings
+// by type, with breaking changes first; otherwise they are listed as they
+// are.
+func formatChangelog(commits []changelogCommit, bodies bool) string {
+	conventional := 0
+	for _, c := range commits {
+		if c.typ != "" {
+			conventional++
+		}
+	}
+	var b strings.Builder
+	if conventional*2 < len(commits) {
+		for _, c := range commits {
+			writeChangelogItem(&b, c, c.subject, bodies)
+		}
+		return b.String()
+	}
+
+	section := func(heading string, include func(c changelogCommit) bool) {
+		first := true
+		for _, c := range commits {
+			if !include(c) {
+				continue
+			}
+			if first {
+				if b.Len() > 0 {
+					b.WriteString("\n")
+				}
+				b.WriteString("## " + heading + "\n\n")
+				first = false
+			}
+			text := c.subject
+			if c.typ != "" {
+				text = c.description
+				if c.scope != "" {
+					text = "**" + c.scope + ":** " + text
+				}
+			}
+			writeChangelogItem(&b, c, text, bodies)
+		}
+	}
+	grouped := map[string]bool{}
+	section("Breaking changes", func(c changelogCommit) bool { return c.breaking })
+	for _, group := range changelogGroups {
+		for _, typ := range group.types {
+			grouped[typ] = true
+		}
+		section(group.heading, func(c changelogCommit) bool {
+			return !c.breaking && slices.Contains(group.types, c.typ)
+		})
+	}
+	section("Other changes", func(c changelogCommit) bool { return !c.breaking && !grouped[c.typ] })
+	return b.String()
+}
+
+// writeChangelogItem writes a commit as a list item: text, its hash, and,
+// with bodies, its body indented beneath.
+func writeChangelogItem(b *strings.Builder, c changelogCommit, text string, bodies bool) {
+	fmt.Fprintf(b, "- %s (%s)\n", text, c.hash)
+	if !bodies || c.body == "" {
+		return
+	}
+	for _, line := range strings.Split(c.body, "\n") {
+		if line = strings.TrimRight(line, " \t"); line == "" {
+			b.WriteString("\n")
+		} else {
+			b.WriteString("  " + line + "\n")
+		}
+	}
+}
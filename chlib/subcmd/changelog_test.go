@@ -0,0 +1,124 @@
+package subcmd
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"regexp"
+	"testing"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+)
+
+func TestFormatChangelog(t *testing.T) {
+	testCases := []struct {
+		name     string
+		commits  []changelogCommit
+		bodies   bool
+		expected string
+	}{
+		{
+			name: "Conventional commits",
+			commits: []changelogCommit{
+				parseChangelogCommit("a1", "fix(api): handle a nil request", "A nil request panicked.\n\nFixes #12."),
+				parseChangelogCommit("b2", "feat: add retries", ""),
+				parseChangelogCommit("c3", "Update the README", ""),
+				parseChangelogCommit("d4", "refactor(db)!: rename Store to Repo", ""),
+				parseChangelogCommit("e5", "feat(cli): add -v", "BREAKING CHANGE: -q is gone"),
+				parseChangelogCommit("f6", "wip: try things", ""),
+			},
+			bodies: true,
+			expected: `## Breaking changes
+
+- **db:** rename Store to Repo (d4)
+- **cli:** add -v (e5)
+  BREAKING CHANGE: -q is gone
+
+## Features
+
+- add retries (b2)
+
+## Bug fixes
+
+- **api:** handle a nil request (a1)
+  A nil request panicked.
+
+  Fixes #12.
+
+## Other changes
+
+- Update the README (c3)
+- try things (f6)
+`,
+		},
+		{
+			name: "Other commits",
+			commits: []changelogCommit{
+				parseChangelogCommit("a1", "Handle a nil request", "A nil request panicked."),
+				parseChangelogCommit("b2", "feat: add retries", ""),
+				parseChangelogCommit("c3", "Update the README", ""),
+			},
+			expected: "- Handle a nil request (a1)\n- feat: add retries (b2)\n- Update the README (c3)\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if actual := formatChangelog(tc.commits, tc.bodies); actual != tc.expected {
+				t.Errorf("Expected:\n%s\n  Actual:\n%s", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestChangelogSub(t *testing.T) {
+	repo := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", repo}, args...)...)
+		cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=ch test", "GIT_AUTHOR_EMAIL=ch@example.com",
+			"GIT_COMMITTER_NAME=ch test", "GIT_COMMITTER_EMAIL=ch@example.com")
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, output)
+		}
+	}
+	git("init", "--quiet")
+	git("commit", "--quiet", "--allow-empty", "-m", "feat: first release")
+	git("tag", "v1.0.0")
+	git("commit", "--quiet", "--allow-empty", "-m", "fix: handle a nil request", "-m", "It panicked.")
+	git("commit", "--quiet", "--allow-empty", "-m", "feat(api): add retries")
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	if err := os.Chdir(repo); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := regexp.MustCompile(`^## Features\n\n- \*\*api:\*\* add retries \(\w+\)\n\n## Bug fixes\n\n- handle a nil request \(\w+\)\n  It panicked.\n$`)
+	for _, args := range [][]string{{"v1.0.0..HEAD"}, nil} {
+		entries, err := changelogSub(context.Background(), Context{}, args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 2 || entries[0].(entry.Message).Text != "Commits in v1.0.0..HEAD (2):" {
+			t.Fatalf("Expected a label and the changelog\n  Actual %v", entries)
+		}
+		if output := entries[1].(entry.Output).Output; !expected.MatchString(output) {
+			t.Errorf("Unexpected changelog for %q:\n%s", args, output)
+		}
+	}
+
+	entries, err := changelogSub(context.Background(), Context{}, []string{"HEAD..HEAD"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].(entry.Message).Text != "There are no commits in HEAD..HEAD." {
+		t.Errorf("Expected a note that there are no commits\n  Actual %v", entries)
+	}
+	if _, err := changelogSub(context.Background(), Context{}, []string{"nosuchtag..HEAD"}); KindOf(err) != KindExec {
+		t.Errorf("Expected git log to fail for an unknown revision, got: %v", err)
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package subcmd
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/exec"
+	"slices"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+)
+
+// ifExistsSub implements "if-exists path... then subcommand...": it runs
+// the subcommand only if every path exists, so that a script shared across
+// projects can attach files that only some of them have.
+func ifExistsSub(ctx context.Context, sc Context, args []string) ([]entry.Entry, error) {
+	return conditional(ctx, sc, "if-exists", args, func(path string) bool {
+		_, err := os.Stat(path)
+		return err == nil
+	})
+}
+
+// ifCmdSub implements "if-cmd program... then subcommand...": it runs the
+// subcommand only if every program is on the PATH.
+func ifCmdSub(ctx context.Context, sc Context, args []string) ([]entry.Entry, error) {
+	return conditional(ctx, sc, "if-cmd", args, func(program string) bool {
+		_, err := exec.LookPath(program)
+		return err == nil
+	})
+}
+
+// conditional runs the subcommand after "then" in args if holds is true of
+// every word before it, and otherwise adds nothing.
+func conditional(ctx context.Context, sc Context, name string, args []string, holds func(string) bool) ([]entry.Entry, error) {
+	then := slices.Index(args, "then")
+	if then < 1 || then == len(args)-1 {
+		return nil, Errorf(KindUsage, "%s takes a condition and a subcommand, e.g. %s go.mod then attach go.mod", name, name)
+	}
+	for _, word := range args[:then] {
+		if !holds(word) {
+			slog.Info("skipped subcommand", "condition", name, "unmet", word)
+			return []entry.Entry{}, nil
+		}
+	}
+	return Execute(ctx, sc, args[then+1:])
+}
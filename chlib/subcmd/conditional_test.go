@@ -0,0 +1,43 @@
+package subcmd
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+)
+
+func TestConditionalSubs(t *testing.T) {
+	sc, filePath, _ := setupTestFiles(t)
+	defer sc.Cleanup()
+	said := []entry.Entry{entry.Message{Text: "yes"}}
+
+	testCases := []struct {
+		name     string
+		fn       Func
+		args     []string
+		expected []entry.Entry
+		wantErr  bool
+	}{
+		{"file exists", ifExistsSub, []string{filePath, "then", "say", "yes"}, said, false},
+		{"file missing", ifExistsSub, []string{filePath, filePath + ".missing", "then", "say", "yes"}, []entry.Entry{}, false},
+		{"program on PATH", ifCmdSub, []string{"sh", "then", "say", "yes"}, said, false},
+		{"program missing", ifCmdSub, []string{"no-such-program-for-ch", "then", "say", "yes"}, []entry.Entry{}, false},
+		{"prefix and priority", ifExistsSub, []string{filePath, "then", "sa", "--priority", "high", "yes"}, entry.WithPriority(said, entry.PriorityHigh), false},
+		{"no then", ifExistsSub, []string{filePath, "say", "yes"}, nil, true},
+		{"no condition", ifExistsSub, []string{"then", "say", "yes"}, nil, true},
+		{"no subcommand", ifCmdSub, []string{"sh", "then"}, nil, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			entries, err := tc.fn(context.Background(), sc, tc.args)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !tc.wantErr && !reflect.DeepEqual(entries, tc.expected) {
+				t.Errorf("Expected %v\n  Actual %v", tc.expected, entries)
+			}
+		})
+	}
+}
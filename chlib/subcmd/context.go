@@ -0,0 +1,109 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+// Package subcmd implements ch's subcommand language: comma-separated
+// subcommands such as "say", "attach", and "exec" that each contribute
+// entries to a document.
+package subcmd
+
+import (
+	"fmt"
+	"os"
+)
+
+// Context represents the runtime context of the ch tool.
+// It encapsulates the temporary directory used for storing temporary files
+// and provides methods for managing the lifecycle of the context. It is
+// passed to subcommands alongside a context.Context, which carries
+// cancellation.
+//
+// The NewContext function should be used to create a new Context instance.
+// The returned Context should be cleaned up using the Cleanup method when
+// it is no longer needed, typically by deferring the call to Cleanup.
+//
+// Example usage:
+//
+//	sc, err := subcmd.NewContext()
+//	if err != nil {
+//	    // Handle error
+//	}
+//	defer sc.Cleanup()
+//
+//	// Use the context for storing temporary files
+//	tempFile, err := os.CreateTemp(sc.TempDir, "example-")
+//	if err != nil {
+//	    // Handle error
+//	}
+//	// Perform operations with the temporary file
+//
+// The temporary directory associated with the Context is automatically
+// created when the Context is created using NewContext and is cleaned up
+// when the Cleanup method is called.
+type Context struct {
+	TempDir string
+
+	// KeepGoing makes a failed subcommand, or a file that can't be read,
+	// produce an entry.Failure instead of failing the whole command line.
+	KeepGoing bool
+
+	// PruneDirs lists more directory names (path.Match patterns) for
+	// directory walks to skip, in addition to DefaultPruneDirs.
+	PruneDirs []string
+
+	// PathAliases rename attached files whose paths start with a prefix,
+	// such as a machine-specific home directory. The first that matches a
+	// file is used.
+	PathAliases []PathAlias
+
+	// AskTemplates override and add to the ask subcommand's prompt
+	// templates (AskTemplates), by task.
+	AskTemplates map[string]string
+
+	// Bundles are the scripts of subcommands, by name, that the bundle
+	// subcommand runs.
+	Bundles map[string]string
+
+	// Workspace, if set, is the directory of the monorepo workspace chosen
+	// with -workspace, relative to the working directory. Attach resolves
+	// relative paths against it, and attaches it when given no paths.
+	Workspace string
+
+	// Network sends the HTTP requests of subcommands that fetch from
+	// services, within the run's rate limits and budget.
+	Network *Network
+}
+
+// PathAlias shows the files whose paths start with Prefix with Replacement
+// in its place.
+type PathAlias struct {
+	Prefix      string
+	Replacement string
+}
+
+func NewContext() (Context, error) {
+	tempDir, err := os.MkdirTemp("", "ch-")
+	if err != nil {
+		return Context{}, fmt.Errorf("failed to create temporary directory: %v", err)
+	}
+	return Context{TempDir: tempDir, Network: NewNetwork(NetworkLimits{}, nil)}, nil
+}
+
+func (ctx *Context) Cleanup() error {
+	return os.RemoveAll(ctx.TempDir)
+}
@@ -0,0 +1,101 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package subcmd
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+)
+
+// Define registers a subcommand with flags of its own, for programs that
+// embed ch to add their own sources, such as an internal ticket system, to
+// the pipeline. Like one added with Register, it replaces the built-in
+// subcommand of the same name and can be invoked by any unambiguous prefix
+// of its name.
+//
+// doc names and documents the subcommand for Docs, and so for ch's help;
+// its Flags are filled in from flags. flags, which may be nil, adds the
+// subcommand's flags to the FlagSet that parses its arguments and returns
+// what collect needs to read them, typically a struct of the pointers the
+// FlagSet's methods return. It is called afresh for each run. collect
+// receives them once the arguments are parsed, with the arguments that
+// follow the flags, and returns the entries to add to the document.
+//
+// For example:
+//
+//	type ticketFlags struct{ comments *bool }
+//
+//	subcmd.Define(subcmd.Doc{Name: "ticket", Args: "id...", Summary: "Quote tickets."},
+//		func(flags *flag.FlagSet) ticketFlags {
+//			return ticketFlags{comments: flags.Bool("comments", false, "Include comments")}
+//		},
+//		func(ctx context.Context, sc subcmd.Context, f ticketFlags, ids []string) ([]entry.Entry, error) {
+//			...
+//		})
+func Define[F any](doc Doc, flags func(*flag.FlagSet) F, collect func(ctx context.Context, sc Context, f F, args []string) ([]entry.Entry, error)) {
+	if doc.Name == "" || strings.ContainsAny(doc.Name, " \t\n,") || strings.HasPrefix(doc.Name, "-") {
+		panic(fmt.Sprintf("subcmd: invalid subcommand name %q", doc.Name))
+	}
+	doc.flags = nil
+	if flags != nil {
+		doc.flags = func(fs *flag.FlagSet) { flags(fs) }
+	}
+	fn := func(ctx context.Context, sc Context, args []string) ([]entry.Entry, error) {
+		fs := newSubcommandFlags(doc.Name)
+		var f F
+		if flags != nil {
+			f = flags(fs)
+		}
+		if err := fs.Parse(args); err != nil {
+			return nil, Errorf(KindUsage, "invalid %s flags: %v", doc.Name, err)
+		}
+		return collect(ctx, sc, f, fs.Args())
+	}
+	Register(doc.Name, fn)
+	definedDocs[doc.Name] = doc
+}
+
+// definedDocs documents the subcommands added with Define, by name.
+var definedDocs = make(map[string]Doc)
+
+// StoreFile stores content in the context's temporary directory and returns
+// a file entry for it, shown as name, for subcommands whose files come from
+// somewhere other than the file system, such as an API. The fence language
+// follows from name's extension, as for an attached file.
+func (ctx *Context) StoreFile(name string, content []byte) (entry.File, error) {
+	file, err := os.CreateTemp(ctx.TempDir, "stored-*"+filepath.Ext(name))
+	if err != nil {
+		return entry.File{}, err
+	}
+	_, err = file.Write(content)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return entry.File{}, fmt.Errorf("failed to store %s: %v", name, err)
+	}
+	return entry.File{StoragePath: file.Name(), OriginalPath: name}, nil
+}
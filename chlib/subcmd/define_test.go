@@ -0,0 +1,99 @@
+package subcmd
+
+import (
+	"context"
+	"flag"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+)
+
+type ticketFlags struct {
+	comments *bool
+}
+
+func TestDefine(t *testing.T) {
+	saved := slices.Clone(subcommands)
+	t.Cleanup(func() {
+		subcommands = saved
+		delete(definedDocs, "ticket")
+	})
+
+	doc := Doc{Name: "ticket", Args: "id...", Summary: "Quote tickets from the tracker."}
+	Define(doc,
+		func(flags *flag.FlagSet) ticketFlags {
+			return ticketFlags{comments: flags.Bool("comments", false, "Include the comments")}
+		},
+		func(ctx context.Context, sc Context, f ticketFlags, ids []string) ([]entry.Entry, error) {
+			var entries []entry.Entry
+			for _, id := range ids {
+				body := "Ticket " + id
+				if *f.comments {
+					body += " with comments"
+				}
+				file, err := sc.StoreFile(id+".md", []byte(body+"\n"))
+				if err != nil {
+					return nil, err
+				}
+				entries = append(entries, file)
+			}
+			return entries, nil
+		})
+
+	sc, err := NewContext()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sc.Cleanup()
+
+	// Flags are parsed afresh for each run, so the second doesn't inherit
+	// --comments from the first.
+	entries, err := Process(context.Background(), sc, []string{"tick", "--comments", "CH-1,", "ticket", "CH-2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var actual []string
+	for _, e := range entries {
+		file := e.(entry.File)
+		content, err := os.ReadFile(file.StoragePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		actual = append(actual, file.OriginalPath+": "+string(content))
+	}
+	expected := []string{"CH-1.md: Ticket CH-1 with comments\n", "CH-2.md: Ticket CH-2\n"}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected %q\n  Actual %q", expected, actual)
+	}
+
+	if _, err := Process(context.Background(), sc, []string{"ticket", "--unknown"}); KindOf(err) != KindUsage || !strings.Contains(err.Error(), "invalid ticket flags") {
+		t.Errorf("Expected a usage error for an unknown flag\n  Actual %v", err)
+	}
+
+	i := slices.IndexFunc(Docs(), func(d Doc) bool { return d.Name == "ticket" })
+	if i < 0 {
+		t.Fatal("Expected ticket in Docs")
+	}
+	expectedDoc := doc
+	expectedDoc.Flags = []FlagDoc{{Name: "comments", Usage: "Include the comments"}}
+	if actual := Docs()[i]; !reflect.DeepEqual(actual.Flags, expectedDoc.Flags) || actual.Summary != doc.Summary || actual.Args != doc.Args {
+		t.Errorf("Expected %+v\n  Actual %+v", expectedDoc, actual)
+	}
+}
+
+func TestDefineInvalidName(t *testing.T) {
+	for _, name := range []string{"", "my ticket", "a,b", "-x"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected a panic for name %q", name)
+				}
+			}()
+			Define(Doc{Name: name}, nil, func(context.Context, Context, struct{}, []string) ([]entry.Entry, error) { return nil, nil })
+		}()
+	}
+}
@@ -0,0 +1,435 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package subcmd
+
+import (
+	"flag"
+	"io"
+)
+
+// Doc documents a subcommand. ch's usage summary, "ch help", and man page
+// are generated from Docs, so that they stay in step as subcommands are
+// added.
+type Doc struct {
+	// Name is the subcommand's name.
+	Name string
+	// Args summarizes its arguments, e.g. "path...".
+	Args string
+	// Summary is a sentence or two for the usage summary.
+	Summary string
+	// Details are further paragraphs for "ch help" and the man page.
+	Details []string
+	// Examples are complete ch command lines that use the subcommand.
+	Examples []string
+	// Flags are the subcommand's own flags.
+	Flags []FlagDoc
+
+	// flags defines the subcommand's flags, for Docs to describe.
+	flags func(*flag.FlagSet)
+}
+
+// FlagDoc documents one flag of a FlagSet.
+type FlagDoc struct {
+	// Name is the flag's name, without dashes.
+	Name string
+	// Arg names the flag's value, or is empty for a boolean flag.
+	Arg string
+	// Usage describes the flag.
+	Usage string
+	// Default is the flag's default value, or empty if it is the zero
+	// value.
+	Default string
+}
+
+// FlagDocs describes the flags that define adds to a FlagSet, in
+// lexical order. As in the flag package, a name in back quotes in a flag's
+// usage names its value.
+func FlagDocs(define func(*flag.FlagSet)) []FlagDoc {
+	flags := flag.NewFlagSet("", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	define(flags)
+	var docs []FlagDoc
+	flags.VisitAll(func(f *flag.Flag) {
+		arg, usage := flag.UnquoteUsage(f)
+		if isBoolFlag(f) {
+			arg = ""
+		}
+		doc := FlagDoc{Name: f.Name, Arg: arg, Usage: usage}
+		switch f.DefValue {
+		case "", "0", "false", "[]":
+		default:
+			doc.Default = f.DefValue
+		}
+		docs = append(docs, doc)
+	})
+	return docs
+}
+
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+var builtinDocs = []Doc{
+	{
+		Name:    "say",
+		Args:    "message",
+		Summary: "Emit a message (replace @<space>).",
+		Details: []string{
+			"The words of the message are joined with single spaces. Quote the message to keep its spacing, or to include a comma at the end of a word.",
+		},
+		Examples: []string{`ch -c say "Please review", attach file1.go, say "Thank you!"`},
+	},
+	{
+		Name:    "ask",
+		Args:    "task [details]",
+		Summary: "Emit a request for a common task (review, debug, refactor, or explain), phrased from a prompt template, with details of what you want worked into it.",
+		Details: []string{
+			"Each task's template is a Go text/template given .Task and .Details (the words after the task, joined with single spaces, or empty). The [ask] table of the config file overrides the built-in templates and adds tasks of its own. The request is kept even if -budget trims other entries.",
+		},
+		Examples: []string{
+			`ch -c ask review "focus on error handling", exec git diff`,
+			`ch -c ask debug "the server hangs on shutdown", attach server.go, exec go test ./...`,
+		},
+	},
+	{
+		Name:    "turn",
+		Args:    "role [text|@file...]",
+		Summary: "Begin a turn of a conversation by role (system, user, or assistant): the subcommands that follow, up to the next turn, add what it said. Words are added as a message, and @file inserts a file, such as a saved reply.",
+		Details: []string{
+			"In markdown each turn is headed by its role. With -format messages, and in the JSON of ch serve, the turns become an array of {role, content} objects, as chat APIs take; entries before the first turn make a user turn. -export keeps each turn as an entry of type turn.",
+		},
+		Examples: []string{`ch -format messages -o chat.json turn user @question.md, attach main.go, turn assistant @reply.md, turn user "That fails with:", exec go test ./...`},
+	},
+	{
+		Name:    "reply",
+		Summary: "Record an AI's response, from the clipboard (--from-clipboard) or a file (--from file), as an assistant turn, so that follow-up prompts carry the conversation so far.",
+		Details: []string{
+			"In ch -i, or a ch daemon session, each reply joins the history the session accumulates: add the next question as a user turn and deliver the whole transcript, e.g. with -format messages. Outside a session, reply --from file is the same as turn assistant @file.",
+		},
+		Examples: []string{`ch -format messages -o chat.json turn user @question.md, reply --from answer.md, turn user "And on Windows?"`},
+		flags:    func(flags *flag.FlagSet) { addReplyFlags(flags) },
+	},
+	{
+		Name:    "attach",
+		Args:    "path...",
+		Summary: "Attach a file or directory of files (replace bare path). Supports remote file paths prefixed with hostname (e.g., host:path/to/file).",
+		Details: []string{
+			"Each file is rendered as a fenced code block headed by its path, with a language chosen from its extension or name. A directory attaches every file beneath it, in lexical order. Each local file is opened as it is attached, so one that can't be read, such as a dangling symlink or a file without read permission, fails attach (or, with -keep-going, leaves a failure in its place) rather than being left out of the output.",
+			"Hidden files and directories are skipped when walking unless included with --hidden or --include-hidden, and directories such as .git and node_modules (see prune_dirs in the config file) are skipped unless --no-prune is given. A hidden or pruned path named directly is always attached.",
+			"A remote path (host:path) is copied with scp.",
+			"A .zip, .tar, .tar.gz, or .tgz file named directly is unpacked: its text files are attached in lexical order as archive/path, filtered as a directory walk would be. Binary files and files over 1 MiB are skipped.",
+			"Local .html and .htm files are converted to markdown, keeping headings, lists, code, links, and tables, unless --keep-html is given.",
+			"With --go-package, the arguments are Go package patterns, resolved with go list in the working directory: exactly the Go files that build each package are attached, without its tests unless --go-tests is given, or other files in its directory. --go-deps follows them with the exported API of each package they import directly, other than the standard library: its declarations without function bodies or unexported fields, each with the first sentence of its doc comment.",
+			"With --order imports, each file follows the attached files it imports, so that the model reads foundational types before the code that uses them; otherwise the order is kept, and files in an import cycle stay in their order. Go imports are resolved by package, using the module path in go.mod; Python, JavaScript, and TypeScript imports, and C and C++ #include \"...\" lines, by path. Imports of files that aren't attached are ignored.",
+			"With ch -workspace, relative paths and Go package patterns are taken relative to the chosen workspace, and attach with no paths attaches all of it.",
+		},
+		Examples: []string{
+			"ch -c attach --max-depth 2 --exclude 'vendor/**' --exclude '*.min.js' .",
+			"ch -c attach remote-host:/path/to/file.txt, say \"Remote file attached.\"",
+			"ch -c attach --go-package --go-deps ./internal/server",
+			"ch -c attach --order imports --exclude '*_test.go' ./internal",
+		},
+		flags: func(flags *flag.FlagSet) { addAttachFlags(flags) },
+	},
+	{
+		Name:    "insert",
+		Args:    "file...",
+		Summary: "Insert the contents of a file (replace @file). Supports remote file paths prefixed with hostname (e.g., host:path/to/file).",
+		Details: []string{
+			"Unlike attach, the contents are inserted as they are, without a code fence, as if they were part of the message. Contents that look like a unified diff, JSON, YAML, or a log are fenced with that language instead, unless --lang says otherwise.",
+			"With --enrich-stacktrace, the source around each frame of the Go panics, Python tracebacks, and Java stack traces in the contents is attached after them, if the frame is in a file of the project (the working directory). Nearby frames share an excerpt; --stacktrace-context sets how many lines either side are included.",
+		},
+		Examples: []string{
+			`ch -c insert remote-host:/path/to/file.txt, say "Contents of remote file:"`,
+			`ch -c insert --enrich-stacktrace crash.log, say "What causes this crash?"`,
+		},
+		flags: func(flags *flag.FlagSet) { addInsertFlags(flags) },
+	},
+	{
+		Name:    "head",
+		Args:    "file...",
+		Summary: "Attach the first lines of each file (10 unless -n says otherwise).",
+		Details: []string{
+			"Only the lines wanted are read, so head and tail suit multi-gigabyte logs that attach would include whole. Remote files (host:path) are read with head or tail over ssh.",
+		},
+		Examples: []string{`ch -c head -n 100 data.csv, say "What does each column mean?"`},
+		flags:    func(flags *flag.FlagSet) { addHeadTailFlags(flags) },
+	},
+	{
+		Name:     "tail",
+		Args:     "file...",
+		Summary:  "Attach the last lines of each file (10 unless -n says otherwise).",
+		Examples: []string{`ch -c tail -n 500 /var/log/app.log, say "Why does the app crash?"`},
+		flags:    func(flags *flag.FlagSet) { addHeadTailFlags(flags) },
+	},
+	{
+		Name:    "ocr",
+		Args:    "image...",
+		Summary: "Add the text in each image, such as a screenshot of an error dialog, extracted with tesseract.",
+		Details: []string{
+			"tesseract must be installed and on PATH. Remote images (host:path) are copied with scp first.",
+		},
+		Examples: []string{`ch -c ocr error-dialog.png, say "What does this error mean?"`},
+		flags:    func(flags *flag.FlagSet) { addOCRFlags(flags) },
+	},
+	{
+		Name:    "email",
+		Args:    "message.eml...",
+		Summary: "Add the sender, recipients, date, subject, and text body of each email, decoded from MIME, as a blockquote.",
+		Details: []string{
+			"The text/plain part is preferred; an HTML-only message is converted to markdown. Attachments are listed by name but not included.",
+		},
+		Examples: []string{`ch -c email message.eml, say "Draft a polite reply declining the meeting."`},
+	},
+	{
+		Name:    "slack",
+		Args:    "permalink...",
+		Summary: "Add the Slack thread each message permalink points into, as a transcript attributing each message to its speaker.",
+		Details: []string{
+			"The token is the slack credential stored with ch auth set slack, or else $SLACK_TOKEN, and needs the channels:history (or groups:history) and users:read scopes. Mentions are shown as @name and links as their label followed by the URL.",
+		},
+		Examples: []string{`ch -c slack https://acme.slack.com/archives/C0123ABCD/p1712345678123456, say "Summarize this incident: timeline, cause, and follow-ups."`},
+	},
+	{
+		Name:    "graphql",
+		Args:    "--endpoint url --query query|@file [--var name=value]...",
+		Summary: "Run a GraphQL query and add the data it returns as pretty-printed JSON, to pull structured data from an API into a prompt.",
+		Details: []string{
+			"Errors returned without data fail the subcommand; errors alongside data are shown with it. Results longer than --max-lines are cut short, and the label says so.",
+			"With --auth name, the credential stored with ch auth set name (or $NAME_TOKEN) is sent as a bearer token.",
+		},
+		Examples: []string{`ch -c graphql --endpoint https://api.github.com/graphql --auth github --query @open-prs.graphql --var owner=acme --var first=20, say "Which of these PRs need review first?"`},
+		flags:    func(flags *flag.FlagSet) { addGraphQLFlags(flags) },
+	},
+	{
+		Name:    "openapi",
+		Args:    "spec...",
+		Summary: "Add a compact summary of each OpenAPI or Swagger document, YAML or JSON: its endpoints with their parameters, request bodies, and responses, and the schemas they use.",
+		Details: []string{
+			"Parameters are grouped by location, with * marking required ones; schemas are shown by name, or inline as {field*: type, ...}. With --paths, only the matching endpoints, and the schemas they refer to, are summarized.",
+			"Remote documents (host:path) are copied with scp first.",
+		},
+		Examples: []string{`ch -c openapi --paths '/orders*' api/openapi.yaml, say "Write a client for the order endpoints."`},
+		flags:    func(flags *flag.FlagSet) { addOpenAPIFlags(flags) },
+	},
+	{
+		Name:    "proto",
+		Args:    "dir|file.proto...",
+		Summary: "Add a compact listing of the services, RPCs, messages, and enums in each .proto file, or in each under a directory, for discussing a gRPC or protobuf API.",
+		Details: []string{
+			"Syntax and import statements are left out and the rest is reformatted consistently. Comments and options are kept unless --no-comments or --no-options is given; an RPC left without options is listed on one line.",
+		},
+		Examples: []string{`ch -c proto --no-options --no-comments api/, say "How should we version the order service?"`},
+		flags:    func(flags *flag.FlagSet) { addProtoFlags(flags) },
+	},
+	{
+		Name:    "tfplan",
+		Args:    "plan.json...",
+		Summary: "Add a summary of each Terraform plan, as written by terraform show -json: the resources it creates, updates, replaces, and destroys, with the attributes that change, in place of megabytes of JSON.",
+		Details: []string{
+			"Updates and replacements list each changed attribute as old → new, marking those that force replacement; creations list the attributes set. Values not known until apply, and sensitive ones, are shown as such. --max-attrs limits the attributes listed per resource.",
+			"Remote plans (host:path) are copied with scp first.",
+		},
+		Examples: []string{`ch -c tfplan --max-attrs 10 plan.json, say "Is anything here risky to apply?"`},
+		flags:    func(flags *flag.FlagSet) { addTFPlanFlags(flags) },
+	},
+	{
+		Name:    "stats",
+		Args:    "[dir...]",
+		Summary: "Add a cloc-style summary of the code in each directory (by default, the working directory): files and lines of code, comments, and blank lines by language, and the largest files, as markdown tables.",
+		Details: []string{
+			"The files counted are those attach would attach from the directory: hidden and pruned directories are skipped, as are files matching --exclude, binary files, and empty files. --top sets how many of the largest files are listed, or 0 for none. A line with both code and a comment counts as code.",
+		},
+		Examples: []string{`ch -c say "Where should we start splitting this service up?", stats --exclude '*_test.go' internal/`},
+		flags:    func(flags *flag.FlagSet) { addStatsFlags(flags) },
+	},
+	{
+		Name:    "quote",
+		Args:    "text | file",
+		Summary: "Add text, or the contents of a file, as a blockquote, to set quoted requirements or earlier answers apart from your own words.",
+		Details: []string{
+			"A single argument that names an existing file is quoted as a file; anything else is quoted as text.",
+		},
+		Examples: []string{`ch -c say "You suggested:", quote answer.md, say "but that deadlocks. Why?"`},
+	},
+	{
+		Name:     "heading",
+		Args:     "[level] text",
+		Summary:  "Add a markdown heading, at level 2 unless a level from 1 to 6 is given.",
+		Examples: []string{`ch -c heading 2 "Server logs", exec journalctl -n 50, hr, heading 2 Question, say "Why does it restart?"`},
+	},
+	{
+		Name:    "hr",
+		Summary: "Add a horizontal rule.",
+	},
+	{
+		Name:     "list",
+		Args:     "item...",
+		Summary:  "Add a bulleted list of the items, or a numbered one with --numbered.",
+		Examples: []string{`ch -c say "Requirements:", list --numbered "Keep the API" "Add retries" "Log failures", attach client.go`},
+		flags:    func(flags *flag.FlagSet) { addListFlags(flags) },
+	},
+	{
+		Name:    "exec",
+		Args:    "command [arg...]",
+		Summary: "Execute a command (pass command line to bash).",
+		Details: []string{
+			"The command's standard output is added in a code block headed by the command line. A command that fails fails the whole run unless -keep-going is given.",
+			"Output that looks like a unified diff, JSON, YAML, or a log is fenced with that language; --lang names the language instead.",
+			"With --parallel, each argument is a whole command line, split into words as a shell would but not run by one. The commands run at once, and their outputs are added in the order given, each labeled with its command line.",
+			"With --enrich-stacktrace, standard error is added too, a command that fails doesn't fail the run, and the output is followed by the source around each in-project frame of its stack traces, as for insert, making a self-contained crash report.",
+		},
+		Examples: []string{
+			`ch -c exec "ls -l", say "Directory listing:", attach .`,
+			`ch -c exec --lang toml cat Cargo.lock, say "Which crates are duplicated?"`,
+			`ch -c exec --parallel 'go vet ./...' 'go test ./...' 'golangci-lint run', say "Fix these."`,
+			`ch -c exec --enrich-stacktrace go run ./cmd/server, say "Why does it panic?"`,
+		},
+		flags: func(flags *flag.FlagSet) { addExecFlags(flags) },
+	},
+	{
+		Name:    "paste",
+		Summary: "Insert the contents of the clipboard, or attach the files on it if they were copied in a file manager.",
+		Details: []string{
+			"Files copied in Finder, Explorer, or a Linux file manager such as Nautilus, Dolphin, or Thunar are attached as attach would attach them, directories included; --text inserts the clipboard's text instead. On Linux, reading copied files needs wl-paste (Wayland) or xclip (X11).",
+		},
+		Examples: []string{`ch -c paste, say "Why do these differ?"`},
+		flags:    func(flags *flag.FlagSet) { addPasteFlags(flags) },
+	},
+	{
+		Name:    "import",
+		Args:    "file...",
+		Summary: "Add the entries saved by -export (- reads stdin).",
+		Details: []string{
+			"Imported entries carry their content with them, so the files they came from need not exist any more.",
+		},
+		Examples: []string{`ch -c import overview.json, say "Why does this test fail?", exec go test ./...`},
+	},
+	{
+		Name:    "rdiff",
+		Args:    "old new",
+		Summary: "Add a unified diff of two files; either may be remote (host:/path), e.g. rdiff host:/etc/nginx.conf ./nginx.conf.",
+		Details: []string{
+			"Remote files are copied with scp. It is meant for comparing a deployed file with its copy in the repository.",
+		},
+		Examples: []string{
+			`ch -c say "Why does prod differ?", rdiff prod:/etc/nginx/nginx.conf ./nginx.conf`,
+			`ch -c say "Review my edits:", rdiff --word-diff draft.md.orig draft.md`,
+		},
+		flags: func(flags *flag.FlagSet) { addRdiffFlags(flags) },
+	},
+	{
+		Name:    "blame",
+		Args:    "file[:start-end]...",
+		Summary: "Add an excerpt of a file with the commit, author, and age of each line, from git blame, followed by those commits' dates and summaries, for asking who changed code and why it might have broken.",
+		Details: []string{
+			"Without a line range, the whole file is blamed; file:100 blames a single line. git runs in the file's directory, so files of other repositories can be blamed too. Lines not yet committed are marked as such.",
+		},
+		Examples: []string{`ch -c say "This started failing last week. Which change could have caused it?", blame server.go:100-160, exec go test ./...`},
+	},
+	{
+		Name:    "changelog",
+		Args:    "[range]",
+		Summary: "Add the subjects and bodies of the commits in a git revision range, such as v1.2.0..HEAD, as input for drafting release notes. Without a range, the commits since the latest tag are listed.",
+		Details: []string{
+			"When at least half of the commits follow the conventional commits format (type(scope): description), they are grouped by type under headings such as Features and Bug fixes, with breaking changes (type!: or a BREAKING CHANGE: footer) first; otherwise they are listed newest first. Merge commits are left out unless --merges is given, and bodies with --no-bodies.",
+		},
+		Examples: []string{`ch -c say "Draft release notes for v1.3.0 from these commits:", changelog v1.2.0..HEAD`},
+		flags:    func(flags *flag.FlagSet) { addChangelogFlags(flags) },
+	},
+	{
+		Name:    "load",
+		Args:    "script...",
+		Summary: "Run the subcommands in a script file, one per line.",
+		Details: []string{
+			"Blank lines and lines starting with # are skipped. Each line is split into words as a shell would split it, with quotes and backslashes but no expansion, and may hold several comma-separated subcommands.",
+			"Paths in a script are relative to the working directory, not to the script, so one script can be shared by several projects. Use if-exists and if-cmd for the parts that only apply to some of them.",
+		},
+		Examples: []string{`ch -c load ~/prompts/review.ch, say "Focus on error handling."`},
+	},
+	{
+		Name:    "bundle",
+		Args:    "name",
+		Summary: "Run a named bundle: the subcommands, one per line as in a script file, that a [bundles.name] table of the config file or of the project's .ch.toml gives.",
+		Details: []string{
+			"A bundle codifies the context a kind of question needs, such as a tree, key files, recent logs, and a diff. ch bundle name runs one by itself, within the bundle's budget.",
+		},
+		Examples: []string{`ch -c bundle api-debug, say "Why does /users return 500?"`},
+	},
+	{
+		Name:     "if-exists",
+		Args:     "path... then subcommand",
+		Summary:  "Run the subcommand only if every path exists; otherwise add nothing.",
+		Examples: []string{"ch -c if-exists go.mod then attach go.mod, if-exists Cargo.toml then attach Cargo.toml"},
+	},
+	{
+		Name:     "if-cmd",
+		Args:     "program... then subcommand",
+		Summary:  "Run the subcommand only if every program is on the PATH; otherwise add nothing.",
+		Examples: []string{"ch -c if-cmd go then exec go env GOVERSION"},
+	},
+	{
+		Name:    "foreach",
+		Args:    "pattern subcommand, ...",
+		Summary: "Run the subcommands that follow, up to end or the end of the line, once for each path matching the glob pattern, with {} replaced by the path.",
+		Details: []string{
+			"Quote the pattern so the shell leaves it to ch. Besides *, ?, and [...], the pattern may use ** to match any number of directories, in which case hidden and pruned directories are skipped as attach skips them.",
+			"A subcommand consisting of just end closes the foreach, so that the subcommands after it run once. In a script file, a foreach ends with its line. Within a nested foreach, {} is the nested foreach's path, except in its pattern.",
+		},
+		Examples: []string{
+			`ch -c foreach 'cmd/*/main.go' say "Entry point: {}", attach {}`,
+			`ch -c foreach 'docs/**/*.md' say "From {}:", insert {}, end, say "Which of these are out of date?"`,
+		},
+	},
+	{
+		Name:    "wrap",
+		Args:    "tag subcommand, ...",
+		Summary: "Surround the entries of the subcommands that follow, up to end or the end of the line, with <tag> and </tag>, to label a group of context.",
+		Details: []string{
+			"The tags are kept even if -budget drops what they enclose. In a script file, a wrap ends with its line.",
+		},
+		Examples: []string{`ch -c wrap logs exec journalctl -u app -n 100, attach /var/log/app.log, end, say "Why does the app restart?"`},
+	},
+}
+
+// Docs documents the subcommands, in the order they are listed in help.
+// A subcommand added with Define has the documentation given there. One
+// added with Register that replaces a built-in one keeps its
+// documentation; any other is documented by name only.
+func Docs() []Doc {
+	var docs []Doc
+	for _, sub := range subcommands {
+		doc := Doc{Name: sub.name}
+		for _, builtin := range builtinDocs {
+			if builtin.Name == sub.name {
+				doc = builtin
+			}
+		}
+		if defined, ok := definedDocs[sub.name]; ok {
+			doc = defined
+		}
+		if doc.flags != nil {
+			doc.Flags = FlagDocs(doc.flags)
+		}
+		docs = append(docs, doc)
+	}
+	return docs
+}
@@ -0,0 +1,38 @@
+package subcmd
+
+import (
+	"flag"
+	"reflect"
+	"testing"
+)
+
+func TestDocs(t *testing.T) {
+	docs := Docs()
+	if len(docs) != len(subcommands) {
+		t.Fatalf("Expected a doc for each of %d subcommands\n  Actual: %d", len(subcommands), len(docs))
+	}
+	for _, doc := range docs {
+		if doc.Summary == "" {
+			t.Errorf("Expected a summary for %s", doc.Name)
+		}
+	}
+}
+
+func TestFlagDocs(t *testing.T) {
+	actual := FlagDocs(func(flags *flag.FlagSet) {
+		flags.Int("depth", -1, "Descend at most `N` levels")
+		flags.Bool("hidden", false, "Include hidden files")
+		var list stringList
+		flags.Var(&list, "exclude", "Skip `glob`")
+		flags.String("name", "", "Use `name`")
+	})
+	expected := []FlagDoc{
+		{Name: "depth", Arg: "N", Usage: "Descend at most N levels", Default: "-1"},
+		{Name: "exclude", Arg: "glob", Usage: "Skip glob"},
+		{Name: "hidden", Usage: "Include hidden files"},
+		{Name: "name", Arg: "name", Usage: "Use name"},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected: %+v\n  Actual: %+v", expected, actual)
+	}
+}
@@ -0,0 +1,184 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package subcmd
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+	"github.com/eloquence-cloud/ch/chlib/htmlmd"
+)
+
+// emailHeaders are the headers that email shows, in order.
+var emailHeaders = []string{"From", "To", "Cc", "Date", "Subject"}
+
+// emailSub implements "email message.eml...": it adds each message's
+// sender, recipients, date, subject, and text body, decoded from MIME, as a
+// blockquote, ready for a "draft a reply to this" prompt.
+func emailSub(ctx context.Context, sc Context, args []string) ([]entry.Entry, error) {
+	if len(args) == 0 {
+		return nil, Errorf(KindUsage, "email takes one or more messages, e.g. email message.eml")
+	}
+	return eachPath(ctx, sc, "email", args, func(filePath string) ([]entry.Entry, error) {
+		content, err := readLocalOrRemote(ctx, sc, filePath)
+		if err != nil {
+			return nil, err
+		}
+		text, err := formatEmail(strings.NewReader(content))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse email %s: %v", filePath, err)
+		}
+		return []entry.Entry{entry.Message{Text: blockquote(text), Source: filePath}}, nil
+	})
+}
+
+// formatEmail returns the headers and text body of the message read from
+// r, followed by the names of any attachments.
+func formatEmail(r io.Reader) (string, error) {
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		return "", err
+	}
+	var decoder mime.WordDecoder
+	var text strings.Builder
+	for _, name := range emailHeaders {
+		value := msg.Header.Get(name)
+		if value == "" {
+			continue
+		}
+		if decoded, err := decoder.DecodeHeader(value); err == nil {
+			value = decoded
+		}
+		fmt.Fprintf(&text, "%s: %s\n", name, value)
+	}
+
+	var body emailBody
+	if err := body.read(msg.Header, msg.Body); err != nil {
+		return "", err
+	}
+	text.WriteString("\n")
+	switch {
+	case body.plain != "":
+		text.WriteString(body.plain)
+	case body.html != "":
+		text.WriteString(htmlmd.Convert(body.html))
+	default:
+		text.WriteString("(no text body)")
+	}
+	if len(body.attachments) > 0 {
+		fmt.Fprintf(&text, "\n\nAttachments: %s", strings.Join(body.attachments, ", "))
+	}
+	return strings.TrimSpace(text.String()), nil
+}
+
+// emailBody collects the parts of a message worth showing: the first
+// text/plain and text/html parts, and the names of the attachments.
+type emailBody struct {
+	plain, html string
+	attachments []string
+}
+
+// mimeHeader is what emailBody reads from the header of a message or of
+// one of its parts.
+type mimeHeader interface {
+	Get(key string) string
+}
+
+// read reads a message or part with the given header and body, descending
+// into multipart bodies.
+func (b *emailBody) read(h mimeHeader, body io.Reader) error {
+	mediaType, params, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", nil
+	}
+	disposition, dispositionParams, _ := mime.ParseMediaType(h.Get("Content-Disposition"))
+	if disposition == "attachment" {
+		name := dispositionParams["filename"]
+		if name == "" {
+			name = params["name"]
+		}
+		if name == "" {
+			name = mediaType
+		}
+		b.attachments = append(b.attachments, name)
+		return nil
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := b.read(part.Header, part); err != nil {
+				return err
+			}
+		}
+	}
+
+	if mediaType != "text/plain" && mediaType != "text/html" {
+		return nil
+	}
+	// multipart.Reader decodes quoted-printable parts itself.
+	switch strings.ToLower(h.Get("Content-Transfer-Encoding")) {
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	text := strings.TrimSpace(strings.ReplaceAll(decodeCharset(data, params["charset"]), "\r\n", "\n"))
+	if mediaType == "text/plain" && b.plain == "" {
+		b.plain = text
+	} else if mediaType == "text/html" && b.html == "" {
+		b.html = text
+	}
+	return nil
+}
+
+// decodeCharset converts text in charset to UTF-8. Latin-1 and its
+// Windows variant are converted byte by byte; anything else is taken to
+// be UTF-8 already.
+func decodeCharset(data []byte, charset string) string {
+	switch strings.ToLower(charset) {
+	case "iso-8859-1", "latin1", "windows-1252":
+		runes := make([]rune, len(data))
+		for i, c := range data {
+			runes[i] = rune(c)
+		}
+		return string(runes)
+	}
+	return string(data)
+}
@@ -0,0 +1,91 @@
+package subcmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+)
+
+func TestEmailSub(t *testing.T) {
+	sc, _, _ := setupTestFiles(t)
+	defer sc.Cleanup()
+
+	testCases := []struct {
+		name     string
+		message  string
+		expected string
+	}{
+		{
+			"multipart with quoted-printable and attachment",
+			strings.Join([]string{
+				"From: =?UTF-8?Q?Ren=C3=A9e?= <renee@example.com>",
+				"To: team@example.com",
+				"Date: Mon, 6 May 2024 09:30:00 +0200",
+				"Subject: =?UTF-8?B?UXVhcnRlcmx5IHBsYW4=?=",
+				"MIME-Version: 1.0",
+				`Content-Type: multipart/mixed; boundary="outer"`,
+				"",
+				"--outer",
+				`Content-Type: multipart/alternative; boundary="inner"`,
+				"",
+				"--inner",
+				"Content-Type: text/plain; charset=utf-8",
+				"Content-Transfer-Encoding: quoted-printable",
+				"",
+				"Can we meet on Thursday? The caf=C3=A9 is fine, or the office if it's a lo=",
+				"ng one.",
+				"--inner",
+				"Content-Type: text/html",
+				"",
+				"<p>ignored</p>",
+				"--inner--",
+				"--outer",
+				`Content-Type: application/pdf; name="plan.pdf"`,
+				"Content-Disposition: attachment; filename=plan.pdf",
+				"Content-Transfer-Encoding: base64",
+				"",
+				"JVBERi0=",
+				"--outer--",
+				"",
+			}, "\r\n"),
+			"> From: Renée <renee@example.com>\n> To: team@example.com\n> Date: Mon, 6 May 2024 09:30:00 +0200\n> Subject: Quarterly plan\n>\n" +
+				"> Can we meet on Thursday? The café is fine, or the office if it's a long one.\n>\n> Attachments: plan.pdf",
+		},
+		{
+			"HTML only, base64, Latin-1",
+			"From: ops@example.com\nSubject: Alert\nContent-Type: text/html; charset=iso-8859-1\nContent-Transfer-Encoding: base64\n\n" +
+				"PGgxPkRpc2sgZnVsbDwvaDE+PHA+T24gZGIxLi4uIHNlcnZlciDp\n",
+			"> From: ops@example.com\n> Subject: Alert\n>\n> # Disk full\n>\n> On db1... server é",
+		},
+		{
+			"no body",
+			"Subject: Empty\n\n",
+			"> Subject: Empty\n>\n> (no text body)",
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(sc.TempDir, "message"+string(rune('a'+i))+".eml")
+			if err := os.WriteFile(path, []byte(tc.message), 0644); err != nil {
+				t.Fatal(err)
+			}
+			entries, err := emailSub(context.Background(), sc, []string{path})
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := []entry.Entry{entry.Message{Text: tc.expected, Source: path}}
+			if !reflect.DeepEqual(entries, expected) {
+				t.Errorf("Expected %q\n  Actual %q", expected, entries)
+			}
+		})
+	}
+
+	if _, err := emailSub(context.Background(), sc, nil); err == nil {
+		t.Error("Expected an error without messages")
+	}
+}
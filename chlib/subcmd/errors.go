@@ -0,0 +1,92 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package subcmd
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrorKind classifies an error, so that programs (and ch's exit status)
+// can tell what went wrong without parsing its message.
+type ErrorKind int
+
+const (
+	// KindOther is any error not covered by another kind.
+	KindOther ErrorKind = iota
+	// KindUsage is a malformed command line: an unknown subcommand, or
+	// invalid flags or arguments.
+	KindUsage
+	// KindMissingFile is a local file that doesn't exist or can't be read.
+	KindMissingFile
+	// KindRemote is a failure to copy a file from another host or to fetch
+	// content from a service such as Slack.
+	KindRemote
+	// KindExec is a command or plugin that failed.
+	KindExec
+	// KindOutput is output that couldn't be delivered.
+	KindOutput
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case KindUsage:
+		return "usage"
+	case KindMissingFile:
+		return "missing-file"
+	case KindRemote:
+		return "remote"
+	case KindExec:
+		return "exec"
+	case KindOutput:
+		return "output"
+	default:
+		return "other"
+	}
+}
+
+// Error is an error of a known kind. Its message is that of Err.
+type Error struct {
+	Kind ErrorKind
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Errorf formats an error of the given kind, as fmt.Errorf would.
+func Errorf(kind ErrorKind, format string, args ...any) error {
+	return &Error{Kind: kind, Err: fmt.Errorf(format, args...)}
+}
+
+// KindOf returns the kind of the first Error in err's chain, or KindOther
+// if there is none.
+func KindOf(err error) ErrorKind {
+	var kindErr *Error
+	if errors.As(err, &kindErr) {
+		return kindErr.Kind
+	}
+	return KindOther
+}
@@ -0,0 +1,156 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package subcmd
+
+import (
+	"context"
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+)
+
+// foreachSub implements "foreach pattern subcommand": it runs the
+// subcommand once for each path that matches the glob pattern, with every
+// {} in its words replaced by the path. Process gives foreach all of the
+// subcommands after it, up to "end", so that
+//
+//	foreach 'cmd/*/main.go' say "Entry point: {}", attach {}
+//
+// says and attaches each match in turn. This function handles the single
+// subcommand of a foreach run by Execute, as from if-exists.
+func foreachSub(ctx context.Context, sc Context, args []string) ([]entry.Entry, error) {
+	if len(args) < 1 {
+		return nil, foreachUsage()
+	}
+	return foreachSubcommands(ctx, sc, args, nil)
+}
+
+// foreachSubcommands runs a foreach whose own words are args (the pattern
+// and the start of the first subcommand) followed by the subcommands body.
+func foreachSubcommands(ctx context.Context, sc Context, args []string, body [][]string) ([]entry.Entry, error) {
+	if len(args) == 0 {
+		return nil, foreachUsage()
+	}
+	pattern := args[0]
+	if len(args) > 1 {
+		body = append([][]string{args[1:]}, body...)
+	}
+	if len(body) == 0 {
+		return nil, foreachUsage()
+	}
+	paths, err := expandGlob(pattern, sc.PruneDirs)
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		slog.Warn("foreach pattern matched no files", "pattern", pattern)
+	}
+	var entries []entry.Entry
+	for _, path := range paths {
+		pathEntries, err := processSubcommands(ctx, sc, substitutePath(body, path))
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, pathEntries...)
+	}
+	return entries, nil
+}
+
+func foreachUsage() error {
+	return Errorf(KindUsage, "foreach takes a pattern and subcommands, e.g. foreach '*.go' attach {}")
+}
+
+// substitutePath returns a copy of subcommands with {} replaced by path.
+// In a nested foreach, {} stands for the nested foreach's paths instead,
+// so only its pattern is changed.
+func substitutePath(subcommands [][]string, path string) [][]string {
+	result := make([][]string, len(subcommands))
+	// open holds the blocks that enclose the current subcommand, true for
+	// each foreach.
+	var open []bool
+	for i, command := range subcommands {
+		words := append([]string{}, command...)
+		result[i] = words
+		if closesBlock(command) {
+			if len(open) > 0 {
+				open = open[:len(open)-1]
+			}
+			continue
+		}
+		nested := slices.Contains(open, true)
+		start := 0
+		for start < len(words) && opensBlock(words[start:]) {
+			if !nested && start+1 < len(words) {
+				words[start+1] = strings.ReplaceAll(words[start+1], "{}", path)
+			}
+			isForeach := words[start] == "foreach"
+			open = append(open, isForeach)
+			nested = nested || isForeach
+			start += 2
+		}
+		if !nested {
+			for j := start; j < len(words); j++ {
+				words[j] = strings.ReplaceAll(words[j], "{}", path)
+			}
+		}
+	}
+	return result
+}
+
+// expandGlob returns the paths that match pattern, in lexical order. A
+// pattern with "**", which matches any number of directories, is matched
+// against the files under its leading literal directories, skipping the
+// hidden and pruned ones as attach does; any other pattern is passed to
+// filepath.Glob.
+func expandGlob(pattern string, pruneDirs []string) ([]string, error) {
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return nil, Errorf(KindUsage, "invalid foreach pattern %q: %v", pattern, err)
+	}
+	if !strings.Contains(pattern, "**") {
+		return filepath.Glob(pattern)
+	}
+	elems := strings.Split(filepath.ToSlash(pattern), "/")
+	literal := 0
+	for literal < len(elems)-1 && !strings.ContainsAny(elems[literal], `*?[\`) {
+		literal++
+	}
+	root := strings.Join(elems[:literal], "/")
+	switch {
+	case literal == 0:
+		root = "."
+	case root == "":
+		root = "/"
+	}
+	files, err := ListFiles(filepath.FromSlash(root), pruneDirs)
+	if err != nil {
+		return nil, Errorf(KindMissingFile, "failed to expand foreach pattern %q: %v", pattern, err)
+	}
+	var paths []string
+	for _, file := range files {
+		rel, err := filepath.Rel(root, file)
+		if err == nil && MatchGlob(strings.Join(elems[literal:], "/"), filepath.ToSlash(rel)) {
+			paths = append(paths, file)
+		}
+	}
+	return paths, nil
+}
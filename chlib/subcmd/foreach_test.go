@@ -0,0 +1,84 @@
+package subcmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+)
+
+func TestForeach(t *testing.T) {
+	sc, _, _ := setupTestFiles(t)
+	defer sc.Cleanup()
+	root := filepath.Join(sc.TempDir, "tree")
+	for _, name := range []string{"cmd/a/main.go", "cmd/b/main.go", "cmd/b/util.go", "docs/x.md", "docs/deep/y.md", "docs/.hidden/z.md"} {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mainA := filepath.Join(root, "cmd/a/main.go")
+	mainB := filepath.Join(root, "cmd/b/main.go")
+	say := func(text string) entry.Entry { return entry.Message{Text: text} }
+	file := func(path string) entry.Entry { return entry.File{StoragePath: path, OriginalPath: path} }
+
+	testCases := []struct {
+		name     string
+		args     []string
+		expected []entry.Entry
+	}{
+		{
+			"to the end of the line",
+			[]string{"say", "Start,", "foreach", filepath.Join(root, "cmd/*/main.go"), "say", "Entry point: {},", "attach", "{}"},
+			[]entry.Entry{say("Start"), say("Entry point: " + mainA), file(mainA), say("Entry point: " + mainB), file(mainB)},
+		},
+		{
+			"up to end",
+			[]string{"foreach", filepath.Join(root, "cmd/*/main.go"), "say", "{},", "end,", "say", "Done"},
+			[]entry.Entry{say(mainA), say(mainB), say("Done")},
+		},
+		{
+			"nested",
+			[]string{"foreach", filepath.Join(root, "cmd/a/main.go"), "say", "outer {},", "foreach", filepath.Join(root, "docs/*.md"), "say", "inner {},", "end,", "say", "after inner,", "end,", "say", "after outer"},
+			[]entry.Entry{say("outer " + mainA), say("inner " + filepath.Join(root, "docs/x.md")), say("after inner"), say("after outer")},
+		},
+		{
+			"nested pattern",
+			[]string{"foreach", filepath.Join(root, "cmd/*"), "foreach", "{}/main.go", "say", "{}"},
+			[]entry.Entry{say(mainA), say(mainB)},
+		},
+		{
+			"double star",
+			[]string{"foreach", filepath.Join(root, "docs/**/*.md"), "say", "{}"},
+			[]entry.Entry{say(filepath.Join(root, "docs/deep/y.md")), say(filepath.Join(root, "docs/x.md"))},
+		},
+		{
+			"no matches",
+			[]string{"foreach", filepath.Join(root, "*.rs"), "attach", "{},", "end,", "say", "Done"},
+			[]entry.Entry{say("Done")},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			entries, err := Process(context.Background(), sc, tc.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(entries, tc.expected) {
+				t.Errorf("Expected %v\n  Actual %v", tc.expected, entries)
+			}
+		})
+	}
+
+	for _, args := range [][]string{{"foreach"}, {"foreach", "*.go"}, {"foreach", "[", "say", "{}"}} {
+		if _, err := Process(context.Background(), sc, args); err == nil {
+			t.Errorf("Expected an error for %q", args)
+		}
+	}
+}
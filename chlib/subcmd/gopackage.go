@@ -0,0 +1,218 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package subcmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/doc"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+)
+
+// goPackage is the part of a package's "go list -json" description that
+// attach --go-package uses.
+type goPackage struct {
+	Dir          string
+	ImportPath   string
+	Name         string
+	Standard     bool
+	GoFiles      []string
+	CgoFiles     []string
+	TestGoFiles  []string
+	XTestGoFiles []string
+	Imports      []string
+	Error        *struct{ Err string }
+}
+
+// sourceFiles returns the paths of the package's Go files, with its test
+// files if tests is set, in lexical order.
+func (p goPackage) sourceFiles(tests bool) []string {
+	names := append(append([]string{}, p.GoFiles...), p.CgoFiles...)
+	if tests {
+		names = append(append(names, p.TestGoFiles...), p.XTestGoFiles...)
+	}
+	slices.Sort(names)
+	paths := make([]string, len(names))
+	for i, name := range names {
+		paths[i] = filepath.Join(p.Dir, name)
+	}
+	return paths
+}
+
+// listGoPackages resolves Go package patterns, such as ./internal/server,
+// ./..., or an import path, with go list, the tool that go/packages runs
+// too, from the working directory.
+func listGoPackages(ctx context.Context, patterns []string) ([]goPackage, error) {
+	cmd := exec.CommandContext(ctx, "go", append([]string{"list", "-e", "-json"}, patterns...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, Errorf(KindExec, "go list %s failed: %v\n%s", strings.Join(patterns, " "), contextError(ctx, err), strings.TrimSpace(stderr.String()))
+	}
+	var packages []goPackage
+	decoder := json.NewDecoder(bytes.NewReader(output))
+	for {
+		var p goPackage
+		if err := decoder.Decode(&p); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, Errorf(KindExec, "failed to read the output of go list: %v", err)
+		}
+		if p.Error != nil {
+			return nil, Errorf(KindMissingFile, "go package %s: %s", p.ImportPath, p.Error.Err)
+		}
+		packages = append(packages, p)
+	}
+	if len(packages) == 0 {
+		return nil, Errorf(KindMissingFile, "no Go packages match %s", strings.Join(patterns, " "))
+	}
+	return packages, nil
+}
+
+// attachGoPackages attaches the source files of the Go packages matching
+// patterns, relative to the working directory where they are beneath it.
+// With deps, each package they import directly, outside the standard
+// library and the packages attached, follows as a summary of its exported
+// API.
+func attachGoPackages(ctx context.Context, patterns []string, tests, deps bool) ([]entry.Entry, error) {
+	packages, err := listGoPackages(ctx, patterns)
+	if err != nil {
+		return nil, err
+	}
+	cwd, _ := os.Getwd()
+	var entries []entry.Entry
+	attached := map[string]bool{}
+	for _, p := range packages {
+		attached[p.ImportPath] = true
+		for _, path := range p.sourceFiles(tests) {
+			if rel, err := filepath.Rel(cwd, path); err == nil && !strings.HasPrefix(rel, "..") {
+				path = rel
+			}
+			entries = append(entries, entry.File{StoragePath: path, OriginalPath: path})
+		}
+	}
+	if !deps {
+		return entries, nil
+	}
+
+	var imports []string
+	for _, p := range packages {
+		for _, path := range p.Imports {
+			if !attached[path] && !slices.Contains(imports, path) && path != "C" && path != "unsafe" {
+				imports = append(imports, path)
+			}
+		}
+	}
+	if len(imports) == 0 {
+		return entries, nil
+	}
+	slices.Sort(imports)
+	dependencies, err := listGoPackages(ctx, imports)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range dependencies {
+		if p.Standard {
+			continue
+		}
+		api, err := goPackageAPI(p)
+		if err != nil {
+			return nil, Errorf(KindMissingFile, "failed to read go package %s: %v", p.ImportPath, err)
+		}
+		entries = append(entries,
+			entry.Message{Text: "Exported API of " + p.ImportPath + ", which the attached code imports:"},
+			entry.Output{Output: api, Command: "attach --go-deps " + p.ImportPath, Lang: "go"},
+		)
+	}
+	return entries, nil
+}
+
+// goPackageAPI summarizes the exported API of a package as Go declarations
+// without function bodies or unexported fields, each preceded by the first
+// sentence of its doc comment.
+func goPackageAPI(p goPackage) (string, error) {
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, path := range p.sourceFiles(false) {
+		file, err := parser.ParseFile(fset, path, nil, parser.ParseComments)
+		if err != nil {
+			return "", err
+		}
+		files = append(files, file)
+	}
+	pkg, err := doc.NewFromFiles(fset, files, p.ImportPath)
+	if err != nil {
+		return "", err
+	}
+
+	var api strings.Builder
+	fmt.Fprintf(&api, "package %s // import %q\n", pkg.Name, p.ImportPath)
+	write := func(text string, node ast.Node) {
+		api.WriteString("\n")
+		if synopsis := pkg.Synopsis(text); synopsis != "" {
+			api.WriteString("// " + synopsis + "\n")
+		}
+		var decl bytes.Buffer
+		if err := format.Node(&decl, fset, node); err != nil {
+			fmt.Fprintf(&decl, "// (could not be printed: %v)", err)
+		}
+		api.WriteString(decl.String() + "\n")
+	}
+	for _, v := range pkg.Consts {
+		write(v.Doc, v.Decl)
+	}
+	for _, v := range pkg.Vars {
+		write(v.Doc, v.Decl)
+	}
+	for _, f := range pkg.Funcs {
+		write(f.Doc, f.Decl)
+	}
+	for _, t := range pkg.Types {
+		write(t.Doc, t.Decl)
+		for _, v := range t.Consts {
+			write(v.Doc, v.Decl)
+		}
+		for _, v := range t.Vars {
+			write(v.Doc, v.Decl)
+		}
+		for _, f := range t.Funcs {
+			write(f.Doc, f.Decl)
+		}
+		for _, f := range t.Methods {
+			write(f.Doc, f.Decl)
+		}
+	}
+	return api.String(), nil
+}
@@ -0,0 +1,89 @@
+package subcmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+)
+
+func TestAttachGoPackage(t *testing.T) {
+	module := t.TempDir()
+	files := map[string]string{
+		"go.mod":                  "module example.com/m\n\ngo 1.22\n",
+		"server/server.go":        "package server\n\nimport (\n\t\"fmt\"\n\n\t\"example.com/m/store\"\n)\n\nfunc Run(s *store.Store) { fmt.Println(s.Get(\"k\")) }\n",
+		"server/routes.go":        "package server\n\nvar routes = []string{\"/\"}\n",
+		"server/server_test.go":   "package server\n",
+		"server/README.md":        "# Server\n",
+		"server/ignored_linux.go": "//go:build ignore\n\npackage server\n",
+		"store/store.go": "package store\n\n// Store holds values. It is safe for concurrent use.\ntype Store struct {\n\tName string\n\tvalues map[string]string\n}\n\n" +
+			"// New returns an empty store.\nfunc New() *Store { return &Store{values: map[string]string{}} }\n\n" +
+			"// Get returns the value for key.\nfunc (s *Store) Get(key string) string { return s.values[key] }\n\nfunc helper() {}\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(module, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	if err := os.Chdir(module); err != nil {
+		t.Fatal(err)
+	}
+	sc := Context{}
+
+	entries, err := attachSub(context.Background(), sc, []string{"--go-package", "./server"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []entry.Entry{
+		entry.File{StoragePath: filepath.Join("server", "routes.go"), OriginalPath: filepath.Join("server", "routes.go")},
+		entry.File{StoragePath: filepath.Join("server", "server.go"), OriginalPath: filepath.Join("server", "server.go")},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("Expected %v\n  Actual %v", expected, entries)
+	}
+
+	entries, err = attachSub(context.Background(), sc, []string{"--go-package", "--go-tests", "--go-deps", "./server"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 5 {
+		t.Fatalf("Expected 3 files, then the API of store\n  Actual %v", entries)
+	}
+	api, ok := entries[4].(entry.Output)
+	if !ok {
+		t.Fatalf("Expected the API of store as command output\n  Actual %#v", entries[4])
+	}
+	for _, want := range []string{
+		"package store // import \"example.com/m/store\"",
+		"// Store holds values.\ntype Store struct {\n\tName string\n\t// contains filtered or unexported fields\n}",
+		"// New returns an empty store.\nfunc New() *Store\n",
+		"func (s *Store) Get(key string) string\n",
+	} {
+		if !strings.Contains(api.Output, want) {
+			t.Errorf("Expected the API to contain %q\n  Actual %s", want, api.Output)
+		}
+	}
+	if strings.Contains(api.Output, "helper") || strings.Contains(api.Output, "s.values") {
+		t.Errorf("Expected no unexported declarations or function bodies\n  Actual %s", api.Output)
+	}
+
+	if _, err := attachSub(context.Background(), sc, []string{"--go-package", "./missing"}); err == nil {
+		t.Errorf("Expected an error for a package that doesn't exist")
+	}
+	if _, err := attachSub(context.Background(), sc, []string{"--go-deps", "server"}); err == nil {
+		t.Errorf("Expected an error for --go-deps without --go-package")
+	}
+}
@@ -0,0 +1,181 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package subcmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+	"github.com/eloquence-cloud/ch/chlib/keyring"
+)
+
+// graphqlFlags are the flags of the graphql subcommand.
+type graphqlFlags struct {
+	endpoint *string
+	query    *string
+	vars     *stringList
+	auth     *string
+	maxLines *int
+}
+
+func addGraphQLFlags(flags *flag.FlagSet) graphqlFlags {
+	f := graphqlFlags{vars: &stringList{}}
+	f.endpoint = flags.String("endpoint", "", "Send the query to the GraphQL endpoint at `url`")
+	f.query = flags.String("query", "", "The `query` to run, or @file to read it from a file")
+	flags.Var(f.vars, "var", "Set the query variable `name=value` (repeatable); a value that parses as JSON is sent as JSON, anything else as a string")
+	f.auth = flags.String("auth", "", "Send the keyring credential `name` (or $NAME_TOKEN) as a bearer token")
+	f.maxLines = flags.Int("max-lines", 200, "Show at most `N` lines of the result (0 = no limit)")
+	return f
+}
+
+// graphqlSub implements "graphql --endpoint url --query query": it runs a
+// GraphQL query and adds the data it returns as pretty-printed JSON, cut
+// short after --max-lines lines.
+func graphqlSub(ctx context.Context, sc Context, args []string) ([]entry.Entry, error) {
+	flags := newSubcommandFlags("graphql")
+	f := addGraphQLFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return nil, Errorf(KindUsage, "invalid graphql flags: %v", err)
+	}
+	if *f.endpoint == "" || *f.query == "" || flags.NArg() > 0 {
+		return nil, Errorf(KindUsage, "graphql takes an endpoint and a query, e.g. graphql --endpoint https://api.example.com/graphql --query @open-bugs.graphql --var team=infra")
+	}
+	query := *f.query
+	if file, ok := strings.CutPrefix(query, "@"); ok {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return nil, Errorf(KindMissingFile, "failed to read query: %v", err)
+		}
+		query = string(content)
+	}
+	variables, err := parseGraphQLVars(*f.vars)
+	if err != nil {
+		return nil, err
+	}
+	var token string
+	if *f.auth != "" {
+		if token, err = keyring.Lookup(*f.auth, keyring.EnvVar(*f.auth)); err != nil {
+			return nil, Errorf(KindUsage, "%v", err)
+		}
+	}
+
+	result, err := runGraphQL(ctx, sc.Network, *f.endpoint, token, query, variables)
+	if err != nil {
+		return nil, err
+	}
+	var pretty bytes.Buffer
+	if err := json.Indent(&pretty, result, "", "  "); err != nil {
+		return nil, Errorf(KindRemote, "graphql endpoint returned invalid JSON: %v", err)
+	}
+	text := pretty.String()
+	label := fmt.Sprintf("Result of GraphQL query to %s:", *f.endpoint)
+	if lines := strings.Split(text, "\n"); *f.maxLines > 0 && len(lines) > *f.maxLines {
+		text = strings.Join(lines[:*f.maxLines], "\n")
+		label = fmt.Sprintf("Result of GraphQL query to %s (first %d of %d lines):", *f.endpoint, *f.maxLines, len(lines))
+	}
+	return []entry.Entry{
+		entry.Message{Text: label},
+		entry.Output{Output: text, Command: "graphql " + *f.endpoint, Lang: "json"},
+	}, nil
+}
+
+// parseGraphQLVars parses --var name=value flags into query variables.
+func parseGraphQLVars(vars []string) (map[string]any, error) {
+	variables := map[string]any{}
+	for _, v := range vars {
+		name, value, ok := strings.Cut(v, "=")
+		if !ok || name == "" {
+			return nil, Errorf(KindUsage, "invalid graphql --var %q (expected name=value)", v)
+		}
+		var parsed any
+		if err := json.Unmarshal([]byte(value), &parsed); err != nil {
+			parsed = value
+		}
+		variables[name] = parsed
+	}
+	return variables, nil
+}
+
+// runGraphQL posts a query to endpoint and returns the data of the
+// response, or, if it reports errors as well as data, the whole response.
+// A response with errors and no data is an error.
+func runGraphQL(ctx context.Context, network *Network, endpoint, token, query string, variables map[string]any) (json.RawMessage, error) {
+	body, err := json.Marshal(map[string]any{"query": query, "variables": variables})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, Errorf(KindUsage, "invalid graphql endpoint: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := network.Do(req)
+	if err != nil {
+		return nil, Errorf(KindRemote, "graphql query failed: %w", err)
+	}
+	defer resp.Body.Close()
+	content, err := io.ReadAll(resp.Body)
+	if errors.Is(err, ErrNetworkBudget) {
+		return nil, err
+	} else if err != nil {
+		return nil, Errorf(KindRemote, "graphql query failed: %v", err)
+	}
+
+	var response struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(content, &response); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return nil, Errorf(KindRemote, "graphql query failed: %s", resp.Status)
+		}
+		return nil, Errorf(KindRemote, "graphql endpoint returned invalid JSON: %v", err)
+	}
+	hasData := len(response.Data) > 0 && string(response.Data) != "null"
+	if len(response.Errors) > 0 && !hasData {
+		var messages []string
+		for _, e := range response.Errors {
+			messages = append(messages, e.Message)
+		}
+		return nil, Errorf(KindRemote, "graphql query failed: %s", strings.Join(messages, "; "))
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, Errorf(KindRemote, "graphql query failed: %s", resp.Status)
+	}
+	if len(response.Errors) > 0 {
+		return content, nil
+	}
+	return response.Data, nil
+}
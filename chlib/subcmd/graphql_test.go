@@ -0,0 +1,85 @@
+package subcmd
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+)
+
+func TestGraphQLSub(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Query     string         `json:"query"`
+			Variables map[string]any `json:"variables"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		switch {
+		case r.Header.Get("Authorization") != "Bearer secret":
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"errors": [{"message": "bad credentials"}]}`))
+		case request.Query == "{ broken":
+			w.Write([]byte(`{"data": null, "errors": [{"message": "syntax error"}]}`))
+		default:
+			data, _ := json.Marshal(map[string]any{"data": map[string]any{"team": request.Variables["team"], "first": request.Variables["first"]}})
+			w.Write(data)
+		}
+	}))
+	defer server.Close()
+
+	sc, _, _ := setupTestFiles(t)
+	defer sc.Cleanup()
+	queryFile := filepath.Join(sc.TempDir, "bugs.graphql")
+	if err := os.WriteFile(queryFile, []byte("query($team: String) { bugs(team: $team) { id } }"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", t.TempDir()) // no keyring
+	t.Setenv("TRACKER_TOKEN", "secret")
+
+	args := []string{"--endpoint", server.URL, "--auth", "tracker", "--query", "@" + queryFile, "--var", "team=infra", "--var", "first=2"}
+	entries, err := graphqlSub(context.Background(), sc, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []entry.Entry{
+		entry.Message{Text: "Result of GraphQL query to " + server.URL + ":"},
+		entry.Output{Output: "{\n  \"first\": 2,\n  \"team\": \"infra\"\n}", Command: "graphql " + server.URL, Lang: "json"},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("Expected %#v\n  Actual %#v", expected, entries)
+	}
+
+	entries, err = graphqlSub(context.Background(), sc, append(args, "--max-lines", "2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []entry.Entry{
+		entry.Message{Text: "Result of GraphQL query to " + server.URL + " (first 2 of 4 lines):"},
+		entry.Output{Output: "{\n  \"first\": 2,", Command: "graphql " + server.URL, Lang: "json"},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("Expected %#v\n  Actual %#v", expected, entries)
+	}
+
+	failures := [][]string{
+		{"--endpoint", server.URL, "--auth", "tracker", "--query", "{ broken"},
+		{"--endpoint", server.URL, "--query", "{ bugs { id } }"},
+		{"--endpoint", server.URL},
+		{"--endpoint", server.URL, "--auth", "tracker", "--query", "{ x }", "--var", "novalue"},
+		{"--endpoint", server.URL, "--query", "@" + filepath.Join(sc.TempDir, "missing.graphql")},
+	}
+	for _, args := range failures {
+		if _, err := graphqlSub(context.Background(), sc, args); err == nil {
+			t.Errorf("Expected an error for %q", args)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package subcmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+)
+
+// tailChunkSize is how much of a file tail reads at a time, working back
+// from its end.
+const tailChunkSize = 64 << 10
+
+// headTailFlags are the flags of the head and tail subcommands.
+type headTailFlags struct {
+	lines *int
+}
+
+func addHeadTailFlags(flags *flag.FlagSet) headTailFlags {
+	return headTailFlags{
+		lines: flags.Int("n", 10, "Include `count` lines"),
+	}
+}
+
+// headSub implements "head [-n count] file...": it attaches the first lines
+// of each file, reading no further.
+func headSub(ctx context.Context, sc Context, args []string) ([]entry.Entry, error) {
+	return headTail(ctx, sc, "head", args)
+}
+
+// tailSub implements "tail [-n count] file...": it attaches the last lines
+// of each file, reading back from its end, so that only the end of a large
+// log is read.
+func tailSub(ctx context.Context, sc Context, args []string) ([]entry.Entry, error) {
+	return headTail(ctx, sc, "tail", args)
+}
+
+func headTail(ctx context.Context, sc Context, name string, args []string) ([]entry.Entry, error) {
+	flags := newSubcommandFlags(name)
+	f := addHeadTailFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return nil, Errorf(KindUsage, "invalid %s flags: %v", name, err)
+	}
+	if *f.lines < 1 {
+		return nil, Errorf(KindUsage, "%s -n takes a positive count", name)
+	}
+	if flags.NArg() == 0 {
+		return nil, Errorf(KindUsage, "%s takes one or more files, e.g. %s -n 100 app.log", name, name)
+	}
+
+	return eachPath(ctx, sc, name, flags.Args(), func(filePath string) ([]entry.Entry, error) {
+		content, truncated, err := readLines(ctx, name, filePath, *f.lines)
+		if err != nil {
+			return nil, err
+		}
+		file, err := entry.NewStoredFile(sc.TempDir, filePath, content)
+		if err != nil {
+			return nil, fmt.Errorf("failed to store %s: %v", filePath, err)
+		}
+		file = labelFiles([]entry.Entry{file}, filePath, "", sc.PathAliases)[0].(entry.File)
+		if truncated {
+			part := "first"
+			if name == "tail" {
+				part = "last"
+			}
+			file.Label = fmt.Sprintf("%s (%s %s)", file.DisplayPath(), part, entry.FormatLineCount(*f.lines))
+		}
+		return []entry.Entry{file}, nil
+	})
+}
+
+// readLines returns the first (for head) or last (for tail) n lines of a
+// local or remote file, and whether the file has more lines than that.
+func readLines(ctx context.Context, name, filePath string, n int) ([]byte, bool, error) {
+	if hostname, remotePath, ok := strings.Cut(filePath, ":"); ok {
+		return readRemoteLines(ctx, name, hostname, remotePath, n)
+	}
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, false, Errorf(KindMissingFile, "file does not exist: %v", filePath)
+	}
+	defer file.Close()
+	if info, err := file.Stat(); err == nil && info.IsDir() {
+		return nil, false, Errorf(KindUsage, "%s takes files, not directories: %s", name, filePath)
+	}
+	if name == "head" {
+		return firstLines(file, n)
+	}
+	return lastLines(file, n)
+}
+
+// firstLines returns the first n lines read from r, and whether more follow.
+func firstLines(r io.Reader, n int) ([]byte, bool, error) {
+	reader := bufio.NewReader(r)
+	var content []byte
+	for i := 0; i < n; i++ {
+		line, err := reader.ReadBytes('\n')
+		content = append(content, line...)
+		if err == io.EOF {
+			return content, false, nil
+		}
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	_, err := reader.Peek(1)
+	return content, err == nil, nil
+}
+
+// lastLines returns the last n lines of file, and whether lines precede
+// them. It reads the file back from its end, a chunk at a time.
+func lastLines(file *os.File, n int) ([]byte, bool, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, false, err
+	}
+	var content []byte
+	for offset := info.Size(); offset > 0; {
+		size := min(tailChunkSize, offset)
+		offset -= size
+		chunk := make([]byte, size)
+		if _, err := file.ReadAt(chunk, offset); err != nil && !errors.Is(err, io.EOF) {
+			return nil, false, err
+		}
+		content = append(chunk, content...)
+
+		// The newline that ends the last line doesn't separate lines, so
+		// the nth newline before it starts the last n lines.
+		body := bytes.TrimSuffix(content, []byte("\n"))
+		count := 0
+		for i := len(body) - 1; i >= 0; i-- {
+			if body[i] == '\n' {
+				count++
+				if count == n {
+					return content[i+1:], true, nil
+				}
+			}
+		}
+	}
+	return content, false, nil
+}
+
+// readRemoteLines runs head or tail on the remote host over ssh, so that
+// only the lines wanted are copied. A file with exactly n lines is reported
+// as having more, since the remote command doesn't say.
+func readRemoteLines(ctx context.Context, name, hostname, remotePath string, n int) ([]byte, bool, error) {
+	cmd := exec.CommandContext(ctx, "ssh", hostname, fmt.Sprintf("%s -n %d -- %s", name, n, shellQuote(remotePath)))
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, false, Errorf(KindRemote, "failed to read remote file %s:%s: %v\nOutput: %s", hostname, remotePath, err, stderr.String())
+	}
+	return output, bytes.Count(output, []byte("\n")) >= n, nil
+}
+
+// shellQuote quotes s as a single word for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,71 @@
+package subcmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+)
+
+func TestHeadTail(t *testing.T) {
+	sc, _, _ := setupTestFiles(t)
+	defer sc.Cleanup()
+
+	// Enough lines that tail reads more than one chunk.
+	var lines []string
+	for i := 1; i <= 20000; i++ {
+		lines = append(lines, fmt.Sprintf("line %d", i))
+	}
+	logPath := filepath.Join(sc.TempDir, "app.log")
+	if err := os.WriteFile(logPath, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	shortPath := filepath.Join(sc.TempDir, "short.log")
+	if err := os.WriteFile(shortPath, []byte("one\ntwo"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name            string
+		args            []string
+		expectedLabel   string
+		expectedContent string
+	}{
+		{"head", []string{"head", "-n", "2", logPath}, logPath + " (first 2 lines)", "line 1\nline 2\n"},
+		{"head default", []string{"head", logPath}, logPath + " (first 10 lines)", strings.Join(lines[:10], "\n") + "\n"},
+		{"tail", []string{"tail", "-n", "3", logPath}, logPath + " (last 3 lines)", "line 19998\nline 19999\nline 20000\n"},
+		{"tail across chunks", []string{"tail", "-n", "15000", logPath}, logPath + " (last 15000 lines)", strings.Join(lines[5000:], "\n") + "\n"},
+		{"head of short file", []string{"head", "-n", "5", shortPath}, "", "one\ntwo"},
+		{"tail of short file", []string{"tail", "-n", "5", shortPath}, "", "one\ntwo"},
+		{"tail without final newline", []string{"tail", "-n", "1", shortPath}, shortPath + " (last 1 line)", "two"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			entries, err := Execute(context.Background(), sc, tc.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 1 {
+				t.Fatalf("Expected 1 entry\n  Actual %v", entries)
+			}
+			file := entries[0].(entry.File)
+			content, err := os.ReadFile(file.StoragePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if file.Label != tc.expectedLabel || string(content) != tc.expectedContent {
+				t.Errorf("Expected %q %q\n  Actual %q %q", tc.expectedLabel, tc.expectedContent, file.Label, content)
+			}
+		})
+	}
+
+	for _, args := range [][]string{{"tail"}, {"tail", "-n", "0", logPath}, {"head", sc.TempDir}, {"hea", logPath}} {
+		if _, err := Execute(context.Background(), sc, args); err == nil {
+			t.Errorf("Expected an error for %q", args)
+		}
+	}
+}
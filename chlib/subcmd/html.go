@@ -0,0 +1,57 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package subcmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+	"github.com/eloquence-cloud/ch/chlib/htmlmd"
+)
+
+// isHTML reports whether a file is named as an HTML document.
+func isHTML(filePath string) bool {
+	ext := strings.ToLower(filepath.Ext(filePath))
+	return ext == ".html" || ext == ".htm"
+}
+
+// convertHTML replaces the HTML files among entries with their conversions
+// to markdown, which read better and take fewer tokens than the markup.
+func convertHTML(sc Context, entries []entry.Entry) ([]entry.Entry, error) {
+	for i, e := range entries {
+		file, ok := e.(entry.File)
+		if !ok || !isHTML(file.OriginalPath) {
+			continue
+		}
+		content, err := os.ReadFile(file.StoragePath)
+		if err != nil {
+			return nil, Errorf(KindMissingFile, "failed to read %s: %v", file.OriginalPath, err)
+		}
+		converted, err := entry.NewStoredFile(sc.TempDir, file.OriginalPath, []byte(htmlmd.Convert(string(content))))
+		if err != nil {
+			return nil, err
+		}
+		converted.Lang = "markdown"
+		entries[i] = converted
+	}
+	return entries, nil
+}
@@ -0,0 +1,58 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package subcmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+)
+
+// importSub reads entry lists written by -export. A path of "-" reads from
+// standard input.
+func importSub(ctx context.Context, sc Context, args []string) ([]entry.Entry, error) {
+	var entries []entry.Entry
+	for _, listPath := range args {
+		var data []byte
+		var err error
+		if listPath == "-" {
+			data, err = io.ReadAll(os.Stdin)
+		} else {
+			data, err = os.ReadFile(listPath)
+		}
+		if err != nil {
+			return nil, Errorf(KindMissingFile, "failed to read entry list: %v", err)
+		}
+		var list entry.List
+		if err := json.Unmarshal(data, &list); err != nil {
+			return nil, fmt.Errorf("invalid entry list %s: %v", listPath, err)
+		}
+		imported, err := entry.Import(sc.TempDir, list)
+		if err != nil {
+			return nil, fmt.Errorf("invalid entry list %s: %v", listPath, err)
+		}
+		entries = append(entries, imported...)
+	}
+	return entries, nil
+}
@@ -0,0 +1,27 @@
+package subcmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestImportSubErrors(t *testing.T) {
+	sc, err := NewContext()
+	if err != nil {
+		t.Fatalf("Failed to create context: %v", err)
+	}
+	defer sc.Cleanup()
+
+	badPath := filepath.Join(sc.TempDir, "bad.json")
+	if err := os.WriteFile(badPath, []byte(`{"entries": [{"type": "picture"}]}`), 0644); err != nil {
+		t.Fatalf("Failed to write entry list: %v", err)
+	}
+	if _, err := importSub(context.Background(), sc, []string{badPath}); err == nil {
+		t.Error("Expected an error for an unknown entry type")
+	}
+	if _, err := importSub(context.Background(), sc, []string{filepath.Join(sc.TempDir, "missing.json")}); err == nil {
+		t.Error("Expected an error for a missing entry list")
+	}
+}
@@ -0,0 +1,192 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package subcmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+)
+
+// maxLoadDepth limits how deeply script files can load one another, so
+// that a script that loads itself fails instead of recursing forever.
+const maxLoadDepth = 16
+
+type loadDepthKey struct{}
+
+// loadSub implements "load file...": it runs the subcommands in each script
+// file, one per line. Blank lines and lines starting with # are skipped,
+// and each line is split into words as a shell would, without expansion.
+// Paths in the script are relative to the working directory, not the
+// script, so that one script can be shared by several projects.
+func loadSub(ctx context.Context, sc Context, args []string) ([]entry.Entry, error) {
+	if len(args) == 0 {
+		return nil, Errorf(KindUsage, "load takes one or more script files")
+	}
+	depth, _ := ctx.Value(loadDepthKey{}).(int)
+	if depth >= maxLoadDepth {
+		return nil, Errorf(KindUsage, "script files are loaded more than %d deep", maxLoadDepth)
+	}
+	ctx = context.WithValue(ctx, loadDepthKey{}, depth+1)
+
+	var entries []entry.Entry
+	for _, path := range args {
+		lines, err := readScript(path)
+		if err != nil {
+			return nil, err
+		}
+		scriptEntries, err := runScript(ctx, sc, path, lines)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, scriptEntries...)
+	}
+	return entries, nil
+}
+
+// bundleSub implements "bundle name": it runs the named bundle, a script
+// of subcommands defined in the config file or the project's .ch.toml, as
+// load runs a script file.
+func bundleSub(ctx context.Context, sc Context, args []string) ([]entry.Entry, error) {
+	if len(args) != 1 {
+		return nil, Errorf(KindUsage, "bundle takes the name of a bundle")
+	}
+	script, ok := sc.Bundles[args[0]]
+	if !ok {
+		var names []string
+		for name := range sc.Bundles {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		if len(names) == 0 {
+			return nil, Errorf(KindUsage, "unknown bundle %q (no bundles are defined)", args[0])
+		}
+		return nil, Errorf(KindUsage, "unknown bundle %q (expected %s)", args[0], strings.Join(names, ", "))
+	}
+	depth, _ := ctx.Value(loadDepthKey{}).(int)
+	if depth >= maxLoadDepth {
+		return nil, Errorf(KindUsage, "script files are loaded more than %d deep", maxLoadDepth)
+	}
+	ctx = context.WithValue(ctx, loadDepthKey{}, depth+1)
+	name := "bundle " + args[0]
+	lines, err := parseScript(name, strings.NewReader(script))
+	if err != nil {
+		return nil, err
+	}
+	return runScript(ctx, sc, name, lines)
+}
+
+// runScript runs the lines of the script called name.
+func runScript(ctx context.Context, sc Context, name string, lines []scriptLine) ([]entry.Entry, error) {
+	var entries []entry.Entry
+	for _, line := range lines {
+		lineEntries, err := Process(ctx, sc, line.words)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", name, line.number, err)
+		}
+		entries = append(entries, lineEntries...)
+	}
+	return entries, nil
+}
+
+// scriptLine is a line of a script file, split into words.
+type scriptLine struct {
+	number int
+	words  []string
+}
+
+// readScript reads the subcommand lines of the script file at path.
+func readScript(path string) ([]scriptLine, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, Errorf(KindMissingFile, "failed to read script: %v", err)
+	}
+	defer file.Close()
+	return parseScript(path, file)
+}
+
+// parseScript reads the subcommand lines of the script called name from r.
+func parseScript(name string, r io.Reader) ([]scriptLine, error) {
+	var lines []scriptLine
+	scanner := bufio.NewScanner(r)
+	for number := 1; scanner.Scan(); number++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		words, err := SplitWords(text)
+		if err != nil {
+			return nil, Errorf(KindUsage, "%s:%d: %v", name, number, err)
+		}
+		lines = append(lines, scriptLine{number, words})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, Errorf(KindMissingFile, "failed to read script: %v", err)
+	}
+	return lines, nil
+}
+
+// SplitWords splits a line of subcommands into words as a shell would: at
+// unquoted spaces, with single quotes, double quotes, and backslashes
+// quoting what they enclose or precede.
+func SplitWords(line string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	escaped := false
+	for _, c := range line {
+		switch {
+		case escaped:
+			word.WriteRune(c)
+			escaped = false
+		case c == '\\' && quote != '\'':
+			escaped, inWord = true, true
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote != 0:
+			word.WriteRune(c)
+		case c == '\'' || c == '"':
+			quote, inWord = c, true
+		case c == ' ' || c == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(c)
+			inWord = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("unterminated quote or escape")
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
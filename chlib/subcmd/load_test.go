@@ -0,0 +1,119 @@
+package subcmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+)
+
+func TestLoadSub(t *testing.T) {
+	sc, filePath, _ := setupTestFiles(t)
+	defer sc.Cleanup()
+
+	script := filepath.Join(sc.TempDir, "review.ch")
+	content := "# Shared review prompt\n" +
+		"say 'Please review:'\n" +
+		"\n" +
+		"if-exists " + filePath + " then attach " + filePath + "\n" +
+		"if-exists " + filepath.Join(sc.TempDir, "missing.txt") + " then attach missing.txt\n" +
+		"say Thanks, say \"Bye now\"\n"
+	if err := os.WriteFile(script, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := loadSub(context.Background(), sc, []string{script})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []entry.Entry{
+		entry.Message{Text: "Please review:"},
+		entry.File{StoragePath: filePath, OriginalPath: filePath},
+		entry.Message{Text: "Thanks"},
+		entry.Message{Text: "Bye now"},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("Expected %v\n  Actual %v", expected, entries)
+	}
+
+	loop := filepath.Join(sc.TempDir, "loop.ch")
+	if err := os.WriteFile(loop, []byte("load "+loop+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadSub(context.Background(), sc, []string{loop}); err == nil || !strings.Contains(err.Error(), "deep") {
+		t.Errorf("Expected an error for a script that loads itself\n  Actual %v", err)
+	}
+
+	bad := filepath.Join(sc.TempDir, "bad.ch")
+	if err := os.WriteFile(bad, []byte("say ok\nsay \"open\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadSub(context.Background(), sc, []string{bad}); err == nil || !strings.Contains(err.Error(), "bad.ch:2") {
+		t.Errorf("Expected an error naming bad.ch:2\n  Actual %v", err)
+	}
+}
+
+func TestBundleSub(t *testing.T) {
+	sc, filePath, _ := setupTestFiles(t)
+	defer sc.Cleanup()
+	sc.Bundles = map[string]string{
+		"review": "# What a review needs\nsay 'Please review:'\n\nattach " + filePath + "\nbundle thanks\n",
+		"thanks": "say Thanks",
+		"loop":   "bundle loop",
+		"broken": "say ok\nexec no-such-program-for-ch\n",
+	}
+
+	entries, err := bundleSub(context.Background(), sc, []string{"review"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []entry.Entry{
+		entry.Message{Text: "Please review:"},
+		entry.File{StoragePath: filePath, OriginalPath: filePath},
+		entry.Message{Text: "Thanks"},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("Expected %v\n  Actual %v", expected, entries)
+	}
+
+	for _, tc := range []struct{ name, err string }{
+		{"loop", "deep"},
+		{"broken", "bundle broken:2"},
+		{"missing", "expected broken, loop, review, thanks"},
+	} {
+		if _, err := bundleSub(context.Background(), sc, []string{tc.name}); err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("Expected an error for bundle %s containing %q\n  Actual %v", tc.name, tc.err, err)
+		}
+	}
+}
+
+func TestSplitWords(t *testing.T) {
+	testCases := []struct {
+		line     string
+		expected []string
+		wantErr  bool
+	}{
+		{"", nil, false},
+		{"  attach  a.go b.go ", []string{"attach", "a.go", "b.go"}, false},
+		{`say "Please review," attach x`, []string{"say", "Please review,", "attach", "x"}, false},
+		{`say 'it''s' a\ b ""`, []string{"say", "its", "a b", ""}, false},
+		{`say "a \"quoted\" word"`, []string{"say", `a "quoted" word`}, false},
+		{`say 'back\slash'`, []string{"say", `back\slash`}, false},
+		{`say "open`, nil, true},
+		{`say trailing\`, nil, true},
+	}
+	for _, tc := range testCases {
+		actual, err := SplitWords(tc.line)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("SplitWords(%q): unexpected error %v", tc.line, err)
+			continue
+		}
+		if !reflect.DeepEqual(actual, tc.expected) {
+			t.Errorf("SplitWords(%q)\nExpected: %q\n  Actual: %q", tc.line, tc.expected, actual)
+		}
+	}
+}
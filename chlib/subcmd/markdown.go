@@ -0,0 +1,138 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package subcmd
+
+import (
+	"context"
+	"flag"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+)
+
+// quoteSub implements "quote text" and "quote file": it adds the text, or
+// the contents of the file, as a markdown blockquote, to set quoted
+// requirements or earlier answers apart from the user's own words. A single
+// argument naming an existing file is read as a file.
+func quoteSub(ctx context.Context, sc Context, args []string) ([]entry.Entry, error) {
+	if len(args) == 0 {
+		return nil, Errorf(KindUsage, "quote takes text or a file to quote")
+	}
+	text := strings.Join(args, " ")
+	var source string
+	if len(args) == 1 {
+		if info, err := os.Stat(args[0]); err == nil && info.Mode().IsRegular() {
+			content, err := os.ReadFile(args[0])
+			if err != nil {
+				return nil, Errorf(KindMissingFile, "failed to read file: %v", err)
+			}
+			text, source = string(content), args[0]
+		}
+	}
+	return []entry.Entry{entry.Message{Text: blockquote(text), Source: source}}, nil
+}
+
+// blockquote returns text as a markdown blockquote, with each line,
+// including blank ones, prefixed with ">".
+func blockquote(text string) string {
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+	for i, line := range lines {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" {
+			lines[i] = ">"
+		} else {
+			lines[i] = "> " + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// headingSub implements "heading [level] text": it adds a markdown heading,
+// at level 2 unless a level from 1 to 6 is given.
+func headingSub(ctx context.Context, sc Context, args []string) ([]entry.Entry, error) {
+	level := 2
+	if len(args) > 1 {
+		if n, err := strconv.Atoi(args[0]); err == nil && n >= 1 && n <= 6 {
+			level, args = n, args[1:]
+		}
+	}
+	if len(args) == 0 {
+		return nil, Errorf(KindUsage, "heading takes a level and text, e.g. heading 2 \"Server logs\"")
+	}
+	return []entry.Entry{entry.Message{Text: strings.Repeat("#", level) + " " + strings.Join(args, " ")}}, nil
+}
+
+// hrSub implements "hr": it adds a horizontal rule.
+func hrSub(ctx context.Context, sc Context, args []string) ([]entry.Entry, error) {
+	if len(args) > 0 {
+		return nil, Errorf(KindUsage, "hr takes no arguments")
+	}
+	return []entry.Entry{entry.Message{Text: "---"}}, nil
+}
+
+// listFlags are the flags of the list subcommand.
+type listFlags struct {
+	fromFile *string
+	numbered *bool
+}
+
+func addListFlags(flags *flag.FlagSet) listFlags {
+	return listFlags{
+		fromFile: flags.String("from-file", "", "Add the non-blank lines of `file` as items, after any given as arguments"),
+		numbered: flags.Bool("numbered", false, "Number the items instead of bulleting them"),
+	}
+}
+
+// listSub implements "list item...": it adds a bulleted or numbered list.
+func listSub(ctx context.Context, sc Context, args []string) ([]entry.Entry, error) {
+	flags := newSubcommandFlags("list")
+	f := addListFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return nil, Errorf(KindUsage, "invalid list flags: %v", err)
+	}
+	items := flags.Args()
+	var source string
+	if *f.fromFile != "" {
+		content, err := os.ReadFile(*f.fromFile)
+		if err != nil {
+			return nil, Errorf(KindMissingFile, "failed to read list items: %v", err)
+		}
+		for _, line := range strings.Split(string(content), "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				items = append(items, line)
+			}
+		}
+		source = *f.fromFile
+	}
+	if len(items) == 0 {
+		return nil, Errorf(KindUsage, "list takes items as arguments or with --from-file")
+	}
+	lines := make([]string, len(items))
+	for i, item := range items {
+		marker := "-"
+		if *f.numbered {
+			marker = strconv.Itoa(i+1) + "."
+		}
+		lines[i] = marker + " " + item
+	}
+	return []entry.Entry{entry.Message{Text: strings.Join(lines, "\n"), Source: source}}, nil
+}
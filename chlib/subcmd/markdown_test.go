@@ -0,0 +1,116 @@
+package subcmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+)
+
+func TestQuoteSub(t *testing.T) {
+	sc, _, _ := setupTestFiles(t)
+	defer sc.Cleanup()
+	answer := filepath.Join(sc.TempDir, "answer.md")
+	if err := os.WriteFile(answer, []byte("Use a mutex.\r\n\n  Or a channel.  \n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name     string
+		args     []string
+		expected entry.Message
+	}{
+		{"text", []string{"Must", "support", "IPv6."}, entry.Message{Text: "> Must support IPv6."}},
+		{"file", []string{answer}, entry.Message{Text: "> Use a mutex.\n>\n>   Or a channel.", Source: answer}},
+		{"missing file is text", []string{"missing.md"}, entry.Message{Text: "> missing.md"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			entries, err := quoteSub(context.Background(), sc, tc.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if expected := []entry.Entry{tc.expected}; !reflect.DeepEqual(entries, expected) {
+				t.Errorf("Expected %q\n  Actual %q", expected, entries)
+			}
+		})
+	}
+
+	if _, err := quoteSub(context.Background(), sc, nil); err == nil {
+		t.Errorf("Expected an error for no arguments")
+	}
+}
+
+func TestHeadingAndHrSubs(t *testing.T) {
+	sc, _, _ := setupTestFiles(t)
+	defer sc.Cleanup()
+
+	testCases := []struct {
+		name     string
+		fn       Func
+		args     []string
+		expected string
+		wantErr  bool
+	}{
+		{"heading with level", headingSub, []string{"3", "Server", "logs"}, "### Server logs", false},
+		{"heading without level", headingSub, []string{"Server logs"}, "## Server logs", false},
+		{"number as text", headingSub, []string{"2024", "plans"}, "## 2024 plans", false},
+		{"lone number is text", headingSub, []string{"7"}, "## 7", false},
+		{"heading without text", headingSub, nil, "", true},
+		{"hr", hrSub, nil, "---", false},
+		{"hr with arguments", hrSub, []string{"x"}, "", true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			entries, err := tc.fn(context.Background(), sc, tc.args)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if tc.wantErr {
+				return
+			}
+			if expected := []entry.Entry{entry.Message{Text: tc.expected}}; !reflect.DeepEqual(entries, expected) {
+				t.Errorf("Expected %q\n  Actual %q", expected, entries)
+			}
+		})
+	}
+}
+
+func TestListSub(t *testing.T) {
+	sc, _, _ := setupTestFiles(t)
+	defer sc.Cleanup()
+	items := filepath.Join(sc.TempDir, "items.txt")
+	if err := os.WriteFile(items, []byte("Handle timeouts\n\n  Log retries  \n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name     string
+		args     []string
+		expected entry.Message
+		wantErr  bool
+	}{
+		{"bullets", []string{"Be brief", "Cite files"}, entry.Message{Text: "- Be brief\n- Cite files"}, false},
+		{"numbered", []string{"--numbered", "a", "b"}, entry.Message{Text: "1. a\n2. b"}, false},
+		{"from file", []string{"--from-file", items, "--numbered", "First"}, entry.Message{Text: "1. First\n2. Handle timeouts\n3. Log retries", Source: items}, false},
+		{"no items", []string{"--numbered"}, entry.Message{}, true},
+		{"missing file", []string{"--from-file", items + ".missing"}, entry.Message{}, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			entries, err := listSub(context.Background(), sc, tc.args)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if tc.wantErr {
+				return
+			}
+			if expected := []entry.Entry{tc.expected}; !reflect.DeepEqual(entries, expected) {
+				t.Errorf("Expected %q\n  Actual %q", expected, entries)
+			}
+		})
+	}
+}
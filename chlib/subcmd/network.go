@@ -0,0 +1,144 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package subcmd
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Default network limits, used where NetworkLimits leaves a field zero.
+const (
+	DefaultRequestsPerSecond = 5
+	DefaultMaxRequests       = 1000
+	DefaultMaxBytes          = 100 << 20
+)
+
+// ErrNetworkBudget is the error, of KindRemote, for a request or response
+// beyond a run's NetworkLimits.
+var ErrNetworkBudget = errors.New("network budget exhausted")
+
+// NetworkLimits bound the HTTP requests that subcommands such as slack
+// make in one run, so that a mistake can't hammer a service or quietly
+// download gigabytes. A zero field takes its default.
+type NetworkLimits struct {
+	// RequestsPerSecond is how often requests may be sent to each host.
+	RequestsPerSecond float64
+	// MaxRequests is how many requests may be sent in all.
+	MaxRequests int
+	// MaxBytes is how many bytes of response bodies may be read in all.
+	MaxBytes int64
+}
+
+// Network sends the HTTP requests of a run's subcommands, spacing out the
+// requests to each host and enforcing the run's budget of requests and
+// bytes. It is safe for concurrent use.
+type Network struct {
+	limits   NetworkLimits
+	client   *http.Client
+	mu       sync.Mutex
+	next     map[string]time.Time // when each host may next be sent a request
+	requests int
+	bytes    int64
+}
+
+// NewNetwork returns a Network enforcing limits that sends requests with
+// transport, or if it is nil, with http.DefaultTransport.
+func NewNetwork(limits NetworkLimits, transport http.RoundTripper) *Network {
+	if limits.RequestsPerSecond <= 0 {
+		limits.RequestsPerSecond = DefaultRequestsPerSecond
+	}
+	if limits.MaxRequests <= 0 {
+		limits.MaxRequests = DefaultMaxRequests
+	}
+	if limits.MaxBytes <= 0 {
+		limits.MaxBytes = DefaultMaxBytes
+	}
+	return &Network{limits: limits, client: &http.Client{Transport: transport}, next: map[string]time.Time{}}
+}
+
+// Do sends req once its host's rate limit allows, as http.Client.Do would.
+// It fails with a KindRemote error once the run's request budget is spent,
+// and reading the response body fails once the byte budget is.
+func (n *Network) Do(req *http.Request) (*http.Response, error) {
+	wait, err := n.reserve(req.URL.Host)
+	if err != nil {
+		return nil, err
+	}
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = &budgetedBody{body: resp.Body, network: n}
+	return resp, nil
+}
+
+// reserve counts a request to host against the budget and returns how long
+// to wait before sending it.
+func (n *Network) reserve(host string) (time.Duration, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.requests >= n.limits.MaxRequests {
+		return 0, Errorf(KindRemote, "%w: no more than %d requests may be sent", ErrNetworkBudget, n.limits.MaxRequests)
+	}
+	n.requests++
+	now := time.Now()
+	at := n.next[host]
+	if at.Before(now) {
+		at = now
+	}
+	n.next[host] = at.Add(time.Duration(float64(time.Second) / n.limits.RequestsPerSecond))
+	return at.Sub(now), nil
+}
+
+// budgetedBody is a response body that counts what is read from it
+// against its Network's byte budget.
+type budgetedBody struct {
+	body    io.ReadCloser
+	network *Network
+}
+
+func (b *budgetedBody) Read(p []byte) (int, error) {
+	count, err := b.body.Read(p)
+	n := b.network
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.bytes += int64(count)
+	if n.bytes > n.limits.MaxBytes {
+		return count, Errorf(KindRemote, "%w: no more than %d bytes may be downloaded", ErrNetworkBudget, n.limits.MaxBytes)
+	}
+	return count, err
+}
+
+func (b *budgetedBody) Close() error {
+	return b.body.Close()
+}
@@ -0,0 +1,69 @@
+package subcmd
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNetworkRateLimit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer server.Close()
+
+	network := NewNetwork(NetworkLimits{RequestsPerSecond: 20}, nil)
+	start := time.Now()
+	for range 3 {
+		req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		resp, err := network.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	// The first request goes at once and the other two 50ms apart.
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("Expected three requests at 20 per second to take at least 100ms\n  Actual %v", elapsed)
+	}
+}
+
+func TestNetworkBudget(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, strings.Repeat("x", 600))
+	}))
+	defer server.Close()
+
+	get := func(network *Network) error {
+		req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		resp, err := network.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		_, err = io.ReadAll(resp.Body)
+		return err
+	}
+
+	network := NewNetwork(NetworkLimits{RequestsPerSecond: 1000, MaxRequests: 2}, nil)
+	for i := range 2 {
+		if err := get(network); err != nil {
+			t.Fatalf("Request %d: %v", i+1, err)
+		}
+	}
+	if err := get(network); !errors.Is(err, ErrNetworkBudget) || KindOf(err) != KindRemote {
+		t.Errorf("Expected the third request to exceed the request budget\n  Actual %v", err)
+	}
+
+	network = NewNetwork(NetworkLimits{RequestsPerSecond: 1000, MaxBytes: 1000}, nil)
+	if err := get(network); err != nil {
+		t.Fatal(err)
+	}
+	if err := get(network); !errors.Is(err, ErrNetworkBudget) {
+		t.Errorf("Expected the second download to exceed the byte budget\n  Actual %v", err)
+	}
+}
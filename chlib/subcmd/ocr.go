@@ -0,0 +1,90 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package subcmd
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+)
+
+// ocrFlags are the flags of the ocr subcommand.
+type ocrFlags struct {
+	language *string
+}
+
+func addOCRFlags(flags *flag.FlagSet) ocrFlags {
+	return ocrFlags{
+		language: flags.String("language", "", "Recognize text in `lang`, a tesseract language such as deu or eng+fra (default eng)"),
+	}
+}
+
+// ocrSub implements "ocr image...": it extracts the text from each image,
+// such as a screenshot of an error dialog, with tesseract, and adds it as a
+// message.
+func ocrSub(ctx context.Context, sc Context, args []string) ([]entry.Entry, error) {
+	flags := newSubcommandFlags("ocr")
+	f := addOCRFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return nil, Errorf(KindUsage, "invalid ocr flags: %v", err)
+	}
+	if flags.NArg() == 0 {
+		return nil, Errorf(KindUsage, "ocr takes one or more images, e.g. ocr screenshot.png")
+	}
+	tesseract, err := exec.LookPath("tesseract")
+	if err != nil {
+		return nil, Errorf(KindExec, "ocr requires tesseract on PATH (https://github.com/tesseract-ocr/tesseract)")
+	}
+
+	return eachPath(ctx, sc, "ocr", flags.Args(), func(imagePath string) ([]entry.Entry, error) {
+		localPath := imagePath
+		if hostname, remotePath, ok := strings.Cut(imagePath, ":"); ok {
+			tempFile, _, err := copyRemoteFileToTemp(ctx, sc, hostname, remotePath)
+			if err != nil {
+				return nil, err
+			}
+			localPath = tempFile
+		} else if _, err := os.Stat(imagePath); err != nil {
+			return nil, Errorf(KindMissingFile, "file does not exist: %v", imagePath)
+		}
+
+		cmdArgs := []string{localPath, "stdout"}
+		if *f.language != "" {
+			cmdArgs = append(cmdArgs, "-l", *f.language)
+		}
+		cmd := exec.CommandContext(ctx, tesseract, cmdArgs...)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		output, err := cmd.Output()
+		if err != nil {
+			return nil, Errorf(KindExec, "tesseract failed on %s: %v\nOutput: %s", imagePath, contextError(ctx, err), stderr.String())
+		}
+		text := strings.TrimSpace(string(output))
+		if text == "" {
+			return nil, Errorf(KindExec, "no text found in %s", imagePath)
+		}
+		return []entry.Entry{entry.Message{Text: text, Source: imagePath}}, nil
+	})
+}
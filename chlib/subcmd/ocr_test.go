@@ -0,0 +1,56 @@
+package subcmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+)
+
+func TestOCRSub(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("ocr test uses a shell script")
+	}
+	// A stand-in for tesseract that reports its arguments as the text.
+	binDir := t.TempDir()
+	script := "#!/bin/sh\ncase \"$1\" in *blank.png) exit 0;; esac\necho \"Error: disk full ($*)\"\n"
+	if err := os.WriteFile(filepath.Join(binDir, "tesseract"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", binDir)
+
+	sc, _, _ := setupTestFiles(t)
+	defer sc.Cleanup()
+	imagePath := filepath.Join(sc.TempDir, "dialog.png")
+	if err := os.WriteFile(imagePath, []byte("not really a PNG"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := ocrSub(context.Background(), sc, []string{"--language", "deu", imagePath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []entry.Entry{entry.Message{Text: "Error: disk full (" + imagePath + " stdout -l deu)", Source: imagePath}}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("Expected %v\n  Actual %v", expected, entries)
+	}
+
+	blankPath := filepath.Join(sc.TempDir, "blank.png")
+	if err := os.WriteFile(blankPath, []byte("not really a PNG"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{{}, {filepath.Join(sc.TempDir, "missing.png")}, {blankPath}} {
+		if _, err := ocrSub(context.Background(), sc, args); err == nil {
+			t.Errorf("Expected an error for %q", args)
+		}
+	}
+
+	t.Setenv("PATH", t.TempDir())
+	if _, err := ocrSub(context.Background(), sc, []string{imagePath}); err == nil {
+		t.Error("Expected an error without tesseract")
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package subcmd
+
+import (
+	"context"
+	"flag"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+	"github.com/eloquence-cloud/ch/chlib/openapi"
+)
+
+// openapiFlags are the flags of the openapi subcommand.
+type openapiFlags struct {
+	paths *stringList
+}
+
+func addOpenAPIFlags(flags *flag.FlagSet) openapiFlags {
+	f := openapiFlags{paths: &stringList{}}
+	flags.Var(f.paths, "paths", "Summarize only the endpoints whose paths match `glob`, in which * matches anything, even /, e.g. '/users*' (repeatable)")
+	return f
+}
+
+// openapiSub implements "openapi spec...": it adds a compact summary of
+// each OpenAPI or Swagger document's endpoints and schemas, in place of a
+// spec too large to include whole.
+func openapiSub(ctx context.Context, sc Context, args []string) ([]entry.Entry, error) {
+	flags := newSubcommandFlags("openapi")
+	f := addOpenAPIFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return nil, Errorf(KindUsage, "invalid openapi flags: %v", err)
+	}
+	if flags.NArg() == 0 {
+		return nil, Errorf(KindUsage, "openapi takes one or more OpenAPI documents, e.g. openapi --paths '/users*' api/openapi.yaml")
+	}
+	return eachPath(ctx, sc, "openapi", flags.Args(), func(specPath string) ([]entry.Entry, error) {
+		spec, err := readLocalOrRemote(ctx, sc, specPath)
+		if err != nil {
+			return nil, err
+		}
+		summary, err := openapi.Summarize([]byte(spec), *f.paths)
+		if err != nil {
+			return nil, Errorf(KindOther, "%s: %v", specPath, err)
+		}
+		return []entry.Entry{
+			entry.Message{Text: "Summary of the OpenAPI document " + specPath + ":"},
+			entry.Output{Output: summary, Command: "openapi " + specPath, Lang: "text"},
+		}, nil
+	})
+}
@@ -0,0 +1,56 @@
+package subcmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+)
+
+func TestOpenAPISub(t *testing.T) {
+	sc, fileWithContent, _ := setupTestFiles(t)
+	defer sc.Cleanup()
+	spec := filepath.Join(sc.TempDir, "openapi.yaml")
+	content := `openapi: 3.1.0
+info: {title: Orders, version: "1"}
+paths:
+  /orders:
+    get:
+      summary: List orders
+      responses:
+        '200': {description: OK}
+  /users:
+    get:
+      summary: List users
+      responses:
+        '200': {description: OK}
+`
+	if err := os.WriteFile(spec, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := openapiSub(context.Background(), sc, []string{"--paths", "/orders*", spec})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Expected a label and a summary\n  Actual %#v", entries)
+	}
+	if label := entries[0].(entry.Message).Text; label != "Summary of the OpenAPI document "+spec+":" {
+		t.Errorf("Unexpected label %q", label)
+	}
+	summary := entries[1].(entry.Output).Output
+	if !strings.Contains(summary, "GET /orders — List orders") || strings.Contains(summary, "/users") {
+		t.Errorf("Expected only the orders endpoint\n  Actual %s", summary)
+	}
+
+	if _, err := openapiSub(context.Background(), sc, []string{fileWithContent}); err == nil {
+		t.Error("Expected an error for a file that isn't an OpenAPI document")
+	}
+	if _, err := openapiSub(context.Background(), sc, nil); KindOf(err) != KindUsage {
+		t.Errorf("Expected a usage error without a document\n  Actual %v", err)
+	}
+}
@@ -0,0 +1,359 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package subcmd
+
+import (
+	"bufio"
+	"go/parser"
+	"go/token"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+)
+
+// Orders of attached files, as given to attach --order.
+const (
+	OrderPath    = "path"
+	OrderImports = "imports"
+)
+
+var (
+	// pythonImportPattern matches "import a.b, c" and "from .a import b, c".
+	pythonImportPattern = regexp.MustCompile(`^\s*(?:from\s+(\.*[\w.]*)\s+import\s+([\w\s,.*()]+)|import\s+([\w\s,.]+))`)
+	// jsImportPattern matches the module of an import, export ... from,
+	// require, or dynamic import in JavaScript and TypeScript.
+	jsImportPattern = regexp.MustCompile(`(?:\bfrom\s*|\bimport\s*\(?\s*|\brequire\s*\(\s*)['"]([^'"\n]+)['"]`)
+	// includePattern matches a C or C++ #include of a project header.
+	includePattern = regexp.MustCompile(`^\s*#\s*include\s*"([^"]+)"`)
+)
+
+// jsExtensions are the extensions tried, in order, for a JavaScript or
+// TypeScript import that names a module without one.
+var jsExtensions = []string{".ts", ".tsx", ".js", ".jsx", ".mjs", ".cjs"}
+
+// orderByImports reorders the files among entries so that each comes after
+// the attached files it imports, keeping their order otherwise; files in an
+// import cycle stay in their order. Go imports are resolved by package,
+// with the module path in go.mod; Python, JavaScript and TypeScript
+// imports, and C and C++ #include "...", by path. Other entries keep their
+// places.
+func orderByImports(entries []entry.Entry) []entry.Entry {
+	var slots []int
+	var files []entry.File
+	for i, e := range entries {
+		if file, ok := e.(entry.File); ok {
+			slots = append(slots, i)
+			files = append(files, file)
+		}
+	}
+	g := newImportGraph(files)
+	ordered := make([]entry.Entry, len(entries))
+	copy(ordered, entries)
+	for i, file := range g.sorted() {
+		ordered[slots[i]] = file
+	}
+	return ordered
+}
+
+// importGraph holds the attached files and which of them each imports.
+type importGraph struct {
+	files []entry.File
+	// byPath indexes the files by their cleaned, slash-separated paths.
+	byPath map[string]int
+	// byGoPackage lists the Go files of each import path.
+	byGoPackage map[string][]int
+	// modules caches the module path of the go.mod governing a directory.
+	modules map[string]goModule
+	imports [][]int
+}
+
+// goModule is a Go module: its path, and the directory of its go.mod.
+type goModule struct {
+	path, dir string
+}
+
+func newImportGraph(files []entry.File) *importGraph {
+	g := &importGraph{
+		files:       files,
+		byPath:      map[string]int{},
+		byGoPackage: map[string][]int{},
+		modules:     map[string]goModule{},
+		imports:     make([][]int, len(files)),
+	}
+	for i, file := range files {
+		g.byPath[slashPath(file.OriginalPath)] = i
+		if entry.LanguageFor(file.OriginalPath, nil) == "go" {
+			if pkg := g.goImportPath(filepath.Dir(file.OriginalPath)); pkg != "" {
+				g.byGoPackage[pkg] = append(g.byGoPackage[pkg], i)
+			}
+		}
+	}
+	for i, file := range files {
+		for _, j := range g.fileImports(file) {
+			if j != i && !slices.Contains(g.imports[i], j) {
+				g.imports[i] = append(g.imports[i], j)
+			}
+		}
+	}
+	return g
+}
+
+// sorted returns the files in dependency order: a depth-first walk in the
+// files' original order that places each file after those it imports.
+func (g *importGraph) sorted() []entry.File {
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make([]int, len(g.files))
+	var sorted []entry.File
+	var visit func(i int)
+	visit = func(i int) {
+		if state[i] != unvisited {
+			return
+		}
+		state[i] = visiting
+		for _, j := range g.imports[i] {
+			visit(j)
+		}
+		state[i] = done
+		sorted = append(sorted, g.files[i])
+	}
+	for i := range g.files {
+		visit(i)
+	}
+	return sorted
+}
+
+// fileImports returns the indexes of the attached files that file imports.
+func (g *importGraph) fileImports(file entry.File) []int {
+	lang := entry.LanguageFor(file.OriginalPath, nil)
+	dir := path.Dir(slashPath(file.OriginalPath))
+	var imports []int
+	switch lang {
+	case "go":
+		parsed, err := parser.ParseFile(token.NewFileSet(), file.StoragePath, nil, parser.ImportsOnly)
+		if err != nil {
+			return nil
+		}
+		for _, spec := range parsed.Imports {
+			if pkg, err := strconv.Unquote(spec.Path.Value); err == nil {
+				imports = append(imports, g.byGoPackage[pkg]...)
+			}
+		}
+	case "python":
+		eachLine(file.StoragePath, func(line string) {
+			for _, module := range pythonImports(line) {
+				if i, ok := g.pythonModule(dir, module); ok {
+					imports = append(imports, i)
+				}
+			}
+		})
+	case "javascript", "jsx", "typescript", "tsx", "vue":
+		eachLine(file.StoragePath, func(line string) {
+			for _, match := range jsImportPattern.FindAllStringSubmatch(line, -1) {
+				if i, ok := g.jsModule(dir, match[1]); ok {
+					imports = append(imports, i)
+				}
+			}
+		})
+	case "c", "cpp":
+		eachLine(file.StoragePath, func(line string) {
+			if match := includePattern.FindStringSubmatch(line); match != nil {
+				if i, ok := g.header(dir, match[1]); ok {
+					imports = append(imports, i)
+				}
+			}
+		})
+	}
+	return imports
+}
+
+// goImportPath returns the import path of the Go package in dir, from the
+// nearest go.mod at or above it, or "" if there is none.
+func (g *importGraph) goImportPath(dir string) string {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+	module := g.goModule(abs)
+	if module.path == "" {
+		return ""
+	}
+	rel, err := filepath.Rel(module.dir, abs)
+	if err != nil {
+		return ""
+	}
+	return path.Join(module.path, filepath.ToSlash(rel))
+}
+
+func (g *importGraph) goModule(dir string) goModule {
+	if module, ok := g.modules[dir]; ok {
+		return module
+	}
+	var module goModule
+	if path := goModulePath(filepath.Join(dir, "go.mod")); path != "" {
+		module = goModule{path: path, dir: dir}
+	} else if parent := filepath.Dir(dir); parent != dir {
+		module = g.goModule(parent)
+	}
+	g.modules[dir] = module
+	return module
+}
+
+// goModulePath returns the module path declared by the go.mod file at
+// path, or "" if there is none.
+func goModulePath(path string) string {
+	var module string
+	eachLine(path, func(line string) {
+		if rest, ok := strings.CutPrefix(strings.TrimSpace(line), "module"); ok && module == "" {
+			module = strings.Trim(strings.TrimSpace(rest), `"`)
+		}
+	})
+	return module
+}
+
+// pythonImports returns the modules that an import statement on line may
+// name, as dotted paths: for "from a import b", both a.b (if b is a
+// module) and a.
+func pythonImports(line string) []string {
+	match := pythonImportPattern.FindStringSubmatch(line)
+	if match == nil {
+		return nil
+	}
+	var modules []string
+	if match[1] == "" {
+		for _, name := range strings.Split(match[3], ",") {
+			if fields := strings.Fields(name); len(fields) > 0 {
+				modules = append(modules, fields[0])
+			}
+		}
+		return modules
+	}
+	from := match[1]
+	for _, name := range strings.Split(strings.Trim(match[2], "() \t"), ",") {
+		fields := strings.Fields(name)
+		if len(fields) == 0 || fields[0] == "*" {
+			continue
+		}
+		if strings.HasSuffix(from, ".") {
+			modules = append(modules, from+fields[0])
+		} else {
+			modules = append(modules, from+"."+fields[0])
+		}
+	}
+	return append(modules, from)
+}
+
+// pythonModule finds the attached file of a module imported from a file in
+// dir: relative to dir for a relative import, or else by its path's suffix.
+func (g *importGraph) pythonModule(dir, module string) (int, bool) {
+	dots := len(module) - len(strings.TrimLeft(module, "."))
+	name := strings.ReplaceAll(module[dots:], ".", "/")
+	var candidates []string
+	if name != "" {
+		candidates = []string{name + ".py", name + "/__init__.py"}
+	} else {
+		candidates = []string{"__init__.py"}
+	}
+	if dots > 0 {
+		for range dots - 1 {
+			dir = path.Dir(dir)
+		}
+		for _, candidate := range candidates {
+			if i, ok := g.byPath[path.Join(dir, candidate)]; ok {
+				return i, true
+			}
+		}
+		return 0, false
+	}
+	return g.bySuffix(candidates...)
+}
+
+// jsModule finds the attached file of a relative module specifier imported
+// from a file in dir, trying the extensions and index files that Node and
+// TypeScript do. Package imports, which don't start with ".", are ignored.
+func (g *importGraph) jsModule(dir, specifier string) (int, bool) {
+	if !strings.HasPrefix(specifier, ".") {
+		return 0, false
+	}
+	base := path.Join(dir, specifier)
+	candidates := []string{base}
+	// TypeScript sources are imported by the name of their compiled .js.
+	stem := strings.TrimSuffix(base, path.Ext(base))
+	for _, ext := range jsExtensions {
+		candidates = append(candidates, base+ext, stem+ext, base+"/index"+ext)
+	}
+	for _, candidate := range candidates {
+		if i, ok := g.byPath[candidate]; ok {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// header finds the attached file of a header included from a file in dir:
+// beside it, or else anywhere with a matching path suffix.
+func (g *importGraph) header(dir, name string) (int, bool) {
+	if i, ok := g.byPath[path.Join(dir, name)]; ok {
+		return i, true
+	}
+	return g.bySuffix(path.Clean(name))
+}
+
+// bySuffix returns the first attached file whose path is, or ends with a
+// path element followed by, one of the suffixes, in order of preference.
+func (g *importGraph) bySuffix(suffixes ...string) (int, bool) {
+	for _, suffix := range suffixes {
+		for i, file := range g.files {
+			p := slashPath(file.OriginalPath)
+			if p == suffix || strings.HasSuffix(p, "/"+suffix) {
+				return i, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// eachLine calls fn with each line of the file at path, if it can be read.
+func eachLine(path string, fn func(line string)) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		fn(scanner.Text())
+	}
+}
+
+// slashPath returns p cleaned and with forward slashes.
+func slashPath(p string) string {
+	return path.Clean(filepath.ToSlash(p))
+}
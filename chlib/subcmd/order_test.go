@@ -0,0 +1,98 @@
+package subcmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+)
+
+func TestAttachOrderImports(t *testing.T) {
+	testCases := []struct {
+		name     string
+		files    map[string]string
+		expected []string
+	}{
+		{
+			name: "Go packages",
+			files: map[string]string{
+				"go.mod":            "module example.com/m\n\ngo 1.22\n",
+				"api/handler.go":    "package api\n\nimport (\n\t\"fmt\"\n\n\t\"example.com/m/store\"\n)\n",
+				"api/routes.go":     "package api\n",
+				"main.go":           "package main\n\nimport \"example.com/m/api\"\n",
+				"store/store.go":    "package store\n\nimport \"example.com/m/model\"\n",
+				"model/model.go":    "package model\n",
+				"store/store_2.go":  "package store\n",
+				"unrelated/util.go": "package unrelated\n",
+			},
+			expected: []string{"model/model.go", "store/store.go", "store/store_2.go", "api/handler.go", "api/routes.go", "go.mod", "main.go", "unrelated/util.go"},
+		},
+		{
+			name: "Python modules",
+			files: map[string]string{
+				"app.py":           "import os\nfrom pkg.service import run\n",
+				"pkg/__init__.py":  "",
+				"pkg/service.py":   "from . import models\nfrom .util import helper as h\n",
+				"pkg/models.py":    "import pkg.util\n",
+				"pkg/util.py":      "",
+				"scripts/setup.py": "import app, pkg\n",
+			},
+			expected: []string{"pkg/util.py", "pkg/models.py", "pkg/__init__.py", "pkg/service.py", "app.py", "scripts/setup.py"},
+		},
+		{
+			name: "TypeScript and JavaScript modules",
+			files: map[string]string{
+				"src/index.ts":       "import { App } from './app.js';\nexport * from \"./types\";\n",
+				"src/app.ts":         "import React from 'react';\nimport type { User } from './types';\nconst lazy = import('./views');\n",
+				"src/types.ts":       "export interface User {}\n",
+				"src/views/index.js": "const { User } = require('../types');\n",
+			},
+			expected: []string{"src/types.ts", "src/views/index.js", "src/app.ts", "src/index.ts"},
+		},
+		{
+			name: "C headers and a cycle",
+			files: map[string]string{
+				"a.c":            "#include <stdio.h>\n#include \"include/list.h\"\n",
+				"b.h":            "#include \"c.h\"\n",
+				"c.h":            "#include \"b.h\"\n",
+				"include/list.h": "#include \"node.h\"\n",
+				"include/node.h": "",
+			},
+			expected: []string{"include/node.h", "include/list.h", "a.c", "c.h", "b.h"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range tc.files {
+				path := filepath.Join(dir, name)
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			entries, err := attachSub(context.Background(), Context{}, []string{"--order", "imports", dir})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var actual []string
+			for _, e := range entries {
+				rel, _ := filepath.Rel(dir, e.(entry.File).OriginalPath)
+				actual = append(actual, filepath.ToSlash(rel))
+			}
+			if !reflect.DeepEqual(actual, tc.expected) {
+				t.Errorf("Expected %v\n  Actual %v", tc.expected, actual)
+			}
+		})
+	}
+
+	if _, err := attachSub(context.Background(), Context{}, []string{"--order", "size", "."}); err == nil {
+		t.Errorf("Expected an error for an invalid order")
+	}
+}
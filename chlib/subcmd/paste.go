@@ -0,0 +1,166 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package subcmd
+
+import (
+	"context"
+	"flag"
+	"log/slog"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+	"golang.design/x/clipboard"
+)
+
+// pasteFlags are the flags of the paste subcommand.
+type pasteFlags struct {
+	text *bool
+}
+
+func addPasteFlags(flags *flag.FlagSet) pasteFlags {
+	return pasteFlags{
+		text: flags.Bool("text", false, "Insert the clipboard's text even if it holds files copied in a file manager"),
+	}
+}
+
+// pasteSub implements "paste": it inserts the text on the clipboard or, if
+// files copied in a file manager (Finder, Explorer, Nautilus, and the
+// like) are there, attaches them as attach would.
+func pasteSub(ctx context.Context, sc Context, args []string) ([]entry.Entry, error) {
+	flags := newSubcommandFlags("paste")
+	f := addPasteFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return nil, Errorf(KindUsage, "invalid paste flags: %v", err)
+	}
+	if flags.NArg() > 0 {
+		return nil, Errorf(KindUsage, "paste takes no arguments")
+	}
+	if !*f.text {
+		if paths := clipboardFiles(ctx); len(paths) > 0 {
+			slog.Debug("attaching files from the clipboard", "files", len(paths))
+			// Files beneath the working directory are shown by their
+			// relative paths, as if named on the command line.
+			cwd, _ := os.Getwd()
+			for i, path := range paths {
+				if rel, err := filepath.Rel(cwd, path); err == nil && !strings.HasPrefix(rel, "..") {
+					paths[i] = rel
+				}
+			}
+			return attachSub(ctx, sc, append([]string{"--"}, paths...))
+		}
+	}
+	content, err := readClipboardText()
+	if err != nil {
+		return nil, err
+	}
+	return []entry.Entry{entry.Message{Text: content, Source: "clipboard"}}, nil
+}
+
+// initClipboard initializes the clipboard. It is a variable so that tests
+// can make it fail.
+var initClipboard = clipboard.Init
+
+// readClipboardText returns the text on the clipboard. The command line
+// doesn't initialize the clipboard under -stdin-dsl, which may run with
+// no display, so it is initialized here, failing with a usage error if
+// there is none, rather than quietly reading nothing.
+func readClipboardText() (string, error) {
+	if err := initClipboard(); err != nil {
+		return "", Errorf(KindUsage, "no clipboard to read: %v", err)
+	}
+	return string(clipboard.Read(clipboard.FmtText)), nil
+}
+
+// fileListScript is the JavaScript for Automation that prints the paths
+// of the files on the macOS pasteboard, one per line.
+const fileListScript = `ObjC.import('AppKit');
+var urls = $.NSPasteboard.generalPasteboard.readObjectsForClassesOptions($([$.NSURL]), $({NSPasteboardURLReadingFileURLsOnlyKey: true}));
+var paths = [];
+for (var i = 0; urls && i < urls.count; i++) {
+	paths.push(urls.objectAtIndex(i).path.js);
+}
+paths.join('\n');`
+
+// fileListCommand returns the command line that prints the files on the
+// clipboard on goos, with the given environment and installed programs,
+// or nil if there is no way to read them. Its output is read by
+// parseFileList.
+func fileListCommand(goos string, getenv func(string) string, lookPath func(string) (string, error)) []string {
+	installed := func(name string) bool {
+		_, err := lookPath(name)
+		return err == nil
+	}
+	switch goos {
+	case "darwin":
+		return []string{"osascript", "-l", "JavaScript", "-e", fileListScript}
+	case "windows":
+		return []string{"powershell", "-NoProfile", "-STA", "-Command", "Get-Clipboard -Format FileDropList | ForEach-Object { $_.FullName }"}
+	case "linux", "freebsd", "openbsd", "netbsd":
+		// File managers offer the files copied as a text/uri-list.
+		if getenv("WAYLAND_DISPLAY") != "" && installed("wl-paste") {
+			return []string{"wl-paste", "--no-newline", "--type", "text/uri-list"}
+		}
+		if getenv("DISPLAY") != "" && installed("xclip") {
+			return []string{"xclip", "-selection", "clipboard", "-out", "-target", "text/uri-list"}
+		}
+	}
+	return nil
+}
+
+// parseFileList returns the local paths in the output of fileListCommand:
+// file: URIs, or paths, one per line. Comments, the "copy" or "cut" that
+// starts GNOME's list, and URIs of other schemes are skipped.
+func parseFileList(output string) []string {
+	var paths []string
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "" || line == "copy" || line == "cut" || strings.HasPrefix(line, "#"):
+		case strings.HasPrefix(line, "file:"):
+			if u, err := url.Parse(line); err == nil && (u.Host == "" || u.Host == "localhost") && u.Path != "" {
+				paths = append(paths, u.Path)
+			}
+		case !strings.Contains(line, "://"):
+			paths = append(paths, line)
+		}
+	}
+	return paths
+}
+
+// clipboardFiles returns the files on the clipboard, or nil if there are
+// none or they can't be read, in which case paste falls back to text.
+func clipboardFiles(ctx context.Context) []string {
+	args := fileListCommand(runtime.GOOS, os.Getenv, exec.LookPath)
+	if args == nil {
+		return nil
+	}
+	output, err := exec.CommandContext(ctx, args[0], args[1:]...).Output()
+	if err != nil {
+		// The clipboard holds no file list, or the tool failed.
+		slog.Debug("no files on the clipboard", "error", err)
+		return nil
+	}
+	return parseFileList(string(output))
+}
@@ -0,0 +1,71 @@
+package subcmd
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseFileList(t *testing.T) {
+	tests := []struct {
+		name     string
+		output   string
+		expected []string
+	}{
+		{"URI list", "file:///home/me/src/main.go\r\nfile:///home/me/My%20Notes.txt\r\n", []string{"/home/me/src/main.go", "/home/me/My Notes.txt"}},
+		{"GNOME", "copy\nfile:///home/me/a.go\n", []string{"/home/me/a.go"}},
+		{"Comments and other schemes", "# from Dolphin\nhttps://example.com/x\nsmb://server/share/y\nfile://localhost/tmp/z\n", []string{"/tmp/z"}},
+		{"Paths", "/Users/me/a.go\n/Users/me/b.go", []string{"/Users/me/a.go", "/Users/me/b.go"}},
+		{"Empty", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual := parseFileList(tt.output)
+			if !reflect.DeepEqual(actual, tt.expected) {
+				t.Errorf("Expected %q\n  Actual %q", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestFileListCommand(t *testing.T) {
+	env := func(vars ...string) func(string) string {
+		return func(name string) string {
+			for _, v := range vars {
+				if v == name {
+					return "set"
+				}
+			}
+			return ""
+		}
+	}
+	installed := func(name string) (string, error) { return "/usr/bin/" + name, nil }
+	missing := func(string) (string, error) { return "", errors.New("not found") }
+
+	tests := []struct {
+		name     string
+		goos     string
+		getenv   func(string) string
+		lookPath func(string) (string, error)
+		program  string
+	}{
+		{"macOS", "darwin", env(), missing, "osascript"},
+		{"Windows", "windows", env(), missing, "powershell"},
+		{"Wayland", "linux", env("WAYLAND_DISPLAY", "DISPLAY"), installed, "wl-paste"},
+		{"X11", "linux", env("DISPLAY"), installed, "xclip"},
+		{"No tools", "linux", env("DISPLAY"), missing, ""},
+		{"No display", "linux", env(), installed, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := fileListCommand(tt.goos, tt.getenv, tt.lookPath)
+			program := ""
+			if args != nil {
+				program = args[0]
+			}
+			if program != tt.program {
+				t.Errorf("Expected %q\n  Actual %q", tt.program, args)
+			}
+		})
+	}
+}
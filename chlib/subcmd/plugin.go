@@ -0,0 +1,107 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package subcmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"os/exec"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+)
+
+// PluginPrefix begins the name of every plugin executable: the subcommand
+// "jira" is provided by an executable named "ch-jira" on PATH.
+const PluginPrefix = "ch-"
+
+// PluginProtocolVersion is the version of the plugin protocol, sent in every
+// PluginRequest.
+const PluginProtocolVersion = 1
+
+// PluginRequest is the JSON object a plugin reads from standard input. The
+// plugin replies on standard output with an entry.List, the same format
+// that -export writes; anything it writes to standard error is passed
+// through to the user. A non-zero exit status fails the subcommand.
+//
+// For example, "ch -c jira --priority high PROJ-123" runs ch-jira with
+// {"version": 1, "subcommand": "jira", "args": ["PROJ-123"], "workDir": "..."}
+// on standard input, and ch-jira might reply
+// {"entries": [{"type": "message", "content": "PROJ-123: Fix login"}]}.
+type PluginRequest struct {
+	Version    int      `json:"version"`
+	Subcommand string   `json:"subcommand"`
+	Args       []string `json:"args"`
+	// WorkDir is ch's working directory, which relative paths in Args are
+	// relative to.
+	WorkDir string `json:"workDir"`
+}
+
+// findPlugin returns a Func that runs the plugin for the subcommand name,
+// if there is one on PATH. Unlike built-in subcommands, plugins must be
+// named in full.
+func findPlugin(name string) (Func, bool) {
+	path, err := exec.LookPath(PluginPrefix + name)
+	if err != nil {
+		return nil, false
+	}
+	return func(ctx context.Context, sc Context, args []string) ([]entry.Entry, error) {
+		return runPlugin(ctx, sc, path, name, args)
+	}, true
+}
+
+func runPlugin(ctx context.Context, sc Context, path, name string, args []string) ([]entry.Entry, error) {
+	workDir, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	if args == nil {
+		args = []string{}
+	}
+	request, err := json.Marshal(PluginRequest{
+		Version:    PluginProtocolVersion,
+		Subcommand: name,
+		Args:       args,
+		WorkDir:    workDir,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Debug("running plugin", "path", path, "request_bytes", len(request))
+	cmd := exec.CommandContext(ctx, path)
+	cmd.Stdin = bytes.NewReader(request)
+	cmd.Stderr = os.Stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, Errorf(KindExec, "plugin %s failed: %v", path, err)
+	}
+	var list entry.List
+	if err := json.Unmarshal(output, &list); err != nil {
+		return nil, Errorf(KindExec, "plugin %s returned an invalid entry list: %v", path, err)
+	}
+	entries, err := entry.Import(sc.TempDir, list)
+	if err != nil {
+		return nil, Errorf(KindExec, "plugin %s returned an invalid entry list: %v", path, err)
+	}
+	return entries, nil
+}
@@ -0,0 +1,74 @@
+package subcmd
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+)
+
+func TestPlugin(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("plugin test uses a shell script")
+	}
+	binDir := t.TempDir()
+	requestPath := filepath.Join(binDir, "request.json")
+	script := "#!/bin/sh\ncat > " + requestPath + "\ncat <<'EOF'\n" +
+		`{"entries": [{"type": "message", "content": "from plugin"}, {"type": "file", "path": "remote.txt", "content": "data\n"}]}` +
+		"\nEOF\n"
+	if err := os.WriteFile(filepath.Join(binDir, "ch-tickets"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	failing := "#!/bin/sh\necho broken >&2\nexit 3\n"
+	if err := os.WriteFile(filepath.Join(binDir, "ch-broken"), []byte(failing), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	sc, err := NewContext()
+	if err != nil {
+		t.Fatalf("Failed to create context: %v", err)
+	}
+	defer sc.Cleanup()
+
+	entries, err := Process(context.Background(), sc, []string{"tickets", "--priority", "low", "PROJ-1", "PROJ-2"})
+	if err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 entries, got %v", entries)
+	}
+	expectedMessage := entry.Prioritized{Entry: entry.Message{Text: "from plugin"}, Priority: entry.PriorityLow}
+	if !reflect.DeepEqual(entries[0], expectedMessage) {
+		t.Errorf("Expected %v\n  Actual %v", expectedMessage, entries[0])
+	}
+	if file, ok := entry.Unwrap(entries[1]).(entry.File); !ok || file.OriginalPath != "remote.txt" {
+		t.Errorf("Expected a file entry for remote.txt, got %v", entries[1])
+	}
+
+	data, err := os.ReadFile(requestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var request PluginRequest
+	if err := json.Unmarshal(data, &request); err != nil {
+		t.Fatalf("Plugin received invalid JSON: %v", err)
+	}
+	wd, _ := os.Getwd()
+	expectedRequest := PluginRequest{Version: PluginProtocolVersion, Subcommand: "tickets", Args: []string{"PROJ-1", "PROJ-2"}, WorkDir: wd}
+	if !reflect.DeepEqual(request, expectedRequest) {
+		t.Errorf("Expected request %+v\n  Actual %+v", expectedRequest, request)
+	}
+
+	if _, err := Process(context.Background(), sc, []string{"broken"}); err == nil {
+		t.Error("Expected an error from a failing plugin")
+	}
+	if _, err := Process(context.Background(), sc, []string{"tick"}); err == nil {
+		t.Error("Expected plugins to require their full name")
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package subcmd
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+	"github.com/eloquence-cloud/ch/chlib/proto"
+)
+
+// protoFlags are the flags of the proto subcommand.
+type protoFlags struct {
+	noComments *bool
+	noOptions  *bool
+}
+
+func addProtoFlags(flags *flag.FlagSet) protoFlags {
+	return protoFlags{
+		noComments: flags.Bool("no-comments", false, "Leave out comments"),
+		noOptions:  flags.Bool("no-options", false, "Leave out option statements and [field options]"),
+	}
+}
+
+// protoSub implements "proto dir|file.proto...": it adds a compact listing
+// of the services, RPCs, messages, and enums of each .proto file, or of
+// each under a directory.
+func protoSub(ctx context.Context, sc Context, args []string) ([]entry.Entry, error) {
+	flags := newSubcommandFlags("proto")
+	f := addProtoFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return nil, Errorf(KindUsage, "invalid proto flags: %v", err)
+	}
+	if flags.NArg() == 0 {
+		return nil, Errorf(KindUsage, "proto takes .proto files or directories, e.g. proto --no-options api/")
+	}
+	opts := proto.Options{NoComments: *f.noComments, NoOptions: *f.noOptions}
+
+	return eachPath(ctx, sc, "proto", flags.Args(), func(protoPath string) ([]entry.Entry, error) {
+		files := []string{protoPath}
+		if info, err := os.Stat(protoPath); err == nil && info.IsDir() {
+			all, err := ListFiles(protoPath, sc.PruneDirs)
+			if err != nil {
+				return nil, Errorf(KindMissingFile, "failed to list %s: %v", protoPath, err)
+			}
+			files = nil
+			for _, file := range all {
+				if filepath.Ext(file) == ".proto" {
+					files = append(files, file)
+				}
+			}
+			if len(files) == 0 {
+				return nil, Errorf(KindMissingFile, "no .proto files under %s", protoPath)
+			}
+		}
+		var entries []entry.Entry
+		for _, file := range files {
+			source, err := readLocalOrRemote(ctx, sc, file)
+			if err != nil {
+				return nil, err
+			}
+			listing, err := proto.Summarize(source, opts)
+			if err != nil {
+				return nil, Errorf(KindOther, "%s: %v", file, err)
+			}
+			stored, err := entry.NewStoredFile(sc.TempDir, file, []byte(listing))
+			if err != nil {
+				return nil, fmt.Errorf("failed to store %s: %v", file, err)
+			}
+			stored = labelFiles([]entry.Entry{stored}, file, "", sc.PathAliases)[0].(entry.File)
+			stored.Label = stored.DisplayPath() + " (summary)"
+			if !strings.HasSuffix(file, ".proto") {
+				stored.Lang = "protobuf"
+			}
+			entries = append(entries, stored)
+		}
+		return entries, nil
+	})
+}
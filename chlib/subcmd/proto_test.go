@@ -0,0 +1,58 @@
+package subcmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+)
+
+func TestProtoSub(t *testing.T) {
+	sc, _, _ := setupTestFiles(t)
+	defer sc.Cleanup()
+	dir := filepath.Join(sc.TempDir, "api")
+	if err := os.MkdirAll(filepath.Join(dir, "v1"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"v1/orders.proto": "syntax = \"proto3\";\n// Orders.\nmessage Order { string id = 1 [json_name = \"ID\"]; }\n",
+		"v1/users.proto":  "service Users { rpc Get(GetRequest) returns (User); }\n",
+		"README.md":       "Not a proto file.\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := protoSub(context.Background(), sc, []string{"--no-comments", "--no-options", dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		filepath.Join(dir, "v1/orders.proto") + " (summary)": "message Order {\n  string id = 1;\n}\n",
+		filepath.Join(dir, "v1/users.proto") + " (summary)":  "service Users {\n  rpc Get(GetRequest) returns (User);\n}\n",
+	}
+	if len(entries) != len(expected) {
+		t.Fatalf("Expected %d files\n  Actual %#v", len(expected), entries)
+	}
+	for _, e := range entries {
+		file := e.(entry.File)
+		content, err := os.ReadFile(file.StoragePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want, ok := expected[file.Label]; !ok || string(content) != want {
+			t.Errorf("Unexpected %s:\n%s", file.Label, content)
+		}
+	}
+
+	if _, err := protoSub(context.Background(), sc, []string{filepath.Join(sc.TempDir, "empty.txt")}); err != nil {
+		t.Errorf("Expected an empty file to list as nothing\n  Actual %v", err)
+	}
+	if _, err := protoSub(context.Background(), sc, []string{sc.TempDir + "/none"}); KindOf(err) != KindMissingFile {
+		t.Errorf("Expected a missing-file error\n  Actual %v", err)
+	}
+}
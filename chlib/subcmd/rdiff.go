@@ -0,0 +1,71 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package subcmd
+
+import (
+	"context"
+	"flag"
+
+	"github.com/eloquence-cloud/ch/chlib/diff"
+	"github.com/eloquence-cloud/ch/chlib/entry"
+)
+
+// rdiffFlags are the flags of the rdiff subcommand.
+type rdiffFlags struct {
+	wordDiff *bool
+}
+
+func addRdiffFlags(flags *flag.FlagSet) rdiffFlags {
+	return rdiffFlags{
+		wordDiff: flags.Bool("word-diff", false, "Mark the changed words within lines instead of showing whole changed lines"),
+	}
+}
+
+// rdiffSub implements "rdiff old new": a unified diff between two files,
+// either of which may be remote (host:/path), fetched with scp. It is meant
+// for comparing a deployed file with its copy in the repository.
+func rdiffSub(ctx context.Context, sc Context, args []string) ([]entry.Entry, error) {
+	flags := newSubcommandFlags("rdiff")
+	f := addRdiffFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return nil, Errorf(KindUsage, "invalid rdiff flags: %v", err)
+	}
+	args = flags.Args()
+	if len(args) != 2 {
+		return nil, Errorf(KindUsage, "rdiff takes two files, e.g. rdiff host:/etc/nginx/nginx.conf ./nginx.conf")
+	}
+	var contents [2]string
+	for i, arg := range args {
+		content, err := readLocalOrRemote(ctx, sc, arg)
+		if err != nil {
+			return nil, err
+		}
+		contents[i] = content
+	}
+	compare := diff.Unified
+	if *f.wordDiff {
+		compare = diff.Words
+	}
+	return []entry.Entry{entry.Diff{
+		Path:  args[0] + " vs " + args[1],
+		Diff:  compare(args[0], args[1], contents[0], contents[1]),
+		Words: *f.wordDiff,
+	}}, nil
+}
@@ -0,0 +1,50 @@
+package subcmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+)
+
+func TestRdiffSub(t *testing.T) {
+	sc, filePath, _ := setupTestFiles(t)
+	defer sc.Cleanup()
+
+	otherPath := filepath.Join(filepath.Dir(filePath), "other.txt")
+	if err := os.WriteFile(otherPath, []byte("Other content\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := rdiffSub(context.Background(), sc, []string{filePath, otherPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []entry.Entry{entry.Diff{
+		Path: filePath + " vs " + otherPath,
+		Diff: "--- " + filePath + "\n+++ " + otherPath + "\n@@ -1 +1 @@\n-File content\n+Other content\n",
+	}}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("Expected %v\n  Actual %v", expected, entries)
+	}
+
+	entries, err = rdiffSub(context.Background(), sc, []string{"--word-diff", filePath, otherPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []entry.Entry{entry.Diff{
+		Path:  filePath + " vs " + otherPath,
+		Diff:  "--- " + filePath + "\n+++ " + otherPath + "\n@@ -1 +1 @@\n[-File-]{+Other+} content\n",
+		Words: true,
+	}}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("Expected %v\n  Actual %v", expected, entries)
+	}
+
+	if _, err := rdiffSub(context.Background(), sc, []string{filePath}); err == nil {
+		t.Errorf("Expected an error for a single argument")
+	}
+}
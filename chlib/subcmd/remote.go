@@ -0,0 +1,63 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package subcmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+func copyRemoteFileToTemp(ctx context.Context, sc Context, hostname, remotePath string) (string, string, error) {
+	tempFile, err := os.CreateTemp(sc.TempDir, "file-")
+	if err != nil {
+		return "", "", err
+	}
+	tempFileName := tempFile.Name()
+	tempFile.Close()
+
+	cmd := exec.CommandContext(ctx, "scp", fmt.Sprintf("%s:%s", hostname, remotePath), tempFileName)
+	slog.Debug("copying remote file", "host", hostname, "path", remotePath, "to", tempFileName)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", "", Errorf(KindRemote, "failed to copy remote file: %v\nOutput: %s", err, string(output))
+	}
+	return tempFileName, fmt.Sprintf("%s:%s", hostname, remotePath), nil
+}
+
+// readLocalOrRemote returns the contents of a local file or, for a
+// host:/path argument, of a remote one.
+func readLocalOrRemote(ctx context.Context, sc Context, filePath string) (string, error) {
+	if hostname, remotePath, ok := strings.Cut(filePath, ":"); ok {
+		tempFile, _, err := copyRemoteFileToTemp(ctx, sc, hostname, remotePath)
+		if err != nil {
+			return "", err
+		}
+		filePath = tempFile
+	}
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return "", Errorf(KindMissingFile, "failed to read file: %v", err)
+	}
+	return string(content), nil
+}
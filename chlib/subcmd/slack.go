@@ -0,0 +1,241 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package subcmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+	"github.com/eloquence-cloud/ch/chlib/keyring"
+)
+
+// slackAPI is the base URL of the Slack Web API; tests point it elsewhere.
+var slackAPI = "https://slack.com/api/"
+
+// slackPermalinkPattern matches a message permalink, capturing the channel
+// and the message timestamp without its dot, e.g.
+// https://acme.slack.com/archives/C0123ABCD/p1712345678123456.
+var slackPermalinkPattern = regexp.MustCompile(`^https://[^/]+\.slack\.com/archives/([A-Z0-9]+)/p(\d{7,})(\d{6})(?:\?.*)?$`)
+
+// slackMarkupPattern matches Slack's markup for mentions and links, such as
+// <@U123>, <#C123|general>, and <https://example.com|Example>.
+var slackMarkupPattern = regexp.MustCompile(`<([^<>|]+)(?:\|([^<>]*))?>`)
+
+// slackSub implements "slack permalink...": it fetches the thread that each
+// permalink points into and adds it as a transcript, one line per message,
+// headed by the speaker's name and the time. The token is the keyring's
+// slack credential, or $SLACK_TOKEN, and needs the channels:history (or
+// groups:history) and users:read scopes.
+func slackSub(ctx context.Context, sc Context, args []string) ([]entry.Entry, error) {
+	if len(args) == 0 {
+		return nil, Errorf(KindUsage, "slack takes one or more message permalinks, e.g. slack https://acme.slack.com/archives/C0123ABCD/p1712345678123456")
+	}
+	token, err := keyring.Lookup("slack", "SLACK_TOKEN")
+	if err != nil {
+		return nil, Errorf(KindUsage, "%v", err)
+	}
+	client := &slackClient{token: token, network: sc.Network, names: map[string]string{}}
+	return eachPath(ctx, sc, "slack", args, func(permalink string) ([]entry.Entry, error) {
+		channel, ts, err := parseSlackPermalink(permalink)
+		if err != nil {
+			return nil, err
+		}
+		transcript, err := client.thread(ctx, channel, ts)
+		if err != nil {
+			return nil, err
+		}
+		return []entry.Entry{entry.Message{Text: transcript, Source: permalink}}, nil
+	})
+}
+
+// parseSlackPermalink returns the channel and the timestamp of the thread
+// a permalink points into: that of the message itself, or for a reply, the
+// thread_ts in its query.
+func parseSlackPermalink(permalink string) (channel, ts string, err error) {
+	m := slackPermalinkPattern.FindStringSubmatch(permalink)
+	if m == nil {
+		return "", "", Errorf(KindUsage, "not a Slack message permalink: %s", permalink)
+	}
+	channel, ts = m[1], m[2]+"."+m[3]
+	if u, err := url.Parse(permalink); err == nil {
+		if threadTS := u.Query().Get("thread_ts"); threadTS != "" {
+			ts = threadTS
+		}
+	}
+	return channel, ts, nil
+}
+
+// slackClient calls the Slack Web API, remembering the names of the users
+// it has looked up.
+type slackClient struct {
+	token   string
+	network *Network
+	names   map[string]string
+}
+
+// slackMessage is a message as conversations.replies returns it.
+type slackMessage struct {
+	User     string `json:"user"`
+	Username string `json:"username"`
+	BotID    string `json:"bot_id"`
+	Text     string `json:"text"`
+	TS       string `json:"ts"`
+}
+
+// thread returns the transcript of the thread started by the message ts in
+// channel.
+func (c *slackClient) thread(ctx context.Context, channel, ts string) (string, error) {
+	var messages []slackMessage
+	cursor := ""
+	for {
+		var response struct {
+			Messages         []slackMessage `json:"messages"`
+			ResponseMetadata struct {
+				NextCursor string `json:"next_cursor"`
+			} `json:"response_metadata"`
+		}
+		params := url.Values{"channel": {channel}, "ts": {ts}, "limit": {"200"}}
+		if cursor != "" {
+			params.Set("cursor", cursor)
+		}
+		if err := c.call(ctx, "conversations.replies", params, &response); err != nil {
+			return "", err
+		}
+		messages = append(messages, response.Messages...)
+		if cursor = response.ResponseMetadata.NextCursor; cursor == "" {
+			break
+		}
+	}
+
+	var transcript strings.Builder
+	fmt.Fprintf(&transcript, "Slack thread (%d messages):\n", len(messages))
+	for _, message := range messages {
+		speaker := message.Username
+		if message.User != "" {
+			speaker = c.name(ctx, message.User)
+		}
+		if speaker == "" {
+			speaker = "bot " + message.BotID
+		}
+		fmt.Fprintf(&transcript, "\n**%s** (%s): %s\n", speaker, slackTime(message.TS), c.plainText(ctx, message.Text))
+	}
+	return strings.TrimSpace(transcript.String()), nil
+}
+
+// name returns the display name of a user, falling back to the real name,
+// the user name, and finally the ID if the user can't be looked up.
+func (c *slackClient) name(ctx context.Context, user string) string {
+	if name, ok := c.names[user]; ok {
+		return name
+	}
+	var response struct {
+		User struct {
+			Name    string `json:"name"`
+			Profile struct {
+				DisplayName string `json:"display_name"`
+				RealName    string `json:"real_name"`
+			} `json:"profile"`
+		} `json:"user"`
+	}
+	name := user
+	if err := c.call(ctx, "users.info", url.Values{"user": {user}}, &response); err == nil {
+		for _, candidate := range []string{response.User.Profile.DisplayName, response.User.Profile.RealName, response.User.Name} {
+			if candidate != "" {
+				name = candidate
+				break
+			}
+		}
+	}
+	c.names[user] = name
+	return name
+}
+
+// plainText rewrites Slack's markup as plain text: mentions become @name
+// and #channel, and links show their label followed by the URL.
+func (c *slackClient) plainText(ctx context.Context, text string) string {
+	text = slackMarkupPattern.ReplaceAllStringFunc(text, func(markup string) string {
+		m := slackMarkupPattern.FindStringSubmatch(markup)
+		target, label := m[1], m[2]
+		switch {
+		case strings.HasPrefix(target, "@"):
+			return "@" + c.name(ctx, target[1:])
+		case strings.HasPrefix(target, "#") && label != "":
+			return "#" + label
+		case strings.HasPrefix(target, "!"):
+			return "@" + strings.TrimPrefix(target, "!")
+		case label != "":
+			return label + " (" + target + ")"
+		}
+		return target
+	})
+	return html.UnescapeString(text)
+}
+
+// call calls a Slack Web API method and decodes its response into result,
+// turning a response that is not "ok" into an error.
+func (c *slackClient) call(ctx context.Context, method string, params url.Values, result any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, slackAPI+method+"?"+params.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	resp, err := c.network.Do(req)
+	if err != nil {
+		return Errorf(KindRemote, "slack %s failed: %v", method, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Errorf(KindRemote, "slack %s failed: %s", method, resp.Status)
+	}
+	var body json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&body); errors.Is(err, ErrNetworkBudget) {
+		return err
+	} else if err != nil {
+		return Errorf(KindRemote, "slack %s returned invalid JSON: %v", method, err)
+	}
+	var status struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(body, &status); err != nil || !status.OK {
+		return Errorf(KindRemote, "slack %s failed: %s", method, status.Error)
+	}
+	return json.Unmarshal(body, result)
+}
+
+// slackTime formats a Slack message timestamp, seconds since the epoch with
+// a fraction, as a UTC time.
+func slackTime(ts string) string {
+	seconds, err := strconv.ParseFloat(ts, 64)
+	if err != nil {
+		return ts
+	}
+	return time.Unix(int64(seconds), 0).UTC().Format("2006-01-02 15:04 UTC")
+}
@@ -0,0 +1,89 @@
+package subcmd
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+)
+
+func TestParseSlackPermalink(t *testing.T) {
+	testCases := []struct {
+		permalink   string
+		channel, ts string
+		wantErr     bool
+	}{
+		{"https://acme.slack.com/archives/C0123ABCD/p1712345678123456", "C0123ABCD", "1712345678.123456", false},
+		{"https://acme.slack.com/archives/C0123ABCD/p1712345999000200?thread_ts=1712345678.123456&cid=C0123ABCD", "C0123ABCD", "1712345678.123456", false},
+		{"https://example.com/archives/C0123ABCD/p1712345678123456", "", "", true},
+		{"https://acme.slack.com/archives/C0123ABCD", "", "", true},
+	}
+	for _, tc := range testCases {
+		channel, ts, err := parseSlackPermalink(tc.permalink)
+		if (err != nil) != tc.wantErr || channel != tc.channel || ts != tc.ts {
+			t.Errorf("parseSlackPermalink(%q) = %q, %q, %v, expected %q, %q", tc.permalink, channel, ts, err, tc.channel, tc.ts)
+		}
+	}
+}
+
+func TestSlackSub(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer xoxb-test" {
+			w.Write([]byte(`{"ok": false, "error": "invalid_auth"}`))
+			return
+		}
+		switch r.URL.Path + "?" + r.URL.RawQuery {
+		case "/conversations.replies?channel=C0123ABCD&limit=200&ts=1712345678.123456":
+			w.Write([]byte(`{"ok": true, "messages": [
+				{"user": "U1", "text": "API is down &gt; 5 min, <@U2> can you look?", "ts": "1712345678.123456"}
+			], "response_metadata": {"next_cursor": "page2"}}`))
+		case "/conversations.replies?channel=C0123ABCD&cursor=page2&limit=200&ts=1712345678.123456":
+			w.Write([]byte(`{"ok": true, "messages": [
+				{"user": "U2", "text": "On it, see <https://status.example.com|status page> in <#C9|incidents>", "ts": "1712345738.000100"},
+				{"bot_id": "B1", "username": "pagerbot", "text": "Resolved", "ts": "1712346000.000000"}
+			]}`))
+		case "/users.info?user=U1":
+			w.Write([]byte(`{"ok": true, "user": {"name": "alice", "profile": {"display_name": "", "real_name": "Alice Ng"}}}`))
+		case "/users.info?user=U2":
+			w.Write([]byte(`{"ok": true, "user": {"name": "bob", "profile": {"display_name": "bobby"}}}`))
+		default:
+			w.Write([]byte(`{"ok": false, "error": "channel_not_found"}`))
+		}
+	}))
+	defer server.Close()
+	defer func(api string) { slackAPI = api }(slackAPI)
+	slackAPI = server.URL + "/"
+
+	sc, _, _ := setupTestFiles(t)
+	defer sc.Cleanup()
+	permalink := "https://acme.slack.com/archives/C0123ABCD/p1712345678123456"
+
+	t.Setenv("PATH", t.TempDir()) // no keyring
+	t.Setenv("SLACK_TOKEN", "")
+	if _, err := slackSub(context.Background(), sc, []string{permalink}); err == nil {
+		t.Error("Expected an error without a token")
+	}
+
+	t.Setenv("SLACK_TOKEN", "xoxb-test")
+	entries, err := slackSub(context.Background(), sc, []string{permalink})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []entry.Entry{entry.Message{
+		Text: "Slack thread (3 messages):\n\n" +
+			"**Alice Ng** (2024-04-05 19:34 UTC): API is down > 5 min, @bobby can you look?\n\n" +
+			"**bobby** (2024-04-05 19:35 UTC): On it, see status page (https://status.example.com) in #incidents\n\n" +
+			"**pagerbot** (2024-04-05 19:40 UTC): Resolved",
+		Source: permalink,
+	}}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("Expected %q\n  Actual %q", expected, entries)
+	}
+
+	if _, err := slackSub(context.Background(), sc, []string{"https://acme.slack.com/archives/C999/p1712345678123456"}); err == nil {
+		t.Error("Expected an error for an unknown channel")
+	}
+}
@@ -0,0 +1,195 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package subcmd
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+	"github.com/eloquence-cloud/ch/chlib/stacktrace"
+)
+
+// maxStacktraceFrames limits how many frames' source --enrich-stacktrace
+// attaches, since a deep or recursive trace repeats itself.
+const maxStacktraceFrames = 20
+
+// stacktraceFlags are the flags of the subcommands whose content can be
+// enriched with the source of its stack traces' frames: insert and exec.
+type stacktraceFlags struct {
+	enrich  *bool
+	context *int
+}
+
+func addStacktraceFlags(flags *flag.FlagSet) stacktraceFlags {
+	return stacktraceFlags{
+		enrich:  flags.Bool("enrich-stacktrace", false, "Attach the source around each frame, in this project, of the Go panics, Python tracebacks, and Java stack traces in the content"),
+		context: flags.Int("stacktrace-context", 5, "With --enrich-stacktrace, attach `n` lines either side of each frame's line"),
+	}
+}
+
+// check reports flags that make no sense.
+func (f stacktraceFlags) check(name string) error {
+	if *f.context < 0 {
+		return Errorf(KindUsage, "%s --stacktrace-context must be 0 or more", name)
+	}
+	return nil
+}
+
+// sources returns, with --enrich-stacktrace, the source around each frame
+// of the stack traces in text that is in a file of the project, the
+// working directory: one attached file for each run of nearby lines.
+// Frames in files outside the project, or in pruned directories such as
+// vendor, are left out.
+func (f stacktraceFlags) sources(sc Context, text string) ([]entry.Entry, error) {
+	if !*f.enrich {
+		return nil, nil
+	}
+	frames := stacktrace.Parse(text)
+	if len(frames) == 0 {
+		return nil, nil
+	}
+	root, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the project directory: %v", err)
+	}
+	files, err := ListFiles(root, sc.PruneDirs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the project's files: %v", err)
+	}
+	project := map[string]bool{}
+	for i, file := range files {
+		rel, _ := filepath.Rel(root, file)
+		files[i] = filepath.ToSlash(rel)
+		project[files[i]] = true
+	}
+
+	var paths []string
+	lines := map[string][]int{}
+	count := 0
+	for _, frame := range frames {
+		path := resolveFrame(root, frame.Path, project, files)
+		if path == "" {
+			slog.Debug("frame not in project", "path", frame.Path, "line", frame.Line)
+			continue
+		}
+		if count == maxStacktraceFrames {
+			slog.Info("attaching the source of only the first frames", "frames", maxStacktraceFrames)
+			break
+		}
+		count++
+		if lines[path] == nil {
+			paths = append(paths, path)
+		}
+		lines[path] = append(lines[path], frame.Line)
+	}
+
+	var entries []entry.Entry
+	for _, path := range paths {
+		fileEntries, err := frameSources(sc, path, lines[path], *f.context)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, fileEntries...)
+	}
+	return entries, nil
+}
+
+// resolveFrame returns the path, relative to root, of the project file a
+// frame's path refers to, or "" if it refers to none. A relative path that
+// isn't a project file's, such as a Java frame's, matches the one project
+// file, if only one, whose path ends with it.
+func resolveFrame(root, path string, project map[string]bool, files []string) string {
+	if filepath.IsAbs(path) {
+		rel, err := filepath.Rel(root, path)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			return ""
+		}
+		rel = filepath.ToSlash(rel)
+		if !project[rel] {
+			return ""
+		}
+		return rel
+	}
+	path = filepath.ToSlash(filepath.Clean(path))
+	if project[path] {
+		return path
+	}
+	match := ""
+	for _, file := range files {
+		if strings.HasSuffix(file, "/"+path) {
+			if match != "" {
+				return ""
+			}
+			match = file
+		}
+	}
+	return match
+}
+
+// frameSources returns the source of a file around its frames' lines, as
+// one attached file for each run of lines, with context lines either side,
+// that overlaps or adjoins no other.
+func frameSources(sc Context, path string, frameLines []int, context int) ([]entry.Entry, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, Errorf(KindMissingFile, "failed to read %s: %v", path, err)
+	}
+	source := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+	frameLines = slices.Clone(frameLines)
+	slices.Sort(frameLines)
+	frameLines = slices.Compact(frameLines)
+
+	var entries []entry.Entry
+	for i := 0; i < len(frameLines); {
+		if frameLines[i] < 1 || frameLines[i] > len(source) {
+			// The file has changed since the trace was written.
+			i++
+			continue
+		}
+		first := max(1, frameLines[i]-context)
+		last := min(len(source), frameLines[i]+context)
+		within := []string{strconv.Itoa(frameLines[i])}
+		for i++; i < len(frameLines) && frameLines[i] <= len(source) && frameLines[i]-context <= last+1; i++ {
+			last = min(len(source), frameLines[i]+context)
+			within = append(within, strconv.Itoa(frameLines[i]))
+		}
+
+		text := strings.Join(source[first-1:last], "\n") + "\n"
+		file, err := entry.NewStoredFile(sc.TempDir, path, []byte(text))
+		if err != nil {
+			return nil, fmt.Errorf("failed to store %s: %v", path, err)
+		}
+		file = labelFiles([]entry.Entry{file}, path, "", sc.PathAliases)[0].(entry.File)
+		at := "frame at line " + within[0]
+		if len(within) > 1 {
+			at = "frames at lines " + strings.Join(within, ", ")
+		}
+		file.Label = fmt.Sprintf("%s (lines %d-%d, %s)", file.DisplayPath(), first, last, at)
+		entries = append(entries, file)
+	}
+	return entries, nil
+}
@@ -0,0 +1,111 @@
+package subcmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+)
+
+func TestEnrichStacktrace(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+	sc, _, _ := setupTestFiles(t)
+	defer sc.Cleanup()
+	sc.PruneDirs = []string{"vendor"}
+
+	project := t.TempDir()
+	var source []string
+	for i := 1; i <= 30; i++ {
+		source = append(source, fmt.Sprintf("line %d", i))
+	}
+	files := map[string]string{
+		"app/orders.py":                      strings.Join(source, "\n") + "\n",
+		"vendor/lib.py":                      "def f():\n    pass\n",
+		"src/main/java/com/acme/Orders.java": strings.Join(source, "\n") + "\n",
+		"trace.txt": `Traceback (most recent call last):
+  File "app/orders.py", line 10, in <module>
+  File "` + filepath.Join(project, "app/orders.py") + `", line 13, in total
+  File "vendor/lib.py", line 2, in f
+  File "/usr/lib/python3/json/__init__.py", line 346, in loads
+ZeroDivisionError: division by zero
+Exception in thread "main" java.lang.IllegalStateException
+	at com.acme.Orders.main(Orders.java:29)
+`,
+	}
+	for path, content := range files {
+		path = filepath.Join(project, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	if err := os.Chdir(project); err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(entries []entry.Entry) {
+		t.Helper()
+		if len(entries) != 3 {
+			t.Fatalf("Expected the trace and two excerpts\n  Actual %#v", entries)
+		}
+		expected := []struct{ label, first, last string }{
+			{"app/orders.py (lines 8-15, frames at lines 10, 13)", "line 8", "line 15"},
+			{"src/main/java/com/acme/Orders.java (lines 27-30, frame at line 29)", "line 27", "line 30"},
+		}
+		for i, e := range expected {
+			file, ok := entries[i+1].(entry.File)
+			if !ok {
+				t.Fatalf("Expected an attached excerpt\n  Actual %#v", entries[i+1])
+			}
+			if file.Label != e.label {
+				t.Errorf("Expected label %q\n  Actual label %q", e.label, file.Label)
+			}
+			content, err := os.ReadFile(file.StoragePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			lines := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+			if lines[0] != e.first || lines[len(lines)-1] != e.last {
+				t.Errorf("Expected lines %q to %q\n  Actual %q", e.first, e.last, lines)
+			}
+		}
+	}
+
+	args := []string{"exec", "--enrich-stacktrace", "--stacktrace-context", "2", "sh", "-c", "cat trace.txt >&2; exit 1"}
+	entries, err := Execute(context.Background(), sc, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output := entries[0].(entry.Output).Output; output != files["trace.txt"] {
+		t.Errorf("Expected standard error in the output\n  Actual %q", output)
+	}
+	check(entries)
+
+	entries, err = Execute(context.Background(), sc, []string{"insert", "--enrich-stacktrace", "--stacktrace-context", "2", "trace.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(entries)
+
+	entries, err = Execute(context.Background(), sc, []string{"insert", "trace.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("Expected no excerpts without --enrich-stacktrace\n  Actual %#v", entries)
+	}
+}
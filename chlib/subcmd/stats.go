@@ -0,0 +1,236 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package subcmd
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+)
+
+// commentSyntax is how a language marks comments: lines starting with
+// line, and text between blockStart and blockEnd.
+type commentSyntax struct {
+	line                 string
+	blockStart, blockEnd string
+}
+
+var (
+	cComments    = commentSyntax{line: "//", blockStart: "/*", blockEnd: "*/"}
+	hashComments = commentSyntax{line: "#"}
+	xmlComments  = commentSyntax{blockStart: "<!--", blockEnd: "-->"}
+)
+
+// commentSyntaxes gives the comment syntax of the languages of
+// entry.LanguageFor that stats tells comments apart in.
+var commentSyntaxes = map[string]commentSyntax{
+	"c": cComments, "cpp": cComments, "csharp": cComments, "dart": cComments,
+	"go": cComments, "java": cComments, "javascript": cComments, "jsx": cComments,
+	"kotlin": cComments, "php": cComments, "protobuf": cComments, "rust": cComments,
+	"scala": cComments, "scss": cComments, "swift": cComments, "typescript": cComments,
+	"tsx":  cComments,
+	"css":  {blockStart: "/*", blockEnd: "*/"},
+	"hcl":  {line: "#", blockStart: "/*", blockEnd: "*/"},
+	"bash": hashComments, "cmake": hashComments, "dockerfile": hashComments,
+	"makefile": hashComments, "perl": hashComments, "powershell": hashComments,
+	"python": hashComments, "r": hashComments, "ruby": hashComments,
+	"toml": hashComments, "yaml": hashComments, "zsh": hashComments,
+	"lua": {line: "--"}, "sql": {line: "--", blockStart: "/*", blockEnd: "*/"},
+	"html": xmlComments, "vue": xmlComments, "xml": xmlComments,
+}
+
+// lineCounts counts a file's or language's lines by kind.
+type lineCounts struct {
+	files, code, comments, blank int
+}
+
+func (c lineCounts) lines() int {
+	return c.code + c.comments + c.blank
+}
+
+func (c *lineCounts) add(other lineCounts) {
+	c.files += other.files
+	c.code += other.code
+	c.comments += other.comments
+	c.blank += other.blank
+}
+
+// countLines counts the code, comment, and blank lines of content. A line
+// with both code and a comment counts as code.
+func countLines(content []byte, syntax commentSyntax) lineCounts {
+	counts := lineCounts{files: 1}
+	inBlock := false
+	for _, line := range strings.Split(strings.TrimSuffix(string(content), "\n"), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case inBlock:
+			counts.comments++
+			inBlock = !strings.Contains(line, syntax.blockEnd)
+		case line == "":
+			counts.blank++
+		case syntax.line != "" && strings.HasPrefix(line, syntax.line):
+			counts.comments++
+		case syntax.blockStart != "" && strings.HasPrefix(line, syntax.blockStart):
+			counts.comments++
+			rest := line[len(syntax.blockStart):]
+			if end := strings.Index(rest, syntax.blockEnd); end < 0 {
+				inBlock = true
+			} else if strings.TrimSpace(rest[end+len(syntax.blockEnd):]) != "" {
+				counts.comments--
+				counts.code++
+			}
+		default:
+			counts.code++
+		}
+	}
+	return counts
+}
+
+// statsFlags are the flags of the stats subcommand.
+type statsFlags struct {
+	top      *int
+	excludes *stringList
+}
+
+func addStatsFlags(flags *flag.FlagSet) statsFlags {
+	f := statsFlags{excludes: &stringList{}}
+	f.top = flags.Int("top", 10, "List the `N` largest files")
+	flags.Var(f.excludes, "exclude", "Skip files and directories matching `glob`, as attach --exclude does (repeatable)")
+	return f
+}
+
+// statsFile is a file counted by stats.
+type statsFile struct {
+	path, lang string
+	counts     lineCounts
+}
+
+// statsSub implements "stats [dir...]": a cloc-style summary of the files
+// that attach would attach from each directory: their lines of code,
+// comments, and blank lines by language, and the largest files.
+func statsSub(ctx context.Context, sc Context, args []string) ([]entry.Entry, error) {
+	flags := newSubcommandFlags("stats")
+	f := addStatsFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return nil, Errorf(KindUsage, "invalid stats flags: %v", err)
+	}
+	if *f.top < 0 {
+		return nil, Errorf(KindUsage, "stats --top must be 0 or more")
+	}
+	dirs := flags.Args()
+	if len(dirs) == 0 {
+		dirs = []string{"."}
+	}
+	opts := walkOptions{
+		maxDepth: -1,
+		excludes: *f.excludes,
+		prune:    append(append([]string{}, DefaultPruneDirs...), sc.PruneDirs...),
+	}
+	return eachPath(ctx, sc, "stats", dirs, func(dir string) ([]entry.Entry, error) {
+		if info, err := os.Stat(dir); err != nil {
+			return nil, Errorf(KindMissingFile, "directory does not exist: %v", dir)
+		} else if !info.IsDir() {
+			return nil, Errorf(KindUsage, "stats takes directories, not files: %s", dir)
+		}
+		var files []statsFile
+		var readErr error
+		err := walkDirectory(dir, opts, func(path string) {
+			if readErr != nil || ctx.Err() != nil {
+				return
+			}
+			content, err := os.ReadFile(path)
+			if err != nil {
+				readErr = err
+				return
+			}
+			if bytes.IndexByte(content, 0) >= 0 || !utf8.Valid(content) || len(content) == 0 {
+				return
+			}
+			lang := cmp.Or(entry.LanguageFor(path, nil), "other")
+			files = append(files, statsFile{path: path, lang: lang, counts: countLines(content, commentSyntaxes[lang])})
+		})
+		if err == nil {
+			err = readErr
+		}
+		if err != nil {
+			return nil, Errorf(KindMissingFile, "failed to read directory: %v", err)
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return []entry.Entry{entry.Message{Text: formatStats(dir, files, *f.top), Source: dir}}, nil
+	})
+}
+
+// formatStats summarizes files as markdown tables: totals by language,
+// most code first, and the top largest files.
+func formatStats(dir string, files []statsFile, top int) string {
+	var total lineCounts
+	byLang := map[string]*lineCounts{}
+	var langs []string
+	for _, file := range files {
+		total.add(file.counts)
+		if byLang[file.lang] == nil {
+			byLang[file.lang] = &lineCounts{}
+			langs = append(langs, file.lang)
+		}
+		byLang[file.lang].add(file.counts)
+	}
+	if len(files) == 0 {
+		return fmt.Sprintf("Code statistics for %s: no text files.\n", dir)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Code statistics for %s: %d files, %d lines (%d code, %d comments, %d blank).\n\n",
+		dir, total.files, total.lines(), total.code, total.comments, total.blank)
+	slices.SortFunc(langs, func(a, b string) int {
+		return cmp.Or(cmp.Compare(byLang[b].code, byLang[a].code), strings.Compare(a, b))
+	})
+	b.WriteString("| Language | Files | Code | Comments | Blank | Lines |\n|---|--:|--:|--:|--:|--:|\n")
+	for _, lang := range langs {
+		c := byLang[lang]
+		fmt.Fprintf(&b, "| %s | %d | %d | %d | %d | %d |\n", lang, c.files, c.code, c.comments, c.blank, c.lines())
+	}
+	if len(langs) > 1 {
+		fmt.Fprintf(&b, "| **Total** | %d | %d | %d | %d | %d |\n", total.files, total.code, total.comments, total.blank, total.lines())
+	}
+
+	if top == 0 {
+		return b.String()
+	}
+	largest := slices.Clone(files)
+	slices.SortStableFunc(largest, func(a, b statsFile) int {
+		return cmp.Compare(b.counts.lines(), a.counts.lines())
+	})
+	largest = largest[:min(top, len(largest))]
+	fmt.Fprintf(&b, "\nLargest files:\n\n| File | Language | Lines | Code |\n|---|---|--:|--:|\n")
+	for _, file := range largest {
+		fmt.Fprintf(&b, "| %s | %s | %d | %d |\n", strings.ReplaceAll(file.path, "|", `\|`), file.lang, file.counts.lines(), file.counts.code)
+	}
+	return b.String()
+}
@@ -0,0 +1,89 @@
+package subcmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+)
+
+func TestCountLines(t *testing.T) {
+	testCases := []struct {
+		name     string
+		content  string
+		syntax   commentSyntax
+		expected lineCounts
+	}{
+		{
+			name:     "Go",
+			content:  "// Package a does things.\npackage a\n\n/*\nMore.\n*/\nfunc F() {} // F does nothing.\n/* x */ var v = 1\n",
+			syntax:   cComments,
+			expected: lineCounts{files: 1, code: 3, comments: 4, blank: 1},
+		},
+		{
+			name:     "Python",
+			content:  "#!/usr/bin/env python3\nimport os\n\n\n# Print it.\nprint(os.name)",
+			syntax:   hashComments,
+			expected: lineCounts{files: 1, code: 2, comments: 2, blank: 2},
+		},
+		{
+			name:     "No comment syntax",
+			content:  "# Title\n\nSome // text.\n",
+			expected: lineCounts{files: 1, code: 2, blank: 1},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if actual := countLines([]byte(tc.content), tc.syntax); actual != tc.expected {
+				t.Errorf("Expected %+v\n  Actual %+v", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestStatsSub(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"main.go":             "package main\n\n// main runs.\nfunc main() {\n}\n",
+		"util/util.go":        "package util\n",
+		"scripts/build.py":    "# Build it.\nprint('ok')\n",
+		"README.md":           "# Tool\n",
+		"logo.png":            "\x89PNG\x00\x00",
+		"empty.txt":           "",
+		"node_modules/dep.js": "module.exports = 1;\n",
+		".env":                "SECRET=1\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := statsSub(context.Background(), Context{PruneDirs: []string{"node_modules"}}, []string{"--top", "2", "--exclude", "*.md", dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []entry.Entry{entry.Message{Source: dir, Text: "Code statistics for " + dir + ": 3 files, 8 lines (5 code, 2 comments, 1 blank).\n\n" +
+		"| Language | Files | Code | Comments | Blank | Lines |\n|---|--:|--:|--:|--:|--:|\n" +
+		"| go | 2 | 4 | 1 | 1 | 6 |\n" +
+		"| python | 1 | 1 | 1 | 0 | 2 |\n" +
+		"| **Total** | 3 | 5 | 2 | 1 | 8 |\n" +
+		"\nLargest files:\n\n| File | Language | Lines | Code |\n|---|---|--:|--:|\n" +
+		"| " + filepath.Join(dir, "main.go") + " | go | 5 | 3 |\n" +
+		"| " + filepath.Join(dir, "scripts", "build.py") + " | python | 2 | 1 |\n",
+	}}
+	if len(entries) != 1 || entries[0] != expected[0] {
+		t.Errorf("Expected %v\n  Actual %v", expected, entries)
+	}
+
+	if _, err := statsSub(context.Background(), Context{}, []string{filepath.Join(dir, "main.go")}); KindOf(err) != KindUsage {
+		t.Errorf("Expected a usage error for a file, got: %v", err)
+	}
+}
@@ -0,0 +1,363 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package subcmd
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+)
+
+// Func implements a subcommand. It receives the words after the
+// subcommand's name (and after any --priority flag) and returns the entries
+// to add to the document. Work it starts, such as commands and remote
+// copies, must stop when ctx is done.
+type Func func(ctx context.Context, sc Context, args []string) ([]entry.Entry, error)
+
+type subcommand struct {
+	name string
+	fn   Func
+}
+
+var subcommands []subcommand
+
+// The subcommands are listed in init, since some of them, such as load and
+// if-exists, run other subcommands through the list.
+func init() {
+	subcommands = []subcommand{
+		{"say", saySub},
+		{"ask", askSub},
+		{"turn", turnSub},
+		{"reply", replySub},
+		{"attach", attachSub},
+		{"insert", insertSub},
+		{"head", headSub},
+		{"tail", tailSub},
+		{"ocr", ocrSub},
+		{"email", emailSub},
+		{"slack", slackSub},
+		{"graphql", graphqlSub},
+		{"openapi", openapiSub},
+		{"proto", protoSub},
+		{"tfplan", tfplanSub},
+		{"stats", statsSub},
+		{"quote", quoteSub},
+		{"heading", headingSub},
+		{"hr", hrSub},
+		{"list", listSub},
+		{"exec", execSub},
+		{"paste", pasteSub},
+		{"import", importSub},
+		{"rdiff", rdiffSub},
+		{"blame", blameSub},
+		{"changelog", changelogSub},
+		{"load", loadSub},
+		{"bundle", bundleSub},
+		{"if-exists", ifExistsSub},
+		{"if-cmd", ifCmdSub},
+		{"foreach", foreachSub},
+		{"wrap", wrapSub},
+	}
+}
+
+// Register adds a subcommand, or replaces the built-in subcommand of the
+// same name. Like the built-in ones, it can be invoked by any unambiguous
+// prefix of its name.
+func Register(name string, fn Func) {
+	for i, sub := range subcommands {
+		if sub.name == name {
+			subcommands[i].fn = fn
+			return
+		}
+	}
+	subcommands = append(subcommands, subcommand{name, fn})
+}
+
+// Process runs a command line of comma-separated subcommands and returns
+// the entries they produce, in order. Cancelling ctx stops the subcommand
+// that is running and fails the whole command line.
+func Process(ctx context.Context, sc Context, args []string) ([]entry.Entry, error) {
+	return processSubcommands(ctx, sc, splitSubcommands(args))
+}
+
+// splitSubcommands splits a command line into subcommands at the commas
+// that end words. The last subcommand is the one not ended by a comma, if
+// any words follow the last comma.
+func splitSubcommands(args []string) [][]string {
+	var subcommands [][]string
+	var accumCommand []string
+	for _, arg := range args {
+		arg = strings.TrimSpace(arg)
+		if strings.HasSuffix(arg, ",") {
+			argWithoutComma := strings.TrimSuffix(arg, ",")
+			if len(argWithoutComma) > 0 {
+				accumCommand = append(accumCommand, argWithoutComma)
+			}
+			subcommands = append(subcommands, accumCommand)
+			accumCommand = nil
+		} else {
+			accumCommand = append(accumCommand, arg)
+		}
+	}
+	if len(accumCommand) > 0 {
+		subcommands = append(subcommands, accumCommand)
+	}
+	return subcommands
+}
+
+// processSubcommands runs subcommands in order, giving each foreach and
+// wrap the subcommands that follow it, up to its "end".
+func processSubcommands(ctx context.Context, sc Context, subcommands [][]string) ([]entry.Entry, error) {
+	var entries []entry.Entry
+	for i := 0; i < len(subcommands); i++ {
+		command := subcommands[i]
+		var subcommandEntries []entry.Entry
+		var err error
+		if opensBlock(command) {
+			body, n := blockBody(subcommands[i+1:], blocksOpened(command))
+			if command[0] == "foreach" {
+				subcommandEntries, err = foreachSubcommands(ctx, sc, command[1:], body)
+			} else {
+				subcommandEntries, err = wrapSubcommands(ctx, sc, command[1:], body)
+			}
+			i += n
+		} else {
+			subcommandEntries, err = execute(ctx, sc, command)
+		}
+		if err != nil {
+			if i < len(subcommands)-1 {
+				err = fmt.Errorf("failed to execute subcommand %s: %w", command, err)
+			}
+			return nil, contextError(ctx, err)
+		}
+		entries = append(entries, subcommandEntries...)
+	}
+	return entries, nil
+}
+
+// opensBlock reports whether command is a foreach or wrap, which applies to
+// the subcommands after it, up to a matching end.
+func opensBlock(command []string) bool {
+	return len(command) > 0 && (command[0] == "foreach" || command[0] == "wrap")
+}
+
+// closesBlock reports whether command is the end of a foreach or wrap.
+func closesBlock(command []string) bool {
+	return len(command) == 1 && command[0] == "end"
+}
+
+// blocksOpened returns how many blocks command opens, since the subcommand
+// that a foreach or wrap starts with may be another, as in
+// "foreach '*.go' wrap file attach {}".
+func blocksOpened(command []string) int {
+	n := 0
+	for opensBlock(command) {
+		n++
+		if len(command) <= 2 {
+			break
+		}
+		command = command[2:]
+	}
+	return n
+}
+
+// blockBody returns the subcommands that belong to the foreach or wrap
+// before them, which opened the given number of blocks: those up to the
+// end of the outermost, or all of them if there is none. It also returns
+// how many subcommands it used, counting the end.
+func blockBody(subcommands [][]string, opened int) ([][]string, int) {
+	depth := opened - 1
+	for i, command := range subcommands {
+		switch {
+		case opensBlock(command):
+			depth += blocksOpened(command)
+		case closesBlock(command):
+			if depth == 0 {
+				return subcommands[:i], i + 1
+			}
+			depth--
+		}
+	}
+	return subcommands, len(subcommands)
+}
+
+// execute runs a subcommand for Process. With sc.KeepGoing, a failure
+// becomes an entry.Failure, unless it is due to ctx being done.
+func execute(ctx context.Context, sc Context, args []string) ([]entry.Entry, error) {
+	entries, err := Execute(ctx, sc, args)
+	if err != nil && sc.KeepGoing && ctx.Err() == nil {
+		return []entry.Entry{keptGoing(strings.Join(args, " "), err)}, nil
+	}
+	return entries, err
+}
+
+// eachPath calls fn for each of a subcommand's paths and collects the
+// entries. With sc.KeepGoing, a path that fails becomes an entry.Failure
+// and the remaining paths are still processed.
+func eachPath(ctx context.Context, sc Context, name string, paths []string, fn func(path string) ([]entry.Entry, error)) ([]entry.Entry, error) {
+	var entries []entry.Entry
+	for _, path := range paths {
+		pathEntries, err := fn(path)
+		if err != nil {
+			if !sc.KeepGoing || ctx.Err() != nil {
+				return nil, err
+			}
+			pathEntries = []entry.Entry{keptGoing(name+" "+path, err)}
+		}
+		entries = append(entries, pathEntries...)
+	}
+	return entries, nil
+}
+
+// keptGoing logs a failure that sc.KeepGoing carries on past and returns
+// the placeholder that stands in for it.
+func keptGoing(command string, err error) entry.Entry {
+	slog.Warn("kept going past failure", "command", command, "error", err)
+	return entry.Failure{Command: command, Error: err.Error()}
+}
+
+// contextError returns ctx's error, such as context.DeadlineExceeded, in
+// place of err if ctx is done, since err (often "signal: killed") is only a
+// symptom.
+func contextError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// Execute runs a single subcommand, given as its name (or a prefix of it)
+// followed by its arguments. A name that matches no subcommand runs the
+// plugin of that name, if there is one; see PluginRequest. A full name is
+// never ambiguous, even when it prefixes another, as head does heading.
+func Execute(ctx context.Context, sc Context, args []string) ([]entry.Entry, error) {
+	if len(args) == 0 {
+		return []entry.Entry{}, Errorf(KindUsage, "no subcommand provided")
+	}
+	command := args[0]
+	var matches []subcommand
+	for _, sub := range subcommands {
+		if sub.name == command {
+			matches = []subcommand{sub}
+			break
+		}
+		if strings.HasPrefix(sub.name, command) {
+			matches = append(matches, sub)
+		}
+	}
+	var fn Func
+	switch len(matches) {
+	case 0:
+		plugin, ok := findPlugin(command)
+		if !ok {
+			return []entry.Entry{}, Errorf(KindUsage, "unknown subcommand: %s", command)
+		}
+		fn = plugin
+	case 1:
+		fn = matches[0].fn
+	default:
+		return []entry.Entry{}, Errorf(KindUsage, "ambiguous subcommand: %s", command)
+	}
+	p, args, err := extractPriority(args[1:])
+	if err != nil {
+		return []entry.Entry{}, err
+	}
+	start := time.Now()
+	entries, err := fn(ctx, sc, args)
+	if err != nil {
+		slog.Info("subcommand failed", "command", command, "args", args, "duration", time.Since(start), "error", err)
+		return nil, err
+	}
+	slog.Info("subcommand", "command", command, "args", args, "entries", len(entries), "bytes", contentBytes(entries), "duration", time.Since(start))
+	return entry.WithPriority(entries, p), nil
+}
+
+// contentBytes totals the size of the content entries will contribute to
+// the output, for logging.
+func contentBytes(entries []entry.Entry) int64 {
+	var total int64
+	for _, e := range entries {
+		switch e := entry.Unwrap(e).(type) {
+		case entry.Message:
+			total += int64(len(e.Text))
+		case entry.File:
+			if info, err := os.Stat(e.StoragePath); err == nil {
+				total += info.Size()
+			}
+		case entry.Output:
+			total += int64(len(e.Output))
+		case entry.Diff:
+			total += int64(len(e.Diff))
+		}
+	}
+	return total
+}
+
+// extractPriority removes a leading "--priority level" (or
+// "--priority=level") from a subcommand's arguments.
+func extractPriority(args []string) (entry.Priority, []string, error) {
+	if len(args) == 0 {
+		return entry.PriorityNormal, args, nil
+	}
+	flagName, value, hasValue := strings.Cut(args[0], "=")
+	if flagName != "--priority" && flagName != "-priority" {
+		return entry.PriorityNormal, args, nil
+	}
+	rest := args[1:]
+	if !hasValue {
+		if len(rest) == 0 {
+			return entry.PriorityNormal, nil, Errorf(KindUsage, "--priority requires a value")
+		}
+		value, rest = rest[0], rest[1:]
+	}
+	p, err := entry.ParsePriority(value)
+	if err != nil {
+		return p, rest, &Error{Kind: KindUsage, Err: err}
+	}
+	return p, rest, nil
+}
+
+// stringList is a flag.Value that collects every occurrence of a repeatable
+// flag, such as attach's --exclude.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// newSubcommandFlags returns a FlagSet for parsing a subcommand's own flags.
+// Errors are reported through the returned error rather than printed.
+func newSubcommandFlags(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	return flags
+}
@@ -0,0 +1,471 @@
+package subcmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+	"golang.design/x/clipboard"
+)
+
+func TestProcess(t *testing.T) {
+	sc, err := NewContext()
+	if err != nil {
+		t.Fatalf("Failed to create context: %v", err)
+	}
+	defer sc.Cleanup()
+
+	// Create temporary files within the context's temporary directory
+	file1, file2 := createTempFiles(t, sc)
+
+	testCases := []struct {
+		name     string
+		args     []string
+		expected []entry.Entry
+	}{
+		{
+			name:     "Say subcommand",
+			args:     []string{"say", "Hello world!"},
+			expected: []entry.Entry{entry.Message{Text: "Hello world!"}},
+		},
+		{
+			name:     "Say subcommand with multiple words",
+			args:     []string{"say", "Hello", "world!"},
+			expected: []entry.Entry{entry.Message{Text: "Hello world!"}},
+		},
+		{
+			name: "Attach subcommand",
+			args: []string{"attach", file1, sc.TempDir + ",", "attach", file2},
+			expected: []entry.Entry{
+				// from explicit attach of file1
+				entry.File{StoragePath: file1, OriginalPath: file1},
+				// from attach of sc.TempDir
+				entry.File{StoragePath: file1, OriginalPath: file1},
+				entry.File{StoragePath: file2, OriginalPath: file2},
+				// from explicit attach of file2
+				entry.File{StoragePath: file2, OriginalPath: file2},
+			},
+		},
+		{
+			name:     "Insert subcommand",
+			args:     []string{"insert", file1, file2},
+			expected: []entry.Entry{entry.Message{Text: "File 1 content", Source: file1}, entry.Message{Text: "File 2 content", Source: file2}},
+		},
+		{
+			name:     "Exec subcommand",
+			args:     []string{"exec", "echo", "Exec", "output"},
+			expected: []entry.Entry{entry.Output{Output: "Exec output\n", Command: "echo Exec output"}},
+		},
+		{
+			name:     "Exec subcommand with detected language",
+			args:     []string{"exec", "echo", `{"ok": true}`},
+			expected: []entry.Entry{entry.Output{Output: "{\"ok\": true}\n", Command: `echo {"ok": true}`, Lang: "json"}},
+		},
+		{
+			name:     "Exec subcommand with language override",
+			args:     []string{"exec", "--lang", "none", "echo", `{"ok": true}`},
+			expected: []entry.Entry{entry.Output{Output: "{\"ok\": true}\n", Command: `echo {"ok": true}`}},
+		},
+		{
+			name:     "Insert subcommand with language override",
+			args:     []string{"insert", "--lang", "text", file1},
+			expected: []entry.Entry{entry.Message{Text: "File 1 content", Source: file1, Lang: "text"}},
+		},
+		{
+			name: "Mixed subcommands",
+			args: []string{
+				"say", "Message 1", ",", "attach", file1 + ",", "insert", file2, ",", "exec", "echo", "Exec", "output,", "say", "Message 2",
+			},
+			expected: []entry.Entry{
+				entry.Message{Text: "Message 1"},
+				entry.File{StoragePath: file1, OriginalPath: file1},
+				entry.Message{Text: "File 2 content", Source: file2},
+				entry.Output{Output: "Exec output\n", Command: "echo Exec output"},
+				entry.Message{Text: "Message 2"},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			entries, err := Process(context.Background(), sc, tc.args)
+			if err != nil {
+				t.Fatalf("Process failed: %v", err)
+			}
+			if !reflect.DeepEqual(entries, tc.expected) {
+				t.Errorf("testing %v\nExpected entries: %v\n  Actual entries: %v", tc.name, tc.expected, entries)
+			}
+		})
+	}
+}
+
+func createTempFiles(t *testing.T, sc Context) (string, string) {
+	file1 := filepath.Join(sc.TempDir, "file1.txt")
+	file2 := filepath.Join(sc.TempDir, "file2.txt")
+	err := os.WriteFile(file1, []byte("File 1 content"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(file2, []byte("File 2 content"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return file1, file2
+}
+
+func TestExtractPriority(t *testing.T) {
+	testCases := []struct {
+		args         []string
+		expected     entry.Priority
+		expectedArgs []string
+		wantErr      bool
+	}{
+		{args: []string{"main.go"}, expected: entry.PriorityNormal, expectedArgs: []string{"main.go"}},
+		{args: []string{"--priority", "high", "main.go"}, expected: entry.PriorityHigh, expectedArgs: []string{"main.go"}},
+		{args: []string{"--priority=low", "docs/"}, expected: entry.PriorityLow, expectedArgs: []string{"docs/"}},
+		{args: []string{"-priority", "normal"}, expected: entry.PriorityNormal, expectedArgs: []string{}},
+		{args: []string{"--priority", "urgent"}, wantErr: true},
+		{args: []string{"--priority"}, wantErr: true},
+		{args: nil, expected: entry.PriorityNormal, expectedArgs: nil},
+	}
+
+	for _, tc := range testCases {
+		p, args, err := extractPriority(tc.args)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("extractPriority(%q): expected an error", tc.args)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("extractPriority(%q): unexpected error: %v", tc.args, err)
+			continue
+		}
+		if p != tc.expected || !reflect.DeepEqual(args, tc.expectedArgs) {
+			t.Errorf("extractPriority(%q) = %v, %q; expected %v, %q", tc.args, p, args, tc.expected, tc.expectedArgs)
+		}
+	}
+}
+
+func TestProcessWithPriority(t *testing.T) {
+	sc, err := NewContext()
+	if err != nil {
+		t.Fatalf("Failed to create context: %v", err)
+	}
+	defer sc.Cleanup()
+
+	entries, err := Process(context.Background(), sc, []string{"say", "--priority", "high", "Keep me,", "say", "Plain"})
+	if err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+	expected := []entry.Entry{
+		entry.Prioritized{Entry: entry.Message{Text: "Keep me"}, Priority: entry.PriorityHigh},
+		entry.Message{Text: "Plain"},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("Expected entries: %v\n  Actual entries: %v", expected, entries)
+	}
+}
+
+func TestPasteSub(t *testing.T) {
+	testCases := []struct {
+		name     string
+		content  string
+		expected []entry.Entry
+		wantErr  bool
+	}{
+		{
+			name:     "Simple text",
+			content:  "Clipboard content",
+			expected: []entry.Entry{entry.Message{Text: "Clipboard content", Source: "clipboard"}},
+			wantErr:  false,
+		},
+		{
+			name:     "Empty clipboard",
+			content:  "",
+			expected: []entry.Entry{entry.Message{Text: "", Source: "clipboard"}},
+			wantErr:  false,
+		},
+		{
+			name:     "Multiline text",
+			content:  "Line 1\nLine 2\nLine 3",
+			expected: []entry.Entry{entry.Message{Text: "Line 1\nLine 2\nLine 3", Source: "clipboard"}},
+			wantErr:  false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sc, err := NewContext()
+			if err != nil {
+				t.Fatalf("Failed to create context: %v", err)
+			}
+			defer sc.Cleanup()
+
+			if !tc.wantErr {
+				clipboard.Write(clipboard.FmtText, []byte(tc.content))
+			} else {
+				// Simulate clipboard initialization failure
+				clipboard.Write(clipboard.FmtText, nil)
+			}
+
+			entries, err := pasteSub(context.Background(), sc, nil)
+			if tc.wantErr {
+				if err == nil {
+					t.Error("Expected an error, but got nil")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("pasteSub failed: %v", err)
+			}
+
+			if !reflect.DeepEqual(entries, tc.expected) {
+				t.Errorf("pasteSub returned unexpected entries.\nExpected: %v\n  Actual: %v", tc.expected, entries)
+			}
+		})
+	}
+}
+
+func TestClipboardUnavailable(t *testing.T) {
+	defer func(init func() error) { initClipboard = init }(initClipboard)
+	initClipboard = func() error { return errors.New("no display") }
+
+	sc, err := NewContext()
+	if err != nil {
+		t.Fatalf("Failed to create context: %v", err)
+	}
+	defer sc.Cleanup()
+	for _, args := range [][]string{{"paste", "--text"}, {"reply", "--from-clipboard"}} {
+		if _, err := Process(context.Background(), sc, args); KindOf(err) != KindUsage || !strings.Contains(err.Error(), "no clipboard") {
+			t.Errorf("Expected a usage error for %q without a clipboard\n  Actual %v", args, err)
+		}
+	}
+}
+
+func setupTestFiles(t *testing.T) (Context, string, string) {
+	sc, err := NewContext()
+	if err != nil {
+		t.Fatalf("Failed to create context: %v", err)
+	}
+
+	fileWithContentPath := filepath.Join(sc.TempDir, "file.txt")
+	err = os.WriteFile(fileWithContentPath, []byte("File content\n"), 0644)
+	if err != nil {
+		t.Fatalf("Failed to create file with content: %v", err)
+	}
+
+	emptyFilePath := filepath.Join(sc.TempDir, "empty.txt")
+	err = os.WriteFile(emptyFilePath, []byte{}, 0644)
+	if err != nil {
+		t.Fatalf("Failed to create empty file: %v", err)
+	}
+
+	return sc, fileWithContentPath, emptyFilePath
+}
+
+func TestMain(m *testing.M) {
+	if err := clipboard.Init(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to initialize clipboard: %v\n", err)
+		os.Exit(1)
+	}
+	exitCode := m.Run()
+
+	// Clean up the clipboard after the tests are done
+	clipboard.Write(clipboard.FmtText, nil)
+
+	os.Exit(exitCode)
+}
+
+func TestRegister(t *testing.T) {
+	Register("shout", func(ctx context.Context, sc Context, args []string) ([]entry.Entry, error) {
+		return []entry.Entry{entry.Message{Text: fmt.Sprint(len(args), " words")}}, nil
+	})
+	defer func() { subcommands = subcommands[:len(subcommands)-1] }()
+
+	sc, err := NewContext()
+	if err != nil {
+		t.Fatalf("Failed to create context: %v", err)
+	}
+	defer sc.Cleanup()
+
+	entries, err := Process(context.Background(), sc, []string{"sh", "--priority", "low", "a", "b"})
+	if err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+	expected := []entry.Entry{entry.Prioritized{Entry: entry.Message{Text: "2 words"}, Priority: entry.PriorityLow}}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("Expected entries: %v\n  Actual entries: %v", expected, entries)
+	}
+}
+
+func TestProcessDeadline(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sleep")
+	}
+	sc, err := NewContext()
+	if err != nil {
+		t.Fatalf("Failed to create context: %v", err)
+	}
+	defer sc.Cleanup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = Process(ctx, sc, []string{"say", "Before,", "exec", "sleep", "10"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded, got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected the command to be killed at the deadline, but Process took %v", elapsed)
+	}
+}
+
+func TestProcessKeepGoing(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires false")
+	}
+	sc, fileWithContentPath, _ := setupTestFiles(t)
+	defer sc.Cleanup()
+	missingPath := filepath.Join(sc.TempDir, "missing.txt")
+	args := []string{"attach", fileWithContentPath, missingPath + ",", "exec", "false,", "frobnicate,", "say", "Still here"}
+
+	if _, err := Process(context.Background(), sc, args); err == nil {
+		t.Fatal("Expected Process to fail without KeepGoing")
+	}
+
+	sc.KeepGoing = true
+	entries, err := Process(context.Background(), sc, args)
+	if err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+	expected := []entry.Entry{
+		entry.File{StoragePath: fileWithContentPath, OriginalPath: fileWithContentPath},
+		entry.Failure{Command: "attach " + missingPath, Error: "file does not exist: " + missingPath},
+		entry.Failure{Command: "exec false", Error: "command execution failed: exit status 1"},
+		entry.Failure{Command: "frobnicate", Error: "unknown subcommand: frobnicate"},
+		entry.Message{Text: "Still here"},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("Expected entries: %v\n  Actual entries: %v", expected, entries)
+	}
+}
+
+func TestExecParallel(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sleep and false")
+	}
+	sc, _, _ := setupTestFiles(t)
+	defer sc.Cleanup()
+
+	// The first command finishes last, but its output still comes first.
+	args := []string{"exec", "--parallel", "sh -c 'sleep 0.2; echo slow'", "echo 'fast one'"}
+	entries, err := Execute(context.Background(), sc, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []entry.Entry{
+		entry.Message{Text: "Output of `sh -c 'sleep 0.2; echo slow'`:"},
+		entry.Output{Output: "slow\n", Command: "sh -c sleep 0.2; echo slow"},
+		entry.Message{Text: "Output of `echo 'fast one'`:"},
+		entry.Output{Output: "fast one\n", Command: "echo fast one"},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("Expected entries: %v\n  Actual entries: %v", expected, entries)
+	}
+
+	args = []string{"exec", "--parallel", "false", "echo ok"}
+	if _, err := Execute(context.Background(), sc, args); err == nil {
+		t.Fatal("Expected exec --parallel to fail without KeepGoing")
+	}
+	sc.KeepGoing = true
+	entries, err = Execute(context.Background(), sc, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []entry.Entry{
+		entry.Failure{Command: "exec false", Error: "command execution failed: exit status 1"},
+		entry.Message{Text: "Output of `echo ok`:"},
+		entry.Output{Output: "ok\n", Command: "echo ok"},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("Expected entries: %v\n  Actual entries: %v", expected, entries)
+	}
+}
+
+func TestExecuteLogs(t *testing.T) {
+	var buf bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo})))
+
+	sc, err := NewContext()
+	if err != nil {
+		t.Fatalf("Failed to create context: %v", err)
+	}
+	defer sc.Cleanup()
+
+	if _, err := Process(context.Background(), sc, []string{"say", "Hello,", "frobnicate"}); err == nil {
+		t.Fatal("Expected Process to fail")
+	}
+
+	var records []map[string]any
+	decoder := json.NewDecoder(&buf)
+	for decoder.More() {
+		var record map[string]any
+		if err := decoder.Decode(&record); err != nil {
+			t.Fatalf("Invalid log record: %v", err)
+		}
+		delete(record, "time")
+		delete(record, "duration")
+		records = append(records, record)
+	}
+	expected := []map[string]any{
+		{"level": "INFO", "msg": "subcommand", "command": "say", "args": []any{"Hello"}, "entries": float64(1), "bytes": float64(5)},
+	}
+	if !reflect.DeepEqual(records, expected) {
+		t.Errorf("Expected log records: %v\n  Actual log records: %v", expected, records)
+	}
+}
+
+func TestProcessErrorKinds(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires false")
+	}
+	sc, err := NewContext()
+	if err != nil {
+		t.Fatalf("Failed to create context: %v", err)
+	}
+	defer sc.Cleanup()
+
+	testCases := []struct {
+		name     string
+		args     []string
+		expected ErrorKind
+	}{
+		{name: "Unknown subcommand", args: []string{"say", "Hi,", "frobnicate"}, expected: KindUsage},
+		{name: "Invalid priority", args: []string{"say", "--priority", "urgent", "Hi"}, expected: KindUsage},
+		{name: "Missing file", args: []string{"attach", filepath.Join(sc.TempDir, "missing.txt")}, expected: KindMissingFile},
+		{name: "Missing inserted file", args: []string{"insert", filepath.Join(sc.TempDir, "missing.txt")}, expected: KindMissingFile},
+		{name: "Failed command", args: []string{"exec", "false"}, expected: KindExec},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Process(context.Background(), sc, tc.args)
+			if actual := KindOf(err); actual != tc.expected {
+				t.Errorf("Expected kind %v, got %v (error: %v)", tc.expected, actual, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package subcmd
+
+import (
+	"context"
+	"flag"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+	"github.com/eloquence-cloud/ch/chlib/tfplan"
+)
+
+// tfplanFlags are the flags of the tfplan subcommand.
+type tfplanFlags struct {
+	maxAttrs *int
+}
+
+func addTFPlanFlags(flags *flag.FlagSet) tfplanFlags {
+	return tfplanFlags{
+		maxAttrs: flags.Int("max-attrs", 20, "List at most `n` changed attributes of each resource, 0 for all"),
+	}
+}
+
+// tfplanSub implements "tfplan plan.json...": it adds a summary of each
+// Terraform plan, in the JSON form terraform show -json writes, in place of
+// the plan's JSON.
+func tfplanSub(ctx context.Context, sc Context, args []string) ([]entry.Entry, error) {
+	flags := newSubcommandFlags("tfplan")
+	f := addTFPlanFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return nil, Errorf(KindUsage, "invalid tfplan flags: %v", err)
+	}
+	if flags.NArg() == 0 {
+		return nil, Errorf(KindUsage, "tfplan takes one or more plans in JSON, e.g. terraform show -json plan.out > plan.json; ch tfplan plan.json")
+	}
+	if *f.maxAttrs < 0 {
+		return nil, Errorf(KindUsage, "tfplan --max-attrs must be 0 or more")
+	}
+	return eachPath(ctx, sc, "tfplan", flags.Args(), func(planPath string) ([]entry.Entry, error) {
+		planJSON, err := readLocalOrRemote(ctx, sc, planPath)
+		if err != nil {
+			return nil, err
+		}
+		summary, err := tfplan.Summarize([]byte(planJSON), *f.maxAttrs)
+		if err != nil {
+			return nil, Errorf(KindOther, "%s: %v", planPath, err)
+		}
+		return []entry.Entry{
+			entry.Message{Text: "Summary of the Terraform plan " + planPath + ":"},
+			entry.Output{Output: summary, Command: "tfplan " + planPath, Lang: "text"},
+		}, nil
+	})
+}
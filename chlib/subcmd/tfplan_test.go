@@ -0,0 +1,47 @@
+package subcmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+)
+
+func TestTFPlanSub(t *testing.T) {
+	sc, fileWithContent, _ := setupTestFiles(t)
+	defer sc.Cleanup()
+	plan := filepath.Join(sc.TempDir, "plan.json")
+	content := `{"format_version": "1.2", "resource_changes": [
+  {"address": "aws_instance.web", "change": {"actions": ["update"],
+    "before": {"instance_type": "t3.small", "ami": "ami-1"},
+    "after": {"instance_type": "t3.large", "ami": "ami-1"}}}
+]}`
+	if err := os.WriteFile(plan, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := tfplanSub(context.Background(), sc, []string{plan})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Expected a label and a summary\n  Actual %#v", entries)
+	}
+	if label := entries[0].(entry.Message).Text; label != "Summary of the Terraform plan "+plan+":" {
+		t.Errorf("Unexpected label %q", label)
+	}
+	summary := entries[1].(entry.Output).Output
+	if !strings.Contains(summary, `instance_type: "t3.small" → "t3.large"`) || strings.Contains(summary, "ami") {
+		t.Errorf("Expected only the changed attribute\n  Actual %s", summary)
+	}
+
+	if _, err := tfplanSub(context.Background(), sc, []string{fileWithContent}); err == nil {
+		t.Error("Expected an error for a file that isn't a plan")
+	}
+	if _, err := tfplanSub(context.Background(), sc, nil); KindOf(err) != KindUsage {
+		t.Errorf("Expected a usage error without a plan\n  Actual %v", err)
+	}
+}
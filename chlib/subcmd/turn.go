@@ -0,0 +1,109 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package subcmd
+
+import (
+	"context"
+	"flag"
+	"slices"
+	"strings"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+)
+
+// turnSub implements "turn role [text|@file...]": it begins a turn of a
+// conversation, so that the subcommands after it, up to the next turn, add
+// what role said. Its own arguments, if any, start the turn: words are
+// added as a message, as say adds them, and @file inserts the file's
+// contents, such as a saved reply.
+func turnSub(ctx context.Context, sc Context, args []string) ([]entry.Entry, error) {
+	if len(args) == 0 || !slices.Contains(entry.Roles, args[0]) {
+		return nil, Errorf(KindUsage, "turn takes a role (system, user, or assistant), e.g. turn assistant @reply.md")
+	}
+	entries := []entry.Entry{entry.Turn{Role: args[0]}}
+	var words []string
+	addWords := func() {
+		if len(words) > 0 {
+			entries = append(entries, entry.Message{Text: strings.Join(words, " ")})
+			words = nil
+		}
+	}
+	for _, arg := range args[1:] {
+		filePath, ok := strings.CutPrefix(arg, "@")
+		if !ok || filePath == "" {
+			words = append(words, arg)
+			continue
+		}
+		addWords()
+		content, err := readLocalOrRemote(ctx, sc, filePath)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry.Message{Text: content, Source: filePath})
+	}
+	addWords()
+	return entries, nil
+}
+
+// replyFlags are the flags of the reply subcommand.
+type replyFlags struct {
+	fromClipboard *bool
+	from          *string
+}
+
+func addReplyFlags(flags *flag.FlagSet) replyFlags {
+	return replyFlags{
+		fromClipboard: flags.Bool("from-clipboard", false, "Record the response on the clipboard, as copied from a chat"),
+		from:          flags.String("from", "", "Record the response saved in `file`"),
+	}
+}
+
+// replySub implements "reply --from-clipboard" and "reply --from file": it
+// records an AI's response as an assistant turn, so that a session (ch -i,
+// or a ch daemon session) carries the conversation so far into the next
+// prompt.
+func replySub(ctx context.Context, sc Context, args []string) ([]entry.Entry, error) {
+	flags := newSubcommandFlags("reply")
+	f := addReplyFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return nil, Errorf(KindUsage, "invalid reply flags: %v", err)
+	}
+	if flags.NArg() > 0 || *f.fromClipboard == (*f.from != "") {
+		return nil, Errorf(KindUsage, "reply takes either --from-clipboard or --from file")
+	}
+
+	var text, source string
+	var err error
+	if *f.fromClipboard {
+		if text, err = readClipboardText(); err != nil {
+			return nil, err
+		}
+		source = "clipboard"
+	} else {
+		if text, err = readLocalOrRemote(ctx, sc, *f.from); err != nil {
+			return nil, err
+		}
+		source = *f.from
+	}
+	if strings.TrimSpace(text) == "" {
+		return nil, Errorf(KindUsage, "reply: %s holds no response", source)
+	}
+	return []entry.Entry{entry.Turn{Role: "assistant"}, entry.Message{Text: text, Source: source}}, nil
+}
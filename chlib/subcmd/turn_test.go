@@ -0,0 +1,112 @@
+package subcmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+	"golang.design/x/clipboard"
+)
+
+func TestTurnSub(t *testing.T) {
+	sc, _, _ := setupTestFiles(t)
+	defer sc.Cleanup()
+	reply := filepath.Join(sc.TempDir, "reply.md")
+	if err := os.WriteFile(reply, []byte("Use a mutex.\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		args     []string
+		expected []entry.Entry
+	}{
+		{
+			name:     "Role only",
+			args:     []string{"user"},
+			expected: []entry.Entry{entry.Turn{Role: "user"}},
+		},
+		{
+			name:     "Words",
+			args:     []string{"system", "Be", "brief."},
+			expected: []entry.Entry{entry.Turn{Role: "system"}, entry.Message{Text: "Be brief."}},
+		},
+		{
+			name: "File",
+			args: []string{"assistant", "Earlier:", "@" + reply, "@"},
+			expected: []entry.Entry{
+				entry.Turn{Role: "assistant"},
+				entry.Message{Text: "Earlier:"},
+				entry.Message{Text: "Use a mutex.\n", Source: reply},
+				entry.Message{Text: "@"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual, err := turnSub(context.Background(), sc, test.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(actual, test.expected) {
+				t.Errorf("Expected %#v\n  Actual %#v", test.expected, actual)
+			}
+		})
+	}
+
+	for _, args := range [][]string{nil, {"narrator"}} {
+		if _, err := turnSub(context.Background(), sc, args); KindOf(err) != KindUsage {
+			t.Errorf("Expected a usage error for %q\n  Actual %v", args, err)
+		}
+	}
+	if _, err := turnSub(context.Background(), sc, []string{"user", "@/nonexistent/reply.md"}); KindOf(err) != KindMissingFile {
+		t.Errorf("Expected a missing file error\n  Actual %v", err)
+	}
+}
+
+func TestReplySub(t *testing.T) {
+	sc, fileWithContent, emptyFile := setupTestFiles(t)
+	defer sc.Cleanup()
+
+	entries, err := replySub(context.Background(), sc, []string{"--from", fileWithContent})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []entry.Entry{entry.Turn{Role: "assistant"}, entry.Message{Text: "File content\n", Source: fileWithContent}}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("Expected %#v\n  Actual %#v", expected, entries)
+	}
+
+	for _, args := range [][]string{nil, {"--from-clipboard", "--from", fileWithContent}, {"--from", emptyFile}, {"--from", fileWithContent, "extra"}} {
+		if _, err := replySub(context.Background(), sc, args); KindOf(err) != KindUsage {
+			t.Errorf("Expected a usage error for %q\n  Actual %v", args, err)
+		}
+	}
+}
+
+func TestReplySubClipboard(t *testing.T) {
+	sc, err := NewContext()
+	if err != nil {
+		t.Fatalf("Failed to create context: %v", err)
+	}
+	defer sc.Cleanup()
+
+	clipboard.Write(clipboard.FmtText, []byte("Use a mutex.\n"))
+	entries, err := replySub(context.Background(), sc, []string{"--from-clipboard"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []entry.Entry{entry.Turn{Role: "assistant"}, entry.Message{Text: "Use a mutex.\n", Source: "clipboard"}}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("Expected %#v\n  Actual %#v", expected, entries)
+	}
+
+	clipboard.Write(clipboard.FmtText, []byte(" \n"))
+	if _, err := replySub(context.Background(), sc, []string{"--from-clipboard"}); KindOf(err) != KindUsage {
+		t.Errorf("Expected a usage error for an empty clipboard\n  Actual %v", err)
+	}
+}
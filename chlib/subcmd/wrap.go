@@ -0,0 +1,68 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package subcmd
+
+import (
+	"context"
+	"regexp"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+)
+
+// tagPattern matches the tag names that wrap accepts: XML names without
+// namespaces.
+var tagPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+// wrapSub implements "wrap tag subcommand": it surrounds the subcommand's
+// entries with <tag> and </tag>, to label a group of context the way
+// prompting guides recommend. Process gives wrap all of the subcommands
+// after it, up to "end", so that
+//
+//	wrap logs exec journalctl -n 100, attach app.log, end
+//
+// puts both entries inside <logs>. This function handles the single
+// subcommand of a wrap run by Execute, as from if-exists.
+func wrapSub(ctx context.Context, sc Context, args []string) ([]entry.Entry, error) {
+	return wrapSubcommands(ctx, sc, args, nil)
+}
+
+// wrapSubcommands runs a wrap whose own words are args (the tag and the
+// start of the first subcommand) followed by the subcommands body.
+func wrapSubcommands(ctx context.Context, sc Context, args []string, body [][]string) ([]entry.Entry, error) {
+	if len(args) == 0 {
+		return nil, Errorf(KindUsage, "wrap takes a tag and subcommands, e.g. wrap logs exec journalctl -n 100, end")
+	}
+	tag := args[0]
+	if !tagPattern.MatchString(tag) {
+		return nil, Errorf(KindUsage, "invalid wrap tag %q (use letters, digits, '_', '.', and '-')", tag)
+	}
+	if len(args) > 1 {
+		body = append([][]string{args[1:]}, body...)
+	}
+	entries, err := processSubcommands(ctx, sc, body)
+	if err != nil {
+		return nil, err
+	}
+	// The tags are kept even if a budget drops what they enclose, so that
+	// they always pair up.
+	open := entry.Prioritized{Entry: entry.Message{Text: "<" + tag + ">"}, Priority: entry.PriorityHigh}
+	closing := entry.Prioritized{Entry: entry.Message{Text: "</" + tag + ">"}, Priority: entry.PriorityHigh}
+	return append(append([]entry.Entry{open}, entries...), closing), nil
+}
@@ -0,0 +1,67 @@
+package subcmd
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+)
+
+func TestWrap(t *testing.T) {
+	sc, filePath, emptyPath := setupTestFiles(t)
+	defer sc.Cleanup()
+	say := func(text string) entry.Entry { return entry.Message{Text: text} }
+	tag := func(text string) entry.Entry {
+		return entry.Prioritized{Entry: entry.Message{Text: text}, Priority: entry.PriorityHigh}
+	}
+
+	testCases := []struct {
+		name     string
+		args     []string
+		expected []entry.Entry
+	}{
+		{
+			"up to end",
+			[]string{"wrap", "logs", "say", "one,", "say", "two,", "end,", "say", "Why?"},
+			[]entry.Entry{tag("<logs>"), say("one"), say("two"), tag("</logs>"), say("Why?")},
+		},
+		{
+			"to the end of the line",
+			[]string{"say", "Context:,", "wrap", "requirements", "say", "Be fast"},
+			[]entry.Entry{say("Context:"), tag("<requirements>"), say("Be fast"), tag("</requirements>")},
+		},
+		{
+			"nested in foreach",
+			[]string{"foreach", filepath.Join(sc.TempDir, "*.txt"), "wrap", "document", "say", "{},", "end,", "end,", "say", "Done"},
+			[]entry.Entry{
+				tag("<document>"), say(emptyPath), tag("</document>"),
+				tag("<document>"), say(filePath), tag("</document>"),
+				say("Done"),
+			},
+		},
+		{
+			"empty",
+			[]string{"wrap", "empty,", "end"},
+			[]entry.Entry{tag("<empty>"), tag("</empty>")},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			entries, err := Process(context.Background(), sc, tc.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(entries, tc.expected) {
+				t.Errorf("Expected %v\n  Actual %v", tc.expected, entries)
+			}
+		})
+	}
+
+	for _, args := range [][]string{{"wrap"}, {"wrap", "<logs>", "say", "x"}, {"wrap", "2nd", "say", "x"}} {
+		if _, err := Process(context.Background(), sc, args); err == nil {
+			t.Errorf("Expected an error for %q", args)
+		}
+	}
+}
@@ -0,0 +1,361 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+// Package tfplan summarizes the JSON form of a Terraform plan, the output
+// of "terraform show -json plan", as the resources it creates, updates,
+// replaces, and destroys, with the attributes that change. It keeps infra
+// reviews to the substance of a plan whose JSON may run to megabytes.
+package tfplan
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// plan is the part of a plan's JSON that a summary uses.
+type plan struct {
+	FormatVersion   string           `json:"format_version"`
+	ResourceChanges []resourceChange `json:"resource_changes"`
+	OutputChanges   map[string]struct {
+		Change change `json:"change"`
+	} `json:"output_changes"`
+}
+
+type resourceChange struct {
+	Address      string `json:"address"`
+	Mode         string `json:"mode"`
+	ActionReason string `json:"action_reason"`
+	Change       change `json:"change"`
+}
+
+type change struct {
+	Actions         []string `json:"actions"`
+	Before          any      `json:"before"`
+	After           any      `json:"after"`
+	AfterUnknown    any      `json:"after_unknown"`
+	BeforeSensitive any      `json:"before_sensitive"`
+	AfterSensitive  any      `json:"after_sensitive"`
+	ReplacePaths    [][]any  `json:"replace_paths"`
+}
+
+// Summarize returns a summary of a plan in JSON, listing for each changed
+// resource at most maxAttrs changed attributes (0 for no limit).
+func Summarize(planJSON []byte, maxAttrs int) (string, error) {
+	var p plan
+	if err := json.Unmarshal(planJSON, &p); err != nil {
+		return "", fmt.Errorf("invalid plan JSON: %v", err)
+	}
+	if p.FormatVersion == "" {
+		return "", fmt.Errorf("not a Terraform plan: no format_version (use the output of terraform show -json)")
+	}
+
+	var b strings.Builder
+	counts := map[string]int{}
+	for _, rc := range p.ResourceChanges {
+		kind := kindOf(rc.Change.Actions)
+		if kind == "no-op" {
+			continue
+		}
+		counts[kind]++
+		writeResource(&b, rc, kind, maxAttrs)
+	}
+	if outputs := outputChanges(p, maxAttrs); outputs != "" {
+		b.WriteString("\nOutputs:\n" + outputs)
+	}
+
+	var parts []string
+	for _, kind := range []string{"create", "update", "replace", "destroy", "read"} {
+		if counts[kind] > 0 {
+			parts = append(parts, fmt.Sprintf("%d to %s", counts[kind], kind))
+		}
+	}
+	if len(parts) == 0 {
+		parts = []string{"no changes"}
+	}
+	header := "Terraform plan: " + strings.Join(parts, ", ") + "\n"
+	if b.Len() > 0 {
+		header += "\n"
+	}
+	return header + b.String(), nil
+}
+
+// kindOf classifies a change's actions.
+func kindOf(actions []string) string {
+	switch strings.Join(actions, ",") {
+	case "create":
+		return "create"
+	case "update":
+		return "update"
+	case "delete":
+		return "destroy"
+	case "delete,create", "create,delete":
+		return "replace"
+	case "read":
+		return "read"
+	}
+	return "no-op"
+}
+
+// symbols are the markers Terraform's own plan output uses for each kind of
+// change.
+var symbols = map[string]string{
+	"create":  "+",
+	"update":  "~",
+	"replace": "-/+",
+	"destroy": "-",
+	"read":    "<=",
+}
+
+// writeResource writes a resource's change and its attributes: all those
+// set, for a create, and those that change, for an update or replace.
+func writeResource(b *strings.Builder, rc resourceChange, kind string, maxAttrs int) {
+	description := kind
+	switch kind {
+	case "update":
+		description = "update in place"
+	case "replace":
+		if strings.HasPrefix(strings.Join(rc.Change.Actions, ","), "create") {
+			description = "replace, create before destroy"
+		}
+	}
+	if reason := reasons[rc.ActionReason]; reason != "" {
+		description += ", " + reason
+	}
+	fmt.Fprintf(b, "%s %s (%s)\n", symbols[kind], rc.Address, description)
+	if kind == "destroy" || kind == "read" {
+		return
+	}
+
+	c := rc.Change
+	before := flatten(c.Before)
+	after := flatten(c.After)
+	unknown := trueOnly(flatten(c.AfterUnknown))
+	sensitive := trueOnly(flatten(c.AfterSensitive))
+	beforeSensitive := trueOnly(flatten(c.BeforeSensitive))
+	forces := map[string]bool{}
+	for _, path := range c.ReplacePaths {
+		forces[pathString(path)] = true
+	}
+
+	var lines []string
+	for _, path := range unionKeys(before, after, unknown) {
+		oldValue, hadOld := before[path]
+		newValue, hasNew := after[path]
+		newText := show(newValue)
+		switch {
+		case unknown[path] == true:
+			newText = "(known after apply)"
+		case sensitive[path] == true:
+			newText = "(sensitive)"
+		}
+		var line string
+		if kind == "create" {
+			if newValue == nil && unknown[path] != true {
+				continue
+			}
+			line = fmt.Sprintf("%s = %s", path, newText)
+		} else {
+			if unknown[path] != true && hadOld == hasNew && show(oldValue) == show(newValue) && sensitive[path] == beforeSensitive[path] {
+				continue
+			}
+			oldText := show(oldValue)
+			if beforeSensitive[path] == true {
+				oldText = "(sensitive)"
+			}
+			if !hadOld {
+				oldText = "null"
+			}
+			if !hasNew && unknown[path] != true {
+				newText = "null"
+			}
+			line = fmt.Sprintf("%s: %s → %s", path, oldText, newText)
+		}
+		if forces[path] || forcesParent(forces, path) {
+			line += "  # forces replacement"
+		}
+		lines = append(lines, line)
+	}
+	if maxAttrs > 0 && len(lines) > maxAttrs {
+		more := len(lines) - maxAttrs
+		lines = append(lines[:maxAttrs], fmt.Sprintf("… %d more", more))
+	}
+	for _, line := range lines {
+		fmt.Fprintf(b, "    %s\n", line)
+	}
+}
+
+// reasons explain the action reasons Terraform gives.
+var reasons = map[string]string{
+	"replace_because_tainted":           "because it is tainted",
+	"replace_because_cannot_update":     "because an attribute can't be updated in place",
+	"replace_by_request":                "by request",
+	"delete_because_no_resource_config": "because it is no longer in the configuration",
+	"delete_because_no_module":          "because its module is no longer in the configuration",
+	"delete_because_wrong_repetition":   "because of a change to count or for_each",
+	"delete_because_count_index":        "because it is beyond count",
+	"delete_because_each_key":           "because its key is no longer in for_each",
+	"read_because_config_unknown":       "because its configuration depends on values not yet known",
+	"read_because_dependency_pending":   "because a dependency has pending changes",
+}
+
+// outputChanges describes the outputs that change.
+func outputChanges(p plan, maxAttrs int) string {
+	var names []string
+	for name, oc := range p.OutputChanges {
+		if kindOf(oc.Change.Actions) != "no-op" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, name := range names {
+		c := p.OutputChanges[name].Change
+		kind := kindOf(c.Actions)
+		newText := show(c.After)
+		if c.AfterUnknown == true {
+			newText = "(known after apply)"
+		} else if c.AfterSensitive == true {
+			newText = "(sensitive)"
+		}
+		switch kind {
+		case "create":
+			fmt.Fprintf(&b, "+ %s = %s\n", name, newText)
+		case "destroy":
+			fmt.Fprintf(&b, "- %s\n", name)
+		default:
+			oldText := show(c.Before)
+			if c.BeforeSensitive == true {
+				oldText = "(sensitive)"
+			}
+			fmt.Fprintf(&b, "~ %s: %s → %s\n", name, oldText, newText)
+		}
+	}
+	return b.String()
+}
+
+// flatten maps the dotted path of each scalar, empty collection, and null
+// in value to it, e.g. "tags.env" or "ingress[0].port".
+func flatten(value any) map[string]any {
+	out := map[string]any{}
+	var walk func(path string, value any)
+	walk = func(path string, value any) {
+		switch v := value.(type) {
+		case map[string]any:
+			if len(v) == 0 && path != "" {
+				out[path] = v
+			}
+			for key, child := range v {
+				walk(joinPath(path, key), child)
+			}
+		case []any:
+			if len(v) == 0 && path != "" {
+				out[path] = v
+			}
+			for i, child := range v {
+				walk(fmt.Sprintf("%s[%d]", path, i), child)
+			}
+		default:
+			if path != "" {
+				out[path] = v
+			}
+		}
+	}
+	walk("", value)
+	return out
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// pathString writes a replace path, such as ["ingress", 0, "port"], the
+// way flatten does.
+func pathString(path []any) string {
+	var s string
+	for _, step := range path {
+		if n, ok := step.(float64); ok {
+			s += "[" + strconv.Itoa(int(n)) + "]"
+		} else {
+			s = joinPath(s, fmt.Sprint(step))
+		}
+	}
+	return s
+}
+
+// forcesParent reports whether a replace path covers path from above, e.g.
+// "tags" for "tags.env".
+func forcesParent(forces map[string]bool, path string) bool {
+	for forced := range forces {
+		if strings.HasPrefix(path, forced+".") || strings.HasPrefix(path, forced+"[") {
+			return true
+		}
+	}
+	return false
+}
+
+// unionKeys returns the keys of maps, sorted.
+func unionKeys(maps ...map[string]any) []string {
+	seen := map[string]bool{}
+	var keys []string
+	for _, m := range maps {
+		for key := range m {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// trueOnly returns the paths in m whose value is true, as after_unknown
+// and the sensitivity maps mark them; the rest hold false.
+func trueOnly(m map[string]any) map[string]any {
+	out := map[string]any{}
+	for key, value := range m {
+		if value == true {
+			out[key] = value
+		}
+	}
+	return out
+}
+
+// show writes a value as HCL would show it.
+func show(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return strconv.Quote(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case map[string]any, []any:
+		data, _ := json.Marshal(v)
+		return string(data)
+	default:
+		return fmt.Sprint(v)
+	}
+}
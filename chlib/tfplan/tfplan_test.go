@@ -0,0 +1,145 @@
+package tfplan
+
+import (
+	"testing"
+)
+
+const samplePlan = `{
+  "format_version": "1.2",
+  "terraform_version": "1.7.0",
+  "resource_changes": [
+    {
+      "address": "aws_s3_bucket.logs",
+      "mode": "managed",
+      "change": {
+        "actions": ["create"],
+        "before": null,
+        "after": {"bucket": "acme-logs", "force_destroy": false, "tags": {"env": "prod"}, "policy": null},
+        "after_unknown": {"arn": true, "id": true, "tags": {}},
+        "before_sensitive": false,
+        "after_sensitive": {"tags": {}}
+      }
+    },
+    {
+      "address": "aws_instance.web",
+      "mode": "managed",
+      "change": {
+        "actions": ["update"],
+        "before": {"ami": "ami-1", "instance_type": "t3.small", "tags": {"Name": "web"}, "user_data": "a"},
+        "after": {"ami": "ami-1", "instance_type": "t3.large", "tags": {"Name": "web-1"}, "user_data": "b"},
+        "after_unknown": {"tags": {}},
+        "before_sensitive": {"user_data": true},
+        "after_sensitive": {"user_data": true, "tags": {}}
+      }
+    },
+    {
+      "address": "aws_db_instance.main",
+      "mode": "managed",
+      "action_reason": "replace_because_cannot_update",
+      "change": {
+        "actions": ["delete", "create"],
+        "before": {"engine_version": "13", "id": "db-1", "name": "main"},
+        "after": {"engine_version": "15", "name": "main"},
+        "after_unknown": {"id": true},
+        "replace_paths": [["engine_version"]]
+      }
+    },
+    {
+      "address": "aws_iam_role.old",
+      "mode": "managed",
+      "action_reason": "delete_because_no_resource_config",
+      "change": {"actions": ["delete"], "before": {"name": "old"}, "after": null}
+    },
+    {
+      "address": "aws_vpc.main",
+      "mode": "managed",
+      "change": {"actions": ["no-op"], "before": {"id": "vpc-1"}, "after": {"id": "vpc-1"}}
+    }
+  ],
+  "output_changes": {
+    "bucket_arn": {"change": {"actions": ["create"], "before": null, "after_unknown": true}},
+    "vpc_id": {"change": {"actions": ["no-op"], "before": "vpc-1", "after": "vpc-1"}}
+  }
+}`
+
+func TestSummarize(t *testing.T) {
+	tests := []struct {
+		name     string
+		plan     string
+		maxAttrs int
+		expected string
+	}{
+		{
+			name: "Plan",
+			plan: samplePlan,
+			expected: `Terraform plan: 1 to create, 1 to update, 1 to replace, 1 to destroy
+
++ aws_s3_bucket.logs (create)
+    arn = (known after apply)
+    bucket = "acme-logs"
+    force_destroy = false
+    id = (known after apply)
+    tags.env = "prod"
+~ aws_instance.web (update in place)
+    instance_type: "t3.small" → "t3.large"
+    tags.Name: "web" → "web-1"
+    user_data: (sensitive) → (sensitive)
+-/+ aws_db_instance.main (replace, because an attribute can't be updated in place)
+    engine_version: "13" → "15"  # forces replacement
+    id: "db-1" → (known after apply)
+- aws_iam_role.old (destroy, because it is no longer in the configuration)
+
+Outputs:
++ bucket_arn = (known after apply)
+`,
+		},
+		{
+			name:     "Attribute limit",
+			plan:     samplePlan,
+			maxAttrs: 2,
+			expected: `Terraform plan: 1 to create, 1 to update, 1 to replace, 1 to destroy
+
++ aws_s3_bucket.logs (create)
+    arn = (known after apply)
+    bucket = "acme-logs"
+    … 3 more
+~ aws_instance.web (update in place)
+    instance_type: "t3.small" → "t3.large"
+    tags.Name: "web" → "web-1"
+    … 1 more
+-/+ aws_db_instance.main (replace, because an attribute can't be updated in place)
+    engine_version: "13" → "15"  # forces replacement
+    id: "db-1" → (known after apply)
+- aws_iam_role.old (destroy, because it is no longer in the configuration)
+
+Outputs:
++ bucket_arn = (known after apply)
+`,
+		},
+		{
+			name:     "No changes",
+			plan:     `{"format_version": "1.2", "resource_changes": []}`,
+			expected: "Terraform plan: no changes\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual, err := Summarize([]byte(test.plan), test.maxAttrs)
+			if err != nil {
+				t.Fatalf("Summarize failed: %v", err)
+			}
+			if actual != test.expected {
+				t.Errorf("Expected:\n%s\n  Actual:\n%s", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestSummarizeErrors(t *testing.T) {
+	for _, input := range []string{`not json`, `{"resources": []}`} {
+		if _, err := Summarize([]byte(input), 0); err == nil {
+			t.Errorf("Expected an error for %q", input)
+		}
+	}
+}
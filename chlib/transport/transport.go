@@ -0,0 +1,186 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+// Package transport builds the HTTP transport that ch reaches services
+// through. By default it honors $HTTP_PROXY, $HTTPS_PROXY, and $NO_PROXY;
+// Options can name a proxy explicitly, such as a SOCKS5 proxy, and trust a
+// private certificate authority or present a client certificate.
+package transport
+
+import (
+	"cmp"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Options configure an HTTP transport. The zero value gives the default
+// transport.
+type Options struct {
+	// Proxy is the URL of the proxy to send requests through, with the
+	// scheme http, https, socks5, or socks5h, or "direct" to use no proxy.
+	// If it is empty, the proxy comes from the environment. Hosts matching
+	// $NO_PROXY, and loopback addresses, are always reached directly.
+	Proxy string
+
+	// CACert is a PEM file of certificate authorities to trust in addition
+	// to the system's, such as a company's private CA.
+	CACert string
+
+	// ClientCert and ClientKey are PEM files of a certificate, and its
+	// private key, to present to servers that require one. ClientKey may
+	// be empty if ClientCert holds the key as well.
+	ClientCert string
+	ClientKey  string
+
+	// InsecureSkipVerify accepts any server certificate. It leaves
+	// connections open to interception, so New logs a warning.
+	InsecureSkipVerify bool
+}
+
+// New returns an HTTP transport configured by opts.
+func New(opts Options) (http.RoundTripper, error) {
+	if opts == (Options{}) {
+		return http.DefaultTransport, nil
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	if opts.Proxy != "" {
+		proxy, err := ParseProxy(opts.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		noProxy := os.Getenv("NO_PROXY")
+		if noProxy == "" {
+			noProxy = os.Getenv("no_proxy")
+		}
+		t.Proxy = func(req *http.Request) (*url.URL, error) {
+			if proxy == nil || bypass(req.URL.Hostname(), noProxy) {
+				return nil, nil
+			}
+			return proxy, nil
+		}
+	}
+	tlsConfig, err := opts.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		t.TLSClientConfig = tlsConfig
+	}
+	return t, nil
+}
+
+// tlsConfig returns the TLS configuration for opts, or nil if the default
+// will do.
+func (opts Options) tlsConfig() (*tls.Config, error) {
+	if opts.CACert == "" && opts.ClientCert == "" && opts.ClientKey == "" && !opts.InsecureSkipVerify {
+		return nil, nil
+	}
+	config := &tls.Config{}
+	if opts.CACert != "" {
+		pem, err := os.ReadFile(opts.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA certificate: %v", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			slog.Debug("no system certificate pool", "error", err)
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no PEM certificates in CA certificate %s", opts.CACert)
+		}
+		config.RootCAs = pool
+	}
+	if opts.ClientKey != "" && opts.ClientCert == "" {
+		return nil, fmt.Errorf("a client key needs a client certificate")
+	}
+	if opts.ClientCert != "" {
+		key := cmp.Or(opts.ClientKey, opts.ClientCert)
+		cert, err := tls.LoadX509KeyPair(opts.ClientCert, key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	if opts.InsecureSkipVerify {
+		slog.Warn("TLS certificate verification is OFF: any server, or anyone intercepting the connection, will be trusted with requests and credentials")
+		config.InsecureSkipVerify = true
+	}
+	return config, nil
+}
+
+// ParseProxy parses a proxy URL, returning nil for "direct".
+func ParseProxy(s string) (*url.URL, error) {
+	if s == "direct" {
+		return nil, nil
+	}
+	proxy, err := url.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy %q: %v", s, err)
+	}
+	switch proxy.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("invalid proxy %q: expected an http, https, socks5, or socks5h URL, or direct", s)
+	}
+	if proxy.Host == "" {
+		return nil, fmt.Errorf("invalid proxy %q: no host", s)
+	}
+	return proxy, nil
+}
+
+// bypass reports whether host should be reached without the proxy: it is
+// a loopback address, or it matches an entry of noProxy, a comma-separated
+// list of host names, domain suffixes (".example.com" or "example.com",
+// which also match subdomains), IP addresses, and CIDR blocks, or "*".
+func bypass(host, noProxy string) bool {
+	ip := net.ParseIP(host)
+	if host == "localhost" || ip != nil && ip.IsLoopback() {
+		return true
+	}
+	for _, entry := range strings.Split(noProxy, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if h, _, err := net.SplitHostPort(entry); err == nil {
+			entry = h
+		}
+		switch {
+		case entry == "":
+		case entry == "*":
+			return true
+		case ip != nil:
+			if _, block, err := net.ParseCIDR(entry); err == nil && block.Contains(ip) || net.ParseIP(entry).Equal(ip) {
+				return true
+			}
+		default:
+			host := strings.ToLower(host)
+			domain := strings.TrimPrefix(entry, ".")
+			if host == domain || strings.HasSuffix(host, "."+domain) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,131 @@
+package transport
+
+import (
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBypass(t *testing.T) {
+	testCases := []struct {
+		host     string
+		noProxy  string
+		expected bool
+	}{
+		{"example.com", "", false},
+		{"localhost", "", true},
+		{"127.0.0.1", "", true},
+		{"::1", "", true},
+		{"example.com", "*", true},
+		{"example.com", "example.com", true},
+		{"api.example.com", "example.com", true},
+		{"api.example.com", ".example.com", true},
+		{"badexample.com", "example.com", false},
+		{"Example.COM", "internal, example.com:443", true},
+		{"10.1.2.3", "10.0.0.0/8", true},
+		{"11.1.2.3", "10.0.0.0/8", false},
+		{"192.168.0.1", "192.168.0.1", true},
+	}
+	for _, tc := range testCases {
+		if actual := bypass(tc.host, tc.noProxy); actual != tc.expected {
+			t.Errorf("bypass(%q, %q)\nExpected %v\n  Actual %v", tc.host, tc.noProxy, tc.expected, actual)
+		}
+	}
+}
+
+func TestParseProxy(t *testing.T) {
+	for _, valid := range []string{"http://proxy:3128", "https://proxy", "socks5://localhost:1080", "socks5h://user:pw@proxy:1080", "direct"} {
+		if _, err := ParseProxy(valid); err != nil {
+			t.Errorf("Expected %q to be valid\n  Actual %v", valid, err)
+		}
+	}
+	for _, invalid := range []string{"ftp://proxy", "proxy:3128", "http://", "://"} {
+		if _, err := ParseProxy(invalid); err == nil {
+			t.Errorf("Expected %q to be invalid", invalid)
+		}
+	}
+}
+
+func TestNewProxy(t *testing.T) {
+	// An HTTP proxy sees the absolute URL of each request it forwards; this
+	// one answers them itself.
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+		io.WriteString(w, "via proxy")
+	}))
+	defer proxy.Close()
+	t.Setenv("NO_PROXY", "internal.example")
+
+	transport, err := New(Options{Proxy: proxy.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: transport}
+	resp, err := client.Get("http://service.example/path")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "via proxy" || proxied != "http://service.example/path" {
+		t.Errorf("Expected the request to go through the proxy\n  Actual %q for %q", body, proxied)
+	}
+
+	proxied = ""
+	if _, err := client.Get("http://internal.example/"); err == nil || proxied != "" {
+		t.Errorf("Expected a $NO_PROXY host to be reached directly, and fail to resolve\n  Actual %q, %v", proxied, err)
+	}
+}
+
+func TestNewTLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "secure")
+	}))
+	defer server.Close()
+	caCert := filepath.Join(t.TempDir(), "ca.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caCert, certPEM, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(opts Options) error {
+		transport, err := New(opts)
+		if err != nil {
+			return err
+		}
+		resp, err := (&http.Client{Transport: transport}).Get(server.URL)
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	}
+	if err := get(Options{}); err == nil {
+		t.Error("Expected the test server's certificate to be untrusted by default")
+	}
+	if err := get(Options{CACert: caCert}); err != nil {
+		t.Errorf("Expected -ca-cert to trust the test server\n  Actual %v", err)
+	}
+	if err := get(Options{InsecureSkipVerify: true}); err != nil {
+		t.Errorf("Expected -insecure-skip-verify to accept the test server\n  Actual %v", err)
+	}
+
+	notPEM := filepath.Join(t.TempDir(), "not.pem")
+	if err := os.WriteFile(notPEM, []byte("not a certificate\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, opts := range []Options{
+		{CACert: filepath.Join(t.TempDir(), "missing.pem")},
+		{CACert: notPEM},
+		{ClientKey: caCert},
+		{ClientCert: caCert},
+	} {
+		if _, err := New(opts); err == nil {
+			t.Errorf("Expected an error for %+v", opts)
+		}
+	}
+}
@@ -0,0 +1,327 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/eloquence-cloud/ch/chlib/render"
+	"github.com/eloquence-cloud/ch/chlib/subcmd"
+	"golang.design/x/clipboard"
+)
+
+// clipHistorySize is how many clipboard writes the clip history keeps.
+const clipHistorySize = 20
+
+// clipHistory keeps the last clipHistorySize outputs that ch copied to the
+// clipboard or sent to a model, one file each in dir, named by the time of
+// the copy, so that a prompt replaced by a later copy can be restored with
+// "ch clip restore". A model's reply to an output is kept beside it, with
+// the extension .reply.md.
+type clipHistory struct {
+	dir string
+}
+
+// clip is an output in the clip history.
+type clip struct {
+	path string
+	time time.Time
+}
+
+// defaultClipHistory returns the history in the data directory, moving it
+// there from the user cache directory, where older versions of ch kept it.
+func defaultClipHistory() (clipHistory, error) {
+	data, err := dataDir()
+	if err != nil {
+		return clipHistory{}, err
+	}
+	dir := filepath.Join(data, "clips")
+	if cache, err := os.UserCacheDir(); err == nil {
+		moveLegacy(filepath.Join(cache, "ch", "clips"), dir)
+	}
+	return clipHistory{dir: dir}, nil
+}
+
+// replyPath returns the path of the file that holds the reply to the clip.
+func (c clip) replyPath() string {
+	return strings.TrimSuffix(c.path, ".md") + ".reply.md"
+}
+
+// list returns the clips in the history, most recent first.
+func (h clipHistory) list() ([]clip, error) {
+	files, err := os.ReadDir(h.dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	var clips []clip
+	for _, file := range files {
+		nanos, err := strconv.ParseInt(strings.TrimSuffix(file.Name(), ".md"), 10, 64)
+		if err != nil || !strings.HasSuffix(file.Name(), ".md") {
+			continue
+		}
+		clips = append(clips, clip{path: filepath.Join(h.dir, file.Name()), time: time.Unix(0, nanos)})
+	}
+	slices.SortFunc(clips, func(a, b clip) int { return b.time.Compare(a.time) })
+	return clips, nil
+}
+
+// add records markdown as the most recent clip, unless it already is, and
+// removes the clips beyond clipHistorySize.
+func (h clipHistory) add(markdown string, now time.Time) error {
+	_, err := h.record(markdown, now)
+	return err
+}
+
+// addExchange records markdown as add does, with reply, a model's reply to
+// it.
+func (h clipHistory) addExchange(markdown, reply string, now time.Time) error {
+	c, err := h.record(markdown, now)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(c.replyPath(), []byte(reply), 0600)
+}
+
+// record adds markdown to the history as add does, returning its clip.
+func (h clipHistory) record(markdown string, now time.Time) (clip, error) {
+	clips, err := h.list()
+	if err != nil {
+		return clip{}, err
+	}
+	if len(clips) > 0 {
+		if latest, err := os.ReadFile(clips[0].path); err == nil && string(latest) == markdown {
+			return clips[0], nil
+		}
+	}
+	if err := os.MkdirAll(h.dir, 0700); err != nil {
+		return clip{}, err
+	}
+	c := clip{path: filepath.Join(h.dir, strconv.FormatInt(now.UnixNano(), 10)+".md"), time: now}
+	if err := os.WriteFile(c.path, []byte(markdown), 0600); err != nil {
+		return clip{}, err
+	}
+	for _, old := range clips[min(len(clips), clipHistorySize-1):] {
+		os.Remove(old.path)
+		os.Remove(old.replyPath())
+	}
+	return c, nil
+}
+
+// get returns the contents of clip n, counting from 1 for the most recent.
+func (h clipHistory) get(n int) (string, error) {
+	c, err := h.clip(n)
+	if err != nil {
+		return "", err
+	}
+	markdown, err := os.ReadFile(c.path)
+	if err != nil {
+		return "", err
+	}
+	return string(markdown), nil
+}
+
+// getReply returns the reply saved with clip n.
+func (h clipHistory) getReply(n int) (string, error) {
+	c, err := h.clip(n)
+	if err != nil {
+		return "", err
+	}
+	reply, err := os.ReadFile(c.replyPath())
+	if os.IsNotExist(err) {
+		return "", subcmd.Errorf(subcmd.KindUsage, "clip %d has no reply (only output sent with -send has one)", n)
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(reply), nil
+}
+
+// clip returns clip n, counting from 1 for the most recent.
+func (h clipHistory) clip(n int) (clip, error) {
+	clips, err := h.list()
+	if err != nil {
+		return clip{}, err
+	}
+	if n < 1 || n > len(clips) {
+		return clip{}, subcmd.Errorf(subcmd.KindUsage, "no clip %d in the history (there are %d)", n, len(clips))
+	}
+	return clips[n-1], nil
+}
+
+// defaultClipboardLimit is the largest output copied to the clipboard
+// without asking, unless clipboard_limit sets another. Much larger writes
+// can hang some desktop environments' clipboard managers.
+var defaultClipboardLimit = render.Limit{Amount: 2_000_000}
+
+// checkClipboardSize returns an error if markdown is larger than limit,
+// unless ask, which is nil when there is no one to ask, confirms that it
+// should be copied anyway.
+func checkClipboardSize(markdown string, limit render.Limit, ask func(question string) bool) error {
+	if limit.Measure(markdown) <= limit.Amount {
+		return nil
+	}
+	size := fmt.Sprintf("The output is %s (~%d tokens), over the clipboard limit of %s", describeBytes(len(markdown)), render.ApproxTokens(markdown), limit)
+	if ask != nil && ask(size+". Copy it anyway?") {
+		return nil
+	}
+	return subcmd.Errorf(subcmd.KindOutput, "%s; give -force to copy it, or use -o to write it to a file", size)
+}
+
+// describeBytes describes a size in bytes, in the largest unit that keeps
+// it at least 1.
+func describeBytes(n int) string {
+	switch {
+	case n >= 1_000_000:
+		return fmt.Sprintf("%.1f MB", float64(n)/1e6)
+	case n >= 1_000:
+		return fmt.Sprintf("%.1f kB", float64(n)/1e3)
+	default:
+		return fmt.Sprintf("%d bytes", n)
+	}
+}
+
+// askTerminal returns a function that asks a yes-or-no question on stderr
+// and reads the answer from stdin, or nil if stdin isn't a terminal.
+func askTerminal(stdin *os.File) func(question string) bool {
+	if info, err := stdin.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return nil
+	}
+	return func(question string) bool {
+		fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
+		answer, _ := bufio.NewReader(stdin).ReadString('\n')
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		return answer == "y" || answer == "yes"
+	}
+}
+
+// writeClipboard copies markdown to the clipboard and records it in the
+// clip history.
+func writeClipboard(markdown string) error {
+	if err := clipboard.Init(); err != nil {
+		return subcmd.Errorf(subcmd.KindOutput, "failed to initialize clipboard: %v", err)
+	}
+	clipboard.Write(clipboard.FmtText, []byte(markdown))
+	recordClip(markdown)
+	return nil
+}
+
+// recordClip adds markdown to the default clip history. Failures are only
+// logged, since the copy itself succeeded.
+func recordClip(markdown string) {
+	history, err := defaultClipHistory()
+	if err == nil {
+		err = history.add(markdown, time.Now())
+	}
+	if err != nil {
+		slog.Debug("failed to record clip", "error", err)
+	}
+}
+
+// clipCommand implements "ch clip list" and "ch clip restore [-reply] n".
+func clipCommand(args []string) error {
+	flags := newCommandFlags("clip")
+	reply := flags.Bool("reply", false, "Restore the model's reply to the output instead")
+	rest, err := parseInterspersed(flags, args)
+	if err != nil {
+		return err
+	}
+	history, err := defaultClipHistory()
+	if err != nil {
+		return fmt.Errorf("failed to locate clip history: %v", err)
+	}
+	switch {
+	case len(rest) == 1 && rest[0] == "list":
+		return listClips(history)
+	case len(rest) == 2 && rest[0] == "restore":
+		n, err := strconv.Atoi(rest[1])
+		if err != nil {
+			return usageError("invalid clip number %q", rest[1])
+		}
+		if *reply {
+			text, err := history.getReply(n)
+			if err != nil {
+				return err
+			}
+			// The reply isn't recorded as a clip itself, so that it doesn't
+			// push prompts out of the history.
+			if err := clipboard.Init(); err != nil {
+				return subcmd.Errorf(subcmd.KindOutput, "failed to initialize clipboard: %v", err)
+			}
+			clipboard.Write(clipboard.FmtText, []byte(text))
+			fmt.Fprintf(messages, "The reply to clip %d copied to the clipboard.\n", n)
+			return nil
+		}
+		markdown, err := history.get(n)
+		if err != nil {
+			return err
+		}
+		if err := writeClipboard(markdown); err != nil {
+			return err
+		}
+		fmt.Fprintf(messages, "Clip %d copied to the clipboard.\n", n)
+		return nil
+	default:
+		return usageError("usage: ch clip list | ch clip restore [-reply] n")
+	}
+}
+
+// listClips prints the clips in history, numbered for "ch clip restore",
+// with their times, sizes, and first lines, and whether a reply was saved
+// with them.
+func listClips(history clipHistory) error {
+	clips, err := history.list()
+	if err != nil {
+		return fmt.Errorf("failed to read clip history: %v", err)
+	}
+	if len(clips) == 0 {
+		fmt.Fprintln(messages, "The clip history is empty.")
+		return nil
+	}
+	for i, c := range clips {
+		content, err := os.ReadFile(c.path)
+		if err != nil {
+			return fmt.Errorf("failed to read clip history: %v", err)
+		}
+		replied := ""
+		if _, err := os.Stat(c.replyPath()); err == nil {
+			replied = "  (with reply)"
+		}
+		fmt.Printf("%2d  %s  %s%s\n", i+1, c.time.Format("2006-01-02 15:04"), describeOutput(string(content)), replied)
+	}
+	return nil
+}
+
+// describeOutput summarizes a saved output for a listing: its approximate
+// size in tokens and the start of its first line.
+func describeOutput(markdown string) string {
+	first, _, _ := strings.Cut(strings.TrimSpace(markdown), "\n")
+	if runes := []rune(first); len(runes) > 60 {
+		first = string(runes[:57]) + "..."
+	}
+	return fmt.Sprintf("~%d tokens  %s", render.ApproxTokens(markdown), first)
+}
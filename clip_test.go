@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eloquence-cloud/ch/chlib/render"
+	"github.com/eloquence-cloud/ch/chlib/subcmd"
+)
+
+func TestClipHistory(t *testing.T) {
+	history := clipHistory{dir: t.TempDir()}
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	add := func(i int, markdown string) {
+		t.Helper()
+		if err := history.add(markdown, start.Add(time.Duration(i)*time.Second)); err != nil {
+			t.Fatalf("add: %v", err)
+		}
+	}
+
+	if _, err := history.get(1); err == nil {
+		t.Errorf("Expected an error for an empty history")
+	}
+	for i := 0; i < clipHistorySize+5; i++ {
+		add(i, fmt.Sprintf("clip %d", i))
+	}
+	// Copying the most recent clip again doesn't add it twice.
+	add(100, fmt.Sprintf("clip %d", clipHistorySize+4))
+
+	clips, err := history.list()
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(clips) != clipHistorySize {
+		t.Errorf("Expected %d clips\n  Actual %d", clipHistorySize, len(clips))
+	}
+	tests := []struct {
+		n    int
+		want string
+	}{
+		{1, fmt.Sprintf("clip %d", clipHistorySize+4)},
+		{2, fmt.Sprintf("clip %d", clipHistorySize+3)},
+		{clipHistorySize, "clip 5"},
+	}
+	for _, tt := range tests {
+		got, err := history.get(tt.n)
+		if err != nil {
+			t.Fatalf("get(%d): %v", tt.n, err)
+		}
+		if got != tt.want {
+			t.Errorf("Expected clip %d to be %q\n  Actual %q", tt.n, tt.want, got)
+		}
+	}
+	for _, n := range []int{0, clipHistorySize + 1} {
+		if _, err := history.get(n); err == nil {
+			t.Errorf("Expected an error for clip %d", n)
+		}
+	}
+}
+
+func TestClipHistoryExchange(t *testing.T) {
+	history := clipHistory{dir: t.TempDir()}
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	// Output copied with -c and then sent is recorded once, with its reply.
+	if err := history.add("prompt", start); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	if err := history.addExchange("prompt", "reply", start.Add(time.Second)); err != nil {
+		t.Fatalf("addExchange: %v", err)
+	}
+	if err := history.add("later", start.Add(2*time.Second)); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+
+	clips, err := history.list()
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(clips) != 2 {
+		t.Fatalf("Expected 2 clips\n  Actual %d", len(clips))
+	}
+	if reply, err := history.getReply(2); err != nil || reply != "reply" {
+		t.Errorf("Expected the reply to clip 2 to be \"reply\"\n  Actual %q (error %v)", reply, err)
+	}
+	if _, err := history.getReply(1); err == nil {
+		t.Errorf("Expected an error for a clip without a reply")
+	}
+
+	// Replies are removed with their clips.
+	for i := 0; i < clipHistorySize; i++ {
+		if err := history.add(fmt.Sprintf("clip %d", i), start.Add(time.Duration(10+i)*time.Second)); err != nil {
+			t.Fatalf("add: %v", err)
+		}
+	}
+	if _, err := os.Stat(clips[1].replyPath()); !os.IsNotExist(err) {
+		t.Errorf("Expected the reply to be removed with its clip, got: %v", err)
+	}
+}
+
+func TestCheckClipboardSize(t *testing.T) {
+	limit := render.Limit{Amount: 100}
+	small, large := strings.Repeat("x", 100), strings.Repeat("x", 2500)
+	yes := func(string) bool { return true }
+	no := func(string) bool { return false }
+
+	tests := []struct {
+		name     string
+		markdown string
+		ask      func(string) bool
+		err      string
+	}{
+		{"Within the limit", small, nil, ""},
+		{"Confirmed", large, yes, ""},
+		{"Declined", large, no, "The output is 2.5 kB (~625 tokens), over the clipboard limit of 100 bytes; give -force"},
+		{"No terminal", large, nil, "give -force to copy it"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkClipboardSize(tt.markdown, limit, tt.ask)
+			if tt.err == "" {
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) || subcmd.KindOf(err) != subcmd.KindOutput {
+				t.Errorf("Expected an output error containing %q\n  Actual %v", tt.err, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/eloquence-cloud/ch/chlib/subcmd"
+)
+
+// command is a top-level command, such as "ch merge", that runs in place of
+// the usual subcommand pipeline. Commands are recognized only as the first
+// argument, and parse their own flags.
+type command struct {
+	name string
+	fn   func(args []string) error
+	// flags defines the command's flags, for its documentation.
+	flags func(*flag.FlagSet)
+}
+
+var commands []command
+
+// The commands are listed in init, since their help refers back to the
+// list.
+func init() {
+	commands = []command{
+		{"merge", mergeCommand, func(flags *flag.FlagSet) { addOutputFlags(flags) }},
+		{"diff-outputs", diffOutputsCommand, func(flags *flag.FlagSet) { addDiffOutputsFlags(flags) }},
+		{"serve", serveCommand, func(flags *flag.FlagSet) { addServeFlags(flags) }},
+		{"daemon", daemonCommand, func(flags *flag.FlagSet) { addDaemonFlags(flags) }},
+		{"self-update", selfUpdateCommand, func(flags *flag.FlagSet) { addSelfUpdateFlags(flags) }},
+		{"clip", clipCommand, func(*flag.FlagSet) {}},
+		{"stash", stashCommand, func(flags *flag.FlagSet) { addStashFlags(flags) }},
+		{"session", sessionCommand, func(flags *flag.FlagSet) { addSessionFlags(flags) }},
+		{"bundle", bundleCommand, func(*flag.FlagSet) {}},
+		{"apply", applyCommand, func(flags *flag.FlagSet) { addApplyFlags(flags) }},
+		{"auth", authCommand, func(*flag.FlagSet) {}},
+		{"cache", cacheCommand, func(*flag.FlagSet) {}},
+		{"config", configCommand, func(flags *flag.FlagSet) { addConfigFlags(flags) }},
+		{"schema", schemaCommand, func(*flag.FlagSet) {}},
+		{"verify", verifyCommand, func(*flag.FlagSet) {}},
+		{"help", helpCommand, func(flags *flag.FlagSet) { addHelpFlags(flags) }},
+	}
+}
+
+// findCommand returns the top-level command with exactly the given name.
+func findCommand(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+	return command{}, false
+}
+
+// newCommandFlags returns a FlagSet for a top-level command. Unlike
+// subcommand flags, usage errors are printed, since the command owns the
+// whole command line.
+func newCommandFlags(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet("ch "+name, flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	flags.Usage = func() {
+		if topic, ok := findTopic(name); ok {
+			writeHelp(os.Stderr, topic)
+		}
+	}
+	return flags
+}
+
+// parseInterspersed parses flags that may appear before, between, or after
+// positional arguments (as in "ch merge a.md b.md -c") and returns the
+// positional arguments.
+func parseInterspersed(flags *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, &subcmd.Error{Kind: subcmd.KindUsage, Err: err}
+		}
+		args = flags.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// outputFlags are the -c and -o flags shared by the main pipeline and the
+// top-level commands that produce markdown.
+type outputFlags struct {
+	copyToClipboard *bool
+	outputFile      *string
+}
+
+func addOutputFlags(flags *flag.FlagSet) outputFlags {
+	return outputFlags{
+		copyToClipboard: flags.Bool("c", false, "Copy the generated markdown to the clipboard"),
+		outputFile:      flags.String("o", "", "Write the output to `file` (- for stdout)"),
+	}
+}
+
+func (o outputFlags) validate() error {
+	if !*o.copyToClipboard && *o.outputFile == "" {
+		return subcmd.Errorf(subcmd.KindUsage, "either -c or -o must be specified")
+	}
+	return nil
+}
+
+// write delivers markdown as the flags direct.
+func (o outputFlags) write(markdown string) error {
+	return writeOutput(context.Background(), markdown, *o.copyToClipboard, *o.outputFile)
+}
+
+// messages receives the progress messages that report where output went.
+// It is stdout unless -json-status reserves stdout for the status object.
+var messages io.Writer = os.Stdout
+
+// writeOutput copies markdown to the clipboard, prints it to stdout
+// (outputFile "-"), or writes it to outputFile, reporting where it went.
+func writeOutput(ctx context.Context, markdown string, copyToClipboard bool, outputFile string) error {
+	if copyToClipboard {
+		if err := writeClipboard(markdown); err != nil {
+			return err
+		}
+		fmt.Fprintln(messages, "Markdown copied to the clipboard.")
+		return nil
+	}
+	if outputFile == "-" {
+		if _, err := io.WriteString(os.Stdout, markdown); err != nil {
+			return &subcmd.Error{Kind: subcmd.KindOutput, Err: err}
+		}
+		return nil
+	}
+	remote, err := writeFile(ctx, outputFile, []byte(markdown))
+	if err != nil {
+		if subcmd.KindOf(err) == subcmd.KindRemote {
+			return err
+		}
+		return subcmd.Errorf(subcmd.KindOutput, "failed to write output to file: %v", err)
+	}
+	if remote {
+		fmt.Fprintf(messages, "Markdown uploaded to: %s\n", outputFile)
+		return nil
+	}
+	fmt.Fprintf(messages, "Markdown written to file: %s\n", outputFile)
+	return nil
+}
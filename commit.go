@@ -0,0 +1,194 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+)
+
+// defaultCommitTemplate is the message ch apply -commit gives its commits.
+const defaultCommitTemplate = `Apply a model's changes to {{join .Files ", "}}
+{{if .Prompt}}
+Prompt: {{.Prompt}} (sha256 {{.PromptSHA}}, copied {{.PromptTime.Format "2006-01-02 15:04"}})
+{{- end}}
+Reply: {{.Reply}} (sha256 {{.ReplySHA}})
+`
+
+// commitFlag is the value of -commit: off, on with defaultCommitTemplate
+// (-commit), or on with a template of its own (-commit=template).
+type commitFlag struct {
+	template string
+}
+
+func (c *commitFlag) String() string {
+	if c == nil {
+		return ""
+	}
+	return c.template
+}
+
+func (c *commitFlag) Set(value string) error {
+	switch value {
+	case "true":
+		value = defaultCommitTemplate
+	case "false":
+		value = ""
+	}
+	if value != "" {
+		if _, err := parseCommitTemplate(value); err != nil {
+			return err
+		}
+	}
+	c.template = value
+	return nil
+}
+
+func (c *commitFlag) IsBoolFlag() bool {
+	return true
+}
+
+func parseCommitTemplate(text string) (*template.Template, error) {
+	return template.New("commit").Funcs(template.FuncMap{"join": strings.Join}).Parse(text)
+}
+
+// commitInfo is what a -commit template can refer to.
+type commitInfo struct {
+	// Files are the paths of the files written, relative to the top of
+	// the repository.
+	Files []string
+	// Prompt is the first line of the prompt the reply answers: the latest
+	// output in the clip history that has the ID of a file written, or
+	// else the latest output, or "" if there is none. PromptSHA is the
+	// start of its SHA-256, and PromptTime when it was copied.
+	Prompt     string
+	PromptSHA  string
+	PromptTime time.Time
+	// Reply is the first line of the reply, and ReplySHA the start of its
+	// SHA-256.
+	Reply    string
+	ReplySHA string
+}
+
+// commitMessage fills in the -commit template for the reply, whose files
+// written are at paths relative to the repository.
+func commitMessage(text string, paths []string, reply string, ids []string) (string, error) {
+	tmpl, err := parseCommitTemplate(text)
+	if err != nil {
+		return "", err
+	}
+	info := commitInfo{Files: paths, Reply: summaryLine(reply), ReplySHA: shortHash(reply)}
+	if history, err := defaultClipHistory(); err == nil {
+		if prompt, copied, ok := findPrompt(history, ids); ok {
+			info.Prompt, info.PromptSHA, info.PromptTime = summaryLine(prompt), shortHash(prompt), copied
+		}
+	}
+	var message strings.Builder
+	if err := tmpl.Execute(&message, info); err != nil {
+		return "", fmt.Errorf("invalid -commit template: %v", err)
+	}
+	return message.String(), nil
+}
+
+// findPrompt returns the latest output in history that holds any of ids as
+// a file ID, or else the latest output, with the time it was copied.
+func findPrompt(history clipHistory, ids []string) (string, time.Time, bool) {
+	clips, err := history.list()
+	if err != nil || len(clips) == 0 {
+		return "", time.Time{}, false
+	}
+	for _, clip := range clips {
+		content, err := os.ReadFile(clip.path)
+		if err != nil {
+			continue
+		}
+		for _, id := range ids {
+			if strings.Contains(string(content), " id="+id) {
+				return string(content), clip.time, true
+			}
+		}
+	}
+	content, err := os.ReadFile(clips[0].path)
+	if err != nil {
+		return "", time.Time{}, false
+	}
+	return string(content), clips[0].time, true
+}
+
+// summaryLine returns the first line of text that reads as prose, rather
+// than a fence, a file's name, or front matter, shortened to fit a commit
+// message.
+func summaryLine(text string) string {
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(strings.TrimLeft(line, "#>*- "))
+		if line == "" || strings.HasPrefix(line, "```") || strings.HasPrefix(line, "`") || strings.HasPrefix(line, "---") {
+			continue
+		}
+		return shorten(line, 72)
+	}
+	return "(no text)"
+}
+
+// shortHash returns the start of the SHA-256 of text.
+func shortHash(text string) string {
+	sum, _ := entry.HashContent(strings.NewReader(text))
+	return sum[:12]
+}
+
+// gitCommit commits the files at paths, in the git repository at dir, with
+// message, returning the commit's short hash. Other changes already staged
+// are left out of the commit.
+func gitCommit(dir string, paths []string, message string) (string, error) {
+	if _, err := runGit(dir, append([]string{"add", "--"}, paths...)...); err != nil {
+		return "", err
+	}
+	if _, err := runGit(dir, append([]string{"commit", "--quiet", "-m", message, "--"}, paths...)...); err != nil {
+		return "", err
+	}
+	return runGit(dir, "rev-parse", "--short", "HEAD")
+}
+
+// repoPaths returns paths relative to the top of the git repository at dir.
+func repoPaths(dir string, paths []string) ([]string, error) {
+	root, err := runGit(dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, fmt.Errorf("-commit needs a git repository: %v", err)
+	}
+	root = resolvePath(root)
+	var rel []string
+	for _, path := range paths {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return nil, err
+		}
+		r, err := filepath.Rel(root, filepath.Join(resolvePath(filepath.Dir(abs)), filepath.Base(abs)))
+		if err != nil {
+			return nil, err
+		}
+		rel = append(rel, filepath.ToSlash(r))
+	}
+	return rel, nil
+}
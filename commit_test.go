@@ -0,0 +1,99 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+)
+
+func TestApplyCommit(t *testing.T) {
+	parent, git := testRepo(t)
+	repo := filepath.Join(parent, "repo")
+	oldMessages := messages
+	defer func() { messages = oldMessages }()
+	var reported strings.Builder
+	messages = &reported
+
+	// The prompt attached a.txt with its ID; a later copy did not.
+	a, err := defaultAttachedFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := entry.File{StoragePath: filepath.Join(repo, "a.txt"), OriginalPath: filepath.Join(repo, "a.txt")}
+	if err := a.record([]entry.Entry{file}, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	history, err := defaultClipHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	history.add("Make a.txt say new.\n\n`a.txt`\n```text id="+file.ID()+" sha256=0\nold\n```\n", time.Now().Add(-time.Minute))
+	history.add("Something else entirely.\n", time.Now())
+
+	replyPath := filepath.Join(parent, "reply.md")
+	if err := os.WriteFile(replyPath, []byte("Here you go.\n\n`a.txt`\n```text id="+file.ID()+"\nnew\n```\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// Changes already staged are left out of the commit.
+	if err := os.WriteFile(filepath.Join(repo, "b.txt"), []byte("b\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	git(repo, "add", "b.txt")
+
+	if err := applyCommand([]string{"-f", replyPath, "-commit"}); err != nil {
+		t.Fatalf("apply -commit: %v\n%s", err, reported.String())
+	}
+	message := git(repo, "log", "-1", "--format=%B")
+	for _, want := range []string{"Apply a model's changes to a.txt", "Prompt: Make a.txt say new.", "Reply: Here you go."} {
+		if !strings.Contains(message, want) {
+			t.Errorf("Expected the message to contain %q\n  Actual:\n%s", want, message)
+		}
+	}
+	if files := git(repo, "show", "--format=", "--name-only", "HEAD"); files != "a.txt" {
+		t.Errorf("Expected only a.txt in the commit\n  Actual %q", files)
+	}
+
+	if err := os.WriteFile(replyPath, []byte("`a.txt`\n```\nnewer\n```\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// a.txt has changed since it was attached, by the first apply.
+	if err := applyCommand([]string{"-force", "-f", replyPath, "-test", "false", "-commit"}); err == nil || !strings.Contains(reported.String(), "Not committing") {
+		t.Errorf("Expected a failing -test to fail the apply, uncommitted\n  Actual %v", err)
+	}
+	if got := git(repo, "log", "-1", "--format=%s"); got != "Apply a model's changes to a.txt" {
+		t.Errorf("Expected no commit after failing tests\n  Actual %q", got)
+	}
+	if err := applyCommand([]string{"-force", "-f", replyPath, "-commit=Take {{join .Files \" \"}} ({{.ReplySHA}})"}); err != nil {
+		t.Fatalf("apply -commit=template: %v", err)
+	}
+	if got := git(repo, "log", "-1", "--format=%s"); !strings.HasPrefix(got, "Take a.txt (") {
+		t.Errorf("Expected the template's message\n  Actual %q", got)
+	}
+}
+
+func TestCommitFlag(t *testing.T) {
+	testCases := []struct {
+		args     []string
+		expected string
+		err      bool
+	}{
+		{nil, "", false},
+		{[]string{"-commit"}, defaultCommitTemplate, false},
+		{[]string{"-commit=Fix {{.Reply}}"}, "Fix {{.Reply}}", false},
+		{[]string{"-commit=Fix {{.Reply"}, "", true},
+	}
+	for _, tc := range testCases {
+		flags := flag.NewFlagSet("apply", flag.ContinueOnError)
+		flags.SetOutput(&strings.Builder{})
+		f := addApplyFlags(flags)
+		err := flags.Parse(tc.args)
+		if (err != nil) != tc.err || (!tc.err && f.commit.template != tc.expected) {
+			t.Errorf("%v: expected %q (error: %v)\n  Actual %q, %v", tc.args, tc.expected, tc.err, f.commit.template, err)
+		}
+	}
+}
@@ -0,0 +1,346 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package main
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/BurntSushi/toml"
+	"github.com/eloquence-cloud/ch/chlib/render"
+	"github.com/eloquence-cloud/ch/chlib/subcmd"
+	"github.com/eloquence-cloud/ch/chlib/transport"
+)
+
+// config holds the user's settings, loaded from a TOML file. Every field is
+// optional; the zero value means "use the built-in behavior".
+//
+// Example config file:
+//
+//	scripts = ["hooks.star"]
+//	prune_dirs = ["dist", "*.egg-info"]
+//
+//	[languages]
+//	".tfvars" = "hcl"
+//	"Dockerfile" = "dockerfile"
+//
+//	[projects.node]
+//	prune_dirs = ["node_modules", "coverage"]
+//
+//	[path_aliases]
+//	"/home/me/src/" = ""
+//	"prod:/etc/app/" = "app config (prod)/"
+//
+//	[ask]
+//	security = "Audit the code below for security problems. {{.Details}}"
+//
+//	[bundles.api-debug]
+//	description = "What a bug in the API needs"
+//	subcommands = """
+//	attach api/server.go api/routes.go
+//	tail -n 200 logs/api.log
+//	exec git diff
+//	"""
+//	budget = "30k-tokens"
+//
+//	[models.claude]
+//	provider = "anthropic"
+//	model = "claude-3-5-sonnet-latest"
+//	auth = "anthropic"
+//	fallback = ["local"]
+//
+//	[models.local]
+//	provider = "openai"
+//	endpoint = "http://localhost:11434/v1/chat/completions"
+//	model = "llama3.1"
+//
+//	[network]
+//	requests_per_second = 2
+//	max_megabytes = 20
+//	proxy = "socks5://localhost:1080"
+//	ca_cert = "corp-ca.pem"
+type config struct {
+	// Languages maps file extensions (keys starting with ".") and exact file
+	// names to fence languages. Entries override and extend the built-in
+	// detection in entry.LanguageFor.
+	Languages map[string]string `toml:"languages"`
+
+	// Scripts lists Starlark scripts to load (see chlib/script). Relative
+	// paths are resolved against the config file's directory.
+	Scripts []string `toml:"scripts"`
+
+	// PruneDirs lists directory names (path.Match patterns) that attach
+	// skips when walking a directory, in addition to
+	// subcmd.DefaultPruneDirs.
+	PruneDirs []string `toml:"prune_dirs"`
+
+	// DetectProjects, if false, turns off project type detection, which
+	// otherwise adds the prune_dirs and languages of the types of the
+	// project in the working directory to those configured.
+	DetectProjects *bool `toml:"detect_projects"`
+
+	// Projects overrides the built-in project types (builtinProjectTypes)
+	// by name, or defines more.
+	Projects map[string]projectType `toml:"projects"`
+
+	// PathAliases maps path prefixes to what attached files whose paths
+	// start with them are shown with instead. Where several prefixes
+	// match, the longest is used.
+	PathAliases map[string]string `toml:"path_aliases"`
+
+	// Ask maps the ask subcommand's tasks to prompt templates, which
+	// override and add to subcmd.AskTemplates.
+	Ask map[string]string `toml:"ask"`
+
+	// Bundles are named scripts of subcommands, run by "ch bundle" and the
+	// bundle subcommand. The project's .ch.toml can define more.
+	Bundles map[string]bundleConfig `toml:"bundles"`
+
+	// ClipboardLimit is the size of output (as with -budget) above which
+	// -c asks before copying, or fails without -force when it can't ask.
+	// The default is defaultClipboardLimit.
+	ClipboardLimit string `toml:"clipboard_limit"`
+	// CacheLimit is the size, in bytes (as "200m-bytes"), that the render
+	// cache is kept within. The default is defaultCacheLimit.
+	CacheLimit string `toml:"cache_limit"`
+
+	// Models are the language models that -send can send the output to,
+	// by name.
+	Models map[string]modelConfig `toml:"models"`
+
+	// Network limits the HTTP requests that subcommands such as slack make
+	// in one run.
+	Network networkConfig `toml:"network"`
+}
+
+// networkConfig is the [network] table of the config file. Zero fields
+// take the subcmd.NetworkLimits defaults.
+type networkConfig struct {
+	// RequestsPerSecond is how often each host may be sent a request.
+	RequestsPerSecond float64 `toml:"requests_per_second"`
+	// MaxRequests is how many requests a run may send in all.
+	MaxRequests int `toml:"max_requests"`
+	// MaxMegabytes is how many megabytes (MiB) of responses a run may
+	// download in all.
+	MaxMegabytes int64 `toml:"max_megabytes"`
+	// Proxy is the proxy to send requests through, as with -proxy.
+	Proxy string `toml:"proxy"`
+	// CACert, ClientCert, and ClientKey are PEM files, as with -ca-cert,
+	// -client-cert, and -client-key. Relative paths are resolved against
+	// the config file's directory.
+	CACert     string `toml:"ca_cert"`
+	ClientCert string `toml:"client_cert"`
+	ClientKey  string `toml:"client_key"`
+}
+
+// transport returns the HTTP transport for the configured proxy and TLS
+// files, overridden by those set in opts, as with -proxy and -ca-cert.
+func (cfg config) transport(opts transport.Options) (http.RoundTripper, error) {
+	opts.Proxy = cmp.Or(opts.Proxy, cfg.Network.Proxy)
+	opts.CACert = cmp.Or(opts.CACert, cfg.Network.CACert)
+	if opts.ClientCert == "" {
+		opts.ClientCert, opts.ClientKey = cfg.Network.ClientCert, cmp.Or(opts.ClientKey, cfg.Network.ClientKey)
+	}
+	return transport.New(opts)
+}
+
+// networkLimits returns the configured network limits.
+func (cfg config) networkLimits() subcmd.NetworkLimits {
+	return subcmd.NetworkLimits{
+		RequestsPerSecond: cfg.Network.RequestsPerSecond,
+		MaxRequests:       cfg.Network.MaxRequests,
+		MaxBytes:          cfg.Network.MaxMegabytes << 20,
+	}
+}
+
+// cacheLimit returns the size in bytes that the render cache is kept
+// within: cache_limit, or defaultCacheLimit.
+func (cfg config) cacheLimit() int64 {
+	if limit, err := render.ParseLimit(cfg.CacheLimit); err == nil && !limit.Tokens {
+		return int64(limit.Amount)
+	}
+	return defaultCacheLimit
+}
+
+// clipboardLimit returns the configured clipboard limit, or the default.
+func (cfg config) clipboardLimit() render.Limit {
+	if limit, err := render.ParseLimit(cfg.ClipboardLimit); err == nil {
+		return limit
+	}
+	return defaultClipboardLimit
+}
+
+// pathAliases returns the configured path aliases, longest prefix first.
+func (cfg config) pathAliases() []subcmd.PathAlias {
+	var aliases []subcmd.PathAlias
+	for prefix, replacement := range cfg.PathAliases {
+		aliases = append(aliases, subcmd.PathAlias{Prefix: prefix, Replacement: replacement})
+	}
+	slices.SortFunc(aliases, func(a, b subcmd.PathAlias) int {
+		if n := cmp.Compare(len(b.Prefix), len(a.Prefix)); n != 0 {
+			return n
+		}
+		return strings.Compare(a.Prefix, b.Prefix)
+	})
+	return aliases
+}
+
+// defaultConfigPath returns the location of the user's config file,
+// $XDG_CONFIG_HOME/ch/config.toml or the platform equivalent.
+func defaultConfigPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "ch", "config.toml"), nil
+}
+
+// loadUserConfig loads the config file given with -config, which must
+// exist, or else the default config file, if there is one. The bundles of
+// the project's .ch.toml, if there is one, are added to it, as are the
+// defaults of the project's detected types.
+func loadUserConfig(configPath string) (config, error) {
+	required := configPath != ""
+	if !required {
+		defaultPath, err := defaultConfigPath()
+		if err != nil {
+			return config{}, fmt.Errorf("failed to locate config file: %v", err)
+		}
+		configPath = defaultPath
+	}
+	cfg, err := loadConfig(configPath, required)
+	if err != nil {
+		return config{}, err
+	}
+	if err := addProjectBundles(&cfg); err != nil {
+		return config{}, err
+	}
+	addProjectDefaults(&cfg)
+	return cfg, nil
+}
+
+// validLanguage reports whether key = lang is a valid language mapping: a
+// non-empty extension or file name, and a language that can follow a
+// code fence.
+func validLanguage(key, lang string) bool {
+	return key != "" && lang != "" && !strings.ContainsAny(lang, " \t`")
+}
+
+// validPruneDir reports whether pattern is a valid prune_dirs pattern: a
+// directory name or path.Match glob, without slashes.
+func validPruneDir(pattern string) bool {
+	_, err := path.Match(pattern, "")
+	return err == nil && pattern != "" && !strings.Contains(pattern, "/")
+}
+
+// loadConfig reads the config file at configPath. A missing file is not an
+// error when required is false; it yields the zero config. Unknown keys are
+// reported as errors so that typos don't go unnoticed.
+func loadConfig(configPath string, required bool) (config, error) {
+	var cfg config
+	metadata, err := toml.DecodeFile(configPath, &cfg)
+	if err != nil {
+		if !required && errors.Is(err, os.ErrNotExist) {
+			return config{}, nil
+		}
+		return config{}, fmt.Errorf("failed to load config %s: %v", configPath, err)
+	}
+	if undecoded := metadata.Undecoded(); len(undecoded) > 0 {
+		var keys []string
+		for _, key := range undecoded {
+			keys = append(keys, key.String())
+		}
+		return config{}, fmt.Errorf("unknown keys in config %s: %s", configPath, strings.Join(keys, ", "))
+	}
+	for key, lang := range cfg.Languages {
+		if !validLanguage(key, lang) {
+			return config{}, fmt.Errorf("invalid language mapping in config %s: %q = %q", configPath, key, lang)
+		}
+	}
+	for _, pattern := range cfg.PruneDirs {
+		if !validPruneDir(pattern) {
+			return config{}, fmt.Errorf("invalid prune_dirs pattern in config %s: %q (expected a directory name or glob)", configPath, pattern)
+		}
+	}
+	if err := validateProjects(cfg.Projects); err != nil {
+		return config{}, fmt.Errorf("%v in config %s", err, configPath)
+	}
+	for prefix := range cfg.PathAliases {
+		if prefix == "" {
+			return config{}, fmt.Errorf("empty path_aliases prefix in config %s", configPath)
+		}
+	}
+	for task, text := range cfg.Ask {
+		if task == "" || strings.ContainsAny(task, " \t,") {
+			return config{}, fmt.Errorf("invalid [ask] task name in config %s: %q", configPath, task)
+		}
+		if _, err := template.New(task).Parse(text); err != nil {
+			return config{}, fmt.Errorf("invalid [ask] template in config %s: %v", configPath, err)
+		}
+	}
+	if err := validateBundles(cfg.Bundles); err != nil {
+		return config{}, fmt.Errorf("%v in config %s", err, configPath)
+	}
+	if cfg.CacheLimit != "" {
+		if limit, err := render.ParseLimit(cfg.CacheLimit); err != nil {
+			return config{}, fmt.Errorf("invalid cache_limit in config %s: %v", configPath, err)
+		} else if limit.Tokens {
+			return config{}, fmt.Errorf("invalid cache_limit in config %s: %q is not in bytes", configPath, cfg.CacheLimit)
+		}
+	}
+	if cfg.ClipboardLimit != "" {
+		if _, err := render.ParseLimit(cfg.ClipboardLimit); err != nil {
+			return config{}, fmt.Errorf("invalid clipboard_limit in config %s: %v", configPath, err)
+		}
+	}
+	if err := validateModels(cfg.Models); err != nil {
+		return config{}, fmt.Errorf("%v in config %s", err, configPath)
+	}
+	if n := cfg.Network; n.RequestsPerSecond < 0 || n.MaxRequests < 0 || n.MaxMegabytes < 0 {
+		return config{}, fmt.Errorf("invalid [network] limits in config %s: limits can't be negative", configPath)
+	}
+	if cfg.Network.Proxy != "" {
+		if _, err := transport.ParseProxy(cfg.Network.Proxy); err != nil {
+			return config{}, fmt.Errorf("%v in config %s", err, configPath)
+		}
+	}
+	for _, file := range []*string{&cfg.Network.CACert, &cfg.Network.ClientCert, &cfg.Network.ClientKey} {
+		if *file != "" && !filepath.IsAbs(*file) {
+			*file = filepath.Join(filepath.Dir(configPath), *file)
+		}
+	}
+	for i, script := range cfg.Scripts {
+		if script == "" {
+			return config{}, fmt.Errorf("empty script path in config %s", configPath)
+		}
+		if !filepath.IsAbs(script) {
+			cfg.Scripts[i] = filepath.Join(filepath.Dir(configPath), script)
+		}
+	}
+	return cfg, nil
+}
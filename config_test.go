@@ -0,0 +1,221 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/eloquence-cloud/ch/chlib/subcmd"
+)
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+
+	testCases := []struct {
+		name        string
+		content     string
+		expected    config
+		expectedErr string
+	}{
+		{
+			name: "Languages",
+			content: `[languages]
+".tfvars" = "hcl"
+"Dockerfile" = "dockerfile"
+`,
+			expected: config{Languages: map[string]string{".tfvars": "hcl", "Dockerfile": "dockerfile"}},
+		},
+		{
+			name:     "Scripts",
+			content:  "scripts = [\"hooks.star\", \"/opt/ch/team.star\"]\n",
+			expected: config{Scripts: []string{filepath.Join(dir, "hooks.star"), "/opt/ch/team.star"}},
+		},
+		{
+			name:     "Prune dirs",
+			content:  "prune_dirs = [\"dist\", \"*.egg-info\"]\n",
+			expected: config{PruneDirs: []string{"dist", "*.egg-info"}},
+		},
+		{
+			name: "Projects",
+			content: `detect_projects = false
+
+[projects.node]
+prune_dirs = []
+
+[projects.elixir]
+markers = ["mix.exs"]
+languages = { ".ex" = "elixir" }
+`,
+			expected: config{DetectProjects: new(bool), Projects: map[string]projectType{
+				"node":   {PruneDirs: []string{}},
+				"elixir": {Markers: []string{"mix.exs"}, Languages: map[string]string{".ex": "elixir"}},
+			}},
+		},
+		{
+			name:     "Path aliases",
+			content:  "[path_aliases]\n\"/home/me/\" = \"~/\"\n",
+			expected: config{PathAliases: map[string]string{"/home/me/": "~/"}},
+		},
+		{
+			name:        "Empty path alias",
+			content:     "[path_aliases]\n\"\" = \"x\"\n",
+			expectedErr: "empty path_aliases prefix",
+		},
+		{
+			name:     "Ask templates",
+			content:  "[ask]\nsecurity = \"Audit this. {{.Details}}\"\n",
+			expected: config{Ask: map[string]string{"security": "Audit this. {{.Details}}"}},
+		},
+		{
+			name:        "Invalid ask template",
+			content:     "[ask]\nreview = \"{{if .Details}}\"\n",
+			expectedErr: "invalid [ask] template",
+		},
+		{
+			name:     "Network",
+			content:  "[network]\nrequests_per_second = 0.5\nmax_megabytes = 20\n",
+			expected: config{Network: networkConfig{RequestsPerSecond: 0.5, MaxMegabytes: 20}},
+		},
+		{
+			name:     "Network TLS files",
+			content:  "[network]\nca_cert = \"corp-ca.pem\"\nclient_cert = \"/etc/ch/client.pem\"\n",
+			expected: config{Network: networkConfig{CACert: filepath.Join(dir, "corp-ca.pem"), ClientCert: "/etc/ch/client.pem"}},
+		},
+		{
+			name:        "Negative network limit",
+			content:     "[network]\nmax_requests = -1\n",
+			expectedErr: "invalid [network] limits",
+		},
+		{
+			name: "Models",
+			content: `[models.claude]
+provider = "anthropic"
+model = "claude-3-5-sonnet-latest"
+auth = "anthropic"
+fallback = ["local"]
+
+[models.local]
+provider = "openai"
+endpoint = "http://localhost:11434/v1/chat/completions"
+model = "llama3.1"
+`,
+			expected: config{Models: map[string]modelConfig{
+				"claude": {Provider: "anthropic", Model: "claude-3-5-sonnet-latest", Auth: "anthropic", Fallback: []string{"local"}},
+				"local":  {Provider: "openai", Endpoint: "http://localhost:11434/v1/chat/completions", Model: "llama3.1"},
+			}},
+		},
+		{
+			name:     "Cache limit",
+			content:  "cache_limit = \"200m-bytes\"\n",
+			expected: config{CacheLimit: "200m-bytes"},
+		},
+		{
+			name:        "Cache limit in tokens",
+			content:     "cache_limit = \"200k\"\n",
+			expectedErr: "is not in bytes",
+		},
+		{
+			name:     "Clipboard limit",
+			content:  "clipboard_limit = \"500k-tokens\"\n",
+			expected: config{ClipboardLimit: "500k-tokens"},
+		},
+		{
+			name:        "Invalid clipboard limit",
+			content:     "clipboard_limit = \"2MB\"\n",
+			expectedErr: "invalid clipboard_limit",
+		},
+		{
+			name:        "Unknown model provider",
+			content:     "[models.gemini]\nprovider = \"google\"\nmodel = \"gemini-pro\"\n",
+			expectedErr: "invalid provider \"google\" for model gemini",
+		},
+		{
+			name:        "Unknown model fallback",
+			content:     "[models.gpt]\nprovider = \"openai\"\nmodel = \"gpt-4o\"\nfallback = [\"claude\"]\n",
+			expectedErr: "unknown fallback \"claude\" for model gpt",
+		},
+		{
+			name:     "Empty",
+			content:  "",
+			expected: config{},
+		},
+		{
+			name:        "Unknown key",
+			content:     "[langauges]\n\".tf\" = \"hcl\"\n",
+			expectedErr: "unknown keys",
+		},
+		{
+			name:        "Invalid language",
+			content:     "[languages]\n\".tf\" = \"terraform hcl\"\n",
+			expectedErr: "invalid language mapping",
+		},
+		{
+			name:        "Invalid prune dir",
+			content:     "prune_dirs = [\"build/out\"]\n",
+			expectedErr: "invalid prune_dirs pattern",
+		},
+		{
+			name:        "Project type without markers",
+			content:     "[projects.elixir]\nprune_dirs = [\"_build\"]\n",
+			expectedErr: "project type elixir has no markers",
+		},
+		{
+			name:        "Invalid project prune dir",
+			content:     "[projects.node]\nprune_dirs = [\"web/dist\"]\n",
+			expectedErr: "invalid prune_dirs pattern for project type node",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			configPath := filepath.Join(dir, strings.ReplaceAll(tc.name, " ", "-")+".toml")
+			if err := os.WriteFile(configPath, []byte(tc.content), 0644); err != nil {
+				t.Fatalf("Failed to write config: %v", err)
+			}
+			cfg, err := loadConfig(configPath, true)
+			if tc.expectedErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.expectedErr) {
+					t.Errorf("Expected error containing %q, got: %v", tc.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(cfg, tc.expected) {
+				t.Errorf("Expected config: %+v, got: %+v", tc.expected, cfg)
+			}
+		})
+	}
+}
+
+func TestLoadConfigMissing(t *testing.T) {
+	missingPath := filepath.Join(t.TempDir(), "missing.toml")
+
+	cfg, err := loadConfig(missingPath, false)
+	if err != nil {
+		t.Errorf("Expected a missing optional config to be ignored, got: %v", err)
+	}
+	if !reflect.DeepEqual(cfg, config{}) {
+		t.Errorf("Expected zero config, got: %+v", cfg)
+	}
+
+	if _, err := loadConfig(missingPath, true); err == nil {
+		t.Error("Expected an error for a missing required config")
+	}
+}
+
+func TestPathAliasesOrder(t *testing.T) {
+	cfg := config{PathAliases: map[string]string{"/home/": "", "/home/me/src/": "src/", "/home/me/": "~/", "/opt/": "opt/"}}
+	expected := []subcmd.PathAlias{
+		{Prefix: "/home/me/src/", Replacement: "src/"},
+		{Prefix: "/home/me/", Replacement: "~/"},
+		{Prefix: "/home/", Replacement: ""},
+		{Prefix: "/opt/", Replacement: "opt/"},
+	}
+	if actual := cfg.pathAliases(); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected aliases: %+v, got: %+v", expected, actual)
+	}
+}
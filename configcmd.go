@@ -0,0 +1,535 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// configFlags are the flags of "ch config".
+type configFlags struct {
+	configPath *string
+	all        *bool
+}
+
+func addConfigFlags(flags *flag.FlagSet) configFlags {
+	return configFlags{
+		configPath: flags.String("config", "", "Read and change this config `file` instead of the default"),
+		all:        flags.Bool("all", false, "With list, also list the settings that aren't set, with what each does"),
+	}
+}
+
+// configCommand implements "ch config get|set|list|edit": it reads and
+// changes the config file from the command line, checking each change as
+// ch would load the file, so that settings can be scripted without
+// hand-editing TOML.
+func configCommand(args []string) error {
+	flags := newCommandFlags("config")
+	f := addConfigFlags(flags)
+	rest, err := parseInterspersed(flags, args)
+	if err != nil {
+		return err
+	}
+	path := *f.configPath
+	if path == "" {
+		if path, err = defaultConfigPath(); err != nil {
+			return fmt.Errorf("failed to locate config file: %v", err)
+		}
+	}
+	switch {
+	case len(rest) == 2 && rest[0] == "get":
+		return configGet(os.Stdout, path, rest[1])
+	case len(rest) == 3 && rest[0] == "set":
+		if err := configSet(path, rest[1], rest[2]); err != nil {
+			return err
+		}
+		fmt.Fprintf(messages, "Set %s in %s.\n", rest[1], path)
+		return nil
+	case len(rest) == 1 && rest[0] == "list":
+		return configList(os.Stdout, path, *f.all)
+	case len(rest) == 1 && rest[0] == "edit":
+		return configEdit(path)
+	default:
+		return usageError("usage: ch config get key | set key value | list [-all] | edit")
+	}
+}
+
+// configKeys returns the top-level keys of the config file, in the order
+// of config's fields.
+func configKeys() []string {
+	var keys []string
+	t := reflect.TypeOf(config{})
+	for i := 0; i < t.NumField(); i++ {
+		if key := t.Field(i).Tag.Get("toml"); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// settingDocs returns what each top-level setting does, from the config
+// file's help section.
+func settingDocs() map[string]string {
+	docs := make(map[string]string)
+	for _, section := range helpSections {
+		if section.manTitle != "CONFIG FILE" {
+			continue
+		}
+		for _, item := range section.items {
+			// Terms are such as "cache_limit", "scripts = [...]", and
+			// "[models.name]".
+			key, _, _ := strings.Cut(strings.Fields(strings.Trim(item.term, "[]"))[0], ".")
+			docs[key] = item.text
+		}
+	}
+	return docs
+}
+
+// readSettings decodes the config file at path, which need not exist.
+func readSettings(path string) (map[string]any, error) {
+	settings := make(map[string]any)
+	if _, err := toml.DecodeFile(path, &settings); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to load config %s: %v", path, err)
+	}
+	return settings, nil
+}
+
+// checkKey parses a dotted key, such as models.claude.max_tokens or
+// languages.".tfvars", and checks that it starts with a known setting.
+func checkKey(key string) ([]string, error) {
+	keys, rest, err := parseKey(key)
+	if err == nil && rest != "" {
+		err = fmt.Errorf("unexpected %q", rest)
+	}
+	if err != nil {
+		return nil, usageError("invalid key %q: %v", key, err)
+	}
+	if known := configKeys(); !slices.Contains(known, keys[0]) {
+		return nil, usageError("unknown setting %q (expected one of %s)", keys[0], strings.Join(known, ", "))
+	}
+	return keys, nil
+}
+
+func configGet(w io.Writer, path, key string) error {
+	keys, err := checkKey(key)
+	if err != nil {
+		return err
+	}
+	settings, err := readSettings(path)
+	if err != nil {
+		return err
+	}
+	var value any = settings
+	for _, k := range keys {
+		table, ok := value.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s is not set in %s", key, path)
+		}
+		if value, ok = table[k]; !ok {
+			return fmt.Errorf("%s is not set in %s", key, path)
+		}
+	}
+	switch v := value.(type) {
+	case string:
+		_, err = fmt.Fprintln(w, v)
+	case map[string]any:
+		enc := toml.NewEncoder(w)
+		enc.Indent = ""
+		err = enc.Encode(v)
+	default:
+		var literal string
+		if literal, err = tomlValue(v); err == nil {
+			_, err = fmt.Fprintln(w, literal)
+		}
+	}
+	return err
+}
+
+// configList prints each setting in the config file at path as key =
+// value, and with all, the top-level settings that aren't set, as
+// comments saying what they do.
+func configList(w io.Writer, path string, all bool) error {
+	settings, err := readSettings(path)
+	if err != nil {
+		return err
+	}
+	var lines []string
+	if err := flattenSettings(nil, settings, &lines); err != nil {
+		return err
+	}
+	if all {
+		docs := settingDocs()
+		for _, key := range configKeys() {
+			if _, ok := settings[key]; !ok {
+				lines = append(lines, fmt.Sprintf("# %s (not set): %s", key, docs[key]))
+			}
+		}
+	}
+	for _, line := range lines {
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flattenSettings appends a key = value line for each value in settings,
+// whose keys follow prefix, in order of key.
+func flattenSettings(prefix []string, settings map[string]any, lines *[]string) error {
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		path := append(slices.Clip(prefix), key)
+		if table, ok := settings[key].(map[string]any); ok {
+			if err := flattenSettings(path, table, lines); err != nil {
+				return err
+			}
+			continue
+		}
+		literal, err := tomlValue(settings[key])
+		if err != nil {
+			return err
+		}
+		*lines = append(*lines, formatKey(path)+" = "+literal)
+	}
+	return nil
+}
+
+// configSet sets key to value in the config file at path, changing only
+// the key's line, or adding one, so that comments and layout are kept. A
+// value that is valid TOML, such as false, 3, or ["dist"], is written as
+// it is; anything else is written as a string. An inline table, such as
+// {provider = "openai", model = "llama3.1"}, sets each of its keys, so
+// that a table whose keys are required together can be added at once.
+func configSet(path, key, value string) error {
+	keys, err := checkKey(key)
+	if err != nil {
+		return err
+	}
+	literal := strings.TrimSpace(value)
+	var decoded struct{ V any }
+	if strings.ContainsAny(value, "\r\n") || literal == "" || toml.Unmarshal([]byte("v = "+literal), &decoded) != nil {
+		decoded.V = value
+		literal = ""
+	}
+	content, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to read config %s: %v", path, err)
+	}
+	updated, err := setValue(string(content), keys, decoded.V, literal)
+	if err != nil {
+		return fmt.Errorf("cannot set %s in %s: %v", key, path, err)
+	}
+	return writeConfig(path, updated)
+}
+
+// setValue returns content with keys set to value, each key of a table
+// value in turn, written as literal if it is given.
+func setValue(content string, keys []string, value any, literal string) (string, error) {
+	table, ok := value.(map[string]any)
+	if !ok {
+		if literal == "" {
+			var err error
+			if literal, err = tomlValue(value); err != nil {
+				return "", err
+			}
+		}
+		return setKey(content, keys, literal)
+	}
+	names := make([]string, 0, len(table))
+	for name := range table {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		var err error
+		if content, err = setValue(content, append(slices.Clip(keys), name), table[name], ""); err != nil {
+			return "", err
+		}
+	}
+	return content, nil
+}
+
+// setKey returns content, a TOML document, with keys set to the TOML value
+// literal. The key's line is replaced if it has one; otherwise a line is
+// added to the end of its table, which is added if need be.
+func setKey(content string, keys []string, literal string) (string, error) {
+	table, name := keys[:len(keys)-1], keys[len(keys)-1]
+	line := formatKey([]string{name}) + " = " + literal + "\n"
+	lines := strings.SplitAfter(content, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	// The table's lines are lines[start:end]; the top-level keys come
+	// before the first header.
+	start, end := -1, len(lines)
+	if len(table) == 0 {
+		start = 0
+	}
+	for i, l := range lines {
+		header, ok := parseHeader(l)
+		if !ok {
+			continue
+		}
+		if start >= 0 {
+			end = i
+			break
+		}
+		if slices.Equal(header, table) {
+			start = i + 1
+		}
+	}
+	if start < 0 {
+		if content != "" && !strings.HasSuffix(content, "\n") {
+			content += "\n"
+		}
+		if content != "" {
+			content += "\n"
+		}
+		return content + "[" + formatKey(table) + "]\n" + line, nil
+	}
+
+	insert := start
+	for i := start; i < end; i++ {
+		if k, rest, ok := parseKeyLine(lines[i]); ok && slices.Equal(k, []string{name}) {
+			if toml.Unmarshal([]byte("v = "+rest), new(map[string]any)) != nil {
+				return "", errors.New("its value spans several lines; change it with ch config edit")
+			}
+			lines[i] = line
+			return strings.Join(lines, ""), nil
+		}
+		if trimmed := strings.TrimSpace(lines[i]); trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+			insert = i + 1
+		}
+	}
+	if insert > 0 && !strings.HasSuffix(lines[insert-1], "\n") {
+		lines[insert-1] += "\n"
+	}
+	lines = slices.Insert(lines, insert, line)
+	return strings.Join(lines, ""), nil
+}
+
+// configEdit has the user edit a copy of the config file at path in
+// $VISUAL or $EDITOR, and replaces the file with it once it loads.
+func configEdit(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to read config %s: %v", path, err)
+	}
+	file, err := os.CreateTemp("", "ch-config-*.toml")
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(content)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+
+	ask := askTerminal(os.Stdin)
+	for {
+		if err := runEditor(file.Name()); err != nil {
+			os.Remove(file.Name())
+			return err
+		}
+		edited, err := os.ReadFile(file.Name())
+		if err != nil {
+			return err
+		}
+		if string(edited) == string(content) {
+			os.Remove(file.Name())
+			fmt.Fprintf(messages, "%s not changed.\n", path)
+			return nil
+		}
+		err = writeConfig(path, string(edited))
+		if err == nil {
+			os.Remove(file.Name())
+			fmt.Fprintf(messages, "Saved %s.\n", path)
+			return nil
+		}
+		if ask == nil || !ask(fmt.Sprintf("%v\nEdit it again?", err)) {
+			return fmt.Errorf("%v\n%s not changed; the edited copy is in %s", err, path, file.Name())
+		}
+	}
+}
+
+// writeConfig checks content as ch would load it from path, and if it
+// loads, writes it to path, keeping the file's permissions.
+func writeConfig(path, content string) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(dir, ".config-*.toml")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	_, err = file.WriteString(content)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	// Scripts are resolved against the config file's directory, which the
+	// copy shares.
+	if _, err := loadConfig(file.Name(), true); err != nil {
+		return usageError("%s", strings.ReplaceAll(err.Error(), file.Name(), path))
+	}
+	mode := fs.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if err := os.Chmod(file.Name(), mode); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+// tomlValue returns v as a TOML value.
+func tomlValue(v any) (string, error) {
+	var b strings.Builder
+	if err := toml.NewEncoder(&b).Encode(map[string]any{"v": v}); err != nil {
+		return "", err
+	}
+	value, ok := strings.CutPrefix(strings.TrimSuffix(b.String(), "\n"), "v = ")
+	if !ok {
+		return "", fmt.Errorf("cannot write %v as a value", v)
+	}
+	return value, nil
+}
+
+var bareKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// formatKey returns keys as a dotted TOML key, quoting those that can't be
+// bare.
+func formatKey(keys []string) string {
+	quoted := make([]string, len(keys))
+	for i, key := range keys {
+		quoted[i] = key
+		if !bareKeyPattern.MatchString(key) {
+			quoted[i] = strconv.Quote(key)
+		}
+	}
+	return strings.Join(quoted, ".")
+}
+
+// parseKey parses the dotted TOML key at the start of s, whose parts are
+// bare or quoted, returning them and what follows the key.
+func parseKey(s string) ([]string, string, error) {
+	var keys []string
+	for {
+		s = strings.TrimLeft(s, " \t")
+		var key string
+		switch {
+		case strings.HasPrefix(s, `"`):
+			end := 1
+			for end < len(s) && s[end] != '"' {
+				if s[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(s) {
+				return nil, "", errors.New("unterminated quoted key")
+			}
+			var err error
+			if key, err = strconv.Unquote(s[:end+1]); err != nil {
+				return nil, "", fmt.Errorf("invalid quoted key %s", s[:end+1])
+			}
+			s = s[end+1:]
+		case strings.HasPrefix(s, "'"):
+			end := strings.IndexByte(s[1:], '\'')
+			if end < 0 {
+				return nil, "", errors.New("unterminated quoted key")
+			}
+			key, s = s[1:end+1], s[end+2:]
+		default:
+			end := strings.IndexFunc(s, func(r rune) bool {
+				return !(r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '_' || r == '-')
+			})
+			if end < 0 {
+				end = len(s)
+			}
+			if end == 0 {
+				return nil, "", errors.New("empty key")
+			}
+			key, s = s[:end], s[end:]
+		}
+		keys = append(keys, key)
+		s = strings.TrimLeft(s, " \t")
+		if !strings.HasPrefix(s, ".") {
+			return keys, s, nil
+		}
+		s = s[1:]
+	}
+}
+
+// parseHeader reports whether line is a table header, and if it is, the
+// table's keys. Headers of arrays of tables ([[name]]) have no keys.
+func parseHeader(line string) ([]string, bool) {
+	line = strings.TrimSpace(line)
+	if strings.HasPrefix(line, "[[") {
+		return nil, true
+	}
+	if !strings.HasPrefix(line, "[") {
+		return nil, false
+	}
+	keys, rest, err := parseKey(line[1:])
+	if err != nil || !strings.HasPrefix(rest, "]") {
+		return nil, false
+	}
+	return keys, true
+}
+
+// parseKeyLine reports whether line is a key = value line, and if it is,
+// its keys and the value (with anything following it).
+func parseKeyLine(line string) ([]string, string, bool) {
+	trimmed := strings.TrimSpace(line)
+	if trimmed == "" || strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, "[") {
+		return nil, "", false
+	}
+	keys, rest, err := parseKey(trimmed)
+	if err != nil || !strings.HasPrefix(rest, "=") {
+		return nil, "", false
+	}
+	return keys, rest[1:], true
+}
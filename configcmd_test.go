@@ -0,0 +1,171 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSetKey(t *testing.T) {
+	const content = `# Settings
+scripts = ["hooks.star"]
+
+# Fence languages.
+[languages]
+".tfvars" = "hcl"
+
+[models.claude]
+provider = "anthropic" # the default
+prune = """
+dist
+"""
+`
+	tests := []struct {
+		name     string
+		keys     []string
+		literal  string
+		expected string
+		err      string
+	}{
+		{
+			name:     "Replace a top-level key",
+			keys:     []string{"scripts"},
+			literal:  "[]",
+			expected: strings.Replace(content, `scripts = ["hooks.star"]`, "scripts = []", 1),
+		},
+		{
+			name:     "Add a top-level key before the tables and their comments",
+			keys:     []string{"cache_limit"},
+			literal:  `"200m-bytes"`,
+			expected: strings.Replace(content, "[\"hooks.star\"]\n", "[\"hooks.star\"]\ncache_limit = \"200m-bytes\"\n", 1),
+		},
+		{
+			name:     "Add a quoted key to a table",
+			keys:     []string{"languages", ".tsx"},
+			literal:  `"tsx"`,
+			expected: strings.Replace(content, "\"hcl\"\n", "\"hcl\"\n\".tsx\" = \"tsx\"\n", 1),
+		},
+		{
+			name:     "Replace a key in a dotted table",
+			keys:     []string{"models", "claude", "provider"},
+			literal:  `"openai"`,
+			expected: strings.Replace(content, `provider = "anthropic" # the default`, `provider = "openai"`, 1),
+		},
+		{
+			name:     "Add a table",
+			keys:     []string{"network", "max_requests"},
+			literal:  "10",
+			expected: content + "\n[network]\nmax_requests = 10\n",
+		},
+		{
+			name:    "Multi-line value",
+			keys:    []string{"models", "claude", "prune"},
+			literal: `"x"`,
+			err:     "spans several lines",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := setKey(content, tt.keys, tt.literal)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("Expected error containing %q\n  Actual %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if actual != tt.expected {
+				t.Errorf("Expected:\n%s\n  Actual:\n%s", tt.expected, actual)
+			}
+		})
+	}
+
+	if actual, _ := setKey("", []string{"detect_projects"}, "false"); actual != "detect_projects = false\n" {
+		t.Errorf("Expected a key in an empty file\n  Actual %q", actual)
+	}
+}
+
+func TestConfigCommand(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ch", "config.toml")
+	var output strings.Builder
+	messages = &output
+	defer func() { messages = os.Stdout }()
+
+	for _, args := range [][]string{
+		{"set", "cache_limit", "200m-bytes"},
+		{"set", "prune_dirs", `["dist"]`},
+		{"set", "models.local", `{provider = "openai", model = "llama3.1"}`},
+		{"set", "models.local.max_tokens", "2048"},
+	} {
+		if err := configCommand(append([]string{"-config", path}, args...)); err != nil {
+			t.Fatalf("%q: %v", args, err)
+		}
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `cache_limit = "200m-bytes"
+prune_dirs = ["dist"]
+
+[models.local]
+model = "llama3.1"
+provider = "openai"
+max_tokens = 2048
+`
+	if string(content) != expected {
+		t.Errorf("Expected:\n%s\n  Actual:\n%s", expected, content)
+	}
+
+	// Changes that wouldn't load leave the file as it was.
+	for _, tt := range []struct {
+		args []string
+		err  string
+	}{
+		{[]string{"set", "cache_limit", "2k"}, "is not in bytes"},
+		{[]string{"set", "models.local.temperature", "1"}, "unknown keys in config " + path + ": models.local.temperature"},
+		{[]string{"set", "models.other.model", "x"}, "invalid provider"},
+		{[]string{"set", "colour", "red"}, `unknown setting "colour"`},
+		{[]string{"get", "models.local.endpoint"}, "models.local.endpoint is not set"},
+		{[]string{"get", "languages..x"}, "invalid key"},
+		{[]string{"unset", "cache_limit"}, "usage: ch config"},
+	} {
+		err := configCommand(append([]string{"-config", path}, tt.args...))
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("Expected error containing %q for %q\n  Actual %v", tt.err, tt.args, err)
+		}
+	}
+	if unchanged, _ := os.ReadFile(path); string(unchanged) != expected {
+		t.Errorf("Expected the file unchanged\n  Actual:\n%s", unchanged)
+	}
+
+	var got strings.Builder
+	if err := configGet(&got, path, "cache_limit"); err != nil || got.String() != "200m-bytes\n" {
+		t.Errorf("Expected cache_limit 200m-bytes\n  Actual %q, %v", got.String(), err)
+	}
+	var list strings.Builder
+	if err := configList(&list, path, true); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		`models.local.max_tokens = 2048`,
+		`prune_dirs = ["dist"]`,
+		"# clipboard_limit (not set): The size",
+	} {
+		if !strings.Contains(list.String(), line) {
+			t.Errorf("Expected the list to contain %q\n  Actual:\n%s", line, list.String())
+		}
+	}
+}
+
+func TestSettingDocs(t *testing.T) {
+	docs := settingDocs()
+	for _, key := range configKeys() {
+		if docs[key] == "" {
+			t.Errorf("Expected the config file help to document %s", key)
+		}
+	}
+}
@@ -0,0 +1,417 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"sync"
+	"syscall"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+	"github.com/eloquence-cloud/ch/chlib/script"
+	"github.com/eloquence-cloud/ch/chlib/subcmd"
+	"github.com/eloquence-cloud/ch/chlib/transport"
+)
+
+// defaultSession is the session used by calls that name none.
+const defaultSession = "default"
+
+// JSON-RPC 2.0 error codes.
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcServerError    = -32000
+)
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string {
+	return e.Message
+}
+
+// session is a document being assembled across calls: its entries, and the
+// context holding their stored file contents.
+type session struct {
+	sc      subcmd.Context
+	entries []entry.Entry
+}
+
+// sessionParams names the session a call applies to.
+type sessionParams struct {
+	Session string `json:"session,omitempty"`
+}
+
+type addParams struct {
+	sessionParams
+	Subcommands []string `json:"subcommands"`
+	KeepGoing   bool     `json:"keepGoing,omitempty"`
+}
+
+type renderParams struct {
+	sessionParams
+	pipelineOptions
+}
+
+// sessionInfo describes a session in the result of session.list.
+type sessionInfo struct {
+	Session string `json:"session"`
+	Entries int    `json:"entries"`
+}
+
+// daemon holds the sessions shared by all clients of ch daemon. Calls are
+// handled one at a time, like the requests of ch serve.
+type daemon struct {
+	cfg       config
+	transport http.RoundTripper
+	scripts   *script.Scripts
+	cache     *entry.Cache
+	mu        sync.Mutex
+	sessions  map[string]*session
+}
+
+// daemonFlags are the flags of "ch daemon".
+type daemonFlags struct {
+	socketPath *string
+	configPath *string
+}
+
+func addDaemonFlags(flags *flag.FlagSet) daemonFlags {
+	return daemonFlags{
+		socketPath: flags.String("socket", defaultSocketPath(), "Listen on the Unix socket at `path`"),
+		configPath: flags.String("config", "", "Read settings from this config `file`"),
+	}
+}
+
+// daemonCommand implements "ch daemon": a long-lived process that editor
+// extensions drive with JSON-RPC 2.0 over a Unix socket, keeping sessions
+// of entries between calls.
+func daemonCommand(args []string) error {
+	flags := newCommandFlags("daemon")
+	f := addDaemonFlags(flags)
+	rest, err := parseInterspersed(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return subcmd.Errorf(subcmd.KindUsage, "usage: ch daemon [-socket path] [-config file]")
+	}
+
+	cfg, err := loadUserConfig(*f.configPath)
+	if err != nil {
+		return err
+	}
+	scripts, err := script.Load(cfg.Scripts...)
+	if err != nil {
+		return err
+	}
+	scripts.RegisterSubcommands()
+
+	listener, err := listenUnix(*f.socketPath)
+	if err != nil {
+		return err
+	}
+	d := newDaemon(cfg, scripts)
+	d.cache = openRenderCache(cfg)
+	if d.transport, err = cfg.transport(transport.Options{}); err != nil {
+		return err
+	}
+	defer d.close()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		listener.Close()
+	}()
+
+	fmt.Printf("Listening on %s\n", *f.socketPath)
+	if err := d.serve(listener); !errors.Is(err, net.ErrClosed) {
+		return err
+	}
+	return nil
+}
+
+// defaultSocketPath returns $XDG_RUNTIME_DIR/ch.sock, or a per-user socket
+// in the temporary directory when XDG_RUNTIME_DIR is not set.
+func defaultSocketPath() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "ch.sock")
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("ch-%d.sock", os.Getuid()))
+}
+
+// listenUnix listens on a Unix socket that only the current user can use,
+// since clients can run commands. A socket left behind by a daemon that
+// exited uncleanly is replaced; one that still accepts connections is not.
+func listenUnix(path string) (net.Listener, error) {
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("a daemon is already listening on %s", path)
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+func newDaemon(cfg config, scripts *script.Scripts) *daemon {
+	return &daemon{cfg: cfg, scripts: scripts, sessions: make(map[string]*session)}
+}
+
+// serve accepts connections until the listener is closed.
+func (d *daemon) serve(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go d.handleConn(conn)
+	}
+}
+
+// handleConn answers the JSON-RPC requests read from conn. Requests and
+// responses are JSON values, one per line.
+func (d *daemon) handleConn(conn net.Conn) {
+	defer conn.Close()
+	decoder := json.NewDecoder(conn)
+	encoder := json.NewEncoder(conn)
+	for {
+		var req rpcRequest
+		if err := decoder.Decode(&req); err != nil {
+			var typeErr *json.UnmarshalTypeError
+			if errors.As(err, &typeErr) {
+				// Valid JSON of the wrong shape, such as a batch.
+				encoder.Encode(rpcResponse{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &rpcError{rpcInvalidRequest, "expected a JSON-RPC 2.0 request object"}})
+				continue
+			}
+			if err != io.EOF {
+				// The stream can't be resynchronized after malformed JSON.
+				encoder.Encode(rpcResponse{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &rpcError{rpcParseError, err.Error()}})
+			}
+			return
+		}
+		result, err := d.call(req)
+		if req.ID == nil {
+			continue // a notification
+		}
+		response := rpcResponse{JSONRPC: "2.0", ID: req.ID, Result: result}
+		if err != nil {
+			var rpcErr *rpcError
+			if !errors.As(err, &rpcErr) {
+				rpcErr = &rpcError{rpcServerError, err.Error()}
+			}
+			response.Result, response.Error = nil, rpcErr
+		}
+		if err := encoder.Encode(response); err != nil {
+			return
+		}
+	}
+}
+
+// call runs one request and returns its result.
+func (d *daemon) call(req rpcRequest) (any, error) {
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		return nil, &rpcError{rpcInvalidRequest, "expected a JSON-RPC 2.0 request with a method"}
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	switch req.Method {
+	case "add":
+		var params addParams
+		if err := decodeParams(req.Params, &params); err != nil {
+			return nil, err
+		}
+		return d.add(params)
+	case "render", "copy":
+		var params renderParams
+		if err := decodeParams(req.Params, &params); err != nil {
+			return nil, err
+		}
+		markdown, err := d.render(params)
+		if err != nil {
+			return nil, err
+		}
+		if req.Method == "copy" {
+			if err := writeClipboard(markdown); err != nil {
+				return nil, err
+			}
+			return map[string]int{"bytes": len(markdown)}, nil
+		}
+		return map[string]string{"markdown": markdown}, nil
+	case "entries":
+		var params sessionParams
+		if err := decodeParams(req.Params, &params); err != nil {
+			return nil, err
+		}
+		s, err := d.session(params.Session)
+		if err != nil {
+			return nil, err
+		}
+		return entry.Export(s.entries)
+	case "session.list":
+		infos := []sessionInfo{}
+		for name, s := range d.sessions {
+			infos = append(infos, sessionInfo{Session: name, Entries: len(s.entries)})
+		}
+		sort.Slice(infos, func(i, j int) bool { return infos[i].Session < infos[j].Session })
+		return infos, nil
+	case "session.clear", "session.close":
+		var params sessionParams
+		if err := decodeParams(req.Params, &params); err != nil {
+			return nil, err
+		}
+		name := sessionName(params.Session)
+		s, err := d.session(name)
+		if err != nil {
+			return nil, err
+		}
+		s.sc.Cleanup()
+		delete(d.sessions, name)
+		if req.Method == "session.clear" {
+			if _, err := d.createSession(name); err != nil {
+				return nil, err
+			}
+		}
+		return struct{}{}, nil
+	}
+	return nil, &rpcError{rpcMethodNotFound, fmt.Sprintf("unknown method %q", req.Method)}
+}
+
+// add runs subcommands and appends their entries to a session, creating
+// the session if needed.
+func (d *daemon) add(params addParams) (any, error) {
+	name := sessionName(params.Session)
+	s, ok := d.sessions[name]
+	if !ok {
+		var err error
+		if s, err = d.createSession(name); err != nil {
+			return nil, err
+		}
+	}
+	sc := s.sc
+	sc.KeepGoing = params.KeepGoing
+	sc.Network = subcmd.NewNetwork(d.cfg.networkLimits(), d.transport)
+	entries, err := subcmd.Process(context.Background(), sc, params.Subcommands)
+	if err != nil {
+		return nil, fmt.Errorf("failed to process subcommands: %v", err)
+	}
+	s.entries = append(s.entries, entries...)
+	return map[string]int{"added": len(entries), "entries": len(s.entries)}, nil
+}
+
+func (d *daemon) render(params renderParams) (string, error) {
+	s, err := d.session(params.Session)
+	if err != nil {
+		return "", err
+	}
+	markdown, _, _, err := params.pipelineOptions.render(s.sc.TempDir, s.entries, d.cfg, d.scripts, d.cache)
+	return markdown, err
+}
+
+func (d *daemon) session(name string) (*session, error) {
+	name = sessionName(name)
+	s, ok := d.sessions[name]
+	if !ok {
+		return nil, fmt.Errorf("no session %q", name)
+	}
+	return s, nil
+}
+
+func (d *daemon) createSession(name string) (*session, error) {
+	sc, err := subcmd.NewContext()
+	if err != nil {
+		return nil, err
+	}
+	sc.PruneDirs = d.cfg.PruneDirs
+	sc.PathAliases = d.cfg.pathAliases()
+	sc.AskTemplates = d.cfg.Ask
+	sc.Bundles = d.cfg.bundleScripts()
+	s := &session{sc: sc}
+	d.sessions[name] = s
+	return s, nil
+}
+
+// close removes the stored file contents of every session.
+func (d *daemon) close() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for name, s := range d.sessions {
+		s.sc.Cleanup()
+		delete(d.sessions, name)
+	}
+}
+
+func sessionName(name string) string {
+	if name == "" {
+		return defaultSession
+	}
+	return name
+}
+
+// decodeParams decodes by-name params into v. Absent params leave v at its
+// zero value.
+func decodeParams(params json.RawMessage, v any) error {
+	if len(params) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(params, v); err != nil {
+		return &rpcError{rpcInvalidParams, fmt.Sprintf("invalid params: %v", err)}
+	}
+	return nil
+}
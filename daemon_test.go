@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/eloquence-cloud/ch/chlib/script"
+)
+
+// startDaemon runs a daemon on a socket in a temporary directory and
+// returns a connection to it.
+func startDaemon(t *testing.T) net.Conn {
+	scripts, err := script.Load()
+	if err != nil {
+		t.Fatalf("Failed to load scripts: %v", err)
+	}
+	socketPath := filepath.Join(t.TempDir(), "ch.sock")
+	listener, err := listenUnix(socketPath)
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	d := newDaemon(config{}, scripts)
+	go d.serve(listener)
+	t.Cleanup(func() {
+		listener.Close()
+		d.close()
+	})
+
+	conn, err := net.Dial("unix", socketPath)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// rpcCall sends request on conn and decodes the response.
+func rpcCall(t *testing.T, conn net.Conn, reader *bufio.Reader, request string) map[string]any {
+	if _, err := conn.Write([]byte(request + "\n")); err != nil {
+		t.Fatalf("Failed to send request: %v", err)
+	}
+	line, err := reader.ReadBytes('\n')
+	if err != nil {
+		t.Fatalf("Failed to read response: %v", err)
+	}
+	var response map[string]any
+	if err := json.Unmarshal(line, &response); err != nil {
+		t.Fatalf("Failed to decode response %q: %v", line, err)
+	}
+	return response
+}
+
+func TestDaemonSession(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(path, []byte("remember\n"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	conn := startDaemon(t)
+	reader := bufio.NewReader(conn)
+
+	calls := []struct {
+		request  string
+		expected map[string]any
+	}{
+		{
+			request:  `{"jsonrpc": "2.0", "id": 1, "method": "add", "params": {"subcommands": ["say", "Read this:"]}}`,
+			expected: map[string]any{"jsonrpc": "2.0", "id": 1.0, "result": map[string]any{"added": 1.0, "entries": 1.0}},
+		},
+		{
+			request:  `{"jsonrpc": "2.0", "id": 2, "method": "add", "params": {"subcommands": ["attach", "` + path + `"]}}`,
+			expected: map[string]any{"jsonrpc": "2.0", "id": 2.0, "result": map[string]any{"added": 1.0, "entries": 2.0}},
+		},
+		{
+			request:  `{"jsonrpc": "2.0", "id": 3, "method": "add", "params": {"session": "other", "subcommands": ["say", "Elsewhere"]}}`,
+			expected: map[string]any{"jsonrpc": "2.0", "id": 3.0, "result": map[string]any{"added": 1.0, "entries": 1.0}},
+		},
+		{
+			request:  `{"jsonrpc": "2.0", "id": 4, "method": "render"}`,
+			expected: map[string]any{"jsonrpc": "2.0", "id": 4.0, "result": map[string]any{"markdown": "Read this:\n\n`" + path + "`\n```\nremember\n```\n"}},
+		},
+		{
+			request: `{"jsonrpc": "2.0", "id": 5, "method": "session.list"}`,
+			expected: map[string]any{"jsonrpc": "2.0", "id": 5.0, "result": []any{
+				map[string]any{"session": "default", "entries": 2.0},
+				map[string]any{"session": "other", "entries": 1.0},
+			}},
+		},
+		{
+			request:  `{"jsonrpc": "2.0", "id": 6, "method": "session.clear"}`,
+			expected: map[string]any{"jsonrpc": "2.0", "id": 6.0, "result": map[string]any{}},
+		},
+		{
+			request:  `{"jsonrpc": "2.0", "id": 7, "method": "entries", "params": {"session": "other"}}`,
+			expected: map[string]any{"jsonrpc": "2.0", "id": 7.0, "result": map[string]any{"schemaVersion": 1.0, "entries": []any{map[string]any{"type": "message", "content": "Elsewhere"}}}},
+		},
+		{
+			request:  `{"jsonrpc": "2.0", "id": 8, "method": "session.close", "params": {"session": "other"}}`,
+			expected: map[string]any{"jsonrpc": "2.0", "id": 8.0, "result": map[string]any{}},
+		},
+		{
+			request: `{"jsonrpc": "2.0", "id": 9, "method": "session.list"}`,
+			expected: map[string]any{"jsonrpc": "2.0", "id": 9.0, "result": []any{
+				map[string]any{"session": "default", "entries": 0.0},
+			}},
+		},
+	}
+
+	for _, call := range calls {
+		actual := rpcCall(t, conn, reader, call.request)
+		if !reflect.DeepEqual(actual, call.expected) {
+			t.Errorf("Request: %s\nExpected: %v\n  Actual: %v", call.request, call.expected, actual)
+		}
+	}
+}
+
+func TestDaemonErrors(t *testing.T) {
+	conn := startDaemon(t)
+	reader := bufio.NewReader(conn)
+
+	testCases := []struct {
+		name     string
+		request  string
+		expected float64
+	}{
+		{name: "Unknown method", request: `{"jsonrpc": "2.0", "id": 1, "method": "frobnicate"}`, expected: rpcMethodNotFound},
+		{name: "Invalid params", request: `{"jsonrpc": "2.0", "id": 2, "method": "add", "params": {"subcommands": "say hi"}}`, expected: rpcInvalidParams},
+		{name: "Missing version", request: `{"id": 3, "method": "render"}`, expected: rpcInvalidRequest},
+		{name: "Batch", request: `[{"jsonrpc": "2.0", "id": 4, "method": "render"}]`, expected: rpcInvalidRequest},
+		{name: "Unknown session", request: `{"jsonrpc": "2.0", "id": 5, "method": "render", "params": {"session": "nope"}}`, expected: rpcServerError},
+		{name: "Failing subcommand", request: `{"jsonrpc": "2.0", "id": 6, "method": "add", "params": {"subcommands": ["insert", "/nonexistent/file"]}}`, expected: rpcServerError},
+		{name: "Malformed JSON", request: `{"jsonrpc": }`, expected: rpcParseError},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			response := rpcCall(t, conn, reader, tc.request)
+			rpcErr, ok := response["error"].(map[string]any)
+			if !ok || rpcErr["code"] != tc.expected {
+				t.Errorf("Expected error code %v, got response: %v", tc.expected, response)
+			}
+			if _, ok := response["result"]; ok {
+				t.Errorf("Expected no result alongside the error, got: %v", response)
+			}
+		})
+	}
+}
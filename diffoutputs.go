@@ -0,0 +1,176 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/eloquence-cloud/ch/chlib/diff"
+	"github.com/eloquence-cloud/ch/chlib/entry"
+	"github.com/eloquence-cloud/ch/chlib/render"
+	"github.com/eloquence-cloud/ch/chlib/subcmd"
+)
+
+// diffOutputsFlags are the flags of the diff-outputs command.
+type diffOutputsFlags struct {
+	output   outputFlags
+	wordDiff *bool
+}
+
+func addDiffOutputsFlags(flags *flag.FlagSet) diffOutputsFlags {
+	return diffOutputsFlags{
+		output:   addOutputFlags(flags),
+		wordDiff: flags.Bool("word-diff", false, "Mark the changed words within lines instead of showing whole changed lines"),
+	}
+}
+
+// diffOutputsCommand implements "ch diff-outputs old.md new.md": it compares
+// two generated outputs file by file and writes a summary of what was added,
+// removed, and changed, with a diff for each changed file and the full
+// contents of each added one.
+func diffOutputsCommand(args []string) error {
+	flags := newCommandFlags("diff-outputs")
+	f := addDiffOutputsFlags(flags)
+	output := f.output
+	inputs, err := parseInterspersed(flags, args)
+	if err != nil {
+		return err
+	}
+	if err := output.validate(); err != nil {
+		return err
+	}
+	if len(inputs) != 2 {
+		return subcmd.Errorf(subcmd.KindUsage, "usage: ch diff-outputs old.md new.md (-c | -o file)")
+	}
+
+	ctx, err := subcmd.NewContext()
+	if err != nil {
+		return err
+	}
+	defer ctx.Cleanup()
+
+	var outputs [2]parsedOutput
+	for i, input := range inputs {
+		if outputs[i], err = readParsedOutput(ctx, input); err != nil {
+			return err
+		}
+	}
+
+	entries, err := diffOutputs(outputs[0], outputs[1], *f.wordDiff)
+	if err != nil {
+		return err
+	}
+	return output.write(render.Markdown(entries, entry.RenderOptions{}))
+}
+
+// parsedOutput is a generated output reduced to what diff-outputs compares:
+// its files in order of appearance, and the rest of its text.
+type parsedOutput struct {
+	paths []string
+	files map[string]entry.File
+	text  string
+}
+
+func readParsedOutput(ctx subcmd.Context, path string) (parsedOutput, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return parsedOutput{}, subcmd.Errorf(subcmd.KindMissingFile, "failed to read %s: %v", path, err)
+	}
+	entries, err := render.Parse(ctx.TempDir, string(content), path)
+	if err != nil {
+		return parsedOutput{}, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	return newParsedOutput(entries), nil
+}
+
+// newParsedOutput groups the entries parsed from an output. When a file
+// appears more than once, its last copy is compared.
+func newParsedOutput(entries []entry.Entry) parsedOutput {
+	output := parsedOutput{files: make(map[string]entry.File)}
+	var text []string
+	for _, e := range entries {
+		switch e := e.(type) {
+		case entry.File:
+			if _, seen := output.files[e.OriginalPath]; !seen {
+				output.paths = append(output.paths, e.OriginalPath)
+			}
+			output.files[e.OriginalPath] = e
+		case entry.Message:
+			text = append(text, e.Text)
+		}
+	}
+	output.text = strings.Join(text, "\n\n")
+	return output
+}
+
+// diffOutputs describes how new differs from old: a summary list, then a
+// diff entry per changed file and a file entry per added one. With words,
+// the diffs mark changed words rather than lines.
+func diffOutputs(old, new parsedOutput, words bool) ([]entry.Entry, error) {
+	compare := diff.Unified
+	if words {
+		compare = diff.Words
+	}
+	var summary []string
+	var details []entry.Entry
+
+	for _, path := range new.paths {
+		newContent, err := os.ReadFile(new.files[path].StoragePath)
+		if err != nil {
+			return nil, err
+		}
+		oldFile, existed := old.files[path]
+		if !existed {
+			summary = append(summary, fmt.Sprintf("- Added `%s`", path))
+			details = append(details, new.files[path])
+			continue
+		}
+		oldContent, err := os.ReadFile(oldFile.StoragePath)
+		if err != nil {
+			return nil, err
+		}
+		if changes := compare("a/"+path, "b/"+path, string(oldContent), string(newContent)); changes != "" {
+			summary = append(summary, fmt.Sprintf("- Changed `%s`", path))
+			details = append(details, entry.Diff{Path: path, Diff: changes, Words: words})
+		}
+	}
+	for _, path := range old.paths {
+		if _, kept := new.files[path]; !kept {
+			summary = append(summary, fmt.Sprintf("- Removed `%s`", path))
+		}
+	}
+	if old.text != new.text {
+		summary = append(summary, "- Changed the text outside of files")
+		details = append(details, entry.Diff{
+			Path:  "text",
+			Diff:  compare("a/text", "b/text", old.text+"\n", new.text+"\n"),
+			Words: words,
+		})
+	}
+
+	if len(summary) == 0 {
+		return []entry.Entry{entry.Message{Text: "Nothing has changed since the previous context."}}, nil
+	}
+	entries := []entry.Entry{entry.Message{Text: "Changes since the previous context:\n\n" + strings.Join(summary, "\n")}}
+	return append(entries, details...), nil
+}
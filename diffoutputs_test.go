@@ -0,0 +1,69 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+	"github.com/eloquence-cloud/ch/chlib/render"
+)
+
+func TestDiffOutputs(t *testing.T) {
+	dir := t.TempDir()
+	parse := func(markdown string) parsedOutput {
+		entries, err := render.Parse(dir, markdown, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return newParsedOutput(entries)
+	}
+
+	old := parse("Context:\n\n`same.go`\n```go\nx\n```\n\n`changed.go`\n```go\nold\n```\n\n`gone.go`\n```go\ny\n```\n")
+	new := parse("Context:\n\n`same.go`\n```go\nx\n```\n\n`changed.go`\n```go\nnew\n```\n\n`added.go`\n```go\nz\n```\n")
+
+	entries, err := diffOutputs(old, new, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"message: Changes since the previous context:\n\n- Changed `changed.go`\n- Added `added.go`\n- Removed `gone.go`",
+		"diff changed.go: --- a/changed.go\n+++ b/changed.go\n@@ -1 +1 @@\n-old\n+new\n",
+		"file added.go: z\n",
+	}
+	if actual := summarizeEntries(t, entries); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected %q\n  Actual %q", expected, actual)
+	}
+
+	entries, err = diffOutputs(old, old, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []string{"message: Nothing has changed since the previous context."}
+	if actual := summarizeEntries(t, entries); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected %q\n  Actual %q", expected, actual)
+	}
+}
+
+// summarizeEntries flattens entries into comparable strings, reading file
+// contents back from storage.
+func summarizeEntries(t *testing.T, entries []entry.Entry) []string {
+	var summary []string
+	for _, e := range entries {
+		switch e := e.(type) {
+		case entry.Message:
+			summary = append(summary, "message: "+e.Text)
+		case entry.File:
+			content, err := os.ReadFile(e.StoragePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			summary = append(summary, "file "+e.OriginalPath+": "+string(content))
+		case entry.Diff:
+			summary = append(summary, "diff "+e.Path+": "+e.Diff)
+		default:
+			t.Fatalf("unexpected entry %#v", e)
+		}
+	}
+	return summary
+}
@@ -0,0 +1,68 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package main
+
+import (
+	"log"
+	"os"
+
+	"github.com/eloquence-cloud/ch/chlib/subcmd"
+)
+
+// Exit statuses, one for each subcmd.ErrorKind, so that scripts and CI
+// jobs can branch on what went wrong. 2 matches the flag package's status
+// for invalid flags.
+const (
+	exitOther       = 1
+	exitUsage       = 2
+	exitMissingFile = 3
+	exitRemote      = 4
+	exitExec        = 5
+	exitOutput      = 6
+)
+
+// exitCode returns the exit status for err.
+func exitCode(err error) int {
+	switch subcmd.KindOf(err) {
+	case subcmd.KindUsage:
+		return exitUsage
+	case subcmd.KindMissingFile:
+		return exitMissingFile
+	case subcmd.KindRemote:
+		return exitRemote
+	case subcmd.KindExec:
+		return exitExec
+	case subcmd.KindOutput:
+		return exitOutput
+	default:
+		return exitOther
+	}
+}
+
+// fail reports err and exits with its exit status.
+func fail(err error) {
+	log.Print(err)
+	os.Exit(exitCode(err))
+}
+
+// usageError returns an error of kind subcmd.KindUsage, for invalid flags.
+func usageError(format string, args ...any) error {
+	return subcmd.Errorf(subcmd.KindUsage, format, args...)
+}
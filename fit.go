@@ -0,0 +1,343 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+	"github.com/eloquence-cloud/ch/chlib/render"
+	"github.com/eloquence-cloud/ch/chlib/skeleton"
+	"github.com/eloquence-cloud/ch/chlib/subcmd"
+)
+
+// fitCommands documents the commands of -fit's overflow assistant.
+var fitCommands = []optionDoc{
+	{"drop n...", "Leave out entries."},
+	{"truncate n lines", "Keep only the first lines of entry n, a file, message, or command output."},
+	{"skeleton n...", "Reduce attached files to their declarations, without function bodies."},
+	{"undo", "Undo the last change."},
+	{"auto", "Trim the rest as -budget does without -fit, and deliver the output."},
+	{"quit", "Quit without delivering anything. So does the end of input (Ctrl-D)."},
+	{"help", "List these commands."},
+}
+
+// fitListed is how many of the costliest entries the overflow assistant
+// lists.
+const fitListed = 20
+
+// fitter is a session of -fit's overflow assistant: the entries as changed
+// so far, rendered, and the earlier versions that undo returns to.
+type fitter struct {
+	sc      subcmd.Context
+	opts    entry.RenderOptions
+	budget  render.Limit
+	out     io.Writer
+	entries []entry.Entry
+	chunks  []render.Chunk
+	history [][]entry.Entry
+}
+
+// fitBudget runs -fit's overflow assistant if chunks, rendered from
+// entries, are over budget. It lists the entries by cost and reads
+// commands from in (see fitCommands) that drop, truncate, or skeletonize
+// them, until the output fits or the user has the rest trimmed
+// automatically. It returns the changed entries and their chunks.
+// Truncated and skeletonized files are stored in sc.TempDir.
+func fitBudget(sc subcmd.Context, entries []entry.Entry, chunks []render.Chunk, opts entry.RenderOptions, budget render.Limit, in io.Reader, out io.Writer) ([]entry.Entry, []render.Chunk, error) {
+	f := &fitter{sc: sc, opts: opts, budget: budget, out: out, entries: entries, chunks: chunks}
+	if f.size() <= budget.Amount {
+		return entries, chunks, nil
+	}
+	f.list()
+	fmt.Fprintln(out, "Drop, truncate, or skeletonize entries until it fits, or enter help for more commands.")
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprint(out, "fit> ")
+		if !scanner.Scan() {
+			fmt.Fprintln(out)
+			if err := scanner.Err(); err != nil {
+				return nil, nil, err
+			}
+			return nil, nil, fmt.Errorf("stopped before the output fit the budget")
+		}
+		done, err := f.handle(scanner.Text())
+		if err != nil {
+			fmt.Fprintf(out, "Error: %v\n", err)
+			continue
+		}
+		if done {
+			return f.entries, f.chunks, nil
+		}
+	}
+}
+
+// handle runs one line of input, reporting whether the assistant is done.
+func (f *fitter) handle(line string) (bool, error) {
+	words, err := subcmd.SplitWords(line)
+	if err != nil || len(words) == 0 {
+		return false, err
+	}
+	args := words[1:]
+	var changed []entry.Entry
+	switch words[0] {
+	case "drop", "d":
+		changed, err = f.drop(args)
+	case "truncate", "t":
+		changed, err = f.truncate(args)
+	case "skeleton", "s":
+		changed, err = f.skeleton(args)
+	case "undo", "u":
+		if len(f.history) == 0 {
+			return false, fmt.Errorf("there is nothing to undo")
+		}
+		changed = f.history[len(f.history)-1]
+		f.history = f.history[:len(f.history)-1]
+	case "auto", "a":
+		return true, nil
+	case "quit", "q":
+		return false, fmt.Errorf("stopped before the output fit the budget")
+	case "help":
+		for _, cmd := range fitCommands {
+			writeTerm(f.out, 2, 18, cmd.term, cmd.text)
+		}
+		return false, nil
+	default:
+		return false, fmt.Errorf("unknown command %s (try help)", words[0])
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if words[0] != "undo" && words[0] != "u" {
+		f.history = append(f.history, f.entries)
+	}
+	f.entries = changed
+	f.chunks = render.Chunks(changed, f.opts)
+	if size := f.size(); size <= f.budget.Amount {
+		fmt.Fprintf(f.out, "The output is now %s, within the budget of %s.\n", f.measure(size), f.budget)
+		return true, nil
+	}
+	f.list()
+	return false, nil
+}
+
+// size returns the size of the output, in the budget's unit.
+func (f *fitter) size() int {
+	return f.budget.Measure(render.Join(f.chunks))
+}
+
+// measure describes n in the budget's unit.
+func (f *fitter) measure(n int) string {
+	return render.Limit{Amount: n, Tokens: f.budget.Tokens}.String()
+}
+
+// list reports how far the output is over budget, and lists the costliest
+// entries, numbered by their position in the output.
+func (f *fitter) list() {
+	size := f.size()
+	fmt.Fprintf(f.out, "The output is %s, over the budget of %s by %s.\n", f.measure(size), f.budget, f.measure(size-f.budget.Amount))
+	// The chunks of the preamble and table of contents, if any, come
+	// before those of the entries.
+	offset := len(f.chunks) - len(f.entries)
+	costs := make([]int, len(f.entries))
+	order := make([]int, len(f.entries))
+	for i := range f.entries {
+		costs[i], order[i] = f.budget.Measure(f.chunks[offset+i].Markdown), i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return costs[order[a]] > costs[order[b]] })
+	rest := 0
+	for n, i := range order {
+		if n >= fitListed {
+			rest += costs[i]
+			continue
+		}
+		line := render.Describe(f.entries[i])
+		if p := entry.PriorityOf(f.entries[i]); p != entry.PriorityNormal {
+			line += fmt.Sprintf(" [%s]", p)
+		}
+		fmt.Fprintf(f.out, "%3d. %10s  %s\n", i+1, f.measure(costs[i]), line)
+	}
+	if len(order) > fitListed {
+		fmt.Fprintf(f.out, "     and %d more, %s in all\n", len(order)-fitListed, f.measure(rest))
+	}
+}
+
+// index converts an entry number, as listed, to an index into f.entries.
+func (f *fitter) index(arg string) (int, error) {
+	n, err := strconv.Atoi(arg)
+	if err != nil || n < 1 || n > len(f.entries) {
+		return 0, fmt.Errorf("no entry %s (there are %d)", arg, len(f.entries))
+	}
+	return n - 1, nil
+}
+
+// drop returns the entries without those numbered in args.
+func (f *fitter) drop(args []string) ([]entry.Entry, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("usage: drop n...")
+	}
+	dropped := make(map[int]bool)
+	for _, arg := range args {
+		i, err := f.index(arg)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := entry.Unwrap(f.entries[i]).(entry.Turn); ok {
+			return nil, fmt.Errorf("entry %d starts a turn, which can't be dropped", i+1)
+		}
+		dropped[i] = true
+	}
+	var kept []entry.Entry
+	for i, e := range f.entries {
+		if !dropped[i] {
+			kept = append(kept, e)
+		}
+	}
+	return kept, nil
+}
+
+// truncate returns the entries with the one numbered args[0] cut to its
+// first args[1] lines.
+func (f *fitter) truncate(args []string) ([]entry.Entry, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("usage: truncate n lines")
+	}
+	i, err := f.index(args[0])
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(args[1])
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("invalid number of lines %q", args[1])
+	}
+	cut := func(text string) (string, int, error) {
+		lines := strings.SplitAfter(strings.TrimSuffix(text, "\n"), "\n")
+		if n >= len(lines) {
+			return "", 0, fmt.Errorf("entry %d has only %d lines", i+1, len(lines))
+		}
+		return strings.Join(lines[:n], ""), len(lines), nil
+	}
+
+	var truncated entry.Entry
+	switch e := entry.Unwrap(f.entries[i]).(type) {
+	case entry.File:
+		content, err := os.ReadFile(e.StoragePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", e.DisplayPath(), err)
+		}
+		kept, total, err := cut(string(content))
+		if err != nil {
+			return nil, err
+		}
+		if truncated, err = f.store(e, kept, fmt.Sprintf("first %d of %d lines", n, total)); err != nil {
+			return nil, err
+		}
+	case entry.Message:
+		kept, total, err := cut(e.Text)
+		if err != nil {
+			return nil, err
+		}
+		e.Text = kept + omittedLines(total-n)
+		truncated = e
+	case entry.Output:
+		kept, total, err := cut(e.Output)
+		if err != nil {
+			return nil, err
+		}
+		e.Output = kept + omittedLines(total-n)
+		truncated = e
+	default:
+		return nil, fmt.Errorf("entry %d can't be truncated; drop it instead", i+1)
+	}
+	return replaceEntry(f.entries, i, truncated), nil
+}
+
+// omittedLines ends a message or command output that truncate has cut,
+// saying how many lines it left out.
+func omittedLines(n int) string {
+	if n == 1 {
+		return "... (1 more line)\n"
+	}
+	return fmt.Sprintf("... (%d more lines)\n", n)
+}
+
+// skeleton returns the entries with the files numbered in args reduced
+// to their declarations.
+func (f *fitter) skeleton(args []string) ([]entry.Entry, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("usage: skeleton n...")
+	}
+	entries := f.entries
+	for _, arg := range args {
+		i, err := f.index(arg)
+		if err != nil {
+			return nil, err
+		}
+		file, ok := entry.Unwrap(entries[i]).(entry.File)
+		if !ok {
+			return nil, fmt.Errorf("entry %d isn't an attached file", i+1)
+		}
+		content, err := os.ReadFile(file.StoragePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", file.DisplayPath(), err)
+		}
+		reduced := skeleton.Of(file.OriginalPath, string(content))
+		if len(reduced) >= len(content) {
+			return nil, fmt.Errorf("entry %d has no function bodies to leave out", i+1)
+		}
+		stored, err := f.store(file, reduced, "skeleton")
+		if err != nil {
+			return nil, err
+		}
+		entries = replaceEntry(entries, i, stored)
+	}
+	return entries, nil
+}
+
+// store stores content, cut down from file's, and returns an entry for it
+// labeled with file's name and how it was cut. The copy has no file ID,
+// so ch apply won't write a reply's version of it over the file.
+func (f *fitter) store(file entry.File, content, how string) (entry.File, error) {
+	stored, err := f.sc.StoreFile(file.OriginalPath, []byte(content))
+	if err != nil {
+		return entry.File{}, err
+	}
+	stored.Label = fmt.Sprintf("%s (%s)", file.DisplayPath(), how)
+	stored.Lang = file.Lang
+	return stored, nil
+}
+
+// replaceEntry returns a copy of entries with entry i replaced by e, at the
+// same priority.
+func replaceEntry(entries []entry.Entry, i int, e entry.Entry) []entry.Entry {
+	entries = append([]entry.Entry(nil), entries...)
+	if p := entry.PriorityOf(entries[i]); p != entry.PriorityNormal {
+		e = entry.Prioritized{Entry: e, Priority: p}
+	}
+	entries[i] = e
+	return entries
+}
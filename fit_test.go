@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+	"github.com/eloquence-cloud/ch/chlib/render"
+	"github.com/eloquence-cloud/ch/chlib/subcmd"
+)
+
+func TestFitBudget(t *testing.T) {
+	dir := t.TempDir()
+	source := "package big\n\nfunc Big() {\n" + strings.Repeat("\tprintln(\"padding the body\")\n", 100) + "}\n"
+	path := filepath.Join(dir, "big.go")
+	if err := os.WriteFile(path, []byte(source), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	var lines strings.Builder
+	for i := 1; i <= 30; i++ {
+		fmt.Fprintf(&lines, "line %d\n", i)
+	}
+	entries := []entry.Entry{
+		entry.File{StoragePath: path, OriginalPath: "big.go"},
+		entry.Output{Output: lines.String(), Command: "seq"},
+		entry.Message{Text: "Why?"},
+	}
+
+	// describe summarizes an entry for comparison: a file by its name,
+	// anything else by its content.
+	describe := func(e entry.Entry) string {
+		switch e := e.(type) {
+		case entry.File:
+			return e.DisplayPath()
+		case entry.Output:
+			return e.Output
+		case entry.Message:
+			return e.Text
+		}
+		return fmt.Sprintf("%T", e)
+	}
+
+	testCases := []struct {
+		name          string
+		budget        int
+		input         string
+		expected      []string
+		expectedError string
+		// expectedOutput is a substring of the assistant's output.
+		expectedOutput string
+	}{
+		{
+			name:     "Already fits",
+			budget:   100_000,
+			expected: []string{"big.go", lines.String(), "Why?"},
+		},
+		{
+			name:           "Drop",
+			budget:         600,
+			input:          "drop 1\n",
+			expected:       []string{lines.String(), "Why?"},
+			expectedOutput: "The output is now",
+		},
+		{
+			name:     "Truncate a file",
+			budget:   600,
+			input:    "truncate 1 5\n",
+			expected: []string{"big.go (first 5 of 104 lines)", lines.String(), "Why?"},
+		},
+		{
+			name:     "Skeleton",
+			budget:   600,
+			input:    "skeleton 1\n",
+			expected: []string{"big.go (skeleton)", lines.String(), "Why?"},
+		},
+		{
+			name:     "Truncate output, then trim automatically",
+			budget:   600,
+			input:    "truncate 2 3\nauto\n",
+			expected: []string{"big.go", "line 1\nline 2\nline 3\n... (27 more lines)\n", "Why?"},
+		},
+		{
+			name:           "Errors and undo",
+			budget:         600,
+			input:          "undo\nskeleton 3\ndrop 9\ndrop 2\nundo\nskeleton 1\n",
+			expected:       []string{"big.go (skeleton)", lines.String(), "Why?"},
+			expectedOutput: "Error: entry 3 isn't an attached file",
+		},
+		{
+			name:          "Quit",
+			budget:        600,
+			input:         "quit\n",
+			expectedError: "stopped before the output fit the budget",
+		},
+		{
+			name:          "End of input",
+			budget:        600,
+			expectedError: "stopped before the output fit the budget",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sc, err := subcmd.NewContext()
+			if err != nil {
+				t.Fatalf("Failed to create context: %v", err)
+			}
+			defer sc.Cleanup()
+			var out bytes.Buffer
+			budget := render.Limit{Amount: tc.budget}
+			chunks := render.Chunks(entries, entry.RenderOptions{})
+			fitted, fittedChunks, err := fitBudget(sc, entries, chunks, entry.RenderOptions{}, budget, strings.NewReader(tc.input), &out)
+			if tc.expectedError != "" {
+				if err == nil || err.Error() != tc.expectedError {
+					t.Fatalf("Expected error %q\n  Actual %v", tc.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			var actual []string
+			for _, e := range fitted {
+				actual = append(actual, describe(e))
+			}
+			if !slices.Equal(actual, tc.expected) {
+				t.Errorf("Expected entries %q\n  Actual %q", tc.expected, actual)
+			}
+			if len(fittedChunks) != len(fitted) {
+				t.Errorf("Expected %d chunks\n  Actual %d", len(fitted), len(fittedChunks))
+			}
+			if !strings.Contains(out.String(), tc.expectedOutput) {
+				t.Errorf("Expected output containing %q\n  Actual %q", tc.expectedOutput, out.String())
+			}
+		})
+	}
+}
@@ -2,7 +2,13 @@ module github.com/eloquence-cloud/ch
 
 go 1.22.1
 
-require golang.design/x/clipboard v0.7.0
+require (
+	github.com/BurntSushi/toml v1.4.0
+	github.com/fsnotify/fsnotify v1.9.0
+	go.starlark.net v0.0.0-20231121155337-90ade8b19d09
+	golang.design/x/clipboard v0.7.0
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require (
 	golang.org/x/exp v0.0.0-20190731235908-ec7cb31e5a56 // indirect
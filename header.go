@@ -0,0 +1,76 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// runHeader returns the text that -header puts at the top of the output:
+// a front matter block recording when, where, and by which ch the output
+// was generated, so that a saved prompt can be traced and regenerated.
+func runHeader(now time.Time) string {
+	fields := [][2]string{{"generated", now.Format(time.RFC3339)}}
+	if host, err := os.Hostname(); err == nil {
+		fields = append(fields, [2]string{"host", host})
+	}
+	cwd, err := os.Getwd()
+	if err == nil {
+		fields = append(fields, [2]string{"cwd", cwd})
+		fields = append(fields, gitFields(cwd)...)
+	}
+	fields = append(fields, [2]string{"ch", buildVersion()})
+
+	var text strings.Builder
+	text.WriteString("---\n")
+	for _, field := range fields {
+		text.WriteString(field[0] + ": " + field[1] + "\n")
+	}
+	text.WriteString("---\n")
+	return text.String()
+}
+
+// gitFields describes the git repository containing dir, if any: its
+// origin (or top-level directory), branch, and commit, marked dirty when
+// there are uncommitted changes.
+func gitFields(dir string) [][2]string {
+	git := func(args ...string) string {
+		output, err := exec.Command("git", append([]string{"-C", dir}, args...)...).Output()
+		if err != nil {
+			return ""
+		}
+		return strings.TrimSpace(string(output))
+	}
+	commit := git("rev-parse", "--short=12", "HEAD")
+	if commit == "" {
+		return nil
+	}
+	repo := git("config", "--get", "remote.origin.url")
+	if repo == "" {
+		repo = git("rev-parse", "--show-toplevel")
+	}
+	if git("status", "--porcelain") != "" {
+		commit += "-dirty"
+	}
+	return [][2]string{{"repo", repo}, {"branch", git("rev-parse", "--abbrev-ref", "HEAD")}, {"commit", commit}}
+}
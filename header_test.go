@@ -0,0 +1,58 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunHeader(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+	markdown := runHeader(now)
+	for _, want := range []string{"---\ngenerated: 2024-05-01T12:30:00Z\n", "\nhost: ", "\ncwd: ", "\nch: dev\n---\n"} {
+		if !strings.Contains(markdown, want) {
+			t.Errorf("Expected the header to contain %q\n  Actual %q", want, markdown)
+		}
+	}
+}
+
+func TestGitFields(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	if fields := gitFields(dir); fields != nil {
+		t.Errorf("Expected no fields outside a repository\n  Actual %q", fields)
+	}
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=t", "-c", "user.email=t@example.com"}, args...)...)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, output)
+		}
+	}
+	git("init", "-q", "-b", "main")
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	git("add", "a.txt")
+	git("commit", "-q", "-m", "a")
+	git("remote", "add", "origin", "https://example.com/a.git")
+
+	fields := gitFields(dir)
+	if len(fields) != 3 || fields[0] != [2]string{"repo", "https://example.com/a.git"} || fields[1] != [2]string{"branch", "main"} {
+		t.Fatalf("Expected repo and branch fields\n  Actual %q", fields)
+	}
+	if strings.HasSuffix(fields[2][1], "-dirty") {
+		t.Errorf("Expected a clean commit\n  Actual %q", fields[2][1])
+	}
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("b"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if commit := gitFields(dir)[2][1]; !strings.HasSuffix(commit, "-dirty") {
+		t.Errorf("Expected a dirty commit\n  Actual %q", commit)
+	}
+}
@@ -0,0 +1,702 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+	"github.com/eloquence-cloud/ch/chlib/subcmd"
+)
+
+// The usage summary (ch -help), "ch help name", and the man page (ch help
+// -man) are all generated from the model below, together with
+// subcmd.Docs for the subcommands, so that a subcommand, command, or flag
+// is documented in one place.
+
+const helpTitle = "ch - A tool for constructing chat messages for easy pasting into AI chat UIs."
+
+var helpDescription = []string{
+	"ch allows you to combine messages, file contents, and command outputs into a formatted markdown suitable for AI chat interactions. It provides a flexible and extensible syntax for creating chat messages with ease.",
+}
+
+// optionDoc documents a term in a list: a flag of the main pipeline, a
+// config file setting, or an exit status.
+type optionDoc struct {
+	term string
+	text string
+}
+
+// optionGroup is a titled list of the main pipeline's flags.
+type optionGroup struct {
+	title   string
+	options []optionDoc
+}
+
+var optionGroups = []optionGroup{
+	{"Flags (one of -c, -o, -push, or -send is required)", []optionDoc{
+		{"-c", "Copy the generated markdown to the clipboard"},
+		{"-force", "With -c, copy output larger than clipboard_limit (by default 2 MB) without asking for confirmation."},
+		{"-rich", "With -c, also copy an HTML rendering of the output, so that pasting into a rich-text editor such as Google Docs, Notion, or a mail client keeps code blocks as formatted code, while plain-text targets still get the markdown. macOS and Windows only. Not with -split."},
+		{"-o file", "Write the output to the specified file (overwriting)."},
+		{"-o -", "Write the output to stdout."},
+		{"-o host:/path", "Upload the output to a file on a remote machine over SFTP, with the sftp command and your ssh configuration and keys (no password prompts). With -split, each part is uploaded beside it. A local name with a colon, such as notes:v2.md, is taken for host:path, so name it ./notes:v2.md; one starting with a digit, such as 2024-10-16T10:00.md, stays local unless the part before the colon is an IP address."},
+		{"-paste-into-frontmost", "Copy the output (as -c does), then switch to the previously active window and paste it there, e.g. into a chat in the browser you came from. Uses osascript on macOS, which needs Accessibility permission for the terminal, and xdotool on X11. Not with -split or -watch."},
+		{"-push", "Send the output to the ch serve at $CH_SERVER (default http://localhost:8377, with $CH_TOKEN if set), for browser extensions listening there to insert into a chat. Not with -split."},
+		{"-send model", "Send the output, as the turns of a conversation, to a model configured in [models], and print its reply on stdout, followed on stderr by the tokens used and, if prices are configured, the cost. If the model fails or is rate limited, its fallbacks are tried in turn. With -json-status, the reply is in the status's reply field. The output and the reply are saved together in the clip history (see ch clip), and with -session the reply joins the session as an assistant turn. Not with -split, -watch, -i, or -o -."},
+		{"-reply-out file", "Also write the reply of the -send model to file, e.g. for ch apply -f."},
+	}},
+	{"Other flags", []optionDoc{
+		{"-dedupe mode", "Handle files included more than once (directly and via a directory): off (default) keeps every copy, drop keeps only the first, stub replaces later copies with a \"see above\" note."},
+		{"-meta", "Show size, line count, modification time, and git status in the header line of each attached file."},
+		{"-toc", "Prefix the output with a table of contents listing every file, message, and command output, with counts."},
+		{"-preamble", "Prefix the output with an introduction for the model: how many files and lines are attached, in which languages and directories, what else is included, and how each kind of entry is delimited (as the other flags render it). Placed before the table of contents, and never trimmed by -budget."},
+		{"-header", "Prefix the output with a front matter block giving the time, host, working directory, git repository, branch, and commit (marked -dirty if there are uncommitted changes), and ch version, so that a saved prompt records how to regenerate it."},
+		{"-details N", "Wrap attached files longer than N lines in a collapsible <details> element, for chat UIs that render HTML."},
+		{"-fence-path", "Put each file's path in its fence info string (```go path=src/main.go) instead of a separate line."},
+		{"-file-ids", "Tag each attached local file with an ID and the start of its SHA-256 in its fence info string (```go id=1a2b3c4d sha256=...), and record them, so that ch apply can tell which file a reply means even if it renames it. The IDs stay the same from run to run."},
+		{"-reply-format files|diff", "End the output with instructions telling the model how to format its reply so that ch apply reads it: each changed file in full, under its path and with its id=, or a unified diff of each in a diff block. Implies -file-ids. The instructions end with an example of the format."},
+		{"-budget size", "Trim the output to fit size (same format as -split): drop low-priority entries, then truncate normal ones. High-priority entries are never trimmed."},
+		{"-fit", "When the output is over -budget (or its bundle's budget), list the entries by cost and ask what to do instead of trimming automatically: drop n..., truncate n lines (keep the first lines of a file, message, or command output), skeleton n... (reduce files to their declarations, without function bodies), or undo, until it fits; auto trims the rest as -budget does, and quit stops. Not with -watch, -i, or -stdin-dsl."},
+		{"-split size", "Split output larger than size into numbered parts, each headed \"Part i of N\". Size is a count of tokens or bytes: 30k-tokens, 100k-bytes, 2m-bytes (a bare number means tokens). With -o file, parts go to file-1.md, file-2.md, ...; with -c, they are copied one at a time, pressing Enter between parts."},
+		{"-format format", "Deliver the output as markdown (the default); as messages: a JSON array of {\"role\", \"content\"} objects, one for each turn begun by the turn subcommand, as chat APIs take; or as anthropic-json: the system and messages of a request to Anthropic's Messages API, with system turns as the system prompt and each run of attached files in a text block of its own; or as launcher-json: an item in the Script Filter JSON that Alfred (and Raycast) read from script commands, titled with the counts of entries, subtitled with the size, and with the markdown as its arg and text.copy, so that a bundle bound to a launcher hotkey ends in Copy to Clipboard. Not with -split."},
+		{"-cache-breakpoints", "With -format anthropic-json, put a cache_control marker after each run of attached files (the first four, which is all the API allows), so that repeated runs of the same bundle reuse the provider's prompt cache of the files up to the first one that changed."},
+		{"-manifest file", "Write a JSON manifest describing each entry (type, source path or command, byte/line/token counts, SHA-256 of its content)."},
+		{"-reproducible", "Pin the run, so that the same files give the same output and ch verify can tell whether they still do: render from the files themselves rather than the cache, and add a lock to the -manifest (which is required) recording the ch version, the working directory, the subcommands, and the SHA-256 of the output. Entries always come in the order of the subcommands, with directories walked in lexical order. Not with -header or -meta, whose time and file details change from run to run, or with -fit."},
+		{"-export file", "Write the collected entries, with their content, as JSON for a later \"import\". With -export, -c and -o are optional."},
+		{"-config file", "Read settings from file instead of the default $XDG_CONFIG_HOME/ch/config.toml (or platform equivalent)."},
+		{"-workspace name", "Scope attach to a workspace of the monorepo: a module of go.work, a package of pnpm-workspace.yaml, or a member of a Cargo workspace, named by its module, package, or crate name or its directory. attach resolves relative paths in it, and attaches all of it when given none."},
+		{"-keep-going", "When a subcommand fails or a file can't be read, put a marked placeholder with the error in the output and carry on."},
+		{"-deadline d", "Stop commands, remote copies, and plugins still running after d (e.g. 30s, 2m) and fail cleanly. With -watch, each run gets d."},
+		{"-proxy url", "Send HTTP requests, such as slack's and -push's, through the proxy at url (http://, https://, socks5://), or directly with \"direct\". By default $HTTPS_PROXY, $HTTP_PROXY, and $NO_PROXY are honored."},
+		{"-ca-cert file", "Trust the certificate authorities in the PEM file, such as a company's private CA, as well as the system's, for HTTPS."},
+		{"-client-cert file", "Present the certificate in the PEM file to HTTPS servers that ask for one; -client-key file gives its private key if the file doesn't hold it too."},
+		{"-insecure-skip-verify", "Don't verify HTTPS servers' certificates. This exposes requests and credentials to anyone who can intercept them; ch warns each time it is used. Prefer -ca-cert."},
+		{"-watch", "Keep running, and re-run whenever an attached or inserted local file changes (or a file is added beside one), refreshing the clipboard or -o file when the output changes. Not with -split; avoid paste with -c, since each run would paste its own output."},
+		{"-no-cache", "Don't reuse or save renderings of attached files. Normally each is cached under $XDG_CACHE_HOME/ch/render (or platform equivalent), keyed by path, size, modification time, and flags, so repeated runs only read the files that changed. The least recently used renderings are removed to keep the cache within cache_limit."},
+		{"-v", "Log each subcommand as it runs: arguments, timing, entry count, and bytes added. -vv also logs debugging detail."},
+		{"-log-file file", "Append logs to file as JSON lines instead of writing them to stderr. The file records at least -v detail."},
+		{"-json-status", "Print one JSON object on stdout when done: success, error, destination and path, entries, bytes, tokens, and warnings. Progress messages go to stderr instead. Not with -o -."},
+		{"-session name", "Put the history of the named session before this run's entries, then store them all as its history, so a conversation can be built up across runs (with turn and reply). With -session, -c and -o are optional. Not with -i or -watch. See the session command."},
+		{"-i", "Build the output interactively: enter subcommands a line at a time, list, preview, reorder, and delete the entries, then copy or write them. -c and -o are optional. See Interactive mode."},
+		{"-stdin-dsl", "Read the subcommands from stdin, a subcommand or more per line as on the command line (blank lines and # comments are skipped), and write the output to stdout. Never prompts and doesn't need a clipboard, for editors' process filters. Not with subcommands on the command line, -c, -o, -push, -send, -i, -watch, or -json-status."},
+		{"-version", "Show the version, commit, Go version, and platform of this ch."},
+		{"-help", "Show this summary. \"ch help name\" shows the details of a subcommand or command."},
+	}},
+}
+
+// commandDocs documents the top-level commands. Their flags come from the
+// commands list.
+var commandDocs = []subcmd.Doc{
+	{
+		Name:     "merge",
+		Args:     "file...",
+		Summary:  "Combine previously generated outputs, separated by rules, keeping only the last copy of each attached file.",
+		Examples: []string{"ch merge overview.md diagnostics.md -c"},
+	},
+	{
+		Name:     "diff-outputs",
+		Args:     "old.md new.md",
+		Summary:  "Summarize which files were added, removed, or changed between two generated outputs, with a diff of each change.",
+		Examples: []string{"ch diff-outputs yesterday.md today.md -c", "ch diff-outputs -word-diff draft-v1.md draft-v2.md -c"},
+	},
+	{
+		Name:    "serve",
+		Summary: "Serve POST /render over HTTP (default localhost:8377): send {\"subcommands\": [...]} and receive markdown, or JSON with \"format\": \"json\". See README for the request fields.",
+		Details: []string{
+			"Each request runs its subcommands in a fresh temporary directory and renders them with the flags it gives, as the main pipeline would. Also serves GET /health.",
+			"Requests must carry \"Authorization: Bearer token\", where the token is -token, else $CH_TOKEN, else a random one that ch serve prints. POST bodies must be sent as application/json, and requests naming a host other than the -listen address, in their Host or Origin header, are refused.",
+			"POST /push relays output sent by ch -push to every client listening on GET /events, a stream of server-sent events, so that a browser extension can insert it straight into a chat.",
+			"With -ui, it also serves a web page at / that lists the files under the working directory, with their approximate token counts, for ticking the ones to attach, typing messages before and after them, previewing the output, and copying it.",
+		},
+		Examples: []string{"ch serve -listen :8377 -token \"$CH_TOKEN\"", "ch serve -ui"},
+	},
+	{
+		Name:    "daemon",
+		Summary: "Serve JSON-RPC 2.0 on a Unix socket (default $XDG_RUNTIME_DIR/ch.sock) for editor extensions: add, render, copy, entries, and session.list/clear/close. See README.",
+		Details: []string{
+			"Each session accumulates entries across requests until it is cleared or closed.",
+		},
+	},
+	{
+		Name:    "self-update",
+		Summary: "Replace ch with the latest release for this platform, after verifying its SHA-256 checksum (and, in signed release builds, the checksums' signature).",
+		Details: []string{
+			"A development build is replaced only with -force, since its version can't be compared.",
+		},
+	},
+	{
+		Name:    "clip",
+		Args:    "list | restore [-reply] n",
+		Summary: fmt.Sprintf("List the last %d outputs that ch copied to the clipboard or sent to a model, most recent first, or copy output n from the list again.", clipHistorySize),
+		Details: []string{
+			"The history is kept in $XDG_DATA_HOME/ch/clips (see ch cache), so a prompt that was replaced on the clipboard by a later copy can be recovered.",
+			"The reply to output sent with -send is saved with it, and listed as \"(with reply)\"; restore -reply copies the reply instead.",
+		},
+		Examples: []string{"ch clip list", "ch clip restore 2", "ch clip restore -reply 1"},
+	},
+	{
+		Name:    "stash",
+		Args:    "list | save|copy|drop name",
+		Summary: "Keep rendered outputs under names for reuse: save stores the clipboard (or -f file) as name, copy copies it back (or writes it with -o), list shows the stash, and drop removes one.",
+		Details: []string{
+			"Stashed outputs are kept in $XDG_DATA_HOME/ch/stash (by default ~/.local/share/ch/stash, or the user config directory on macOS and Windows) until they are dropped, unlike the clip history.",
+		},
+		Examples: []string{"ch -c attach src/ && ch stash save review-ctx", "ch stash copy review-ctx"},
+	},
+	{
+		Name:    "session",
+		Args:    "list | show|drop|compact name",
+		Summary: "Manage the sessions kept by -session: list shows each with its turns and size, show prints one, drop removes one, and compact summarizes its earlier turns to bring it within -target (default 8k-tokens), keeping the last -keep turns (default 2), and as many more as fit, verbatim.",
+		Details: []string{
+			"Sessions are kept in $XDG_DATA_HOME/ch/sessions, beside the stash, with the contents of their files as they were when attached.",
+			"By default compact outlines each earlier turn in a line: the start of what was said and which files were attached and commands run. With -summarizer command, such as \"ollama run llama3.2\", the earlier turns are piped to the command with instructions to summarize them, and its output is used instead. System turns are never summarized.",
+		},
+		Examples: []string{"ch -session fix-auth -c turn user @question.md, attach auth.go", "ch session compact -target 16k-tokens -summarizer \"ollama run llama3.2\" fix-auth"},
+	},
+	{
+		Name:    "bundle",
+		Args:    "[name [flags] [subcommands]]",
+		Summary: "Run a named bundle of subcommands, defined in the config file or the project's .ch.toml, with the flags of the main command line (such as -c) and within the bundle's budget; any subcommands given follow the bundle's. Without a name, list the bundles.",
+		Details: []string{
+			"A bundle is a [bundles.name] table with subcommands, one per line as in a script file for load, and optionally a description and a budget, which -budget overrides. The project's .ch.toml is found in the working directory or the nearest directory above it that has one; only its [bundles] are read, and they replace the config file's bundles of the same names.",
+			"The bundle subcommand runs a bundle within another command line, without its budget.",
+		},
+		Examples: []string{"ch bundle", "ch bundle api-debug -c", `ch bundle api-debug -o prompt.md say "Why does /users return 500?"`},
+	},
+	{
+		Name:    "apply",
+		Summary: "Write the files proposed in a model's reply, read from the clipboard (or -f file, - for stdin). With -n, only show which files would be written; with -undo, put back the files the last apply wrote.",
+		Details: []string{
+			"A proposed file is a fenced code block holding the file's full new content, labeled as ch labels attachments: with a `path` line before it, path= in its info string, or the id= that -file-ids gives. A code block in the diff language holds a unified diff instead, which is applied to the file as it is now, so changes made since it was attached are kept. Other code blocks are taken to be snippets and left alone. -reply-format asks the model for one form or the other.",
+			"A block with an ID is written to the file recorded under that ID, whatever path the reply gives it; an ID ch has no record of is an error, and nothing is written. A block with only a path is written there if ch attached that file or the path is relative and stays within the working directory or its git repository; other paths are refused. IDs are recorded in $XDG_DATA_HOME/ch/attached, with a copy of each file as it was attached.",
+			"If a file has changed since it was attached, apply writes nothing and says which files changed. -merge merges the reply with those changes (using git merge-file), marking any conflicts as git does; -force overwrites them.",
+			"With -interactive, apply shows each file's changes a hunk at a time, as git add -p does, and asks whether to take it: y or n, a or d for the rest of the file, e to edit the hunk's new lines in $VISUAL or $EDITOR first, or q to stop and write only what was taken.",
+			"To keep the working tree untouched until the changes are reviewed, -worktree dir writes them in a git worktree instead, adding it (detached at HEAD, or on -branch) if it doesn't exist. -branch alone writes them in a temporary worktree and commits them on the branch, created from HEAD if need be. -test command then runs the command with sh where the files were written, such as \"go test ./...\", and fails the apply if it fails.",
+			"-commit then commits the files written (and only those), unless -test failed, with a message naming them and quoting the first lines of the reply and of the prompt it answers, the latest output in the clip history with one of their IDs, along with their SHA-256s. -commit=template gives a Go template for the message instead, which can use .Files, .Prompt, .PromptSHA, .PromptTime, .Reply, and .ReplySHA. -branch without -worktree always commits, with -commit's message.",
+			"Each apply first backs up the files it replaces, in $XDG_STATE_HOME/ch/applied, and writes all of them or none. -undo restores the files written by the last apply (removing any it created), unless they have been changed since, which takes -force; undoing again goes back one apply further, up to 20.",
+		},
+		Examples: []string{"ch -c -file-ids attach auth/", "ch -c -reply-format diff attach auth/", "ch apply -n", "ch apply -f reply.md", "ch apply -interactive", "ch apply -worktree ../suggestion -test \"go test ./...\"", "ch apply -branch ai/suggestion", "ch apply -commit", "ch apply -commit='AI: {{.Reply}}'", "ch apply -undo"},
+	},
+	{
+		Name:    "auth",
+		Args:    "set|get|remove name",
+		Summary: "Keep credentials, such as API keys, in the OS keyring: set reads one from stdin (prompting without echo at a terminal), get prints it, and remove deletes it.",
+		Details: []string{
+			"Subcommands that call network services look their credentials up by name, falling back to an environment variable for machines without a keyring: slack ($SLACK_TOKEN); serve, the token -push sends ($CH_TOKEN); and whatever graphql --auth and a [models] table's auth name ($NAME_TOKEN).",
+			"macOS uses the login keychain; Linux and the BSDs use the Secret Service through secret-tool (libsecret-tools).",
+		},
+		Examples: []string{"ch auth set slack", "ch auth remove slack"},
+	},
+	{
+		Name:    "cache",
+		Args:    "info | clean",
+		Summary: "Show where ch stores things between runs and how much space each place takes (info), or empty the cache (clean).",
+		Details: []string{
+			"ch follows the XDG base directories on every platform. The cache, $XDG_CACHE_HOME/ch (by default ~/.cache/ch, or the user cache directory on macOS and Windows), holds what can be recomputed, such as the render cache, which is kept within cache_limit (default 500m-bytes). The data directory, $XDG_DATA_HOME/ch, holds the clip history, the stash, sessions, and the files recorded for ch apply. The state directory, $XDG_STATE_HOME/ch (by default ~/.local/state/ch, or state in the data directory on macOS and Windows), holds the backups for ch apply -undo.",
+			"Remote files and fetched pages are not cached: they are fetched afresh on each run.",
+		},
+		Examples: []string{"ch cache info", "ch cache clean"},
+	},
+	{
+		Name:    "schema",
+		Args:    "[entry-list | manifest | status]",
+		Summary: "Print the JSON Schema of the entry lists that -export writes and import and plugins read, of -manifest's manifests, or of -json-status's status, or list the schemas.",
+		Details: []string{
+			fmt.Sprintf("Each carries a schemaVersion, now %d, which goes up only when a field is renamed or changes meaning, not when one is added. ch reads entry lists of its own version or older, including those written before the version was recorded, and rejects newer ones rather than misread them.", entry.SchemaVersion),
+		},
+		Examples: []string{"ch schema entry-list > entry-list.schema.json"},
+	},
+	{
+		Name:    "verify",
+		Args:    "manifest.json",
+		Summary: "Check that the files a manifest lists still have the bytes on disk it records, listing each that changed or is missing, and fail if any did.",
+		Details: []string{
+			"The check is of each file's sourceSha256, the hash of the file as ch read it, so it holds for HTML pages converted to markdown and for files sliced with tail or head. Relative paths resolve against the working directory recorded by -reproducible, or else the current directory. Files on other machines (host:path), and files not read from disk, such as those stored from an API, are skipped.",
+		},
+		Examples: []string{"ch -reproducible -manifest context.lock.json -o context.md attach src/", "ch verify context.lock.json"},
+	},
+	{
+		Name:    "config",
+		Args:    "get key | set key value | list [-all] | edit",
+		Summary: "Read and change the config file (or -config file) without hand-editing TOML: get prints a setting, set changes one, list prints every setting that is set (with -all, the others too, with what each does), and edit opens the file in $VISUAL or $EDITOR.",
+		Details: []string{
+			"Keys are dotted, as models.claude.max_tokens, with parts that aren't plain words quoted, as languages.\".tfvars\". A value that is valid TOML, such as false, 4096, or [\"dist\"], is taken as it is; anything else is a string. An inline table, such as {provider = \"openai\", model = \"llama3.1\"}, sets each of its keys, for a table whose keys are needed together.",
+			"set changes only the key's line, or adds one at the end of its table, so comments and layout are kept. Every change is checked as ch would load the file, and the file is left as it was if it wouldn't load; edit works on a copy, which replaces the file only once it loads, and offers to edit it again if it doesn't.",
+		},
+		Examples: []string{"ch config set cache_limit 200m-bytes", "ch config set models.local '{provider = \"openai\", model = \"llama3.1\"}'", "ch config get models.claude.model", "ch config list -all"},
+	},
+	{
+		Name:    "help",
+		Args:    "[name]",
+		Summary: "Show this summary, or the details of a subcommand or command.",
+		Examples: []string{
+			"ch help attach",
+			"ch help -man > ch.1",
+		},
+	},
+}
+
+// helpSection is a titled part of the usage summary and man page that
+// follows the commands. An untitled section continues the one before.
+type helpSection struct {
+	title      string
+	manTitle   string
+	paragraphs []string
+	// items are listed after the paragraphs, with their terms padded to
+	// termWidth.
+	items     []optionDoc
+	termWidth int
+}
+
+var helpSections = []helpSection{
+	{
+		paragraphs: []string{"Commands take their flags (-c, -o, ...) anywhere on their command line."},
+	},
+	{
+		title:    "Interactive mode",
+		manTitle: "INTERACTIVE MODE",
+		paragraphs: []string{
+			"ch -i prompts for lines of subcommands, adding their entries to the output. Lines starting with a colon manage the entries:",
+		},
+		items:     replCommands,
+		termWidth: 12,
+	},
+	{
+		title:    "Plugins",
+		manTitle: "PLUGINS",
+		paragraphs: []string{
+			"Any other subcommand name runs the executable ch-<name> on PATH, which reads {\"version\", \"subcommand\", \"args\", \"workDir\"} as JSON on stdin and writes an entry list (the -export format) as JSON on stdout.",
+		},
+	},
+	{
+		title:    "Priorities",
+		manTitle: "PRIORITIES",
+		paragraphs: []string{
+			"Every subcommand accepts --priority high|normal|low right after its name, telling -budget and -split what to keep intact and what to trim first.",
+		},
+	},
+	{
+		title:    "Comma separation rules",
+		manTitle: "COMMA SEPARATION",
+		paragraphs: []string{
+			"- A comma at the end of a word ends that command and is not included in the word.",
+			"- A comma alone in a word ends that command and is not included as a word.",
+			"- A comma within a word is just part of that word.",
+		},
+	},
+	{
+		title:    "Config file (TOML)",
+		manTitle: "CONFIG FILE",
+		items: []optionDoc{
+			{"[languages]", "Map extensions or file names to fence languages, e.g. \".tfvars\" = \"hcl\", \"Dockerfile\" = \"dockerfile\""},
+			{"scripts = [...]", "Starlark scripts that define subcommands and pre_render / post_render hooks (paths relative to the config file)"},
+			{"cache_limit", "The size, in bytes (as 200m-bytes), that the render cache is kept within (default 500m-bytes); see ch cache"},
+			{"clipboard_limit", "The size, as with -budget, above which -c asks before copying output, or without a terminal to ask at, fails unless -force is given (default 2m-bytes)"},
+			{"prune_dirs = [...]", "More directory names (globs) for attach to skip when walking, besides " + strings.Join(subcmd.DefaultPruneDirs, ", ")},
+			{"detect_projects", "Set to false to stop detecting the project type (go, node, python, rust) from marker files such as go.mod and package.json in the working directory or above; a type's prune_dirs, such as dist, and languages are added to those configured"},
+			{"[projects.type]", "Override a project type's markers, prune_dirs (which replace the built-in list), or languages, or define a new type, e.g. [projects.node] prune_dirs = [\"node_modules\"]"},
+			{"[path_aliases]", "Show attached files whose paths start with a prefix under another name, e.g. \"/home/me/src/\" = \"\" (the longest matching prefix wins; attach --as overrides)"},
+			{"[bundles.name]", "A bundle for ch bundle and the bundle subcommand: subcommands (one per line, as in a script file), description, and budget. The project's .ch.toml can define bundles too"},
+			{"[ask]", "Prompt templates for the ask subcommand, by task, overriding the built-in review, debug, refactor, and explain or adding tasks, e.g. security = \"Audit the code below. {{.Details}}\""},
+			{"[models.name]", "A model for -send: provider (anthropic, or openai for OpenAI-compatible servers such as Ollama), model (its ID), endpoint (if not the provider's API), auth (a credential name, see ch auth) and auth_env, max_tokens, context_window and bytes_per_token (to skip a model a request doesn't fit), input_price and output_price (dollars per million tokens), and fallback (models to try next)"},
+			{"[network]", fmt.Sprintf("Limit the HTTP requests of subcommands such as slack: requests_per_second to each host (default %d), max_requests (default %d) and max_megabytes (default %d) per run; proxy, ca_cert, client_cert, and client_key, as with the flags", subcmd.DefaultRequestsPerSecond, subcmd.DefaultMaxRequests, subcmd.DefaultMaxBytes>>20)},
+		},
+		termWidth: 19,
+	},
+	{
+		title:    "Exit status",
+		manTitle: "EXIT STATUS",
+		items: []optionDoc{
+			{"0", "success"},
+			{"1", "other error"},
+			{"2", "usage error (bad flags, unknown subcommand)"},
+			{"3", "missing or unreadable file"},
+			{"4", "remote copy failed"},
+			{"5", "command or plugin failed"},
+			{"6", "output could not be delivered (clipboard, -o file, -export)"},
+		},
+		termWidth: 3,
+	},
+}
+
+// generalExamples come first in the list of examples, before those of
+// each subcommand and command.
+var generalExamples = []string{
+	"ch -o output.md say \"Here are the changes:\", insert changes.txt, attach src/",
+	"ch -export overview.json attach docs/, exec git log --oneline -20",
+	"ch -o prompt.md -json-status -keep-going attach src/, exec make test",
+	"ch -c -watch say \"Why does this fail?\", attach src/, exec go test ./...",
+	"ch -c -budget 50k-tokens attach --priority high main.go, attach --priority low docs/",
+	"ch bundle api-debug -c -fit",
+	"ch -i -meta attach src/",
+}
+
+// helpTopic is a subcommand or command that can be documented.
+type helpTopic struct {
+	subcmd.Doc
+	// command is set for a top-level command, whose flags take one dash;
+	// a subcommand's are written with two.
+	command bool
+}
+
+func subcommandTopics() []helpTopic {
+	var topics []helpTopic
+	for _, doc := range subcmd.Docs() {
+		topics = append(topics, helpTopic{Doc: doc})
+	}
+	return topics
+}
+
+func commandTopics() []helpTopic {
+	var topics []helpTopic
+	for _, cmd := range commands {
+		doc := subcmd.Doc{Name: cmd.name}
+		for _, d := range commandDocs {
+			if d.Name == cmd.name {
+				doc = d
+			}
+		}
+		doc.Flags = subcmd.FlagDocs(cmd.flags)
+		topics = append(topics, helpTopic{Doc: doc, command: true})
+	}
+	return topics
+}
+
+// findTopic returns the command or subcommand with exactly the given name.
+func findTopic(name string) (helpTopic, bool) {
+	for _, topic := range append(commandTopics(), subcommandTopics()...) {
+		if topic.Name == name {
+			return topic, true
+		}
+	}
+	return helpTopic{}, false
+}
+
+func (t helpTopic) flagName(f subcmd.FlagDoc) string {
+	name := "--" + f.Name
+	if t.command || len(f.Name) == 1 {
+		name = "-" + f.Name
+	}
+	if f.Arg != "" {
+		name += " " + f.Arg
+	}
+	return name
+}
+
+// synopsis is the topic's name and arguments, e.g. "attach path...".
+func (t helpTopic) synopsis() string {
+	return strings.TrimSpace(t.Name + " " + t.Args)
+}
+
+// usage is the command line that runs the topic.
+func (t helpTopic) usage() string {
+	var flags string
+	if len(t.Flags) > 0 {
+		flags = " [flags]"
+	}
+	if t.command {
+		return strings.TrimSpace("ch " + t.Name + flags + " " + t.Args)
+	}
+	return strings.TrimSpace("ch [flags] " + t.Name + flags + " " + t.Args)
+}
+
+func allExamples() []string {
+	examples := append([]string{}, generalExamples...)
+	for _, topic := range append(subcommandTopics(), commandTopics()...) {
+		examples = append(examples, topic.Examples...)
+	}
+	return examples
+}
+
+// helpWidth is the width that help text is wrapped to.
+const helpWidth = 79
+
+// wrap breaks text into lines of at most width characters, where
+// possible, at spaces.
+func wrap(text string, width int) []string {
+	var lines []string
+	var line string
+	for _, word := range strings.Fields(text) {
+		if line != "" && len(line)+1+len(word) > width {
+			lines = append(lines, line)
+			line = ""
+		}
+		if line != "" {
+			line += " "
+		}
+		line += word
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// writeTerm writes a term and its wrapped description, starting the
+// description in the column after indent+termWidth, or on the next line if
+// the term doesn't fit.
+func writeTerm(w io.Writer, indent, termWidth int, term, text string) {
+	prefix := strings.Repeat(" ", indent)
+	hanging := strings.Repeat(" ", indent+termWidth+1)
+	lines := wrap(text, helpWidth-len(hanging))
+	if len(term) > termWidth {
+		fmt.Fprintf(w, "%s%s\n", prefix, term)
+	} else if len(lines) > 0 {
+		fmt.Fprintf(w, "%s%-*s %s\n", prefix, termWidth, term, lines[0])
+		lines = lines[1:]
+	} else {
+		fmt.Fprintf(w, "%s%s\n", prefix, term)
+	}
+	for _, line := range lines {
+		fmt.Fprintf(w, "%s%s\n", hanging, line)
+	}
+}
+
+// writeParagraph writes text wrapped and indented, with a hanging indent
+// for a list item ("- ...").
+func writeParagraph(w io.Writer, indent int, text string) {
+	prefix := strings.Repeat(" ", indent)
+	hanging := prefix
+	if strings.HasPrefix(text, "- ") {
+		hanging += "  "
+	}
+	for i, line := range wrap(text, helpWidth-len(hanging)) {
+		if i == 0 {
+			fmt.Fprintf(w, "%s%s\n", prefix, line)
+		} else {
+			fmt.Fprintf(w, "%s%s\n", hanging, line)
+		}
+	}
+}
+
+// writeUsage writes the usage summary shown by -help.
+func writeUsage(w io.Writer) {
+	fmt.Fprintln(w, helpTitle)
+	for _, paragraph := range helpDescription {
+		fmt.Fprintln(w)
+		writeParagraph(w, 0, paragraph)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Usage: ch [flags] subcommand [, subcommand ...]")
+	fmt.Fprintln(w, "       ch command [args]")
+	for _, group := range optionGroups {
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "%s:\n", group.title)
+		for _, option := range group.options {
+			writeTerm(w, 2, 12, option.term, option.text)
+		}
+	}
+	writeTopics(w, "Subcommands", subcommandTopics())
+	writeTopics(w, "Commands", commandTopics())
+	for _, section := range helpSections {
+		fmt.Fprintln(w)
+		indent := 0
+		if section.title != "" {
+			fmt.Fprintf(w, "%s:\n", section.title)
+			indent = 2
+		}
+		for _, paragraph := range section.paragraphs {
+			writeParagraph(w, indent, paragraph)
+		}
+		for _, item := range section.items {
+			writeTerm(w, 2, section.termWidth, item.term, item.text)
+		}
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Examples:")
+	for _, example := range allExamples() {
+		fmt.Fprintf(w, "  %s\n", example)
+	}
+}
+
+func writeTopics(w io.Writer, title string, topics []helpTopic) {
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "%s:\n", title)
+	for _, topic := range topics {
+		writeTerm(w, 2, 17, topic.synopsis(), topic.Summary)
+		for _, f := range topic.Flags {
+			writeTerm(w, 20, 15, topic.flagName(f), f.Usage)
+		}
+	}
+}
+
+// printUsage writes the usage summary to stdout.
+func printUsage() {
+	writeUsage(os.Stdout)
+}
+
+// writeHelp writes the details of a subcommand or command, for "ch help
+// name".
+func writeHelp(w io.Writer, topic helpTopic) {
+	fmt.Fprintf(w, "Usage: %s\n", topic.usage())
+	for _, paragraph := range append([]string{topic.Summary}, topic.Details...) {
+		if paragraph != "" {
+			fmt.Fprintln(w)
+			writeParagraph(w, 0, paragraph)
+		}
+	}
+	if len(topic.Flags) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "Flags:")
+		for _, f := range topic.Flags {
+			usage := f.Usage
+			if f.Default != "" {
+				usage += fmt.Sprintf(" (default %s)", f.Default)
+			}
+			fmt.Fprintf(w, "  %s\n", topic.flagName(f))
+			writeParagraph(w, 6, usage)
+		}
+	}
+	if len(topic.Examples) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "Examples:")
+		for _, example := range topic.Examples {
+			fmt.Fprintf(w, "  %s\n", example)
+		}
+	}
+}
+
+// roff escapes text for a man page.
+func roff(text string) string {
+	text = strings.NewReplacer(`\`, `\e`, "-", `\-`).Replace(text)
+	if strings.HasPrefix(text, ".") || strings.HasPrefix(text, "'") {
+		text = `\&` + text
+	}
+	return text
+}
+
+// roffTerm formats a term for a man page: its first word (a flag or name)
+// in bold and the rest in italics.
+func roffTerm(term string) string {
+	name, rest, ok := strings.Cut(term, " ")
+	if !ok {
+		return `\fB` + roff(name) + `\fR`
+	}
+	return `\fB` + roff(name) + `\fR \fI` + roff(rest) + `\fR`
+}
+
+// writeMan writes ch's man page, in roff, for "ch help -man".
+func writeMan(w io.Writer) {
+	fmt.Fprintf(w, ".TH CH 1 \"\" \"ch %s\" \"User Commands\"\n", roff(buildVersion()))
+	fmt.Fprintln(w, ".SH NAME")
+	fmt.Fprintln(w, `ch \- construct chat messages for easy pasting into AI chat UIs`)
+	fmt.Fprintln(w, ".SH SYNOPSIS")
+	fmt.Fprintln(w, `.B ch`)
+	fmt.Fprintln(w, `[\fIflags\fR] \fIsubcommand\fR [, \fIsubcommand\fR ...]`)
+	fmt.Fprintln(w, ".br")
+	fmt.Fprintln(w, `.B ch`)
+	fmt.Fprintln(w, `\fIcommand\fR [\fIargs\fR]`)
+	fmt.Fprintln(w, ".SH DESCRIPTION")
+	for _, paragraph := range helpDescription {
+		fmt.Fprintf(w, ".PP\n%s\n", roff(paragraph))
+	}
+	fmt.Fprintln(w, ".SH OPTIONS")
+	for _, group := range optionGroups {
+		for _, option := range group.options {
+			fmt.Fprintf(w, ".TP\n%s\n%s\n", roffTerm(option.term), roff(option.text))
+		}
+	}
+	writeManTopics(w, "SUBCOMMANDS", subcommandTopics())
+	writeManTopics(w, "COMMANDS", commandTopics())
+	for _, section := range helpSections {
+		if section.manTitle != "" {
+			fmt.Fprintf(w, ".SH %s\n", section.manTitle)
+		}
+		for _, paragraph := range section.paragraphs {
+			if item, ok := strings.CutPrefix(paragraph, "- "); ok {
+				fmt.Fprintf(w, ".IP \\(bu 2\n%s\n", roff(item))
+			} else {
+				fmt.Fprintf(w, ".PP\n%s\n", roff(paragraph))
+			}
+		}
+		for _, item := range section.items {
+			fmt.Fprintf(w, ".TP\n\\fB%s\\fR\n%s\n", roff(item.term), roff(item.text))
+		}
+	}
+	fmt.Fprintln(w, ".SH EXAMPLES")
+	for _, example := range allExamples() {
+		fmt.Fprintf(w, ".PP\n.nf\n%s\n.fi\n", roff(example))
+	}
+}
+
+func writeManTopics(w io.Writer, title string, topics []helpTopic) {
+	fmt.Fprintf(w, ".SH %s\n", title)
+	for _, topic := range topics {
+		fmt.Fprintf(w, ".TP\n%s\n", roffTerm(topic.synopsis()))
+		if topic.Summary != "" {
+			fmt.Fprintln(w, roff(topic.Summary))
+		}
+		for _, paragraph := range topic.Details {
+			fmt.Fprintf(w, ".IP\n%s\n", roff(paragraph))
+		}
+		if len(topic.Flags) > 0 {
+			fmt.Fprintln(w, ".RS")
+			for _, f := range topic.Flags {
+				usage := f.Usage
+				if f.Default != "" {
+					usage += fmt.Sprintf(" (default %s)", f.Default)
+				}
+				fmt.Fprintf(w, ".TP\n%s\n%s\n", roffTerm(topic.flagName(f)), roff(usage))
+			}
+			fmt.Fprintln(w, ".RE")
+		}
+	}
+}
+
+// helpFlags are the flags of "ch help".
+type helpFlags struct {
+	man *bool
+}
+
+func addHelpFlags(flags *flag.FlagSet) helpFlags {
+	return helpFlags{
+		man: flags.Bool("man", false, "Print ch's man page (roff) instead"),
+	}
+}
+
+// helpCommand implements "ch help [-man] [name]".
+func helpCommand(args []string) error {
+	flags := newCommandFlags("help")
+	f := addHelpFlags(flags)
+	rest, err := parseInterspersed(flags, args)
+	if err != nil {
+		return err
+	}
+	switch {
+	case *f.man && len(rest) == 0:
+		writeMan(os.Stdout)
+	case len(rest) == 0:
+		writeUsage(os.Stdout)
+	case len(rest) == 1:
+		topic, ok := findTopic(rest[0])
+		if !ok {
+			return usageError("no subcommand or command named %s", rest[0])
+		}
+		writeHelp(os.Stdout, topic)
+	default:
+		return usageError("usage: ch help [-man] [name]")
+	}
+	return nil
+}
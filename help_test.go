@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestREADMEUsage(t *testing.T) {
+	readme, err := os.ReadFile("README.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const start = "## Usage\n\n```\n"
+	i := bytes.Index(readme, []byte(start))
+	if i < 0 {
+		t.Fatal("README has no usage block")
+	}
+	block := readme[i+len(start):]
+	block = block[:bytes.Index(block, []byte("```\n"))]
+
+	var usage bytes.Buffer
+	writeUsage(&usage)
+	if !bytes.Equal(block, usage.Bytes()) {
+		t.Errorf("README usage block differs from ch -help; regenerate it with \"ch -help\"")
+	}
+}
+
+func TestHelpTopics(t *testing.T) {
+	topics := append(subcommandTopics(), commandTopics()...)
+	for _, topic := range topics {
+		if topic.Summary == "" {
+			t.Errorf("Expected a summary for %s", topic.Name)
+		}
+		found, ok := findTopic(topic.Name)
+		if !ok || found.Name != topic.Name {
+			t.Errorf("Expected to find help for %s", topic.Name)
+		}
+	}
+	for _, cmd := range commands {
+		if _, ok := findTopic(cmd.name); !ok {
+			t.Errorf("Expected help for command %s", cmd.name)
+		}
+	}
+}
+
+func TestWriteHelp(t *testing.T) {
+	testCases := []struct {
+		name     string
+		expected []string
+	}{
+		{"attach", []string{"Usage: ch [flags] attach [flags] path...\n", "  --max-depth N\n", "Examples:\n"}},
+		{"serve", []string{"Usage: ch serve [flags]\n", "  -listen addr\n", "(default localhost:8377)"}},
+		{"paste", []string{"Usage: ch [flags] paste [flags]\n", "  --text\n"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			topic, ok := findTopic(tc.name)
+			if !ok {
+				t.Fatalf("No help for %s", tc.name)
+			}
+			var buf bytes.Buffer
+			writeHelp(&buf, topic)
+			for _, expected := range tc.expected {
+				if !strings.Contains(buf.String(), expected) {
+					t.Errorf("Expected help containing %q\n  Actual:\n%s", expected, buf.String())
+				}
+			}
+		})
+	}
+}
+
+func TestWriteMan(t *testing.T) {
+	var buf bytes.Buffer
+	writeMan(&buf)
+	man := buf.String()
+	for _, expected := range []string{
+		".TH CH 1 ",
+		".SH SUBCOMMANDS\n",
+		".SH COMMANDS\n",
+		`\fB\-\-max\-depth\fR \fIN\fR`,
+		`\fBself\-update\fR`,
+		".SH EXIT STATUS\n",
+	} {
+		if !strings.Contains(man, expected) {
+			t.Errorf("Expected man page containing %q", expected)
+		}
+	}
+	for _, line := range strings.Split(man, "\n") {
+		if strings.HasPrefix(line, "'") {
+			t.Errorf("Unescaped control character in %q", line)
+		}
+	}
+}
+
+func TestWrap(t *testing.T) {
+	testCases := []struct {
+		text     string
+		width    int
+		expected []string
+	}{
+		{"", 10, nil},
+		{"one two three", 7, []string{"one two", "three"}},
+		{"one two three", 80, []string{"one two three"}},
+		{"unbreakable-long-word x", 5, []string{"unbreakable-long-word", "x"}},
+	}
+	for _, tc := range testCases {
+		actual := wrap(tc.text, tc.width)
+		if strings.Join(actual, "|") != strings.Join(tc.expected, "|") {
+			t.Errorf("wrap(%q, %d)\nExpected: %q\n  Actual: %q", tc.text, tc.width, tc.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package main
+
+import (
+	"log"
+	"log/slog"
+	"os"
+)
+
+// setupLogging directs structured logs to stderr, or as JSON to logFile if
+// it is set. Verbosity 0 logs only warnings and errors, 1 (-v) adds each
+// subcommand's execution, and 2 (-vv) adds debugging detail. A log file
+// always gets at least the -v level. The returned function closes the log
+// file.
+func setupLogging(verbosity int, logFile string) (func() error, error) {
+	level := slog.LevelWarn
+	switch {
+	case verbosity >= 2:
+		level = slog.LevelDebug
+	case verbosity == 1:
+		level = slog.LevelInfo
+	}
+
+	closeLog := func() error { return nil }
+	var handler slog.Handler
+	if logFile != "" {
+		file, err := os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, err
+		}
+		closeLog = file.Close
+		handler = slog.NewJSONHandler(file, &slog.HandlerOptions{Level: min(level, slog.LevelInfo)})
+	} else {
+		handler = slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level})
+	}
+	setDefaultHandler(handler)
+	return closeLog, nil
+}
+
+// setDefaultHandler makes handler the default slog handler.
+func setDefaultHandler(handler slog.Handler) {
+	slog.SetDefault(slog.New(handler))
+
+	// slog.SetDefault reroutes the log package through the handler, at
+	// info level; keep fatal errors going straight to stderr regardless of
+	// verbosity.
+	log.SetOutput(os.Stderr)
+	log.SetFlags(log.LstdFlags)
+}
@@ -20,374 +20,781 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"log/slog"
+	"net/http"
 	"os"
-	"os/exec"
+	"os/signal"
 	"path/filepath"
+	"runtime"
 	"strings"
-
+	"time"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+	"github.com/eloquence-cloud/ch/chlib/llm"
+	"github.com/eloquence-cloud/ch/chlib/render"
+	"github.com/eloquence-cloud/ch/chlib/reply"
+	"github.com/eloquence-cloud/ch/chlib/script"
+	"github.com/eloquence-cloud/ch/chlib/subcmd"
+	"github.com/eloquence-cloud/ch/chlib/transport"
 	"golang.design/x/clipboard"
 )
 
-// Context represents the runtime context of the ch tool.
-// It encapsulates the temporary directory used for storing temporary files
-// and provides methods for managing the lifecycle of the context.
-//
-// The NewContext function should be used to create a new Context instance.
-// The returned Context should be cleaned up using the Cleanup method when
-// it is no longer needed, typically by deferring the call to Cleanup.
-//
-// Example usage:
-//
-//	ctx, err := NewContext()
-//	if err != nil {
-//	    // Handle error
-//	}
-//	defer ctx.Cleanup()
-//
-//	// Use the context for storing temporary files
-//	tempFile, err := ioutil.TempFile(ctx.TempDir, "example-")
-//	if err != nil {
-//	    // Handle error
-//	}
-//	// Perform operations with the temporary file
-//
-// The temporary directory associated with the Context is automatically
-// created when the Context is created using NewContext and is cleaned up
-// when the Cleanup method is called.
-type Context struct {
-	TempDir string
-}
-
-func NewContext() (Context, error) {
-	tempDir, err := os.MkdirTemp("", "ch-")
-	if err != nil {
-		return Context{}, fmt.Errorf("failed to create temporary directory: %v", err)
+func main() {
+	if _, err := setupLogging(0, ""); err != nil {
+		log.Fatal(err)
 	}
-	return Context{TempDir: tempDir}, nil
-}
-
-func (ctx *Context) Cleanup() error {
-	return os.RemoveAll(ctx.TempDir)
-}
-
-type markdownEntry interface {
-	// renderMarkdown returns the markdown representation of the entry.
-	// This should end with a single newline.
-	renderMarkdown() string
+	if len(os.Args) > 1 {
+		if cmd, ok := findCommand(os.Args[1]); ok {
+			if err := cmd.fn(os.Args[2:]); err != nil && !errors.Is(err, flag.ErrHelp) {
+				fail(fmt.Errorf("ch %s: %w", cmd.name, err))
+			}
+			return
+		}
+	}
+	runPipelineCommand("")
 }
 
-type messageEntry struct {
-	message string
-}
+// runPipelineCommand runs the subcommand pipeline as the command line
+// (os.Args) directs. With bundle, as "ch bundle" runs it, the named bundle
+// runs first, within its budget unless -budget is given.
+func runPipelineCommand(bundle string) {
+	copyToClipboard := flag.Bool("c", false, "Copy the generated markdown to the clipboard")
+	outputFile := flag.String("o", "", "Write the output to the specified file")
+	push := flag.Bool("push", false, "Push the output to browser extensions listening on ch serve")
+	send := flag.String("send", "", "Send the output to the configured `model` and print its reply")
+	replyOut := flag.String("reply-out", "", "Also write the reply of the -send model to this file")
+	force := flag.Bool("force", false, "With -c, copy output over the clipboard_limit without asking")
+	rich := flag.Bool("rich", false, "With -c, also copy an HTML rendering, for pasting into rich-text editors")
+	pasteInto := flag.Bool("paste-into-frontmost", false, "Copy the output, then paste it into the previously active window")
+	dedupeMode := flag.String("dedupe", entry.DedupeOff, "How to handle repeated files: off, drop, or stub")
+	metadata := flag.Bool("meta", false, "Show file metadata in attachment headers")
+	toc := flag.Bool("toc", false, "Prefix the output with a table of contents")
+	preamble := flag.Bool("preamble", false, "Prefix the output with an introduction saying what is attached and how it is delimited")
+	header := flag.Bool("header", false, "Prefix the output with the time, host, directory, git commit, and ch version")
+	detailsOver := flag.Int("details", 0, "Wrap attachments longer than N lines in <details>")
+	fencePath := flag.Bool("fence-path", false, "Put file paths in fence info strings")
+	fileIDs := flag.Bool("file-ids", false, "Tag attached files with IDs and content hashes, for ch apply")
+	replyFormat := flag.String("reply-format", "", "End the output with instructions to reply in a format ch apply reads: files or diff (implies -file-ids)")
+	budgetSize := flag.String("budget", "", "Trim output to at most this size (e.g. 100k-tokens)")
+	fit := flag.Bool("fit", false, "When the output is over its budget, choose entries to drop, truncate, or skeletonize instead of trimming automatically")
+	splitSize := flag.String("split", "", "Split output into parts of at most this size (e.g. 30k-tokens)")
+	format := flag.String("format", formatMarkdown, "Deliver the output as markdown, as messages: a JSON array of turns, as anthropic-json, or as launcher-json")
+	cacheBreakpoints := flag.Bool("cache-breakpoints", false, "With -format anthropic-json, mark attached files for prompt caching")
+	manifestFile := flag.String("manifest", "", "Write a JSON manifest describing the output to this file")
+	exportFile := flag.String("export", "", "Write the collected entries, with content, as JSON to this file")
+	reproducible := flag.Bool("reproducible", false, "Pin the run for ch verify: render without the cache, and record the ch version, directory, subcommands, and output hash in the -manifest")
+	configPath := flag.String("config", "", "Read settings from this config file")
+	watch := flag.Bool("watch", false, "Re-run whenever a referenced file changes")
+	workspaceName := flag.String("workspace", "", "Scope attach to the named workspace of a go.work, pnpm, or Cargo monorepo")
+	keepGoing := flag.Bool("keep-going", false, "Replace failed subcommands with placeholders instead of stopping")
+	verbose := flag.Bool("v", false, "Log each subcommand's execution, timing, and size")
+	veryVerbose := flag.Bool("vv", false, "Log debugging detail as well as -v")
+	jsonStatus := flag.Bool("json-status", false, "Print the result as a JSON object on stdout when done")
+	logFile := flag.String("log-file", "", "Write structured (JSON) logs to this file instead of stderr")
+	noCache := flag.Bool("no-cache", false, "Don't use or update the cache of rendered files")
+	proxy := flag.String("proxy", "", "Send HTTP requests through the proxy at this URL (http, https, socks5), or direct for none")
+	caCert := flag.String("ca-cert", "", "Trust the certificate authorities in this PEM file for HTTPS, as well as the system's")
+	clientCert := flag.String("client-cert", "", "Present the certificate in this PEM file to HTTPS servers that require one")
+	clientKey := flag.String("client-key", "", "Read the -client-cert certificate's private key from this PEM file")
+	insecureSkipVerify := flag.Bool("insecure-skip-verify", false, "Don't verify HTTPS servers' certificates (dangerous; for testing only)")
+	deadline := flag.Duration("deadline", 0, "Cancel subcommands still running after this long (e.g. 30s)")
+	session := flag.String("session", "", "Prefix the output with the named stored session's history, then add this run to it")
+	interactive := flag.Bool("i", false, "Build the output interactively, one line of subcommands at a time")
+	stdinDSL := flag.Bool("stdin-dsl", false, "Read the subcommands from stdin and write the output to stdout, without the clipboard or prompts, as editors' process filters need")
+	versionFlag := flag.Bool("version", false, "Show the version and build information")
+	helpFlag := flag.Bool("help", false, "Show usage information")
+	flag.Parse()
 
-func (e messageEntry) renderMarkdown() string {
-	return strings.TrimSpace(e.message) + "\n"
-}
+	if *helpFlag {
+		printUsage()
+		return
+	}
+	if *versionFlag {
+		fmt.Println(versionString())
+		return
+	}
 
-type fileEntry struct {
-	storagePath  string
-	originalPath string
-}
+	verbosity := 0
+	if *verbose {
+		verbosity = 1
+	}
+	if *veryVerbose {
+		verbosity = 2
+	}
+	closeLog, err := setupLogging(verbosity, *logFile)
+	if err != nil {
+		fail(subcmd.Errorf(subcmd.KindUsage, "Failed to open log file: %v", err))
+	}
+	defer closeLog()
 
-func (e fileEntry) renderMarkdown() string {
-	var markdown strings.Builder
+	if *stdinDSL {
+		if flag.NArg() > 0 || *copyToClipboard || *pasteInto || *outputFile != "" || *push || *send != "" || *interactive || *watch || *jsonStatus {
+			fail(usageError("-stdin-dsl writes to stdout, and cannot be combined with subcommands on the command line, -c, -o, -push, -send, -i, -watch, or -json-status"))
+		}
+		*outputFile = "-"
+	}
+	if *pasteInto {
+		if *splitSize != "" || *watch {
+			fail(usageError("-paste-into-frontmost cannot be combined with -split or -watch"))
+		}
+		*copyToClipboard = true
+	}
+	if !*copyToClipboard && *outputFile == "" && !*push && *send == "" && *exportFile == "" && !*interactive && *session == "" {
+		fail(usageError("One of -c, -o, -push, -send, -export, -i, or -session must be specified"))
+	}
+	if *rich {
+		if !*copyToClipboard || *splitSize != "" {
+			fail(usageError("-rich requires -c, and cannot be combined with -split"))
+		}
+		if _, err := richCopyCommand(runtime.GOOS); err != nil {
+			fail(usageError("%v", err))
+		}
+	}
+	if *push && *splitSize != "" {
+		fail(usageError("-push cannot be combined with -split"))
+	}
+	if *send != "" && (*splitSize != "" || *watch || *interactive) {
+		fail(usageError("-send cannot be combined with -split, -watch, or -i"))
+	}
+	if *replyOut != "" && *send == "" {
+		fail(usageError("-reply-out requires -send"))
+	}
+	if *send != "" && *outputFile == "-" {
+		fail(usageError("-send cannot be combined with -o -, since the reply is written to stdout"))
+	}
+	if *interactive && (*watch || *jsonStatus) {
+		fail(usageError("-i cannot be combined with -watch or -json-status"))
+	}
+	if *session != "" && (*interactive || *watch) {
+		fail(usageError("-session cannot be combined with -i or -watch"))
+	}
+	if *watch && *splitSize != "" {
+		fail(usageError("-watch cannot be combined with -split"))
+	}
+	switch *format {
+	case formatMarkdown:
+	case formatMessages, formatAnthropic, formatLauncher:
+		if *splitSize != "" {
+			fail(usageError("-format %s cannot be combined with -split", *format))
+		}
+	default:
+		fail(usageError("Invalid -format %q (expected markdown, messages, anthropic-json, or launcher-json)", *format))
+	}
+	if *cacheBreakpoints && *format != formatAnthropic {
+		fail(usageError("-cache-breakpoints requires -format anthropic-json"))
+	}
+	if *reproducible {
+		if *manifestFile == "" {
+			fail(usageError("-reproducible requires -manifest, where it records the run"))
+		}
+		if *header || *metadata || *fit {
+			fail(usageError("-reproducible cannot be combined with -header or -meta, which show when and where the output was made, or with -fit"))
+		}
+		*noCache = true
+	}
+	if *jsonStatus && *outputFile == "-" && !*copyToClipboard {
+		fail(usageError("-json-status cannot be combined with -o -, which also writes to stdout"))
+	}
 
-	markdown.WriteString(fmt.Sprintf("`%s`\n", e.originalPath))
-	markdown.WriteString("```\n")
+	var budgetLimit, splitLimit render.Limit
+	if *budgetSize != "" {
+		var err error
+		if budgetLimit, err = render.ParseLimit(*budgetSize); err != nil {
+			fail(usageError("Invalid -budget size: %v", err))
+		}
+	}
+	if *splitSize != "" {
+		var err error
+		if splitLimit, err = render.ParseLimit(*splitSize); err != nil {
+			fail(usageError("Invalid -split size: %v", err))
+		}
+	}
 
-	content, err := os.ReadFile(e.storagePath)
+	cfg, err := loadUserConfig(*configPath)
 	if err != nil {
-		log.Printf("Failed to read file %s: %v", e.storagePath, err)
-		return ""
+		fail(&subcmd.Error{Kind: subcmd.KindUsage, Err: err})
+	}
+	subcommands := flag.Args()
+	if *stdinDSL {
+		if subcommands, err = readSubcommands(os.Stdin); err != nil {
+			fail(err)
+		}
+	}
+	if bundle != "" {
+		b, ok := cfg.Bundles[bundle]
+		if !ok {
+			fail(usageError("Unknown bundle %q (ch bundle lists them)", bundle))
+		}
+		if *budgetSize == "" && b.Budget != "" {
+			*budgetSize = b.Budget
+			if budgetLimit, err = render.ParseLimit(b.Budget); err != nil {
+				fail(usageError("Invalid budget for bundle %q: %v", bundle, err))
+			}
+		}
+		if len(subcommands) > 0 {
+			subcommands = append([]string{","}, subcommands...)
+		}
+		subcommands = append([]string{"bundle", bundle}, subcommands...)
+	}
+	if *fit {
+		if *budgetSize == "" {
+			fail(usageError("-fit requires -budget, or a bundle with a budget"))
+		}
+		if *watch || *interactive || *stdinDSL {
+			fail(usageError("-fit cannot be combined with -watch, -i, or -stdin-dsl"))
+		}
+	}
+	var models []llm.Model
+	if *send != "" {
+		if models, err = cfg.modelChain(*send); err != nil {
+			fail(usageError("Invalid -send: %v", err))
+		}
+	}
+	var workspaceDir string
+	if *workspaceName != "" {
+		cwd, err := os.Getwd()
+		if err == nil {
+			workspaceDir, err = resolveWorkspace(cwd, *workspaceName)
+		}
+		if err != nil {
+			fail(usageError("Invalid -workspace: %v", err))
+		}
+	}
+	httpTransport, err := cfg.transport(transport.Options{
+		Proxy:              *proxy,
+		CACert:             *caCert,
+		ClientCert:         *clientCert,
+		ClientKey:          *clientKey,
+		InsecureSkipVerify: *insecureSkipVerify,
+	})
+	if err != nil {
+		fail(usageError("Invalid network settings: %v", err))
 	}
-	markdown.Write(content)
 
-	markdown.WriteString("```\n")
+	switch *dedupeMode {
+	case entry.DedupeOff, entry.DedupeDrop, entry.DedupeStub:
+	default:
+		fail(usageError("Invalid -dedupe mode %q (expected off, drop, or stub)", *dedupeMode))
+	}
+	var instructions entry.Entry
+	if *replyFormat != "" {
+		if instructions, err = replyInstructions(*replyFormat); err != nil {
+			fail(usageError("Invalid -reply-format %q (expected %s)", *replyFormat, strings.Join(reply.Formats, " or ")))
+		}
+		*fileIDs = true
+	}
 
-	return markdown.String()
-}
+	// -stdin-dsl runs where there may be no clipboard to read or write,
+	// such as under an editor on a server. Subcommands that read it
+	// initialize it themselves.
+	if !*stdinDSL {
+		if err := clipboard.Init(); err != nil {
+			fail(subcmd.Errorf(subcmd.KindOutput, "Failed to initialize clipboard: %v", err))
+		}
+	}
 
-type outputEntry struct {
-	output string
-}
+	scripts, err := script.Load(cfg.Scripts...)
+	if err != nil {
+		fail(&subcmd.Error{Kind: subcmd.KindUsage, Err: err})
+	}
+	scripts.RegisterSubcommands()
+
+	inv := &invocation{
+		subcommands:     subcommands,
+		copyToClipboard: *copyToClipboard,
+		outputFile:      *outputFile,
+		push:            *push,
+		send:            models,
+		replyOut:        *replyOut,
+		pasteInto:       *pasteInto,
+		rich:            *rich,
+		clipboardLimit:  cfg.clipboardLimit(),
+		force:           *force,
+		header:          *header,
+		dedupeMode:      *dedupeMode,
+		instructions:    instructions,
+		format:          *format,
+		cacheBreaks:     *cacheBreakpoints,
+		manifestFile:    *manifestFile,
+		reproducible:    *reproducible,
+		exportFile:      *exportFile,
+		session:         *session,
+		keepGoing:       *keepGoing,
+		pruneDirs:       cfg.PruneDirs,
+		pathAliases:     cfg.pathAliases(),
+		askTemplates:    cfg.Ask,
+		bundles:         cfg.bundleScripts(),
+		workspace:       workspaceDir,
+		network:         cfg.networkLimits(),
+		transport:       httpTransport,
+		deadline:        *deadline,
+		scripts:         scripts,
+		opts: entry.RenderOptions{
+			Metadata:    *metadata,
+			TOC:         *toc,
+			Preamble:    *preamble,
+			DetailsOver: *detailsOver,
+			FencePath:   *fencePath,
+			FileIDs:     *fileIDs,
+			Languages:   cfg.Languages,
+		},
+	}
+	if *jsonStatus {
+		inv.statusOut = os.Stdout
+		inv.warnings = recordWarnings()
+		messages = os.Stderr
+	}
+	if !*noCache {
+		inv.opts.Cache = openRenderCache(cfg)
+	}
+	if *budgetSize != "" {
+		inv.budget = &budgetLimit
+	}
+	if *fit {
+		inv.fitIn = os.Stdin
+	}
+	if *splitSize != "" {
+		inv.split = &splitLimit
+	}
 
-func (e outputEntry) renderMarkdown() string {
-	return strings.TrimSpace(e.output) + "\n"
+	if *interactive {
+		if err := replInvocation(inv, os.Stdin, os.Stdout); err != nil {
+			fail(err)
+		}
+		return
+	}
+	if *watch {
+		if err := watchInvocation(inv); err != nil {
+			fail(err)
+		}
+		return
+	}
+	if _, err := inv.run(context.Background()); err != nil {
+		fail(err)
+	}
 }
 
-type subcommand struct {
-	name string
-	fn   func(ctx Context, args []string) ([]markdownEntry, error)
+// invocation is a run of the subcommand pipeline, configured by the command
+// line.
+type invocation struct {
+	subcommands     []string
+	copyToClipboard bool
+	outputFile      string
+	push            bool
+	pasteInto       bool
+	rich            bool
+	clipboardLimit  render.Limit
+	force           bool
+	header          bool
+	dedupeMode      string
+	format          string
+	cacheBreaks     bool
+	opts            entry.RenderOptions
+	budget          *render.Limit
+	split           *render.Limit
+	manifestFile    string
+	exportFile      string
+	session         string
+	keepGoing       bool
+	pruneDirs       []string
+	pathAliases     []subcmd.PathAlias
+	askTemplates    map[string]string
+	bundles         map[string]string
+	workspace       string
+	network         subcmd.NetworkLimits
+	transport       http.RoundTripper
+	deadline        time.Duration
+	scripts         *script.Scripts
+
+	// fitIn, if set by -fit, is where the overflow assistant reads its
+	// commands when the output is over budget.
+	fitIn io.Reader
+
+	// With reproducible, set by -reproducible, the manifest records the
+	// run in a lock.
+	reproducible bool
+
+	// instructions, if set by -reply-format, end the output.
+	instructions entry.Entry
+
+	// send, if set by -send, is the chain of models to send the output
+	// to: the one named and its fallbacks. replyOut, set by -reply-out,
+	// receives the reply too.
+	send     []llm.Model
+	replyOut string
+
+	// statusOut, if set by -json-status, receives a resultStatus after
+	// each run: result, with the warnings logged during the run.
+	statusOut io.Writer
+	result    resultStatus
+	warnings  *warningLog
+
+	// With skipUnchanged, run doesn't deliver markdown identical to what
+	// it delivered last time (lastMarkdown).
+	skipUnchanged bool
+	lastMarkdown  *string
 }
 
-var subcommands = []subcommand{
-	{"say", saySub},
-	{"attach", attachSub},
-	{"insert", insertSub},
-	{"exec", execSub},
-	{"paste", pasteSub},
+// run processes the subcommands and delivers the output, returning the
+// entries the subcommands produced. With -json-status, it then prints the
+// run's status to inv.statusOut.
+func (inv *invocation) run(ctx context.Context) ([]entry.Entry, error) {
+	if inv.statusOut == nil {
+		return inv.runPipeline(ctx)
+	}
+	inv.result = resultStatus{}
+	inv.warnings.reset()
+	entries, err := inv.runPipeline(ctx)
+	inv.result.finish(err, inv.warnings.take())
+	if err := json.NewEncoder(inv.statusOut).Encode(inv.result); err != nil {
+		slog.Error("failed to write -json-status", "error", err)
+	}
+	return entries, err
 }
 
-//////////// processing of subcommands ///////////////
-
-func processSubcommands(ctx Context, args []string) ([]markdownEntry, error) {
-	var entries []markdownEntry
-	var accumCommand []string
-	for _, arg := range args {
-		arg = strings.TrimSpace(arg)
-		if strings.HasSuffix(arg, ",") {
-			argWithoutComma := strings.TrimSuffix(arg, ",")
-			if len(argWithoutComma) > 0 {
-				accumCommand = append(accumCommand, argWithoutComma)
-			}
-			subcommandEntries, err := executeSubcommand(ctx, accumCommand)
-			if err != nil {
-				return nil, fmt.Errorf("failed to execute subcommand %s: %v", accumCommand, err)
-			}
-			entries = append(entries, subcommandEntries...)
-			accumCommand = nil
-		} else {
-			accumCommand = append(accumCommand, arg)
-		}
+// runPipeline does the work of run. The subcommands are cancelled when
+// inv.deadline passes or on an interrupt (Ctrl-C), so that runPipeline can
+// still clean up after them.
+func (inv *invocation) runPipeline(ctx context.Context) ([]entry.Entry, error) {
+	if inv.deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, inv.deadline)
+		defer cancel()
 	}
-	if len(accumCommand) > 0 {
-		subcommandEntries, err := executeSubcommand(ctx, accumCommand)
-		if err != nil {
-			return nil, err
-		}
-		entries = append(entries, subcommandEntries...)
+
+	sc, err := subcmd.NewContext()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create context: %v", err)
+	}
+	defer sc.Cleanup()
+	sc.KeepGoing = inv.keepGoing
+	sc.PruneDirs = inv.pruneDirs
+	sc.PathAliases = inv.pathAliases
+	sc.AskTemplates = inv.askTemplates
+	sc.Bundles = inv.bundles
+	sc.Workspace = inv.workspace
+	sc.Network = subcmd.NewNetwork(inv.network, inv.transport)
+
+	interruptible, stop := signal.NotifyContext(ctx, os.Interrupt)
+	processed, err := subcmd.Process(interruptible, sc, inv.subcommands)
+	stop()
+	if errors.Is(err, context.DeadlineExceeded) {
+		return nil, fmt.Errorf("subcommands did not finish within -deadline %v", inv.deadline)
+	}
+	if errors.Is(err, context.Canceled) {
+		return nil, fmt.Errorf("interrupted")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to process subcommands: %w", err)
+	}
+	deliver := inv.deliver
+	if inv.session != "" {
+		deliver = inv.deliverSession
 	}
-	return entries, nil
+	if err := deliver(ctx, sc, processed); err != nil {
+		return nil, err
+	}
+	return processed, nil
 }
 
-func executeSubcommand(ctx Context, args []string) ([]markdownEntry, error) {
-	if len(args) == 0 {
-		return []markdownEntry{}, fmt.Errorf("no subcommand provided")
+// deliverSession delivers processed after the history of inv.session, and
+// then stores them together, followed by the reply of the -send model if
+// there is one, as the session's new history.
+func (inv *invocation) deliverSession(ctx context.Context, sc subcmd.Context, processed []entry.Entry) error {
+	sessions, err := defaultSessions()
+	if err != nil {
+		return fmt.Errorf("failed to locate sessions: %v", err)
 	}
-	command := args[0]
-	var matches []subcommand
-	for _, sub := range subcommands {
-		if strings.HasPrefix(sub.name, command) {
-			matches = append(matches, sub)
-		}
+	history, _, err := sessions.load(inv.session, sc.TempDir)
+	if err != nil {
+		return err
 	}
-	if len(matches) == 0 {
-		return []markdownEntry{}, fmt.Errorf("unknown subcommand: %s", command)
+	combined := append(history, processed...)
+	if err := inv.deliver(ctx, sc, combined); err != nil {
+		return err
 	}
-	if len(matches) > 1 {
-		return []markdownEntry{}, fmt.Errorf("ambiguous subcommand: %s", command)
+	if reply := inv.result.Reply; reply != nil {
+		combined = append(combined, entry.Turn{Role: "assistant"}, entry.Message{Text: reply.Text, Source: reply.Model})
 	}
-	return matches[0].fn(ctx, args[1:])
+	if err := sessions.save(inv.session, combined); err != nil {
+		return fmt.Errorf("failed to store session %q: %v", inv.session, err)
+	}
+	return nil
 }
 
-func saySub(ctx Context, args []string) ([]markdownEntry, error) {
-	message := strings.Join(args, " ")
-	return []markdownEntry{messageEntry{message: message}}, nil
-}
+// deliver dedupes and renders processed entries and delivers the output as
+// the flags direct. File contents changed by pre_render hooks are stored in
+// sc.TempDir.
+func (inv *invocation) deliver(ctx context.Context, sc subcmd.Context, processed []entry.Entry) error {
+	if failures := entry.CountFailures(processed); failures > 0 {
+		slog.Warn("kept going after failures; each is marked in the output", "failures", failures)
+	}
+	entries := entry.Dedupe(processed, inv.dedupeMode)
+	inv.result.Entries = len(entries)
 
-func attachSub(ctx Context, args []string) ([]markdownEntry, error) {
-	var entries []markdownEntry
-	for _, filePath := range args {
-		if strings.Contains(filePath, ":") {
-			parts := strings.SplitN(filePath, ":", 2)
-			if len(parts) == 2 {
-				hostname := parts[0]
-				remotePath := parts[1]
-				tempFile, originalPath, err := copyRemoteFileToTemp(ctx, hostname, remotePath)
-				if err != nil {
-					return nil, fmt.Errorf("failed to copy remote file: %v", err)
-				}
-				entries = append(entries, fileEntry{storagePath: tempFile, originalPath: originalPath})
-			} else {
-				return nil, fmt.Errorf("invalid remote file path: %v", filePath)
-			}
-		} else {
-			fileInfo, err := os.Stat(filePath)
-			if err != nil {
-				return nil, fmt.Errorf("file does not exist: %v", filePath)
-			}
-			if fileInfo.IsDir() {
-				err := filepath.Walk(filePath, func(path string, info os.FileInfo, err error) error {
-					if err != nil {
-						return err
-					}
-					if !info.IsDir() && !strings.HasPrefix(info.Name(), ".") {
-						entries = append(entries, fileEntry{storagePath: path, originalPath: path})
-					}
-					return nil
-				})
-				if err != nil {
-					return nil, fmt.Errorf("failed to process directory: %v", err)
-				}
-			} else {
-				entries = append(entries, fileEntry{storagePath: filePath, originalPath: filePath})
-			}
+	if inv.exportFile != "" {
+		list, err := entry.Export(entries)
+		if err != nil {
+			return fmt.Errorf("failed to export entries: %v", err)
+		}
+		if err := writeEntryList(list, inv.exportFile); err != nil {
+			return subcmd.Errorf(subcmd.KindOutput, "failed to write exported entries: %v", err)
+		}
+		if !inv.copyToClipboard && inv.outputFile == "" && !inv.push && inv.send == nil {
+			inv.result.Destination, inv.result.Path = "export", inv.exportFile
+			fmt.Fprintf(messages, "Entries exported to file: %s\n", inv.exportFile)
+			return nil
 		}
 	}
-	return entries, nil
-}
 
-func copyRemoteFileToTemp(ctx Context, hostname, remotePath string) (string, string, error) {
-	tempFile, err := os.CreateTemp(ctx.TempDir, "file-")
-	if err != nil {
-		return "", "", err
+	if inv.header {
+		inv.opts.Header = runHeader(time.Now())
+	}
+	if inv.instructions != nil {
+		entries = append(entries, inv.instructions)
 	}
-	tempFileName := tempFile.Name()
-	tempFile.Close()
 
-	cmd := exec.Command("scp", fmt.Sprintf("%s:%s", hostname, remotePath), tempFileName)
-	output, err := cmd.CombinedOutput()
+	entries, err := inv.scripts.PreRender(sc.TempDir, entries)
 	if err != nil {
-		return "", "", fmt.Errorf("failed to copy remote file: %v\nOutput: %s", err, string(output))
+		return fmt.Errorf("failed to run pre_render hooks: %v", err)
+	}
+	if inv.opts.FileIDs {
+		recordAttachedFiles(entries)
 	}
-	return tempFileName, fmt.Sprintf("%s:%s", hostname, remotePath), nil
-}
 
-func insertSub(ctx Context, args []string) ([]markdownEntry, error) {
-	var entries []markdownEntry
-	for _, filePath := range args {
-		if strings.Contains(filePath, ":") {
-			parts := strings.SplitN(filePath, ":", 2)
-			if len(parts) == 2 {
-				hostname := parts[0]
-				remotePath := parts[1]
-				tempFile, _, err := copyRemoteFileToTemp(ctx, hostname, remotePath)
-				if err != nil {
-					return nil, fmt.Errorf("failed to copy remote file: %v", err)
-				}
-				content, err := os.ReadFile(tempFile)
-				if err != nil {
-					return nil, fmt.Errorf("failed to read file: %v", err)
-				}
-				entries = append(entries, messageEntry{message: string(content)})
-			} else {
-				return nil, fmt.Errorf("invalid remote file path: %v", filePath)
-			}
-		} else {
-			content, err := os.ReadFile(filePath)
-			if err != nil {
-				return nil, fmt.Errorf("failed to read file: %v", err)
-			}
-			entries = append(entries, messageEntry{message: string(content)})
+	if inv.canStream() && entry.AttachedSize(entries) > streamThreshold {
+		return inv.streamOutput(entries)
+	}
+
+	chunks := render.Chunks(entries, inv.opts)
+	if inv.budget != nil && inv.fitIn != nil {
+		if entries, chunks, err = fitBudget(sc, entries, chunks, inv.opts, *inv.budget, inv.fitIn, os.Stderr); err != nil {
+			return err
+		}
+	}
+	if inv.budget != nil {
+		if chunks, err = render.EnforceBudget(chunks, *inv.budget); err != nil {
+			return fmt.Errorf("failed to fit the size budget: %v", err)
 		}
 	}
-	return entries, nil
-}
 
-func execSub(ctx Context, args []string) ([]markdownEntry, error) {
-	cmd := exec.Command(args[0], args[1:]...)
-	output, err := cmd.Output()
+	// With -format messages, anthropic-json, or launcher-json, the
+	// "markdown" delivered is JSON.
+	var markdown string
+	switch inv.format {
+	case formatMessages:
+		markdown, err = transcriptJSON(chunks, inv.scripts)
+	case formatAnthropic:
+		markdown, err = anthropicJSON(chunks, inv.scripts, inv.cacheBreaks)
+	case formatLauncher:
+		if markdown, err = inv.scripts.PostRender(render.Join(chunks)); err == nil {
+			markdown, err = launcherJSON(entries, markdown)
+		}
+	default:
+		markdown, err = inv.scripts.PostRender(render.Join(chunks))
+	}
 	if err != nil {
-		return []markdownEntry{}, fmt.Errorf("command execution failed: %v", err)
+		return fmt.Errorf("failed to run post_render hooks: %v", err)
 	}
-	return []markdownEntry{outputEntry{output: string(output)}}, nil
-}
 
-func pasteSub(ctx Context, args []string) ([]markdownEntry, error) {
-	content := string(clipboard.Read(clipboard.FmtText))
-	return []markdownEntry{messageEntry{message: content}}, nil
-}
+	inv.result.Bytes, inv.result.Tokens = len(markdown), render.ApproxTokens(markdown)
+	inv.result.Destination, inv.result.Path = destination(inv.copyToClipboard, inv.outputFile, inv.push)
+	if !inv.copyToClipboard && inv.outputFile == "" && !inv.push {
+		inv.result.Destination = "send"
+	}
 
-// generateMarkdown concatenates the markdown for entries with an extra newline of separation.
-// It returns a string with no whitespace at the front and exactly one newline at the end.
-// If entries is empty, it returns "\n".
-func generateMarkdown(entries []markdownEntry) string {
-	var markdown strings.Builder
+	if inv.manifestFile != "" {
+		m, err := buildManifest(entries, inv.opts, markdown)
+		if err != nil {
+			return fmt.Errorf("failed to build manifest: %v", err)
+		}
+		if inv.reproducible {
+			if m.Lock, err = newManifestLock(inv.subcommands, markdown); err != nil {
+				return fmt.Errorf("failed to build manifest: %v", err)
+			}
+		}
+		if err := writeManifest(m, inv.manifestFile); err != nil {
+			return subcmd.Errorf(subcmd.KindOutput, "failed to write manifest: %v", err)
+		}
+	}
 
-	for _, entry := range entries {
-		markdown.WriteString(entry.renderMarkdown())
-		// renderMarkdown is specified to return a string ending with a newline.
-		// Add a newline as a paragraph break.
-		markdown.WriteString("\n")
+	if inv.split != nil {
+		parts, err := render.Split(chunks, *inv.split)
+		if err != nil {
+			return fmt.Errorf("failed to split output: %v", err)
+		}
+		if len(parts) > 1 {
+			for i := range parts {
+				if parts[i], err = inv.scripts.PostRender(parts[i]); err != nil {
+					return fmt.Errorf("failed to run post_render hooks: %v", err)
+				}
+			}
+			writeParts(ctx, parts, inv.copyToClipboard, inv.outputFile)
+			inv.result.Parts = len(parts)
+			return nil
+		}
 	}
 
-	return strings.TrimSpace(markdown.String()) + "\n"
+	if inv.skipUnchanged && inv.lastMarkdown != nil && *inv.lastMarkdown == markdown {
+		return nil
+	}
+	inv.lastMarkdown = &markdown
+	slog.Info("rendered output", "entries", len(entries), "bytes", len(markdown), "tokens", inv.result.Tokens)
+	if inv.copyToClipboard && !inv.force && inv.clipboardLimit.Amount > 0 {
+		if err := checkClipboardSize(markdown, inv.clipboardLimit, askTerminal(os.Stdin)); err != nil {
+			return err
+		}
+	}
+	if inv.copyToClipboard && inv.rich {
+		if err := writeRichClipboard(markdown, runtime.GOOS); err != nil {
+			return err
+		}
+		fmt.Fprintln(messages, "Markdown copied to the clipboard, with an HTML rendering.")
+		if inv.pasteInto {
+			if err := pasteIntoFrontmost(); err != nil {
+				return err
+			}
+		}
+	} else if inv.copyToClipboard || inv.outputFile != "" {
+		if err := writeOutput(ctx, markdown, inv.copyToClipboard, inv.outputFile); err != nil {
+			return err
+		}
+		if inv.copyToClipboard && inv.pasteInto {
+			if err := pasteIntoFrontmost(); err != nil {
+				return err
+			}
+		}
+	}
+	if inv.push {
+		if err := pushMarkdown(markdown, inv.transport); err != nil {
+			return err
+		}
+	}
+	if inv.send != nil {
+		return inv.sendOutput(markdown, chunks)
+	}
+	return nil
 }
 
-//////////// main ///////////////
-
-func printUsage() {
-	fmt.Println("ch - A tool for constructing chat messages for easy pasting into AI chat UIs.")
-	fmt.Println()
-	fmt.Println("ch allows you to combine messages, file contents, and command outputs into a")
-	fmt.Println("formatted markdown suitable for AI chat interactions. It provides a flexible")
-	fmt.Println("and extensible syntax for creating chat messages with ease.")
-	fmt.Println()
-	fmt.Println("Usage: ch [flags] subcommand [, subcommand ...]")
-	fmt.Println()
-	fmt.Println("Flags (one of -c or -o is required):")
-	fmt.Println("  -c           Copy the generated markdown to the clipboard")
-	fmt.Println("  -o file      Write the output to the specified file (overwriting).")
-	fmt.Println("  -o -         Write the output to stdout.")
-	fmt.Println()
-	fmt.Println("Subcommands:")
-	fmt.Println("  say message       Emit a message (replace @<space>)")
-	fmt.Println("  attach path       Attach a file or directory of files (replace bare path)")
-	fmt.Println("                    Supports remote file paths prefixed with hostname (e.g., host:path/to/file)")
-	fmt.Println("  insert file       Insert the contents of a file (replace @file)")
-	fmt.Println("                    Supports remote file paths prefixed with hostname (e.g., host:path/to/file)")
-	fmt.Println("  exec command      Execute a command (pass command line to bash)")
-	fmt.Println("  paste             Insert the contents of the clipboard")
-	fmt.Println()
-	fmt.Println("Comma separation rules:")
-	fmt.Println("  - A comma at the end of a word ends that command and is not included in the word.")
-	fmt.Println("  - A comma alone in a word ends that command and is not included as a word.")
-	fmt.Println("  - A comma within a word is just part of that word.")
-	fmt.Println()
-	fmt.Println("Examples:")
-	fmt.Println("  ch -c say \"Please review\", attach file1.go, say \"Thank you!\"")
-	fmt.Println("  ch -o output.md say \"Here are the changes:\", insert changes.txt, attach src/")
-	fmt.Println("  ch -c exec \"ls -l\", say \"Directory listing:\", attach .")
-	fmt.Println("  ch -c attach remote-host:/path/to/file.txt, say \"Remote file attached.\"")
-	fmt.Println("  ch -c insert remote-host:/path/to/file.txt, say \"Contents of remote file:\"")
+// streamThreshold is the total size of attached files above which output
+// is streamed, when it can be. Below it, rendering in memory is cheap and
+// lets files be read concurrently.
+var streamThreshold int64 = 64 << 20
+
+// canStream reports whether the output can be written to -o as it is
+// rendered: it goes only to a local file or stdout, not to a model or a
+// remote machine, and nothing (a budget, splitting,
+// a manifest, post_render hooks, or -watch's comparison with the last
+// output) needs the whole markdown in hand, and it is markdown rather than
+// JSON.
+func (inv *invocation) canStream() bool {
+	_, _, remote := splitRemote(inv.outputFile)
+	return !inv.copyToClipboard && inv.outputFile != "" && !remote && !inv.push && inv.send == nil && inv.budget == nil && inv.split == nil &&
+		inv.manifestFile == "" && !inv.skipUnchanged && !inv.scripts.HasPostRender() && inv.format == formatMarkdown
 }
 
-func main() {
-	copyToClipboard := flag.Bool("c", false, "Copy the generated markdown to the clipboard")
-	outputFile := flag.String("o", "", "Write the output to the specified file")
-	helpFlag := flag.Bool("help", false, "Show usage information")
-	flag.Parse()
-
-	if *helpFlag {
-		printUsage()
-		return
+// streamOutput writes the markdown for entries to -o as it is rendered,
+// without holding it all in memory.
+func (inv *invocation) streamOutput(entries []entry.Entry) error {
+	var out io.Writer = os.Stdout
+	var file *os.File
+	if inv.outputFile != "-" {
+		var err error
+		if file, err = os.Create(inv.outputFile); err != nil {
+			return subcmd.Errorf(subcmd.KindOutput, "failed to write output to file: %v", err)
+		}
+		defer file.Close()
+		out = file
 	}
-
-	if !*copyToClipboard && *outputFile == "" {
-		log.Fatal("Either -c or -o must be specified")
+	buffered := bufio.NewWriter(out)
+	counter := &countingWriter{w: buffered}
+	if err := render.Write(counter, entries, inv.opts); err != nil {
+		return subcmd.Errorf(subcmd.KindOutput, "failed to write output: %v", err)
 	}
-
-	if err := clipboard.Init(); err != nil {
-		log.Fatalf("Failed to initialize clipboard: %v", err)
+	if err := buffered.Flush(); err != nil {
+		return subcmd.Errorf(subcmd.KindOutput, "failed to write output: %v", err)
 	}
-
-	ctx, err := NewContext()
-	if err != nil {
-		log.Fatalf("Failed to create context: %v", err)
+	if file != nil {
+		if err := file.Close(); err != nil {
+			return subcmd.Errorf(subcmd.KindOutput, "failed to write output to file: %v", err)
+		}
 	}
-	defer ctx.Cleanup()
 
-	subcommands := flag.Args()
-	entries, err := processSubcommands(ctx, subcommands)
-	if err != nil {
-		log.Fatalf("Failed to process subcommands: %v", err)
+	inv.result.Bytes, inv.result.Tokens = int(counter.n), render.ApproxTokensForSize(counter.n)
+	inv.result.Destination, inv.result.Path = destination(false, inv.outputFile, false)
+	slog.Info("streamed output", "entries", len(entries), "bytes", counter.n, "tokens", inv.result.Tokens)
+	if file != nil {
+		fmt.Fprintf(messages, "Markdown written to file: %s\n", inv.outputFile)
 	}
+	return nil
+}
 
-	markdown := generateMarkdown(entries)
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
 
-	if *copyToClipboard {
-		clipboard.Write(clipboard.FmtText, []byte(markdown))
-		fmt.Println("Markdown copied to the clipboard.")
-	} else if *outputFile == "-" {
-		fmt.Print(markdown)
-	} else {
-		if err := os.WriteFile(*outputFile, []byte(markdown), 0644); err != nil {
-			log.Printf("Failed to write output to file: %v", err)
-		} else {
-			fmt.Printf("Markdown written to file: %s\n", *outputFile)
+// writeParts delivers the parts of a split output. With -o file, part i is
+// written to file-i (before the extension); with -o -, the parts are printed
+// in order; with -c, the parts are copied one at a time, waiting for Enter
+// before replacing the clipboard with the next part.
+func writeParts(ctx context.Context, parts []string, copyToClipboard bool, outputFile string) {
+	switch {
+	case copyToClipboard:
+		input := bufio.NewReader(os.Stdin)
+		for i, part := range parts {
+			clipboard.Write(clipboard.FmtText, []byte(part))
+			recordClip(part)
+			if i == len(parts)-1 {
+				fmt.Fprintf(messages, "Part %d of %d copied to the clipboard.\n", i+1, len(parts))
+				break
+			}
+			fmt.Fprintf(messages, "Part %d of %d copied to the clipboard. Press Enter to copy the next part...", i+1, len(parts))
+			if _, err := input.ReadString('\n'); err != nil {
+				fmt.Fprintln(messages)
+				fail(subcmd.Errorf(subcmd.KindOutput, "Stopped before part %d: %v", i+2, err))
+			}
+		}
+	case outputFile == "-":
+		for i, part := range parts {
+			if i > 0 {
+				fmt.Println()
+			}
+			fmt.Print(part)
+		}
+	default:
+		ext := filepath.Ext(outputFile)
+		base := strings.TrimSuffix(outputFile, ext)
+		for i, part := range parts {
+			partFile := fmt.Sprintf("%s-%d%s", base, i+1, ext)
+			remote, err := writeFile(ctx, partFile, []byte(part))
+			if err != nil {
+				kind := subcmd.KindOutput
+				if subcmd.KindOf(err) == subcmd.KindRemote {
+					kind = subcmd.KindRemote
+				}
+				fail(subcmd.Errorf(kind, "Failed to write part %d to file: %v", i+1, err))
+			}
+			if remote {
+				fmt.Fprintf(messages, "Part %d of %d uploaded to: %s\n", i+1, len(parts), partFile)
+				continue
+			}
+			fmt.Fprintf(messages, "Part %d of %d written to file: %s\n", i+1, len(parts), partFile)
 		}
 	}
 }
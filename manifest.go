@@ -0,0 +1,182 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+	"github.com/eloquence-cloud/ch/chlib/render"
+)
+
+// manifest describes a generated output for downstream tooling: what each
+// entry is, where it came from, how big it is, and a hash of its content.
+type manifest struct {
+	// SchemaVersion is entry.SchemaVersion, since the manifest describes
+	// entries in the terms of the entry list.
+	SchemaVersion int `json:"schemaVersion"`
+
+	Entries []manifestEntry `json:"entries"`
+	// Output gives the size of the markdown actually delivered, after any
+	// budget trimming.
+	Output manifestCounts `json:"output"`
+	// Lock, written with -reproducible, pins the run that made the output.
+	Lock *manifestLock `json:"lock,omitempty"`
+}
+
+// manifestLock records what a -reproducible run needs to be checked and
+// repeated: the ch that ran, where, the subcommands it ran, and a hash of
+// the output, which is the same as long as the entries' content is.
+type manifestLock struct {
+	Version string `json:"version"`
+	// WorkDir is the working directory, against which relative paths in
+	// the entries' sources resolve.
+	WorkDir     string   `json:"workDir"`
+	Subcommands []string `json:"subcommands"`
+	// SHA256 is the hex SHA-256 of the markdown delivered.
+	SHA256 string `json:"sha256"`
+}
+
+// newManifestLock returns the lock of a -reproducible run of subcommands
+// that delivered markdown.
+func newManifestLock(subcommands []string, markdown string) (*manifestLock, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256([]byte(markdown))
+	return &manifestLock{
+		Version:     buildVersion(),
+		WorkDir:     dir,
+		Subcommands: append([]string{}, subcommands...),
+		SHA256:      hex.EncodeToString(sum[:]),
+	}, nil
+}
+
+type manifestEntry struct {
+	// Type is "message", "file", "output", "duplicate", "diff", or "failure".
+	Type string `json:"type"`
+	// Source is the file path (possibly host:path) for files and inserted
+	// messages, "clipboard" for pasted messages, the command line for
+	// command output, or the files compared for diffs.
+	Source string `json:"source,omitempty"`
+	// Label is the name a file is shown under, if not its path.
+	Label string `json:"label,omitempty"`
+	// ID is a local file's ID, given with -file-ids.
+	ID       string `json:"id,omitempty"`
+	Priority string `json:"priority,omitempty"`
+	// Counts measure the entry's rendered markdown.
+	manifestCounts
+	// SHA256 is the hex SHA-256 of the entry's content: the file's bytes,
+	// the message text, the command output, or the diff.
+	SHA256 string `json:"sha256"`
+	// SourceSHA256 is the hex SHA-256 of a local file's bytes on disk,
+	// which differ from its content when ch converted or sliced it, as for
+	// HTML pages or tail. Files that aren't on disk, such as stored ones,
+	// have none.
+	SourceSHA256 string `json:"sourceSha256,omitempty"`
+}
+
+type manifestCounts struct {
+	Bytes  int `json:"bytes"`
+	Lines  int `json:"lines"`
+	Tokens int `json:"tokens"`
+}
+
+func countsOf(markdown string) manifestCounts {
+	return manifestCounts{
+		Bytes:  len(markdown),
+		Lines:  entry.CountLines([]byte(markdown)),
+		Tokens: render.ApproxTokens(markdown),
+	}
+}
+
+// buildManifest describes entries as rendered with opts, and the final
+// markdown that was delivered.
+func buildManifest(entries []entry.Entry, opts entry.RenderOptions, markdown string) (manifest, error) {
+	m := manifest{SchemaVersion: entry.SchemaVersion, Entries: []manifestEntry{}, Output: countsOf(markdown)}
+	for _, e := range entries {
+		me := manifestEntry{manifestCounts: countsOf(e.RenderMarkdown(opts))}
+		if p := entry.PriorityOf(e); p != entry.PriorityNormal {
+			me.Priority = p.String()
+		}
+		var content []byte
+		switch e := entry.Unwrap(e).(type) {
+		case entry.Message:
+			me.Type, me.Source, content = "message", e.Source, []byte(e.Text)
+		case entry.File:
+			me.Type, me.Source, me.Label = "file", e.OriginalPath, e.Label
+			if opts.FileIDs {
+				me.ID = e.ID()
+			}
+			var err error
+			if content, err = os.ReadFile(e.StoragePath); err != nil {
+				return manifest{}, fmt.Errorf("failed to read file %s: %v", e.OriginalPath, err)
+			}
+			if me.SourceSHA256, err = sourceSHA256(e); err != nil {
+				return manifest{}, err
+			}
+		case entry.Duplicate:
+			me.Type, me.Source = "duplicate", e.OriginalPath
+		case entry.Output:
+			me.Type, me.Source, content = "output", e.Command, []byte(e.Output)
+		case entry.Diff:
+			me.Type, me.Source, content = "diff", e.Path, []byte(e.Diff)
+		case entry.Failure:
+			me.Type, me.Source, content = "failure", e.Command, []byte(e.Error)
+		case entry.Turn:
+			me.Type, me.Source = "turn", e.Role
+		default:
+			return manifest{}, fmt.Errorf("unsupported entry type %T", e)
+		}
+		sum := sha256.Sum256(content)
+		me.SHA256 = hex.EncodeToString(sum[:])
+		m.Entries = append(m.Entries, me)
+	}
+	return m, nil
+}
+
+// sourceSHA256 returns the hex SHA-256 of the bytes on disk at file's
+// original path, or "" if there is no regular file there, as for files on
+// other machines (host:path) or stored from an API.
+func sourceSHA256(file entry.File) (string, error) {
+	if info, err := os.Stat(file.OriginalPath); err != nil || !info.Mode().IsRegular() {
+		return "", nil
+	}
+	content, err := os.ReadFile(file.OriginalPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read file %s: %v", file.OriginalPath, err)
+	}
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// writeManifest writes m as indented JSON to manifestPath.
+func writeManifest(m manifest, manifestPath string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(manifestPath, append(data, '\n'), 0644)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+	"github.com/eloquence-cloud/ch/chlib/render"
+)
+
+func TestBuildManifest(t *testing.T) {
+	dir := t.TempDir()
+	fileWithContentPath := filepath.Join(dir, "file.txt")
+	if err := os.WriteFile(fileWithContentPath, []byte("File content\n"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	entries := []entry.Entry{
+		entry.Message{Text: "Hello"},
+		entry.Prioritized{Entry: entry.File{StoragePath: fileWithContentPath, OriginalPath: fileWithContentPath}, Priority: entry.PriorityHigh},
+		entry.Output{Output: "ok\n", Command: "echo ok"},
+	}
+	opts := entry.RenderOptions{}
+	markdown := render.Markdown(entries, opts)
+
+	m, err := buildManifest(entries, opts, markdown)
+	if err != nil {
+		t.Fatalf("buildManifest failed: %v", err)
+	}
+
+	hash := func(s string) string {
+		sum := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(sum[:])
+	}
+	fileMarkdown := "`" + fileWithContentPath + "`\n```\nFile content\n```\n"
+	expected := manifest{
+		SchemaVersion: entry.SchemaVersion,
+		Entries: []manifestEntry{
+			{Type: "message", manifestCounts: manifestCounts{Bytes: 6, Lines: 1, Tokens: 2}, SHA256: hash("Hello")},
+			{Type: "file", Source: fileWithContentPath, Priority: "high", manifestCounts: countsOf(fileMarkdown), SHA256: hash("File content\n"), SourceSHA256: hash("File content\n")},
+			{Type: "output", Source: "echo ok", manifestCounts: manifestCounts{Bytes: 3, Lines: 1, Tokens: 1}, SHA256: hash("ok\n")},
+		},
+		Output: countsOf(markdown),
+	}
+	if !reflect.DeepEqual(m, expected) {
+		t.Errorf("Unexpected manifest.\nExpected: %+v\n  Actual: %+v", expected, m)
+	}
+
+	manifestPath := filepath.Join(dir, "manifest.json")
+	if err := writeManifest(m, manifestPath); err != nil {
+		t.Fatalf("writeManifest failed: %v", err)
+	}
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		t.Fatalf("Failed to read manifest: %v", err)
+	}
+	var decoded map[string]any
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Manifest is not valid JSON: %v", err)
+	}
+	first := decoded["entries"].([]any)[0].(map[string]any)
+	if first["type"] != "message" || first["bytes"] != 6.0 || first["sha256"] != hash("Hello") {
+		t.Errorf("Unexpected JSON for the first entry: %v", first)
+	}
+}
+
+func TestBuildManifestFileIDs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file.txt")
+	if err := os.WriteFile(path, []byte("File content\n"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	entries := []entry.Entry{
+		entry.File{StoragePath: path, OriginalPath: path},
+		entry.File{StoragePath: path, OriginalPath: "host:file.txt"},
+	}
+	opts := entry.RenderOptions{FileIDs: true}
+	m, err := buildManifest(entries, opts, render.Markdown(entries, opts))
+	if err != nil {
+		t.Fatalf("buildManifest failed: %v", err)
+	}
+	if m.Entries[0].ID != entry.FileID(path) || m.Entries[1].ID != "" {
+		t.Errorf("Expected IDs %q and \"\"\n  Actual %q and %q", entry.FileID(path), m.Entries[0].ID, m.Entries[1].ID)
+	}
+}
+
+func TestNewManifestLock(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte("# Notes\n"))
+	testCases := []struct {
+		name        string
+		subcommands []string
+		expected    []string
+	}{
+		{name: "No subcommands", expected: []string{}},
+		{name: "Subcommands", subcommands: []string{"attach", "main.go,", "say", "Why?"}, expected: []string{"attach", "main.go,", "say", "Why?"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			lock, err := newManifestLock(tc.subcommands, "# Notes\n")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			expected := &manifestLock{Version: buildVersion(), WorkDir: cwd, Subcommands: tc.expected, SHA256: hex.EncodeToString(sum[:])}
+			if !reflect.DeepEqual(lock, expected) {
+				t.Errorf("Expected %+v\n  Actual %+v", expected, lock)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+	"github.com/eloquence-cloud/ch/chlib/render"
+	"github.com/eloquence-cloud/ch/chlib/subcmd"
+)
+
+// mergeCommand implements "ch merge file...": it concatenates previously
+// generated outputs, separated by horizontal rules. When the same file is
+// attached in more than one place, only its last occurrence is kept, since
+// later inputs are usually fresher.
+func mergeCommand(args []string) error {
+	flags := newCommandFlags("merge")
+	output := addOutputFlags(flags)
+	inputs, err := parseInterspersed(flags, args)
+	if err != nil {
+		return err
+	}
+	if err := output.validate(); err != nil {
+		return err
+	}
+	if len(inputs) == 0 {
+		return subcmd.Errorf(subcmd.KindUsage, "usage: ch merge file... (-c | -o file)")
+	}
+
+	ctx, err := subcmd.NewContext()
+	if err != nil {
+		return err
+	}
+	defer ctx.Cleanup()
+
+	var entries []entry.Entry
+	for i, input := range inputs {
+		content, err := os.ReadFile(input)
+		if err != nil {
+			return subcmd.Errorf(subcmd.KindMissingFile, "failed to read %s: %v", input, err)
+		}
+		parsed, err := render.Parse(ctx.TempDir, string(content), input)
+		if err != nil {
+			return fmt.Errorf("failed to parse %s: %v", input, err)
+		}
+		if i > 0 && len(parsed) > 0 && len(entries) > 0 {
+			entries = append(entries, entry.Message{Text: "---"})
+		}
+		entries = append(entries, parsed...)
+	}
+
+	return output.write(render.Markdown(keepLastFiles(entries), entry.RenderOptions{}))
+}
+
+// keepLastFiles removes every file entry (and duplicate stub) that is
+// followed later by another file entry with the same path.
+func keepLastFiles(entries []entry.Entry) []entry.Entry {
+	last := make(map[string]int)
+	for i, e := range entries {
+		if file, ok := e.(entry.File); ok {
+			last[file.OriginalPath] = i
+		}
+	}
+	var result []entry.Entry
+	for i, e := range entries {
+		switch e := e.(type) {
+		case entry.File:
+			if last[e.OriginalPath] != i {
+				continue
+			}
+		case entry.Duplicate:
+			if _, ok := last[e.OriginalPath]; ok {
+				continue
+			}
+		}
+		result = append(result, e)
+	}
+	return result
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+)
+
+func TestKeepLastFiles(t *testing.T) {
+	entries := []entry.Entry{
+		entry.File{StoragePath: "/tmp/1", OriginalPath: "a.go"},
+		entry.Message{Text: "---"},
+		entry.Duplicate{OriginalPath: "a.go"},
+		entry.Duplicate{OriginalPath: "gone.go"},
+		entry.File{StoragePath: "/tmp/2", OriginalPath: "b.go"},
+		entry.File{StoragePath: "/tmp/3", OriginalPath: "a.go"},
+	}
+	expected := []entry.Entry{
+		entry.Message{Text: "---"},
+		entry.Duplicate{OriginalPath: "gone.go"},
+		entry.File{StoragePath: "/tmp/2", OriginalPath: "b.go"},
+		entry.File{StoragePath: "/tmp/3", OriginalPath: "a.go"},
+	}
+	if actual := keepLastFiles(entries); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected %v\n  Actual %v", expected, actual)
+	}
+}
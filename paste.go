@@ -0,0 +1,75 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/eloquence-cloud/ch/chlib/subcmd"
+)
+
+// pasteScript is the AppleScript that -paste-into-frontmost runs on macOS:
+// Cmd-Tab back to the previously active application, then Cmd-V.
+const pasteScript = `tell application "System Events"
+	keystroke tab using command down
+	delay 0.3
+	keystroke "v" using command down
+end tell`
+
+// pasteCommand returns the command line that switches to the previously
+// active window and pastes into it, on goos with the given environment and
+// installed programs.
+func pasteCommand(goos string, getenv func(string) string, lookPath func(string) (string, error)) ([]string, error) {
+	switch goos {
+	case "darwin":
+		return []string{"osascript", "-e", pasteScript}, nil
+	case "linux", "freebsd", "openbsd", "netbsd":
+		if getenv("DISPLAY") == "" {
+			return nil, fmt.Errorf("-paste-into-frontmost needs an X11 display; Wayland sessions aren't supported")
+		}
+		if _, err := lookPath("xdotool"); err != nil {
+			return nil, fmt.Errorf("-paste-into-frontmost needs xdotool, which isn't installed")
+		}
+		return []string{"xdotool", "key", "--clearmodifiers", "alt+Tab", "sleep", "0.3", "key", "--clearmodifiers", "ctrl+v"}, nil
+	default:
+		return nil, fmt.Errorf("-paste-into-frontmost isn't supported on %s", goos)
+	}
+}
+
+// pasteIntoFrontmost switches from the terminal to the window that was
+// active before it, such as a browser showing a chat, and pastes the
+// clipboard there, sparing the user the switch and the paste. On macOS, the
+// terminal needs permission to control the computer (Accessibility).
+func pasteIntoFrontmost() error {
+	args, err := pasteCommand(runtime.GOOS, os.Getenv, exec.LookPath)
+	if err != nil {
+		return subcmd.Errorf(subcmd.KindOutput, "%v", err)
+	}
+	output, err := exec.Command(args[0], args[1:]...).CombinedOutput()
+	if err != nil {
+		return subcmd.Errorf(subcmd.KindOutput, "failed to paste into the previous window: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	fmt.Fprintln(messages, "Pasted into the previously active window.")
+	return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestPasteCommand(t *testing.T) {
+	x11 := func(name string) string {
+		if name == "DISPLAY" {
+			return ":0"
+		}
+		return ""
+	}
+	wayland := func(name string) string {
+		if name == "WAYLAND_DISPLAY" {
+			return "wayland-0"
+		}
+		return ""
+	}
+	installed := func(name string) (string, error) { return "/usr/bin/" + name, nil }
+	missing := func(string) (string, error) { return "", errors.New("not found") }
+
+	tests := []struct {
+		name     string
+		goos     string
+		getenv   func(string) string
+		lookPath func(string) (string, error)
+		paste    string
+		err      string
+	}{
+		{"macOS", "darwin", wayland, missing, `keystroke "v" using command down`, ""},
+		{"X11", "linux", x11, installed, "ctrl+v", ""},
+		{"Wayland", "linux", wayland, installed, "", "X11 display"},
+		{"no xdotool", "linux", x11, missing, "", "needs xdotool"},
+		{"Windows", "windows", x11, installed, "", "isn't supported on windows"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, err := pasteCommand(tt.goos, tt.getenv, tt.lookPath)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("Expected error containing %q\n  Actual %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !slices.ContainsFunc(args, func(arg string) bool { return strings.Contains(arg, tt.paste) }) {
+				t.Errorf("Expected %q in the command\n  Actual %q", tt.paste, args)
+			}
+		})
+	}
+}
@@ -0,0 +1,331 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strings"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+	"github.com/eloquence-cloud/ch/chlib/render"
+	"github.com/eloquence-cloud/ch/chlib/reply"
+	"github.com/eloquence-cloud/ch/chlib/script"
+)
+
+// openRenderCache opens the render cache in the cache directory, keeping
+// it within the configured cache_limit. The cache only saves time, so if it
+// can't be opened, ch warns and carries on without it.
+func openRenderCache(cfg config) *entry.Cache {
+	dir, err := cacheDir()
+	if err == nil {
+		var cache *entry.Cache
+		if cache, err = entry.OpenCache(filepath.Join(dir, "render"), cfg.cacheLimit()); err == nil {
+			return cache
+		}
+	}
+	slog.Warn("rendering without a cache", "error", err)
+	return nil
+}
+
+// The output formats of -format: markdown, the JSON of the transcript's
+// turns (see render.Transcript), the body of a request to Anthropic's
+// Messages API, or an item for a launcher's script command.
+const (
+	formatMarkdown  = "markdown"
+	formatMessages  = "messages"
+	formatAnthropic = "anthropic-json"
+	formatLauncher  = "launcher-json"
+)
+
+// transcriptTurns groups chunks into the turns of their transcript, running
+// the post_render hooks on the content of each.
+func transcriptTurns(chunks []render.Chunk, scripts *script.Scripts) ([]render.Turn, error) {
+	turns := render.Transcript(chunks)
+	for i := range turns {
+		content, err := scripts.PostRender(turns[i].Content + "\n")
+		if err != nil {
+			return nil, err
+		}
+		turns[i].Content = strings.TrimSuffix(content, "\n")
+	}
+	return turns, nil
+}
+
+// transcriptJSON returns the output of -format messages for chunks: the
+// turns of their transcript as an indented JSON array.
+func transcriptJSON(chunks []render.Chunk, scripts *script.Scripts) (string, error) {
+	turns, err := transcriptTurns(chunks, scripts)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.MarshalIndent(turns, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data) + "\n", nil
+}
+
+// maxCacheBreakpoints is how many cache_control markers the Messages API
+// accepts in a request.
+const maxCacheBreakpoints = 4
+
+// anthropicRequest is the output of -format anthropic-json: the system
+// prompt and messages of a request to Anthropic's Messages API, to which
+// the caller adds the model and max_tokens.
+type anthropicRequest struct {
+	System   []anthropicBlock   `json:"system,omitempty"`
+	Messages []anthropicMessage `json:"messages"`
+}
+
+type anthropicMessage struct {
+	Role    string           `json:"role"`
+	Content []anthropicBlock `json:"content"`
+}
+
+// anthropicBlock is a text content block. Attached files get blocks of
+// their own, so that a cache breakpoint can follow them.
+type anthropicBlock struct {
+	Type         string                 `json:"type"`
+	Text         string                 `json:"text"`
+	CacheControl *anthropicCacheControl `json:"cache_control,omitempty"`
+	file         bool
+}
+
+type anthropicCacheControl struct {
+	Type string `json:"type"`
+}
+
+// anthropicJSON returns the output of -format anthropic-json for chunks.
+// System turns make up the system prompt, and empty turns, which the API
+// rejects, are left out. With cacheBreakpoints, a cache_control marker
+// ends each run of attached files, up to maxCacheBreakpoints of them
+// (the first, since earlier prefixes change least), so that later requests
+// starting with the same files reuse the provider's cache of them.
+func anthropicJSON(chunks []render.Chunk, scripts *script.Scripts, cacheBreakpoints bool) (string, error) {
+	var request anthropicRequest
+	for _, turn := range render.TranscriptBlocks(chunks) {
+		var content []anthropicBlock
+		for _, block := range turn.Blocks {
+			text, err := scripts.PostRender(block.Text + "\n")
+			if err != nil {
+				return "", err
+			}
+			if text = strings.TrimSuffix(text, "\n"); strings.TrimSpace(text) != "" {
+				content = append(content, anthropicBlock{Type: "text", Text: text, file: block.File})
+			}
+		}
+		if len(content) == 0 {
+			continue
+		}
+		if turn.Role == "system" {
+			request.System = append(request.System, content...)
+		} else {
+			request.Messages = append(request.Messages, anthropicMessage{Role: turn.Role, Content: content})
+		}
+	}
+	if request.Messages == nil {
+		request.Messages = []anthropicMessage{}
+	}
+
+	// Mark the blocks in the order the API reads them: system, then
+	// messages.
+	var blocks []*anthropicBlock
+	for i := range request.System {
+		blocks = append(blocks, &request.System[i])
+	}
+	for _, message := range request.Messages {
+		for i := range message.Content {
+			blocks = append(blocks, &message.Content[i])
+		}
+	}
+	if cacheBreakpoints {
+		marked := 0
+		for i, block := range blocks {
+			if block.file && (i+1 == len(blocks) || !blocks[i+1].file) && marked < maxCacheBreakpoints {
+				block.CacheControl = &anthropicCacheControl{Type: "ephemeral"}
+				marked++
+			}
+		}
+	}
+
+	data, err := json.MarshalIndent(request, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data) + "\n", nil
+}
+
+// launcherItems is the output of -format launcher-json, in the Script
+// Filter JSON format that Alfred reads from script commands (and that
+// launchers such as Raycast accept from scripts in turn): a list with one
+// item, whose arg (passed on to the next action, such as Copy to
+// Clipboard) and text.copy (copied by Cmd-C) are the markdown.
+type launcherItems struct {
+	Items []launcherItem `json:"items"`
+}
+
+type launcherItem struct {
+	Title    string       `json:"title"`
+	Subtitle string       `json:"subtitle"`
+	Arg      string       `json:"arg"`
+	Text     launcherText `json:"text"`
+}
+
+type launcherText struct {
+	Copy      string `json:"copy"`
+	LargeType string `json:"largetype"`
+}
+
+// launcherJSON returns the output of -format launcher-json for markdown
+// rendered from entries. The item's title counts the entries of each kind
+// and its subtitle gives the size of the markdown.
+func launcherJSON(entries []entry.Entry, markdown string) (string, error) {
+	var files, messages, outputs int
+	for _, e := range entries {
+		switch entry.Unwrap(e).(type) {
+		case entry.File:
+			files++
+		case entry.Message:
+			messages++
+		case entry.Output:
+			outputs++
+		}
+	}
+	var counts []string
+	for _, count := range []struct {
+		n                int
+		singular, plural string
+	}{{files, "file", "files"}, {messages, "message", "messages"}, {outputs, "command output", "command outputs"}} {
+		switch {
+		case count.n == 1:
+			counts = append(counts, "1 "+count.singular)
+		case count.n > 1:
+			counts = append(counts, fmt.Sprintf("%d %s", count.n, count.plural))
+		}
+	}
+	title := "Empty bundle"
+	if len(counts) > 0 {
+		title = strings.Join(counts, ", ")
+	}
+
+	item := launcherItem{
+		Title:    title,
+		Subtitle: fmt.Sprintf("%s (~%d tokens)", describeBytes(len(markdown)), render.ApproxTokens(markdown)),
+		Arg:      markdown,
+		Text:     launcherText{Copy: markdown, LargeType: title},
+	}
+	data, err := json.MarshalIndent(launcherItems{Items: []launcherItem{item}}, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data) + "\n", nil
+}
+
+// pipelineOptions are the rendering settings that ch serve and ch daemon
+// accept with each request. Each field mirrors the flag of the same name.
+type pipelineOptions struct {
+	Metadata    bool   `json:"metadata,omitempty"`
+	TOC         bool   `json:"toc,omitempty"`
+	Preamble    bool   `json:"preamble,omitempty"`
+	Details     int    `json:"details,omitempty"`
+	FencePath   bool   `json:"fencePath,omitempty"`
+	FileIDs     bool   `json:"fileIds,omitempty"`
+	ReplyFormat string `json:"replyFormat,omitempty"`
+	Dedupe      string `json:"dedupe,omitempty"`
+	Budget      string `json:"budget,omitempty"`
+}
+
+// validate reports invalid options, so that requests can be rejected
+// before their subcommands run.
+func (o pipelineOptions) validate() error {
+	switch o.Dedupe {
+	case "", entry.DedupeOff, entry.DedupeDrop, entry.DedupeStub:
+	default:
+		return fmt.Errorf("invalid dedupe mode %q (expected off, drop, or stub)", o.Dedupe)
+	}
+	if o.Budget != "" {
+		if _, err := render.ParseLimit(o.Budget); err != nil {
+			return fmt.Errorf("invalid budget: %v", err)
+		}
+	}
+	if o.ReplyFormat != "" {
+		if _, err := reply.Instructions(o.ReplyFormat); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// render deduplicates entries, runs the script hooks, and renders the
+// result, as the command line does. It returns the markdown, the chunks it
+// joins (within the budget), and the entries it was rendered from. File
+// contents changed by pre_render hooks are stored in tempDir. Renderings of
+// files are kept in cache, if it isn't nil.
+func (o pipelineOptions) render(tempDir string, entries []entry.Entry, cfg config, scripts *script.Scripts, cache *entry.Cache) (string, []render.Chunk, []entry.Entry, error) {
+	if err := o.validate(); err != nil {
+		return "", nil, nil, err
+	}
+	dedupe := o.Dedupe
+	if dedupe == "" {
+		dedupe = entry.DedupeOff
+	}
+
+	entries = entry.Dedupe(entries, dedupe)
+	// As -reply-format implies -file-ids, so ReplyFormat implies FileIDs.
+	fileIDs := o.FileIDs
+	if o.ReplyFormat != "" {
+		instructions, _ := replyInstructions(o.ReplyFormat)
+		entries = append(entries, instructions)
+		fileIDs = true
+	}
+	entries, err := scripts.PreRender(tempDir, entries)
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("failed to run pre_render hooks: %v", err)
+	}
+	if fileIDs {
+		recordAttachedFiles(entries)
+	}
+
+	opts := entry.RenderOptions{
+		Metadata:    o.Metadata,
+		TOC:         o.TOC,
+		Preamble:    o.Preamble,
+		DetailsOver: o.Details,
+		FencePath:   o.FencePath,
+		FileIDs:     fileIDs,
+		Languages:   cfg.Languages,
+		Cache:       cache,
+	}
+	chunks := render.Chunks(entries, opts)
+	if o.Budget != "" {
+		budget, _ := render.ParseLimit(o.Budget)
+		if chunks, err = render.EnforceBudget(chunks, budget); err != nil {
+			return "", nil, nil, fmt.Errorf("failed to fit the size budget: %v", err)
+		}
+	}
+	markdown, err := scripts.PostRender(render.Join(chunks))
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("failed to run post_render hooks: %v", err)
+	}
+	return markdown, chunks, entries, nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+	"github.com/eloquence-cloud/ch/chlib/render"
+	"github.com/eloquence-cloud/ch/chlib/script"
+)
+
+func TestAnthropicJSON(t *testing.T) {
+	scripts, err := script.Load()
+	if err != nil {
+		t.Fatalf("Failed to load scripts: %v", err)
+	}
+	file := func(name string) render.Chunk {
+		return render.Chunk{Markdown: "`" + name + "`\n```\n" + name + "\n```\n", File: true}
+	}
+	message := func(text string) render.Chunk {
+		return render.Chunk{Markdown: text + "\n"}
+	}
+	chunks := []render.Chunk{
+		{Role: "system"}, message("Be brief."),
+		{Role: "user"}, file("a"), file("b"), message("Logs:"), file("c"), message("Why?"),
+		{Role: "assistant"},
+		{Role: "user"}, file("d"), message("And?"), file("e"), message("So?"), file("f"), message("Then?"), file("g"),
+	}
+
+	testCases := []struct {
+		name             string
+		cacheBreakpoints bool
+		// marked lists the texts of the blocks expected to be marked.
+		marked []string
+	}{
+		{name: "Without breakpoints"},
+		{
+			name:             "With breakpoints",
+			cacheBreakpoints: true,
+			marked:           []string{"`a`\n```\na\n```\n\n`b`\n```\nb\n```", "`c`\n```\nc\n```", "`d`\n```\nd\n```", "`e`\n```\ne\n```"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			output, err := anthropicJSON(chunks, scripts, tc.cacheBreakpoints)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			var request anthropicRequest
+			if err := json.Unmarshal([]byte(output), &request); err != nil {
+				t.Fatalf("Invalid JSON %q: %v", output, err)
+			}
+			if len(request.System) != 1 || request.System[0].Text != "Be brief." {
+				t.Errorf("Expected the system turn as the system prompt\n  Actual %+v", request.System)
+			}
+			// The empty assistant turn is left out.
+			if len(request.Messages) != 2 || request.Messages[0].Role != "user" || len(request.Messages[0].Content) != 4 {
+				t.Fatalf("Expected two user messages, the first with 4 blocks\n  Actual %+v", request.Messages)
+			}
+			var marked []string
+			for _, message := range request.Messages {
+				for _, block := range message.Content {
+					if block.CacheControl != nil {
+						if block.CacheControl.Type != "ephemeral" {
+							t.Errorf("Expected an ephemeral cache_control\n  Actual %q", block.CacheControl.Type)
+						}
+						marked = append(marked, block.Text)
+					}
+				}
+			}
+			if len(marked) != len(tc.marked) {
+				t.Fatalf("Expected marked blocks %q\n  Actual %q", tc.marked, marked)
+			}
+			for i := range marked {
+				if marked[i] != tc.marked[i] {
+					t.Errorf("Expected marked blocks %q\n  Actual %q", tc.marked, marked)
+				}
+			}
+		})
+	}
+}
+
+func TestLauncherJSON(t *testing.T) {
+	testCases := []struct {
+		name          string
+		entries       []entry.Entry
+		expectedTitle string
+	}{
+		{name: "Empty", expectedTitle: "Empty bundle"},
+		{
+			name:          "One of a kind",
+			entries:       []entry.Entry{entry.Message{Text: "Why?"}},
+			expectedTitle: "1 message",
+		},
+		{
+			name: "Several kinds",
+			entries: []entry.Entry{
+				entry.File{OriginalPath: "a.go"}, entry.File{OriginalPath: "b.go"}, entry.Message{Text: "Why?"},
+				entry.Output{Command: "go test", Output: "FAIL"},
+			},
+			expectedTitle: "2 files, 1 message, 1 command output",
+		},
+	}
+
+	markdown := "Why?\n"
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			output, err := launcherJSON(tc.entries, markdown)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			var actual launcherItems
+			if err := json.Unmarshal([]byte(output), &actual); err != nil {
+				t.Fatalf("Invalid JSON %q: %v", output, err)
+			}
+			expected := launcherItem{
+				Title:    tc.expectedTitle,
+				Subtitle: "5 bytes (~2 tokens)",
+				Arg:      markdown,
+				Text:     launcherText{Copy: markdown, LargeType: tc.expectedTitle},
+			}
+			if len(actual.Items) != 1 || actual.Items[0] != expected {
+				t.Errorf("Expected one item %+v\n  Actual %+v", expected, actual.Items)
+			}
+		})
+	}
+}
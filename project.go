@@ -0,0 +1,187 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// projectType is a kind of project: the marker files in its root that it
+// is recognized by, the directories that attach skips when walking it, and
+// fence languages for its files.
+type projectType struct {
+	Markers   []string          `toml:"markers"`
+	PruneDirs []string          `toml:"prune_dirs"`
+	Languages map[string]string `toml:"languages"`
+}
+
+// builtinProjectTypes are the project types detected unless the config
+// file says otherwise. Their prune_dirs add to subcmd.DefaultPruneDirs,
+// and their languages to the built-in detection in entry.LanguageFor.
+var builtinProjectTypes = map[string]projectType{
+	"go": {
+		Markers:   []string{"go.mod", "go.work"},
+		PruneDirs: []string{"vendor"},
+		Languages: map[string]string{".s": "asm", "go.sum": "text"},
+	},
+	"node": {
+		Markers:   []string{"package.json"},
+		PruneDirs: []string{"node_modules", "dist", "coverage", ".next", ".nuxt", ".turbo", ".parcel-cache"},
+		Languages: map[string]string{".mjs": "javascript", ".cjs": "javascript", ".mts": "typescript", ".cts": "typescript", ".npmrc": "ini"},
+	},
+	"python": {
+		Markers:   []string{"pyproject.toml", "setup.py", "setup.cfg", "requirements.txt", "Pipfile"},
+		PruneDirs: []string{".venv", "venv", "__pycache__", ".pytest_cache", ".mypy_cache", ".ruff_cache", ".tox", "dist", "build", "*.egg-info"},
+		Languages: map[string]string{".pyi": "python", ".pyx": "cython", "Pipfile": "toml", "setup.cfg": "ini"},
+	},
+	"rust": {
+		Markers:   []string{"Cargo.toml"},
+		PruneDirs: []string{"target"},
+		Languages: map[string]string{"Cargo.lock": "toml"},
+	},
+}
+
+// validateProjects reports the first invalid [projects.name] table. A
+// table that names no built-in type defines a new one, which needs
+// markers.
+func validateProjects(projects map[string]projectType) error {
+	for name, p := range projects {
+		if name == "" || strings.ContainsAny(name, " \t,") {
+			return fmt.Errorf("invalid project type name %q", name)
+		}
+		if _, ok := builtinProjectTypes[name]; !ok && len(p.Markers) == 0 {
+			return fmt.Errorf("project type %s has no markers", name)
+		}
+		for _, marker := range p.Markers {
+			if marker == "" || strings.ContainsAny(marker, `/\`) {
+				return fmt.Errorf("invalid marker for project type %s: %q (expected a file name)", name, marker)
+			}
+		}
+		for _, pattern := range p.PruneDirs {
+			if !validPruneDir(pattern) {
+				return fmt.Errorf("invalid prune_dirs pattern for project type %s: %q (expected a directory name or glob)", name, pattern)
+			}
+		}
+		for key, lang := range p.Languages {
+			if !validLanguage(key, lang) {
+				return fmt.Errorf("invalid language mapping for project type %s: %q = %q", name, key, lang)
+			}
+		}
+	}
+	return nil
+}
+
+// projectTypes returns the built-in project types with the config's
+// [projects] tables applied: markers and prune_dirs replace the built-in
+// lists where given, and languages override and add to them.
+func (cfg config) projectTypes() map[string]projectType {
+	types := make(map[string]projectType, len(builtinProjectTypes)+len(cfg.Projects))
+	for name, p := range builtinProjectTypes {
+		types[name] = p
+	}
+	for name, override := range cfg.Projects {
+		p := types[name]
+		if override.Markers != nil {
+			p.Markers = override.Markers
+		}
+		if override.PruneDirs != nil {
+			p.PruneDirs = override.PruneDirs
+		}
+		languages := make(map[string]string, len(p.Languages)+len(override.Languages))
+		for key, lang := range p.Languages {
+			languages[key] = lang
+		}
+		for key, lang := range override.Languages {
+			languages[key] = lang
+		}
+		p.Languages = languages
+		types[name] = p
+	}
+	return types
+}
+
+// detectProjects returns the root of the project that dir is in, the
+// nearest directory at or above it with a marker file of one of types,
+// and the names of the types whose markers it has, in lexical order. The
+// search stops at the root of a repository (a directory with .git).
+func detectProjects(dir string, types map[string]projectType) (string, []string) {
+	for {
+		var names []string
+		for name, p := range types {
+			for _, marker := range p.Markers {
+				if _, err := os.Stat(filepath.Join(dir, marker)); err == nil {
+					names = append(names, name)
+					break
+				}
+			}
+		}
+		if len(names) > 0 {
+			slices.Sort(names)
+			return dir, names
+		}
+		parent := filepath.Dir(dir)
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil || parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+// addProjectDefaults detects the type of the project in the working
+// directory, unless detect_projects is false, and adds the prune_dirs and
+// languages of its types to cfg. Languages configured in [languages] take
+// precedence.
+func addProjectDefaults(cfg *config) {
+	if cfg.DetectProjects != nil && !*cfg.DetectProjects {
+		return
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return
+	}
+	types := cfg.projectTypes()
+	root, names := detectProjects(cwd, types)
+	if len(names) == 0 {
+		return
+	}
+	slog.Debug("detected project", "root", root, "types", names)
+	for _, name := range names {
+		p := types[name]
+		for _, pattern := range p.PruneDirs {
+			if !slices.Contains(cfg.PruneDirs, pattern) {
+				cfg.PruneDirs = append(cfg.PruneDirs, pattern)
+			}
+		}
+		for key, lang := range p.Languages {
+			if _, ok := cfg.Languages[key]; ok {
+				continue
+			}
+			if cfg.Languages == nil {
+				cfg.Languages = map[string]string{}
+			}
+			cfg.Languages[key] = lang
+		}
+	}
+}
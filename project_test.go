@@ -0,0 +1,145 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/eloquence-cloud/ch/chlib/subcmd"
+)
+
+func TestDetectProjects(t *testing.T) {
+	testCases := []struct {
+		name          string
+		files         []string
+		dir           string
+		expectedRoot  string
+		expectedTypes []string
+	}{
+		{
+			name:          "Go module",
+			files:         []string{"go.mod", "cmd/ch/main.go"},
+			dir:           "cmd/ch",
+			expectedRoot:  ".",
+			expectedTypes: []string{"go"},
+		},
+		{
+			name:          "Several types",
+			files:         []string{"pyproject.toml", "package.json", "web/index.js"},
+			dir:           ".",
+			expectedRoot:  ".",
+			expectedTypes: []string{"node", "python"},
+		},
+		{
+			name:          "Nearest project",
+			files:         []string{"Cargo.toml", "web/package.json", "web/src/app.ts"},
+			dir:           "web/src",
+			expectedRoot:  "web",
+			expectedTypes: []string{"node"},
+		},
+		{
+			name:  "Repository root",
+			files: []string{"go.mod", "repo/.git/HEAD", "repo/src/main.c"},
+			dir:   "repo/src",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			root := t.TempDir()
+			for _, name := range tc.files {
+				path := filepath.Join(root, name)
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, nil, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			projectRoot, types := detectProjects(filepath.Join(root, tc.dir), builtinProjectTypes)
+			expectedRoot := ""
+			if tc.expectedRoot != "" {
+				expectedRoot = filepath.Join(root, tc.expectedRoot)
+			}
+			if projectRoot != expectedRoot || !reflect.DeepEqual(types, tc.expectedTypes) {
+				t.Errorf("Expected %q %v\n  Actual %q %v", expectedRoot, tc.expectedTypes, projectRoot, types)
+			}
+		})
+	}
+}
+
+func TestAddProjectDefaults(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"package.json", "mix.exs"} {
+		if err := os.WriteFile(filepath.Join(root, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	if err := os.Chdir(root); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config{
+		PruneDirs: []string{"coverage"},
+		Languages: map[string]string{".mjs": "js"},
+		Projects: map[string]projectType{
+			"node":   {PruneDirs: []string{"node_modules", "coverage"}, Languages: map[string]string{".npmrc": "properties"}},
+			"elixir": {Markers: []string{"mix.exs"}, PruneDirs: []string{"_build"}, Languages: map[string]string{".ex": "elixir"}},
+		},
+	}
+	addProjectDefaults(&cfg)
+	expectedPruneDirs := []string{"coverage", "_build", "node_modules"}
+	if !reflect.DeepEqual(cfg.PruneDirs, expectedPruneDirs) {
+		t.Errorf("Expected prune dirs %v\n  Actual %v", expectedPruneDirs, cfg.PruneDirs)
+	}
+	expectedLanguages := map[string]string{
+		".mjs": "js", ".cjs": "javascript", ".mts": "typescript", ".cts": "typescript", ".npmrc": "properties", ".ex": "elixir",
+	}
+	if !reflect.DeepEqual(cfg.Languages, expectedLanguages) {
+		t.Errorf("Expected languages %v\n  Actual %v", expectedLanguages, cfg.Languages)
+	}
+
+	// A project type's prune_dirs replace its built-in ones, so an empty
+	// list turns its pruning off.
+	if err := os.WriteFile(filepath.Join(root, "go.mod"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	unpruned := config{Projects: map[string]projectType{"go": {PruneDirs: []string{}}, "node": {PruneDirs: []string{}}}}
+	addProjectDefaults(&unpruned)
+	if len(unpruned.PruneDirs) != 0 {
+		t.Errorf("Expected no prune dirs with prune_dirs = []\n  Actual %v", unpruned.PruneDirs)
+	}
+	if err := os.MkdirAll(filepath.Join(root, "vendor", "lib"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "vendor", "lib", "lib.go"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	var defaults config
+	addProjectDefaults(&defaults)
+	for _, tc := range []struct {
+		pruneDirs []string
+		expected  bool
+	}{{defaults.PruneDirs, false}, {unpruned.PruneDirs, true}} {
+		files, err := subcmd.ListFiles(root, tc.pruneDirs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual := slices.Contains(files, filepath.Join(root, "vendor", "lib", "lib.go")); actual != tc.expected {
+			t.Errorf("Expected vendor listed: %v, with prune dirs %v\n  Actual: %v", tc.expected, tc.pruneDirs, files)
+		}
+	}
+
+	disabled := config{DetectProjects: new(bool)}
+	addProjectDefaults(&disabled)
+	if disabled.PruneDirs != nil || disabled.Languages != nil {
+		t.Errorf("Expected no defaults with detect_projects = false\n  Actual %+v", disabled)
+	}
+}
@@ -0,0 +1,202 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eloquence-cloud/ch/chlib/keyring"
+	"github.com/eloquence-cloud/ch/chlib/render"
+	"github.com/eloquence-cloud/ch/chlib/subcmd"
+)
+
+// defaultServer is where -push sends output when $CH_SERVER isn't set:
+// ch serve's default address.
+const defaultServer = "http://localhost:8377"
+
+// pushKeepAlive is how often GET /events sends a comment to a listener
+// that has had no event, so that idle connections aren't dropped.
+var pushKeepAlive = 30 * time.Second
+
+// pushEvent is the data of a "markdown" event on GET /events: output
+// pushed with POST /push, for a browser extension to insert into a chat.
+type pushEvent struct {
+	Markdown string `json:"markdown"`
+	Tokens   int    `json:"tokens"`
+
+	// id numbers the events, for the SSE id field.
+	id int
+}
+
+// pushResult is the reply to POST /push.
+type pushResult struct {
+	Listeners int `json:"listeners"`
+}
+
+// pushHub relays pushed output to the listeners on GET /events.
+type pushHub struct {
+	mu        sync.Mutex
+	listeners map[chan pushEvent]bool
+	lastID    int
+}
+
+func (h *pushHub) subscribe() chan pushEvent {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.listeners == nil {
+		h.listeners = make(map[chan pushEvent]bool)
+	}
+	// A listener that falls behind misses events rather than holding up
+	// the others.
+	events := make(chan pushEvent, 4)
+	h.listeners[events] = true
+	return events
+}
+
+func (h *pushHub) unsubscribe(events chan pushEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.listeners, events)
+}
+
+// publish sends event to every listener and returns how many there are.
+func (h *pushHub) publish(event pushEvent) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastID++
+	event.id = h.lastID
+	for events := range h.listeners {
+		select {
+		case events <- event:
+		default:
+		}
+	}
+	return len(h.listeners)
+}
+
+func (s *server) handlePush(w http.ResponseWriter, r *http.Request) {
+	if !requireJSON(w, r) {
+		return
+	}
+	var event pushEvent
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxPushSize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&event); err != nil {
+		http.Error(w, fmt.Sprintf("invalid push: %v", err), http.StatusBadRequest)
+		return
+	}
+	event.Tokens = render.ApproxTokens(event.Markdown)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pushResult{Listeners: s.push.publish(event)})
+}
+
+// maxPushSize bounds the body of a push, which is whole output rather
+// than a request.
+const maxPushSize = 64 << 20
+
+// handleEvents streams pushed output to a listener as server-sent events,
+// until the listener goes away.
+func (s *server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	events := s.push.subscribe()
+	defer s.push.unsubscribe(events)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	io.WriteString(w, ": listening for ch output\n\n")
+	flusher.Flush()
+	keepAlive := time.NewTicker(pushKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event := <-events:
+			data, err := json.Marshal(event)
+			if err != nil {
+				return
+			}
+			fmt.Fprintf(w, "id: %d\nevent: markdown\ndata: %s\n\n", event.id, data)
+		case <-keepAlive.C:
+			io.WriteString(w, ": keep-alive\n\n")
+		}
+		flusher.Flush()
+	}
+}
+
+// pushMarkdown sends markdown to the ch serve at $CH_SERVER (by default
+// defaultServer), authorized by the keyring's serve credential or $CH_TOKEN
+// if either is set, which passes it on
+// to the browser extensions listening there, using transport. It reports
+// how many there were.
+func pushMarkdown(markdown string, transport http.RoundTripper) error {
+	server := os.Getenv("CH_SERVER")
+	if server == "" {
+		server = defaultServer
+	}
+	body, err := json.Marshal(pushEvent{Markdown: markdown})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", strings.TrimSuffix(server, "/")+"/push", bytes.NewReader(body))
+	if err != nil {
+		return subcmd.Errorf(subcmd.KindOutput, "invalid $CH_SERVER: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token, err := keyring.Lookup("serve", "CH_TOKEN"); err == nil {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	client := &http.Client{Timeout: 30 * time.Second, Transport: transport}
+	resp, err := client.Do(req)
+	if err != nil {
+		return subcmd.Errorf(subcmd.KindOutput, "failed to push output (is ch serve running?): %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return subcmd.Errorf(subcmd.KindOutput, "failed to push output: %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	var result pushResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return subcmd.Errorf(subcmd.KindOutput, "failed to push output: invalid reply: %v", err)
+	}
+	if result.Listeners == 0 {
+		slog.Warn("pushed output, but no browser extension is listening", "server", server)
+	}
+	listeners := "1 listener"
+	if result.Listeners != 1 {
+		listeners = fmt.Sprintf("%d listeners", result.Listeners)
+	}
+	fmt.Fprintf(messages, "Markdown pushed to %s at %s.\n", listeners, server)
+	return nil
+}
@@ -0,0 +1,295 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+	"github.com/eloquence-cloud/ch/chlib/render"
+	"github.com/eloquence-cloud/ch/chlib/subcmd"
+)
+
+// replCommands documents the commands of ch -i, besides subcommands.
+var replCommands = []optionDoc{
+	{":list", "List the entries so far, numbered."},
+	{":show [n]", "Preview the markdown of entry n, or of the whole output."},
+	{":rm n...", "Delete entries."},
+	{":mv n m", "Move entry n to position m."},
+	{":clear", "Delete every entry."},
+	{":copy", "Copy the output to the clipboard, and quit."},
+	{":write file", "Write the output to file (- for stdout), and quit."},
+	{":done", "Deliver the output as -c, -o, -push, or -export directs, and quit. So does the end of input (Ctrl-D)."},
+	{":quit", "Quit without delivering anything."},
+	{":help", "List these commands."},
+}
+
+// repl is a session of ch -i: the entries accumulated so far, and where
+// the command line said to deliver them.
+type repl struct {
+	inv     *invocation
+	sc      subcmd.Context
+	out     io.Writer
+	entries []entry.Entry
+
+	copyToClipboard bool
+	outputFile      string
+}
+
+// replInvocation runs ch -i: it reads subcommands from in, one line at a
+// time, accumulating their entries until they are delivered or the user
+// quits. Lines starting with ":" list, preview, reorder, and delete the
+// entries, and deliver them; see replCommands. The subcommands given on
+// the command line, if any, run first.
+func replInvocation(inv *invocation, in io.Reader, out io.Writer) error {
+	sc, err := subcmd.NewContext()
+	if err != nil {
+		return fmt.Errorf("failed to create context: %v", err)
+	}
+	defer sc.Cleanup()
+	sc.KeepGoing = inv.keepGoing
+	sc.PruneDirs = inv.pruneDirs
+	sc.PathAliases = inv.pathAliases
+	sc.AskTemplates = inv.askTemplates
+	sc.Bundles = inv.bundles
+	sc.Workspace = inv.workspace
+	sc.Network = subcmd.NewNetwork(inv.network, inv.transport)
+
+	r := &repl{inv: inv, sc: sc, out: out, copyToClipboard: inv.copyToClipboard, outputFile: inv.outputFile}
+	if len(inv.subcommands) > 0 {
+		if err := r.run(inv.subcommands); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintln(out, "Enter subcommands to add entries, or :help for more commands.")
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprint(out, "ch> ")
+		if !scanner.Scan() {
+			fmt.Fprintln(out)
+			if err := scanner.Err(); err != nil {
+				return err
+			}
+			if !r.hasDestination() {
+				return nil
+			}
+			_, err := r.deliver(r.copyToClipboard, r.outputFile)
+			return err
+		}
+		done, err := r.handle(scanner.Text())
+		if err != nil {
+			fmt.Fprintf(out, "Error: %v\n", err)
+		}
+		if done {
+			return nil
+		}
+	}
+}
+
+// handle runs one line of input, reporting whether the session is over.
+func (r *repl) handle(line string) (bool, error) {
+	words, err := subcmd.SplitWords(line)
+	if err != nil || len(words) == 0 {
+		return false, err
+	}
+	if !strings.HasPrefix(words[0], ":") {
+		return false, r.run(words)
+	}
+
+	args := words[1:]
+	switch words[0] {
+	case ":list", ":ls":
+		r.list()
+	case ":show":
+		return false, r.show(args)
+	case ":rm":
+		return false, r.remove(args)
+	case ":mv":
+		return false, r.move(args)
+	case ":clear":
+		r.entries = nil
+		fmt.Fprintln(r.out, "Deleted every entry.")
+	case ":copy":
+		return r.deliver(true, "")
+	case ":write", ":w":
+		if len(args) != 1 {
+			return false, fmt.Errorf("usage: :write file")
+		}
+		return r.deliver(false, args[0])
+	case ":done":
+		if !r.hasDestination() {
+			return false, fmt.Errorf("ch -i was given no -c, -o, -push, or -export; use :copy or :write file")
+		}
+		return r.deliver(r.copyToClipboard, r.outputFile)
+	case ":quit", ":q":
+		return true, nil
+	case ":help":
+		for _, cmd := range replCommands {
+			writeTerm(r.out, 2, 12, cmd.term, cmd.text)
+		}
+		fmt.Fprintln(r.out, "Anything else is a line of subcommands, as on the command line.")
+	default:
+		return false, fmt.Errorf("unknown command %s (try :help)", words[0])
+	}
+	return false, nil
+}
+
+// run processes a line of subcommands and adds their entries. Like a run
+// of the pipeline, it stops them at -deadline or on an interrupt (Ctrl-C).
+func (r *repl) run(words []string) error {
+	ctx := context.Background()
+	if r.inv.deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.inv.deadline)
+		defer cancel()
+	}
+	interruptible, stop := signal.NotifyContext(ctx, os.Interrupt)
+	entries, err := subcmd.Process(interruptible, r.sc, words)
+	stop()
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("subcommands did not finish within -deadline %v", r.inv.deadline)
+	}
+	if errors.Is(err, context.Canceled) {
+		return fmt.Errorf("interrupted")
+	}
+	if err != nil {
+		return err
+	}
+	r.entries = append(r.entries, entries...)
+	fmt.Fprintf(r.out, "Added %s, %d in all.\n", countEntries(len(entries)), len(r.entries))
+	return nil
+}
+
+func (r *repl) list() {
+	if len(r.entries) == 0 {
+		fmt.Fprintln(r.out, "No entries yet.")
+		return
+	}
+	for i, e := range r.entries {
+		line := render.Describe(e)
+		if p := entry.PriorityOf(e); p != entry.PriorityNormal {
+			line += fmt.Sprintf(" [%s]", p)
+		}
+		fmt.Fprintf(r.out, "%3d. %s\n", i+1, line)
+	}
+}
+
+func (r *repl) show(args []string) error {
+	switch len(args) {
+	case 0:
+		entries := entry.Dedupe(r.entries, r.inv.dedupeMode)
+		fmt.Fprint(r.out, render.Join(render.Chunks(entries, r.inv.opts)))
+	case 1:
+		i, err := r.index(args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(r.out, r.entries[i].RenderMarkdown(r.inv.opts))
+	default:
+		return fmt.Errorf("usage: :show [n]")
+	}
+	return nil
+}
+
+func (r *repl) remove(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: :rm n...")
+	}
+	remove := make(map[int]bool)
+	for _, arg := range args {
+		i, err := r.index(arg)
+		if err != nil {
+			return err
+		}
+		remove[i] = true
+	}
+	indexes := make([]int, 0, len(remove))
+	for i := range remove {
+		indexes = append(indexes, i)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(indexes)))
+	for _, i := range indexes {
+		r.entries = append(r.entries[:i], r.entries[i+1:]...)
+	}
+	fmt.Fprintf(r.out, "Deleted %s, %d left.\n", countEntries(len(indexes)), len(r.entries))
+	return nil
+}
+
+func (r *repl) move(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: :mv n m")
+	}
+	from, err := r.index(args[0])
+	if err != nil {
+		return err
+	}
+	to, err := r.index(args[1])
+	if err != nil {
+		return err
+	}
+	e := r.entries[from]
+	r.entries = append(r.entries[:from], r.entries[from+1:]...)
+	r.entries = append(r.entries[:to], append([]entry.Entry{e}, r.entries[to:]...)...)
+	r.list()
+	return nil
+}
+
+// index converts an entry number, as listed by :list, to an index into
+// r.entries.
+func (r *repl) index(arg string) (int, error) {
+	n, err := strconv.Atoi(arg)
+	if err != nil || n < 1 || n > len(r.entries) {
+		return 0, fmt.Errorf("no entry %s (there are %d)", arg, len(r.entries))
+	}
+	return n - 1, nil
+}
+
+func (r *repl) hasDestination() bool {
+	return r.copyToClipboard || r.outputFile != "" || r.inv.push || r.inv.exportFile != ""
+}
+
+// deliver delivers the entries to the clipboard or outputFile, with the
+// rest of the command line's flags, reporting whether the session is over.
+func (r *repl) deliver(copyToClipboard bool, outputFile string) (bool, error) {
+	if len(r.entries) == 0 {
+		return false, fmt.Errorf("there are no entries to deliver")
+	}
+	r.inv.copyToClipboard, r.inv.outputFile = copyToClipboard, outputFile
+	if err := r.inv.deliver(context.Background(), r.sc, r.entries); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func countEntries(n int) string {
+	if n == 1 {
+		return "1 entry"
+	}
+	return fmt.Sprintf("%d entries", n)
+}
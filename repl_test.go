@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+	"github.com/eloquence-cloud/ch/chlib/script"
+)
+
+func TestReplInvocation(t *testing.T) {
+	scripts, err := script.Load()
+	if err != nil {
+		t.Fatalf("Failed to load scripts: %v", err)
+	}
+	dir := t.TempDir()
+	attached := filepath.Join(dir, "main.go")
+	if err := os.WriteFile(attached, []byte("package main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	outputPath := filepath.Join(dir, "out.md")
+	oldMessages := messages
+	defer func() { messages = oldMessages }()
+	messages = &bytes.Buffer{}
+
+	testCases := []struct {
+		name     string
+		input    string
+		expected string
+		output   []string
+	}{
+		{
+			name:     "reorder and delete",
+			input:    "say first\nsay 'second one'\nattach " + attached + "\n:mv 3 1\n:rm 3\n:list\n:done\n",
+			expected: "`" + attached + "`\n```go\npackage main\n```\n\nfirst\n",
+			output:   []string{"Added 1 entry, 3 in all.", "Deleted 1 entry, 2 left.", "  2. Message: \"first\""},
+		},
+		{
+			name:     "end of input delivers",
+			input:    "say hello, say world",
+			expected: "hello\n\nworld\n",
+		},
+		{
+			name:     "errors are reported",
+			input:    "frobnicate\n:rm 5\n:bogus\nsay 'unterminated\nsay ok\n",
+			expected: "ok\n",
+			output:   []string{"unknown subcommand: frobnicate", "no entry 5 (there are 0)", "unknown command :bogus", "unterminated quote"},
+		},
+		{
+			name:   "quit delivers nothing",
+			input:  "say hello\n:quit\nsay never\n",
+			output: []string{"Added 1 entry, 1 in all."},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			os.Remove(outputPath)
+			inv := &invocation{outputFile: outputPath, dedupeMode: entry.DedupeOff, scripts: scripts}
+			var out bytes.Buffer
+			if err := replInvocation(inv, strings.NewReader(tc.input), &out); err != nil {
+				t.Fatalf("REPL failed: %v", err)
+			}
+			actual, err := os.ReadFile(outputPath)
+			if tc.expected == "" {
+				if !os.IsNotExist(err) {
+					t.Errorf("Expected no output\n  Actual: %q", actual)
+				}
+			} else if string(actual) != tc.expected {
+				t.Errorf("Expected output %q\n  Actual: %q", tc.expected, actual)
+			}
+			for _, expected := range tc.output {
+				if !strings.Contains(out.String(), expected) {
+					t.Errorf("Expected session containing %q\n  Actual:\n%s", expected, out.String())
+				}
+			}
+		})
+	}
+}
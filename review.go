@@ -0,0 +1,214 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/eloquence-cloud/ch/chlib/diff"
+	"github.com/eloquence-cloud/ch/chlib/subcmd"
+)
+
+// reviewHelp explains the answers to the reviewer's question.
+const reviewHelp = `y - apply this hunk
+n - don't apply this hunk
+a - apply this hunk and the rest of the file's
+d - don't apply this hunk or the rest of the file's
+e - edit this hunk's new lines, then apply them
+q - quit: apply only the hunks already taken
+? - show this help
+`
+
+// reviewer asks, hunk by hunk, which of a reply's changes to take, as git
+// add -p does.
+type reviewer struct {
+	in  *bufio.Reader
+	out io.Writer
+	// edit has the user edit text, returning the result.
+	edit func(text string) (string, error)
+	// quit is set once the user has quit, to skip the files left.
+	quit bool
+}
+
+// reviewWrites returns writes with only the changes the user takes. Files
+// none of whose changes are taken are left out.
+func reviewWrites(writes []fileWrite, r *reviewer) ([]fileWrite, error) {
+	var reviewed []fileWrite
+	for _, write := range writes {
+		if r.quit {
+			break
+		}
+		current, err := os.ReadFile(write.path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		exists := err == nil
+		hunks := diff.Hunks(string(current), write.content)
+		if len(hunks) == 0 {
+			fmt.Fprintf(r.out, "%s is unchanged.\n", write.path)
+			continue
+		}
+		label := write.path
+		if !exists {
+			label += " (new file)"
+		}
+		fmt.Fprintf(r.out, "--- %s\n", label)
+		taken, err := r.reviewFile(write.path, hunks)
+		if err != nil {
+			return nil, err
+		}
+		if taken == nil {
+			continue
+		}
+		result := diff.Splice(string(current), hunks, func(i int) string { return taken[i] })
+		if exists && result == string(current) {
+			continue
+		}
+		if partial := countTaken(hunks, taken); partial < len(hunks) {
+			write.notes = append(write.notes, fmt.Sprintf("took %d of its %d hunks", partial, len(hunks)))
+		}
+		write.content = result
+		reviewed = append(reviewed, write)
+	}
+	return reviewed, nil
+}
+
+// reviewFile asks about each of a file's hunks, returning the text to put
+// in place of each, or nil if none is taken.
+func (r *reviewer) reviewFile(path string, hunks []diff.Hunk) ([]string, error) {
+	taken := make([]string, len(hunks))
+	for i, hunk := range hunks {
+		taken[i] = hunk.Old
+	}
+	took := false
+	for i := 0; i < len(hunks); i++ {
+		hunk := hunks[i]
+		fmt.Fprintf(r.out, "%s\n%s", hunk.Header, hunk.Diff)
+		answer, err := r.ask(fmt.Sprintf("(%d/%d) Apply this hunk to %s [y,n,a,d,e,q,?]? ", i+1, len(hunks), filepath.Base(path)))
+		if err != nil {
+			return nil, err
+		}
+		switch answer {
+		case "y":
+			taken[i], took = hunk.New, true
+		case "n":
+		case "a":
+			for j := i; j < len(hunks); j++ {
+				taken[j] = hunks[j].New
+			}
+			took, i = true, len(hunks)
+		case "d":
+			i = len(hunks)
+		case "e":
+			edited, err := r.edit(hunk.New)
+			if err != nil {
+				fmt.Fprintf(r.out, "Error: %v\n", err)
+				i--
+				continue
+			}
+			taken[i], took = edited, true
+		case "q":
+			r.quit, i = true, len(hunks)
+		default:
+			fmt.Fprint(r.out, reviewHelp)
+			i--
+		}
+	}
+	if !took {
+		return nil, nil
+	}
+	return taken, nil
+}
+
+// ask prints prompt and returns the first letter of the answer, in lower
+// case. At the end of the input it returns "q".
+func (r *reviewer) ask(prompt string) (string, error) {
+	fmt.Fprint(r.out, prompt)
+	line, err := r.in.ReadString('\n')
+	if err == io.EOF && line == "" {
+		fmt.Fprintln(r.out)
+		return "q", nil
+	}
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	answer := strings.ToLower(strings.TrimSpace(line))
+	if answer == "" {
+		return "?", nil
+	}
+	return answer[:1], nil
+}
+
+// countTaken returns how many of hunks are not left as they were.
+func countTaken(hunks []diff.Hunk, taken []string) int {
+	n := 0
+	for i, hunk := range hunks {
+		if taken[i] != hunk.Old {
+			n++
+		}
+	}
+	return n
+}
+
+// editText has the user edit text in $VISUAL or $EDITOR (by default vi),
+// returning the result.
+func editText(text string) (string, error) {
+	file, err := os.CreateTemp("", "ch-hunk-*.txt")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(file.Name())
+	_, err = file.WriteString(text)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+	if err := runEditor(file.Name()); err != nil {
+		return "", err
+	}
+	edited, err := os.ReadFile(file.Name())
+	return string(edited), err
+}
+
+// runEditor opens path in $VISUAL or $EDITOR (by default vi) and waits for
+// the user to quit it.
+func runEditor(path string) error {
+	editor := cmp.Or(os.Getenv("VISUAL"), os.Getenv("EDITOR"), "vi")
+	words, err := subcmd.SplitWords(editor)
+	if err != nil || len(words) == 0 {
+		return fmt.Errorf("invalid editor %q", editor)
+	}
+	cmd := exec.Command(words[0], append(words[1:], path)...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s failed: %v", words[0], err)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReviewWrites(t *testing.T) {
+	dir := t.TempDir()
+	var old, new strings.Builder
+	for i := 1; i <= 12; i++ {
+		fmt.Fprintf(&old, "%d\n", i)
+		if i == 1 || i == 12 {
+			fmt.Fprintf(&new, "%d changed\n", i)
+		} else {
+			fmt.Fprintf(&new, "%d\n", i)
+		}
+	}
+	existing := filepath.Join(dir, "numbers.txt")
+	if err := os.WriteFile(existing, []byte(old.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	created := filepath.Join(dir, "new.txt")
+	writes := []fileWrite{{path: existing, content: new.String()}, {path: created, content: "hello\n"}}
+
+	testCases := []struct {
+		name    string
+		answers string
+		// expected is the content of each file written, by path.
+		expected map[string]string
+	}{
+		{"all", "y\ny\ny\n", map[string]string{existing: new.String(), created: "hello\n"}},
+		{"first hunk only", "y\nn\nn\n", map[string]string{existing: strings.Replace(old.String(), "1\n", "1 changed\n", 1)}},
+		{"rest of file, skip new file", "a\nd\n", map[string]string{existing: new.String()}},
+		{"help, then edit", "?\ne\nn\ny\n", map[string]string{existing: strings.Replace(old.String(), "1\n", "1 edited\n", 1), created: "hello\n"}},
+		{"quit", "n\nq\n", map[string]string{}},
+		{"end of input", "y\n", map[string]string{existing: strings.Replace(old.String(), "1\n", "1 changed\n", 1)}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var out strings.Builder
+			r := &reviewer{
+				in:  bufio.NewReader(strings.NewReader(tc.answers)),
+				out: &out,
+				edit: func(text string) (string, error) {
+					return strings.Replace(text, "1 changed", "1 edited", 1), nil
+				},
+			}
+			reviewed, err := reviewWrites(writes, r)
+			if err != nil {
+				t.Fatalf("reviewWrites: %v", err)
+			}
+			actual := map[string]string{}
+			for _, write := range reviewed {
+				actual[write.path] = write.content
+			}
+			if fmt.Sprint(actual) != fmt.Sprint(tc.expected) {
+				t.Errorf("Expected %q\n  Actual %q\nOutput:\n%s", tc.expected, actual, out.String())
+			}
+		})
+	}
+}
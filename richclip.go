@@ -0,0 +1,118 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/eloquence-cloud/ch/chlib/mdhtml"
+	"github.com/eloquence-cloud/ch/chlib/subcmd"
+)
+
+// richCopyScript is the JavaScript for Automation that -rich runs on
+// macOS: it puts the HTML and the text in the files named by
+// $CH_HTML_FILE and $CH_TEXT_FILE on the pasteboard together.
+const richCopyScript = `ObjC.import('AppKit');
+function read(name) {
+	var path = $.NSProcessInfo.processInfo.environment.objectForKey(name);
+	return $.NSString.stringWithContentsOfFileEncodingError(path, $.NSUTF8StringEncoding, null);
+}
+var pasteboard = $.NSPasteboard.generalPasteboard;
+pasteboard.clearContents;
+pasteboard.setStringForType(read('CH_HTML_FILE'), $.NSPasteboardTypeHTML);
+pasteboard.setStringForType(read('CH_TEXT_FILE'), $.NSPasteboardTypeString);`
+
+// richCopyPowerShell is the PowerShell that -rich runs on Windows, to the
+// same effect. $CH_HTML_FILE holds the HTML in the CF_HTML format.
+const richCopyPowerShell = `Add-Type -AssemblyName System.Windows.Forms
+$data = New-Object System.Windows.Forms.DataObject
+$data.SetData('HTML Format', [IO.File]::ReadAllText($env:CH_HTML_FILE))
+$data.SetText([IO.File]::ReadAllText($env:CH_TEXT_FILE))
+[System.Windows.Forms.Clipboard]::SetDataObject($data, $true)`
+
+// richCopyCommand returns the command line that copies HTML and plain text
+// to the clipboard together on goos. Linux has no tool that offers more
+// than one flavor at once (xclip and wl-copy offer one), so it isn't
+// supported there.
+func richCopyCommand(goos string) ([]string, error) {
+	switch goos {
+	case "darwin":
+		return []string{"osascript", "-l", "JavaScript", "-e", richCopyScript}, nil
+	case "windows":
+		return []string{"powershell", "-NoProfile", "-STA", "-Command", richCopyPowerShell}, nil
+	default:
+		return nil, fmt.Errorf("-rich isn't supported on %s, whose clipboard tools copy one flavor at a time", goos)
+	}
+}
+
+// htmlDocument wraps an HTML fragment in the document that the clipboard
+// holds on goos: CF_HTML on Windows, and a page declaring its encoding
+// elsewhere.
+func htmlDocument(fragment, goos string) string {
+	if goos != "windows" {
+		return `<meta charset="utf-8">` + "\n" + fragment
+	}
+	// CF_HTML starts with a header giving the byte offsets of the document
+	// and of the fragment in it, each written in 10 digits so that the
+	// header's length doesn't depend on them.
+	const header = "Version:0.9\r\nStartHTML:%010d\r\nEndHTML:%010d\r\nStartFragment:%010d\r\nEndFragment:%010d\r\n"
+	const prefix = "<html><body>\r\n<!--StartFragment-->"
+	const suffix = "<!--EndFragment-->\r\n</body></html>"
+	start := len(fmt.Sprintf(header, 0, 0, 0, 0))
+	startFragment := start + len(prefix)
+	endFragment := startFragment + len(fragment)
+	end := endFragment + len(suffix)
+	return fmt.Sprintf(header, start, end, startFragment, endFragment) + prefix + fragment + suffix
+}
+
+// writeRichClipboard copies markdown to the clipboard as writeClipboard
+// does, along with an HTML rendering of it, so that rich-text editors
+// paste its code blocks as code while plain-text targets still get the
+// markdown.
+func writeRichClipboard(markdown, goos string) error {
+	args, err := richCopyCommand(goos)
+	if err != nil {
+		return subcmd.Errorf(subcmd.KindOutput, "%v", err)
+	}
+	dir, err := os.MkdirTemp("", "ch-rich-")
+	if err != nil {
+		return subcmd.Errorf(subcmd.KindOutput, "failed to copy to the clipboard: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	htmlPath, textPath := filepath.Join(dir, "clip.html"), filepath.Join(dir, "clip.md")
+	if err := os.WriteFile(htmlPath, []byte(htmlDocument(mdhtml.Render(markdown), goos)), 0600); err != nil {
+		return subcmd.Errorf(subcmd.KindOutput, "failed to copy to the clipboard: %v", err)
+	}
+	if err := os.WriteFile(textPath, []byte(markdown), 0600); err != nil {
+		return subcmd.Errorf(subcmd.KindOutput, "failed to copy to the clipboard: %v", err)
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Env = append(os.Environ(), "CH_HTML_FILE="+htmlPath, "CH_TEXT_FILE="+textPath)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return subcmd.Errorf(subcmd.KindOutput, "failed to copy to the clipboard: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	recordClip(markdown)
+	return nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestRichCopyCommand(t *testing.T) {
+	tests := []struct {
+		goos    string
+		program string
+		err     string
+	}{
+		{"darwin", "osascript", ""},
+		{"windows", "powershell", ""},
+		{"linux", "", "isn't supported on linux"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.goos, func(t *testing.T) {
+			args, err := richCopyCommand(tt.goos)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("Expected error containing %q\n  Actual %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil || args[0] != tt.program {
+				t.Errorf("Expected %s\n  Actual %q (error %v)", tt.program, args, err)
+			}
+		})
+	}
+}
+
+func TestHTMLDocumentWindows(t *testing.T) {
+	fragment := "<p>héllo</p>"
+	doc := htmlDocument(fragment, "windows")
+	offset := func(name string) int {
+		t.Helper()
+		_, rest, ok := strings.Cut(doc, name+":")
+		if !ok {
+			t.Fatalf("Expected %s in %q", name, doc)
+		}
+		n, err := strconv.Atoi(rest[:10])
+		if err != nil {
+			t.Fatalf("Invalid %s: %v", name, err)
+		}
+		return n
+	}
+	if actual := doc[offset("StartFragment"):offset("EndFragment")]; actual != fragment {
+		t.Errorf("Expected the fragment %q\n  Actual %q", fragment, actual)
+	}
+	if !strings.HasPrefix(doc[offset("StartHTML"):], "<html>") || offset("EndHTML") != len(doc) {
+		t.Errorf("Expected StartHTML and EndHTML to bound the document\n  Actual %q", doc)
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package main
+
+import (
+	"embed"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// schemas are the JSON Schemas of the JSON that ch writes and reads, each
+// of version entry.SchemaVersion.
+//
+//go:embed schema/*.json
+var schemas embed.FS
+
+// schemaNames lists the schemas, by the names "ch schema" takes.
+var schemaNames = []string{"entry-list", "manifest", "status"}
+
+// schemaCommand implements "ch schema [name]": it prints the JSON Schema
+// of an entry list (-export, import, and plugins), a manifest (-manifest),
+// or a status (-json-status), for plugins and editors to check their JSON
+// against, or lists the schemas.
+func schemaCommand(args []string) error {
+	flags := newCommandFlags("schema")
+	rest, err := parseInterspersed(flags, args)
+	if err != nil {
+		return err
+	}
+	switch len(rest) {
+	case 0:
+		for _, name := range schemaNames {
+			fmt.Println(name)
+		}
+		return nil
+	case 1:
+		data, err := schemas.ReadFile("schema/" + rest[0] + ".json")
+		if err != nil {
+			return usageError("unknown schema %q (expected %s)", rest[0], strings.Join(schemaNames, ", "))
+		}
+		_, err = os.Stdout.Write(data)
+		return err
+	default:
+		return usageError("usage: ch schema [name]")
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+)
+
+// jsonFields returns the JSON names of t's fields, including those of
+// embedded structs.
+func jsonFields(t reflect.Type) []string {
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous {
+			names = append(names, jsonFields(field.Type)...)
+			continue
+		}
+		if name, _, _ := strings.Cut(field.Tag.Get("json"), ","); name != "" && name != "-" {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// schemaObject is the part of a JSON Schema that describes an object.
+type schemaObject struct {
+	Properties map[string]json.RawMessage `json:"properties"`
+}
+
+func (o schemaObject) names() []string {
+	var names []string
+	for name := range o.Properties {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func (o schemaObject) object(t *testing.T, path ...string) schemaObject {
+	t.Helper()
+	raw := o.Properties[path[0]]
+	var sub struct {
+		schemaObject
+		Items *schemaObject `json:"items"`
+	}
+	if err := json.Unmarshal(raw, &sub); err != nil {
+		t.Fatalf("Failed to read %s: %v", path[0], err)
+	}
+	next := sub.schemaObject
+	if sub.Items != nil {
+		next = *sub.Items
+	}
+	if len(path) > 1 {
+		return next.object(t, path[1:]...)
+	}
+	return next
+}
+
+// TestSchemas checks that the schemas describe the fields that ch writes,
+// at the current schema version.
+func TestSchemas(t *testing.T) {
+	tests := []struct {
+		schema string
+		path   []string
+		value  any
+	}{
+		{"entry-list", nil, entry.List{}},
+		{"entry-list", []string{"entries"}, entry.Exported{}},
+		{"manifest", nil, manifest{}},
+		{"manifest", []string{"entries"}, manifestEntry{}},
+		{"manifest", []string{"output"}, manifestCounts{}},
+		{"manifest", []string{"lock"}, manifestLock{}},
+		{"status", nil, resultStatus{}},
+		{"status", []string{"reply"}, replyStatus{}},
+	}
+	for _, tt := range tests {
+		data, err := schemas.ReadFile("schema/" + tt.schema + ".json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var root schemaObject
+		if err := json.Unmarshal(data, &root); err != nil {
+			t.Fatalf("Invalid schema %s: %v", tt.schema, err)
+		}
+		object := root
+		if tt.path != nil {
+			object = root.object(t, tt.path...)
+		}
+		if expected, actual := jsonFields(reflect.TypeOf(tt.value)), object.names(); !slices.Equal(expected, actual) {
+			t.Errorf("Expected %s %v to have properties %v\n  Actual %v", tt.schema, tt.path, expected, actual)
+		}
+		var version struct{ Const int }
+		if err := json.Unmarshal(root.Properties["schemaVersion"], &version); err != nil || version.Const != entry.SchemaVersion {
+			t.Errorf("Expected %s to have schema version %d\n  Actual %s", tt.schema, entry.SchemaVersion, root.Properties["schemaVersion"])
+		}
+	}
+}
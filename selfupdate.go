@@ -0,0 +1,281 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/eloquence-cloud/ch/chlib/subcmd"
+	"github.com/eloquence-cloud/ch/chlib/transport"
+)
+
+// defaultReleaseFeed describes the latest release, in the format of the
+// GitHub releases API.
+const defaultReleaseFeed = "https://api.github.com/repos/eloquence-cloud/ch/releases/latest"
+
+// releasePublicKey is the base64 Ed25519 public key that signs release
+// checksums, set when building a release with
+// -ldflags "-X main.releasePublicKey=...". When it is set, self-update
+// requires checksums.txt.sig, a base64 signature of checksums.txt.
+var releasePublicKey = ""
+
+// release is the part of a release feed that self-update reads.
+type release struct {
+	TagName string         `json:"tag_name"`
+	Assets  []releaseAsset `json:"assets"`
+}
+
+type releaseAsset struct {
+	Name string `json:"name"`
+	URL  string `json:"browser_download_url"`
+}
+
+// url returns the download URL of the asset with the given name.
+func (r release) url(name string) (string, bool) {
+	for _, asset := range r.Assets {
+		if asset.Name == name {
+			return asset.URL, true
+		}
+	}
+	return "", false
+}
+
+// selfUpdateFlags are the flags of "ch self-update".
+type selfUpdateFlags struct {
+	check *bool
+	force *bool
+	feed  *string
+	proxy *string
+}
+
+func addSelfUpdateFlags(flags *flag.FlagSet) selfUpdateFlags {
+	return selfUpdateFlags{
+		check: flags.Bool("check", false, "Only report whether a newer release is available"),
+		force: flags.Bool("force", false, "Install the latest release even if it isn't newer"),
+		feed:  flags.String("feed", defaultReleaseFeed, "Read releases from the feed at `url` (GitHub releases API format)"),
+		proxy: flags.String("proxy", "", "Download through the proxy at `url` (http, https, socks5), or direct for none"),
+	}
+}
+
+// selfUpdateCommand implements "ch self-update": it replaces the running
+// executable with the latest release for this platform, after checking the
+// download against the release's checksums.
+func selfUpdateCommand(args []string) error {
+	flags := newCommandFlags("self-update")
+	f := addSelfUpdateFlags(flags)
+	rest, err := parseInterspersed(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return usageError("usage: ch self-update [-check] [-force] [-feed url] [-proxy url]")
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate the ch executable: %v", err)
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return fmt.Errorf("failed to locate the ch executable: %v", err)
+	}
+	httpTransport, err := transport.New(transport.Options{Proxy: *f.proxy})
+	if err != nil {
+		return usageError("%v", err)
+	}
+	u := updater{client: &http.Client{Timeout: 5 * time.Minute, Transport: httpTransport}, feed: *f.feed, exe: exe}
+	return u.update(*f.check, *f.force)
+}
+
+// updater replaces exe with the latest release listed in feed.
+type updater struct {
+	client *http.Client
+	feed   string
+	exe    string
+}
+
+func (u updater) update(check, force bool) error {
+	var latest release
+	if err := u.getJSON(u.feed, &latest); err != nil {
+		return err
+	}
+	current := buildVersion()
+	if !force {
+		if current == "dev" {
+			return usageError("this is a development build of ch; use -force to replace it with %s", latest.TagName)
+		}
+		if cmp, ok := compareVersions(latest.TagName, current); (ok && cmp <= 0) || latest.TagName == current {
+			fmt.Fprintf(messages, "ch %s is up to date.\n", current)
+			return nil
+		}
+	}
+	if check {
+		fmt.Fprintf(messages, "ch %s is available (this is %s). Run \"ch self-update\" to install it.\n", latest.TagName, current)
+		return nil
+	}
+
+	assetName := fmt.Sprintf("ch_%s_%s", runtime.GOOS, runtime.GOARCH)
+	if runtime.GOOS == "windows" {
+		assetName += ".exe"
+	}
+	assetURL, ok := latest.url(assetName)
+	if !ok {
+		return fmt.Errorf("release %s has no build for %s/%s", latest.TagName, runtime.GOOS, runtime.GOARCH)
+	}
+	expected, err := u.checksum(latest, assetName)
+	if err != nil {
+		return err
+	}
+
+	// Download next to the executable, so that the final rename doesn't
+	// cross filesystems.
+	tmp, err := os.CreateTemp(filepath.Dir(u.exe), ".ch-update-")
+	if err != nil {
+		return fmt.Errorf("failed to replace %s: %v", u.exe, err)
+	}
+	defer os.Remove(tmp.Name())
+	hash := sha256.New()
+	err = u.download(assetURL, io.MultiWriter(tmp, hash))
+	if closeErr := tmp.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to replace %s: %v", u.exe, closeErr)
+	}
+	if err != nil {
+		return err
+	}
+	if actual := hex.EncodeToString(hash.Sum(nil)); actual != expected {
+		return fmt.Errorf("checksum mismatch for %s: expected %s, got %s", assetName, expected, actual)
+	}
+	if err := replaceExecutable(u.exe, tmp.Name()); err != nil {
+		return fmt.Errorf("failed to replace %s: %v", u.exe, err)
+	}
+	fmt.Fprintf(messages, "Updated ch from %s to %s.\n", current, latest.TagName)
+	return nil
+}
+
+// checksum returns the SHA-256 of the asset named name, from the release's
+// checksums.txt (in sha256sum format), verifying the file's signature if
+// releasePublicKey is set.
+func (u updater) checksum(r release, name string) (string, error) {
+	url, ok := r.url("checksums.txt")
+	if !ok {
+		return "", fmt.Errorf("release %s has no checksums.txt", r.TagName)
+	}
+	var checksums bytes.Buffer
+	if err := u.download(url, &checksums); err != nil {
+		return "", err
+	}
+
+	if releasePublicKey != "" {
+		key, err := base64.StdEncoding.DecodeString(releasePublicKey)
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			return "", fmt.Errorf("invalid release public key built into ch")
+		}
+		sigURL, ok := r.url("checksums.txt.sig")
+		if !ok {
+			return "", fmt.Errorf("release %s has no checksums.txt.sig", r.TagName)
+		}
+		var sigText bytes.Buffer
+		if err := u.download(sigURL, &sigText); err != nil {
+			return "", err
+		}
+		sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(sigText.String()))
+		if err != nil || !ed25519.Verify(key, checksums.Bytes(), sig) {
+			return "", fmt.Errorf("checksums.txt of release %s is not correctly signed", r.TagName)
+		}
+	}
+
+	scanner := bufio.NewScanner(&checksums)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	return "", fmt.Errorf("checksums.txt of release %s has no checksum for %s", r.TagName, name)
+}
+
+// getJSON decodes the JSON document at url into v.
+func (u updater) getJSON(url string, v any) error {
+	var body bytes.Buffer
+	if err := u.download(url, &body); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body.Bytes(), v); err != nil {
+		return fmt.Errorf("invalid release feed %s: %v", url, err)
+	}
+	return nil
+}
+
+// download copies the document at url to w.
+func (u updater) download(url string, w io.Writer) error {
+	resp, err := u.client.Get(url)
+	if err != nil {
+		return subcmd.Errorf(subcmd.KindRemote, "failed to download %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return subcmd.Errorf(subcmd.KindRemote, "failed to download %s: %s", url, resp.Status)
+	}
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return subcmd.Errorf(subcmd.KindRemote, "failed to download %s: %v", url, err)
+	}
+	return nil
+}
+
+// replaceExecutable moves the file at newPath over exe, keeping exe's
+// permissions. The old executable is first moved aside, since Windows
+// won't overwrite a running program.
+func replaceExecutable(exe, newPath string) error {
+	info, err := os.Stat(exe)
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(newPath, info.Mode().Perm()); err != nil {
+		return err
+	}
+	old := exe + ".old"
+	os.Remove(old)
+	if err := os.Rename(exe, old); err != nil {
+		return err
+	}
+	if err := os.Rename(newPath, exe); err != nil {
+		// Put the old executable back rather than leave none.
+		os.Rename(old, exe)
+		return err
+	}
+	// On Windows, the running program can't be removed; the next update
+	// removes it instead.
+	os.Remove(old)
+	return nil
+}
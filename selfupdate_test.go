@@ -0,0 +1,236 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// releaseServer serves a release feed at /latest and each of files at
+// /<name>.
+func releaseServer(t *testing.T, tag string, files map[string]string) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	latest := release{TagName: tag}
+	for name, content := range files {
+		content := content
+		latest.Assets = append(latest.Assets, releaseAsset{Name: name, URL: server.URL + "/" + name})
+		mux.HandleFunc("GET /"+name, func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(content))
+		})
+	}
+	mux.HandleFunc("GET /latest", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(latest)
+	})
+	return server
+}
+
+func platformAsset() string {
+	name := "ch_" + runtime.GOOS + "_" + runtime.GOARCH
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func setupSelfUpdate(t *testing.T, current string) string {
+	t.Helper()
+	oldVersion, oldKey, oldMessages := version, releasePublicKey, messages
+	t.Cleanup(func() { version, releasePublicKey, messages = oldVersion, oldKey, oldMessages })
+	version = current
+	messages = &strings.Builder{}
+	exe := filepath.Join(t.TempDir(), "ch")
+	if err := os.WriteFile(exe, []byte("old binary"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return exe
+}
+
+func TestSelfUpdate(t *testing.T) {
+	newBinary := "new binary"
+	checksums := sha256Hex(newBinary) + "  " + platformAsset() + "\n" +
+		sha256Hex("other") + "  ch_plan9_386\n"
+	badChecksums := sha256Hex("something else") + "  " + platformAsset() + "\n"
+
+	testCases := []struct {
+		name     string
+		current  string
+		files    map[string]string
+		check    bool
+		force    bool
+		wantErr  string
+		expected string
+	}{
+		{
+			name:     "newer release",
+			current:  "v1.0.0",
+			files:    map[string]string{platformAsset(): newBinary, "checksums.txt": checksums},
+			expected: newBinary,
+		},
+		{
+			name:     "up to date",
+			current:  "v1.1.0",
+			files:    map[string]string{platformAsset(): newBinary, "checksums.txt": checksums},
+			expected: "old binary",
+		},
+		{
+			name:     "check only",
+			current:  "v1.0.0",
+			files:    map[string]string{platformAsset(): newBinary, "checksums.txt": checksums},
+			check:    true,
+			expected: "old binary",
+		},
+		{
+			name:     "dev build with force",
+			current:  "",
+			files:    map[string]string{platformAsset(): newBinary, "checksums.txt": checksums},
+			force:    true,
+			expected: newBinary,
+		},
+		{
+			name:     "checksum mismatch",
+			current:  "v1.0.0",
+			files:    map[string]string{platformAsset(): newBinary, "checksums.txt": badChecksums},
+			wantErr:  "checksum mismatch",
+			expected: "old binary",
+		},
+		{
+			name:     "no build for platform",
+			current:  "v1.0.0",
+			files:    map[string]string{"checksums.txt": checksums},
+			wantErr:  "has no build for",
+			expected: "old binary",
+		},
+		{
+			name:     "no checksums",
+			current:  "v1.0.0",
+			files:    map[string]string{platformAsset(): newBinary},
+			wantErr:  "has no checksums.txt",
+			expected: "old binary",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			exe := setupSelfUpdate(t, tc.current)
+			server := releaseServer(t, "v1.1.0", tc.files)
+			u := updater{client: server.Client(), feed: server.URL + "/latest", exe: exe}
+			err := u.update(tc.check, tc.force)
+			if tc.wantErr == "" && err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)) {
+				t.Fatalf("Expected error containing %q\n  Actual: %v", tc.wantErr, err)
+			}
+			content, err := os.ReadFile(exe)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(content) != tc.expected {
+				t.Errorf("Expected executable %q\n  Actual: %q", tc.expected, content)
+			}
+			leftovers, _ := filepath.Glob(filepath.Join(filepath.Dir(exe), "*"))
+			if len(leftovers) != 1 {
+				t.Errorf("Expected only the executable to remain\n  Actual: %v", leftovers)
+			}
+		})
+	}
+}
+
+func TestSelfUpdateSignature(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newBinary := "new binary"
+	checksums := sha256Hex(newBinary) + "  " + platformAsset() + "\n"
+	signature := base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, []byte(checksums)))
+	forged := base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, []byte("forged")))
+
+	testCases := []struct {
+		name     string
+		files    map[string]string
+		wantErr  string
+		expected string
+	}{
+		{
+			name:     "valid signature",
+			files:    map[string]string{platformAsset(): newBinary, "checksums.txt": checksums, "checksums.txt.sig": signature + "\n"},
+			expected: newBinary,
+		},
+		{
+			name:     "bad signature",
+			files:    map[string]string{platformAsset(): newBinary, "checksums.txt": checksums, "checksums.txt.sig": forged},
+			wantErr:  "not correctly signed",
+			expected: "old binary",
+		},
+		{
+			name:     "missing signature",
+			files:    map[string]string{platformAsset(): newBinary, "checksums.txt": checksums},
+			wantErr:  "has no checksums.txt.sig",
+			expected: "old binary",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			exe := setupSelfUpdate(t, "v1.0.0")
+			releasePublicKey = base64.StdEncoding.EncodeToString(publicKey)
+			server := releaseServer(t, "v1.1.0", tc.files)
+			u := updater{client: server.Client(), feed: server.URL + "/latest", exe: exe}
+			err := u.update(false, false)
+			if tc.wantErr == "" && err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)) {
+				t.Fatalf("Expected error containing %q\n  Actual: %v", tc.wantErr, err)
+			}
+			content, err := os.ReadFile(exe)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(content) != tc.expected {
+				t.Errorf("Expected executable %q\n  Actual: %q", tc.expected, content)
+			}
+		})
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	testCases := []struct {
+		a, b     string
+		expected int
+		ok       bool
+	}{
+		{"v1.2.3", "v1.2.3", 0, true},
+		{"v1.2.4", "v1.2.3", 1, true},
+		{"v1.10.0", "v1.9.9", 1, true},
+		{"v1.2.3", "v2.0.0", -1, true},
+		{"1.2.3", "v1.2.3-rc.1", 0, true},
+		{"v1.2.3", "dev", 0, false},
+		{"v1.2", "v1.2.0", 0, false},
+	}
+	for _, tc := range testCases {
+		actual, ok := compareVersions(tc.a, tc.b)
+		if actual != tc.expected || ok != tc.ok {
+			t.Errorf("compareVersions(%q, %q)\nExpected: %d, %v\n  Actual: %d, %v", tc.a, tc.b, tc.expected, tc.ok, actual, ok)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/eloquence-cloud/ch/chlib/keyring"
+	"github.com/eloquence-cloud/ch/chlib/llm"
+	"github.com/eloquence-cloud/ch/chlib/render"
+	"github.com/eloquence-cloud/ch/chlib/subcmd"
+)
+
+// modelConfig is a [models.name] table of the config file: a language
+// model that -send can send the output to.
+type modelConfig struct {
+	// Provider is the API the model is reached through: anthropic, or
+	// openai for OpenAI and the servers compatible with it.
+	Provider string `toml:"provider"`
+	// Endpoint is the URL of the API, if not the provider's own, such as a
+	// local Ollama server's.
+	Endpoint string `toml:"endpoint"`
+	// Model is the model's ID in the API.
+	Model string `toml:"model"`
+	// Auth names the keyring credential holding the API key, which is
+	// read from AuthEnv (by default the credential's conventional
+	// variable, such as ANTHROPIC_TOKEN) if the keyring doesn't have it.
+	// Without one, requests aren't authenticated.
+	Auth    string `toml:"auth"`
+	AuthEnv string `toml:"auth_env"`
+	// MaxTokens limits the length of replies (by default 4096 tokens).
+	MaxTokens int `toml:"max_tokens"`
+	// BytesPerToken approximates the model's tokenizer, for checking that
+	// requests fit ContextWindow (by default 4).
+	BytesPerToken float64 `toml:"bytes_per_token"`
+	ContextWindow int     `toml:"context_window"`
+	// InputPrice and OutputPrice are the dollars a million tokens of
+	// request and of reply cost, for reporting what a request cost.
+	InputPrice  float64 `toml:"input_price"`
+	OutputPrice float64 `toml:"output_price"`
+	// Fallback names the models to try, in order, if this one fails or is
+	// rate limited. Their own fallbacks follow them.
+	Fallback []string `toml:"fallback"`
+}
+
+// validateModels checks the [models] tables of the config file.
+func validateModels(models map[string]modelConfig) error {
+	for name, m := range models {
+		if name == "" || strings.ContainsAny(name, " \t,") {
+			return fmt.Errorf("invalid model name %q", name)
+		}
+		if !slices.Contains(llm.Providers(), m.Provider) {
+			return fmt.Errorf("invalid provider %q for model %s (expected %s)", m.Provider, name, strings.Join(llm.Providers(), " or "))
+		}
+		if m.Model == "" {
+			return fmt.Errorf("model %s has no model ID", name)
+		}
+		if m.Endpoint != "" {
+			if u, err := url.Parse(m.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("invalid endpoint %q for model %s (expected an http or https URL)", m.Endpoint, name)
+			}
+		}
+		if m.Auth != "" {
+			if err := keyring.ValidateName(m.Auth); err != nil {
+				return fmt.Errorf("invalid auth for model %s: %v", name, err)
+			}
+		}
+		if m.MaxTokens < 0 || m.BytesPerToken < 0 || m.ContextWindow < 0 || m.InputPrice < 0 || m.OutputPrice < 0 {
+			return fmt.Errorf("invalid settings for model %s: sizes and prices can't be negative", name)
+		}
+		for _, fallback := range m.Fallback {
+			if _, ok := models[fallback]; !ok {
+				return fmt.Errorf("unknown fallback %q for model %s", fallback, name)
+			}
+		}
+	}
+	return nil
+}
+
+// modelChain returns the named model followed by its fallbacks, and
+// theirs, each once.
+func (cfg config) modelChain(name string) ([]llm.Model, error) {
+	if _, ok := cfg.Models[name]; !ok {
+		var names []string
+		for name := range cfg.Models {
+			names = append(names, name)
+		}
+		if len(names) == 0 {
+			return nil, fmt.Errorf("unknown model %q (no [models] are configured)", name)
+		}
+		slices.Sort(names)
+		return nil, fmt.Errorf("unknown model %q (expected %s)", name, strings.Join(names, ", "))
+	}
+	var chain []llm.Model
+	seen := map[string]bool{}
+	var add func(name string)
+	add = func(name string) {
+		if seen[name] {
+			return
+		}
+		seen[name] = true
+		m := cfg.Models[name]
+		chain = append(chain, llm.Model{
+			Name:          name,
+			Provider:      m.Provider,
+			Endpoint:      m.Endpoint,
+			ID:            m.Model,
+			Credential:    m.credential(),
+			MaxTokens:     m.MaxTokens,
+			BytesPerToken: m.BytesPerToken,
+			ContextWindow: m.ContextWindow,
+			InputPrice:    m.InputPrice,
+			OutputPrice:   m.OutputPrice,
+		})
+		for _, fallback := range m.Fallback {
+			add(fallback)
+		}
+	}
+	add(name)
+	return chain, nil
+}
+
+// credential returns the function that looks up the model's API key, or
+// nil if it has none.
+func (m modelConfig) credential() func() (string, error) {
+	if m.Auth == "" {
+		return nil
+	}
+	envVar := m.AuthEnv
+	if envVar == "" {
+		envVar = keyring.EnvVar(m.Auth)
+	}
+	return func() (string, error) {
+		return keyring.Lookup(m.Auth, envVar)
+	}
+}
+
+// replyStatus describes, for -json-status, the reply to output sent with
+// -send.
+type replyStatus struct {
+	// Model is the model that replied, which is a fallback of the one
+	// -send named if that failed.
+	Model        string  `json:"model"`
+	Text         string  `json:"text"`
+	InputTokens  int     `json:"inputTokens"`
+	OutputTokens int     `json:"outputTokens"`
+	Cost         float64 `json:"cost,omitempty"`
+}
+
+// sendOutput sends the transcript of chunks to inv.send's models and
+// prints the reply on stdout, or, with -json-status, records it in the
+// result. markdown, the rendered output, is saved in the clip history
+// with the reply, which is also written to -reply-out.
+func (inv *invocation) sendOutput(markdown string, chunks []render.Chunk) error {
+	turns, err := transcriptTurns(chunks, inv.scripts)
+	if err != nil {
+		return fmt.Errorf("failed to run post_render hooks: %v", err)
+	}
+	conversation := make([]llm.Message, len(turns))
+	for i, turn := range turns {
+		conversation[i] = llm.Message{Role: turn.Role, Content: turn.Content}
+	}
+	client := &http.Client{Transport: inv.transport}
+	response, err := llm.Send(context.Background(), client, inv.send, conversation)
+	if err != nil {
+		return subcmd.Errorf(subcmd.KindRemote, "failed to send the output: %v", err)
+	}
+	recordExchange(markdown, response.Text)
+	if inv.replyOut != "" {
+		if err := os.WriteFile(inv.replyOut, []byte(response.Text), 0644); err != nil {
+			return subcmd.Errorf(subcmd.KindOutput, "failed to write the reply: %v", err)
+		}
+	}
+	inv.reportReply(response)
+	return nil
+}
+
+// recordExchange adds markdown and the reply to it to the default clip
+// history. Failures are only logged, since the exchange itself succeeded.
+func recordExchange(markdown, reply string) {
+	history, err := defaultClipHistory()
+	if err == nil {
+		err = history.addExchange(markdown, reply, time.Now())
+	}
+	if err != nil {
+		slog.Warn("failed to save the reply in the clip history", "error", err)
+	}
+}
+
+// reportReply records a model's reply in the result, for -json-status and
+// -session, and otherwise prints it.
+func (inv *invocation) reportReply(response llm.Response) {
+	var cost float64
+	for _, m := range inv.send {
+		if m.Name == response.Model {
+			cost = m.Cost(response.InputTokens, response.OutputTokens)
+		}
+	}
+	inv.result.Reply = &replyStatus{
+		Model:        response.Model,
+		Text:         response.Text,
+		InputTokens:  response.InputTokens,
+		OutputTokens: response.OutputTokens,
+		Cost:         cost,
+	}
+	if inv.statusOut != nil {
+		return
+	}
+	fmt.Print(response.Text)
+	if !strings.HasSuffix(response.Text, "\n") {
+		fmt.Println()
+	}
+	summary := fmt.Sprintf("Reply from %s: %d tokens in, %d out", response.Model, response.InputTokens, response.OutputTokens)
+	if cost > 0 {
+		summary += fmt.Sprintf(", about $%.4f", cost)
+	}
+	if response.StopReason == "max_tokens" || response.StopReason == "length" {
+		summary += " (cut off at the max_tokens limit)"
+	}
+	fmt.Fprintln(messages, summary)
+}
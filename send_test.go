@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/eloquence-cloud/ch/chlib/llm"
+	"github.com/eloquence-cloud/ch/chlib/script"
+)
+
+func TestModelChain(t *testing.T) {
+	cfg := config{Models: map[string]modelConfig{
+		"claude": {Provider: "anthropic", Model: "claude-3-5-sonnet-latest", Fallback: []string{"gpt", "local"}},
+		"gpt":    {Provider: "openai", Model: "gpt-4o", Fallback: []string{"local", "claude"}},
+		"local":  {Provider: "openai", Model: "llama3.1", Fallback: []string{"gpt"}},
+	}}
+
+	testCases := []struct {
+		name        string
+		expected    []string
+		expectedErr string
+	}{
+		{name: "claude", expected: []string{"claude", "gpt", "local"}},
+		{name: "local", expected: []string{"local", "gpt", "claude"}},
+		{name: "gemini", expectedErr: "unknown model \"gemini\" (expected claude, gpt, local)"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			chain, err := cfg.modelChain(tc.name)
+			if tc.expectedErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.expectedErr) {
+					t.Errorf("Expected error containing %q, got: %v", tc.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			var names []string
+			for _, m := range chain {
+				names = append(names, m.Name)
+			}
+			if !reflect.DeepEqual(names, tc.expected) {
+				t.Errorf("Expected chain: %v\n  Actual chain: %v", tc.expected, names)
+			}
+		})
+	}
+}
+
+func TestInvocationSend(t *testing.T) {
+	isolateStorage(t)
+	scripts, err := script.Load()
+	if err != nil {
+		t.Fatalf("Failed to load scripts: %v", err)
+	}
+	defer slog.SetDefault(slog.Default())
+	if _, err := setupLogging(0, ""); err != nil {
+		t.Fatalf("Failed to set up logging: %v", err)
+	}
+	var request struct {
+		Messages []llm.Message `json:"messages"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&request)
+		io.WriteString(w, `{"choices": [{"message": {"content": "Hi there."}}], "usage": {"prompt_tokens": 4, "completion_tokens": 2}}`)
+	}))
+	defer server.Close()
+
+	replyPath := filepath.Join(t.TempDir(), "reply.md")
+	var status bytes.Buffer
+	inv := &invocation{
+		subcommands: []string{"say", "Hello."},
+		send:        []llm.Model{{Name: "local", Provider: llm.ProviderOpenAI, Endpoint: server.URL, ID: "llama3.1", InputPrice: 1e6}},
+		replyOut:    replyPath,
+		transport:   server.Client().Transport,
+		scripts:     scripts,
+		statusOut:   &status,
+		warnings:    recordWarnings(),
+	}
+	if _, err := inv.run(context.Background()); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	expectedMessages := []llm.Message{{Role: "user", Content: "Hello."}}
+	if !reflect.DeepEqual(request.Messages, expectedMessages) {
+		t.Errorf("Expected messages: %+v\n  Actual messages: %+v", expectedMessages, request.Messages)
+	}
+	var actual resultStatus
+	if err := json.Unmarshal(status.Bytes(), &actual); err != nil {
+		t.Fatalf("Invalid status %q: %v", status.String(), err)
+	}
+	expected := &replyStatus{Model: "local", Text: "Hi there.", InputTokens: 4, OutputTokens: 2, Cost: 4}
+	if actual.Destination != "send" || !reflect.DeepEqual(actual.Reply, expected) {
+		t.Errorf("Expected destination send and reply %+v\n  Actual %q and %+v", expected, actual.Destination, actual.Reply)
+	}
+	if reply, err := os.ReadFile(replyPath); err != nil || string(reply) != "Hi there." {
+		t.Errorf("Expected -reply-out to hold the reply\n  Actual %q (error %v)", reply, err)
+	}
+	history, err := defaultClipHistory()
+	if err != nil {
+		t.Fatalf("Failed to locate clip history: %v", err)
+	}
+	if reply, err := history.getReply(1); err != nil || reply != "Hi there." {
+		t.Errorf("Expected the clip history to hold the reply\n  Actual %q (error %v)", reply, err)
+	}
+}
@@ -0,0 +1,348 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+	"github.com/eloquence-cloud/ch/chlib/keyring"
+	"github.com/eloquence-cloud/ch/chlib/render"
+	"github.com/eloquence-cloud/ch/chlib/script"
+	"github.com/eloquence-cloud/ch/chlib/subcmd"
+	"github.com/eloquence-cloud/ch/chlib/transport"
+)
+
+// maxRequestSize bounds the body of a render request.
+const maxRequestSize = 1 << 20
+
+// renderRequest is the JSON body of POST /render. Subcommands is a command
+// line for the subcommand pipeline, one word per element, exactly as it
+// would follow "ch -o -".
+type renderRequest struct {
+	Subcommands []string `json:"subcommands"`
+	Format      string   `json:"format,omitempty"`
+	KeepGoing   bool     `json:"keepGoing,omitempty"`
+	pipelineOptions
+}
+
+// renderResponse is the reply to a render request with format "json": the
+// rendered markdown, plus the entries it was rendered from in the -export
+// format and the turns of its transcript, as -format messages writes them.
+type renderResponse struct {
+	// SchemaVersion is entry.SchemaVersion, the version of Entries' form.
+	SchemaVersion int `json:"schemaVersion"`
+
+	Markdown string           `json:"markdown"`
+	Tokens   int              `json:"tokens"`
+	Entries  []entry.Exported `json:"entries"`
+	Messages []render.Turn    `json:"messages,omitempty"`
+}
+
+// server answers render requests over HTTP. Requests are handled one at a
+// time, since script hooks and the subcommand registry are not safe for
+// concurrent use.
+type server struct {
+	cfg       config
+	transport http.RoundTripper
+	scripts   *script.Scripts
+	cache     *entry.Cache
+	token     string
+	// listen is the address the server listens on. Requests naming
+	// another host are rejected; see checkHost.
+	listen string
+
+	// ui serves the web UI at / and the file list it shows at /files,
+	// for the files under root (by default the working directory).
+	ui   bool
+	root string
+	// push relays output pushed with POST /push to GET /events.
+	push pushHub
+	mu   sync.Mutex
+}
+
+// serveFlags are the flags of "ch serve".
+type serveFlags struct {
+	listen     *string
+	token      *string
+	configPath *string
+	ui         *bool
+}
+
+func addServeFlags(flags *flag.FlagSet) serveFlags {
+	return serveFlags{
+		listen:     flags.String("listen", "localhost:8377", "Listen on `addr`"),
+		token:      flags.String("token", "", "Require requests to carry \"Authorization: Bearer `token`\" (default $CH_TOKEN, else a random token, which is printed)"),
+		configPath: flags.String("config", "", "Read settings from this config `file`"),
+		ui:         flags.Bool("ui", false, "Also serve a web page at / for picking files and composing output"),
+	}
+}
+
+// serveCommand implements "ch serve": it runs an HTTP server that renders
+// subcommand lists on request, for editor plugins, scripts, and web hooks.
+func serveCommand(args []string) error {
+	flags := newCommandFlags("serve")
+	f := addServeFlags(flags)
+	rest, err := parseInterspersed(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return subcmd.Errorf(subcmd.KindUsage, "usage: ch serve [-listen addr] [-token token] [-config file] [-ui]")
+	}
+
+	cfg, err := loadUserConfig(*f.configPath)
+	if err != nil {
+		return err
+	}
+	scripts, err := script.Load(cfg.Scripts...)
+	if err != nil {
+		return err
+	}
+	scripts.RegisterSubcommands()
+
+	httpTransport, err := cfg.transport(transport.Options{})
+	if err != nil {
+		return err
+	}
+	// Requests can run commands, so they always need a token, lest any
+	// web page the user visits send them.
+	token := *f.token
+	if token == "" {
+		if token, err = keyring.Lookup("serve", "CH_TOKEN"); err != nil {
+			if token, err = randomToken(); err != nil {
+				return err
+			}
+			fmt.Printf("Token: %s (set $CH_TOKEN to it for ch -push)\n", token)
+		}
+	}
+	s := &server{cfg: cfg, transport: httpTransport, scripts: scripts, cache: openRenderCache(cfg), token: token, listen: *f.listen, ui: *f.ui}
+	fmt.Printf("Listening on %s\n", *f.listen)
+	if s.ui {
+		fmt.Printf("Web UI at %s\n", uiURL(*f.listen, token))
+	}
+	return http.ListenAndServe(*f.listen, s.handler())
+}
+
+func (s *server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok\n")
+	})
+	mux.HandleFunc("POST /render", s.handleRender)
+	mux.HandleFunc("POST /push", s.handlePush)
+	mux.HandleFunc("GET /events", s.handleEvents)
+	if !s.ui {
+		return s.checkHost(s.authorize(mux))
+	}
+	// The page itself holds no data, so it is served without the token,
+	// which it reads from its URL and sends with its own requests.
+	mux.HandleFunc("GET /files", s.handleFiles)
+	outer := http.NewServeMux()
+	outer.HandleFunc("GET /{$}", serveUIPage)
+	outer.Handle("/", s.authorize(mux))
+	return s.checkHost(outer)
+}
+
+// randomToken returns a new random bearer token.
+func randomToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate a token: %v", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// checkHost rejects requests whose Host, or whose Origin if a web page
+// sent them, isn't the address the server listens on, so that other web
+// pages can't reach the server, even by DNS rebinding. Browser extensions'
+// origins can't be forged by pages, so they are let through.
+func (s *server) checkHost(next http.Handler) http.Handler {
+	if s.listen == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.listensOn(r.Host, "80") {
+			http.Error(w, fmt.Sprintf("unexpected host %q", r.Host), http.StatusForbidden)
+			return
+		}
+		if origin := r.Header.Get("Origin"); origin != "" {
+			u, err := url.Parse(origin)
+			web := err != nil || u.Scheme == "http" || u.Scheme == "https" || origin == "null"
+			defaultPort := "80"
+			if err == nil && u.Scheme == "https" {
+				defaultPort = "443"
+			}
+			if web && (err != nil || !s.listensOn(u.Host, defaultPort)) {
+				http.Error(w, fmt.Sprintf("requests from %s are not allowed", origin), http.StatusForbidden)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// listensOn reports whether hostport, with defaultPort if it has none,
+// names the server's listen address. Any name for the loopback interface
+// will do when the server listens there, and any host when it listens on
+// every interface, since it can't know the names it is reached by.
+func (s *server) listensOn(hostport, defaultPort string) bool {
+	listenHost, listenPort, err := net.SplitHostPort(s.listen)
+	if err != nil {
+		return false
+	}
+	host, port, err := net.SplitHostPort(hostport)
+	if err != nil {
+		host, port = strings.Trim(hostport, "[]"), defaultPort
+	}
+	if port != listenPort {
+		return false
+	}
+	if ip := net.ParseIP(listenHost); listenHost == "" || (ip != nil && ip.IsUnspecified()) {
+		return true
+	}
+	if isLoopback(listenHost) {
+		return isLoopback(host)
+	}
+	return strings.EqualFold(host, listenHost)
+}
+
+func isLoopback(host string) bool {
+	ip := net.ParseIP(host)
+	return strings.EqualFold(host, "localhost") || (ip != nil && ip.IsLoopback())
+}
+
+// requireJSON reports whether r has a JSON body, answering 415 if not.
+// Requiring the type keeps web pages from sending requests without a CORS
+// preflight, which the server doesn't answer.
+func requireJSON(w http.ResponseWriter, r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		http.Error(w, "expected Content-Type: application/json", http.StatusUnsupportedMediaType)
+		return false
+	}
+	return true
+}
+
+// authorize rejects requests without the server's bearer token, if it has
+// one.
+func (s *server) authorize(next http.Handler) http.Handler {
+	if s.token == "" {
+		return next
+	}
+	expected := []byte("Bearer " + s.token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			http.Error(w, "missing or invalid bearer token", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *server) handleRender(w http.ResponseWriter, r *http.Request) {
+	if !requireJSON(w, r) {
+		return
+	}
+	var req renderRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	response, err := s.render(r.Context(), req)
+	s.mu.Unlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	if req.Format == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+	w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+	io.WriteString(w, response.Markdown)
+}
+
+// render runs req through the same pipeline as the command line. The
+// entries are exported only for format "json". Subcommands are cancelled if
+// ctx, the request's context, is done because the client went away.
+func (s *server) render(ctx context.Context, req renderRequest) (renderResponse, error) {
+	switch req.Format {
+	case "", "markdown", "json":
+	default:
+		return renderResponse{}, fmt.Errorf("invalid format %q (expected markdown or json)", req.Format)
+	}
+	if err := req.validate(); err != nil {
+		return renderResponse{}, err
+	}
+
+	sc, err := subcmd.NewContext()
+	if err != nil {
+		return renderResponse{}, err
+	}
+	defer sc.Cleanup()
+	sc.KeepGoing = req.KeepGoing
+	sc.PruneDirs = s.cfg.PruneDirs
+	sc.PathAliases = s.cfg.pathAliases()
+	sc.AskTemplates = s.cfg.Ask
+	sc.Bundles = s.cfg.bundleScripts()
+	sc.Network = subcmd.NewNetwork(s.cfg.networkLimits(), s.transport)
+
+	entries, err := subcmd.Process(ctx, sc, req.Subcommands)
+	if err != nil {
+		return renderResponse{}, fmt.Errorf("failed to process subcommands: %v", err)
+	}
+	markdown, chunks, entries, err := req.render(sc.TempDir, entries, s.cfg, s.scripts, s.cache)
+	if err != nil {
+		return renderResponse{}, err
+	}
+	response := renderResponse{SchemaVersion: entry.SchemaVersion, Markdown: markdown, Tokens: render.ApproxTokens(markdown)}
+	if req.Format == "json" {
+		// Export before sc.Cleanup removes stored file contents.
+		list, err := entry.Export(entries)
+		if err != nil {
+			return renderResponse{}, fmt.Errorf("failed to export entries: %v", err)
+		}
+		response.Entries = list.Entries
+		if response.Messages, err = transcriptTurns(chunks, s.scripts); err != nil {
+			return renderResponse{}, fmt.Errorf("failed to run post_render hooks: %v", err)
+		}
+	}
+	return response, nil
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+	"github.com/eloquence-cloud/ch/chlib/reply"
+	"github.com/eloquence-cloud/ch/chlib/script"
+)
+
+func newTestServer(t *testing.T, token string) *httptest.Server {
+	scripts, err := script.Load()
+	if err != nil {
+		t.Fatalf("Failed to load scripts: %v", err)
+	}
+	ts := httptest.NewServer((&server{scripts: scripts, token: token}).handler())
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func postRender(t *testing.T, ts *httptest.Server, body, token string) (int, string) {
+	req, err := http.NewRequest("POST", ts.URL+"/render", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Failed to read response: %v", err)
+	}
+	return resp.StatusCode, string(content)
+}
+
+func TestServeRender(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(path, []byte("remember\n"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	request, err := json.Marshal(renderRequest{Subcommands: []string{"say", "Read this:,", "attach", path}})
+	if err != nil {
+		t.Fatalf("Failed to encode request: %v", err)
+	}
+	ts := newTestServer(t, "")
+
+	t.Run("Markdown", func(t *testing.T) {
+		status, body := postRender(t, ts, string(request), "")
+		expected := "Read this:\n\n`" + path + "`\n```\nremember\n```\n"
+		if status != http.StatusOK || body != expected {
+			t.Errorf("Expected 200 %q\n  Actual %d %q", expected, status, body)
+		}
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		status, body := postRender(t, ts, strings.Replace(string(request), "{", `{"format":"json",`, 1), "")
+		if status != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", status, body)
+		}
+		var response renderResponse
+		if err := json.Unmarshal([]byte(body), &response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if len(response.Entries) != 2 || response.Entries[1].Type != "file" || response.Entries[1].Content != "remember\n" {
+			t.Errorf("Unexpected entries: %+v", response.Entries)
+		}
+		if !strings.HasPrefix(response.Markdown, "Read this:") {
+			t.Errorf("Unexpected markdown: %q", response.Markdown)
+		}
+		if len(response.Messages) != 1 || response.Messages[0].Role != "user" || response.Messages[0].Content != strings.TrimSuffix(response.Markdown, "\n") {
+			t.Errorf("Expected the markdown as one user turn\n  Actual %+v", response.Messages)
+		}
+	})
+	t.Run("Reply format", func(t *testing.T) {
+		isolateStorage(t)
+		status, body := postRender(t, ts, strings.Replace(string(request), "{", `{"replyFormat":"diff",`, 1), "")
+		id := entry.FileID(path)
+		instructions, _ := reply.Instructions(reply.FormatDiff)
+		if status != http.StatusOK || !strings.Contains(body, "```text id="+id) || !strings.HasSuffix(body, instructions) {
+			t.Errorf("Expected the file tagged with ID %s, then the diff instructions\n  Actual %d %q", id, status, body)
+		}
+	})
+}
+
+func TestServeErrors(t *testing.T) {
+	ts := newTestServer(t, "secret")
+
+	testCases := []struct {
+		name     string
+		body     string
+		token    string
+		expected int
+	}{
+		{name: "Missing token", body: `{"subcommands": ["say", "hi"]}`, expected: http.StatusUnauthorized},
+		{name: "Wrong token", body: `{"subcommands": ["say", "hi"]}`, token: "guess", expected: http.StatusUnauthorized},
+		{name: "Valid token", body: `{"subcommands": ["say", "hi"]}`, token: "secret", expected: http.StatusOK},
+		{name: "Malformed body", body: `{"subcommands": "say hi"}`, token: "secret", expected: http.StatusBadRequest},
+		{name: "Unknown field", body: `{"subcommand": ["say"]}`, token: "secret", expected: http.StatusBadRequest},
+		{name: "Invalid format", body: `{"subcommands": ["say", "hi"], "format": "html"}`, token: "secret", expected: http.StatusUnprocessableEntity},
+		{name: "Invalid reply format", body: `{"subcommands": ["say", "hi"], "replyFormat": "xml"}`, token: "secret", expected: http.StatusUnprocessableEntity},
+		{name: "Failing subcommand", body: `{"subcommands": ["insert", "/nonexistent/file"]}`, token: "secret", expected: http.StatusUnprocessableEntity},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			status, body := postRender(t, ts, tc.body, tc.token)
+			if status != tc.expected {
+				t.Errorf("Expected status %d, got %d: %s", tc.expected, status, body)
+			}
+		})
+	}
+}
+
+func TestServeRequiresJSON(t *testing.T) {
+	ts := newTestServer(t, "")
+	for _, path := range []string{"/render", "/push"} {
+		resp, err := http.Post(ts.URL+path, "text/plain", strings.NewReader(`{"subcommands": ["say", "hi"]}`))
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnsupportedMediaType {
+			t.Errorf("POST %s as text/plain\nExpected: %d\n  Actual: %d", path, http.StatusUnsupportedMediaType, resp.StatusCode)
+		}
+	}
+}
+
+func TestServeCheckHost(t *testing.T) {
+	testCases := []struct {
+		name, listen, host, origin string
+		expected                   int
+	}{
+		{name: "Listen address", listen: "localhost:8377", host: "localhost:8377", expected: http.StatusOK},
+		{name: "Loopback IP", listen: "localhost:8377", host: "127.0.0.1:8377", expected: http.StatusOK},
+		{name: "IPv6 loopback", listen: "[::1]:8377", host: "[::1]:8377", expected: http.StatusOK},
+		{name: "Rebound name", listen: "localhost:8377", host: "attacker.example:8377", expected: http.StatusForbidden},
+		{name: "Other port", listen: "localhost:8377", host: "localhost:9000", expected: http.StatusForbidden},
+		{name: "Default port", listen: "localhost:80", host: "localhost", expected: http.StatusOK},
+		{name: "All interfaces", listen: ":8377", host: "build.example:8377", expected: http.StatusOK},
+		{name: "Named host", listen: "build.example:8377", host: "build.example:8377", expected: http.StatusOK},
+		{name: "Other named host", listen: "build.example:8377", host: "localhost:8377", expected: http.StatusForbidden},
+		{name: "Own origin", listen: "localhost:8377", host: "localhost:8377", origin: "http://localhost:8377", expected: http.StatusOK},
+		{name: "Foreign origin", listen: "localhost:8377", host: "localhost:8377", origin: "https://attacker.example", expected: http.StatusForbidden},
+		{name: "Null origin", listen: "localhost:8377", host: "localhost:8377", origin: "null", expected: http.StatusForbidden},
+		{name: "Extension origin", listen: "localhost:8377", host: "localhost:8377", origin: "chrome-extension://abcdef", expected: http.StatusOK},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := (&server{listen: tc.listen}).checkHost(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			req := httptest.NewRequest("GET", "/health", nil)
+			req.Host = tc.host
+			if tc.origin != "" {
+				req.Header.Set("Origin", tc.origin)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tc.expected {
+				t.Errorf("Expected: %d\n  Actual: %d %s", tc.expected, rec.Code, rec.Body)
+			}
+		})
+	}
+}
+
+func TestRandomToken(t *testing.T) {
+	a, err := randomToken()
+	if err != nil {
+		t.Fatalf("randomToken failed: %v", err)
+	}
+	b, err := randomToken()
+	if err != nil {
+		t.Fatalf("randomToken failed: %v", err)
+	}
+	if len(a) != 32 || a == b {
+		t.Errorf("Expected two distinct 32-character tokens\n  Actual: %q, %q", a, b)
+	}
+}
+
+func TestServeUI(t *testing.T) {
+	root := t.TempDir()
+	for path, content := range map[string]string{"src/main.go": "package main\n", ".git/config": "[core]\n"} {
+		path = filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+	scripts, err := script.Load()
+	if err != nil {
+		t.Fatalf("Failed to load scripts: %v", err)
+	}
+	ts := httptest.NewServer((&server{scripts: scripts, token: "secret", ui: true, root: root}).handler())
+	defer ts.Close()
+	plain := newTestServer(t, "")
+
+	get := func(url, token string) (int, string) {
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		content, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("Failed to read response: %v", err)
+		}
+		return resp.StatusCode, string(content)
+	}
+
+	testCases := []struct {
+		name     string
+		url      string
+		token    string
+		expected int
+		contains string
+	}{
+		{name: "Page needs no token", url: ts.URL + "/", expected: http.StatusOK, contains: "<title>ch</title>"},
+		{name: "Files need the token", url: ts.URL + "/files", expected: http.StatusUnauthorized},
+		{name: "Files", url: ts.URL + "/files", token: "secret", expected: http.StatusOK, contains: `"path":"` + filepath.ToSlash(root) + `/src/main.go","bytes":13,"tokens":4}`},
+		{name: "Other paths need the token", url: ts.URL + "/health", expected: http.StatusUnauthorized},
+		{name: "No page without -ui", url: plain.URL + "/", expected: http.StatusNotFound},
+		{name: "No files without -ui", url: plain.URL + "/files", expected: http.StatusNotFound},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			status, body := get(tc.url, tc.token)
+			if status != tc.expected || !strings.Contains(body, tc.contains) {
+				t.Errorf("Expected %d with %q\n  Actual %d %q", tc.expected, tc.contains, status, body)
+			}
+			if strings.Contains(body, ".git") {
+				t.Errorf("Expected .git to be pruned\n  Actual: %s", body)
+			}
+		})
+	}
+}
+
+func TestUIURL(t *testing.T) {
+	testCases := []struct {
+		listen, token, expected string
+	}{
+		{"localhost:8377", "", "http://localhost:8377/"},
+		{":8377", "", "http://localhost:8377/"},
+		{"[::1]:9000", "a b", "http://[::1]:9000/#token=a+b"},
+	}
+	for _, tc := range testCases {
+		if actual := uiURL(tc.listen, tc.token); actual != tc.expected {
+			t.Errorf("uiURL(%q, %q)\nExpected: %q\n  Actual: %q", tc.listen, tc.token, tc.expected, actual)
+		}
+	}
+}
+
+func TestServePush(t *testing.T) {
+	ts := newTestServer(t, "secret")
+	t.Setenv("CH_SERVER", ts.URL)
+	oldMessages := messages
+	defer func() { messages = oldMessages }()
+	var sent strings.Builder
+	messages = &sent
+
+	t.Setenv("CH_TOKEN", "guess")
+	if err := pushMarkdown("nobody", nil); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("Expected an unauthorized push to fail, got: %v", err)
+	}
+	t.Setenv("CH_TOKEN", "secret")
+
+	req, err := http.NewRequest("GET", ts.URL+"/events", nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Expected an event stream\n  Actual: %q", ct)
+	}
+	events := bufio.NewReader(resp.Body)
+	if line, err := events.ReadString('\n'); err != nil || !strings.HasPrefix(line, ":") {
+		t.Fatalf("Expected a comment when listening, got %q, %v", line, err)
+	}
+
+	if err := pushMarkdown("Hello,\nworld\n", nil); err != nil {
+		t.Fatalf("Push failed: %v", err)
+	}
+	if expected := "Markdown pushed to 1 listener at " + ts.URL + ".\n"; sent.String() != expected {
+		t.Errorf("Expected message %q\n  Actual: %q", expected, sent.String())
+	}
+	var lines []string
+	for len(lines) < 3 {
+		line, err := events.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Failed to read event: %v", err)
+		}
+		if line = strings.TrimSuffix(line, "\n"); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	expected := []string{"id: 1", "event: markdown", `data: {"markdown":"Hello,\nworld\n","tokens":4}`}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Errorf("Expected event %q\n  Actual: %q", expected, lines)
+	}
+}
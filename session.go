@@ -0,0 +1,445 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+	"github.com/eloquence-cloud/ch/chlib/render"
+	"github.com/eloquence-cloud/ch/chlib/subcmd"
+)
+
+// sessionStore keeps sessions: conversations built up across runs with
+// -session, each stored in dir as an entry list (the -export format), so
+// that stored files keep the content they had when they were added.
+type sessionStore struct {
+	dir string
+}
+
+// defaultSessions returns the sessions in the data directory.
+func defaultSessions() (sessionStore, error) {
+	dir, err := dataDir()
+	if err != nil {
+		return sessionStore{}, err
+	}
+	return sessionStore{dir: filepath.Join(dir, "sessions")}, nil
+}
+
+func (s sessionStore) path(name string) (string, error) {
+	if !storedNamePattern.MatchString(name) {
+		return "", usageError("invalid session name %q (use letters, digits, '.', '_', and '-')", name)
+	}
+	return filepath.Join(s.dir, name+".json"), nil
+}
+
+// load returns the entries of the named session, with the contents of
+// files stored in tempDir, and whether there is such a session.
+func (s sessionStore) load(name, tempDir string) ([]entry.Entry, bool, error) {
+	path, err := s.path(name)
+	if err != nil {
+		return nil, false, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	var list entry.List
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, false, fmt.Errorf("session %q is corrupt: %v", name, err)
+	}
+	entries, err := entry.Import(tempDir, list)
+	if err != nil {
+		return nil, false, fmt.Errorf("session %q is corrupt: %v", name, err)
+	}
+	return entries, true, nil
+}
+
+// mustLoad is load for a session that must exist.
+func (s sessionStore) mustLoad(name, tempDir string) ([]entry.Entry, error) {
+	entries, ok, err := s.load(name, tempDir)
+	if err == nil && !ok {
+		err = subcmd.Errorf(subcmd.KindMissingFile, "no session named %q", name)
+	}
+	return entries, err
+}
+
+// save stores entries as the named session, replacing what was stored.
+// Sessions are private to the user, since they hold whatever was attached.
+func (s sessionStore) save(name string, entries []entry.Entry) error {
+	path, err := s.path(name)
+	if err != nil {
+		return err
+	}
+	list, err := entry.Export(entries)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0600)
+}
+
+// drop removes the named session.
+func (s sessionStore) drop(name string) error {
+	path, err := s.path(name)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return subcmd.Errorf(subcmd.KindMissingFile, "no session named %q", name)
+	}
+	return err
+}
+
+// names returns the names of the stored sessions, in alphabetical order.
+func (s sessionStore) names() ([]string, error) {
+	files, err := os.ReadDir(s.dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	var names []string
+	for _, file := range files {
+		if name, ok := strings.CutSuffix(file.Name(), ".json"); ok && storedNamePattern.MatchString(name) {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// splitTurns splits entries into turns, each starting with its entry.Turn.
+// Entries before the first turn make a turn of their own, without one.
+func splitTurns(entries []entry.Entry) [][]entry.Entry {
+	var turns [][]entry.Entry
+	for _, e := range entries {
+		if _, ok := entry.Unwrap(e).(entry.Turn); ok || len(turns) == 0 {
+			turns = append(turns, nil)
+		}
+		turns[len(turns)-1] = append(turns[len(turns)-1], e)
+	}
+	return turns
+}
+
+// turnRole returns the role of a turn from splitTurns: that of its
+// entry.Turn, or user for the entries before the first turn.
+func turnRole(turn []entry.Entry) string {
+	if t, ok := entry.Unwrap(turn[0]).(entry.Turn); ok {
+		return t.Role
+	}
+	return "user"
+}
+
+// compactOptions control how compactSession shrinks a session.
+type compactOptions struct {
+	// target is the size the session is brought within, if it can be.
+	target render.Limit
+	// keep is the number of recent turns that are always kept verbatim.
+	keep int
+	// summarizer, if set, is the command line of a program, such as a
+	// local model, that reads earlier turns on stdin and writes their
+	// summary on stdout. Otherwise a brief outline of each turn is made.
+	summarizer string
+}
+
+// compactSession returns entries with their earlier turns replaced by a
+// summary, so that the session fits within opts.target, and the number of
+// turns summarized. As many recent turns are kept verbatim as fit in three
+// quarters of the target, and at least opts.keep of them. System turns,
+// which hold instructions, are always kept.
+func compactSession(ctx context.Context, entries []entry.Entry, opts compactOptions) ([]entry.Entry, int, error) {
+	measure := func(entries []entry.Entry) int {
+		return opts.target.Measure(render.Markdown(entries, entry.RenderOptions{}))
+	}
+	if measure(entries) <= opts.target.Amount {
+		return entries, 0, nil
+	}
+
+	var system, rest [][]entry.Entry
+	for _, turn := range splitTurns(entries) {
+		if turnRole(turn) == "system" {
+			system = append(system, turn)
+		} else {
+			rest = append(rest, turn)
+		}
+	}
+	kept := min(opts.keep, len(rest))
+	for kept < len(rest) && measure(flatten(system, rest[len(rest)-kept-1:])) <= opts.target.Amount*3/4 {
+		kept++
+	}
+	earlier, recent := rest[:len(rest)-kept], rest[len(rest)-kept:]
+	if len(earlier) == 0 {
+		return entries, 0, nil
+	}
+
+	budget := opts.target.Amount - measure(flatten(system, recent))
+	var summary string
+	var err error
+	if opts.summarizer != "" {
+		summary, err = summarizeTurns(ctx, opts.summarizer, flatten(earlier), budget, opts.target)
+		if err != nil {
+			return nil, 0, err
+		}
+	} else {
+		summary = outlineTurns(earlier, budget, opts.target)
+	}
+
+	compacted := flatten(system)
+	compacted = append(compacted, entry.Turn{Role: "user"}, entry.Message{
+		Text:   fmt.Sprintf("Summary of the %d earlier turns of this conversation:\n\n%s", len(earlier), summary),
+		Source: "ch session compact",
+	})
+	if len(recent) > 0 && turnRole(recent[0]) == "user" {
+		// Run the summary into the user turn that follows it, rather than
+		// have two user turns in a row.
+		if _, ok := entry.Unwrap(recent[0][0]).(entry.Turn); ok {
+			recent[0] = recent[0][1:]
+		}
+	}
+	return append(compacted, flatten(recent)...), len(earlier), nil
+}
+
+// flatten joins groups of turns back into a list of entries.
+func flatten(groups ...[][]entry.Entry) []entry.Entry {
+	var entries []entry.Entry
+	for _, turns := range groups {
+		for _, turn := range turns {
+			entries = append(entries, turn...)
+		}
+	}
+	return entries
+}
+
+// outlineTurns summarizes turns without a model: a line for each, giving
+// the start of what was said and what was attached or run. Lines for the
+// earliest turns are left out as needed to fit budget.
+func outlineTurns(turns [][]entry.Entry, budget int, limit render.Limit) string {
+	lines := make([]string, len(turns))
+	for i, turn := range turns {
+		var parts []string
+		for _, e := range turn {
+			switch e := entry.Unwrap(e).(type) {
+			case entry.Message:
+				parts = append(parts, shorten(strings.Join(strings.Fields(e.Text), " "), 200))
+			case entry.File:
+				parts = append(parts, fmt.Sprintf("attached `%s`", e.DisplayPath()))
+			case entry.Output:
+				parts = append(parts, fmt.Sprintf("ran `%s`", e.Command))
+			case entry.Diff:
+				parts = append(parts, fmt.Sprintf("diffed `%s`", e.Path))
+			}
+		}
+		role := turnRole(turn)
+		lines[i] = fmt.Sprintf("- %s%s: %s", strings.ToUpper(role[:1]), role[1:], strings.Join(parts, "; "))
+	}
+	for omitted := 0; omitted < len(lines); omitted++ {
+		outline := strings.Join(lines[omitted:], "\n")
+		if omitted > 0 {
+			outline = fmt.Sprintf("- (%d earlier turns left out)\n", omitted) + outline
+		}
+		if limit.Measure(outline) <= budget {
+			return outline
+		}
+	}
+	return fmt.Sprintf("- (%d earlier turns left out)", len(lines))
+}
+
+// shorten cuts text to at most n runes, marking the cut.
+func shorten(text string, n int) string {
+	if runes := []rune(text); len(runes) > n {
+		return string(runes[:n-1]) + "…"
+	}
+	return text
+}
+
+// summarizeTurns has the summarizer command summarize entries, the earlier
+// turns of a session, in about budget (in limit's unit).
+func summarizeTurns(ctx context.Context, summarizer string, entries []entry.Entry, budget int, limit render.Limit) (string, error) {
+	words, err := subcmd.SplitWords(summarizer)
+	if err != nil || len(words) == 0 {
+		return "", usageError("invalid -summarizer command %q", summarizer)
+	}
+	size := fmt.Sprintf("%d %s", max(budget, 1), map[bool]string{true: "tokens", false: "bytes"}[limit.Tokens])
+	prompt := fmt.Sprintf("Summarize the conversation below in at most %s, for whoever continues it. Keep decisions, facts, names of files and functions, and open questions; drop pleasantries.\n\n%s",
+		size, render.Markdown(entries, entry.RenderOptions{}))
+
+	cmd := exec.CommandContext(ctx, words[0], words[1:]...)
+	cmd.Stdin = strings.NewReader(prompt)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return "", subcmd.Errorf(subcmd.KindExec, "summarizer %s failed: %v\n%s", words[0], err, strings.TrimSpace(stderr.String()))
+	}
+	summary := strings.TrimSpace(string(output))
+	if summary == "" {
+		return "", subcmd.Errorf(subcmd.KindExec, "summarizer %s wrote no summary", words[0])
+	}
+	return summary, nil
+}
+
+// sessionFlags are the flags of "ch session".
+type sessionFlags struct {
+	target     *string
+	keep       *int
+	summarizer *string
+}
+
+func addSessionFlags(flags *flag.FlagSet) sessionFlags {
+	return sessionFlags{
+		target:     flags.String("target", "8k-tokens", "With compact, bring the session within `size` (e.g. 8k-tokens, 32k-bytes)"),
+		keep:       flags.Int("keep", 2, "With compact, always keep the last `n` turns verbatim"),
+		summarizer: flags.String("summarizer", "", "With compact, summarize earlier turns by piping them to `command`, such as a local model, instead of outlining them"),
+	}
+}
+
+// sessionCommand implements "ch session list|show|drop|compact".
+func sessionCommand(args []string) error {
+	flags := newCommandFlags("session")
+	f := addSessionFlags(flags)
+	rest, err := parseInterspersed(flags, args)
+	if err != nil {
+		return err
+	}
+	s, err := defaultSessions()
+	if err != nil {
+		return fmt.Errorf("failed to locate sessions: %v", err)
+	}
+	if len(rest) == 1 && rest[0] == "list" {
+		return listSessions(s)
+	}
+	if len(rest) != 2 {
+		return usageError("usage: ch session list | ch session show|drop|compact name")
+	}
+	name := rest[1]
+	switch rest[0] {
+	case "show":
+		tempDir, err := os.MkdirTemp("", "ch-")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(tempDir)
+		entries, err := s.mustLoad(name, tempDir)
+		if err != nil {
+			return err
+		}
+		fmt.Print(render.Markdown(entries, entry.RenderOptions{}))
+		return nil
+	case "drop":
+		if err := s.drop(name); err != nil {
+			return err
+		}
+		fmt.Fprintf(messages, "Dropped session %q.\n", name)
+		return nil
+	case "compact":
+		target, err := render.ParseLimit(*f.target)
+		if err != nil {
+			return usageError("invalid -target: %v", err)
+		}
+		if *f.keep < 0 {
+			return usageError("-keep must be 0 or more")
+		}
+		return compactStoredSession(s, name, compactOptions{target: target, keep: *f.keep, summarizer: *f.summarizer})
+	default:
+		return usageError("unknown session action %q (expected list, show, drop, or compact)", rest[0])
+	}
+}
+
+// compactStoredSession compacts the named session and stores the result.
+func compactStoredSession(s sessionStore, name string, opts compactOptions) error {
+	tempDir, err := os.MkdirTemp("", "ch-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tempDir)
+	entries, err := s.mustLoad(name, tempDir)
+	if err != nil {
+		return err
+	}
+	before := opts.target.Measure(render.Markdown(entries, entry.RenderOptions{}))
+	compacted, summarized, err := compactSession(context.Background(), entries, opts)
+	if err != nil {
+		return err
+	}
+	after := opts.target.Measure(render.Markdown(compacted, entry.RenderOptions{}))
+	unit := map[bool]string{true: "tokens", false: "bytes"}[opts.target.Tokens]
+	if summarized == 0 {
+		if before > opts.target.Amount {
+			return fmt.Errorf("session %q (%d %s) has no turns to summarize beyond the last %d; lower -keep to compact it", name, before, unit, opts.keep)
+		}
+		fmt.Fprintf(messages, "Session %q is already within %s (%d %s).\n", name, opts.target, before, unit)
+		return nil
+	}
+	if err := s.save(name, compacted); err != nil {
+		return fmt.Errorf("failed to store session %q: %v", name, err)
+	}
+	fmt.Fprintf(messages, "Compacted session %q from %d to %d %s, summarizing %d earlier turns.\n", name, before, after, unit, summarized)
+	if after > opts.target.Amount {
+		fmt.Fprintf(messages, "It is still over %s, since the last %d turns are kept verbatim.\n", opts.target, opts.keep)
+	}
+	return nil
+}
+
+// listSessions prints the stored sessions with their turns and sizes.
+func listSessions(s sessionStore) error {
+	names, err := s.names()
+	if err != nil {
+		return fmt.Errorf("failed to read sessions: %v", err)
+	}
+	if len(names) == 0 {
+		fmt.Fprintln(messages, "There are no sessions.")
+		return nil
+	}
+	tempDir, err := os.MkdirTemp("", "ch-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tempDir)
+	width := 0
+	for _, name := range names {
+		width = max(width, len(name))
+	}
+	for _, name := range names {
+		entries, err := s.mustLoad(name, tempDir)
+		if err != nil {
+			return err
+		}
+		markdown := render.Markdown(entries, entry.RenderOptions{})
+		fmt.Printf("%-*s  %d turns  ~%d tokens\n", width, name, len(splitTurns(entries)), render.ApproxTokens(markdown))
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+	"github.com/eloquence-cloud/ch/chlib/render"
+	"github.com/eloquence-cloud/ch/chlib/script"
+)
+
+func TestSessionStore(t *testing.T) {
+	s := sessionStore{dir: t.TempDir()}
+	entries := []entry.Entry{
+		entry.Turn{Role: "user"},
+		entry.Message{Text: "Why does this fail?"},
+		entry.Turn{Role: "assistant"},
+		entry.Message{Text: "It reads a closed file."},
+	}
+	if err := s.save("fix-auth", entries); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	loaded, ok, err := s.load("fix-auth", t.TempDir())
+	if err != nil || !ok {
+		t.Fatalf("load: %v, %v", ok, err)
+	}
+	want := render.Markdown(entries, entry.RenderOptions{})
+	if got := render.Markdown(loaded, entry.RenderOptions{}); got != want {
+		t.Errorf("Expected %q\n  Actual %q", want, got)
+	}
+	if _, ok, err := s.load("other", t.TempDir()); ok || err != nil {
+		t.Errorf("Expected no session, no error\n  Actual %v, %v", ok, err)
+	}
+
+	names, err := s.names()
+	if err != nil || !slices.Equal(names, []string{"fix-auth"}) {
+		t.Errorf("Expected names [fix-auth]\n  Actual %q, %v", names, err)
+	}
+	if err := s.drop("fix-auth"); err != nil {
+		t.Fatalf("drop: %v", err)
+	}
+	if _, err := s.mustLoad("fix-auth", t.TempDir()); err == nil {
+		t.Errorf("Expected an error for a dropped session")
+	}
+	if err := s.save("../escape", entries); err == nil {
+		t.Errorf("Expected an error for session name %q", "../escape")
+	}
+}
+
+// conversation returns a session of n exchanges, each a long user message
+// and a reply, after a system turn.
+func conversation(n int) []entry.Entry {
+	entries := []entry.Entry{entry.Turn{Role: "system"}, entry.Message{Text: "Answer briefly."}}
+	for i := range n {
+		entries = append(entries,
+			entry.Turn{Role: "user"}, entry.Message{Text: strings.Repeat("question ", 50) + string(rune('A'+i))},
+			entry.Turn{Role: "assistant"}, entry.Message{Text: strings.Repeat("answer ", 50)},
+		)
+	}
+	return entries
+}
+
+func TestCompactSession(t *testing.T) {
+	target := render.Limit{Amount: 400, Tokens: true}
+	entries := conversation(8)
+
+	compacted, summarized, err := compactSession(context.Background(), entries, compactOptions{target: target, keep: 2})
+	if err != nil {
+		t.Fatalf("compactSession: %v", err)
+	}
+	if summarized == 0 {
+		t.Fatalf("Expected earlier turns to be summarized")
+	}
+	markdown := render.Markdown(compacted, entry.RenderOptions{})
+	if size := target.Measure(markdown); size > target.Amount {
+		t.Errorf("Expected at most %d tokens\n  Actual %d:\n%s", target.Amount, size, markdown)
+	}
+	for _, want := range []string{"Answer briefly.", "Summary of the", "- User: question", strings.Repeat("question ", 50) + "H"} {
+		if !strings.Contains(markdown, want) {
+			t.Errorf("Expected output to contain %q\n  Actual:\n%s", want, markdown)
+		}
+	}
+	turns := splitTurns(compacted)
+	if got := turnRole(turns[0]); got != "system" {
+		t.Errorf("Expected the system turn first\n  Actual %s", got)
+	}
+	if got, want := len(turns), 1+len(splitTurns(entries))-1-summarized; got != want {
+		t.Errorf("Expected %d turns\n  Actual %d", want, got)
+	}
+
+	// A session within the target is left alone.
+	same, summarized, err := compactSession(context.Background(), conversation(1), compactOptions{target: target, keep: 2})
+	if err != nil || summarized != 0 || len(same) != len(conversation(1)) {
+		t.Errorf("Expected an unchanged session\n  Actual %d entries, %d summarized, %v", len(same), summarized, err)
+	}
+}
+
+func TestCompactSessionSummarizer(t *testing.T) {
+	// A stand-in for a local model: it reads the prompt and writes a summary.
+	dir := t.TempDir()
+	script := "#!/bin/sh\ncat > " + filepath.Join(dir, "prompt") + "\necho 'They asked eight questions.'\n"
+	if err := os.WriteFile(filepath.Join(dir, "summarize"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := compactOptions{target: render.Limit{Amount: 400, Tokens: true}, keep: 1, summarizer: filepath.Join(dir, "summarize") + " --brief"}
+	compacted, _, err := compactSession(context.Background(), conversation(8), opts)
+	if err != nil {
+		t.Fatalf("compactSession: %v", err)
+	}
+	if markdown := render.Markdown(compacted, entry.RenderOptions{}); !strings.Contains(markdown, "They asked eight questions.") {
+		t.Errorf("Expected the summarizer's summary\n  Actual:\n%s", markdown)
+	}
+	prompt, err := os.ReadFile(filepath.Join(dir, "prompt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(prompt), "Summarize the conversation") || !strings.Contains(string(prompt), "question A") {
+		t.Errorf("Expected the prompt to hold the instructions and earlier turns\n  Actual:\n%s", prompt)
+	}
+
+	opts.summarizer = "false"
+	if _, _, err := compactSession(context.Background(), conversation(8), opts); err == nil {
+		t.Errorf("Expected an error from a failing summarizer")
+	}
+}
+
+func TestInvocationSession(t *testing.T) {
+	scripts, err := script.Load()
+	if err != nil {
+		t.Fatalf("Failed to load scripts: %v", err)
+	}
+	isolateStorage(t)
+	outputPath := filepath.Join(t.TempDir(), "out.md")
+	for _, subcommands := range [][]string{
+		{"turn", "user", "How", "do", "I", "fix", "the", "race?"},
+		{"turn", "assistant", "Use", "a", "mutex.,", "turn", "user", "It", "still", "fails."},
+	} {
+		inv := &invocation{subcommands: subcommands, outputFile: outputPath, session: "race", scripts: scripts}
+		if _, err := inv.run(context.Background()); err != nil {
+			t.Fatalf("Run failed: %v", err)
+		}
+	}
+	data, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to read output: %v", err)
+	}
+	for _, part := range []string{"## User\n\nHow do I fix the race?\n", "## Assistant\n\nUse a mutex.\n", "## User\n\nIt still fails.\n"} {
+		if !strings.Contains(string(data), part) {
+			t.Errorf("Expected output to contain %q\n  Actual:\n%s", part, data)
+		}
+	}
+
+	s, err := defaultSessions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := s.mustLoad("race", t.TempDir())
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if got := len(splitTurns(entries)); got != 3 {
+		t.Errorf("Expected 3 stored turns\n  Actual %d", got)
+	}
+}
@@ -0,0 +1,227 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/eloquence-cloud/ch/chlib/subcmd"
+	"golang.design/x/clipboard"
+)
+
+// storedNamePattern matches the names that stashes and sessions are stored
+// under.
+var storedNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// stash stores named outputs, one file each in dir, for reuse across
+// sessions. Unlike the clip history, stashed outputs are kept until they
+// are dropped.
+type stash struct {
+	dir string
+}
+
+// defaultStash returns the stash in the data directory.
+func defaultStash() (stash, error) {
+	dir, err := dataDir()
+	if err != nil {
+		return stash{}, err
+	}
+	return stash{dir: filepath.Join(dir, "stash")}, nil
+}
+
+func (s stash) path(name string) (string, error) {
+	if !storedNamePattern.MatchString(name) {
+		return "", usageError("invalid stash name %q (use letters, digits, '.', '_', and '-')", name)
+	}
+	return filepath.Join(s.dir, name+".md"), nil
+}
+
+// save stores markdown under name, replacing any output stashed there.
+func (s stash) save(name, markdown string) error {
+	path, err := s.path(name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(markdown), 0600)
+}
+
+// get returns the output stashed under name.
+func (s stash) get(name string) (string, error) {
+	path, err := s.path(name)
+	if err != nil {
+		return "", err
+	}
+	markdown, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", subcmd.Errorf(subcmd.KindMissingFile, "no stash named %q", name)
+	}
+	return string(markdown), err
+}
+
+// drop removes the output stashed under name.
+func (s stash) drop(name string) error {
+	path, err := s.path(name)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return subcmd.Errorf(subcmd.KindMissingFile, "no stash named %q", name)
+	}
+	return err
+}
+
+// names returns the names of the stashed outputs, in alphabetical order.
+func (s stash) names() ([]string, error) {
+	files, err := os.ReadDir(s.dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	var names []string
+	for _, file := range files {
+		if name, ok := strings.CutSuffix(file.Name(), ".md"); ok && storedNamePattern.MatchString(name) {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// stashFlags are the flags of "ch stash".
+type stashFlags struct {
+	output outputFlags
+	file   *string
+}
+
+func addStashFlags(flags *flag.FlagSet) stashFlags {
+	return stashFlags{
+		output: addOutputFlags(flags),
+		file:   flags.String("f", "", "With save, stash the contents of `file` (- for stdin) instead of the clipboard"),
+	}
+}
+
+// stashCommand implements "ch stash save|list|copy|show|drop".
+func stashCommand(args []string) error {
+	flags := newCommandFlags("stash")
+	f := addStashFlags(flags)
+	rest, err := parseInterspersed(flags, args)
+	if err != nil {
+		return err
+	}
+	s, err := defaultStash()
+	if err != nil {
+		return fmt.Errorf("failed to locate stash: %v", err)
+	}
+	if len(rest) == 1 && rest[0] == "list" {
+		return listStash(s)
+	}
+	if len(rest) != 2 {
+		return usageError("usage: ch stash list | ch stash save|copy|drop name")
+	}
+	name := rest[1]
+	switch rest[0] {
+	case "save":
+		markdown, err := readInput(*f.file, "stash")
+		if err != nil {
+			return err
+		}
+		if err := s.save(name, markdown); err != nil {
+			return err
+		}
+		fmt.Fprintf(messages, "Stashed %q.\n", name)
+		return nil
+	case "copy":
+		markdown, err := s.get(name)
+		if err != nil {
+			return err
+		}
+		if !*f.output.copyToClipboard && *f.output.outputFile == "" {
+			*f.output.copyToClipboard = true
+		}
+		return f.output.write(markdown)
+	case "drop":
+		if err := s.drop(name); err != nil {
+			return err
+		}
+		fmt.Fprintf(messages, "Dropped %q.\n", name)
+		return nil
+	default:
+		return usageError("unknown stash action %q (expected save, list, copy, or drop)", rest[0])
+	}
+}
+
+// readInput returns the text for a command to use, such as an output to
+// stash: the contents of file, stdin for "-", or the clipboard when file is
+// "". The purpose completes "nothing to ..." if there is no text.
+func readInput(file, purpose string) (string, error) {
+	var content []byte
+	var err error
+	switch file {
+	case "":
+		if err := clipboard.Init(); err != nil {
+			return "", subcmd.Errorf(subcmd.KindOutput, "failed to initialize clipboard: %v", err)
+		}
+		content = clipboard.Read(clipboard.FmtText)
+	case "-":
+		content, err = io.ReadAll(os.Stdin)
+	default:
+		content, err = os.ReadFile(file)
+	}
+	if err != nil {
+		return "", subcmd.Errorf(subcmd.KindMissingFile, "failed to read input to %s: %v", purpose, err)
+	}
+	if len(content) == 0 {
+		return "", usageError("nothing to %s: the clipboard or input is empty", purpose)
+	}
+	return string(content), nil
+}
+
+// listStash prints the stashed outputs with their sizes and first lines.
+func listStash(s stash) error {
+	names, err := s.names()
+	if err != nil {
+		return fmt.Errorf("failed to read stash: %v", err)
+	}
+	if len(names) == 0 {
+		fmt.Fprintln(messages, "The stash is empty.")
+		return nil
+	}
+	width := 0
+	for _, name := range names {
+		width = max(width, len(name))
+	}
+	for _, name := range names {
+		markdown, err := s.get(name)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%-*s  %s\n", width, name, describeOutput(markdown))
+	}
+	return nil
+}
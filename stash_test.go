@@ -0,0 +1,45 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestStash(t *testing.T) {
+	s := stash{dir: t.TempDir()}
+	for name, markdown := range map[string]string{"review-ctx": "review", "bug_42.v2": "bug", "review-ctx2": "other"} {
+		if err := s.save(name, markdown); err != nil {
+			t.Fatalf("save %s: %v", name, err)
+		}
+	}
+	if err := s.save("review-ctx", "review, again"); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	names, err := s.names()
+	if err != nil {
+		t.Fatalf("names: %v", err)
+	}
+	if want := []string{"bug_42.v2", "review-ctx", "review-ctx2"}; !slices.Equal(names, want) {
+		t.Errorf("Expected names %q\n  Actual %q", want, names)
+	}
+	if got, err := s.get("review-ctx"); err != nil || got != "review, again" {
+		t.Errorf("Expected %q\n  Actual %q, %v", "review, again", got, err)
+	}
+
+	if err := s.drop("review-ctx"); err != nil {
+		t.Fatalf("drop: %v", err)
+	}
+	if _, err := s.get("review-ctx"); err == nil {
+		t.Errorf("Expected an error for a dropped stash")
+	}
+	if err := s.drop("review-ctx"); err == nil {
+		t.Errorf("Expected an error for dropping a missing stash")
+	}
+
+	for _, name := range []string{"", ".hidden", "../escape", "a/b", "has space"} {
+		if err := s.save(name, "x"); err == nil {
+			t.Errorf("Expected an error for stash name %q", name)
+		}
+	}
+}
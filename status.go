@@ -0,0 +1,160 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+	"github.com/eloquence-cloud/ch/chlib/subcmd"
+)
+
+// resultStatus is the JSON object -json-status prints when a run finishes,
+// for wrapper scripts and editor plugins.
+type resultStatus struct {
+	// SchemaVersion is entry.SchemaVersion, which versions the status
+	// along with the other JSON that ch writes.
+	SchemaVersion int `json:"schemaVersion"`
+
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+	// ErrorKind classifies Error (see subcmd.ErrorKind), matching ch's exit
+	// status: "usage", "missing-file", "remote", "exec", "output", or
+	// "other".
+	ErrorKind string `json:"errorKind,omitempty"`
+	// Destination is where the output went: "clipboard", "stdout", "file",
+	// "push" when only -push was given, "send" when only -send was given,
+	// or "export" when only -export was given. Path names the file, as
+	// host:/path if it was uploaded.
+	Destination string `json:"destination,omitempty"`
+	Path        string `json:"path,omitempty"`
+	// Parts is the number of parts -split divided the output into, if more
+	// than one.
+	Parts   int `json:"parts,omitempty"`
+	Entries int `json:"entries"`
+	Bytes   int `json:"bytes"`
+	Tokens  int `json:"tokens"`
+	// Reply is the reply to the output sent with -send.
+	Reply *replyStatus `json:"reply,omitempty"`
+	// Warnings are the warnings logged during the run, such as failures
+	// that -keep-going carried on past.
+	Warnings []string `json:"warnings"`
+}
+
+// finish records the outcome of the run.
+func (s *resultStatus) finish(err error, warnings []string) {
+	s.SchemaVersion = entry.SchemaVersion
+	s.Success = err == nil
+	if err != nil {
+		s.Error, s.ErrorKind = err.Error(), subcmd.KindOf(err).String()
+	}
+	s.Warnings = warnings
+	if s.Warnings == nil {
+		s.Warnings = []string{}
+	}
+}
+
+// destination describes where writeOutput (or, with only -push,
+// pushMarkdown) delivers output, for resultStatus.
+func destination(copyToClipboard bool, outputFile string, push bool) (string, string) {
+	switch {
+	case copyToClipboard:
+		return "clipboard", ""
+	case outputFile == "-":
+		return "stdout", ""
+	case outputFile == "" && push:
+		return "push", ""
+	default:
+		return "file", outputFile
+	}
+}
+
+// warningLog collects the warnings and errors logged through slog, as
+// well as passing them on to be logged as usual.
+type warningLog struct {
+	mu       sync.Mutex
+	warnings []string
+}
+
+// recordWarnings installs a warningLog in front of the slog handler set up
+// by setupLogging.
+func recordWarnings() *warningLog {
+	w := &warningLog{}
+	setDefaultHandler(warningHandler{Handler: slog.Default().Handler(), log: w})
+	return w
+}
+
+// reset forgets the warnings recorded so far.
+func (w *warningLog) reset() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.warnings = nil
+}
+
+// take returns the warnings recorded since the last reset.
+func (w *warningLog) take() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.warnings
+}
+
+func (w *warningLog) add(warning string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.warnings = append(w.warnings, warning)
+}
+
+// warningHandler is the slog.Handler installed by recordWarnings.
+type warningHandler struct {
+	slog.Handler
+	log *warningLog
+}
+
+func (h warningHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= slog.LevelWarn || h.Handler.Enabled(ctx, level)
+}
+
+func (h warningHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level >= slog.LevelWarn {
+		var warning strings.Builder
+		warning.WriteString(r.Message)
+		r.Attrs(func(a slog.Attr) bool {
+			fmt.Fprintf(&warning, " %s=%v", a.Key, a.Value)
+			return true
+		})
+		h.log.add(warning.String())
+	}
+	if !h.Handler.Enabled(ctx, r.Level) {
+		return nil
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h warningHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return warningHandler{Handler: h.Handler.WithAttrs(attrs), log: h.log}
+}
+
+func (h warningHandler) WithGroup(name string) slog.Handler {
+	return warningHandler{Handler: h.Handler.WithGroup(name), log: h.log}
+}
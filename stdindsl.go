@@ -0,0 +1,61 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/eloquence-cloud/ch/chlib/subcmd"
+)
+
+// readSubcommands reads the subcommands of -stdin-dsl from r: lines of
+// subcommands as they are written on the command line, split into words as
+// a shell would. Each line ends a subcommand, as if it ended with a comma,
+// and blank lines and lines starting with # are skipped, as in the script
+// files that load runs.
+func readSubcommands(r io.Reader) ([]string, error) {
+	var subcommands []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	number := 1
+	for ; scanner.Scan(); number++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		words, err := subcmd.SplitWords(text)
+		if err != nil {
+			return nil, usageError("stdin:%d: %v", number, err)
+		}
+		if len(words) > 0 && !strings.HasSuffix(words[len(words)-1], ",") {
+			words[len(words)-1] += ","
+		}
+		subcommands = append(subcommands, words...)
+	}
+	if err := scanner.Err(); errors.Is(err, bufio.ErrTooLong) {
+		return nil, usageError("stdin:%d: line longer than 1 MiB", number)
+	} else if err != nil {
+		return nil, subcmd.Errorf(subcmd.KindOther, "failed to read subcommands from stdin: %v", err)
+	}
+	return subcommands, nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestReadSubcommands(t *testing.T) {
+	testCases := []struct {
+		name          string
+		input         string
+		expected      []string
+		expectedError string
+	}{
+		{name: "Empty", input: ""},
+		{
+			name:     "One line",
+			input:    "attach main.go, say \"Why, though?\"\n",
+			expected: []string{"attach", "main.go,", "say", "Why, though?,"},
+		},
+		{
+			name:     "Lines, comments, and blank lines",
+			input:    "# Context\nattach main.go\n\n  exec go test ./...,\nsay 'Why?'",
+			expected: []string{"attach", "main.go,", "exec", "go", "test", "./...,", "say", "Why?,"},
+		},
+		{
+			name:          "Unterminated quote",
+			input:         "attach main.go\nsay \"Why?\n",
+			expectedError: "stdin:2: unterminated quote or escape",
+		},
+		{
+			name:          "Line too long",
+			input:         "attach main.go\nsay " + strings.Repeat("x", 1<<20) + "\n",
+			expectedError: "stdin:2: line longer than 1 MiB",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := readSubcommands(strings.NewReader(tc.input))
+			if tc.expectedError != "" {
+				if err == nil || err.Error() != tc.expectedError {
+					t.Fatalf("Expected error %q\n  Actual %v", tc.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !slices.Equal(actual, tc.expected) {
+				t.Errorf("Expected %q\n  Actual %q", tc.expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,199 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// ch keeps what it stores between runs in three places, following the XDG
+// base directory specification on every platform:
+//
+//   - the cache directory, $XDG_CACHE_HOME/ch, for what can be recomputed,
+//     such as the render cache; "ch cache clean" empties it, and the render
+//     cache is kept within cache_limit;
+//   - the data directory, $XDG_DATA_HOME/ch, for what the user made and
+//     would miss: the clip history, the stash, sessions, and the files
+//     recorded for ch apply;
+//   - the state directory, $XDG_STATE_HOME/ch, for what ch keeps to carry
+//     on where it left off, such as the backups that ch apply -undo
+//     restores.
+//
+// Remote files and fetched pages are copied to a temporary directory for
+// each run rather than cached, so that they are never stale.
+
+// defaultCacheLimit is the size the render cache is kept within, unless
+// cache_limit says otherwise.
+const defaultCacheLimit = 500_000_000
+
+// cacheDir returns $XDG_CACHE_HOME/ch, or ch in the platform's user cache
+// directory (~/.cache by default).
+func cacheDir() (string, error) {
+	dir := os.Getenv("XDG_CACHE_HOME")
+	if dir == "" {
+		var err error
+		if dir, err = os.UserCacheDir(); err != nil {
+			return "", err
+		}
+	}
+	return filepath.Join(dir, "ch"), nil
+}
+
+// dataDir returns the directory that ch keeps data in until it is deleted:
+// $XDG_DATA_HOME/ch, which is ~/.local/share/ch by default, or on macOS and
+// Windows ch in the user's config directory.
+func dataDir() (string, error) {
+	dir := os.Getenv("XDG_DATA_HOME")
+	if dir == "" {
+		var err error
+		switch runtime.GOOS {
+		case "darwin", "windows", "plan9":
+			dir, err = os.UserConfigDir()
+		default:
+			var home string
+			home, err = os.UserHomeDir()
+			dir = filepath.Join(home, ".local", "share")
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return filepath.Join(dir, "ch"), nil
+}
+
+// stateDir returns $XDG_STATE_HOME/ch, which is ~/.local/state/ch by
+// default, or on macOS and Windows the state directory in the data
+// directory.
+func stateDir() (string, error) {
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, "ch"), nil
+	}
+	switch runtime.GOOS {
+	case "darwin", "windows", "plan9":
+		dir, err := dataDir()
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(dir, "state"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "state", "ch"), nil
+}
+
+// moveLegacy moves what older versions of ch stored in legacy to dir, if
+// dir doesn't exist yet. Failures are only logged: the data stays where it
+// was, and dir starts out empty.
+func moveLegacy(legacy, dir string) {
+	if legacy == dir {
+		return
+	}
+	if _, err := os.Stat(dir); !errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+	if _, err := os.Stat(legacy); err != nil {
+		return
+	}
+	err := os.MkdirAll(filepath.Dir(dir), 0700)
+	if err == nil {
+		err = os.Rename(legacy, dir)
+	}
+	if err != nil {
+		slog.Warn("failed to move stored files to their new location", "from", legacy, "to", dir, "error", err)
+		return
+	}
+	slog.Info("moved stored files to their new location", "from", legacy, "to", dir)
+}
+
+// dirSize returns the total size of the files under dir, or 0 if it
+// doesn't exist.
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info, err := d.Info(); err == nil && info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+// cacheCommand implements "ch cache info|clean": info shows where ch
+// stores things and how much space each place takes, and clean empties
+// the cache directory.
+func cacheCommand(args []string) error {
+	flags := newCommandFlags("cache")
+	rest, err := parseInterspersed(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 1 {
+		return usageError("usage: ch cache info|clean")
+	}
+	cache, err := cacheDir()
+	if err != nil {
+		return fmt.Errorf("failed to locate the cache directory: %v", err)
+	}
+	switch rest[0] {
+	case "info":
+		data, err := dataDir()
+		if err != nil {
+			return fmt.Errorf("failed to locate the data directory: %v", err)
+		}
+		state, err := stateDir()
+		if err != nil {
+			return fmt.Errorf("failed to locate the state directory: %v", err)
+		}
+		for _, place := range []struct{ name, dir string }{{"cache", cache}, {"data", data}, {"state", state}} {
+			size, err := dirSize(place.dir)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%-6s %s (%s)\n", place.name, place.dir, describeBytes(int(size)))
+		}
+		return nil
+	case "clean":
+		size, err := dirSize(cache)
+		if err != nil {
+			return err
+		}
+		if err := os.RemoveAll(cache); err != nil {
+			return fmt.Errorf("failed to clean the cache: %v", err)
+		}
+		fmt.Fprintf(messages, "Removed %s from %s.\n", describeBytes(int(size)), cache)
+		return nil
+	default:
+		return usageError("unknown cache command %q (expected info or clean)", rest[0])
+	}
+}
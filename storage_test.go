@@ -0,0 +1,88 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// isolateStorage points the cache, data, and state directories at
+// temporary directories for the rest of the test.
+func isolateStorage(t *testing.T) {
+	t.Helper()
+	for _, name := range []string{"XDG_CACHE_HOME", "XDG_DATA_HOME", "XDG_STATE_HOME"} {
+		t.Setenv(name, t.TempDir())
+	}
+}
+
+func TestStorageDirs(t *testing.T) {
+	isolateStorage(t)
+	for name, dir := range map[string]func() (string, error){"XDG_CACHE_HOME": cacheDir, "XDG_DATA_HOME": dataDir, "XDG_STATE_HOME": stateDir} {
+		actual, err := dir()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := filepath.Join(os.Getenv(name), "ch"); actual != expected {
+			t.Errorf("Expected %s\n  Actual %s", expected, actual)
+		}
+	}
+}
+
+func TestMoveLegacy(t *testing.T) {
+	root := t.TempDir()
+	legacy, dir := filepath.Join(root, "old", "clips"), filepath.Join(root, "new", "ch", "clips")
+	if err := os.MkdirAll(legacy, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(legacy, "1.md"), []byte("first"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	moveLegacy(legacy, dir)
+	if content, err := os.ReadFile(filepath.Join(dir, "1.md")); err != nil || string(content) != "first" {
+		t.Errorf("Expected the legacy clip to be moved\n  Actual %q, %v", content, err)
+	}
+	if _, err := os.Stat(legacy); !os.IsNotExist(err) {
+		t.Errorf("Expected the legacy directory to be gone\n  Actual %v", err)
+	}
+
+	// Once the new directory exists, a legacy one is left alone.
+	if err := os.MkdirAll(legacy, 0700); err != nil {
+		t.Fatal(err)
+	}
+	moveLegacy(legacy, dir)
+	if _, err := os.Stat(legacy); err != nil {
+		t.Errorf("Expected the legacy directory to be left\n  Actual %v", err)
+	}
+}
+
+func TestCacheCommand(t *testing.T) {
+	isolateStorage(t)
+	cache, _ := cacheDir()
+	if err := os.MkdirAll(filepath.Join(cache, "render"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(cache, "render", "key"), make([]byte, 1500), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var output strings.Builder
+	messages = &output
+	defer func() { messages = os.Stdout }()
+	if err := cacheCommand([]string{"clean"}); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "Removed 1.5 kB from " + cache + ".\n"; output.String() != expected {
+		t.Errorf("Expected %q\n  Actual %q", expected, output.String())
+	}
+	if _, err := os.Stat(cache); !os.IsNotExist(err) {
+		t.Errorf("Expected the cache to be removed\n  Actual %v", err)
+	}
+
+	for _, args := range [][]string{{}, {"purge"}, {"info", "clean"}} {
+		if err := cacheCommand(args); err == nil {
+			t.Errorf("Expected a usage error for %q", args)
+		}
+	}
+}
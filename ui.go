@@ -0,0 +1,111 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/eloquence-cloud/ch/chlib/render"
+	"github.com/eloquence-cloud/ch/chlib/subcmd"
+)
+
+// uiPage is the web UI of ch serve -ui: a page that lists the project's
+// files, builds a command line from the files ticked and the messages
+// typed, and renders it with POST /render.
+//
+//go:embed ui/index.html
+var uiPage []byte
+
+// maxUIFiles bounds the files listed by GET /files, so that serving from
+// a huge directory doesn't produce a page too big to use.
+const maxUIFiles = 20000
+
+// uiFile is a file listed by GET /files.
+type uiFile struct {
+	Path   string `json:"path"`
+	Bytes  int64  `json:"bytes"`
+	Tokens int    `json:"tokens"`
+}
+
+// uiFiles is the reply to GET /files: the files under root that attach
+// would include, with their approximate sizes in tokens.
+type uiFiles struct {
+	Root      string   `json:"root"`
+	Files     []uiFile `json:"files"`
+	Truncated bool     `json:"truncated,omitempty"`
+}
+
+func serveUIPage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(uiPage)
+}
+
+func (s *server) handleFiles(w http.ResponseWriter, r *http.Request) {
+	root := s.root
+	if root == "" {
+		root = "."
+	}
+	paths, err := subcmd.ListFiles(root, s.cfg.PruneDirs)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to list files: %v", err), http.StatusInternalServerError)
+		return
+	}
+	response := uiFiles{Root: filepath.ToSlash(root), Files: []uiFile{}}
+	if len(paths) > maxUIFiles {
+		paths, response.Truncated = paths[:maxUIFiles], true
+	}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		response.Files = append(response.Files, uiFile{
+			Path:   filepath.ToSlash(path),
+			Bytes:  info.Size(),
+			Tokens: render.ApproxTokensForSize(info.Size()),
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// uiURL returns the address of the web UI of a server listening on
+// listen, with the server's token, if any, in the fragment.
+func uiURL(listen, token string) string {
+	host, port, err := net.SplitHostPort(listen)
+	if err != nil {
+		return "http://" + listen + "/"
+	}
+	if host == "" {
+		host = "localhost"
+	}
+	u := url.URL{Scheme: "http", Host: net.JoinHostPort(host, port), Path: "/"}
+	if token != "" {
+		u.Fragment = "token=" + url.QueryEscape(token)
+	}
+	return u.String()
+}
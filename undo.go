@@ -0,0 +1,286 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+)
+
+// maxChangeSets bounds how many applies can be undone; older change sets
+// are removed.
+const maxChangeSets = 20
+
+// changeSets keeps a change set for each ch apply: the previous contents of
+// the files it wrote, so that ch apply -undo can put them back. Each change
+// set is a directory named by the time of the apply, holding changes.json
+// and the previous contents, numbered in the order of its files.
+type changeSets struct {
+	dir string
+}
+
+// changeSet describes the files written by one ch apply.
+type changeSet struct {
+	Applied time.Time     `json:"applied"`
+	Files   []changedFile `json:"files"`
+}
+
+type changedFile struct {
+	Path string `json:"path"`
+	// Existed reports whether the file existed before; if not, undoing the
+	// apply removes it.
+	Existed bool        `json:"existed"`
+	Mode    os.FileMode `json:"mode,omitempty"`
+	// SHA256 is that of the content the apply wrote, to tell whether the
+	// file has been changed since.
+	SHA256 string `json:"sha256"`
+}
+
+// defaultChangeSets returns the change sets in the state directory,
+// moving them there from the data directory, where older versions of ch
+// kept them.
+func defaultChangeSets() (changeSets, error) {
+	state, err := stateDir()
+	if err != nil {
+		return changeSets{}, err
+	}
+	dir := filepath.Join(state, "applied")
+	if data, err := dataDir(); err == nil {
+		moveLegacy(filepath.Join(data, "applied"), dir)
+	}
+	return changeSets{dir: dir}, nil
+}
+
+// save records the files that writes are about to replace, returning the
+// change set's directory, and removes the oldest change sets beyond
+// maxChangeSets.
+func (c changeSets) save(writes []fileWrite, now time.Time) (string, error) {
+	dir := filepath.Join(c.dir, strconv.FormatInt(now.UnixNano(), 10))
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	set := changeSet{Applied: now}
+	for i, write := range writes {
+		changed := changedFile{Path: write.path}
+		sum, err := entry.HashContent(strings.NewReader(write.content))
+		if err != nil {
+			return "", err
+		}
+		changed.SHA256 = sum
+		if info, err := os.Stat(write.path); err == nil {
+			previous, err := os.ReadFile(write.path)
+			if err != nil {
+				os.RemoveAll(dir)
+				return "", err
+			}
+			if err := os.WriteFile(filepath.Join(dir, strconv.Itoa(i)), previous, 0600); err != nil {
+				os.RemoveAll(dir)
+				return "", err
+			}
+			changed.Existed, changed.Mode = true, info.Mode().Perm()
+		}
+		set.Files = append(set.Files, changed)
+	}
+	data, err := json.MarshalIndent(set, "", "  ")
+	if err == nil {
+		err = os.WriteFile(filepath.Join(dir, "changes.json"), append(data, '\n'), 0600)
+	}
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+
+	names, err := c.names()
+	if err != nil {
+		return dir, nil
+	}
+	for len(names) > maxChangeSets {
+		os.RemoveAll(filepath.Join(c.dir, names[0]))
+		names = names[1:]
+	}
+	return dir, nil
+}
+
+// names returns the names of the change sets, oldest first.
+func (c changeSets) names() ([]string, error) {
+	dirs, err := os.ReadDir(c.dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	var names []string
+	for _, dir := range dirs {
+		if _, err := strconv.ParseInt(dir.Name(), 10, 64); err == nil && dir.IsDir() {
+			names = append(names, dir.Name())
+		}
+	}
+	// The names are times in nanoseconds, all of the same length for
+	// centuries, so they sort as strings.
+	slices.Sort(names)
+	return names, nil
+}
+
+// latest returns the directory and description of the last change set.
+func (c changeSets) latest() (string, changeSet, error) {
+	names, err := c.names()
+	if err != nil {
+		return "", changeSet{}, err
+	}
+	if len(names) == 0 {
+		return "", changeSet{}, errors.New("there is no apply to undo")
+	}
+	dir := filepath.Join(c.dir, names[len(names)-1])
+	data, err := os.ReadFile(filepath.Join(dir, "changes.json"))
+	if err != nil {
+		return "", changeSet{}, err
+	}
+	var set changeSet
+	if err := json.Unmarshal(data, &set); err != nil {
+		return "", changeSet{}, fmt.Errorf("%s is corrupt: %v", dir, err)
+	}
+	return dir, set, nil
+}
+
+// undoLastApply restores the files written by the last ch apply and forgets
+// its change set, so that the next undo goes back one further. Unless
+// force, it refuses if any of the files has changed since. With dryRun, it
+// only reports what it would do.
+func undoLastApply(c changeSets, force, dryRun bool) error {
+	dir, set, err := c.latest()
+	if err != nil {
+		return err
+	}
+	var replacements []fileReplacement
+	var changed []string
+	for i, file := range set.Files {
+		if sum, err := hashFile(file.Path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to check %s: %v", file.Path, err)
+		} else if sum != file.SHA256 {
+			changed = append(changed, file.Path)
+		}
+		replacement := fileReplacement{path: file.Path, mode: file.Mode, remove: !file.Existed}
+		if file.Existed {
+			if replacement.content, err = os.ReadFile(filepath.Join(dir, strconv.Itoa(i))); err != nil {
+				return fmt.Errorf("the previous content of %s is missing: %v", file.Path, err)
+			}
+		}
+		replacements = append(replacements, replacement)
+	}
+	if len(changed) > 0 && !force {
+		return fmt.Errorf("not undoing the apply of %s, since these files have changed since:\n  %s\nUse -force to undo it anyway", set.Applied.Format("2006-01-02 15:04"), strings.Join(changed, "\n  "))
+	}
+
+	verb := map[bool]string{true: "Would restore", false: "Restored"}[dryRun]
+	if !dryRun {
+		if err := replaceFiles(replacements); err != nil {
+			return err
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			return err
+		}
+	}
+	for _, r := range replacements {
+		if r.remove {
+			fmt.Fprintf(messages, "%s %s by removing it\n", verb, r.path)
+		} else {
+			fmt.Fprintf(messages, "%s %s\n", verb, r.path)
+		}
+	}
+	return nil
+}
+
+// fileReplacement is new content for a file, or its removal.
+type fileReplacement struct {
+	path    string
+	content []byte
+	// mode is the permissions to write the file with, if not those it
+	// has now (or 0644 for a new file).
+	mode   os.FileMode
+	remove bool
+}
+
+// replaceFiles makes all the replacements, or none if it can help it: each
+// new content is first written to a temporary file beside the file it
+// replaces, and only once all are written are they renamed into place.
+func replaceFiles(replacements []fileReplacement) error {
+	var staged []string
+	cleanup := func() {
+		for _, temp := range staged {
+			os.Remove(temp)
+		}
+	}
+	for _, r := range replacements {
+		if r.remove {
+			staged = append(staged, "")
+			continue
+		}
+		mode := r.mode
+		if info, err := os.Stat(r.path); err == nil && mode == 0 {
+			mode = info.Mode().Perm()
+		} else if err != nil {
+			if err := os.MkdirAll(filepath.Dir(r.path), 0755); err != nil {
+				cleanup()
+				return err
+			}
+		}
+		if mode == 0 {
+			mode = 0644
+		}
+		temp, err := os.CreateTemp(filepath.Dir(r.path), "."+filepath.Base(r.path)+".ch-*")
+		if err == nil {
+			_, err = temp.Write(r.content)
+			if closeErr := temp.Close(); err == nil {
+				err = closeErr
+			}
+			if err == nil {
+				err = os.Chmod(temp.Name(), mode)
+			}
+			staged = append(staged, temp.Name())
+		}
+		if err != nil {
+			cleanup()
+			return fmt.Errorf("failed to write %s: %v", r.path, err)
+		}
+	}
+	for i, r := range replacements {
+		var err error
+		if r.remove {
+			err = os.Remove(r.path)
+			if os.IsNotExist(err) {
+				err = nil
+			}
+		} else {
+			err = os.Rename(staged[i], r.path)
+		}
+		if err != nil {
+			cleanup()
+			return fmt.Errorf("failed to replace %s: %v", r.path, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/eloquence-cloud/ch/chlib/subcmd"
+)
+
+// splitRemote splits an -o argument of the form host:/path into the host
+// and the remote path. A host containing a path separator, or a single
+// letter (a Windows drive), means the argument names a local file, as does
+// one starting with a digit that isn't an IP address, so that timestamped
+// names such as 2024-10-16T10:00.md stay local.
+func splitRemote(outputFile string) (host, remotePath string, ok bool) {
+	host, remotePath, ok = strings.Cut(outputFile, ":")
+	if !ok || len(host) < 2 || strings.ContainsAny(host, `/\`) || remotePath == "" {
+		return "", "", false
+	}
+	name := host[strings.LastIndex(host, "@")+1:]
+	if name == "" || (name[0] >= '0' && name[0] <= '9' && net.ParseIP(name) == nil) {
+		return "", "", false
+	}
+	return host, remotePath, true
+}
+
+// writeFile writes data to a local file or, for host:/path, uploads it to
+// the remote machine over SFTP. It returns whether the file was remote.
+func writeFile(ctx context.Context, outputFile string, data []byte) (bool, error) {
+	host, remotePath, ok := splitRemote(outputFile)
+	if !ok {
+		return false, os.WriteFile(outputFile, data, 0644)
+	}
+	return true, upload(ctx, host, remotePath, data)
+}
+
+// upload copies data to remotePath on host with sftp in batch mode, so it
+// uses the same ssh configuration and keys as the remote subcommands, and
+// fails rather than prompting for a password. sftp is killed if ctx is
+// done first, as when -deadline passes.
+func upload(ctx context.Context, host, remotePath string, data []byte) error {
+	temp, err := os.CreateTemp("", "ch-upload-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+	if _, err := temp.Write(data); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+
+	cmd := exec.CommandContext(ctx, "sftp", "-b", "-", host)
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("put %s %s\n", sftpQuote(temp.Name()), sftpQuote(remotePath)))
+	slog.Debug("uploading output", "host", host, "path", remotePath, "bytes", len(data))
+	if output, err := cmd.CombinedOutput(); err != nil {
+		if ctx.Err() != nil {
+			return subcmd.Errorf(subcmd.KindRemote, "failed to upload to %s:%s: %v", host, remotePath, ctx.Err())
+		}
+		return subcmd.Errorf(subcmd.KindRemote, "failed to upload to %s:%s: %v\nOutput: %s", host, remotePath, err, output)
+	}
+	return nil
+}
+
+// sftpQuote quotes a path for an sftp batch command.
+func sftpQuote(path string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(path) + `"`
+}
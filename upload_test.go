@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSplitRemote(t *testing.T) {
+	tests := []struct {
+		outputFile string
+		host, path string
+		ok         bool
+	}{
+		{"devbox:/home/me/notes/context.md", "devbox", "/home/me/notes/context.md", true},
+		{"me@devbox:notes.md", "me@devbox", "notes.md", true},
+		{"context.md", "", "", false},
+		{"-", "", "", false},
+		{`C:\notes\context.md`, "", "", false},
+		{"./odd:name.md", "", "", false},
+		{"devbox:", "", "", false},
+		{"10.0.0.5:/srv/context.md", "10.0.0.5", "/srv/context.md", true},
+		{"me@192.168.1.2:notes.md", "me@192.168.1.2", "notes.md", true},
+		{"2024-10-16T10:00.md", "", "", false},
+	}
+	for _, tt := range tests {
+		host, path, ok := splitRemote(tt.outputFile)
+		if host != tt.host || path != tt.path || ok != tt.ok {
+			t.Errorf("Expected %q %q %v for %q\n  Actual %q %q %v", tt.host, tt.path, tt.ok, tt.outputFile, host, path, ok)
+		}
+	}
+}
+
+func TestWriteFileRemote(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("upload test uses a shell script")
+	}
+	// A stand-in for sftp that records its arguments and batch commands,
+	// and copies the local file of the put command beside them.
+	binDir, logDir := t.TempDir(), t.TempDir()
+	script := "#!/bin/sh\necho \"$*\" > " + logDir + "/args\ncat > " + logDir + "/batch\n" +
+		"cp \"$(sed 's/^put \"\\([^\"]*\\)\".*/\\1/' " + logDir + "/batch)\" " + logDir + "/uploaded\n"
+	if err := os.WriteFile(filepath.Join(binDir, "sftp"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	remote, err := writeFile(context.Background(), "devbox:/srv/my notes/context.md", []byte("# Context\n"))
+	if err != nil || !remote {
+		t.Fatalf("Expected an upload\n  Actual remote %v, error %v", remote, err)
+	}
+	for name, expected := range map[string]string{
+		"args":     "-b - devbox\n",
+		"uploaded": "# Context\n",
+	} {
+		content, err := os.ReadFile(filepath.Join(logDir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != expected {
+			t.Errorf("Expected %s %q\n  Actual %q", name, expected, content)
+		}
+	}
+	batch, _ := os.ReadFile(filepath.Join(logDir, "batch"))
+	if !strings.HasSuffix(string(batch), ` "/srv/my notes/context.md"`+"\n") {
+		t.Errorf("Expected the remote path quoted in %q", batch)
+	}
+
+	t.Setenv("PATH", t.TempDir())
+	if _, err := writeFile(context.Background(), "devbox:/srv/context.md", []byte("x")); err == nil || !strings.Contains(err.Error(), "failed to upload to devbox:/srv/context.md") {
+		t.Errorf("Expected an upload error without sftp\n  Actual %v", err)
+	}
+}
+
+func TestUploadDeadline(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("upload test uses a shell script")
+	}
+	binDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(binDir, "sftp"), []byte("#!/bin/sh\nexec sleep 10\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := writeFile(ctx, "devbox:/srv/context.md", []byte("x"))
+	if err == nil || !strings.Contains(err.Error(), context.DeadlineExceeded.Error()) {
+		t.Errorf("Expected the upload to stop at the deadline\n  Actual %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected the upload to stop at the deadline\n  Actual it took %v", elapsed)
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+	"github.com/eloquence-cloud/ch/chlib/subcmd"
+)
+
+// The results of checking a file against a manifest.
+const (
+	fileMatches = "matches"
+	fileChanged = "changed"
+	fileMissing = "missing"
+	fileRemote  = "remote"
+	fileStored  = "stored"
+)
+
+// fileCheck is the result of checking one file that a manifest lists.
+type fileCheck struct {
+	path   string
+	result string
+}
+
+// verifyCommand implements "ch verify manifest.json": it checks that the
+// local files a manifest lists still have the content it records, listing
+// each that changed or is missing, and fails if any did.
+func verifyCommand(args []string) error {
+	flags := newCommandFlags("verify")
+	paths, err := parseInterspersed(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(paths) != 1 {
+		return usageError("usage: ch verify manifest.json")
+	}
+	m, err := readManifest(paths[0])
+	if err != nil {
+		return err
+	}
+	dir := "."
+	if m.Lock != nil {
+		dir = m.Lock.WorkDir
+	}
+
+	checks, err := checkManifest(m, dir)
+	if err != nil {
+		return err
+	}
+	var mismatched, remote, stored int
+	for _, check := range checks {
+		switch check.result {
+		case fileChanged, fileMissing:
+			fmt.Fprintf(messages, "%-8s %s\n", check.result, check.path)
+			mismatched++
+		case fileRemote:
+			remote++
+		case fileStored:
+			stored++
+		}
+	}
+	if remote > 0 {
+		fmt.Fprintf(messages, "Skipped %s on other machines.\n", pluralFiles(remote))
+	}
+	if stored > 0 {
+		fmt.Fprintf(messages, "Skipped %s not read from disk.\n", pluralFiles(stored))
+	}
+	checked := len(checks) - remote - stored
+	switch {
+	case mismatched == 1:
+		return fmt.Errorf("1 of %s no longer matches %s", pluralFiles(checked), paths[0])
+	case mismatched > 1:
+		return fmt.Errorf("%d of %s no longer match %s", mismatched, pluralFiles(checked), paths[0])
+	case checked == 0:
+		fmt.Fprintf(messages, "%s lists no local files.\n", paths[0])
+	case checked == 1:
+		fmt.Fprintf(messages, "The file matches %s.\n", paths[0])
+	default:
+		fmt.Fprintf(messages, "All %d files match %s.\n", checked, paths[0])
+	}
+	return nil
+}
+
+func pluralFiles(n int) string {
+	if n == 1 {
+		return "1 file"
+	}
+	return fmt.Sprintf("%d files", n)
+}
+
+// readManifest reads the manifest at path, as written by -manifest.
+func readManifest(path string) (manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return manifest{}, subcmd.Errorf(subcmd.KindMissingFile, "failed to read manifest: %v", err)
+	}
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return manifest{}, fmt.Errorf("invalid manifest %s: %v", path, err)
+	}
+	if m.SchemaVersion > entry.SchemaVersion {
+		return manifest{}, fmt.Errorf("manifest %s has schema version %d, but this ch reads only up to version %d; upgrade ch to read it", path, m.SchemaVersion, entry.SchemaVersion)
+	}
+	return m, nil
+}
+
+// checkManifest checks the source SHA-256 of each file that m lists against
+// the file's current bytes on disk, resolving relative paths against dir.
+// The source hash, unlike the content hash, holds for files that ch
+// converted or sliced. Files on other machines (host:path), and those with
+// no source on disk, such as files stored from an API, aren't checked.
+func checkManifest(m manifest, dir string) ([]fileCheck, error) {
+	var checks []fileCheck
+	for _, me := range m.Entries {
+		if me.Type != "file" {
+			continue
+		}
+		check := fileCheck{path: me.Source}
+		if _, _, remote := splitRemote(me.Source); remote {
+			check.result = fileRemote
+			checks = append(checks, check)
+			continue
+		}
+		if me.SourceSHA256 == "" {
+			check.result = fileStored
+			checks = append(checks, check)
+			continue
+		}
+		path := me.Source
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		content, err := os.ReadFile(path)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			check.result = fileMissing
+		case err != nil:
+			return nil, subcmd.Errorf(subcmd.KindMissingFile, "failed to read %s: %v", me.Source, err)
+		default:
+			sum := sha256.Sum256(content)
+			check.result = fileChanged
+			if hex.EncodeToString(sum[:]) == me.SourceSHA256 {
+				check.result = fileMatches
+			}
+		}
+		checks = append(checks, check)
+	}
+	return checks, nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+)
+
+func TestVerifyCommand(t *testing.T) {
+	dir := t.TempDir()
+	stored := t.TempDir()
+	for path, content := range map[string]string{
+		filepath.Join(dir, "a.go"):        "package a\n",
+		filepath.Join(dir, "b.go"):        "package b\n",
+		filepath.Join(dir, "page.html"):   "<h1>Setup</h1>",
+		filepath.Join(stored, "page.md"):  "# Setup\n",
+		filepath.Join(stored, "copy.go"):  "package remote\n",
+		filepath.Join(stored, "issue.md"): "# Bug\n",
+	} {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Attached HTML is converted to markdown, so the source hash, not the
+	// content hash, is what the page on disk must match.
+	entries := []entry.Entry{
+		entry.File{StoragePath: filepath.Join(dir, "a.go"), OriginalPath: "a.go"},
+		entry.Message{Text: "Why?"},
+		entry.File{StoragePath: filepath.Join(dir, "b.go"), OriginalPath: filepath.Join(dir, "b.go")},
+		entry.File{StoragePath: filepath.Join(stored, "page.md"), OriginalPath: "page.html", Lang: "markdown"},
+		entry.File{StoragePath: filepath.Join(stored, "copy.go"), OriginalPath: "server:/src/remote.go"},
+		entry.File{StoragePath: filepath.Join(stored, "issue.md"), OriginalPath: "issue-12.md"},
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	m, err := buildManifest(entries, entry.RenderOptions{}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(wd); err != nil {
+		t.Fatal(err)
+	}
+	m.Lock = &manifestLock{WorkDir: dir}
+	manifestPath := filepath.Join(t.TempDir(), "context.lock.json")
+	if err := writeManifest(m, manifestPath); err != nil {
+		t.Fatal(err)
+	}
+
+	var output strings.Builder
+	messages = &output
+	defer func() { messages = os.Stdout }()
+	if err := verifyCommand([]string{manifestPath}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := "Skipped 1 file on other machines.\nSkipped 1 file not read from disk.\nAll 3 files match " + manifestPath + ".\n"; output.String() != expected {
+		t.Errorf("Expected %q\n  Actual %q", expected, output.String())
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "b.go"), []byte("package changed\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, "a.go")); err != nil {
+		t.Fatal(err)
+	}
+	output.Reset()
+	err = verifyCommand([]string{manifestPath})
+	if expected := "2 of 3 files no longer match " + manifestPath; err == nil || err.Error() != expected {
+		t.Errorf("Expected error %q\n  Actual %v", expected, err)
+	}
+	if expected := "missing  a.go\nchanged  " + filepath.Join(dir, "b.go") + "\nSkipped 1 file on other machines.\nSkipped 1 file not read from disk.\n"; output.String() != expected {
+		t.Errorf("Expected %q\n  Actual %q", expected, output.String())
+	}
+
+	newer := filepath.Join(t.TempDir(), "newer.json")
+	if err := os.WriteFile(newer, []byte(`{"schemaVersion": 99, "entries": []}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyCommand([]string{newer}); err == nil || !strings.Contains(err.Error(), "upgrade ch") {
+		t.Errorf("Expected an error asking to upgrade ch\n  Actual %v", err)
+	}
+	for _, args := range [][]string{{}, {manifestPath, newer}} {
+		if err := verifyCommand(args); err == nil {
+			t.Errorf("Expected a usage error for %q", args)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDebounce is how long a burst of file changes must settle before
+// -watch re-runs the invocation.
+const watchDebounce = 300 * time.Millisecond
+
+// watchInvocation runs inv, then runs it again whenever a local file it
+// referenced changes or a file appears or disappears beside one, until
+// interrupted. Output is only delivered again when it changes. A failed run
+// is reported and the watch goes on, since files are often briefly broken
+// while being edited.
+func watchInvocation(inv *invocation) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to start watching: %v", err)
+	}
+	defer watcher.Close()
+
+	inv.skipUnchanged = true
+	ignored := make(map[string]bool)
+	for _, path := range []string{inv.outputFile, inv.exportFile, inv.manifestFile} {
+		if path != "" && path != "-" {
+			ignored[absPath(path)] = true
+		}
+	}
+
+	var files map[string]bool
+	for {
+		entries, err := inv.run(context.Background())
+		if err != nil {
+			slog.Error("run failed; waiting for changes", "error", err)
+		} else {
+			files = referencedFiles(entries)
+			if err := watchDirs(watcher, files); err != nil {
+				return err
+			}
+		}
+		if len(watcher.WatchList()) == 0 {
+			return fmt.Errorf("-watch found no local files to watch")
+		}
+		fmt.Fprintf(messages, "Watching %d files for changes...\n", len(files))
+
+		if err := waitForChange(watcher, files, ignored); err != nil {
+			return err
+		}
+	}
+}
+
+// waitForChange returns once a relevant change has been followed by
+// watchDebounce of quiet.
+func waitForChange(watcher *fsnotify.Watcher, files, ignored map[string]bool) error {
+	var settled <-chan time.Time
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return fmt.Errorf("file watcher stopped")
+			}
+			name := absPath(event.Name)
+			if ignored[name] {
+				continue
+			}
+			if files[name] || event.Has(fsnotify.Create) || event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename) {
+				settled = time.After(watchDebounce)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return fmt.Errorf("file watcher stopped")
+			}
+			slog.Warn("file watcher error", "error", err)
+		case <-settled:
+			return nil
+		}
+	}
+}
+
+// watchDirs makes watcher watch exactly the directories containing files.
+// Watching directories rather than files catches editors that save by
+// replacing the file.
+func watchDirs(watcher *fsnotify.Watcher, files map[string]bool) error {
+	dirs := make(map[string]bool)
+	for file := range files {
+		dirs[filepath.Dir(file)] = true
+	}
+	for _, dir := range watcher.WatchList() {
+		if !dirs[dir] {
+			watcher.Remove(dir)
+		}
+	}
+	for dir := range dirs {
+		if err := watcher.Add(dir); err != nil {
+			return fmt.Errorf("failed to watch %s: %v", dir, err)
+		}
+	}
+	return nil
+}
+
+// referencedFiles returns the absolute paths of the local files that
+// entries were read from, including those stored in converted form, such as
+// HTML files attached as markdown.
+func referencedFiles(entries []entry.Entry) map[string]bool {
+	files := make(map[string]bool)
+	for _, e := range entries {
+		switch e := entry.Unwrap(e).(type) {
+		case entry.File:
+			if !e.IsRemote() || e.Lang != "" && isRegularFile(e.OriginalPath) {
+				files[absPath(e.OriginalPath)] = true
+			}
+		case entry.Message:
+			if e.Source != "" && isRegularFile(e.Source) {
+				files[absPath(e.Source)] = true
+			}
+		}
+	}
+	return files
+}
+
+func isRegularFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// absPath returns path made absolute, or path itself if that fails.
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
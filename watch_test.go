@@ -0,0 +1,81 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/eloquence-cloud/ch/chlib/entry"
+	"github.com/fsnotify/fsnotify"
+)
+
+func TestReferencedFiles(t *testing.T) {
+	dir := t.TempDir()
+	notesPath := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(notesPath, []byte("notes\n"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	entries := []entry.Entry{
+		entry.Message{Text: "Hello"},
+		entry.Message{Text: "notes\n", Source: notesPath},
+		entry.Message{Text: "pasted", Source: "clipboard"},
+		entry.WithPriority([]entry.Entry{entry.File{StoragePath: "main.go", OriginalPath: "main.go"}}, entry.PriorityHigh)[0],
+		entry.File{StoragePath: filepath.Join(dir, "copy"), OriginalPath: "host:/etc/app.conf"},
+		entry.Output{Output: "ok\n", Command: "go test"},
+	}
+	expected := map[string]bool{notesPath: true, absPath("main.go"): true}
+
+	if actual := referencedFiles(entries); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected files: %v\n  Actual files: %v", expected, actual)
+	}
+}
+
+func TestWaitForChange(t *testing.T) {
+	dir := t.TempDir()
+	sourcePath := filepath.Join(dir, "main.go")
+	outputPath := filepath.Join(dir, "out.md")
+	for _, path := range []string{sourcePath, outputPath} {
+		if err := os.WriteFile(path, []byte("x\n"), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		t.Fatalf("Failed to create watcher: %v", err)
+	}
+	defer watcher.Close()
+	files := map[string]bool{sourcePath: true}
+	if err := watchDirs(watcher, files); err != nil {
+		t.Fatalf("watchDirs failed: %v", err)
+	}
+
+	changed := make(chan error, 1)
+	go func() {
+		changed <- waitForChange(watcher, files, map[string]bool{outputPath: true})
+	}()
+
+	if err := os.WriteFile(outputPath, []byte("y\n"), 0644); err != nil {
+		t.Fatalf("Failed to write output: %v", err)
+	}
+	select {
+	case <-changed:
+		t.Fatal("Expected writing the output file not to count as a change")
+	case <-time.After(2 * watchDebounce):
+	}
+
+	if err := os.WriteFile(sourcePath, []byte("y\n"), 0644); err != nil {
+		t.Fatalf("Failed to write source: %v", err)
+	}
+	select {
+	case err := <-changed:
+		if err != nil {
+			t.Errorf("waitForChange failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected writing a referenced file to count as a change")
+	}
+}
@@ -0,0 +1,313 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/eloquence-cloud/ch/chlib/subcmd"
+	"gopkg.in/yaml.v3"
+)
+
+// workspace is a member of a monorepo: a module of a go.work file, a
+// package of a pnpm workspace, or a crate of a Cargo workspace.
+type workspace struct {
+	// Name is the module path, package name, or crate name.
+	Name string
+	// Dir is the workspace's directory, slash-separated and relative to
+	// the monorepo's root.
+	Dir string
+}
+
+// matches reports whether name names w: by its name, its directory, or
+// the last element of its directory.
+func (w workspace) matches(name string) bool {
+	name = strings.TrimSuffix(strings.TrimPrefix(filepath.ToSlash(name), "./"), "/")
+	return name == w.Name || name == w.Dir || name == path.Base(w.Dir)
+}
+
+// findMonorepo returns the nearest directory at or above dir with a
+// go.work, a pnpm-workspace.yaml, or a Cargo.toml with a [workspace]
+// table, or "" if there is none.
+func findMonorepo(dir string) string {
+	for {
+		for _, name := range []string{"go.work", "pnpm-workspace.yaml"} {
+			if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+				return dir
+			}
+		}
+		if members, _, _ := cargoWorkspace(dir); members != nil {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// listWorkspaces returns the workspaces of the monorepo at root, of every
+// kind it has, in the order they are declared.
+func listWorkspaces(root string) ([]workspace, error) {
+	var workspaces []workspace
+	goDirs, err := goWorkDirs(filepath.Join(root, "go.work"))
+	if err != nil {
+		return nil, err
+	}
+	for _, dir := range goDirs {
+		name := goModuleName(filepath.Join(root, dir, "go.mod"))
+		workspaces = append(workspaces, workspace{Name: name, Dir: dir})
+	}
+
+	pnpmPatterns, err := pnpmWorkspacePatterns(filepath.Join(root, "pnpm-workspace.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	for _, dir := range memberDirs(root, pnpmPatterns, "package.json") {
+		workspaces = append(workspaces, workspace{Name: packageJSONName(filepath.Join(root, dir, "package.json")), Dir: dir})
+	}
+
+	members, excludes, err := cargoWorkspace(root)
+	if err != nil {
+		return nil, err
+	}
+	for _, pattern := range excludes {
+		members = append(members, "!"+pattern)
+	}
+	for _, dir := range memberDirs(root, members, "Cargo.toml") {
+		workspaces = append(workspaces, workspace{Name: crateName(filepath.Join(root, dir, "Cargo.toml")), Dir: dir})
+	}
+	return workspaces, nil
+}
+
+// resolveWorkspace returns the directory, relative to dir, of the
+// workspace called name in the monorepo that dir is in.
+func resolveWorkspace(dir, name string) (string, error) {
+	root := findMonorepo(dir)
+	if root == "" {
+		return "", fmt.Errorf("no go.work, pnpm-workspace.yaml, or Cargo workspace found in %s or above", dir)
+	}
+	workspaces, err := listWorkspaces(root)
+	if err != nil {
+		return "", err
+	}
+	var found []workspace
+	for _, w := range workspaces {
+		if w.matches(name) {
+			found = append(found, w)
+		}
+	}
+	switch len(found) {
+	case 0:
+		var names []string
+		for _, w := range workspaces {
+			names = append(names, w.Dir)
+		}
+		return "", fmt.Errorf("no workspace %q in %s (workspaces: %s)", name, root, strings.Join(names, ", "))
+	case 1:
+	default:
+		var dirs []string
+		for _, w := range found {
+			dirs = append(dirs, w.Dir)
+		}
+		return "", fmt.Errorf("workspace %q is ambiguous in %s: it could be %s", name, root, strings.Join(dirs, " or "))
+	}
+	rel, err := filepath.Rel(dir, filepath.Join(root, filepath.FromSlash(found[0].Dir)))
+	if err != nil {
+		return "", err
+	}
+	return rel, nil
+}
+
+// goWorkDirs returns the directories of the use directives of the go.work
+// file at workPath, if there is one.
+func goWorkDirs(workPath string) ([]string, error) {
+	f, err := os.Open(workPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var dirs []string
+	inUse := false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "//")
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 0:
+		case inUse && fields[0] == ")":
+			inUse = false
+		case inUse:
+			dirs = append(dirs, cleanMemberDir(fields[0]))
+		case fields[0] == "use" && len(fields) > 1 && fields[1] == "(":
+			inUse = true
+		case fields[0] == "use" && len(fields) > 1:
+			dirs = append(dirs, cleanMemberDir(fields[1]))
+		}
+	}
+	return dirs, scanner.Err()
+}
+
+// goModuleName returns the module path that the go.mod file at modPath
+// declares, or "" if it can't be read.
+func goModuleName(modPath string) string {
+	data, err := os.ReadFile(modPath)
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if rest, ok := strings.CutPrefix(strings.TrimSpace(line), "module "); ok {
+			return strings.Trim(strings.TrimSpace(rest), `"`)
+		}
+	}
+	return ""
+}
+
+// pnpmWorkspacePatterns returns the packages globs of the
+// pnpm-workspace.yaml file at yamlPath, if there is one.
+func pnpmWorkspacePatterns(yamlPath string) ([]string, error) {
+	data, err := os.ReadFile(yamlPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var workspace struct {
+		Packages []string `yaml:"packages"`
+	}
+	if err := yaml.Unmarshal(data, &workspace); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", yamlPath, err)
+	}
+	return workspace.Packages, nil
+}
+
+// packageJSONName returns the name in the package.json file at jsonPath,
+// or "" if it has none.
+func packageJSONName(jsonPath string) string {
+	data, err := os.ReadFile(jsonPath)
+	if err != nil {
+		return ""
+	}
+	var pkg struct {
+		Name string `json:"name"`
+	}
+	json.Unmarshal(data, &pkg)
+	return pkg.Name
+}
+
+// cargoWorkspace returns the members and exclude globs of the [workspace]
+// table of the Cargo.toml in dir. Members is nil if there is no such
+// table.
+func cargoWorkspace(dir string) (members, excludes []string, err error) {
+	var manifest struct {
+		Workspace *struct {
+			Members []string `toml:"members"`
+			Exclude []string `toml:"exclude"`
+		} `toml:"workspace"`
+	}
+	manifestPath := filepath.Join(dir, "Cargo.toml")
+	if _, err := toml.DecodeFile(manifestPath, &manifest); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil, nil
+		}
+		return nil, nil, fmt.Errorf("failed to parse %s: %v", manifestPath, err)
+	}
+	if manifest.Workspace == nil {
+		return nil, nil, nil
+	}
+	return append([]string{}, manifest.Workspace.Members...), manifest.Workspace.Exclude, nil
+}
+
+// crateName returns the package name in the Cargo.toml file at
+// manifestPath, or "" if it has none.
+func crateName(manifestPath string) string {
+	var manifest struct {
+		Package struct {
+			Name string `toml:"name"`
+		} `toml:"package"`
+	}
+	toml.DecodeFile(manifestPath, &manifest)
+	return manifest.Package.Name
+}
+
+// memberDirs returns the directories under root, slash-separated and
+// relative to it, that match one of patterns, as globs in which ** matches
+// any number of directories, and that have a file called marker. Patterns
+// starting with "!" exclude the directories they match.
+func memberDirs(root string, patterns []string, marker string) []string {
+	var include, exclude []string
+	for _, pattern := range patterns {
+		if rest, ok := strings.CutPrefix(pattern, "!"); ok {
+			exclude = append(exclude, cleanMemberDir(rest))
+		} else {
+			include = append(include, cleanMemberDir(pattern))
+		}
+	}
+	excluded := func(dir string) bool {
+		return slices.ContainsFunc(exclude, func(pattern string) bool { return subcmd.MatchGlob(pattern, dir) })
+	}
+
+	var dirs []string
+	var files []string
+	listed := false
+	for _, pattern := range include {
+		if !strings.ContainsAny(pattern, `*?[`) {
+			if _, err := os.Stat(filepath.Join(root, pattern, marker)); err == nil && !excluded(pattern) && !slices.Contains(dirs, pattern) {
+				dirs = append(dirs, pattern)
+			}
+			continue
+		}
+		if !listed {
+			files, _ = subcmd.ListFiles(root, nil)
+			listed = true
+		}
+		for _, file := range files {
+			rel, err := filepath.Rel(root, file)
+			if err != nil || filepath.Base(rel) != marker {
+				continue
+			}
+			dir := path.Dir(filepath.ToSlash(rel))
+			if subcmd.MatchGlob(pattern, dir) && !excluded(dir) && !slices.Contains(dirs, dir) {
+				dirs = append(dirs, dir)
+			}
+		}
+	}
+	return dirs
+}
+
+// cleanMemberDir returns a member directory or glob as given in a
+// workspace file, cleaned and slash-separated.
+func cleanMemberDir(dir string) string {
+	return path.Clean(filepath.ToSlash(strings.Trim(dir, `"'`)))
+}
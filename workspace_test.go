@@ -0,0 +1,116 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestResolveWorkspace(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"go.work":                    "go 1.22\n\nuse (\n\t./services/api // the HTTP API\n\t./tools\n)\nuse ./services/worker\n",
+		"services/api/go.mod":        "module example.com/api\n",
+		"services/worker/go.mod":     "module example.com/worker\n",
+		"tools/go.mod":               "module example.com/tools\n",
+		"pnpm-workspace.yaml":        "packages:\n  - 'web/*'\n  - '!web/legacy'\n",
+		"web/app/package.json":       `{"name": "@acme/app"}`,
+		"web/tools/package.json":     `{"name": "@acme/tools"}`,
+		"web/legacy/package.json":    `{"name": "@acme/legacy"}`,
+		"web/docs/README.md":         "",
+		"Cargo.toml":                 "[workspace]\nmembers = [\"crates/*\"]\nexclude = [\"crates/scratch\"]\n",
+		"crates/parser/Cargo.toml":   "[package]\nname = \"acme-parser\"\n",
+		"crates/scratch/Cargo.toml":  "[package]\nname = \"scratch\"\n",
+		"services/api/handler/h.go":  "package handler\n",
+		"crates/parser/src/lib.rs":   "",
+		"web/app/src/index.ts":       "",
+		"services/worker/main.go":    "package main\n",
+		"web/app/node_modules/x.txt": "",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testCases := []struct {
+		name        string
+		dir         string
+		workspace   string
+		expected    string
+		expectedErr string
+	}{
+		{name: "Go module path", dir: ".", workspace: "example.com/api", expected: "services/api"},
+		{name: "Directory", dir: ".", workspace: "./services/worker/", expected: "services/worker"},
+		{name: "Directory name", dir: ".", workspace: "api", expected: "services/api"},
+		{name: "Package name", dir: ".", workspace: "@acme/app", expected: "web/app"},
+		{name: "Crate name", dir: ".", workspace: "acme-parser", expected: "crates/parser"},
+		{name: "From a subdirectory", dir: "web/app/src", workspace: "worker", expected: "../../../services/worker"},
+		{name: "Ambiguous", dir: ".", workspace: "tools", expectedErr: "could be tools or web/tools"},
+		{name: "Excluded package", dir: ".", workspace: "@acme/legacy", expectedErr: "no workspace"},
+		{name: "Excluded crate", dir: ".", workspace: "scratch", expectedErr: "no workspace"},
+		{name: "Not a package", dir: ".", workspace: "docs", expectedErr: "workspaces: services/api, tools, services/worker, web/app, web/tools, crates/parser"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := resolveWorkspace(filepath.Join(root, tc.dir), tc.workspace)
+			if tc.expectedErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.expectedErr) {
+					t.Errorf("Expected error containing %q\n  Actual %q, %v", tc.expectedErr, dir, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if filepath.ToSlash(dir) != tc.expected {
+				t.Errorf("Expected %q\n  Actual %q", tc.expected, dir)
+			}
+		})
+	}
+
+	if _, err := resolveWorkspace(t.TempDir(), "api"); err == nil || !strings.Contains(err.Error(), "no go.work") {
+		t.Errorf("Expected an error outside a monorepo, got: %v", err)
+	}
+}
+
+func TestPnpmWorkspacePatterns(t *testing.T) {
+	testCases := []struct {
+		name, content string
+		expected      []string
+	}{
+		{name: "Block sequence", content: "packages:\n  - 'web/*'\n  - \"!web/legacy\" # retired\n  - tools\n", expected: []string{"web/*", "!web/legacy", "tools"}},
+		{name: "Flow sequence", content: "packages: ['web/*', apps/*] # all of them\n", expected: []string{"web/*", "apps/*"}},
+		{name: "Anchor", content: "shared: &globs\n  - web/*\npackages: *globs\n", expected: []string{"web/*"}},
+		{name: "No packages", content: "catalog:\n  react: ^18\n"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "pnpm-workspace.yaml")
+			if err := os.WriteFile(path, []byte(tc.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			patterns, err := pnpmWorkspacePatterns(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(patterns, tc.expected) {
+				t.Errorf("Expected %q\n  Actual %q", tc.expected, patterns)
+			}
+		})
+	}
+
+	path := filepath.Join(t.TempDir(), "pnpm-workspace.yaml")
+	if err := os.WriteFile(path, []byte("packages: [unclosed\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pnpmWorkspacePatterns(path); err == nil || !strings.Contains(err.Error(), "failed to parse") {
+		t.Errorf("Expected a parse error\n  Actual %v", err)
+	}
+}
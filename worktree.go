@@ -0,0 +1,155 @@
+// Copyright 2024 Dean Thompson dba Eloquence. All rights reserved.
+//
+// This file is part of the ch project.
+//
+// The ch project is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The ch project is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the ch project. If not, see <https://www.gnu.org/licenses/>.
+//
+// For more information, please contact Eloquence at info@eloquence.cloud.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/eloquence-cloud/ch/chlib/subcmd"
+)
+
+// runGit runs git in dir, returning its output with surrounding space
+// trimmed, or an error giving git's complaint.
+func runGit(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return "", subcmd.Errorf(subcmd.KindExec, "git %s failed: %v %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// sandbox is a git worktree that ch apply writes a reply's files to instead
+// of the working tree, so that they can be reviewed and tested first.
+type sandbox struct {
+	// root is the top level of the repository the reply's files are in.
+	root string
+	// dir is the worktree.
+	dir string
+	// branch, if set, is the branch checked out in dir.
+	branch string
+	// temporary reports whether dir was made for this apply alone, to be
+	// removed, keeping its branch, once the changes are committed.
+	temporary bool
+}
+
+// openSandbox returns the worktree at dir for the repository containing the
+// working directory, adding it if it doesn't exist yet: on branch, if set,
+// which is created from HEAD if need be, or else detached at HEAD. If dir
+// is "", a temporary worktree is added for branch.
+func openSandbox(dir, branch string) (*sandbox, error) {
+	root, err := runGit(".", "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, fmt.Errorf("-worktree and -branch need a git repository: %v", err)
+	}
+	s := &sandbox{root: resolvePath(root), branch: branch}
+	if dir == "" {
+		if s.dir, err = os.MkdirTemp("", "ch-apply-"); err != nil {
+			return nil, err
+		}
+		s.temporary = true
+	} else if s.dir, err = filepath.Abs(dir); err != nil {
+		return nil, err
+	}
+
+	if top, err := runGit(s.dir, "rev-parse", "--show-toplevel"); err == nil && resolvePath(top) == resolvePath(s.dir) {
+		// The worktree was added by an earlier apply.
+		if branch != "" {
+			if current, _ := runGit(s.dir, "rev-parse", "--abbrev-ref", "HEAD"); current != branch {
+				return nil, fmt.Errorf("worktree %s has %s checked out, not %s", dir, current, branch)
+			}
+		}
+		s.dir = resolvePath(s.dir)
+		return s, nil
+	}
+	args := []string{"worktree", "add"}
+	switch {
+	case branch == "":
+		args = append(args, "--detach", s.dir)
+	case branchExists(s.root, branch):
+		args = append(args, s.dir, branch)
+	default:
+		args = append(args, "-b", branch, s.dir)
+	}
+	if _, err := runGit(s.root, args...); err != nil {
+		if s.temporary {
+			os.RemoveAll(s.dir)
+		}
+		return nil, err
+	}
+	s.dir = resolvePath(s.dir)
+	return s, nil
+}
+
+// branchExists reports whether the repository at root has the branch.
+func branchExists(root, branch string) bool {
+	_, err := runGit(root, "rev-parse", "--verify", "--quiet", "refs/heads/"+branch)
+	return err == nil
+}
+
+// resolvePath returns path with symbolic links resolved, if it can, so
+// that paths through a link, such as macOS's /tmp, compare equal.
+func resolvePath(path string) string {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved
+	}
+	return path
+}
+
+// path returns where the file at path in the working tree is in the
+// worktree.
+func (s *sandbox) path(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	// The file may not exist yet, so resolve its directory instead.
+	abs = filepath.Join(resolvePath(filepath.Dir(abs)), filepath.Base(abs))
+	rel, err := filepath.Rel(s.root, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside the repository at %s", path, s.root)
+	}
+	return filepath.Join(s.dir, rel), nil
+}
+
+// close removes the worktree if it is temporary.
+func (s *sandbox) close() {
+	if s.temporary {
+		runGit(s.root, "worktree", "remove", "--force", s.dir)
+	}
+}
+
+// runTests runs command with sh in dir, copying its output to out.
+func runTests(command, dir string, out io.Writer) error {
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Dir, cmd.Stdout, cmd.Stderr = dir, out, out
+	if err := cmd.Run(); err != nil {
+		return subcmd.Errorf(subcmd.KindExec, "-test %q failed in %s: %v", command, dir, err)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testRepo makes a git repository holding a.txt ("old") in a temporary
+// directory, and changes to it for the rest of the test. It returns the
+// repository's parent directory and a function that runs git.
+func testRepo(t *testing.T) (string, func(dir string, args ...string) string) {
+	isolateStorage(t)
+	for _, name := range []string{"GIT_AUTHOR_NAME", "GIT_COMMITTER_NAME"} {
+		t.Setenv(name, "ch test")
+	}
+	for _, name := range []string{"GIT_AUTHOR_EMAIL", "GIT_COMMITTER_EMAIL"} {
+		t.Setenv(name, "ch@example.com")
+	}
+	parent := t.TempDir()
+	repo := filepath.Join(parent, "repo")
+	git := func(dir string, args ...string) string {
+		t.Helper()
+		output, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, output)
+		}
+		return strings.TrimSpace(string(output))
+	}
+	if err := os.MkdirAll(repo, 0755); err != nil {
+		t.Fatal(err)
+	}
+	git(repo, "init", "--quiet", "-b", "main")
+	if err := os.WriteFile(filepath.Join(repo, "a.txt"), []byte("old\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	git(repo, "add", "a.txt")
+	git(repo, "commit", "--quiet", "-m", "initial")
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	if err := os.Chdir(repo); err != nil {
+		t.Fatal(err)
+	}
+	return parent, git
+}
+
+func TestApplySandbox(t *testing.T) {
+	parent, git := testRepo(t)
+	repo := filepath.Join(parent, "repo")
+	oldMessages := messages
+	defer func() { messages = oldMessages }()
+	var reported strings.Builder
+	messages = &reported
+
+	replyPath := filepath.Join(parent, "reply.md")
+	if err := os.WriteFile(replyPath, []byte("`a.txt`\n```\nnew\n```\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	read := func(path string) string {
+		data, _ := os.ReadFile(path)
+		return string(data)
+	}
+
+	worktree := filepath.Join(parent, "suggestion")
+	if err := applyCommand([]string{"-f", replyPath, "-worktree", worktree, "-test", "grep -q new a.txt"}); err != nil {
+		t.Fatalf("apply -worktree: %v\n%s", err, reported.String())
+	}
+	if got := read(filepath.Join(worktree, "a.txt")); got != "new\n" {
+		t.Errorf("Expected the reply's file in the worktree\n  Actual %q", got)
+	}
+	if got := read(filepath.Join(repo, "a.txt")); got != "old\n" {
+		t.Errorf("Expected the working tree to be left alone\n  Actual %q", got)
+	}
+	// Applying again reuses the worktree; a failing test fails the apply.
+	if err := applyCommand([]string{"-f", replyPath, "-worktree", worktree, "-test", "false"}); err == nil {
+		t.Errorf("Expected a failing -test to fail the apply")
+	}
+
+	if err := applyCommand([]string{"-f", replyPath, "-branch", "ai/suggestion"}); err != nil {
+		t.Fatalf("apply -branch: %v\n%s", err, reported.String())
+	}
+	if got := git(repo, "show", "ai/suggestion:a.txt"); got != "new" {
+		t.Errorf("Expected the reply's file committed on the branch\n  Actual %q", got)
+	}
+	if got := git(repo, "rev-parse", "--abbrev-ref", "HEAD"); got != "main" {
+		t.Errorf("Expected main to stay checked out\n  Actual %s", got)
+	}
+	if got := read(filepath.Join(repo, "a.txt")); got != "old\n" {
+		t.Errorf("Expected the working tree to be left alone\n  Actual %q", got)
+	}
+	if log := git(repo, "log", "-1", "--format=%B", "ai/suggestion"); !strings.Contains(log, "to a.txt") || !strings.Contains(log, "Reply: new") {
+		t.Errorf("Expected the commit's message to name the file and reply\n  Actual:\n%s", log)
+	}
+	if list := git(repo, "worktree", "list"); strings.Count(list, "\n") != 1 {
+		t.Errorf("Expected the temporary worktree to be removed\n  Actual:\n%s", list)
+	}
+}